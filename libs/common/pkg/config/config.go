@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -27,6 +29,80 @@ type ServerConfig struct {
 	Host string `yaml:"host"`
 	Port int    `yaml:"port"`
 	Mode string `yaml:"mode"` // "development" or "production"
+
+	CORS            CORSConfig            `yaml:"cors"`
+	SecurityHeaders SecurityHeadersConfig `yaml:"security_headers"`
+	BodyLimits      BodyLimitsConfig      `yaml:"body_limits"`
+	Debug           DebugConfig           `yaml:"debug"`
+	SLO             SLOConfig             `yaml:"slo"`
+}
+
+// SLOConfig sets the service level objectives the gateway tracks API
+// requests and tasks against. Without targets, all API requests and all
+// tasks are tracked against defaults.
+type SLOConfig struct {
+	WindowDays   int               `yaml:"window_days"`    // Error budget window (default 30)
+	FastBurnRate float64           `yaml:"fast_burn_rate"` // Budget at risk when burning this fast over 1h (default 14.4)
+	SlowBurnRate float64           `yaml:"slow_burn_rate"` // Budget at risk when burning this fast over 6h (default 6)
+	Targets      []SLOTargetConfig `yaml:"targets"`
+}
+
+// SLOTargetConfig is a service level objective for API requests or for
+// tasks. Requests with a 5xx status and tasks that failed count against
+// Availability; those slower than LatencyMS count against LatencyTarget.
+type SLOTargetConfig struct {
+	Name string `yaml:"name"`
+	// Endpoint selects API requests: "*" for all, a route pattern such as
+	// "/api/v1/vms/{id}", or a method and pattern, "POST /api/v1/vms"
+	Endpoint string `yaml:"endpoint"`
+	// TaskType selects tasks: "*" for all, or a type such as "vm:create"
+	TaskType      string  `yaml:"task_type"`
+	Availability  float64 `yaml:"availability"`   // % that must succeed, e.g. 99.9
+	LatencyMS     int     `yaml:"latency_ms"`     // 0 = no latency objective
+	LatencyTarget float64 `yaml:"latency_target"` // % that must succeed within LatencyMS (default 99)
+}
+
+// DebugConfig enables the runtime diagnostics under /debug/ (pprof
+// profiles, expvar and goroutine dumps) on the gateway and workers. They
+// are off by default. Clients must present Token as a bearer token; without
+// a token, or with LocalhostOnly set, only loopback clients are served.
+type DebugConfig struct {
+	Enabled       bool   `yaml:"enabled"`        // DEBUG_ENDPOINTS=true
+	Token         string `yaml:"token"`          // DEBUG_TOKEN
+	LocalhostOnly bool   `yaml:"localhost_only"` // Serve loopback clients only, even with a token
+}
+
+// BodyLimitsConfig caps request body sizes per route group, in bytes
+// (-1 = unlimited). Larger requests are rejected with 413.
+type BodyLimitsConfig struct {
+	DefaultBytes int64 `yaml:"default_bytes"` // API requests (default 1 MiB)
+	PromptBytes  int64 `yaml:"prompt_bytes"`  // Prompt submissions and smart-execute (default 4 MiB)
+	WebhookBytes int64 `yaml:"webhook_bytes"` // Integration webhooks (default 1 MiB)
+	UploadBytes  int64 `yaml:"upload_bytes"`  // Backup restores, file uploads and previews (default 1 GiB)
+}
+
+// CORSConfig holds the API's cross-origin policy
+type CORSConfig struct {
+	// AllowedOrigins are origins such as "https://app.example.com", or
+	// "https://*.example.com" for subdomains. Empty allows none, except
+	// http://localhost:3000 (the dashboard) in development mode. "*" allows
+	// any origin, without credentials.
+	AllowedOrigins   []string `yaml:"allowed_origins"`
+	AllowedMethods   []string `yaml:"allowed_methods"`
+	AllowedHeaders   []string `yaml:"allowed_headers"`
+	ExposedHeaders   []string `yaml:"exposed_headers"`
+	AllowCredentials bool     `yaml:"allow_credentials"`
+	MaxAgeSeconds    int      `yaml:"max_age_seconds"` // How long browsers cache preflights
+}
+
+// SecurityHeadersConfig holds the security headers set on API and UI responses
+type SecurityHeadersConfig struct {
+	HSTSMaxAgeSeconds     int    `yaml:"hsts_max_age_seconds"` // Sent over HTTPS only; -1 disables
+	HSTSIncludeSubdomains bool   `yaml:"hsts_include_subdomains"`
+	FrameOptions          string `yaml:"frame_options"`   // X-Frame-Options: DENY or SAMEORIGIN; "off" disables
+	ReferrerPolicy        string `yaml:"referrer_policy"` // "off" disables
+	// UIContentSecurityPolicy is the Content-Security-Policy of the web UI
+	UIContentSecurityPolicy string `yaml:"ui_content_security_policy"`
 }
 
 // DatabaseConfig holds database configuration
@@ -39,6 +115,19 @@ type DatabaseConfig struct {
 	SSLMode      string `yaml:"sslmode"`
 	MaxOpenConns int    `yaml:"max_open_conns"`
 	MaxIdleConns int    `yaml:"max_idle_conns"`
+
+	// CacheTTLSeconds enables the store's read cache for environments and
+	// workspaces; 0 disables it
+	CacheTTLSeconds int `yaml:"cache_ttl_seconds"`
+
+	// ReadReplicas are DSNs of read replicas for plain reads; replicas
+	// lagging by more than MaxReplicaLagSeconds (default 5) are skipped
+	ReadReplicas         []string `yaml:"read_replicas"`
+	MaxReplicaLagSeconds int      `yaml:"max_replica_lag_seconds"`
+
+	// TranscriptChain hash-chains executions and finished prompts so their
+	// history is tamper-evident; set it on every gateway and worker
+	TranscriptChain bool `yaml:"transcript_chain"`
 }
 
 // RedisConfig holds Redis configuration
@@ -52,6 +141,26 @@ type RedisConfig struct {
 type QueueConfig struct {
 	Concurrency int            `yaml:"concurrency"`
 	Queues      map[string]int `yaml:"queues"`
+
+	// Policies override the built-in retry, backoff and timeout policy of
+	// task types, keyed by type (e.g. "vm:create"). Unset fields keep the
+	// built-in values.
+	Policies map[string]TaskPolicyConfig `yaml:"policies"`
+
+	// Lanes reserves concurrency per workload class, "interactive" or
+	// "batch", and gives each class queues of its own. Without it all
+	// classes share the same queues. Gateways and workers must agree on
+	// whether lanes are enabled.
+	Lanes map[string]int `yaml:"lanes"`
+}
+
+// TaskPolicyConfig is the retry, backoff and timeout policy of a task type
+type TaskPolicyConfig struct {
+	MaxRetry           *int   `yaml:"max_retry"` // Retries after the first attempt; 0 disables retries
+	TimeoutSeconds     int    `yaml:"timeout_seconds"`
+	Backoff            string `yaml:"backoff"` // "exponential" or "constant"
+	BackoffBaseSeconds int    `yaml:"backoff_base_seconds"`
+	BackoffMaxSeconds  int    `yaml:"backoff_max_seconds"`
 }
 
 // VMMConfig holds VMM configuration
@@ -66,13 +175,31 @@ type FirecrackerConfig struct {
 	KernelPath      string `yaml:"kernel_path"`
 	RootFSTemplate  string `yaml:"rootfs_template"`
 	SocketDir       string `yaml:"socket_dir"`
+	StateDir        string `yaml:"state_dir"`
 	DefaultVCPU     int    `yaml:"default_vcpu"`
 	DefaultMemoryMB int    `yaml:"default_memory_mb"`
+
+	// API socket timeouts and boot retries (0 = orchestrator default)
+	SocketWaitTimeoutSeconds int `yaml:"socket_wait_timeout_seconds"` // Wait for firecracker to create its API socket
+	APITimeoutMS             int `yaml:"api_timeout_ms"`              // Per API call
+	APIRetries               int `yaml:"api_retries"`                 // Boot retries after an API failure (-1 disables)
+	APIRetryBackoffMS        int `yaml:"api_retry_backoff_ms"`        // Delay before the first retry, doubled for each one
+
+	// Integrity verification (both optional)
+	RootFSChecksum string `yaml:"rootfs_checksum"`  // Expected "sha256:<hex>" of the rootfs template
+	AgentPublicKey string `yaml:"agent_public_key"` // PEM ed25519 key the fc-agent binary must be signed with
 }
 
 // DockerConfig holds Docker-specific configuration
 type DockerConfig struct {
 	Network string `yaml:"network"`
+	Image   string `yaml:"image"`
+
+	// Windows guests run as Windows containers; set on workers with the
+	// docker-windows capability
+	Windows        bool   `yaml:"windows"`
+	WindowsImage   string `yaml:"windows_image"`
+	WindowsNetwork string `yaml:"windows_network"`
 }
 
 // LoggingConfig holds logging configuration
@@ -119,12 +246,32 @@ type LokiConfig struct {
 
 // NetworkConfig holds network configuration
 type NetworkConfig struct {
-	BridgeName string      `yaml:"bridge_name"`
-	BridgeIP   string      `yaml:"bridge_ip"`
-	SubnetCIDR string      `yaml:"subnet_cidr"`
-	TAPPrefix  string      `yaml:"tap_prefix"`
-	EnableNAT  bool        `yaml:"enable_nat"`
-	Proxy      ProxyConfig `yaml:"proxy"`
+	BridgeName string       `yaml:"bridge_name"`
+	BridgeIP   string       `yaml:"bridge_ip"`
+	SubnetCIDR string       `yaml:"subnet_cidr"`
+	TAPPrefix  string       `yaml:"tap_prefix"`
+	EnableNAT  bool         `yaml:"enable_nat"`
+	IPv6       IPv6Config   `yaml:"ipv6"`
+	Proxy      ProxyConfig  `yaml:"proxy"`
+	Mirrors    MirrorConfig `yaml:"mirrors"`
+}
+
+// MirrorConfig points VMs at host-level caches for tool installs. Each
+// field is optional; unset ones leave the VM's default in place.
+type MirrorConfig struct {
+	DNS     string `yaml:"dns"`      // Caching resolver address, e.g. dnsmasq on the bridge IP
+	APT     string `yaml:"apt"`      // HTTP proxy for apt, e.g. apt-cacher-ng at "http://172.16.0.1:3142"
+	NPM     string `yaml:"npm"`      // npm registry URL, e.g. a Verdaccio proxy
+	PyPI    string `yaml:"pypi"`     // pip index URL, e.g. a devpi mirror
+	GoProxy string `yaml:"go_proxy"` // GOPROXY URL, e.g. an Athens proxy
+}
+
+// IPv6Config holds dual-stack network configuration
+type IPv6Config struct {
+	Enabled    bool   `yaml:"enabled"`
+	BridgeIP   string `yaml:"bridge_ip"`
+	SubnetCIDR string `yaml:"subnet_cidr"` // must be a /64
+	Mode       string `yaml:"mode"`        // "static" or "slaac"
 }
 
 // ProxyConfig holds proxy configuration
@@ -170,6 +317,15 @@ func Load(path string) (*Config, error) {
 	return &config, nil
 }
 
+// New returns a configuration with environment overrides and defaults
+// applied, for binaries started without a config file
+func New() *Config {
+	var config Config
+	config.applyEnvOverrides()
+	config.setDefaults()
+	return &config
+}
+
 // applyEnvOverrides applies environment variable overrides
 func (c *Config) applyEnvOverrides() {
 	if dbHost := os.Getenv("DB_HOST"); dbHost != "" {
@@ -184,6 +340,41 @@ func (c *Config) applyEnvOverrides() {
 	if redisPass := os.Getenv("REDIS_PASSWORD"); redisPass != "" {
 		c.Redis.Password = redisPass
 	}
+
+	// Workload lanes as "interactive=4,batch=2"
+	if lanes := os.Getenv("QUEUE_LANES"); lanes != "" {
+		c.Queue.Lanes = make(map[string]int)
+		for _, lane := range strings.Split(lanes, ",") {
+			class, slots, _ := strings.Cut(strings.TrimSpace(lane), "=")
+			n, err := strconv.Atoi(strings.TrimSpace(slots))
+			if err != nil {
+				n = -1 // Rejected when the queue is created
+			}
+			c.Queue.Lanes[strings.TrimSpace(class)] = n
+		}
+	}
+
+	// Provider selection
+	if provider := os.Getenv("STORAGE_PROVIDER"); provider != "" {
+		c.Storage.Provider = provider
+	}
+	if provider := os.Getenv("TASK_QUEUE_PROVIDER"); provider != "" {
+		c.TaskQueue.Provider = provider
+	}
+	if provider := os.Getenv("EVENT_BUS_PROVIDER"); provider != "" {
+		c.EventBus.Provider = provider
+	}
+	if provider := os.Getenv("LOG_PROVIDER"); provider != "" {
+		c.Logging.Provider = provider
+	}
+
+	// Runtime diagnostics
+	if enabled := os.Getenv("DEBUG_ENDPOINTS"); enabled != "" {
+		c.Server.Debug.Enabled = enabled == "true" || enabled == "1"
+	}
+	if token := os.Getenv("DEBUG_TOKEN"); token != "" {
+		c.Server.Debug.Token = token
+	}
 }
 
 // setDefaults sets default values if not specified
@@ -198,12 +389,82 @@ func (c *Config) setDefaults() {
 		c.Server.Mode = "development"
 	}
 
+	// CORS defaults: same-origin only, but for the dashboard's dev server
+	if c.Server.CORS.AllowedOrigins == nil && c.Server.Mode == "development" {
+		c.Server.CORS.AllowedOrigins = []string{"http://localhost:3000"}
+	}
+	if len(c.Server.CORS.AllowedMethods) == 0 {
+		c.Server.CORS.AllowedMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	}
+	if len(c.Server.CORS.AllowedHeaders) == 0 {
+		c.Server.CORS.AllowedHeaders = []string{"Accept", "Authorization", "Content-Type"}
+	}
+	if c.Server.CORS.ExposedHeaders == nil {
+		c.Server.CORS.ExposedHeaders = []string{"Link"}
+	}
+	if c.Server.CORS.MaxAgeSeconds == 0 {
+		c.Server.CORS.MaxAgeSeconds = 300
+	}
+
+	// Body limit defaults
+	if c.Server.BodyLimits.DefaultBytes == 0 {
+		c.Server.BodyLimits.DefaultBytes = 1 << 20
+	}
+	if c.Server.BodyLimits.PromptBytes == 0 {
+		c.Server.BodyLimits.PromptBytes = 4 << 20
+	}
+	if c.Server.BodyLimits.WebhookBytes == 0 {
+		c.Server.BodyLimits.WebhookBytes = 1 << 20
+	}
+	if c.Server.BodyLimits.UploadBytes == 0 {
+		c.Server.BodyLimits.UploadBytes = 1 << 30
+	}
+
+	// SLO defaults
+	if c.Server.SLO.WindowDays == 0 {
+		c.Server.SLO.WindowDays = 30
+	}
+	if c.Server.SLO.FastBurnRate == 0 {
+		c.Server.SLO.FastBurnRate = 14.4
+	}
+	if c.Server.SLO.SlowBurnRate == 0 {
+		c.Server.SLO.SlowBurnRate = 6
+	}
+
+	// Security header defaults
+	if c.Server.SecurityHeaders.HSTSMaxAgeSeconds == 0 {
+		c.Server.SecurityHeaders.HSTSMaxAgeSeconds = 31536000 // 1 year
+	}
+	if c.Server.SecurityHeaders.FrameOptions == "" {
+		c.Server.SecurityHeaders.FrameOptions = "DENY"
+	}
+	if c.Server.SecurityHeaders.ReferrerPolicy == "" {
+		c.Server.SecurityHeaders.ReferrerPolicy = "strict-origin-when-cross-origin"
+	}
+	if c.Server.SecurityHeaders.UIContentSecurityPolicy == "" {
+		// The UI is a single page with inline script and styles that calls
+		// the API on its own origin
+		c.Server.SecurityHeaders.UIContentSecurityPolicy = "default-src 'self'; " +
+			"script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; " +
+			"img-src 'self' data:; connect-src 'self'; frame-ancestors 'none'; " +
+			"base-uri 'self'; form-action 'self'"
+	}
+
 	if c.Database.Host == "" {
 		c.Database.Host = "localhost"
 	}
 	if c.Database.Port == 0 {
 		c.Database.Port = 5432
 	}
+	if c.Database.User == "" {
+		c.Database.User = "aetherium"
+	}
+	if c.Database.Password == "" {
+		c.Database.Password = "aetherium"
+	}
+	if c.Database.Database == "" {
+		c.Database.Database = "aetherium"
+	}
 	if c.Database.SSLMode == "" {
 		c.Database.SSLMode = "disable"
 	}
@@ -258,6 +519,15 @@ func (c *Config) setDefaults() {
 		c.Network.TAPPrefix = "aether-"
 	}
 	// EnableNAT defaults to false if not specified (zero value)
+	if c.Network.IPv6.BridgeIP == "" {
+		c.Network.IPv6.BridgeIP = "fd00:ae::1/64"
+	}
+	if c.Network.IPv6.SubnetCIDR == "" {
+		c.Network.IPv6.SubnetCIDR = "fd00:ae::/64"
+	}
+	if c.Network.IPv6.Mode == "" {
+		c.Network.IPv6.Mode = "static"
+	}
 
 	// Proxy defaults
 	if c.Network.Proxy.Provider == "" {
@@ -405,3 +675,28 @@ func GetStringOrDefault(cfg map[string]interface{}, key string, defaultVal strin
 	}
 	return defaultVal
 }
+
+// GetStringSliceOrDefault returns a string list from config with a default
+// fallback. YAML lists decode as []interface{}; non-string items are skipped.
+func GetStringSliceOrDefault(cfg map[string]interface{}, key string, defaultVal []string) []string {
+	if cfg == nil {
+		return defaultVal
+	}
+	val, ok := cfg[key]
+	if !ok {
+		return defaultVal
+	}
+	switch v := val.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return defaultVal
+}
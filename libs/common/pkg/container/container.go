@@ -3,6 +3,7 @@ package container
 import (
 	"context"
 	"fmt"
+	"log"
 	"sync"
 
 	"github.com/aetherium/aetherium/libs/common/pkg/config"
@@ -14,21 +15,29 @@ import (
 	"github.com/aetherium/aetherium/services/gateway/pkg/integrations"
 )
 
-// Container is a dependency injection container for managing component lifecycle
+// ProviderNone disables an optional component (logger, event bus)
+const ProviderNone = "none"
+
+// Container is a dependency injection container for managing component lifecycle.
+//
+// Binaries register factories for the components they use; components
+// without a registered factory are skipped by Initialize and their getters
+// return nil. Which provider each factory builds comes from the config, so
+// tests can swap in in-memory providers or their own factories.
 type Container struct {
 	config *config.Config
 
 	// Singletons
-	taskQueue    queue.TaskQueue
-	stateStore   storage.StateStore
+	queue        queue.Queue
+	store        storage.Store
 	logger       logging.Logger
 	vmOrch       vmm.VMOrchestrator
 	eventBus     events.EventBus
 	integrations map[string]integrations.Integration
 
 	// Factories
-	taskQueueFactory      TaskQueueFactory
-	stateStoreFactory     StateStoreFactory
+	queueFactory          QueueFactory
+	storeFactory          StoreFactory
 	loggerFactory         LoggerFactory
 	vmOrchestratorFactory VMOrchestratorFactory
 	eventBusFactory       EventBusFactory
@@ -46,18 +55,23 @@ func New(cfg *config.Config) *Container {
 	}
 }
 
-// RegisterTaskQueueFactory registers a factory for task queue providers
-func (c *Container) RegisterTaskQueueFactory(factory TaskQueueFactory) {
+// Config returns the configuration the container was created with
+func (c *Container) Config() *config.Config {
+	return c.config
+}
+
+// RegisterQueueFactory registers a factory for task queue providers
+func (c *Container) RegisterQueueFactory(factory QueueFactory) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.taskQueueFactory = factory
+	c.queueFactory = factory
 }
 
-// RegisterStateStoreFactory registers a factory for state store providers
-func (c *Container) RegisterStateStoreFactory(factory StateStoreFactory) {
+// RegisterStoreFactory registers a factory for storage providers
+func (c *Container) RegisterStoreFactory(factory StoreFactory) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.stateStoreFactory = factory
+	c.storeFactory = factory
 }
 
 // RegisterLoggerFactory registers a factory for logger providers
@@ -86,24 +100,21 @@ func (c *Container) RegisterIntegration(integration integrations.Integration) er
 	return c.integrationRegistry.Register(integration)
 }
 
-// Initialize initializes all components based on configuration
+// Initialize initializes all components based on configuration. The
+// logger and event bus are optional: if they fail, a warning is logged and
+// they are left nil.
 func (c *Container) Initialize(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// Initialize TaskQueue
-	if err := c.initTaskQueue(ctx); err != nil {
-		return fmt.Errorf("failed to initialize task queue: %w", err)
-	}
-
-	// Initialize StateStore
-	if err := c.initStateStore(ctx); err != nil {
-		return fmt.Errorf("failed to initialize state store: %w", err)
+	// Initialize Store
+	if err := c.initStore(ctx); err != nil {
+		return fmt.Errorf("failed to initialize store: %w", err)
 	}
 
-	// Initialize Logger
-	if err := c.initLogger(ctx); err != nil {
-		return fmt.Errorf("failed to initialize logger: %w", err)
+	// Initialize Queue
+	if err := c.initQueue(ctx); err != nil {
+		return fmt.Errorf("failed to initialize task queue: %w", err)
 	}
 
 	// Initialize VMOrchestrator
@@ -111,9 +122,14 @@ func (c *Container) Initialize(ctx context.Context) error {
 		return fmt.Errorf("failed to initialize VM orchestrator: %w", err)
 	}
 
+	// Initialize Logger
+	if err := c.initLogger(ctx); err != nil {
+		log.Printf("Warning: Failed to initialize logger: %v", err)
+	}
+
 	// Initialize EventBus
 	if err := c.initEventBus(ctx); err != nil {
-		return fmt.Errorf("failed to initialize event bus: %w", err)
+		log.Printf("Warning: Failed to initialize event bus: %v", err)
 	}
 
 	// Initialize Integrations
@@ -124,47 +140,78 @@ func (c *Container) Initialize(ctx context.Context) error {
 	return nil
 }
 
-func (c *Container) initTaskQueue(ctx context.Context) error {
-	if c.taskQueueFactory == nil {
-		return fmt.Errorf("task queue factory not registered")
+func (c *Container) initStore(ctx context.Context) error {
+	if c.storeFactory == nil {
+		return nil
 	}
 
-	provider := c.config.TaskQueue.Provider
-	providerConfig := c.config.TaskQueue.Config
-
-	tq, err := c.taskQueueFactory.Create(ctx, provider, providerConfig)
+	provider := c.config.Storage.Provider
+	providerConfig := mergeConfig(map[string]interface{}{
+		"host":                    c.config.Database.Host,
+		"port":                    c.config.Database.Port,
+		"user":                    c.config.Database.User,
+		"password":                c.config.Database.Password,
+		"database":                c.config.Database.Database,
+		"sslmode":                 c.config.Database.SSLMode,
+		"max_open_conns":          c.config.Database.MaxOpenConns,
+		"max_idle_conns":          c.config.Database.MaxIdleConns,
+		"cache_ttl_seconds":       c.config.Database.CacheTTLSeconds,
+		"read_replicas":           c.config.Database.ReadReplicas,
+		"max_replica_lag_seconds": c.config.Database.MaxReplicaLagSeconds,
+		"transcript_chain":        c.config.Database.TranscriptChain,
+	}, c.config.Storage.Config)
+
+	store, err := c.storeFactory.Create(ctx, provider, providerConfig)
 	if err != nil {
-		return fmt.Errorf("failed to create task queue provider '%s': %w", provider, err)
+		return fmt.Errorf("failed to create store provider '%s': %w", provider, err)
 	}
 
-	c.taskQueue = tq
+	c.store = store
 	return nil
 }
 
-func (c *Container) initStateStore(ctx context.Context) error {
-	if c.stateStoreFactory == nil {
-		return fmt.Errorf("state store factory not registered")
+func (c *Container) initQueue(ctx context.Context) error {
+	if c.queueFactory == nil {
+		return nil
 	}
 
-	provider := c.config.Storage.Provider
-	providerConfig := c.config.Storage.Config
-
-	store, err := c.stateStoreFactory.Create(ctx, provider, providerConfig)
+	provider := c.config.TaskQueue.Provider
+	providerConfig := mergeConfig(map[string]interface{}{
+		"addr":        c.config.Redis.Addr,
+		"password":    c.config.Redis.Password,
+		"db":          c.config.Redis.DB,
+		"concurrency": c.config.Queue.Concurrency,
+		"queues":      c.config.Queue.Queues,
+		"policies":    c.config.Queue.Policies,
+		"lanes":       c.config.Queue.Lanes,
+	}, c.config.TaskQueue.Config)
+
+	q, err := c.queueFactory.Create(ctx, provider, providerConfig)
 	if err != nil {
-		return fmt.Errorf("failed to create state store provider '%s': %w", provider, err)
+		return fmt.Errorf("failed to create task queue provider '%s': %w", provider, err)
 	}
 
-	c.stateStore = store
+	// Record every task so VMs and workspaces have a task history
+	if c.store != nil {
+		q = queue.WithHistory(q, c.store.Tasks())
+	}
+
+	c.queue = q
 	return nil
 }
 
 func (c *Container) initLogger(ctx context.Context) error {
-	if c.loggerFactory == nil {
-		return fmt.Errorf("logger factory not registered")
+	provider := c.config.Logging.Provider
+	if c.loggerFactory == nil || provider == ProviderNone {
+		return nil
 	}
 
-	provider := c.config.Logging.Provider
-	providerConfig := c.config.Logging.Config
+	providerConfig := mergeConfig(map[string]interface{}{
+		"url":            c.config.Logging.Loki.URL,
+		"batch_size":     c.config.Logging.Loki.BatchSize,
+		"batch_interval": c.config.Logging.Loki.BatchInterval,
+		"labels":         c.config.Logging.Loki.Labels,
+	}, c.config.Logging.Config)
 
 	logger, err := c.loggerFactory.Create(ctx, provider, providerConfig)
 	if err != nil {
@@ -177,7 +224,7 @@ func (c *Container) initLogger(ctx context.Context) error {
 
 func (c *Container) initVMOrchestrator(ctx context.Context) error {
 	if c.vmOrchestratorFactory == nil {
-		return fmt.Errorf("VM orchestrator factory not registered")
+		return nil
 	}
 
 	provider := c.config.VMM.DefaultOrchestrator
@@ -187,10 +234,30 @@ func (c *Container) initVMOrchestrator(ctx context.Context) error {
 		providerConfig["kernel_path"] = c.config.VMM.Firecracker.KernelPath
 		providerConfig["rootfs_template"] = c.config.VMM.Firecracker.RootFSTemplate
 		providerConfig["socket_dir"] = c.config.VMM.Firecracker.SocketDir
+		providerConfig["state_dir"] = c.config.VMM.Firecracker.StateDir
 		providerConfig["default_vcpu"] = c.config.VMM.Firecracker.DefaultVCPU
 		providerConfig["default_memory_mb"] = c.config.VMM.Firecracker.DefaultMemoryMB
+		providerConfig["socket_wait_timeout_seconds"] = c.config.VMM.Firecracker.SocketWaitTimeoutSeconds
+		providerConfig["api_timeout_ms"] = c.config.VMM.Firecracker.APITimeoutMS
+		providerConfig["api_retries"] = c.config.VMM.Firecracker.APIRetries
+		providerConfig["api_retry_backoff_ms"] = c.config.VMM.Firecracker.APIRetryBackoffMS
+		providerConfig["rootfs_checksum"] = c.config.VMM.Firecracker.RootFSChecksum
+		providerConfig["agent_public_key"] = c.config.VMM.Firecracker.AgentPublicKey
+		if c.config.Network.IPv6.Enabled {
+			providerConfig["ipv6_bridge_ip"] = c.config.Network.IPv6.BridgeIP
+			providerConfig["ipv6_subnet_cidr"] = c.config.Network.IPv6.SubnetCIDR
+			providerConfig["ipv6_mode"] = c.config.Network.IPv6.Mode
+		}
 	} else if provider == "docker" {
 		providerConfig["network"] = c.config.VMM.Docker.Network
+		providerConfig["image"] = c.config.VMM.Docker.Image
+		providerConfig["windows"] = c.config.VMM.Docker.Windows
+		if c.config.VMM.Docker.WindowsImage != "" {
+			providerConfig["windows_image"] = c.config.VMM.Docker.WindowsImage
+		}
+		if c.config.VMM.Docker.WindowsNetwork != "" {
+			providerConfig["windows_network"] = c.config.VMM.Docker.WindowsNetwork
+		}
 	}
 
 	orch, err := c.vmOrchestratorFactory.Create(ctx, provider, providerConfig)
@@ -203,12 +270,16 @@ func (c *Container) initVMOrchestrator(ctx context.Context) error {
 }
 
 func (c *Container) initEventBus(ctx context.Context) error {
-	if c.eventBusFactory == nil {
-		return fmt.Errorf("event bus factory not registered")
+	provider := c.config.EventBus.Provider
+	if c.eventBusFactory == nil || provider == ProviderNone {
+		return nil
 	}
 
-	provider := c.config.EventBus.Provider
-	providerConfig := c.config.EventBus.Config
+	providerConfig := mergeConfig(map[string]interface{}{
+		"addr":     c.config.Redis.Addr,
+		"password": c.config.Redis.Password,
+		"db":       c.config.Redis.DB,
+	}, c.config.EventBus.Config)
 
 	bus, err := c.eventBusFactory.Create(ctx, provider, providerConfig)
 	if err != nil {
@@ -242,21 +313,30 @@ func (c *Container) initIntegrations(ctx context.Context) error {
 	return nil
 }
 
-// GetTaskQueue returns the task queue instance
-func (c *Container) GetTaskQueue() queue.TaskQueue {
+// mergeConfig returns the settings from the typed config sections with the
+// provider-specific config map layered on top
+func mergeConfig(base, overrides map[string]interface{}) map[string]interface{} {
+	for k, v := range overrides {
+		base[k] = v
+	}
+	return base
+}
+
+// GetQueue returns the task queue instance
+func (c *Container) GetQueue() queue.Queue {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.taskQueue
+	return c.queue
 }
 
-// GetStateStore returns the state store instance
-func (c *Container) GetStateStore() storage.StateStore {
+// GetStore returns the store instance
+func (c *Container) GetStore() storage.Store {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.stateStore
+	return c.store
 }
 
-// GetLogger returns the logger instance
+// GetLogger returns the logger instance, or nil if logging is disabled
 func (c *Container) GetLogger() logging.Logger {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -270,7 +350,7 @@ func (c *Container) GetVMOrchestrator() vmm.VMOrchestrator {
 	return c.vmOrch
 }
 
-// GetEventBus returns the event bus instance
+// GetEventBus returns the event bus instance, or nil if it is disabled
 func (c *Container) GetEventBus() events.EventBus {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -290,7 +370,8 @@ func (c *Container) GetIntegration(name string) (integrations.Integration, error
 	return integration, nil
 }
 
-// Shutdown gracefully shuts down all components
+// Shutdown closes the components the container created. The queue is
+// left running; binaries stop it themselves once in-flight work is done.
 func (c *Container) Shutdown(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -304,8 +385,23 @@ func (c *Container) Shutdown(ctx context.Context) error {
 		}
 	}
 
-	// Shutdown other components if they implement Shutdown
-	// This would require adding Shutdown methods to interfaces in future
+	if c.eventBus != nil {
+		if err := c.eventBus.Close(); err != nil {
+			errors = append(errors, fmt.Errorf("event bus: %w", err))
+		}
+	}
+
+	if c.logger != nil {
+		if err := c.logger.Close(); err != nil {
+			errors = append(errors, fmt.Errorf("logger: %w", err))
+		}
+	}
+
+	if c.store != nil {
+		if err := c.store.Close(); err != nil {
+			errors = append(errors, fmt.Errorf("store: %w", err))
+		}
+	}
 
 	if len(errors) > 0 {
 		return fmt.Errorf("shutdown errors: %v", errors)
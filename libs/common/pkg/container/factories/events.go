@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/aetherium/aetherium/libs/common/pkg/config"
 	"github.com/aetherium/aetherium/libs/common/pkg/events"
 	memoryevents "github.com/aetherium/aetherium/libs/common/pkg/events/memory"
+	redisevents "github.com/aetherium/aetherium/libs/common/pkg/events/redis"
 )
 
 // DefaultEventBusFactory creates EventBus instances
@@ -22,8 +24,11 @@ func (f *DefaultEventBusFactory) Create(ctx context.Context, provider string, cf
 	case "memory":
 		return memoryevents.NewMemoryEventBus(), nil
 	case "redis":
-		// TODO: Implement Redis event bus (pub/sub)
-		return nil, fmt.Errorf("redis event bus not yet implemented")
+		return redisevents.NewRedisEventBus(&redisevents.Config{
+			Addr:     config.GetStringOrDefault(cfg, "addr", "localhost:6379"),
+			Password: config.GetStringOrDefault(cfg, "password", ""),
+			DB:       config.GetIntOrDefault(cfg, "db", 0),
+		})
 	default:
 		return nil, fmt.Errorf("unsupported event bus provider: %s", provider)
 	}
@@ -3,9 +3,11 @@ package factories
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/aetherium/aetherium/libs/common/pkg/config"
 	"github.com/aetherium/aetherium/libs/common/pkg/logging"
+	"github.com/aetherium/aetherium/libs/common/pkg/logging/loki"
 	"github.com/aetherium/aetherium/libs/common/pkg/logging/stdout"
 )
 
@@ -24,8 +26,21 @@ func (f *DefaultLoggerFactory) Create(ctx context.Context, provider string, cfg
 		colorize := config.GetBoolOrDefault(cfg, "colorize", true)
 		return stdout.NewStdoutLogger(colorize), nil
 	case "loki":
-		// TODO: Implement Loki logger
-		return nil, fmt.Errorf("loki logger not yet implemented")
+		var batchInterval time.Duration
+		if interval := config.GetStringOrDefault(cfg, "batch_interval", ""); interval != "" {
+			d, err := time.ParseDuration(interval)
+			if err != nil {
+				return nil, fmt.Errorf("invalid loki batch_interval: %w", err)
+			}
+			batchInterval = d
+		}
+		labels, _ := cfg["labels"].(map[string]string)
+		return loki.NewLokiLogger(&loki.Config{
+			URL:           config.GetStringOrDefault(cfg, "url", ""),
+			BatchSize:     config.GetIntOrDefault(cfg, "batch_size", 100),
+			BatchInterval: batchInterval,
+			Labels:        labels,
+		})
 	default:
 		return nil, fmt.Errorf("unsupported logger provider: %s", provider)
 	}
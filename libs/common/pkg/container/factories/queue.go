@@ -3,13 +3,15 @@ package factories
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/aetherium/aetherium/libs/common/pkg/config"
 	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/queue/asynq"
 	"github.com/aetherium/aetherium/services/core/pkg/queue/memory"
 )
 
-// DefaultQueueFactory creates TaskQueue instances
+// DefaultQueueFactory creates Queue instances
 type DefaultQueueFactory struct{}
 
 // NewQueueFactory creates a new queue factory
@@ -17,22 +19,75 @@ func NewQueueFactory() *DefaultQueueFactory {
 	return &DefaultQueueFactory{}
 }
 
-// Create creates a TaskQueue based on the provider name
-func (f *DefaultQueueFactory) Create(ctx context.Context, provider string, cfg map[string]interface{}) (queue.TaskQueue, error) {
+// Create creates a Queue based on the provider name
+func (f *DefaultQueueFactory) Create(ctx context.Context, provider string, cfg map[string]interface{}) (queue.Queue, error) {
 	switch provider {
 	case "memory":
 		bufferSize := config.GetIntOrDefault(cfg, "buffer_size", 100)
-		workers := config.GetIntOrDefault(cfg, "workers", 1)
-		return memory.NewMemoryQueue(bufferSize, workers), nil
-	case "redis":
-		// TODO: Implement Redis queue with Asynq
-		return nil, fmt.Errorf("redis queue not yet implemented")
+		concurrency := config.GetIntOrDefault(cfg, "concurrency", 1)
+		return memory.NewLocalQueue(bufferSize, concurrency), nil
+	case "asynq", "redis":
+		queues, _ := cfg["queues"].(map[string]int)
+		policies, err := taskPolicies(cfg["policies"])
+		if err != nil {
+			return nil, err
+		}
+		var lanes queue.Lanes
+		if slots, _ := cfg["lanes"].(map[string]int); len(slots) > 0 {
+			if lanes, err = queue.NewLanes(slots); err != nil {
+				return nil, fmt.Errorf("queue lanes: %w", err)
+			}
+		}
+		return asynq.NewQueue(asynq.Config{
+			RedisAddr:     config.GetStringOrDefault(cfg, "addr", "localhost:6379"),
+			RedisPassword: config.GetStringOrDefault(cfg, "password", ""),
+			RedisDB:       config.GetIntOrDefault(cfg, "db", 0),
+			Concurrency:   config.GetIntOrDefault(cfg, "concurrency", 10),
+			Queues:        queues,
+			Policies:      policies,
+			Lanes:         lanes,
+		})
 	default:
 		return nil, fmt.Errorf("unsupported queue provider: %s", provider)
 	}
 }
 
+// taskPolicies applies the configured policy overrides to the built-in
+// policies of their task types
+func taskPolicies(value interface{}) (queue.Policies, error) {
+	overrides, _ := value.(map[string]config.TaskPolicyConfig)
+	policies := make(queue.Policies, len(overrides))
+	for name, override := range overrides {
+		taskType := queue.TaskType(name)
+		policy := policies.For(taskType)
+		if override.MaxRetry != nil {
+			if *override.MaxRetry < 0 {
+				return nil, fmt.Errorf("queue policy %s: max_retry must not be negative", name)
+			}
+			policy.MaxRetry = *override.MaxRetry
+		}
+		if override.TimeoutSeconds > 0 {
+			policy.Timeout = time.Duration(override.TimeoutSeconds) * time.Second
+		}
+		switch override.Backoff {
+		case "":
+		case queue.BackoffExponential, queue.BackoffConstant:
+			policy.Backoff = override.Backoff
+		default:
+			return nil, fmt.Errorf("queue policy %s: unknown backoff %q", name, override.Backoff)
+		}
+		if override.BackoffBaseSeconds > 0 {
+			policy.BackoffBase = time.Duration(override.BackoffBaseSeconds) * time.Second
+		}
+		if override.BackoffMaxSeconds > 0 {
+			policy.BackoffMax = time.Duration(override.BackoffMaxSeconds) * time.Second
+		}
+		policies[taskType] = policy
+	}
+	return policies, nil
+}
+
 // SupportedProviders returns list of supported providers
 func (f *DefaultQueueFactory) SupportedProviders() []string {
-	return []string{"memory", "redis"}
+	return []string{"memory", "asynq", "redis"}
 }
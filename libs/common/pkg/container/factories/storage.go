@@ -3,12 +3,14 @@ package factories
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/aetherium/aetherium/libs/common/pkg/config"
 	"github.com/aetherium/aetherium/services/core/pkg/storage"
-	memorystorage "github.com/aetherium/aetherium/services/core/pkg/storage/memory"
+	"github.com/aetherium/aetherium/services/core/pkg/storage/postgres"
 )
 
-// DefaultStorageFactory creates StateStore instances
+// DefaultStorageFactory creates Store instances
 type DefaultStorageFactory struct{}
 
 // NewStorageFactory creates a new storage factory
@@ -16,14 +18,24 @@ func NewStorageFactory() *DefaultStorageFactory {
 	return &DefaultStorageFactory{}
 }
 
-// Create creates a StateStore based on the provider name
-func (f *DefaultStorageFactory) Create(ctx context.Context, provider string, cfg map[string]interface{}) (storage.StateStore, error) {
+// Create creates a Store based on the provider name
+func (f *DefaultStorageFactory) Create(ctx context.Context, provider string, cfg map[string]interface{}) (storage.Store, error) {
 	switch provider {
-	case "memory":
-		return memorystorage.NewMemoryStore(), nil
 	case "postgres":
-		// TODO: Implement PostgreSQL store
-		return nil, fmt.Errorf("postgres store not yet implemented")
+		return postgres.NewStore(postgres.Config{
+			Host:            config.GetStringOrDefault(cfg, "host", "localhost"),
+			Port:            config.GetIntOrDefault(cfg, "port", 5432),
+			User:            config.GetStringOrDefault(cfg, "user", "aetherium"),
+			Password:        config.GetStringOrDefault(cfg, "password", ""),
+			Database:        config.GetStringOrDefault(cfg, "database", "aetherium"),
+			SSLMode:         config.GetStringOrDefault(cfg, "sslmode", "disable"),
+			MaxOpenConns:    config.GetIntOrDefault(cfg, "max_open_conns", 0),
+			MaxIdleConns:    config.GetIntOrDefault(cfg, "max_idle_conns", 0),
+			CacheTTL:        time.Duration(config.GetIntOrDefault(cfg, "cache_ttl_seconds", 0)) * time.Second,
+			ReplicaDSNs:     config.GetStringSliceOrDefault(cfg, "read_replicas", nil),
+			MaxReplicaLag:   time.Duration(config.GetIntOrDefault(cfg, "max_replica_lag_seconds", 0)) * time.Second,
+			TranscriptChain: config.GetBoolOrDefault(cfg, "transcript_chain", false),
+		})
 	default:
 		return nil, fmt.Errorf("unsupported storage provider: %s", provider)
 	}
@@ -31,5 +43,5 @@ func (f *DefaultStorageFactory) Create(ctx context.Context, provider string, cfg
 
 // SupportedProviders returns list of supported providers
 func (f *DefaultStorageFactory) SupportedProviders() []string {
-	return []string{"memory", "postgres"}
+	return []string{"postgres"}
 }
@@ -10,15 +10,15 @@ import (
 	"github.com/aetherium/aetherium/services/core/pkg/vmm"
 )
 
-// TaskQueueFactory creates TaskQueue instances based on provider name
-type TaskQueueFactory interface {
-	Create(ctx context.Context, provider string, config map[string]interface{}) (queue.TaskQueue, error)
+// QueueFactory creates Queue instances based on provider name
+type QueueFactory interface {
+	Create(ctx context.Context, provider string, config map[string]interface{}) (queue.Queue, error)
 	SupportedProviders() []string
 }
 
-// StateStoreFactory creates StateStore instances based on provider name
-type StateStoreFactory interface {
-	Create(ctx context.Context, provider string, config map[string]interface{}) (storage.StateStore, error)
+// StoreFactory creates Store instances based on provider name
+type StoreFactory interface {
+	Create(ctx context.Context, provider string, config map[string]interface{}) (storage.Store, error)
 	SupportedProviders() []string
 }
 
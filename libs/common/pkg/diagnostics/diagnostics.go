@@ -0,0 +1,103 @@
+// Package diagnostics serves runtime diagnostics for finding memory growth
+// and goroutine leaks in a running process: pprof profiles, expvar and
+// goroutine dumps.
+package diagnostics
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/config"
+)
+
+var publishOnce sync.Once
+
+// Handler serves the diagnostics under /debug/:
+//
+//	GET /debug/pprof/...     pprof profiles (heap, goroutine, profile, trace, ...)
+//	GET /debug/vars          expvar, including memstats and the goroutine count
+//	GET /debug/goroutines    Stack traces of all goroutines, as text
+//
+// Requests must present cfg.Token or one of tokens as a bearer token. With
+// no token at all, or with cfg.LocalhostOnly, only loopback clients are
+// served; mount it where RemoteAddr is the client's own address, not one
+// taken from forwarding headers.
+func Handler(cfg config.DebugConfig, tokens ...string) http.Handler {
+	publishOnce.Do(func() {
+		expvar.Publish("goroutines", expvar.Func(func() interface{} {
+			return runtime.NumGoroutine()
+		}))
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	mux.HandleFunc("GET /debug/goroutines", serveGoroutines)
+
+	var accepted []string
+	for _, token := range append([]string{cfg.Token}, tokens...) {
+		if token != "" {
+			accepted = append(accepted, token)
+		}
+	}
+	localOnly := cfg.LocalhostOnly || len(accepted) == 0
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if localOnly && !isLoopback(r.RemoteAddr) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if len(accepted) > 0 && !hasToken(r, accepted) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// serveGoroutines writes the stack of every goroutine, in the format of an
+// unrecovered panic
+func serveGoroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Goroutine-Count", strconv.Itoa(runtime.NumGoroutine()))
+	pprof.Handler("goroutine").ServeHTTP(w, withDebug(r, "2"))
+}
+
+// withDebug returns r asking pprof for the given debug level
+func withDebug(r *http.Request, level string) *http.Request {
+	r2 := r.Clone(r.Context())
+	q := r2.URL.Query()
+	q.Set("debug", level)
+	r2.URL.RawQuery = q.Encode()
+	return r2
+}
+
+func hasToken(r *http.Request, accepted []string) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	for _, t := range accepted {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
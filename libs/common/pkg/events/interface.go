@@ -40,11 +40,96 @@ const (
 	TopicTaskStarted   = "task.started"
 	TopicTaskCompleted = "task.completed"
 	TopicTaskFailed    = "task.failed"
+	TopicTaskProgress  = "task.progress" // Per task, see TaskProgressTopic
 
-	TopicVMCreated = "vm.created"
-	TopicVMStarted = "vm.started"
-	TopicVMStopped = "vm.stopped"
-	TopicVMFailed  = "vm.failed"
+	TopicVMCreated   = "vm.created"
+	TopicVMStarted   = "vm.started"
+	TopicVMStopped   = "vm.stopped"
+	TopicVMFailed    = "vm.failed"
+	TopicVMCrashed   = "vm.crashed"
+	TopicVMRestarted = "vm.restarted"
+
+	TopicVMGCWarning         = "vm.gc_warning"
+	TopicVMGCScheduled       = "vm.gc_scheduled"
+	TopicVMCapacityRejected  = "vm.capacity_rejected"
+	TopicVMIntegrityFailed   = "vm.integrity_failed"
+	TopicVMResourceExhausted = "vm.resource_exhausted"
+
+	TopicWorkerJoined = "worker.joined"
+	TopicWorkerLeft   = "worker.left"
+
+	TopicWorkspaceReady    = "workspace.ready"
+	TopicWorkspaceFailed   = "workspace.failed"
+	TopicWorkspaceStale    = "workspace.stale"
+	TopicWorkspaceArchived = "workspace.archived"
+	TopicPromptFailed      = "prompt.failed"
+
+	TopicQuotaExceeded = "quota.exceeded"
+
+	TopicClusterSaturated      = "cluster.saturated"
+	TopicClusterScaleRequested = "cluster.scale_requested"
+
+	TopicAlertFiring   = "alert.firing"
+	TopicAlertResolved = "alert.resolved"
+
+	TopicSLOBudgetAtRisk    = "slo.budget_at_risk"
+	TopicSLOBudgetExhausted = "slo.budget_exhausted"
+	TopicSLOBudgetRecovered = "slo.budget_recovered"
+
+	TopicTranscriptAnchored           = "transcript.anchored"
+	TopicTranscriptVerificationFailed = "transcript.verification_failed"
 
 	TopicIntegrationWebhook = "integration.webhook_received"
 )
+
+// TimelineTopics lists the topics recorded in the cluster events timeline
+var TimelineTopics = []string{
+	TopicWorkerJoined,
+	TopicWorkerLeft,
+	TopicVMCreated,
+	TopicVMFailed,
+	TopicVMCrashed,
+	TopicVMRestarted,
+	TopicVMGCWarning,
+	TopicVMGCScheduled,
+	TopicVMCapacityRejected,
+	TopicVMIntegrityFailed,
+	TopicVMResourceExhausted,
+	TopicWorkspaceReady,
+	TopicWorkspaceFailed,
+	TopicWorkspaceStale,
+	TopicWorkspaceArchived,
+	TopicPromptFailed,
+	TopicQuotaExceeded,
+	TopicClusterSaturated,
+	TopicClusterScaleRequested,
+	TopicAlertFiring,
+	TopicAlertResolved,
+	TopicSLOBudgetAtRisk,
+	TopicSLOBudgetExhausted,
+	TopicSLOBudgetRecovered,
+	TopicTranscriptAnchored,
+	TopicTranscriptVerificationFailed,
+}
+
+// IsTimelineTopic reports whether a topic is part of the cluster events timeline
+func IsTimelineTopic(topic string) bool {
+	for _, t := range TimelineTopics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// Kinds of task progress events, in their "kind" field
+const (
+	TaskProgressState = "state" // The task's status changed
+	TaskProgressLog   = "log"   // A log line shipped while handling the task
+)
+
+// TaskProgressTopic is the topic a task's state transitions and log lines
+// are published on while a worker handles it
+func TaskProgressTopic(taskID string) string {
+	return TopicTaskProgress + "." + taskID
+}
@@ -0,0 +1,126 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultCheckTimeout bounds each dependency check
+const DefaultCheckTimeout = 2 * time.Second
+
+// Check returns nil when a dependency is reachable
+type Check func(ctx context.Context) error
+
+// CheckResult is the outcome of one dependency check
+type CheckResult struct {
+	Status    string `json:"status"` // ok or failed
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// Report is the response body of /livez and /readyz
+type Report struct {
+	Status    string                  `json:"status"` // ok or unavailable
+	Checks    map[string]*CheckResult `json:"checks,omitempty"`
+	Timestamp time.Time               `json:"timestamp"`
+}
+
+// Checker runs named readiness checks for Kubernetes-style probes
+type Checker struct {
+	timeout time.Duration
+	names   []string
+	checks  map[string]Check
+	mu      sync.RWMutex
+}
+
+// NewChecker creates a checker with the default per-check timeout
+func NewChecker() *Checker {
+	return &Checker{
+		timeout: DefaultCheckTimeout,
+		checks:  make(map[string]Check),
+	}
+}
+
+// Add registers a readiness check. Adding an existing name replaces it.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.checks[name]; !exists {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Run executes all checks concurrently
+func (c *Checker) Run(ctx context.Context) *Report {
+	c.mu.RLock()
+	names := append([]string(nil), c.names...)
+	checks := make(map[string]Check, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.RUnlock()
+
+	report := &Report{
+		Status:    "ok",
+		Checks:    make(map[string]*CheckResult, len(names)),
+		Timestamp: time.Now(),
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(checkCtx)
+			result := &CheckResult{Status: "ok", LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = "failed"
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			report.Checks[name] = result
+			if err != nil {
+				report.Status = "unavailable"
+			}
+			mu.Unlock()
+		}(name, checks[name])
+	}
+	wg.Wait()
+
+	return report
+}
+
+// LivezHandler reports that the process is up and serving requests. It
+// checks no dependencies, so a failing database never restarts the process.
+func LivezHandler(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, &Report{Status: "ok", Timestamp: time.Now()})
+}
+
+// ReadyzHandler runs every check, responding 200 when all pass and 503 otherwise
+func (c *Checker) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, c.Run(r.Context()))
+}
+
+func writeReport(w http.ResponseWriter, report *Report) {
+	code := http.StatusOK
+	if report.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,42 @@
+package logging
+
+import "context"
+
+type fieldsKey struct{}
+
+// WithFields returns a context carrying correlation fields (e.g. task_id,
+// vm_id, workspace_id). Loggers add them to every entry logged with the
+// context; fields given to the log call itself take precedence.
+func WithFields(ctx context.Context, fields map[string]interface{}) context.Context {
+	merged := make(map[string]interface{}, len(fields))
+	for k, v := range ContextFields(ctx) {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// ContextFields returns the correlation fields carried by ctx, or nil
+func ContextFields(ctx context.Context) map[string]interface{} {
+	fields, _ := ctx.Value(fieldsKey{}).(map[string]interface{})
+	return fields
+}
+
+// MergeFields returns fields with ctx's correlation fields added
+func MergeFields(ctx context.Context, fields map[string]interface{}) map[string]interface{} {
+	ctxFields := ContextFields(ctx)
+	if len(ctxFields) == 0 {
+		return fields
+	}
+
+	merged := make(map[string]interface{}, len(ctxFields)+len(fields))
+	for k, v := range ctxFields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return merged
+}
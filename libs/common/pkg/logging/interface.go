@@ -44,7 +44,7 @@ type Query struct {
 	// Log level filter
 	Level *types.LogLevel
 
-	// Time range
+	// Time range (Unix nanoseconds)
 	StartTime *int64
 	EndTime   *int64
 
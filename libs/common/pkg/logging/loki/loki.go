@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -26,7 +27,7 @@ type LokiLogger struct {
 
 // Config holds Loki-specific configuration
 type Config struct {
-	URL           string        // Loki push URL (e.g., http://localhost:3100/loki/api/v1/push)
+	URL           string        // Loki base URL (e.g., http://localhost:3100); a push URL also works
 	BatchSize     int           // Number of logs to batch before sending
 	BatchInterval time.Duration // How often to flush logs
 	Timeout       time.Duration // HTTP request timeout
@@ -74,8 +75,22 @@ func NewLokiLogger(config *Config) (*LokiLogger, error) {
 	return logger, nil
 }
 
-// Log writes a log entry
+// Loki HTTP API paths, relative to the base URL
+const (
+	lokiPushPath  = "/loki/api/v1/push"
+	lokiQueryPath = "/loki/api/v1/query_range"
+)
+
+// baseURL returns the configured URL without a trailing push path
+func (l *LokiLogger) baseURL() string {
+	return strings.TrimSuffix(strings.TrimSuffix(l.config.URL, "/"), lokiPushPath)
+}
+
+// Log writes a log entry. Correlation fields carried by ctx (see
+// logging.WithFields) are added to the entry.
 func (l *LokiLogger) Log(ctx context.Context, level types.LogLevel, message string, fields map[string]interface{}) error {
+	fields = logging.MergeFields(ctx, fields)
+
 	entry := &types.LogEntry{
 		Timestamp: time.Now(),
 		Level:     level,
@@ -181,7 +196,7 @@ func (l *LokiLogger) sendToLoki(entries []*types.LogEntry) error {
 		return fmt.Errorf("failed to marshal loki payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", l.config.URL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", l.baseURL()+lokiPushPath, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -224,9 +239,11 @@ func (l *LokiLogger) buildLabels(entry *types.LogEntry) map[string]string {
 		labels["vm_id"] = entry.VMID
 	}
 
-	// Add component if present in fields
-	if component, ok := entry.Fields["component"].(string); ok {
-		labels["component"] = component
+	// Add component and the IDs logs are looked up by, if present in fields
+	for _, key := range []string{"component", "workspace_id", "worker_id"} {
+		if value, ok := entry.Fields[key].(string); ok && value != "" {
+			labels[key] = value
+		}
 	}
 
 	return labels
@@ -277,7 +294,7 @@ func (l *LokiLogger) Query(ctx context.Context, query *logging.Query) ([]*types.
 	logQL := l.buildLogQLQuery(query)
 
 	// Query Loki
-	queryURL := fmt.Sprintf("%s/loki/api/v1/query_range", l.config.URL)
+	queryURL := l.baseURL() + lokiQueryPath
 
 	req, err := http.NewRequest("GET", queryURL, nil)
 	if err != nil {
@@ -318,9 +335,9 @@ func (l *LokiLogger) Query(ctx context.Context, query *logging.Query) ([]*types.
 	for _, stream := range result.Data.Result {
 		for _, value := range stream.Values {
 			if len(value) >= 2 {
-				entry := &types.LogEntry{
-					Message: value[1],
-				}
+				entry := parseLogLine(value[1])
+				entry.TaskID = stream.Stream["task_id"]
+				entry.VMID = stream.Stream["vm_id"]
 				// Parse timestamp
 				if ts, err := parseTimestamp(value[0]); err == nil {
 					entry.Timestamp = ts
@@ -333,10 +350,29 @@ func (l *LokiLogger) Query(ctx context.Context, query *logging.Query) ([]*types.
 	return entries, nil
 }
 
+// parseLogLine reads a line written by formatLogLine. Lines in another
+// format are returned as the message.
+func parseLogLine(line string) *types.LogEntry {
+	var data struct {
+		Level   types.LogLevel         `json:"level"`
+		Message string                 `json:"message"`
+		Fields  map[string]interface{} `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(line), &data); err != nil || data.Message == "" {
+		return &types.LogEntry{Message: line}
+	}
+	return &types.LogEntry{
+		Level:   data.Level,
+		Message: data.Message,
+		Fields:  data.Fields,
+	}
+}
+
 // buildLogQLQuery builds a LogQL query string
 func (l *LokiLogger) buildLogQLQuery(query *logging.Query) string {
-	// Start with service label
-	logQL := fmt.Sprintf("{service=\"%s\"}", l.config.Labels["service"])
+	// Every stream has a service label; match all services so logs shipped
+	// by workers are found as well as this logger's own
+	logQL := "{service=~\".+\"}"
 
 	// Add label filters
 	for k, v := range query.Labels {
@@ -359,7 +395,7 @@ func (l *LokiLogger) buildLogQLQuery(query *logging.Query) string {
 // Health returns the health status of the logger
 func (l *LokiLogger) Health(ctx context.Context) error {
 	// Try to query Loki ready endpoint
-	healthURL := fmt.Sprintf("%s/ready", l.config.URL)
+	healthURL := l.baseURL() + "/ready"
 	resp, err := l.client.Get(healthURL)
 	if err != nil {
 		return fmt.Errorf("loki health check failed: %w", err)
@@ -26,6 +26,8 @@ func NewStdoutLogger(colorize bool) *StdoutLogger {
 
 // Log writes a log entry to stdout
 func (s *StdoutLogger) Log(ctx context.Context, level types.LogLevel, message string, fields map[string]interface{}) error {
+	fields = logging.MergeFields(ctx, fields)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -67,6 +67,40 @@ type VMConfig struct {
 	DefaultTools    []string          `json:"default_tools,omitempty"`    // Tools installed in all VMs (e.g., nodejs, bun, claude-code)
 	AdditionalTools []string          `json:"additional_tools,omitempty"` // Per-request tools (e.g., go, python)
 	ToolVersions    map[string]string `json:"tool_versions,omitempty"`    // Tool version specifications
+	KernelArgs      []string          `json:"kernel_args,omitempty"`      // Extra kernel boot args (e.g. quiet), checked against an allowlist
+	Firewall        *FirewallPolicy   `json:"firewall,omitempty"`         // L3/L4 rules on the VM's TAP device (nil = no filtering)
+}
+
+// Firewall rule directions, actions and protocols
+const (
+	FirewallEgress  = "egress"  // Traffic leaving the VM
+	FirewallIngress = "ingress" // Traffic reaching the VM
+
+	FirewallAllow = "allow"
+	FirewallDeny  = "deny"
+
+	FirewallTCP  = "tcp"
+	FirewallUDP  = "udp"
+	FirewallICMP = "icmp"
+	FirewallAny  = "any"
+)
+
+// FirewallPolicy filters a VM's traffic at L3/L4. Rules are matched in
+// order; traffic matching none gets the direction's default action.
+type FirewallPolicy struct {
+	DefaultEgress  string         `json:"default_egress"`  // "allow" (default) or "deny"
+	DefaultIngress string         `json:"default_ingress"` // "allow" (default) or "deny"
+	Rules          []FirewallRule `json:"rules"`
+}
+
+// FirewallRule allows or denies traffic to (egress) or from (ingress) a
+// remote address range
+type FirewallRule struct {
+	Direction string `json:"direction"`       // "egress" or "ingress"
+	Action    string `json:"action"`          // "allow" or "deny"
+	Protocol  string `json:"protocol"`        // "tcp", "udp", "icmp" or "any"
+	CIDR      string `json:"cidr,omitempty"`  // Remote address range (empty = anywhere)
+	Ports     string `json:"ports,omitempty"` // "443" or "8000-8100", tcp and udp only; the remote port for egress, the VM's for ingress
 }
 
 // VMStatus represents the current state of a VM
@@ -78,6 +112,8 @@ const (
 	VMStatusRunning  VMStatus = "RUNNING"
 	VMStatusStopping VMStatus = "STOPPING"
 	VMStatusStopped  VMStatus = "STOPPED"
+	VMStatusPaused   VMStatus = "PAUSED"  // Snapshotted to disk, resumable
+	VMStatusCrashed  VMStatus = "CRASHED" // Process exited without being stopped
 	VMStatusFailed   VMStatus = "FAILED"
 )
 
@@ -0,0 +1,90 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidVMTransition is returned when a VM is moved to a state it can't reach
+var ErrInvalidVMTransition = errors.New("invalid VM state transition")
+
+// vmTransitions lists the states each VM state may move to:
+//
+//	Created -> Starting -> Running -> Stopping -> Stopped
+//	Running -> Paused -> Starting (resumed) or Stopping
+//	Running -> Crashed -> Starting (restarted) or Stopped
+//
+// Any non-terminal state may also fail. Stopped and Failed are terminal.
+var vmTransitions = map[VMStatus][]VMStatus{
+	VMStatusCreated:  {VMStatusStarting, VMStatusFailed},
+	VMStatusStarting: {VMStatusRunning, VMStatusFailed},
+	VMStatusRunning:  {VMStatusStopping, VMStatusPaused, VMStatusCrashed, VMStatusFailed},
+	VMStatusPaused:   {VMStatusStarting, VMStatusStopping, VMStatusFailed},
+	VMStatusStopping: {VMStatusStopped, VMStatusFailed},
+	VMStatusCrashed:  {VMStatusStarting, VMStatusStopped, VMStatusFailed},
+	VMStatusStopped:  {},
+	VMStatusFailed:   {},
+}
+
+// legacyVMStatuses maps status strings written by older code to their state
+var legacyVMStatuses = map[string]VMStatus{
+	"READY":  VMStatusRunning,
+	"ACTIVE": VMStatusRunning,
+}
+
+// ParseVMStatus converts a status string to a VMStatus, accepting any case
+// and legacy spellings such as "ready"
+func ParseVMStatus(s string) (VMStatus, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	if status := VMStatus(upper); status.Valid() {
+		return status, nil
+	}
+	if status, ok := legacyVMStatuses[upper]; ok {
+		return status, nil
+	}
+	return "", fmt.Errorf("unknown VM status: %q", s)
+}
+
+// Valid reports whether s is one of the defined VM states
+func (s VMStatus) Valid() bool {
+	_, ok := vmTransitions[s]
+	return ok
+}
+
+// IsTerminal reports whether no further transitions are possible from s
+func (s VMStatus) IsTerminal() bool {
+	return s.Valid() && len(vmTransitions[s]) == 0
+}
+
+// CanTransitionTo reports whether a VM in state s may move to next.
+// Staying in the same state is always allowed.
+func (s VMStatus) CanTransitionTo(next VMStatus) bool {
+	if s == next {
+		return s.Valid()
+	}
+	for _, allowed := range vmTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionTo returns ErrInvalidVMTransition if s can't move to next
+func (s VMStatus) TransitionTo(next VMStatus) error {
+	if !s.CanTransitionTo(next) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidVMTransition, s, next)
+	}
+	return nil
+}
+
+// Transition moves the VM to next, or returns ErrInvalidVMTransition and
+// leaves it unchanged
+func (vm *VM) Transition(next VMStatus) error {
+	if err := vm.Status.TransitionTo(next); err != nil {
+		return fmt.Errorf("VM %s: %w", vm.ID, err)
+	}
+	vm.Status = next
+	return nil
+}
@@ -11,6 +11,7 @@ ROOTFS_PATH="${ROOTFS_PATH:-/var/firecracker/rootfs.ext4}"
 MOUNT_POINT="/tmp/aetherium-rootfs-mount"
 UBUNTU_CODENAME="${UBUNTU_CODENAME:-jammy}"  # Ubuntu 22.04 = jammy
 UBUNTU_VERSION="22.04"  # For display purposes
+WITH_DOCKER="${WITH_DOCKER:-0}"  # 1 = prebake dockerd for environments with docker enabled
 
 # Check if running as root
 if [ "$EUID" -ne 0 ]; then
@@ -116,6 +117,20 @@ echo 'export PATH="$BUN_INSTALL/bin:$PATH"' >> /root/.bashrc
 echo "Installing Claude Code..."
 npm install -g @anthropic-ai/claude-code || echo "Warning: Claude Code installation may require specific configuration"
 
+# Install Docker (started by fc-agent only in VMs of environments with docker enabled)
+if [ "$WITH_DOCKER" = "1" ]; then
+    echo "Installing Docker..."
+    apt-get install -y gnupg
+    install -m 0755 -d /etc/apt/keyrings
+    curl -fsSL https://download.docker.com/linux/ubuntu/gpg | gpg --dearmor -o /etc/apt/keyrings/docker.gpg
+    chmod a+r /etc/apt/keyrings/docker.gpg
+    echo "deb [arch=amd64 signed-by=/etc/apt/keyrings/docker.gpg] https://download.docker.com/linux/ubuntu jammy stable" \
+        > /etc/apt/sources.list.d/docker.list
+    apt-get update
+    apt-get install -y docker-ce docker-ce-cli containerd.io docker-buildx-plugin docker-compose-plugin
+    systemctl disable docker.service docker.socket containerd.service
+fi
+
 # Create systemd service for fc-agent
 cat > /etc/systemd/system/fc-agent.service << EOF
 [Unit]
@@ -160,7 +175,7 @@ SETUP_SCRIPT
 chmod +x "$MOUNT_POINT/tmp/setup.sh"
 
 echo "Running setup in chroot..."
-chroot "$MOUNT_POINT" /tmp/setup.sh
+chroot "$MOUNT_POINT" env WITH_DOCKER="$WITH_DOCKER" /tmp/setup.sh
 
 # Cleanup chroot mounts
 umount "$MOUNT_POINT/dev" || true
@@ -173,6 +188,11 @@ if [ -f "bin/fc-agent" ]; then
     cp bin/fc-agent "$MOUNT_POINT/usr/local/bin/fc-agent"
     chmod +x "$MOUNT_POINT/usr/local/bin/fc-agent"
     echo "✓ fc-agent copied"
+    # Workers with an agent_public_key refuse to boot templates without a valid signature
+    if [ -f "bin/fc-agent.sig" ]; then
+        cp bin/fc-agent.sig "$MOUNT_POINT/usr/local/bin/fc-agent.sig"
+        echo "✓ fc-agent signature copied"
+    fi
 else
     echo "Warning: bin/fc-agent not found. Build it first with: go build -o bin/fc-agent ./cmd/fc-agent"
 fi
@@ -196,6 +216,7 @@ echo "========================================="
 echo ""
 echo "Rootfs location: $ROOTFS_PATH"
 echo "Rootfs size: $(du -h $ROOTFS_PATH | cut -f1)"
+echo "Rootfs checksum: sha256:$(sha256sum $ROOTFS_PATH | cut -d' ' -f1)"
 echo ""
 echo "Pre-installed tools:"
 echo "  - Ubuntu $UBUNTU_VERSION base system"
@@ -203,6 +224,9 @@ echo "  - Git"
 echo "  - Node.js (latest LTS)"
 echo "  - Bun (latest)"
 echo "  - Claude Code (if npm install succeeded)"
+if [ "$WITH_DOCKER" = "1" ]; then
+    echo "  - Docker Engine and Compose (started by fc-agent on demand)"
+fi
 echo "  - Build essentials"
 echo "  - SSH server"
 echo "  - fc-agent service (will auto-start)"
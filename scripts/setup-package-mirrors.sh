@@ -0,0 +1,71 @@
+#!/bin/bash
+# Setup package mirrors for Aetherium
+# This script installs a caching DNS resolver (dnsmasq) and an apt cache
+# (apt-cacher-ng) on the VM bridge, so repeated tool installs across VMs
+# are served from the host
+
+set -e
+
+BRIDGE_IP="${BRIDGE_IP:-172.16.0.1}"
+APT_CACHE_PORT="${APT_CACHE_PORT:-3142}"
+UPSTREAM_DNS="${UPSTREAM_DNS:-8.8.8.8 8.8.4.4}"
+
+echo "=== Aetherium Package Mirror Setup ==="
+echo
+
+# Check if running as root
+if [ "$EUID" -ne 0 ]; then
+    echo "Error: This script must be run as root"
+    exit 1
+fi
+
+if ! command -v apt-get &> /dev/null; then
+    echo "Error: Unsupported package manager. Please install dnsmasq and apt-cacher-ng manually."
+    exit 1
+fi
+
+# Install the caches if not already installed
+echo "Installing dnsmasq and apt-cacher-ng..."
+export DEBIAN_FRONTEND=noninteractive
+apt-get update
+apt-get install -y dnsmasq apt-cacher-ng
+echo "✓ Packages installed"
+
+# Caching resolver on the bridge only, so it doesn't clash with the host's
+echo "Configuring dnsmasq on $BRIDGE_IP..."
+{
+    echo "# Aetherium caching resolver - auto-generated"
+    echo "listen-address=$BRIDGE_IP"
+    echo "bind-interfaces"
+    echo "no-resolv"
+    echo "cache-size=10000"
+    for server in $UPSTREAM_DNS; do
+        echo "server=$server"
+    done
+} > /etc/dnsmasq.d/aetherium.conf
+systemctl restart dnsmasq
+echo "✓ dnsmasq listening on $BRIDGE_IP:53"
+
+echo "Configuring apt-cacher-ng on $BRIDGE_IP:$APT_CACHE_PORT..."
+cat > /etc/apt-cacher-ng/aetherium.conf << EOF
+# Aetherium apt cache - auto-generated
+BindAddress: $BRIDGE_IP
+Port: $APT_CACHE_PORT
+PassThroughPattern: .*
+EOF
+systemctl restart apt-cacher-ng
+echo "✓ apt-cacher-ng listening on $BRIDGE_IP:$APT_CACHE_PORT"
+
+echo
+echo "=== Setup Complete ==="
+echo
+echo "Point the worker at the mirrors in its config:"
+echo
+echo "  network:"
+echo "    mirrors:"
+echo "      dns: $BRIDGE_IP"
+echo "      apt: http://$BRIDGE_IP:$APT_CACHE_PORT"
+echo
+echo "or with MIRROR_DNS and MIRROR_APT. npm, pip and Go module mirrors"
+echo "(e.g. Verdaccio, devpi, Athens) are set with MIRROR_NPM, MIRROR_PYPI"
+echo "and MIRROR_GOPROXY."
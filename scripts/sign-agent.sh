@@ -0,0 +1,29 @@
+#!/bin/bash
+# Sign the fc-agent binary for Aetherium
+# Workers configured with an agent_public_key only boot rootfs templates
+# whose fc-agent matches the signature installed next to it
+
+set -e
+
+AGENT="${1:-bin/fc-agent}"
+KEY="${AGENT_SIGNING_KEY:-keys/agent-signing.pem}"
+
+if [ ! -f "$AGENT" ]; then
+    echo "Error: $AGENT not found. Build it first with: go build -o bin/fc-agent ./cmd/fc-agent"
+    exit 1
+fi
+
+# Generate an ed25519 signing key on first use
+if [ ! -f "$KEY" ]; then
+    echo "Generating signing key $KEY..."
+    mkdir -p "$(dirname "$KEY")"
+    openssl genpkey -algorithm ed25519 -out "$KEY"
+    chmod 600 "$KEY"
+    openssl pkey -in "$KEY" -pubout -out "${KEY%.pem}.pub.pem"
+    echo "✓ Public key written to ${KEY%.pem}.pub.pem (set it as the workers' agent_public_key)"
+fi
+
+openssl pkeyutl -sign -inkey "$KEY" -rawin -in "$AGENT" -out "$AGENT.sig"
+echo "✓ Signed $AGENT ($AGENT.sig)"
+echo
+echo "Rebuild the rootfs with scripts/prepare-rootfs-with-tools.sh to install the signature."
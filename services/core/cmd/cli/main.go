@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -25,6 +26,7 @@ func main() {
 	memory := flag.Int("memory", 256, "Memory in MB (for vm:create)")
 	tools := flag.String("tools", "", "Additional tools to install, comma-separated (for vm:create)")
 	toolVersions := flag.String("tool-versions", "", "Tool versions as key=value pairs, comma-separated (for vm:create)")
+	jsonOut := flag.Bool("json", false, "Print the submitted task as a single JSON line")
 
 	flag.Parse()
 
@@ -94,6 +96,18 @@ func main() {
 		if err != nil {
 			log.Fatalf("Failed to create VM task: %v", err)
 		}
+		if *jsonOut {
+			printJSON(taskOutput{
+				Type:         *taskType,
+				TaskID:       taskID.String(),
+				VMName:       *vmName,
+				VCPUs:        *vcpus,
+				MemoryMB:     *memory,
+				Tools:        additionalTools,
+				ToolVersions: versions,
+			})
+			return
+		}
 		fmt.Printf("✓ VM creation task submitted: %s\n", taskID)
 		fmt.Printf("  Name: %s\n", *vmName)
 		fmt.Printf("  vCPUs: %d\n", *vcpus)
@@ -123,6 +137,10 @@ func main() {
 		if err != nil {
 			log.Fatalf("Failed to create execute task: %v", err)
 		}
+		if *jsonOut {
+			printJSON(taskOutput{Type: *taskType, TaskID: taskID.String(), VMID: *vmID, Command: *cmd, Args: cmdArgs})
+			return
+		}
 		fmt.Printf("✓ Command execution task submitted: %s\n", taskID)
 		fmt.Printf("  VM ID: %s\n", *vmID)
 		fmt.Printf("  Command: %s %v\n", *cmd, cmdArgs)
@@ -135,6 +153,10 @@ func main() {
 		if err != nil {
 			log.Fatalf("Failed to create delete task: %v", err)
 		}
+		if *jsonOut {
+			printJSON(taskOutput{Type: *taskType, TaskID: taskID.String(), VMID: *vmID})
+			return
+		}
 		fmt.Printf("✓ VM deletion task submitted: %s\n", taskID)
 		fmt.Printf("  VM ID: %s\n", *vmID)
 
@@ -142,3 +164,25 @@ func main() {
 		log.Fatalf("Unknown task type: %s", *taskType)
 	}
 }
+
+// taskOutput is the -json output for a submitted task. Field names are stable.
+type taskOutput struct {
+	Type         string            `json:"type"`
+	TaskID       string            `json:"task_id"`
+	VMID         string            `json:"vm_id,omitempty"`
+	VMName       string            `json:"vm_name,omitempty"`
+	VCPUs        int               `json:"vcpus,omitempty"`
+	MemoryMB     int               `json:"memory_mb,omitempty"`
+	Tools        []string          `json:"tools,omitempty"`
+	ToolVersions map[string]string `json:"tool_versions,omitempty"`
+	Command      string            `json:"command,omitempty"`
+	Args         []string          `json:"args,omitempty"`
+}
+
+func printJSON(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Fatalf("Failed to encode output: %v", err)
+	}
+	fmt.Println(string(data))
+}
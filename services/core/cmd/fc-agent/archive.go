@@ -0,0 +1,219 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ArchiveRequest names the directory an archive is read from or extracted to
+type ArchiveRequest struct {
+	Dir string `json:"dir"`
+}
+
+// serveArchive sends a gzipped tar of a directory: a success response, then
+// the archive until the connection is closed
+func serveArchive(conn net.Conn, req *Request) {
+	var archiveReq ArchiveRequest
+	if err := json.Unmarshal(req.Payload, &archiveReq); err != nil {
+		sendResponse(conn, ResponseTypeError, nil, fmt.Sprintf("Invalid archive payload: %v", err))
+		return
+	}
+	if info, err := os.Stat(archiveReq.Dir); err != nil || !info.IsDir() {
+		sendResponse(conn, ResponseTypeError, nil, fmt.Sprintf("%s is not a directory", archiveReq.Dir))
+		return
+	}
+	sendResponse(conn, ResponseTypeSuccess, nil, "")
+
+	w := bufio.NewWriterSize(conn, 64*1024)
+	files, err := writeArchive(w, archiveReq.Dir)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		// The host sees a truncated gzip stream
+		log.Printf("Failed to archive %s: %v", archiveReq.Dir, err)
+		return
+	}
+	log.Printf("Archived %d files from %s", files, archiveReq.Dir)
+}
+
+// serveExtract unpacks a gzipped tar read from the connection into a
+// directory. The agent accepts, reads the archive up to the end of its gzip
+// stream and responds with the number of files written.
+func serveExtract(conn net.Conn, reader *bufio.Reader, req *Request) {
+	var archiveReq ArchiveRequest
+	if err := json.Unmarshal(req.Payload, &archiveReq); err != nil {
+		sendResponse(conn, ResponseTypeError, nil, fmt.Sprintf("Invalid extract payload: %v", err))
+		return
+	}
+	if archiveReq.Dir == "" {
+		sendResponse(conn, ResponseTypeError, nil, "dir is required")
+		return
+	}
+	if err := os.MkdirAll(archiveReq.Dir, 0755); err != nil {
+		sendResponse(conn, ResponseTypeError, nil, err.Error())
+		return
+	}
+	sendResponse(conn, ResponseTypeSuccess, nil, "")
+
+	files, err := extractArchive(reader, archiveReq.Dir)
+	if err != nil {
+		log.Printf("Failed to extract archive into %s: %v", archiveReq.Dir, err)
+		sendResponse(conn, ResponseTypeError, nil, err.Error())
+		return
+	}
+	log.Printf("Extracted %d files into %s", files, archiveReq.Dir)
+	payload, _ := json.Marshal(map[string]int{"files": files})
+	sendResponse(conn, ResponseTypeSuccess, payload, "")
+}
+
+// writeArchive writes a gzipped tar of dir's contents, with paths relative
+// to it. Symlinks are archived as links; sockets and devices are skipped.
+func writeArchive(w io.Writer, dir string) (int, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	files := 0
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			// Removed while walking
+			return nil
+		}
+
+		var link string
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				return nil
+			}
+		case !info.Mode().IsRegular() && !info.IsDir():
+			return nil
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		// Files growing while archived are cut at the size in their header
+		if _, err := io.CopyN(tw, f, hdr.Size); err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		files++
+		return nil
+	})
+	if err != nil {
+		return files, err
+	}
+	if err := tw.Close(); err != nil {
+		return files, err
+	}
+	return files, gz.Close()
+}
+
+// extractArchive unpacks a gzipped tar into dir, keeping modes, owners and
+// modification times. It reads exactly up to the end of the gzip stream.
+// On errors the rest of the stream is still read, so the response is not
+// lost behind unread input.
+func extractArchive(r *bufio.Reader, dir string) (int, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, fmt.Errorf("invalid archive: %w", err)
+	}
+	gz.Multistream(false)
+
+	files, err := extractTar(tar.NewReader(gz), dir)
+	if _, drainErr := io.Copy(io.Discard, gz); err == nil && drainErr != nil {
+		err = fmt.Errorf("invalid archive: %w", drainErr)
+	}
+	return files, err
+}
+
+func extractTar(tr *tar.Reader, dir string) (int, error) {
+	root := filepath.Clean(dir) + string(os.PathSeparator)
+	files := 0
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return files, fmt.Errorf("invalid archive: %w", err)
+		}
+
+		target := filepath.Join(dir, hdr.Name)
+		if !strings.HasPrefix(target+string(os.PathSeparator), root) {
+			return files, fmt.Errorf("archive entry %s is outside %s", hdr.Name, dir)
+		}
+		mode := fs.FileMode(hdr.Mode) & fs.ModePerm
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode|0700); err != nil {
+				return files, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return files, err
+			}
+			os.Remove(target)
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return files, err
+			}
+			_, err = io.Copy(f, tr)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return files, fmt.Errorf("%s: %w", hdr.Name, err)
+			}
+			os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+			files++
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return files, err
+			}
+			os.RemoveAll(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return files, err
+			}
+		default:
+			continue
+		}
+		os.Lchown(target, hdr.Uid, hdr.Gid)
+	}
+}
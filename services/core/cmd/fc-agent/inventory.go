@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of process start times in /proc
+const clockTicks = 100
+
+// Socket is a listening TCP socket in the VM
+type Socket struct {
+	Protocol string `json:"protocol"` // tcp or tcp6
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	Loopback bool   `json:"loopback,omitempty"` // Not reachable from outside the VM
+	PID      int    `json:"pid,omitempty"`
+	Process  string `json:"process,omitempty"`
+
+	inode string
+}
+
+// Process is a process running in the VM
+type Process struct {
+	PID       int       `json:"pid"`
+	PPID      int       `json:"ppid"`
+	User      string    `json:"user"`
+	Name      string    `json:"name"`
+	Command   string    `json:"command"`
+	State     string    `json:"state"`
+	RSSKB     int64     `json:"rss_kb"`
+	StartedAt time.Time `json:"started_at"`
+	Ports     []int     `json:"ports,omitempty"` // Ports it listens on
+}
+
+// SignalRequest asks the agent to signal a process in the VM
+type SignalRequest struct {
+	PID    int    `json:"pid"`
+	Signal string `json:"signal"` // TERM, KILL or INT
+}
+
+// signals are the signals a process may be sent through the agent
+var signals = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM,
+	"KILL": syscall.SIGKILL,
+	"INT":  syscall.SIGINT,
+}
+
+// signalProcess sends a signal to a process. init and the agent itself are
+// off limits: killing either takes the VM down with it.
+func signalProcess(pid int, name string) error {
+	sig, ok := signals[name]
+	if !ok {
+		return fmt.Errorf("unsupported signal %q", name)
+	}
+	if pid <= 1 || pid == os.Getpid() {
+		return fmt.Errorf("process %d is protected", pid)
+	}
+	if err := syscall.Kill(pid, sig); err != nil {
+		if err == syscall.ESRCH {
+			return fmt.Errorf("no such process: %d", pid)
+		}
+		return fmt.Errorf("failed to signal process %d: %w", pid, err)
+	}
+	return nil
+}
+
+// listeningSockets returns the VM's listening TCP sockets and the processes
+// holding them. The agent's own port is left out.
+func listeningSockets() ([]Socket, error) {
+	var sockets []Socket
+	for _, protocol := range []string{"tcp", "tcp6"} {
+		path := "/proc/net/" + protocol
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // No IPv6
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		lines := strings.Split(string(data), "\n")
+		for _, line := range lines[1:] {
+			// sl local_address rem_address st tx:rx tr:when retrnsmt uid timeout inode
+			fields := strings.Fields(line)
+			if len(fields) < 10 || fields[3] != "0A" { // TCP_LISTEN
+				continue
+			}
+			ipHex, portHex, ok := strings.Cut(fields[1], ":")
+			if !ok {
+				continue
+			}
+			port, err := strconv.ParseInt(portHex, 16, 32)
+			if err != nil || int(port) == AgentPort {
+				continue
+			}
+			ip := parseProcIP(ipHex)
+			if ip == nil {
+				continue
+			}
+			sockets = append(sockets, Socket{
+				Protocol: protocol,
+				Address:  ip.String(),
+				Port:     int(port),
+				Loopback: ip.IsLoopback(),
+				inode:    fields[9],
+			})
+		}
+	}
+
+	// Attribute sockets to processes through their file descriptors
+	owners := socketOwners()
+	for i := range sockets {
+		if pid, ok := owners[sockets[i].inode]; ok {
+			sockets[i].PID = pid
+			sockets[i].Process = processName(pid)
+		}
+	}
+
+	sort.Slice(sockets, func(i, j int) bool {
+		if sockets[i].Port != sockets[j].Port {
+			return sockets[i].Port < sockets[j].Port
+		}
+		return sockets[i].Protocol < sockets[j].Protocol
+	})
+	return sockets, nil
+}
+
+// reachablePorts returns the distinct ports of sockets listening outside
+// loopback, which the host can connect to
+func reachablePorts(sockets []Socket) []int {
+	seen := make(map[int]bool)
+	ports := []int{}
+	for _, socket := range sockets {
+		if !socket.Loopback && !seen[socket.Port] {
+			seen[socket.Port] = true
+			ports = append(ports, socket.Port)
+		}
+	}
+	return ports
+}
+
+// parseProcIP decodes a /proc/net/tcp address. The kernel prints each
+// 32-bit word in host (little-endian) byte order.
+func parseProcIP(ipHex string) net.IP {
+	raw, err := hex.DecodeString(ipHex)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil
+	}
+	ip := make(net.IP, len(raw))
+	for word := 0; word < len(raw); word += 4 {
+		for i := 0; i < 4; i++ {
+			ip[word+i] = raw[word+3-i]
+		}
+	}
+	return ip
+}
+
+// socketOwners maps socket inodes to the PID of a process holding them
+func socketOwners() map[string]int {
+	owners := make(map[string]int)
+	for _, pid := range pids() {
+		fds, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", pid))
+		if err != nil {
+			continue // Exited, or not ours to look at
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fmt.Sprintf("/proc/%d/fd", pid), fd.Name()))
+			if err != nil || !strings.HasPrefix(target, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]")
+			if _, ok := owners[inode]; !ok {
+				owners[inode] = pid
+			}
+		}
+	}
+	return owners
+}
+
+// listProcesses returns the VM's user-space processes with the ports they
+// listen on. Kernel threads are left out.
+func listProcesses() ([]Process, error) {
+	bootTime, err := bootTime()
+	if err != nil {
+		return nil, err
+	}
+
+	sockets, err := listeningSockets()
+	if err != nil {
+		return nil, err
+	}
+	ports := make(map[int][]int)
+	for _, socket := range sockets {
+		if socket.PID != 0 && !containsInt(ports[socket.PID], socket.Port) {
+			ports[socket.PID] = append(ports[socket.PID], socket.Port)
+		}
+	}
+
+	processes := []Process{}
+	for _, pid := range pids() {
+		process, ok := readProcess(pid, bootTime)
+		if !ok {
+			continue
+		}
+		process.Ports = ports[pid]
+		processes = append(processes, process)
+	}
+	return processes, nil
+}
+
+// readProcess reads a process from /proc. It reports false for kernel
+// threads and processes that exited meanwhile.
+func readProcess(pid int, bootTime time.Time) (Process, bool) {
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil || len(cmdline) == 0 {
+		return Process{}, false
+	}
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return Process{}, false
+	}
+
+	// pid (comm) state ppid ...; comm may contain spaces and parentheses
+	open := strings.IndexByte(string(stat), '(')
+	end := strings.LastIndexByte(string(stat), ')')
+	if open < 0 || end < open {
+		return Process{}, false
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 20 {
+		return Process{}, false
+	}
+
+	process := Process{
+		PID:     pid,
+		Name:    string(stat[open+1 : end]),
+		Command: strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " ")),
+		State:   fields[0],
+	}
+	process.PPID, _ = strconv.Atoi(fields[1])
+	if ticks, err := strconv.ParseInt(fields[19], 10, 64); err == nil {
+		process.StartedAt = bootTime.Add(time.Duration(ticks) * time.Second / clockTicks)
+	}
+
+	if status, err := os.Open(fmt.Sprintf("/proc/%d/status", pid)); err == nil {
+		scanner := bufio.NewScanner(status)
+		for scanner.Scan() {
+			key, value, _ := strings.Cut(scanner.Text(), ":")
+			fields := strings.Fields(value)
+			if len(fields) == 0 {
+				continue
+			}
+			switch key {
+			case "Uid":
+				process.User = fields[0]
+				if u, err := user.LookupId(fields[0]); err == nil {
+					process.User = u.Username
+				}
+			case "VmRSS":
+				process.RSSKB, _ = strconv.ParseInt(fields[0], 10, 64)
+			}
+		}
+		status.Close()
+	}
+
+	return process, true
+}
+
+// pids returns the IDs of the VM's processes
+func pids() []int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	var pids []int
+	for _, entry := range entries {
+		if pid, err := strconv.Atoi(entry.Name()); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	return pids
+}
+
+// processName returns a process's command name
+func processName(pid int) string {
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(comm))
+}
+
+// bootTime reads when the VM booted from /proc/stat
+func bootTime() (time.Time, error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read /proc/stat: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "btime "); ok {
+			seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid btime %q", value)
+			}
+			return time.Unix(seconds, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("btime missing from /proc/stat")
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -31,9 +31,15 @@ const (
 
 // Request types
 const (
-	RequestTypeCommand    = "execute"
-	RequestTypeGetSecrets = "get_secrets"
-	RequestTypeShutdown   = "shutdown"
+	RequestTypeCommand       = "execute"
+	RequestTypeGetSecrets    = "get_secrets"
+	RequestTypeShutdown      = "shutdown"
+	RequestTypeListPorts     = "list_ports"
+	RequestTypeListProcesses = "list_processes"
+	RequestTypeSignal        = "signal_process"
+	RequestTypeTerminal      = "terminal" // Hands the connection over to a shell, see serveTerminal
+	RequestTypeArchive       = "archive"  // Streams a directory as a gzipped tar, see serveArchive
+	RequestTypeExtract       = "extract"  // Unpacks a gzipped tar into a directory, see serveExtract
 )
 
 // Response types
@@ -66,6 +72,9 @@ type CommandResponse struct {
 	Stdout   string `json:"stdout"`
 	Stderr   string `json:"stderr"`
 	Error    string `json:"error,omitempty"`
+
+	// Resources is set for commands that failed, even when none ran out
+	Resources *ResourceEvents `json:"resources,omitempty"`
 }
 
 // SecretStore stores secrets in memory only (never persisted to filesystem)
@@ -166,18 +175,27 @@ func main() {
 	// Initialize idle tracker
 	idleTracker := NewIdleTracker(IdleTimeout)
 
+	// Initialize resource monitor
+	resourceMonitor := NewResourceMonitor()
+
 	// Context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Step 0: Apply sandbox settings requested on the kernel command line
+	if err := applySandbox(); err != nil {
+		log.Printf("Warning: Failed to apply sandbox settings: %v", err)
+	}
+
 	// Step 1: Fetch secrets from host via vsock (if available)
 	if err := fetchSecretsFromHost(secretStore); err != nil {
 		log.Printf("Warning: Failed to fetch secrets from host: %v", err)
 		log.Println("Continuing without secrets (may be normal for non-workspace VMs)")
 	}
 
-	// Step 2: Start idle timeout monitoring
+	// Step 2: Start idle timeout and OOM kill monitoring
 	go idleTracker.StartMonitoring(ctx, shutdownVM)
+	go resourceMonitor.Start(ctx)
 
 	// Step 3: Start listening for commands
 	listener, transport, err := createListener(AgentPort)
@@ -196,7 +214,7 @@ func main() {
 			continue
 		}
 
-		go handleConnection(conn, secretStore, idleTracker)
+		go handleConnection(conn, secretStore, idleTracker, resourceMonitor)
 	}
 }
 
@@ -254,6 +272,121 @@ func fetchSecretsFromHost(store *SecretStore) error {
 	return nil
 }
 
+// applySandbox applies guest-side sandbox settings passed by the host as kernel parameters:
+//
+//	aetherium.tmpfs=<path>[:<sizeMB>]  mount a writable tmpfs over path
+//	aetherium.readonly=1               root is read-only; mount tmpfs on /tmp
+//	aetherium.hidepid=<n>              remount /proc with hidepid=n
+//	aetherium.docker=1                 start dockerd if the rootfs has it
+func applySandbox() error {
+	cmdline, err := os.ReadFile("/proc/cmdline")
+	if err != nil {
+		return fmt.Errorf("failed to read kernel command line: %w", err)
+	}
+
+	for _, field := range strings.Fields(string(cmdline)) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "aetherium.tmpfs":
+			path, size, _ := strings.Cut(value, ":")
+			opts := "mode=1777"
+			if size != "" {
+				opts += ",size=" + size + "m"
+			}
+			if err := mountTmpfs(path, opts); err != nil {
+				return err
+			}
+		case "aetherium.readonly":
+			if err := mountTmpfs("/tmp", "mode=1777"); err != nil {
+				return err
+			}
+		case "aetherium.hidepid":
+			if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_REMOUNT, "hidepid="+value); err != nil {
+				return fmt.Errorf("failed to remount /proc with hidepid=%s: %w", value, err)
+			}
+			log.Printf("✓ Remounted /proc with hidepid=%s", value)
+		case "aetherium.ipv6":
+			addr, gateway, _ := strings.Cut(value, ",")
+			if err := configureIPv6(addr, gateway); err != nil {
+				return err
+			}
+		case "aetherium.docker":
+			if err := startDockerd(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// configureIPv6 assigns eth0 its static IPv6 address and default route. The
+// kernel's ip= argument only covers IPv4.
+func configureIPv6(addr, gateway string) error {
+	if output, err := exec.Command("ip", "-6", "addr", "add", addr, "dev", "eth0").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to add IPv6 address %s: %w: %s", addr, err, strings.TrimSpace(string(output)))
+	}
+	if gateway != "" {
+		if output, err := exec.Command("ip", "-6", "route", "add", "default", "via", gateway, "dev", "eth0").CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to add IPv6 default route via %s: %w: %s", gateway, err, strings.TrimSpace(string(output)))
+		}
+	}
+	log.Printf("✓ Configured IPv6 address %s", addr)
+	return nil
+}
+
+// startDockerd starts the Docker daemon baked into the rootfs, through
+// systemd when it is the init. Rootfs images without Docker get it installed
+// by the host after boot, which then starts the daemon itself.
+func startDockerd() error {
+	if _, err := exec.LookPath("dockerd"); err != nil {
+		log.Printf("dockerd not found in rootfs, leaving Docker to the host")
+		return nil
+	}
+
+	// --no-block so the agent starts listening without waiting for dockerd
+	if exec.Command("systemctl", "start", "--no-block", "docker").Run() == nil {
+		log.Printf("✓ Started docker.service")
+		return nil
+	}
+
+	logFile, err := os.OpenFile("/var/log/dockerd.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open dockerd log: %w", err)
+	}
+	cmd := exec.Command("dockerd")
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return fmt.Errorf("failed to start dockerd: %w", err)
+	}
+	go func() {
+		cmd.Wait()
+		logFile.Close()
+	}()
+
+	log.Printf("✓ Started dockerd (pid %d)", cmd.Process.Pid)
+	return nil
+}
+
+// mountTmpfs mounts a tmpfs at path, creating the mount point if the rootfs allows it
+func mountTmpfs(path, opts string) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		log.Printf("Warning: Could not create mount point %s: %v", path, err)
+	}
+	if err := syscall.Mount("tmpfs", path, "tmpfs", 0, opts); err != nil {
+		return fmt.Errorf("failed to mount tmpfs at %s: %w", path, err)
+	}
+	log.Printf("✓ Mounted tmpfs at %s (%s)", path, opts)
+	return nil
+}
+
 // shutdownVM triggers VM shutdown
 func shutdownVM() {
 	log.Println("Initiating VM shutdown...")
@@ -286,7 +419,7 @@ func createListener(port uint32) (net.Listener, string, error) {
 	return tcpListener, "TCP", nil
 }
 
-func handleConnection(conn net.Conn, secretStore *SecretStore, idleTracker *IdleTracker) {
+func handleConnection(conn net.Conn, secretStore *SecretStore, idleTracker *IdleTracker, resourceMonitor *ResourceMonitor) {
 	defer conn.Close()
 
 	log.Printf("New connection from %s", conn.RemoteAddr())
@@ -309,8 +442,19 @@ func handleConnection(conn net.Conn, secretStore *SecretStore, idleTracker *Idle
 		// Try to parse as new Request format first
 		var req Request
 		if err := json.Unmarshal([]byte(line), &req); err == nil && req.Type != "" {
+			switch req.Type {
+			case RequestTypeTerminal:
+				serveTerminal(conn, reader, &req, secretStore, idleTracker)
+				return
+			case RequestTypeArchive:
+				serveArchive(conn, &req)
+				return
+			case RequestTypeExtract:
+				serveExtract(conn, reader, &req)
+				return
+			}
 			// New format - handle based on type
-			handleRequest(conn, &req, secretStore, idleTracker)
+			handleRequest(conn, &req, secretStore, idleTracker, resourceMonitor)
 			continue
 		}
 
@@ -322,7 +466,7 @@ func handleConnection(conn net.Conn, secretStore *SecretStore, idleTracker *Idle
 		}
 
 		// Execute legacy command with secrets injected
-		resp := executeCommandWithSecrets(&legacyReq, secretStore)
+		resp := executeCommandWithSecrets(&legacyReq, secretStore, resourceMonitor)
 
 		// Send legacy response
 		data, _ := json.Marshal(resp)
@@ -331,7 +475,7 @@ func handleConnection(conn net.Conn, secretStore *SecretStore, idleTracker *Idle
 }
 
 // handleRequest processes new-format requests
-func handleRequest(conn net.Conn, req *Request, secretStore *SecretStore, idleTracker *IdleTracker) {
+func handleRequest(conn net.Conn, req *Request, secretStore *SecretStore, idleTracker *IdleTracker, resourceMonitor *ResourceMonitor) {
 	switch req.Type {
 	case RequestTypeCommand:
 		// Parse command from payload
@@ -342,12 +486,46 @@ func handleRequest(conn net.Conn, req *Request, secretStore *SecretStore, idleTr
 		}
 
 		// Execute command with secrets
-		cmdResp := executeCommandWithSecrets(&cmdReq, secretStore)
+		cmdResp := executeCommandWithSecrets(&cmdReq, secretStore, resourceMonitor)
 
 		// Wrap in Response
 		payload, _ := json.Marshal(cmdResp)
 		sendResponse(conn, ResponseTypeSuccess, payload, "")
 
+	case RequestTypeListPorts:
+		sockets, err := listeningSockets()
+		if err != nil {
+			sendResponse(conn, ResponseTypeError, nil, err.Error())
+			return
+		}
+		payload, _ := json.Marshal(map[string]interface{}{
+			"ports":   reachablePorts(sockets),
+			"sockets": sockets,
+		})
+		sendResponse(conn, ResponseTypeSuccess, payload, "")
+
+	case RequestTypeListProcesses:
+		processes, err := listProcesses()
+		if err != nil {
+			sendResponse(conn, ResponseTypeError, nil, err.Error())
+			return
+		}
+		payload, _ := json.Marshal(map[string]interface{}{"processes": processes})
+		sendResponse(conn, ResponseTypeSuccess, payload, "")
+
+	case RequestTypeSignal:
+		var sigReq SignalRequest
+		if err := json.Unmarshal(req.Payload, &sigReq); err != nil {
+			sendResponse(conn, ResponseTypeError, nil, fmt.Sprintf("Invalid signal payload: %v", err))
+			return
+		}
+		if err := signalProcess(sigReq.PID, sigReq.Signal); err != nil {
+			sendResponse(conn, ResponseTypeError, nil, err.Error())
+			return
+		}
+		log.Printf("Sent SIG%s to process %d", sigReq.Signal, sigReq.PID)
+		sendResponse(conn, ResponseTypeSuccess, nil, "")
+
 	case RequestTypeShutdown:
 		log.Println("Received shutdown request")
 		sendResponse(conn, ResponseTypeSuccess, nil, "")
@@ -374,8 +552,9 @@ func sendResponse(conn net.Conn, respType string, payload json.RawMessage, errMs
 	conn.Write(append(data, '\n'))
 }
 
-// executeCommandWithSecrets executes a command with secrets injected from memory
-func executeCommandWithSecrets(req *CommandRequest, secretStore *SecretStore) CommandResponse {
+// executeCommandWithSecrets executes a command with secrets injected from
+// memory. Failed commands report the resources they ran out of.
+func executeCommandWithSecrets(req *CommandRequest, secretStore *SecretStore, resourceMonitor *ResourceMonitor) CommandResponse {
 	log.Printf("Executing: %s %v", req.Cmd, req.Args)
 
 	cmd := exec.Command(req.Cmd, req.Args...)
@@ -406,6 +585,7 @@ func executeCommandWithSecrets(req *CommandRequest, secretStore *SecretStore) Co
 	cmd.Stderr = &stderr
 
 	// Execute
+	startedAt := time.Now()
 	err := cmd.Run()
 
 	exitCode := 0
@@ -413,6 +593,10 @@ func executeCommandWithSecrets(req *CommandRequest, secretStore *SecretStore) Co
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
 				exitCode = status.ExitStatus()
+				// Killed by a signal: report it the way shells do
+				if status.Signaled() {
+					exitCode = 128 + int(status.Signal())
+				}
 			} else {
 				exitCode = 1
 			}
@@ -426,11 +610,15 @@ func executeCommandWithSecrets(req *CommandRequest, secretStore *SecretStore) Co
 		}
 	}
 
-	return CommandResponse{
+	resp := CommandResponse{
 		ExitCode: exitCode,
 		Stdout:   stdout.String(),
 		Stderr:   stderr.String(),
 	}
+	if exitCode != 0 {
+		resp.Resources = resourceMonitor.CommandEvents(startedAt, exitCode)
+	}
+	return resp
 }
 
 func sendError(conn net.Conn, errMsg string) {
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// maxOOMKills bounds the OOM kills the monitor remembers
+	maxOOMKills = 50
+	// minFreeBytes is the free space below which a filesystem counts as
+	// full; small ones are full with less than a tenth of them free
+	minFreeBytes = 16 << 20
+	// kmsgSettle is how long a command killed by SIGKILL waits for the
+	// monitor to read the kernel's OOM report
+	kmsgSettle = 100 * time.Millisecond
+)
+
+// oomKillRecord matches the kernel's report of a process killed for lack of
+// memory, e.g. "Out of memory: Killed process 1234 (node) total-vm:..."
+var oomKillRecord = regexp.MustCompile(`Killed process (\d+) \(([^)]*)\)`)
+
+// diskFilesystems are the filesystem types checked for free space
+var diskFilesystems = map[string]bool{
+	"ext2": true, "ext3": true, "ext4": true, "xfs": true, "btrfs": true,
+	"overlay": true, "tmpfs": true, "vfat": true,
+}
+
+// OOMKill is a process the kernel killed for lack of memory
+type OOMKill struct {
+	PID     int       `json:"pid"`
+	Process string    `json:"process"`
+	At      time.Time `json:"at"`
+}
+
+// DiskUsage is the space left on a full filesystem
+type DiskUsage struct {
+	Path       string `json:"path"` // Mount point
+	TotalBytes uint64 `json:"total_bytes"`
+	FreeBytes  uint64 `json:"free_bytes"`
+	FreeInodes uint64 `json:"free_inodes"`
+}
+
+// ResourceEvents are the resources a command ran out of
+type ResourceEvents struct {
+	OOMKills  []OOMKill   `json:"oom_kills,omitempty"`  // Processes killed while it ran
+	FullDisks []DiskUsage `json:"full_disks,omitempty"` // Filesystems full when it exited
+}
+
+// ResourceMonitor follows the kernel log for OOM kills, which leave no
+// trace in the output of the command whose process was killed
+type ResourceMonitor struct {
+	mu       sync.Mutex
+	oomKills []OOMKill // Oldest first
+}
+
+func NewResourceMonitor() *ResourceMonitor {
+	return &ResourceMonitor{}
+}
+
+// Start reads the kernel log until ctx is done. Only messages logged after
+// it starts are considered.
+func (m *ResourceMonitor) Start(ctx context.Context) {
+	kmsg, err := os.Open("/dev/kmsg")
+	if err != nil {
+		log.Printf("Warning: OOM kills won't be reported: %v", err)
+		return
+	}
+	if _, err := kmsg.Seek(0, io.SeekEnd); err != nil {
+		log.Printf("Warning: Failed to skip old kernel messages: %v", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		kmsg.Close()
+	}()
+
+	// Each read returns one record: "<prio>,<seq>,<usec>,<flags>;<message>"
+	buf := make([]byte, 8192)
+	for {
+		n, err := kmsg.Read(buf)
+		if err != nil {
+			// Records overwritten before we got to them
+			if errors.Is(err, syscall.EPIPE) {
+				continue
+			}
+			if ctx.Err() == nil {
+				log.Printf("Warning: Stopped reading the kernel log: %v", err)
+			}
+			return
+		}
+		m.handleRecord(string(buf[:n]))
+	}
+}
+
+// handleRecord remembers the OOM kill a kernel log record reports, if any
+func (m *ResourceMonitor) handleRecord(record string) {
+	_, message, ok := strings.Cut(record, ";")
+	if !ok {
+		return
+	}
+	match := oomKillRecord.FindStringSubmatch(message)
+	if match == nil {
+		return
+	}
+	pid, _ := strconv.Atoi(match[1])
+	kill := OOMKill{PID: pid, Process: match[2], At: time.Now()}
+	log.Printf("Kernel killed process %d (%s) for lack of memory", kill.PID, kill.Process)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.oomKills = append(m.oomKills, kill)
+	if len(m.oomKills) > maxOOMKills {
+		m.oomKills = m.oomKills[len(m.oomKills)-maxOOMKills:]
+	}
+}
+
+// OOMKillsSince returns the OOM kills at or after t
+func (m *ResourceMonitor) OOMKillsSince(t time.Time) []OOMKill {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var kills []OOMKill
+	for _, kill := range m.oomKills {
+		if !kill.At.Before(t) {
+			kills = append(kills, kill)
+		}
+	}
+	return kills
+}
+
+// CommandEvents collects the resources a command that ran since startedAt
+// and exited with exitCode ran out of
+func (m *ResourceMonitor) CommandEvents(startedAt time.Time, exitCode int) *ResourceEvents {
+	// The kernel logs the kill before the process dies, but the monitor
+	// may not have read it yet
+	if exitCode == 128+int(syscall.SIGKILL) {
+		time.Sleep(kmsgSettle)
+	}
+
+	fullDisks, err := fullDisks()
+	if err != nil {
+		log.Printf("Warning: Failed to check free disk space: %v", err)
+	}
+	return &ResourceEvents{
+		OOMKills:  m.OOMKillsSince(startedAt),
+		FullDisks: fullDisks,
+	}
+}
+
+// fullDisks returns the mounted filesystems that are out of space or inodes
+func fullDisks() ([]DiskUsage, error) {
+	file, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var full []DiskUsage
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// device mountpoint fstype options dump pass
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !diskFilesystems[fields[2]] || seen[fields[1]] {
+			continue
+		}
+		path := fields[1]
+		seen[path] = true
+		if strings.HasPrefix(path, "/dev") || strings.HasPrefix(path, "/run") {
+			continue
+		}
+
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(path, &stat); err != nil || stat.Blocks == 0 {
+			continue
+		}
+		usage := DiskUsage{
+			Path:       path,
+			TotalBytes: stat.Blocks * uint64(stat.Bsize),
+			FreeBytes:  stat.Bavail * uint64(stat.Bsize),
+			FreeInodes: stat.Ffree,
+		}
+		outOfInodes := stat.Files > 0 && stat.Ffree == 0
+		if usage.FreeBytes < min(minFreeBytes, usage.TotalBytes/10) || outOfInodes {
+			full = append(full, usage)
+		}
+	}
+	return full, scanner.Err()
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// TerminalRequest asks the agent to start a shell on a pseudo-terminal
+type TerminalRequest struct {
+	Dir  string `json:"dir,omitempty"`
+	Cols uint16 `json:"cols,omitempty"`
+	Rows uint16 `json:"rows,omitempty"`
+}
+
+// Terminal frame types, as in the host's vmm package
+const (
+	FrameTypeInput  = "input"
+	FrameTypeResize = "resize"
+	FrameTypeSignal = "signal"
+	FrameTypeFile   = "file"
+	FrameTypeOutput = "output"
+	FrameTypeExit   = "exit"
+	FrameTypeError  = "error"
+)
+
+// TerminalFrame is a message on a terminal connection
+type TerminalFrame struct {
+	Type     string `json:"type"`
+	Data     []byte `json:"data,omitempty"`
+	Cols     uint16 `json:"cols,omitempty"`
+	Rows     uint16 `json:"rows,omitempty"`
+	Signal   string `json:"signal,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Append   bool   `json:"append,omitempty"`
+	EOF      bool   `json:"eof,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Terminal is a shell running on a pseudo-terminal
+type Terminal struct {
+	cmd       *exec.Cmd
+	master    *os.File
+	dir       string
+	closeOnce sync.Once
+}
+
+// frameWriter writes frames to a terminal connection from several goroutines
+type frameWriter struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (w *frameWriter) send(frame *TerminalFrame) {
+	data, _ := json.Marshal(frame)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.conn.Write(append(data, '\n'))
+}
+
+// serveTerminal starts a shell and hands the connection over to it: frames
+// read from the connection drive the terminal, its output and exit status
+// are sent back. The shell is hung up when the host closes the connection.
+func serveTerminal(conn net.Conn, reader *bufio.Reader, req *Request, secretStore *SecretStore, idleTracker *IdleTracker) {
+	var termReq TerminalRequest
+	if err := json.Unmarshal(req.Payload, &termReq); err != nil {
+		sendResponse(conn, ResponseTypeError, nil, fmt.Sprintf("Invalid terminal payload: %v", err))
+		return
+	}
+	term, err := startTerminal(&termReq, secretStore)
+	if err != nil {
+		sendResponse(conn, ResponseTypeError, nil, err.Error())
+		return
+	}
+	defer term.Close()
+	sendResponse(conn, ResponseTypeSuccess, nil, "")
+	log.Printf("Terminal started (pid %d)", term.cmd.Process.Pid)
+
+	out := &frameWriter{conn: conn}
+	go term.pump(out)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		idleTracker.UpdateActivity()
+
+		var frame TerminalFrame
+		if err := json.Unmarshal(line, &frame); err != nil {
+			out.send(&TerminalFrame{Type: FrameTypeError, Error: fmt.Sprintf("Invalid frame: %v", err)})
+			continue
+		}
+		if err := term.handle(&frame); err != nil {
+			out.send(&TerminalFrame{Type: FrameTypeError, Path: frame.Path, Error: err.Error()})
+		} else if frame.Type == FrameTypeFile && frame.EOF {
+			out.send(&TerminalFrame{Type: FrameTypeFile, Path: frame.Path, EOF: true})
+		}
+	}
+}
+
+// startTerminal starts a login shell on a new pseudo-terminal, with secrets
+// in its environment like executed commands
+func startTerminal(req *TerminalRequest, secretStore *SecretStore) (*Terminal, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	defer slave.Close()
+
+	if req.Cols > 0 && req.Rows > 0 {
+		if err := setWindowSize(master, req.Cols, req.Rows); err != nil {
+			master.Close()
+			return nil, err
+		}
+	}
+
+	dir := req.Dir
+	if dir == "" {
+		if dir, err = os.UserHomeDir(); err != nil {
+			dir = "/"
+		}
+	}
+
+	shell := "/bin/bash"
+	if _, err := os.Stat(shell); err != nil {
+		shell = "/bin/sh"
+	}
+	cmd := exec.Command(shell, "-l")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+	for key, value := range secretStore.GetAll() {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	// A new session with the terminal as its controlling terminal, so job
+	// control and Ctrl-C work as in a login shell
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to start %s: %w", shell, err)
+	}
+
+	return &Terminal{cmd: cmd, master: master, dir: dir}, nil
+}
+
+// pump sends the terminal's output until the shell exits, then its exit
+// code, and closes the connection
+func (t *Terminal) pump(out *frameWriter) {
+	output := make(chan struct{})
+	go func() {
+		defer close(output)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := t.master.Read(buf)
+			if n > 0 {
+				out.send(&TerminalFrame{Type: FrameTypeOutput, Data: buf[:n]})
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	exitCode := exitStatus(t.cmd.Wait())
+	// Flush what the shell wrote last, unless background jobs keep the
+	// terminal open
+	select {
+	case <-output:
+	case <-time.After(time.Second):
+	}
+	out.send(&TerminalFrame{Type: FrameTypeExit, ExitCode: &exitCode})
+	log.Printf("Terminal exited (pid %d, exit code %d)", t.cmd.Process.Pid, exitCode)
+	out.conn.Close()
+}
+
+// handle applies a frame from the host to the terminal
+func (t *Terminal) handle(frame *TerminalFrame) error {
+	switch frame.Type {
+	case FrameTypeInput:
+		_, err := t.master.Write(frame.Data)
+		return err
+	case FrameTypeResize:
+		if frame.Cols == 0 || frame.Rows == 0 {
+			return fmt.Errorf("invalid window size %dx%d", frame.Cols, frame.Rows)
+		}
+		return setWindowSize(t.master, frame.Cols, frame.Rows)
+	case FrameTypeSignal:
+		return t.signal(frame.Signal)
+	case FrameTypeFile:
+		return t.writeFile(frame)
+	default:
+		return fmt.Errorf("unknown frame type: %s", frame.Type)
+	}
+}
+
+// signal sends a signal to the terminal's foreground process group, as the
+// terminal driver does for Ctrl-C
+func (t *Terminal) signal(name string) error {
+	sig, ok := signals[name]
+	if !ok {
+		return fmt.Errorf("unsupported signal %q", name)
+	}
+	pgrp := int32(t.cmd.Process.Pid)
+	if err := ioctl(t.master, syscall.TIOCGPGRP, unsafe.Pointer(&pgrp)); err != nil {
+		pgrp = int32(t.cmd.Process.Pid)
+	}
+	if err := syscall.Kill(-int(pgrp), sig); err != nil && err != syscall.ESRCH {
+		return fmt.Errorf("failed to signal process group %d: %w", pgrp, err)
+	}
+	return nil
+}
+
+// writeFile writes a chunk of a file dropped on the terminal. Relative paths
+// are in the terminal's directory.
+func (t *Terminal) writeFile(frame *TerminalFrame) error {
+	if frame.Path == "" {
+		return fmt.Errorf("file frame without path")
+	}
+	path := frame.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(t.dir, path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if frame.Append {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(frame.Data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Close hangs up the shell and its jobs and closes the terminal
+func (t *Terminal) Close() {
+	t.closeOnce.Do(func() {
+		syscall.Kill(-t.cmd.Process.Pid, syscall.SIGHUP)
+		t.master.Close()
+	})
+}
+
+// openPTY opens a pseudo-terminal pair
+func openPTY() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open /dev/ptmx: %w", err)
+	}
+
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to unlock pseudo-terminal: %w", err)
+	}
+	var n uint32
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to get pseudo-terminal number: %w", err)
+	}
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to open /dev/pts/%d: %w", n, err)
+	}
+	return master, slave, nil
+}
+
+// setWindowSize sets a terminal's size, signaling SIGWINCH to its
+// foreground process group
+func setWindowSize(f *os.File, cols, rows uint16) error {
+	ws := struct{ rows, cols, xpixel, ypixel uint16 }{rows: rows, cols: cols}
+	return ioctl(f, syscall.TIOCSWINSZ, unsafe.Pointer(&ws))
+}
+
+// ioctl runs an ioctl on a file without taking it out of non-blocking mode,
+// so closing the file still interrupts reads
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	if err := conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	}); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// exitStatus returns a command's exit code, 128+n when killed by signal n
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			if status.Signaled() {
+				return 128 + int(status.Signal())
+			}
+			return status.ExitStatus()
+		}
+	}
+	return 1
+}
@@ -0,0 +1,6 @@
+//go:build !nodocker
+
+package main
+
+// Docker container backend. Build with -tags nodocker to leave it out.
+import _ "github.com/aetherium/aetherium/services/core/pkg/vmm/docker"
@@ -0,0 +1,7 @@
+//go:build !nofirecracker
+
+package main
+
+// Firecracker microVM backend (Linux only). Build with -tags nofirecracker
+// to leave out the Firecracker SDK and vsock dependencies.
+import _ "github.com/aetherium/aetherium/services/core/pkg/vmm/firecracker"
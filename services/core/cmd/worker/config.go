@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/config"
+	"github.com/aetherium/aetherium/libs/common/pkg/container"
+)
+
+// loadConfig builds the worker configuration. AETHERIUM_CONFIG may point at
+// a YAML config file; the worker's environment variables override it.
+func loadConfig() (*config.Config, error) {
+	var cfg *config.Config
+	if path := os.Getenv("AETHERIUM_CONFIG"); path != "" {
+		loaded, err := config.Load(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", path, err)
+		}
+		cfg = loaded
+	} else {
+		cfg = config.New()
+		cfg.Database.MaxOpenConns = 10
+
+		// Without a config file, logs are only shipped when Loki's address
+		// is set
+		cfg.Logging.Provider = container.ProviderNone
+		if os.Getenv("LOKI_URL") != "" {
+			cfg.Logging.Provider = "loki"
+		}
+		if provider := os.Getenv("LOG_PROVIDER"); provider != "" {
+			cfg.Logging.Provider = provider
+		}
+	}
+
+	cfg.Database.Host = getEnv("POSTGRES_HOST", cfg.Database.Host)
+	cfg.Database.Port = getEnvInt("POSTGRES_PORT", cfg.Database.Port)
+	cfg.Database.User = getEnv("POSTGRES_USER", cfg.Database.User)
+	cfg.Database.Password = getEnv("POSTGRES_PASSWORD", cfg.Database.Password)
+	cfg.Database.Database = getEnv("POSTGRES_DB", cfg.Database.Database)
+	cfg.Database.CacheTTLSeconds = getEnvInt("DB_CACHE_TTL_SECONDS", cfg.Database.CacheTTLSeconds)
+	if replicas := os.Getenv("POSTGRES_READ_REPLICAS"); replicas != "" {
+		cfg.Database.ReadReplicas = strings.Split(replicas, ",")
+	}
+	cfg.Database.MaxReplicaLagSeconds = getEnvInt("POSTGRES_MAX_REPLICA_LAG_SECONDS", cfg.Database.MaxReplicaLagSeconds)
+	if chain := os.Getenv("TRANSCRIPT_CHAIN"); chain != "" {
+		cfg.Database.TranscriptChain = chain == "true"
+	}
+
+	cfg.Logging.Loki.URL = getEnv("LOKI_URL", cfg.Logging.Loki.URL)
+	if cfg.Logging.Loki.Labels == nil {
+		cfg.Logging.Loki.Labels = map[string]string{
+			"service":   "aetherium-worker",
+			"component": "worker",
+		}
+	}
+
+	vmmCfg := &cfg.VMM
+	vmmCfg.DefaultOrchestrator = getEnv("VMM_BACKEND", vmmCfg.DefaultOrchestrator)
+	vmmCfg.Firecracker.KernelPath = getEnv("KERNEL_PATH", orDefault(vmmCfg.Firecracker.KernelPath, "/var/firecracker/vmlinux"))
+	vmmCfg.Firecracker.RootFSTemplate = getEnv("ROOTFS_TEMPLATE", orDefault(vmmCfg.Firecracker.RootFSTemplate, "/var/firecracker/rootfs.ext4"))
+	vmmCfg.Firecracker.SocketDir = getEnv("SOCKET_DIR", orDefault(vmmCfg.Firecracker.SocketDir, "/tmp"))
+	vmmCfg.Firecracker.StateDir = getEnv("VM_STATE_DIR", orDefault(vmmCfg.Firecracker.StateDir, "/var/firecracker/state"))
+	vmmCfg.Firecracker.DefaultVCPU = getEnvInt("DEFAULT_VCPU", orDefaultInt(vmmCfg.Firecracker.DefaultVCPU, 1))
+	vmmCfg.Firecracker.DefaultMemoryMB = getEnvInt("DEFAULT_MEMORY_MB", orDefaultInt(vmmCfg.Firecracker.DefaultMemoryMB, 256))
+	vmmCfg.Firecracker.SocketWaitTimeoutSeconds = getEnvInt("FIRECRACKER_SOCKET_WAIT_TIMEOUT_SECONDS", vmmCfg.Firecracker.SocketWaitTimeoutSeconds)
+	vmmCfg.Firecracker.APITimeoutMS = getEnvInt("FIRECRACKER_API_TIMEOUT_MS", vmmCfg.Firecracker.APITimeoutMS)
+	vmmCfg.Firecracker.APIRetries = getEnvInt("FIRECRACKER_API_RETRIES", vmmCfg.Firecracker.APIRetries)
+	vmmCfg.Firecracker.APIRetryBackoffMS = getEnvInt("FIRECRACKER_API_RETRY_BACKOFF_MS", vmmCfg.Firecracker.APIRetryBackoffMS)
+	vmmCfg.Firecracker.RootFSChecksum = getEnv("ROOTFS_CHECKSUM", vmmCfg.Firecracker.RootFSChecksum)
+	vmmCfg.Firecracker.AgentPublicKey = getEnv("AGENT_PUBLIC_KEY", vmmCfg.Firecracker.AgentPublicKey)
+	netCfg := &cfg.Network
+	if enabled := os.Getenv("NETWORK_IPV6_ENABLED"); enabled != "" {
+		netCfg.IPv6.Enabled = enabled == "true"
+	}
+	netCfg.IPv6.BridgeIP = getEnv("NETWORK_IPV6_BRIDGE_IP", netCfg.IPv6.BridgeIP)
+	netCfg.IPv6.SubnetCIDR = getEnv("NETWORK_IPV6_SUBNET_CIDR", netCfg.IPv6.SubnetCIDR)
+	netCfg.IPv6.Mode = getEnv("NETWORK_IPV6_MODE", netCfg.IPv6.Mode)
+	netCfg.Mirrors.DNS = getEnv("MIRROR_DNS", netCfg.Mirrors.DNS)
+	netCfg.Mirrors.APT = getEnv("MIRROR_APT", netCfg.Mirrors.APT)
+	netCfg.Mirrors.NPM = getEnv("MIRROR_NPM", netCfg.Mirrors.NPM)
+	netCfg.Mirrors.PyPI = getEnv("MIRROR_PYPI", netCfg.Mirrors.PyPI)
+	netCfg.Mirrors.GoProxy = getEnv("MIRROR_GOPROXY", netCfg.Mirrors.GoProxy)
+
+	vmmCfg.Docker.Network = getEnv("DOCKER_NETWORK", orDefault(vmmCfg.Docker.Network, "bridge"))
+	vmmCfg.Docker.Image = getEnv("DOCKER_IMAGE", orDefault(vmmCfg.Docker.Image, "ubuntu:22.04"))
+	vmmCfg.Docker.WindowsImage = getEnv("DOCKER_WINDOWS_IMAGE", vmmCfg.Docker.WindowsImage)
+	vmmCfg.Docker.WindowsNetwork = getEnv("DOCKER_WINDOWS_NETWORK", vmmCfg.Docker.WindowsNetwork)
+
+	return cfg, nil
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func orDefaultInt(value, fallback int) int {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
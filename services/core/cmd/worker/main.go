@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
@@ -10,63 +11,87 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/aetherium/aetherium/libs/common/pkg/config"
+	"github.com/aetherium/aetherium/libs/common/pkg/container"
+	"github.com/aetherium/aetherium/libs/common/pkg/container/factories"
+	"github.com/aetherium/aetherium/libs/common/pkg/diagnostics"
+	"github.com/aetherium/aetherium/libs/common/pkg/health"
 	"github.com/aetherium/aetherium/services/gateway/pkg/discovery"
 	"github.com/aetherium/aetherium/services/gateway/pkg/discovery/consul"
-	"github.com/aetherium/aetherium/services/core/pkg/queue/asynq"
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
 	"github.com/aetherium/aetherium/services/core/pkg/service"
-	"github.com/aetherium/aetherium/services/core/pkg/storage/postgres"
-	"github.com/aetherium/aetherium/services/core/pkg/vmm/firecracker"
+	"github.com/aetherium/aetherium/services/core/pkg/tools"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
 	"github.com/aetherium/aetherium/services/core/pkg/worker"
 	"github.com/google/uuid"
 )
 
+// Build information, set via -ldflags "-X main.version=... -X main.commit=..."
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
 func main() {
-	log.Println("Aetherium Worker starting...")
-
-	// Initialize PostgreSQL store
-	store, err := postgres.NewStore(postgres.Config{
-		Host:         getEnv("POSTGRES_HOST", "localhost"),
-		Port:         getEnvInt("POSTGRES_PORT", 5432),
-		User:         getEnv("POSTGRES_USER", "aetherium"),
-		Password:     getEnv("POSTGRES_PASSWORD", "aetherium"),
-		Database:     getEnv("POSTGRES_DB", "aetherium"),
-		SSLMode:      "disable",
-		MaxOpenConns: 10,
-		MaxIdleConns: 5,
-	})
+	log.Printf("Aetherium Worker starting (version=%s, commit=%s, task payload versions %d-%d)...",
+		version, commit, queue.MinPayloadVersion, queue.PayloadVersion)
+
+	cfg, err := loadConfig()
 	if err != nil {
-		log.Fatalf("Failed to initialize store: %v", err)
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
-	defer store.Close()
-
-	// Initialize Redis queue
-	queue, err := asynq.NewQueue(asynq.Config{
-		RedisAddr: getEnv("REDIS_ADDR", "localhost:6379"),
-		Queues: map[string]int{
-			"critical": 6,
-			"high":     5,
-			"default":  3,
-			"low":      1,
-		},
-	})
-	if err != nil {
-		log.Fatalf("Failed to initialize queue: %v", err)
+
+	// In distributed mode the worker also consumes a queue of its own, used
+	// for tasks that must run on it such as moving its workspaces elsewhere,
+	// and its zone's queue, used for prompts of workspaces placed in the zone
+	consulAddr := getEnv("CONSUL_ADDR", "")
+	workerID := getEnv("WORKER_ID", "")
+	zone := getEnv("WORKER_ZONE", "default")
+	if consulAddr != "" {
+		if workerID == "" {
+			workerID = "worker-" + uuid.New().String()[:8]
+		}
+		cfg.Queue.Queues[queue.WorkerQueue(workerID)] = 6
+		cfg.Queue.Queues[queue.ZoneQueue(zone)] = 5
 	}
 
-	// Initialize Firecracker orchestrator
-	orchestrator, err := firecracker.NewFirecrackerOrchestrator(map[string]interface{}{
-		"kernel_path":       getEnv("KERNEL_PATH", "/var/firecracker/vmlinux"),
-		"rootfs_template":   getEnv("ROOTFS_TEMPLATE", "/var/firecracker/rootfs.ext4"),
-		"socket_dir":        getEnv("SOCKET_DIR", "/tmp"),
-		"default_vcpu":      getEnvInt("DEFAULT_VCPU", 1),
-		"default_memory_mb": getEnvInt("DEFAULT_MEMORY_MB", 256),
-	})
-	if err != nil {
-		log.Fatalf("Failed to initialize orchestrator: %v", err)
+	// Every worker consumes the queue of its capability, used for tasks that
+	// need a particular backend such as running commands in Docker containers
+	capability := getEnv("WORKER_CAPABILITY", cfg.VMM.DefaultOrchestrator)
+	cfg.Queue.Queues[queue.CapabilityQueue(capability)] = 4
+
+	// Workers whose Docker daemon runs Windows containers boot the VMs of
+	// Windows environments
+	if capability == vmm.CapabilityDockerWindows {
+		if cfg.VMM.DefaultOrchestrator != "docker" {
+			log.Fatalf("Worker capability %s needs the docker VM backend", capability)
+		}
+		cfg.VMM.Docker.Windows = true
 	}
 
-	// Check if Consul is configured
-	consulAddr := getEnv("CONSUL_ADDR", "")
+	// Providers are chosen by the configuration. VM backends are compiled in
+	// unless excluded with build tags (see backends_*.go)
+	deps := container.New(cfg)
+	deps.RegisterStoreFactory(factories.NewStorageFactory())
+	deps.RegisterQueueFactory(factories.NewQueueFactory())
+	deps.RegisterVMOrchestratorFactory(factories.NewVMMFactory())
+	deps.RegisterEventBusFactory(factories.NewEventBusFactory())
+	deps.RegisterLoggerFactory(factories.NewLoggerFactory())
+	if err := deps.Initialize(context.Background()); err != nil {
+		log.Fatalf("Failed to initialize worker: %v", err)
+	}
+	defer deps.Shutdown(context.Background())
+
+	store := deps.GetStore()
+	taskQueue := deps.GetQueue()
+	orchestrator := deps.GetVMOrchestrator()
+	backend := cfg.VMM.DefaultOrchestrator
+	log.Printf("✓ Initialized (storage: %s, queue: %s, VM backend: %s)",
+		cfg.Storage.Provider, cfg.TaskQueue.Provider, backend)
+
+	// Closed when the gateway requests a rolling restart
+	restartChan := make(chan struct{})
+
 	var w *worker.Worker
 
 	if consulAddr != "" {
@@ -90,26 +115,30 @@ func main() {
 		}
 
 		// Get worker configuration
-		workerID := getEnv("WORKER_ID", "")
-		if workerID == "" {
-			workerID = "worker-" + uuid.New().String()[:8]
-		}
-
 		hostname, _ := os.Hostname()
 		workerConfig := &worker.Config{
 			ID:       workerID,
 			Hostname: hostname,
 			Address:  getEnv("WORKER_ADDRESS", hostname+":8081"),
-			Zone:     getEnv("WORKER_ZONE", "default"),
+			Zone:     zone,
 			Labels:   parseLabels(getEnv("WORKER_LABELS", "")),
 			Capabilities: []string{
-				getEnv("WORKER_CAPABILITY", "firecracker"),
+				capability,
 			},
 			CPUCores: getEnvInt("WORKER_CPU_CORES", runtime.NumCPU()),
 			MemoryMB: int64(getEnvInt("WORKER_MEMORY_MB", 32768)),
 			DiskGB:   int64(getEnvInt("WORKER_DISK_GB", 500)),
 			MaxVMs:   getEnvInt("WORKER_MAX_VMS", 100),
 			Registry: consulRegistry,
+
+			Version: version,
+			Commit:  commit,
+
+			MemoryReserveMB: int64(getEnvInt("WORKER_MEMORY_RESERVE_MB", worker.DefaultMemoryReserveMB)),
+			CPUReserveCores: getEnvInt("WORKER_CPU_RESERVE", 0),
+
+			ResultCacheTTL:        time.Duration(getEnvInt("RESULT_CACHE_TTL_SECONDS", 3600)) * time.Second,
+			ResultCacheMaxEntries: getEnvInt("RESULT_CACHE_MAX_ENTRIES", 1000),
 		}
 
 		// Create worker with configuration
@@ -127,6 +156,11 @@ func main() {
 		log.Printf("✓ Worker registered: ID=%s, Zone=%s, Address=%s",
 			workerConfig.ID, workerConfig.Zone, workerConfig.Address)
 
+		// Restart requests from the gateway go through the normal shutdown path
+		w.SetRestartHandler(func() {
+			close(restartChan)
+		})
+
 		// Start heartbeat
 		heartbeatInterval := time.Duration(getEnvInt("HEARTBEAT_INTERVAL_SECONDS", 10)) * time.Second
 		if err := w.StartHeartbeat(heartbeatInterval); err != nil {
@@ -142,28 +176,91 @@ func main() {
 		w = worker.New(store, orchestrator)
 	}
 
+	// Recorded in each prompt's execution environment
+	if backend == "docker" {
+		w.SetBaseImage(cfg.VMM.Docker.Image)
+	} else {
+		w.SetBaseImage(cfg.VMM.Firecracker.RootFSTemplate)
+	}
+
+	w.SetPromptTimeout(time.Duration(getEnvInt("WORKER_PROMPT_TIMEOUT_SECONDS", int(worker.DefaultPromptTimeout.Seconds()))) * time.Second)
+	w.SetPromptCheckpointInterval(time.Duration(getEnvInt("WORKER_PROMPT_CHECKPOINT_SECONDS", int(worker.DefaultPromptCheckpointInterval.Seconds()))) * time.Second)
+
+	if err := w.SetVMRestartPolicy(getEnv("VM_RESTART_POLICY", worker.RestartPolicyNever), getEnvInt("VM_MAX_RESTARTS", worker.DefaultMaxVMRestarts)); err != nil {
+		log.Fatalf("Invalid VM restart policy: %v", err)
+	}
+
+	// Past these the worker reports its host unhealthy and schedulers skip it
+	healthLimits := worker.DefaultHostHealthLimits()
+	w.SetHostHealthLimits(worker.HostHealthLimits{
+		MaxTemperatureC:    getEnvFloat("WORKER_MAX_TEMPERATURE_C", healthLimits.MaxTemperatureC),
+		MaxDiskIOPercent:   getEnvFloat("WORKER_MAX_DISK_IO_PERCENT", healthLimits.MaxDiskIOPercent),
+		MaxCPUStealPercent: getEnvFloat("WORKER_MAX_CPU_STEAL_PERCENT", healthLimits.MaxCPUStealPercent),
+		MaxLoadPerCore:     getEnvFloat("WORKER_MAX_LOAD_PER_CORE", healthLimits.MaxLoadPerCore),
+	})
+
+	// Record the rootfs template's checksum; VMs are verified against it
+	if err := w.RegisterRootFS(context.Background()); err != nil {
+		log.Printf("Warning: Rootfs template failed verification, VMs won't boot from it: %v", err)
+	}
+
+	// Re-attach to VMs still running from before a restart
+	if err := w.AdoptVMs(context.Background()); err != nil {
+		log.Printf("Warning: Failed to adopt running VMs: %v", err)
+	}
+
 	// Register VM handlers
-	if err := w.RegisterHandlers(queue); err != nil {
+	if err := w.RegisterHandlers(taskQueue); err != nil {
 		log.Fatalf("Failed to register handlers: %v", err)
 	}
 
+	// Tasks this worker enqueues, such as prompt retries, are written at a
+	// payload version the other workers read
+	versionedQueue := service.NewVersionedQueue(taskQueue, store)
+
 	// Initialize WorkspaceService for secret decryption
 	encryptionKey := getEnv("WORKSPACE_ENCRYPTION_KEY", "")
-	workspaceService, err := service.NewWorkspaceService(queue, store, encryptionKey)
+	workspaceService, err := service.NewWorkspaceService(versionedQueue, store, encryptionKey)
 	if err != nil {
 		log.Printf("Warning: Failed to initialize workspace service: %v", err)
 		log.Println("  Workspace features will be limited")
 	} else {
 		// Set workspace service on worker for secret decryption
 		w.SetWorkspaceService(workspaceService)
+		workspaceService.SetPromptRetries(getEnvInt("PROMPT_INFRA_RETRIES", service.DefaultPromptRetries))
 
 		// Register workspace handlers
-		if err := w.RegisterWorkspaceHandlers(queue); err != nil {
+		if err := w.RegisterWorkspaceHandlers(taskQueue); err != nil {
 			log.Fatalf("Failed to register workspace handlers: %v", err)
 		}
 		log.Println("  Registered handlers: workspace:create, workspace:delete, prompt:execute")
 	}
 
+	// Event bus for VM lifecycle notifications (optional)
+	if eventBus := deps.GetEventBus(); eventBus != nil {
+		w.SetEventBus(eventBus)
+	} else {
+		log.Println("  VM garbage collection warnings will not be published")
+	}
+
+	// Host-level caches for tool installs (optional)
+	if mirrors := cfg.Network.Mirrors; mirrors != (config.MirrorConfig{}) {
+		w.SetPackageMirrors(tools.Mirrors{
+			DNS:     mirrors.DNS,
+			APT:     mirrors.APT,
+			NPM:     mirrors.NPM,
+			PyPI:    mirrors.PyPI,
+			GoProxy: mirrors.GoProxy,
+		})
+		log.Println("  Tool installs go through the configured package mirrors")
+	}
+
+	// Log shipping for task, VM event and tool install logs (optional)
+	if logger := deps.GetLogger(); logger != nil {
+		w.SetLogger(logger)
+		log.Println("  Shipping task logs to the configured logger")
+	}
+
 	log.Println("✓ Worker initialized successfully")
 	log.Println("  Registered handlers: vm:create, vm:execute, vm:delete")
 	log.Println("  Listening for tasks on Redis queue...")
@@ -174,26 +271,80 @@ func main() {
 	w.StartIdleCleanup(idleCleanupCtx, idleCheckInterval)
 	log.Printf("  Started idle VM cleanup worker (check interval: %v)", idleCheckInterval)
 
+	// Start VM garbage collection (deletes non-workspace VMs according to GC policies)
+	gcCtx, gcCancel := context.WithCancel(context.Background())
+	gcInterval := time.Duration(getEnvInt("VM_GC_INTERVAL_SECONDS", 300)) * time.Second
+	w.StartVMGarbageCollection(gcCtx, versionedQueue, gcInterval)
+	log.Printf("  Started VM garbage collection (check interval: %v)", gcInterval)
+
+	// Start the warm pool (pre-warms VMs for the most used environments while idle)
+	warmPoolCtx, warmPoolCancel := context.WithCancel(context.Background())
+	if warmPoolSize := getEnvInt("WARM_POOL_SIZE", 0); warmPoolSize > 0 {
+		warmPoolMaxAge := time.Duration(getEnvInt("WARM_POOL_MAX_AGE_SECONDS", 0)) * time.Second
+		warmPoolInterval := time.Duration(getEnvInt("WARM_POOL_INTERVAL_SECONDS", 60)) * time.Second
+		w.SetWarmPool(warmPoolSize, warmPoolMaxAge)
+		w.StartWarmPool(warmPoolCtx, warmPoolInterval)
+		log.Printf("  Started warm pool (size: %d, check interval: %v)", warmPoolSize, warmPoolInterval)
+	}
+
 	// Start processing tasks
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if err := queue.Start(ctx); err != nil {
+	if err := taskQueue.Start(ctx); err != nil {
 		log.Fatalf("Failed to start queue: %v", err)
 	}
 
+	// Serve liveness and readiness probes
+	checker := health.NewChecker()
+	checker.Add("database", store.Ping)
+	checker.Add("redis", func(ctx context.Context) error {
+		_, err := taskQueue.Stats(ctx)
+		return err
+	})
+	checker.Add("orchestrator", orchestrator.Health)
+	checker.Add("registration", w.CheckRegistration)
+	// The gateway and other workers authenticate with WORKER_PEER_SECRET;
+	// operators may be given WORKER_ADMIN_SECRET instead, which only opens
+	// the admin API
+	peerSecret := os.Getenv("WORKER_PEER_SECRET")
+	adminSecret := os.Getenv("WORKER_ADMIN_SECRET")
+	var diagnosticsHandler http.Handler
+	if cfg.Server.Debug.Enabled {
+		diagnosticsHandler = diagnostics.Handler(cfg.Server.Debug, adminSecret)
+	}
+	w.SetPeerSecret(peerSecret)
+	healthServer := startHealthServer(getEnv("WORKER_HEALTH_ADDR", ":8081"), checker,
+		w.PeerHandler(peerSecret), w.PreviewHandler(peerSecret), w.AdminHandler(peerSecret, adminSecret), diagnosticsHandler)
+
 	// Wait for interrupt signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+	select {
+	case <-sigChan:
+	case <-restartChan:
+		log.Println("Restart requested by gateway")
+	}
 
 	log.Println("Shutting down worker...")
 	cancel()
 
+	// Stop serving probes
+	healthCtx, healthCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	healthServer.Shutdown(healthCtx)
+	healthCancel()
+
 	// Stop idle cleanup worker
 	idleCleanupCancel()
 	log.Println("  Stopped idle VM cleanup worker")
 
+	// Stop VM garbage collection
+	gcCancel()
+	log.Println("  Stopped VM garbage collection")
+
+	// Stop the warm pool
+	warmPoolCancel()
+
 	// Deregister worker from Consul
 	if consulAddr != "" {
 		deregCtx, deregCancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -206,13 +357,19 @@ func main() {
 		}
 	}
 
-	// Cleanup all VMs (this will delete per-VM rootfs files)
-	log.Println("Cleaning up VMs...")
 	cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cleanupCancel()
 
-	vms, err := orchestrator.ListVMs(cleanupCtx)
-	if err != nil {
+	// VMs the next run can adopt are left running, unless
+	// WORKER_DELETE_VMS_ON_EXIT asks for the old behaviour
+	adopter, canAdopt := orchestrator.(vmm.Adopter)
+	if canAdopt && os.Getenv("WORKER_DELETE_VMS_ON_EXIT") != "true" {
+		if err := adopter.Detach(cleanupCtx); err != nil {
+			log.Printf("Warning: Failed to save VM state, some VMs won't be adopted: %v", err)
+		} else {
+			log.Println("✓ Left VMs running for the next worker run to adopt")
+		}
+	} else if vms, err := orchestrator.ListVMs(cleanupCtx); err != nil {
 		log.Printf("Warning: Failed to list VMs during cleanup: %v", err)
 	} else if len(vms) > 0 {
 		log.Printf("  Found %d VMs to cleanup", len(vms))
@@ -231,13 +388,42 @@ func main() {
 	// Stop queue
 	stopCtx, stopCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer stopCancel()
-	queue.Stop(stopCtx)
+	taskQueue.Stop(stopCtx)
 
 	log.Println("✓ Worker stopped gracefully")
 }
 
 // Helper functions
 
+// startHealthServer serves /livez and /readyz for Kubernetes probes,
+// the VM endpoints and workspace previews for the gateway, the admin API
+// and, unless diagnosticsHandler is nil, runtime diagnostics
+func startHealthServer(addr string, checker *health.Checker, peer, preview, admin, diagnosticsHandler http.Handler) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", health.LivezHandler)
+	mux.HandleFunc("/readyz", checker.ReadyzHandler)
+	mux.Handle("/vms/", peer)
+	mux.Handle("/preview/", preview)
+	mux.Handle("/admin/", admin)
+	if diagnosticsHandler != nil {
+		mux.Handle("/debug/", diagnosticsHandler)
+	}
+
+	server := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+
+	go func() {
+		log.Printf("  Health probes, previews and admin API listening on %s (/livez, /readyz, /vms, /preview, /admin)", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Warning: Health server error: %v", err)
+		}
+	}()
+
+	return server
+}
+
 func getEnv(key, fallback string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -254,6 +440,15 @@ func getEnvInt(key string, fallback int) int {
 	return fallback
 }
 
+func getEnvFloat(key string, fallback float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return fallback
+}
+
 func parseLabels(labelsStr string) map[string]string {
 	labels := make(map[string]string)
 	if labelsStr == "" {
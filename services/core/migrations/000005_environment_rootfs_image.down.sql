@@ -0,0 +1,4 @@
+-- Rollback migration: 000005_environment_rootfs_image
+
+ALTER TABLE environments DROP COLUMN IF EXISTS source_workspace_id;
+ALTER TABLE environments DROP COLUMN IF EXISTS rootfs_image;
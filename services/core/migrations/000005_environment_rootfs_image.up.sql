@@ -0,0 +1,8 @@
+-- Migration: 000005_environment_rootfs_image
+-- Description: Allow environments to boot from a saved rootfs image (captured from a workspace)
+
+-- Path on the worker host of a rootfs image to use instead of the default template
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS rootfs_image VARCHAR(500);
+
+-- Workspace this environment was saved from, if any
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS source_workspace_id UUID REFERENCES workspaces(id) ON DELETE SET NULL;
@@ -0,0 +1,3 @@
+-- Rollback migration: 000006_environment_sandbox
+
+ALTER TABLE environments DROP COLUMN IF EXISTS sandbox;
@@ -0,0 +1,6 @@
+-- Migration: 000006_environment_sandbox
+-- Description: Add sandbox profiles to environments for running untrusted code
+
+-- Sandbox profile (JSON object, NULL = no sandboxing)
+-- Schema: {"read_only_rootfs": true, "tmpfs_workdir": "/workspace", "tmpfs_size_mb": 512, "no_network": true, "restrict_proc": true}
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS sandbox JSONB;
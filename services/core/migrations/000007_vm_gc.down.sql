@@ -0,0 +1,5 @@
+-- Rollback migration: 000007_vm_gc
+
+DROP INDEX IF EXISTS idx_vms_last_used;
+DROP TABLE IF EXISTS vm_gc_policies;
+ALTER TABLE vms DROP COLUMN IF EXISTS last_used_at;
@@ -0,0 +1,31 @@
+-- Migration: 000007_vm_gc
+-- Description: Track VM usage and add garbage collection policies for non-workspace VMs
+
+-- Updated on every command execution
+ALTER TABLE vms ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP WITH TIME ZONE;
+
+-- GC policies per project (VMs are assigned a project via metadata->>'project', else 'default')
+CREATE TABLE vm_gc_policies (
+    project VARCHAR(255) PRIMARY KEY,
+
+    -- 0 disables the corresponding limit
+    max_age_seconds INTEGER NOT NULL DEFAULT 0,
+    max_idle_seconds INTEGER NOT NULL DEFAULT 0,
+
+    -- How long before deletion a warning event is published
+    warning_seconds INTEGER NOT NULL DEFAULT 300,
+
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Default policy: collect VMs idle for more than 24 hours
+INSERT INTO vm_gc_policies (project, max_idle_seconds) VALUES ('default', 86400)
+ON CONFLICT (project) DO NOTHING;
+
+CREATE INDEX idx_vms_last_used ON vms(last_used_at);
+
+-- Grant permissions to aetherium user
+GRANT ALL PRIVILEGES ON TABLE vm_gc_policies TO aetherium;
@@ -0,0 +1,6 @@
+-- Rollback migration: 000008_worker_metrics_throughput
+
+ALTER TABLE worker_metrics DROP COLUMN IF EXISTS error_count;
+ALTER TABLE worker_metrics DROP COLUMN IF EXISTS queue_latency_ms;
+ALTER TABLE worker_metrics DROP COLUMN IF EXISTS tasks_per_minute;
+ALTER TABLE worker_metrics DROP COLUMN IF EXISTS tasks_in_progress;
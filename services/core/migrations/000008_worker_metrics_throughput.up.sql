@@ -0,0 +1,7 @@
+-- Migration: 000008_worker_metrics_throughput
+-- Description: Record task throughput and queue lag in worker heartbeat metrics
+
+ALTER TABLE worker_metrics ADD COLUMN IF NOT EXISTS tasks_in_progress INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE worker_metrics ADD COLUMN IF NOT EXISTS tasks_per_minute FLOAT NOT NULL DEFAULT 0;
+ALTER TABLE worker_metrics ADD COLUMN IF NOT EXISTS queue_latency_ms FLOAT NOT NULL DEFAULT 0;
+ALTER TABLE worker_metrics ADD COLUMN IF NOT EXISTS error_count INTEGER NOT NULL DEFAULT 0;
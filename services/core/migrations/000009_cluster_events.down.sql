@@ -0,0 +1,3 @@
+-- Rollback migration: 000009_cluster_events
+
+DROP TABLE IF EXISTS cluster_events;
@@ -0,0 +1,20 @@
+-- Migration: 000009_cluster_events
+-- Description: Short-retention table backing the cluster events timeline
+
+CREATE TABLE cluster_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    type VARCHAR(100) NOT NULL,            -- Event topic (e.g., vm.created, worker.joined)
+    severity VARCHAR(20) NOT NULL DEFAULT 'info', -- info, warning, error
+    resource_type VARCHAR(50) NOT NULL,    -- worker, vm, workspace, prompt
+    resource_id VARCHAR(255) NOT NULL,
+    worker_id VARCHAR(255),
+    message TEXT NOT NULL,
+    data JSONB DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_cluster_events_created_at ON cluster_events(created_at);
+CREATE INDEX idx_cluster_events_type ON cluster_events(type, created_at);
+CREATE INDEX idx_cluster_events_resource ON cluster_events(resource_type, resource_id);
+
+GRANT ALL PRIVILEGES ON TABLE cluster_events TO aetherium;
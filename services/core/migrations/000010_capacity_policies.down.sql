@@ -0,0 +1,3 @@
+-- Rollback migration: 000010_capacity_policies
+
+DROP TABLE IF EXISTS capacity_policies;
@@ -0,0 +1,23 @@
+-- Migration: 000010_capacity_policies
+-- Description: Per-project policies for VM requests when the cluster is saturated
+
+CREATE TABLE capacity_policies (
+    project VARCHAR(255) PRIMARY KEY,
+
+    -- reject: 503 with Retry-After, queue: accept and report queue position,
+    -- burst: accept and ask the autoscaler for more workers
+    policy VARCHAR(20) NOT NULL DEFAULT 'reject' CHECK (policy IN ('reject', 'queue', 'burst')),
+
+    -- Retry-After hint returned with rejections
+    retry_after_seconds INTEGER NOT NULL DEFAULT 30,
+
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Default policy: reject when saturated instead of queueing indefinitely
+INSERT INTO capacity_policies (project, policy) VALUES ('default', 'reject')
+ON CONFLICT (project) DO NOTHING;
+
+-- Grant permissions to aetherium user
+GRANT ALL PRIVILEGES ON TABLE capacity_policies TO aetherium;
@@ -0,0 +1,3 @@
+-- Rollback migration: 000011_executions_task_id
+
+DROP INDEX IF EXISTS idx_executions_task_id;
@@ -0,0 +1,4 @@
+-- Migration: 000011_executions_task_id
+-- Description: Look up executions by the queue task that produced them (for streaming clients)
+
+CREATE INDEX IF NOT EXISTS idx_executions_task_id ON executions ((metadata->>'task_id'));
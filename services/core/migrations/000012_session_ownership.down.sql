@@ -0,0 +1,4 @@
+-- Rollback migration: 000012_session_ownership
+
+DROP INDEX IF EXISTS idx_sessions_gateway_id;
+ALTER TABLE workspace_sessions DROP COLUMN IF EXISTS gateway_id;
@@ -0,0 +1,6 @@
+-- Migration: 000012_session_ownership
+-- Description: Record which gateway replica owns each WebSocket session
+
+ALTER TABLE workspace_sessions ADD COLUMN gateway_id VARCHAR(255);
+
+CREATE INDEX idx_sessions_gateway_id ON workspace_sessions(gateway_id) WHERE status = 'active';
@@ -0,0 +1,4 @@
+-- Rollback migration: 000013_normalize_vm_status
+-- Status values stay normalized; only the constraint is removed
+
+ALTER TABLE vms DROP CONSTRAINT IF EXISTS vms_status_check;
@@ -0,0 +1,12 @@
+-- Migration: 000013_normalize_vm_status
+-- Description: Normalize VM status strings to the VM state machine and enforce them
+
+UPDATE vms SET status = UPPER(status) WHERE status <> UPPER(status);
+
+UPDATE vms SET status = 'RUNNING' WHERE status IN ('READY', 'ACTIVE');
+
+UPDATE vms SET status = 'FAILED'
+WHERE status NOT IN ('CREATED', 'STARTING', 'RUNNING', 'STOPPING', 'STOPPED', 'FAILED');
+
+ALTER TABLE vms ADD CONSTRAINT vms_status_check
+    CHECK (status IN ('CREATED', 'STARTING', 'RUNNING', 'STOPPING', 'STOPPED', 'FAILED'));
@@ -0,0 +1,3 @@
+-- Rollback migration: 000014_workspace_status_history
+
+DROP TABLE IF EXISTS workspace_status_history;
@@ -0,0 +1,20 @@
+-- Migration: 000014_workspace_status_history
+-- Description: Record every workspace status change with the reason it happened
+
+CREATE TABLE workspace_status_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    from_status VARCHAR(50),               -- NULL for the status a workspace was created with
+    to_status VARCHAR(50) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_workspace_status_history_workspace ON workspace_status_history(workspace_id, created_at);
+
+-- Seed history with each existing workspace's current status
+INSERT INTO workspace_status_history (workspace_id, to_status, reason, created_at)
+SELECT id, status, 'recorded before status history was introduced', created_at
+FROM workspaces;
+
+GRANT ALL PRIVILEGES ON TABLE workspace_status_history TO aetherium;
@@ -0,0 +1,3 @@
+-- Rollback migration: 000015_workspace_create_phase
+
+ALTER TABLE workspaces DROP COLUMN IF EXISTS create_phase;
@@ -0,0 +1,8 @@
+-- Migration: 000015_workspace_create_phase
+-- Description: Checkpoint workspace creation so failed workspaces can be retried
+
+-- Last completed creation phase: '', vm_created, tools_installed or prepared
+ALTER TABLE workspaces ADD COLUMN create_phase VARCHAR(50) NOT NULL DEFAULT '';
+
+-- Workspaces that already finished creating have passed every phase
+UPDATE workspaces SET create_phase = 'prepared' WHERE ready_at IS NOT NULL;
@@ -0,0 +1,8 @@
+-- Rollback migration: 000016_vm_crashed_status
+
+UPDATE vms SET status = 'FAILED' WHERE status = 'CRASHED';
+
+ALTER TABLE vms DROP CONSTRAINT IF EXISTS vms_status_check;
+
+ALTER TABLE vms ADD CONSTRAINT vms_status_check
+    CHECK (status IN ('CREATED', 'STARTING', 'RUNNING', 'STOPPING', 'STOPPED', 'FAILED'));
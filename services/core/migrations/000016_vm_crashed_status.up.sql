@@ -0,0 +1,7 @@
+-- Migration: 000016_vm_crashed_status
+-- Description: Allow the CRASHED VM status for VMs whose process exited unexpectedly
+
+ALTER TABLE vms DROP CONSTRAINT IF EXISTS vms_status_check;
+
+ALTER TABLE vms ADD CONSTRAINT vms_status_check
+    CHECK (status IN ('CREATED', 'STARTING', 'RUNNING', 'STOPPING', 'STOPPED', 'CRASHED', 'FAILED'));
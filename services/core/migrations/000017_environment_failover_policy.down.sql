@@ -0,0 +1,3 @@
+-- Rollback migration: 000017_environment_failover_policy
+
+ALTER TABLE environments DROP COLUMN IF EXISTS failover_policy;
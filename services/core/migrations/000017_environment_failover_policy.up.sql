@@ -0,0 +1,6 @@
+-- Migration: 000017_environment_failover_policy
+-- Description: Let environments allow their workspaces to respawn VMs in another zone
+
+-- 'none' keeps on-demand VMs in the workspace's zone; 'any_zone' permits
+-- respawning elsewhere when that zone has no healthy workers
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS failover_policy VARCHAR(20) NOT NULL DEFAULT 'none';
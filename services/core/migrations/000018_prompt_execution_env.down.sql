@@ -0,0 +1,3 @@
+-- Rollback migration: 000018_prompt_execution_env
+
+ALTER TABLE prompt_tasks DROP COLUMN IF EXISTS execution_env;
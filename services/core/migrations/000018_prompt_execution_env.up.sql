@@ -0,0 +1,6 @@
+-- Migration: 000018_prompt_execution_env
+-- Description: Record the execution environment of each prompt for reproducibility
+
+-- Fingerprint captured by the worker before the prompt runs (NULL = not captured)
+-- Schema: {"vm_id": "...", "rootfs_image": "...", "rootfs_image_sha256": "...", "tool_versions": {"node": "v20.11.1"}, "agent_version": "...", "env_var_names": ["ANTHROPIC_API_KEY"], ...}
+ALTER TABLE prompt_tasks ADD COLUMN IF NOT EXISTS execution_env JSONB;
@@ -0,0 +1,3 @@
+-- Rollback migration: 000019_environment_tool_lock
+
+ALTER TABLE environments DROP COLUMN IF EXISTS tool_lock;
@@ -0,0 +1,6 @@
+-- Migration: 000019_environment_tool_lock
+-- Description: Pin an environment's tools to exact versions
+
+-- Lockfile of resolved tool versions and artifact checksums, used to install
+-- tools in the environment's VMs until it is re-resolved. NULL = not locked.
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS tool_lock JSONB;
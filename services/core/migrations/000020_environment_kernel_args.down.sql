@@ -0,0 +1,3 @@
+-- Rollback migration: 000020_environment_kernel_args
+
+ALTER TABLE environments DROP COLUMN IF EXISTS kernel_args;
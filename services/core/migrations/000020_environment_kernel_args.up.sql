@@ -0,0 +1,5 @@
+-- Migration: 000020_environment_kernel_args
+-- Description: Let environments add kernel boot args to their VMs
+
+-- Extra args appended to the VM's kernel command line, e.g. ["quiet"]
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS kernel_args JSONB NOT NULL DEFAULT '[]';
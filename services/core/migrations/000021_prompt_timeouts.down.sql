@@ -0,0 +1,4 @@
+-- Rollback migration: 000021_prompt_timeouts
+
+ALTER TABLE prompt_tasks DROP COLUMN IF EXISTS timeout_seconds;
+ALTER TABLE environments DROP COLUMN IF EXISTS prompt_timeout_seconds;
@@ -0,0 +1,9 @@
+-- Migration: 000021_prompt_timeouts
+-- Description: Add per-environment and per-prompt execution time limits
+
+-- 0 uses the worker's default (WORKER_PROMPT_TIMEOUT_SECONDS)
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS prompt_timeout_seconds INTEGER NOT NULL DEFAULT 0;
+
+-- Overrides the environment's limit for a single prompt. Prompts killed at
+-- their limit get the status 'timed_out'.
+ALTER TABLE prompt_tasks ADD COLUMN IF NOT EXISTS timeout_seconds INTEGER;
@@ -0,0 +1,3 @@
+-- Rollback migration: 000022_alert_rules
+
+DROP TABLE IF EXISTS alert_rules;
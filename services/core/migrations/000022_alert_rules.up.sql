@@ -0,0 +1,43 @@
+-- Migration: 000022_alert_rules
+-- Description: Alerting rules over worker metrics and cluster events
+
+CREATE TABLE alert_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL UNIQUE,
+
+    -- threshold: fires while the metric compares to the threshold with the
+    -- operator; absence: fires when there has been no data for threshold seconds
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('threshold', 'absence')),
+    metric VARCHAR(255) NOT NULL,
+    operator VARCHAR(2) NOT NULL DEFAULT '' CHECK (operator IN ('', '>', '>=', '<', '<=')),
+    threshold DOUBLE PRECISION NOT NULL,
+
+    -- Time range rate and count metrics are computed over
+    window_seconds INTEGER NOT NULL DEFAULT 0,
+
+    severity VARCHAR(20) NOT NULL DEFAULT 'warning' CHECK (severity IN ('info', 'warning', 'error')),
+
+    -- Notification targets: [{"integration": "slack", "target": "#ops"}]
+    notify JSONB NOT NULL DEFAULT '[]',
+
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+
+    -- Evaluation state
+    firing BOOLEAN NOT NULL DEFAULT FALSE,
+    last_value DOUBLE PRECISION,
+    last_fired_at TIMESTAMP WITH TIME ZONE,
+
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Default rules. They are recorded in the cluster events timeline; add
+-- notification targets to have them delivered.
+INSERT INTO alert_rules (name, kind, metric, operator, threshold, window_seconds, severity) VALUES
+    ('worker-heartbeat-missing', 'absence', 'worker_heartbeat', '', 60, 0, 'error'),
+    ('prompt-failure-rate', 'threshold', 'prompt_failure_rate', '>', 20, 3600, 'warning'),
+    ('worker-disk-usage', 'threshold', 'disk_usage', '>', 90, 0, 'warning')
+ON CONFLICT (name) DO NOTHING;
+
+-- Grant permissions to aetherium user
+GRANT ALL PRIVILEGES ON TABLE alert_rules TO aetherium;
@@ -0,0 +1,4 @@
+-- Rollback migration: 000023_cluster_federation
+
+ALTER TABLE environments DROP COLUMN IF EXISTS region;
+DROP TABLE IF EXISTS clusters;
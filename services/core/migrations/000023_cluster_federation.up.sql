@@ -0,0 +1,21 @@
+-- Migration: 000023_cluster_federation
+-- Description: Register remote clusters for gateway federation and route environments by region
+
+CREATE TABLE IF NOT EXISTS clusters (
+    name VARCHAR(255) PRIMARY KEY,
+    region VARCHAR(100) NOT NULL,
+    url TEXT NOT NULL,
+    encrypted_token BYTEA, -- Bearer token sealed with the workspace secret key; NULL without one
+    token_nonce BYTEA,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_clusters_region ON clusters(region);
+
+-- Empty region means the gateway's own cluster
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS region VARCHAR(100) NOT NULL DEFAULT '';
+
+-- Grant permissions to aetherium user
+GRANT ALL PRIVILEGES ON TABLE clusters TO aetherium;
@@ -0,0 +1,5 @@
+-- Rollback migration: 000024_cache_invalidation
+
+DROP TRIGGER IF EXISTS workspaces_notify_cache ON workspaces;
+DROP TRIGGER IF EXISTS environments_notify_cache ON environments;
+DROP FUNCTION IF EXISTS aetherium_notify_cache();
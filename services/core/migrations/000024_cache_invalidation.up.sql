@@ -0,0 +1,22 @@
+-- Migration: 000024_cache_invalidation
+-- Description: Notify stores' read caches when environments and workspaces change
+
+-- Payload is '<table>:<id>'; stores LISTEN on aetherium_cache and drop the entry
+CREATE OR REPLACE FUNCTION aetherium_notify_cache() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('aetherium_cache', TG_TABLE_NAME || ':' || OLD.id::text);
+    ELSE
+        PERFORM pg_notify('aetherium_cache', TG_TABLE_NAME || ':' || NEW.id::text);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER environments_notify_cache
+    AFTER UPDATE OR DELETE ON environments
+    FOR EACH ROW EXECUTE FUNCTION aetherium_notify_cache();
+
+CREATE TRIGGER workspaces_notify_cache
+    AFTER UPDATE OR DELETE ON workspaces
+    FOR EACH ROW EXECUTE FUNCTION aetherium_notify_cache();
@@ -0,0 +1,3 @@
+-- Rollback migration: 000025_environment_firewall
+
+ALTER TABLE environments DROP COLUMN IF EXISTS firewall;
@@ -0,0 +1,6 @@
+-- Migration: 000025_environment_firewall
+-- Description: Per-environment L3/L4 firewall rules for VMs
+
+-- Default actions and ordered rules programmed on each VM's TAP device
+-- (NULL = no filtering)
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS firewall JSONB;
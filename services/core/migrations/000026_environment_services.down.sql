@@ -0,0 +1,3 @@
+-- Rollback migration: 000026_environment_services
+
+ALTER TABLE environments DROP COLUMN IF EXISTS services;
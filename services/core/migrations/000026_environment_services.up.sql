@@ -0,0 +1,6 @@
+-- Migration: 000026_environment_services
+-- Description: Sidecar service VMs started alongside workspace VMs
+
+-- Services (databases, caches, emulators) booted next to each workspace VM
+-- spawned from the environment, e.g. [{"name": "redis", "command": "redis-server"}]
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS services JSONB NOT NULL DEFAULT '[]';
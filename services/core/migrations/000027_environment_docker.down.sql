@@ -0,0 +1,3 @@
+-- Rollback migration: 000027_environment_docker
+
+ALTER TABLE environments DROP COLUMN IF EXISTS docker;
@@ -0,0 +1,6 @@
+-- Migration: 000027_environment_docker
+-- Description: Docker-in-VM option for environments
+
+-- Docker daemon started in each of the environment's VMs, e.g.
+-- {"disk_size_mb": 16384, "registries": ["ghcr.io"]} (NULL = no Docker)
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS docker JSONB;
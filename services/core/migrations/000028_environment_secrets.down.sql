@@ -0,0 +1,8 @@
+-- Rollback migration: 000028_environment_secrets
+
+DELETE FROM workspace_secrets WHERE environment_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_secrets_environment_id;
+ALTER TABLE workspace_secrets DROP CONSTRAINT IF EXISTS unique_secret_per_owner;
+ALTER TABLE workspace_secrets ADD CONSTRAINT unique_secret_per_workspace
+    UNIQUE NULLS NOT DISTINCT (workspace_id, name);
+ALTER TABLE workspace_secrets DROP COLUMN IF EXISTS environment_id;
@@ -0,0 +1,14 @@
+-- Migration: 000028_environment_secrets
+-- Description: Secrets scoped to an environment, inherited by its workspaces
+
+-- Environment secrets have environment_id set, no workspace_id and scope
+-- 'environment'. A workspace secret of the same name overrides them.
+ALTER TABLE workspace_secrets
+    ADD COLUMN IF NOT EXISTS environment_id UUID REFERENCES environments(id) ON DELETE CASCADE;
+
+-- Names are unique per workspace, per environment, or globally
+ALTER TABLE workspace_secrets DROP CONSTRAINT IF EXISTS unique_secret_per_workspace;
+ALTER TABLE workspace_secrets ADD CONSTRAINT unique_secret_per_owner
+    UNIQUE NULLS NOT DISTINCT (workspace_id, environment_id, name);
+
+CREATE INDEX IF NOT EXISTS idx_secrets_environment_id ON workspace_secrets(environment_id);
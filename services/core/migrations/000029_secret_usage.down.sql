@@ -0,0 +1,4 @@
+-- Rollback migration: 000029_secret_usage
+
+DROP TABLE IF EXISTS secret_usages;
+ALTER TABLE workspace_secrets DROP COLUMN IF EXISTS last_used_at;
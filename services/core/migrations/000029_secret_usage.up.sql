@@ -0,0 +1,21 @@
+-- Migration: 000029_secret_usage
+-- Description: Audit trail of secrets handed to VMs
+
+-- When a secret last reached a VM (NULL = never)
+ALTER TABLE workspace_secrets ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP WITH TIME ZONE;
+
+-- One row per secret each time a VM fetches it at boot or a prompt runs
+-- with it in its environment. Kept when the workspace or VM goes away.
+CREATE TABLE IF NOT EXISTS secret_usages (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    secret_id UUID NOT NULL REFERENCES workspace_secrets(id) ON DELETE CASCADE,
+    workspace_id UUID,
+    vm_id UUID,
+
+    -- Type: 'vm_boot' or 'prompt'
+    request_type VARCHAR(50) NOT NULL,
+
+    used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_secret_usages_secret_used_at ON secret_usages(secret_id, used_at DESC);
@@ -0,0 +1,3 @@
+-- Rollback migration: 000030_smart_executions
+
+DROP TABLE IF EXISTS smart_executions;
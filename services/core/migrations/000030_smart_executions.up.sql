@@ -0,0 +1,20 @@
+-- Migration: 000030_smart_executions
+-- Description: Record of smart-execute requests: which VM ran them and whether it was created or reused
+
+CREATE TABLE IF NOT EXISTS smart_executions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    task_id UUID NOT NULL,                 -- Command task; its execution carries metadata->>'task_id'
+    vm_id UUID REFERENCES vms(id) ON DELETE SET NULL,
+    vm_name VARCHAR(255) NOT NULL,         -- Kept after the VM is deleted
+    vm_created BOOLEAN NOT NULL DEFAULT FALSE,
+    vm_reused BOOLEAN NOT NULL DEFAULT FALSE,
+    command TEXT NOT NULL,
+    args JSONB DEFAULT '[]',
+    environment VARCHAR(255),
+    project VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_smart_executions_created_at ON smart_executions(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_smart_executions_vm_id ON smart_executions(vm_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_smart_executions_task_id ON smart_executions(task_id);
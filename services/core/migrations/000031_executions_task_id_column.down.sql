@@ -0,0 +1,5 @@
+-- Rollback migration: 000031_executions_task_id_column
+
+CREATE INDEX IF NOT EXISTS idx_executions_task_id ON executions ((metadata->>'task_id'));
+DROP INDEX IF EXISTS idx_executions_task_id_column;
+ALTER TABLE executions DROP COLUMN IF EXISTS task_id;
@@ -0,0 +1,13 @@
+-- Migration: 000031_executions_task_id_column
+-- Description: Link executions to the queue task that produced them with a real column
+
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS task_id UUID;
+
+-- Executions recorded before this migration carry the task in their metadata
+UPDATE executions
+SET task_id = (metadata->>'task_id')::uuid
+WHERE task_id IS NULL
+  AND metadata->>'task_id' ~* '^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$';
+
+CREATE INDEX IF NOT EXISTS idx_executions_task_id_column ON executions(task_id, started_at DESC);
+DROP INDEX IF EXISTS idx_executions_task_id;
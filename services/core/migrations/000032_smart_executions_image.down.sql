@@ -0,0 +1,3 @@
+-- Rollback migration: 000032_smart_executions_image
+
+ALTER TABLE smart_executions DROP COLUMN IF EXISTS image;
@@ -0,0 +1,4 @@
+-- Migration: 000032_smart_executions_image
+-- Description: Record the container image of smart executions run without a VM
+
+ALTER TABLE smart_executions ADD COLUMN IF NOT EXISTS image VARCHAR(255);
@@ -0,0 +1,4 @@
+-- Rollback migration: 000033_prompt_failure_reason
+
+ALTER TABLE prompt_tasks DROP COLUMN IF EXISTS failure_detail;
+ALTER TABLE prompt_tasks DROP COLUMN IF EXISTS failure_reason;
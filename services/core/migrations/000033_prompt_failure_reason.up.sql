@@ -0,0 +1,5 @@
+-- Migration: 000033_prompt_failure_reason
+-- Description: Record why failed prompts failed, classified from their output and VM events
+
+ALTER TABLE prompt_tasks ADD COLUMN IF NOT EXISTS failure_reason VARCHAR(50);
+ALTER TABLE prompt_tasks ADD COLUMN IF NOT EXISTS failure_detail TEXT;
@@ -0,0 +1,3 @@
+-- Rollback migration: 000034_environment_scheduling_strategy
+
+ALTER TABLE environments DROP COLUMN IF EXISTS scheduling_strategy;
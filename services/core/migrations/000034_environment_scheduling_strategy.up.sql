@@ -0,0 +1,5 @@
+-- Migration: 000034_environment_scheduling_strategy
+-- Description: Let environments choose the scheduling strategy placing their workspace VMs
+
+-- Empty means the gateway's strategy
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS scheduling_strategy VARCHAR(100) NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- Rollback migration: 000035_task_history
+
+DROP INDEX IF EXISTS idx_tasks_prompt_id;
+DROP INDEX IF EXISTS idx_tasks_workspace_history;
+DROP INDEX IF EXISTS idx_tasks_vm_history;
+
+UPDATE tasks SET vm_id = NULL WHERE vm_id IS NOT NULL AND vm_id NOT IN (SELECT id FROM vms);
+ALTER TABLE tasks ADD CONSTRAINT tasks_vm_id_fkey FOREIGN KEY (vm_id) REFERENCES vms(id) ON DELETE SET NULL;
+
+ALTER TABLE tasks DROP COLUMN IF EXISTS prompt_id;
+ALTER TABLE tasks DROP COLUMN IF EXISTS workspace_id;
@@ -0,0 +1,12 @@
+-- Migration: 000035_task_history
+-- Description: Link tasks to the VM, workspace and prompt they act on, so each resource's history can be listed
+
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS workspace_id UUID;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS prompt_id UUID;
+
+-- Keep the history of VMs and workspaces after they are deleted
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_vm_id_fkey;
+
+CREATE INDEX IF NOT EXISTS idx_tasks_vm_history ON tasks(vm_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_tasks_workspace_history ON tasks(workspace_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_tasks_prompt_id ON tasks(prompt_id);
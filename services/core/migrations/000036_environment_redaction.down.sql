@@ -0,0 +1,3 @@
+-- Rollback migration: 000036_environment_redaction
+
+ALTER TABLE environments DROP COLUMN IF EXISTS redaction;
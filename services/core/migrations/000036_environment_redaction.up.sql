@@ -0,0 +1,5 @@
+-- Migration: 000036_environment_redaction
+-- Description: Let environments configure how secrets are masked in command and prompt output
+
+-- NULL means the default: mask the workspace's secrets and common token formats
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS redaction JSONB;
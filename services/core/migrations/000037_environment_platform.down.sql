@@ -0,0 +1,3 @@
+-- Rollback migration: 000037_environment_platform
+
+ALTER TABLE environments DROP COLUMN IF EXISTS platform;
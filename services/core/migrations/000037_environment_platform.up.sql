@@ -0,0 +1,6 @@
+-- Migration: 000037_environment_platform
+-- Description: Let environments run Windows guests
+
+-- 'linux' runs Firecracker VMs or Linux containers; 'windows' runs Windows
+-- containers on workers with the docker-windows capability
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS platform VARCHAR(20) NOT NULL DEFAULT 'linux';
@@ -0,0 +1,3 @@
+-- Rollback migration: 000038_integration_configs
+
+DROP TABLE IF EXISTS integration_configs;
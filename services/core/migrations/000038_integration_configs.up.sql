@@ -0,0 +1,15 @@
+-- Migration: 000038_integration_configs
+-- Description: Store integrations configured at runtime, with their options encrypted
+
+CREATE TABLE IF NOT EXISTS integration_configs (
+    name VARCHAR(255) PRIMARY KEY,
+    type VARCHAR(50) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    encrypted_options BYTEA NOT NULL,
+    nonce BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Grant permissions to aetherium user
+GRANT ALL PRIVILEGES ON TABLE integration_configs TO aetherium;
@@ -0,0 +1,4 @@
+-- Rollback migration: 000039_prompt_attempts
+
+DROP TABLE IF EXISTS prompt_attempts;
+ALTER TABLE prompt_tasks DROP COLUMN IF EXISTS attempt;
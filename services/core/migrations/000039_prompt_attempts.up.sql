@@ -0,0 +1,22 @@
+-- Migration: 000039_prompt_attempts
+-- Description: Retry prompts that failed for infrastructure reasons, keeping each earlier attempt
+
+-- Attempt the prompt is on, counting from 1
+ALTER TABLE prompt_tasks ADD COLUMN IF NOT EXISTS attempt INTEGER NOT NULL DEFAULT 1;
+
+-- One row per attempt that failed and was retried. The prompt's own
+-- columns describe its latest attempt.
+CREATE TABLE IF NOT EXISTS prompt_attempts (
+    prompt_id UUID NOT NULL REFERENCES prompt_tasks(id) ON DELETE CASCADE,
+    attempt INTEGER NOT NULL,
+    worker_id VARCHAR(255),
+    vm_id UUID,
+    failure_reason VARCHAR(50) NOT NULL,
+    error TEXT,
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (prompt_id, attempt)
+);
+
+GRANT ALL PRIVILEGES ON TABLE prompt_attempts TO aetherium;
@@ -0,0 +1,4 @@
+-- Rollback migration: 000040_kv_entries
+
+DROP TABLE IF EXISTS kv_entries;
+DROP SEQUENCE IF EXISTS kv_entries_version_seq;
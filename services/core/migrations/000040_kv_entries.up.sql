@@ -0,0 +1,25 @@
+-- Migration: 000040_kv_entries
+-- Description: Generic key-value store for runtime coordination state, with expiry
+
+-- Small state subsystems coordinate through: pool membership, locks,
+-- schedule cursors. Each subsystem owns a namespace. Entries past
+-- expires_at are treated as missing and pruned periodically. Versions
+-- come from a sequence so a key recreated after pruning never reuses one.
+CREATE SEQUENCE IF NOT EXISTS kv_entries_version_seq;
+
+CREATE TABLE IF NOT EXISTS kv_entries (
+    namespace VARCHAR(100) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    value BYTEA NOT NULL,
+    version BIGINT NOT NULL DEFAULT nextval('kv_entries_version_seq'),
+    expires_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (namespace, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_kv_entries_expires_at ON kv_entries(expires_at) WHERE expires_at IS NOT NULL;
+
+-- Grant permissions to aetherium user
+GRANT ALL PRIVILEGES ON TABLE kv_entries TO aetherium;
+GRANT USAGE ON SEQUENCE kv_entries_version_seq TO aetherium;
@@ -0,0 +1,5 @@
+-- Rollback migration: 000041_prompt_search
+
+DROP INDEX IF EXISTS idx_workspaces_project;
+DROP INDEX IF EXISTS idx_workspaces_name_search;
+DROP INDEX IF EXISTS idx_prompt_tasks_search;
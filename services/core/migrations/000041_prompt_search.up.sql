@@ -0,0 +1,16 @@
+-- Migration: 000041_prompt_search
+-- Description: Full-text indexes for searching prompts and workspaces
+
+-- Prompt text ranks above its output. Output is indexed up to its first
+-- 100k characters, well within the limit of a tsvector. Searches must use
+-- the same expressions for the indexes to apply.
+CREATE INDEX IF NOT EXISTS idx_prompt_tasks_search ON prompt_tasks USING GIN ((
+    setweight(to_tsvector('english', prompt), 'A') ||
+    setweight(to_tsvector('english', left(coalesce(stdout, ''), 100000)), 'B')
+));
+
+-- Names aren't prose, so they aren't stemmed
+CREATE INDEX IF NOT EXISTS idx_workspaces_name_search ON workspaces USING GIN (to_tsvector('simple', name));
+
+-- Workspaces are scoped to a project through their metadata
+CREATE INDEX IF NOT EXISTS idx_workspaces_project ON workspaces ((metadata->>'project'));
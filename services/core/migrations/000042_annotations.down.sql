@@ -0,0 +1,5 @@
+-- Rollback migration: 000042_annotations
+
+DROP INDEX IF EXISTS idx_workspaces_owner;
+ALTER TABLE environments DROP COLUMN IF EXISTS annotations;
+ALTER TABLE workspaces DROP COLUMN IF EXISTS annotations;
@@ -0,0 +1,9 @@
+-- Migration: 000042_annotations
+-- Description: Owner, purpose, links and Markdown notes on workspaces and environments
+
+-- NULL = no annotations
+ALTER TABLE workspaces ADD COLUMN IF NOT EXISTS annotations JSONB;
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS annotations JSONB;
+
+-- Lists are filtered by owner
+CREATE INDEX IF NOT EXISTS idx_workspaces_owner ON workspaces ((annotations->>'owner'));
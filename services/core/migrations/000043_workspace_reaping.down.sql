@@ -0,0 +1,4 @@
+-- Rollback migration: 000043_workspace_reaping
+
+DROP INDEX IF EXISTS idx_prompt_tasks_workspace_created;
+DROP TABLE IF EXISTS workspace_reap_policies;
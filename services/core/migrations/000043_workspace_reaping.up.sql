@@ -0,0 +1,29 @@
+-- Migration: 000043_workspace_reaping
+-- Description: Per-project policies for flagging and archiving stale workspaces
+
+-- Workspaces are assigned a project via metadata->>'project', else 'default'.
+-- No policy is created, so nothing is reaped until one is added; a disabled
+-- policy opts its project out of the default one.
+CREATE TABLE workspace_reap_policies (
+    project VARCHAR(255) PRIMARY KEY,
+
+    -- How long a workspace goes unused before it is flagged and its owner notified
+    stale_after_seconds INTEGER NOT NULL,
+
+    -- How long after the notice the workspace is archived
+    grace_seconds INTEGER NOT NULL DEFAULT 604800,
+
+    -- Notification targets: [{"integration": "slack", "target": "#team"}]
+    notify JSONB NOT NULL DEFAULT '[]'::jsonb,
+
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Last activity looks up each workspace's latest prompt
+CREATE INDEX IF NOT EXISTS idx_prompt_tasks_workspace_created ON prompt_tasks(workspace_id, created_at);
+
+-- Grant permissions to aetherium user
+GRANT ALL PRIVILEGES ON TABLE workspace_reap_policies TO aetherium;
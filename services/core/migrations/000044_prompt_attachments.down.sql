@@ -0,0 +1,3 @@
+-- Rollback migration: 000044_prompt_attachments
+
+DROP TABLE IF EXISTS prompt_attachments;
@@ -0,0 +1,27 @@
+-- Migration: 000044_prompt_attachments
+-- Description: Files uploaded with prompts and copied into the VM before they run
+
+CREATE TABLE prompt_attachments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+
+    -- NULL until the upload is submitted with a prompt; unattached uploads
+    -- are deleted after a day
+    prompt_id UUID REFERENCES prompt_tasks(id) ON DELETE CASCADE,
+
+    name VARCHAR(255) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    sha256 VARCHAR(64) NOT NULL,
+
+    -- Dropped once the prompt finishes (cleaned_at is then set)
+    content BYTEA,
+
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    cleaned_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_prompt_attachments_prompt_id ON prompt_attachments(prompt_id);
+CREATE INDEX idx_prompt_attachments_unattached ON prompt_attachments(created_at) WHERE prompt_id IS NULL;
+
+-- Grant permissions to aetherium user
+GRANT ALL PRIVILEGES ON TABLE prompt_attachments TO aetherium;
@@ -0,0 +1,3 @@
+-- Rollback migration: 000045_prompt_checkpoints
+
+DROP TABLE IF EXISTS prompt_checkpoints;
@@ -0,0 +1,21 @@
+-- Migration: 000045_prompt_checkpoints
+-- Description: Periodic checkpoints of running prompts' output and working directory changes
+
+CREATE TABLE prompt_checkpoints (
+    -- Only a prompt's latest checkpoint is kept
+    prompt_id UUID PRIMARY KEY REFERENCES prompt_tasks(id) ON DELETE CASCADE,
+    attempt INTEGER NOT NULL,
+    sequence INTEGER NOT NULL,
+
+    stdout TEXT NOT NULL DEFAULT '',
+    stderr TEXT NOT NULL DEFAULT '',
+
+    -- Uncommitted changes in the working directory, as a git diff
+    diff TEXT NOT NULL DEFAULT '',
+    diff_truncated BOOLEAN NOT NULL DEFAULT false,
+
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Grant permissions to aetherium user
+GRANT ALL PRIVILEGES ON TABLE prompt_checkpoints TO aetherium;
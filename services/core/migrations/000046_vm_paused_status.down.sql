@@ -0,0 +1,8 @@
+-- Rollback migration: 000046_vm_paused_status
+
+UPDATE vms SET status = 'STOPPED' WHERE status = 'PAUSED';
+
+ALTER TABLE vms DROP CONSTRAINT IF EXISTS vms_status_check;
+
+ALTER TABLE vms ADD CONSTRAINT vms_status_check
+    CHECK (status IN ('CREATED', 'STARTING', 'RUNNING', 'STOPPING', 'STOPPED', 'CRASHED', 'FAILED'));
@@ -0,0 +1,7 @@
+-- Migration: 000046_vm_paused_status
+-- Description: Allow the PAUSED VM status for VMs snapshotted to disk by PauseVM
+
+ALTER TABLE vms DROP CONSTRAINT IF EXISTS vms_status_check;
+
+ALTER TABLE vms ADD CONSTRAINT vms_status_check
+    CHECK (status IN ('CREATED', 'STARTING', 'RUNNING', 'STOPPING', 'STOPPED', 'PAUSED', 'CRASHED', 'FAILED'));
@@ -0,0 +1,3 @@
+-- Rollback migration: 000047_prompt_workload_class
+
+ALTER TABLE prompt_tasks DROP COLUMN IF EXISTS workload_class;
@@ -0,0 +1,4 @@
+-- Migration: 000047_prompt_workload_class
+-- Description: Workload class prompts are queued in, kept so retries use the same lane
+
+ALTER TABLE prompt_tasks ADD COLUMN IF NOT EXISTS workload_class VARCHAR(20) NOT NULL DEFAULT 'batch';
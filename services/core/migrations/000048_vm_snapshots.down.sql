@@ -0,0 +1,3 @@
+-- Rollback migration: 000048_vm_snapshots
+
+DROP TABLE IF EXISTS vm_snapshots;
@@ -0,0 +1,22 @@
+-- Migration: 000048_vm_snapshots
+-- Description: Snapshots of VMs' memory, devices and disk, kept on the worker hosting the VM
+
+CREATE TABLE vm_snapshots (
+    id UUID PRIMARY KEY,
+    vm_id UUID NOT NULL REFERENCES vms(id) ON DELETE CASCADE,
+    worker_id VARCHAR(255), -- Worker the snapshot's files are kept on
+    name VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'ready', 'failed')),
+    size_bytes BIGINT,
+    error TEXT,
+
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP WITH TIME ZONE,
+    restored_at TIMESTAMP WITH TIME ZONE -- Last time the VM was restored to it
+);
+
+CREATE INDEX idx_vm_snapshots_vm_id ON vm_snapshots(vm_id, created_at DESC);
+
+-- Grant permissions to aetherium user
+GRANT ALL PRIVILEGES ON TABLE vm_snapshots TO aetherium;
@@ -0,0 +1,4 @@
+-- Rollback migration: 000049_slo
+
+DROP INDEX IF EXISTS idx_tasks_completed_at;
+DROP TABLE IF EXISTS slo_request_counts;
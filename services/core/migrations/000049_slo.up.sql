@@ -0,0 +1,19 @@
+-- Migration: 000049_slo
+-- Description: API request counts per SLO target, added to by every gateway, and an index for counting finished tasks
+
+CREATE TABLE slo_request_counts (
+    target VARCHAR(255) NOT NULL,
+    bucket TIMESTAMP WITH TIME ZONE NOT NULL, -- Start of the 5 minute bucket
+    total BIGINT NOT NULL DEFAULT 0,
+    good BIGINT NOT NULL DEFAULT 0, -- Succeeded (status below 500)
+    fast BIGINT NOT NULL DEFAULT 0, -- Succeeded within the target's latency
+    PRIMARY KEY (target, bucket)
+);
+
+CREATE INDEX idx_slo_request_counts_bucket ON slo_request_counts(bucket);
+
+-- Task SLOs count tasks by when they finished
+CREATE INDEX IF NOT EXISTS idx_tasks_completed_at ON tasks(completed_at) WHERE completed_at IS NOT NULL;
+
+-- Grant permissions to aetherium user
+GRANT ALL PRIVILEGES ON TABLE slo_request_counts TO aetherium;
@@ -0,0 +1,3 @@
+-- Rollback migration: 000050_task_list
+
+DROP INDEX IF EXISTS idx_tasks_created_at;
@@ -0,0 +1,4 @@
+-- Migration: 000050_task_list
+-- Description: Index tasks by creation time, so the task list can be served newest first
+
+CREATE INDEX IF NOT EXISTS idx_tasks_created_at ON tasks(created_at DESC);
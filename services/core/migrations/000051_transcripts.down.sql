@@ -0,0 +1,5 @@
+-- Rollback migration: 000051_transcripts
+
+DROP TABLE IF EXISTS transcript_anchors;
+DROP TABLE IF EXISTS transcript_entries;
+DROP FUNCTION IF EXISTS aetherium_append_only();
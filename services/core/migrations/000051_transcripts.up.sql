@@ -0,0 +1,40 @@
+-- Migration: 000051_transcripts
+-- Description: Hash chain over executions and finished prompts, and anchors of its head
+
+CREATE TABLE transcript_entries (
+    seq BIGINT PRIMARY KEY, -- 1, 2, 3... without gaps
+    kind VARCHAR(20) NOT NULL, -- execution or prompt
+    record_id UUID NOT NULL, -- No foreign key: entries outlive their records
+    content_hash VARCHAR(64) NOT NULL,
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_transcript_entries_record ON transcript_entries(record_id, seq);
+
+CREATE TABLE transcript_anchors (
+    seq BIGINT PRIMARY KEY,
+    hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Entries and anchors are append-only. The chain still catches edits made
+-- with this trigger dropped; it only stops them by mistake.
+CREATE OR REPLACE FUNCTION aetherium_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER transcript_entries_append_only
+    BEFORE UPDATE OR DELETE ON transcript_entries
+    FOR EACH ROW EXECUTE FUNCTION aetherium_append_only();
+
+CREATE TRIGGER transcript_anchors_append_only
+    BEFORE UPDATE OR DELETE ON transcript_anchors
+    FOR EACH ROW EXECUTE FUNCTION aetherium_append_only();
+
+-- Grant permissions to aetherium user
+GRANT ALL PRIVILEGES ON TABLE transcript_entries TO aetherium;
+GRANT ALL PRIVILEGES ON TABLE transcript_anchors TO aetherium;
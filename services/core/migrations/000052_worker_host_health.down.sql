@@ -0,0 +1,10 @@
+-- Rollback migration: 000052_worker_host_health
+
+ALTER TABLE worker_metrics DROP COLUMN IF EXISTS gpu_utilization_percent;
+ALTER TABLE worker_metrics DROP COLUMN IF EXISTS gpu_temperature_c;
+ALTER TABLE worker_metrics DROP COLUMN IF EXISTS temperature_c;
+ALTER TABLE worker_metrics DROP COLUMN IF EXISTS disk_io_percent;
+ALTER TABLE worker_metrics DROP COLUMN IF EXISTS cpu_steal_percent;
+ALTER TABLE worker_metrics DROP COLUMN IF EXISTS load_avg_15m;
+ALTER TABLE worker_metrics DROP COLUMN IF EXISTS load_avg_5m;
+ALTER TABLE worker_metrics DROP COLUMN IF EXISTS load_avg_1m;
@@ -0,0 +1,11 @@
+-- Migration: 000052_worker_host_health
+-- Description: Record host health signals in worker heartbeat metrics (NULL where the host doesn't expose them)
+
+ALTER TABLE worker_metrics ADD COLUMN IF NOT EXISTS load_avg_1m FLOAT;
+ALTER TABLE worker_metrics ADD COLUMN IF NOT EXISTS load_avg_5m FLOAT;
+ALTER TABLE worker_metrics ADD COLUMN IF NOT EXISTS load_avg_15m FLOAT;
+ALTER TABLE worker_metrics ADD COLUMN IF NOT EXISTS cpu_steal_percent FLOAT;
+ALTER TABLE worker_metrics ADD COLUMN IF NOT EXISTS disk_io_percent FLOAT;
+ALTER TABLE worker_metrics ADD COLUMN IF NOT EXISTS temperature_c FLOAT;
+ALTER TABLE worker_metrics ADD COLUMN IF NOT EXISTS gpu_temperature_c FLOAT;
+ALTER TABLE worker_metrics ADD COLUMN IF NOT EXISTS gpu_utilization_percent FLOAT;
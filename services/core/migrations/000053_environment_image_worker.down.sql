@@ -0,0 +1,3 @@
+-- Rollback migration: 000053_environment_image_worker
+
+ALTER TABLE environments DROP COLUMN IF EXISTS rootfs_image_worker_id;
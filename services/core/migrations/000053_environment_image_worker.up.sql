@@ -0,0 +1,5 @@
+-- Migration: 000053_environment_image_worker
+-- Description: Record which worker holds an environment's saved rootfs image, so its workspaces are created there
+
+-- Worker whose disk holds rootfs_image (NULL for images every worker has)
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS rootfs_image_worker_id VARCHAR(255);
@@ -0,0 +1,4 @@
+-- Rollback migration: 000054_prompt_checkpoint_sealed_diff
+
+ALTER TABLE prompt_checkpoints DROP COLUMN IF EXISTS sealed_diff_nonce;
+ALTER TABLE prompt_checkpoints DROP COLUMN IF EXISTS sealed_diff;
@@ -0,0 +1,6 @@
+-- Migration: 000054_prompt_checkpoint_sealed_diff
+-- Description: Keep checkpoint diffs unredacted but sealed, so retried prompts restore the real changes
+
+-- The diff before redaction, sealed with the workspace secret key; diff keeps the redacted copy shown to clients
+ALTER TABLE prompt_checkpoints ADD COLUMN IF NOT EXISTS sealed_diff BYTEA;
+ALTER TABLE prompt_checkpoints ADD COLUMN IF NOT EXISTS sealed_diff_nonce BYTEA;
@@ -0,0 +1,208 @@
+// Package markdown renders the Markdown people write in notes to HTML that
+// is safe to embed in a page. It covers the common subset: paragraphs,
+// ATX headings, lists, block quotes, fenced code, rules, code spans,
+// emphasis and links. Raw HTML isn't supported; it is escaped like any
+// other text, and only http, https and mailto links are kept.
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	orderedItem   = regexp.MustCompile(`^\d{1,9}[.)]\s+`)
+	linkPattern   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	strongPattern = regexp.MustCompile(`\*\*([^*]+)\*\*|\b__([^_]+)__\b`)
+	emPattern     = regexp.MustCompile(`\*([^*\s][^*]*)\*|\b_([^_\s][^_]*)_\b`)
+)
+
+// Render converts Markdown to HTML
+func Render(src string) string {
+	r := &renderer{}
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+
+		switch {
+		case strings.HasPrefix(line, "```"):
+			r.closeBlocks()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			r.out.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+
+		case line == "":
+			r.closeBlocks()
+
+		case headingLevel(line) > 0:
+			r.closeBlocks()
+			level := headingLevel(line)
+			text := strings.TrimSpace(strings.TrimRight(line[level:], "#"))
+			fmt.Fprintf(&r.out, "<h%d>%s</h%d>\n", level, inline(text), level)
+
+		case isRule(line):
+			r.closeBlocks()
+			r.out.WriteString("<hr>\n")
+
+		case strings.HasPrefix(line, ">"):
+			r.closeList()
+			r.flushParagraph()
+			r.quote = append(r.quote, strings.TrimSpace(line[1:]))
+
+		case isBulletItem(line):
+			r.listItem("ul", line[2:])
+
+		case orderedItem.MatchString(line):
+			r.listItem("ol", line[len(orderedItem.FindString(line)):])
+
+		default:
+			r.closeList()
+			r.closeQuote()
+			r.paragraph = append(r.paragraph, line)
+		}
+	}
+	r.closeBlocks()
+
+	return r.out.String()
+}
+
+// renderer holds the blocks still open while rendering
+type renderer struct {
+	out       strings.Builder
+	paragraph []string
+	quote     []string
+	list      string // "ul" or "ol" while a list is open
+}
+
+func (r *renderer) listItem(list, text string) {
+	r.flushParagraph()
+	r.closeQuote()
+	if r.list != list {
+		r.closeList()
+		r.out.WriteString("<" + list + ">\n")
+		r.list = list
+	}
+	r.out.WriteString("<li>" + inline(strings.TrimSpace(text)) + "</li>\n")
+}
+
+func (r *renderer) flushParagraph() {
+	if len(r.paragraph) == 0 {
+		return
+	}
+	r.out.WriteString("<p>" + inline(strings.Join(r.paragraph, "\n")) + "</p>\n")
+	r.paragraph = nil
+}
+
+func (r *renderer) closeQuote() {
+	if len(r.quote) == 0 {
+		return
+	}
+	r.out.WriteString("<blockquote><p>" + inline(strings.Join(r.quote, "\n")) + "</p></blockquote>\n")
+	r.quote = nil
+}
+
+func (r *renderer) closeList() {
+	if r.list == "" {
+		return
+	}
+	r.out.WriteString("</" + r.list + ">\n")
+	r.list = ""
+}
+
+func (r *renderer) closeBlocks() {
+	r.flushParagraph()
+	r.closeQuote()
+	r.closeList()
+}
+
+// headingLevel returns the level of an ATX heading line, or 0
+func headingLevel(line string) int {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(line) && line[level] != ' ') {
+		return 0
+	}
+	return level
+}
+
+// isRule reports whether a line is a thematic break: three or more of the
+// same of -, * or _, optionally spaced
+func isRule(line string) bool {
+	compact := strings.ReplaceAll(line, " ", "")
+	if len(compact) < 3 {
+		return false
+	}
+	c := compact[0]
+	return (c == '-' || c == '*' || c == '_') && strings.Count(compact, string(c)) == len(compact)
+}
+
+func isBulletItem(line string) bool {
+	return len(line) >= 2 && (line[0] == '-' || line[0] == '*' || line[0] == '+') && line[1] == ' '
+}
+
+// inline renders code spans, then links and emphasis in the text between
+// them
+func inline(text string) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(text, '`')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start+1:], '`')
+		if end < 0 {
+			break
+		}
+		b.WriteString(links(text[:start]))
+		b.WriteString("<code>" + html.EscapeString(text[start+1:start+1+end]) + "</code>")
+		text = text[start+end+2:]
+	}
+	b.WriteString(links(text))
+	return b.String()
+}
+
+// links renders links, dropping the target of any that isn't safe
+func links(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range linkPattern.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(emphasis(text[last:m[0]]))
+		label, href := text[m[2]:m[3]], text[m[4]:m[5]]
+		if safeURL(href) {
+			fmt.Fprintf(&b, `<a href="%s" rel="nofollow noopener noreferrer">%s</a>`, html.EscapeString(href), emphasis(label))
+		} else {
+			b.WriteString(emphasis(label))
+		}
+		last = m[1]
+	}
+	b.WriteString(emphasis(text[last:]))
+	return b.String()
+}
+
+func emphasis(text string) string {
+	text = html.EscapeString(text)
+	text = strongPattern.ReplaceAllString(text, "<strong>$1$2</strong>")
+	return emPattern.ReplaceAllString(text, "<em>$1$2</em>")
+}
+
+func safeURL(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRender tests each supported construct
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"paragraphs", "one\ntwo\n\nthree", "<p>one\ntwo</p>\n<p>three</p>\n"},
+		{"heading", "## Runbook ##", "<h2>Runbook</h2>\n"},
+		{"not a heading", "#hashtag", "<p>#hashtag</p>\n"},
+		{"bullets", "- a\n* b", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n"},
+		{"numbered", "1. a\n2) b", "<ol>\n<li>a</li>\n<li>b</li>\n</ol>\n"},
+		{"list switch", "- a\n1. b", "<ul>\n<li>a</li>\n</ul>\n<ol>\n<li>b</li>\n</ol>\n"},
+		{"quote", "> a\n> b", "<blockquote><p>a\nb</p></blockquote>\n"},
+		{"rule", "a\n\n- - -", "<p>a</p>\n<hr>\n"},
+		{"code block", "```go\nif a < b {\n```", "<pre><code>if a &lt; b {</code></pre>\n"},
+		{"emphasis", "**bold** and *it* and _it_", "<p><strong>bold</strong> and <em>it</em> and <em>it</em></p>\n"},
+		{"snake case", "use snake_case_names", "<p>use snake_case_names</p>\n"},
+		{"code span", "run `make *all*`", "<p>run <code>make *all*</code></p>\n"},
+		{"link", "[docs](https://example.com/a?b=1&c=2)", `<p><a href="https://example.com/a?b=1&amp;c=2" rel="nofollow noopener noreferrer">docs</a></p>` + "\n"},
+		{"mailto", "[mail](mailto:ops@example.com)", `<p><a href="mailto:ops@example.com" rel="nofollow noopener noreferrer">mail</a></p>` + "\n"},
+	}
+
+	for _, tt := range tests {
+		if got := Render(tt.src); got != tt.want {
+			t.Errorf("%s: Render(%q) = %q, want %q", tt.name, tt.src, got, tt.want)
+		}
+	}
+}
+
+// TestRenderIsSafe tests that markup and unsafe links don't get through
+func TestRenderIsSafe(t *testing.T) {
+	inputs := []string{
+		"<script>alert(1)</script>",
+		"<img src=x onerror=alert(1)>",
+		"[click](javascript:alert(1))",
+		"[click](data:text/html,<b>x</b>)",
+		`[click](https://example.com/"onmouseover="alert(1))`,
+		"> <iframe src=//example.com>",
+		"- <b onclick=x>",
+		"`</code><script>`",
+	}
+
+	for _, src := range inputs {
+		got := Render(src)
+		for _, bad := range []string{"<script", "<img", "<iframe", "<b ", "javascript:", "data:", `"onmouseover`} {
+			if strings.Contains(got, bad) {
+				t.Errorf("Render(%q) = %q contains %q", src, got, bad)
+			}
+		}
+	}
+}
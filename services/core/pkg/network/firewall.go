@@ -0,0 +1,277 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+)
+
+// firewallTable is the nftables table holding every VM's firewall rules.
+// It is a bridge table so rules see which TAP device a frame enters or
+// leaves by, whether it is routed by the host or switched to another VM.
+const firewallTable = "aetherium"
+
+// firewallBaseRules creates the table and its base chains. Frames are
+// dispatched on their TAP device through two verdict maps, so a VM's rules
+// are added and removed as one map element and two chains:
+//   - egress: frames from a VM, to the host (input) or another VM (forward)
+//   - ingress: frames to a VM, from the host (output) or another VM (forward)
+const firewallBaseRules = `
+table bridge aetherium {
+	map egress {
+		type ifname : verdict
+	}
+	map ingress {
+		type ifname : verdict
+	}
+	chain input {
+		type filter hook input priority 0; policy accept;
+		iifname vmap @egress
+	}
+	chain forward {
+		type filter hook forward priority 0; policy accept;
+		iifname vmap @egress
+		oifname vmap @ingress
+	}
+	chain output {
+		type filter hook output priority 0; policy accept;
+		oifname vmap @ingress
+	}
+}
+`
+
+// ValidateFirewall checks a firewall policy's actions, protocols, address
+// ranges and ports
+func ValidateFirewall(policy *types.FirewallPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if !validFirewallAction(policy.DefaultEgress, true) {
+		return fmt.Errorf("default_egress must be %q or %q", types.FirewallAllow, types.FirewallDeny)
+	}
+	if !validFirewallAction(policy.DefaultIngress, true) {
+		return fmt.Errorf("default_ingress must be %q or %q", types.FirewallAllow, types.FirewallDeny)
+	}
+
+	for i, rule := range policy.Rules {
+		if rule.Direction != types.FirewallEgress && rule.Direction != types.FirewallIngress {
+			return fmt.Errorf("rule %d: direction must be %q or %q", i, types.FirewallEgress, types.FirewallIngress)
+		}
+		if !validFirewallAction(rule.Action, false) {
+			return fmt.Errorf("rule %d: action must be %q or %q", i, types.FirewallAllow, types.FirewallDeny)
+		}
+		switch rule.Protocol {
+		case types.FirewallTCP, types.FirewallUDP:
+		case types.FirewallICMP, types.FirewallAny:
+			if rule.Ports != "" {
+				return fmt.Errorf("rule %d: ports only apply to tcp and udp", i)
+			}
+		default:
+			return fmt.Errorf("rule %d: protocol must be tcp, udp, icmp or any", i)
+		}
+		if rule.CIDR != "" {
+			if _, _, err := net.ParseCIDR(rule.CIDR); err != nil {
+				return fmt.Errorf("rule %d: invalid CIDR %q", i, rule.CIDR)
+			}
+		}
+		if rule.Ports != "" {
+			if _, _, err := parsePortRange(rule.Ports); err != nil {
+				return fmt.Errorf("rule %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validFirewallAction(action string, allowEmpty bool) bool {
+	return action == types.FirewallAllow || action == types.FirewallDeny || (allowEmpty && action == "")
+}
+
+// parsePortRange parses "443" or "8000-8100"
+func parsePortRange(ports string) (int, int, error) {
+	lowStr, highStr, isRange := strings.Cut(ports, "-")
+	if !isRange {
+		highStr = lowStr
+	}
+	low, err := strconv.Atoi(lowStr)
+	if err != nil || low < 1 || low > 65535 {
+		return 0, 0, fmt.Errorf("invalid port %q", lowStr)
+	}
+	high, err := strconv.Atoi(highStr)
+	if err != nil || high < 1 || high > 65535 {
+		return 0, 0, fmt.Errorf("invalid port %q", highStr)
+	}
+	if high < low {
+		return 0, 0, fmt.Errorf("invalid port range %q", ports)
+	}
+	return low, high, nil
+}
+
+// ApplyFirewall programs a VM's firewall policy on its TAP device,
+// replacing any rules it had. Traffic to and from the bridge gateway (the
+// HTTP proxy), IPv6 neighbor discovery and replies to allowed connections
+// always pass.
+func (m *Manager) ApplyFirewall(vmID string, policy *types.FirewallPolicy) error {
+	if err := ValidateFirewall(policy); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	tap, exists := m.tapDevices[vmID]
+	m.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("VM %s not found", vmID)
+	}
+
+	if err := m.ensureFirewallTable(); err != nil {
+		return err
+	}
+
+	gateway := extractIP(m.config.BridgeIP)
+	gateway6 := ""
+	if m.IPv6Enabled() {
+		gateway6 = extractIP(m.config.BridgeIP6)
+	}
+
+	var script bytes.Buffer
+	for _, direction := range []string{types.FirewallEgress, types.FirewallIngress} {
+		chain := firewallChain(tap.Name, direction)
+		fmt.Fprintf(&script, "add chain bridge %s %s\n", firewallTable, chain)
+		fmt.Fprintf(&script, "flush chain bridge %s %s\n", firewallTable, chain)
+		fmt.Fprintf(&script, "add rule bridge %s %s ether type arp accept\n", firewallTable, chain)
+		fmt.Fprintf(&script, "add rule bridge %s %s icmpv6 type { nd-router-solicit, nd-router-advert, nd-neighbor-solicit, nd-neighbor-advert } accept\n", firewallTable, chain)
+		fmt.Fprintf(&script, "add rule bridge %s %s ct state established,related accept\n", firewallTable, chain)
+		peer := "daddr"
+		if direction == types.FirewallIngress {
+			peer = "saddr"
+		}
+		fmt.Fprintf(&script, "add rule bridge %s %s ip %s %s accept\n", firewallTable, chain, peer, gateway)
+		if gateway6 != "" {
+			fmt.Fprintf(&script, "add rule bridge %s %s ip6 %s %s accept\n", firewallTable, chain, peer, gateway6)
+		}
+
+		defaultAction := policy.DefaultEgress
+		if direction == types.FirewallIngress {
+			defaultAction = policy.DefaultIngress
+		}
+		for _, rule := range policy.Rules {
+			if rule.Direction == direction {
+				fmt.Fprintf(&script, "add rule bridge %s %s %s\n", firewallTable, chain, nftRule(rule))
+			}
+		}
+		if defaultAction == types.FirewallDeny {
+			fmt.Fprintf(&script, "add rule bridge %s %s drop\n", firewallTable, chain)
+		}
+	}
+	fmt.Fprintf(&script, "add element bridge %s egress { %q : jump %s }\n",
+		firewallTable, tap.Name, firewallChain(tap.Name, types.FirewallEgress))
+	fmt.Fprintf(&script, "add element bridge %s ingress { %q : jump %s }\n",
+		firewallTable, tap.Name, firewallChain(tap.Name, types.FirewallIngress))
+
+	if err := runNft(script.String()); err != nil {
+		return fmt.Errorf("failed to program firewall for VM %s: %w", vmID, err)
+	}
+
+	log.Printf("Network: Applied %d firewall rules to %s", len(policy.Rules), tap.Name)
+	return nil
+}
+
+// removeFirewall drops a TAP device's firewall rules, if it has any
+func (m *Manager) removeFirewall(tapName string) {
+	if exec.Command("nft", "list", "table", "bridge", firewallTable).Run() != nil {
+		return
+	}
+
+	// One command per line so a device without rules doesn't stop the rest
+	for _, cmd := range []string{
+		fmt.Sprintf("delete element bridge %s egress { %q }", firewallTable, tapName),
+		fmt.Sprintf("delete element bridge %s ingress { %q }", firewallTable, tapName),
+		fmt.Sprintf("delete chain bridge %s %s", firewallTable, firewallChain(tapName, types.FirewallEgress)),
+		fmt.Sprintf("delete chain bridge %s %s", firewallTable, firewallChain(tapName, types.FirewallIngress)),
+	} {
+		runNft(cmd)
+	}
+}
+
+// ensureFirewallTable creates the firewall table on first use. An existing
+// table is kept, so VMs adopted after a worker restart keep their rules.
+func (m *Manager) ensureFirewallTable() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.firewallReady {
+		return nil
+	}
+	if exec.Command("nft", "list", "table", "bridge", firewallTable).Run() != nil {
+		if err := runNft(firewallBaseRules); err != nil {
+			return fmt.Errorf("failed to create nftables table (needs nftables and CAP_NET_ADMIN): %w", err)
+		}
+		log.Printf("Network: Created nftables table bridge %s", firewallTable)
+	}
+	m.firewallReady = true
+	return nil
+}
+
+// nftRule renders a rule's match and verdict
+func nftRule(rule types.FirewallRule) string {
+	var parts []string
+
+	if rule.CIDR != "" {
+		family := "ip"
+		if ip, _, err := net.ParseCIDR(rule.CIDR); err == nil && ip.To4() == nil {
+			family = "ip6"
+		}
+		if rule.Direction == types.FirewallEgress {
+			parts = append(parts, family+" daddr "+rule.CIDR)
+		} else {
+			parts = append(parts, family+" saddr "+rule.CIDR)
+		}
+	}
+
+	switch rule.Protocol {
+	case types.FirewallTCP, types.FirewallUDP:
+		if rule.Ports != "" {
+			parts = append(parts, rule.Protocol+" dport "+rule.Ports)
+		} else {
+			parts = append(parts, "meta l4proto "+rule.Protocol)
+		}
+	case types.FirewallICMP:
+		parts = append(parts, "meta l4proto { icmp, ipv6-icmp }")
+	default:
+		if rule.CIDR == "" {
+			parts = append(parts, "ether type { ip, ip6 }")
+		}
+	}
+
+	if rule.Action == types.FirewallAllow {
+		parts = append(parts, "accept")
+	} else {
+		parts = append(parts, "drop")
+	}
+	return strings.Join(parts, " ")
+}
+
+// firewallChain names a TAP device's chain for one direction
+func firewallChain(tapName, direction string) string {
+	if direction == types.FirewallEgress {
+		return tapName + "-out"
+	}
+	return tapName + "-in"
+}
+
+// runNft runs an nft script from stdin
+func runNft(script string) error {
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+)
+
+// TestValidateFirewall tests firewall policy validation
+func TestValidateFirewall(t *testing.T) {
+	valid := &types.FirewallPolicy{
+		DefaultEgress: types.FirewallDeny,
+		Rules: []types.FirewallRule{
+			{Direction: types.FirewallEgress, Action: types.FirewallAllow, Protocol: types.FirewallTCP, CIDR: "10.0.0.0/8", Ports: "443"},
+			{Direction: types.FirewallIngress, Action: types.FirewallAllow, Protocol: types.FirewallUDP, Ports: "8000-8100"},
+			{Direction: types.FirewallEgress, Action: types.FirewallDeny, Protocol: types.FirewallICMP},
+			{Direction: types.FirewallEgress, Action: types.FirewallAllow, Protocol: types.FirewallTCP, CIDR: "2001:db8::/32", Ports: "443"},
+		},
+	}
+	if err := ValidateFirewall(valid); err != nil {
+		t.Errorf("Expected valid policy, got error: %v", err)
+	}
+
+	invalid := map[string]types.FirewallRule{
+		"direction":  {Direction: "out", Action: types.FirewallAllow, Protocol: types.FirewallTCP},
+		"action":     {Direction: types.FirewallEgress, Action: "reject", Protocol: types.FirewallTCP},
+		"protocol":   {Direction: types.FirewallEgress, Action: types.FirewallAllow, Protocol: "sctp"},
+		"cidr":       {Direction: types.FirewallEgress, Action: types.FirewallAllow, Protocol: types.FirewallTCP, CIDR: "10.0.0.0"},
+		"port":       {Direction: types.FirewallEgress, Action: types.FirewallAllow, Protocol: types.FirewallTCP, Ports: "70000"},
+		"port range": {Direction: types.FirewallEgress, Action: types.FirewallAllow, Protocol: types.FirewallTCP, Ports: "90-80"},
+		"icmp ports": {Direction: types.FirewallEgress, Action: types.FirewallAllow, Protocol: types.FirewallICMP, Ports: "80"},
+	}
+	for name, rule := range invalid {
+		policy := &types.FirewallPolicy{Rules: []types.FirewallRule{rule}}
+		if err := ValidateFirewall(policy); err == nil {
+			t.Errorf("Expected error for invalid %s", name)
+		}
+	}
+}
+
+// TestNftRule tests rendering firewall rules as nftables statements
+func TestNftRule(t *testing.T) {
+	tests := []struct {
+		rule     types.FirewallRule
+		expected string
+	}{
+		{
+			rule:     types.FirewallRule{Direction: types.FirewallEgress, Action: types.FirewallAllow, Protocol: types.FirewallTCP, CIDR: "10.0.0.0/8", Ports: "443"},
+			expected: "ip daddr 10.0.0.0/8 tcp dport 443 accept",
+		},
+		{
+			rule:     types.FirewallRule{Direction: types.FirewallIngress, Action: types.FirewallDeny, Protocol: types.FirewallUDP},
+			expected: "meta l4proto udp drop",
+		},
+		{
+			rule:     types.FirewallRule{Direction: types.FirewallIngress, Action: types.FirewallAllow, Protocol: types.FirewallAny, CIDR: "192.168.1.0/24"},
+			expected: "ip saddr 192.168.1.0/24 accept",
+		},
+		{
+			rule:     types.FirewallRule{Direction: types.FirewallEgress, Action: types.FirewallDeny, Protocol: types.FirewallAny},
+			expected: "ether type { ip, ip6 } drop",
+		},
+		{
+			rule:     types.FirewallRule{Direction: types.FirewallEgress, Action: types.FirewallAllow, Protocol: types.FirewallTCP, CIDR: "2001:db8::/32", Ports: "443"},
+			expected: "ip6 daddr 2001:db8::/32 tcp dport 443 accept",
+		},
+		{
+			rule:     types.FirewallRule{Direction: types.FirewallIngress, Action: types.FirewallDeny, Protocol: types.FirewallICMP},
+			expected: "meta l4proto { icmp, ipv6-icmp } drop",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := nftRule(tt.rule); got != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, got)
+		}
+	}
+}
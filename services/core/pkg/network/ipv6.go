@@ -0,0 +1,258 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// IPv6 address modes for guests
+const (
+	// IPv6ModeStatic assigns each VM an address from the subnet and passes it
+	// to the guest agent on the kernel command line
+	IPv6ModeStatic = "static"
+
+	// IPv6ModeSLAAC advertises the subnet with radvd; guests configure their
+	// EUI-64 address from the router advertisements
+	IPv6ModeSLAAC = "slaac"
+)
+
+const (
+	radvdConfigPath = "/run/aetherium/radvd.conf"
+	radvdPIDPath    = "/run/aetherium/radvd.pid"
+)
+
+// radvdConfig advertises the VM subnet on the bridge, with Google's public
+// resolver to match the IPv4 kernel args
+const radvdConfig = `interface %s {
+	AdvSendAdvert on;
+	MinRtrAdvInterval 3;
+	MaxRtrAdvInterval 10;
+	prefix %s {
+		AdvOnLink on;
+		AdvAutonomous on;
+	};
+	RDNSS 2001:4860:4860::8888 {
+	};
+};
+`
+
+// IPv6Allocator manages IPv6 address allocation from a /64
+type IPv6Allocator struct {
+	subnet     *net.IPNet
+	allocated  map[string]bool
+	nextOffset uint64
+	mu         sync.Mutex
+}
+
+// NewIPv6Allocator creates an allocator for a /64 subnet
+func NewIPv6Allocator(subnetCIDR string) (*IPv6Allocator, error) {
+	_, subnet, err := net.ParseCIDR(subnetCIDR)
+	if err != nil || subnet.IP.To4() != nil {
+		return nil, fmt.Errorf("invalid IPv6 subnet CIDR %q", subnetCIDR)
+	}
+	if ones, _ := subnet.Mask.Size(); ones != 64 {
+		return nil, fmt.Errorf("IPv6 subnet %s must be a /64", subnetCIDR)
+	}
+
+	return &IPv6Allocator{
+		subnet:     subnet,
+		allocated:  make(map[string]bool),
+		nextOffset: 2, // Start from ::2 (::1 is gateway)
+	}, nil
+}
+
+// AllocateIP allocates the next free address in the subnet
+func (a *IPv6Allocator) AllocateIP() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// A /64 never runs out in practice; bound the search anyway
+	for i := 0; i < 1<<16; i++ {
+		ip := a.address(a.nextOffset)
+		a.nextOffset++
+		if a.nextOffset == 0 {
+			a.nextOffset = 2
+		}
+
+		if !a.allocated[ip] {
+			a.allocated[ip] = true
+			return ip + "/64", nil
+		}
+	}
+
+	return "", fmt.Errorf("no available IPv6 addresses in subnet")
+}
+
+// AllocateEUI64 reserves the address a guest with the given MAC configures
+// through SLAAC
+func (a *IPv6Allocator) AllocateEUI64(macAddr string) (string, error) {
+	mac, err := net.ParseMAC(macAddr)
+	if err != nil || len(mac) != 6 {
+		return "", fmt.Errorf("invalid MAC address %q", macAddr)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Interface ID: MAC split by ff:fe, universal/local bit flipped
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, a.subnet.IP)
+	ip[8] = mac[0] ^ 0x02
+	ip[9] = mac[1]
+	ip[10] = mac[2]
+	ip[11] = 0xff
+	ip[12] = 0xfe
+	ip[13] = mac[3]
+	ip[14] = mac[4]
+	ip[15] = mac[5]
+
+	ipStr := ip.String()
+	if a.allocated[ipStr] {
+		return "", fmt.Errorf("IPv6 address %s already allocated", ipStr)
+	}
+	a.allocated[ipStr] = true
+	return ipStr + "/64", nil
+}
+
+// ReleaseIP releases an IPv6 address
+func (a *IPv6Allocator) ReleaseIP(ipWithMask string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.allocated, strings.TrimSuffix(ipWithMask, "/64"))
+}
+
+// ReserveIP marks an already assigned IPv6 address as allocated
+func (a *IPv6Allocator) ReserveIP(ipWithMask string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.allocated[strings.TrimSuffix(ipWithMask, "/64")] = true
+}
+
+// address returns the subnet address with the given interface ID
+func (a *IPv6Allocator) address(offset uint64) string {
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, a.subnet.IP)
+	binary.BigEndian.PutUint64(ip[8:], offset)
+	return ip.String()
+}
+
+// IPv6Enabled reports whether VMs get IPv6 addresses
+func (m *Manager) IPv6Enabled() bool {
+	return m.ipv6Allocator != nil
+}
+
+// IPv6Mode returns how guests configure their IPv6 address
+func (m *Manager) IPv6Mode() string {
+	if m.config.IPv6Mode == "" {
+		return IPv6ModeStatic
+	}
+	return m.config.IPv6Mode
+}
+
+// setupIPv6 assigns the bridge its IPv6 address and enables forwarding, NAT
+// and router advertisements as configured. Each step is idempotent, so it
+// also runs on bridges created by setup-network.sh.
+func (m *Manager) setupIPv6() error {
+	if err := exec.Command("ip", "-6", "addr", "replace", m.config.BridgeIP6, "dev", m.config.BridgeName).Run(); err != nil {
+		return fmt.Errorf("failed to set bridge IPv6 address: %w", err)
+	}
+
+	if err := exec.Command("sysctl", "-w", "net.ipv6.conf.all.forwarding=1").Run(); err != nil {
+		return fmt.Errorf("failed to enable IPv6 forwarding: %w", err)
+	}
+
+	if m.config.EnableNAT {
+		if err := m.setupNAT6(); err != nil {
+			return fmt.Errorf("failed to setup IPv6 NAT: %w", err)
+		}
+	}
+
+	if m.IPv6Mode() == IPv6ModeSLAAC {
+		if err := m.startRADVD(); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Network: IPv6 %s on %s (%s)", m.config.SubnetCIDR6, m.config.BridgeName, m.IPv6Mode())
+	return nil
+}
+
+// setupNAT6 masquerades the VM subnet, which is normally a ULA prefix, behind
+// the host's IPv6 address
+func (m *Manager) setupNAT6() error {
+	hostIface := m.config.HostInterface
+	if hostIface == "" {
+		var err error
+		hostIface, err = getDefaultInterface()
+		if err != nil {
+			return fmt.Errorf("failed to detect host interface: %w", err)
+		}
+	}
+
+	rules := [][]string{
+		{"-t", "nat", "POSTROUTING", "-s", m.config.SubnetCIDR6, "-o", hostIface, "-j", "MASQUERADE"},
+		{"FORWARD", "-i", m.config.BridgeName, "-j", "ACCEPT"},
+		{"FORWARD", "-o", m.config.BridgeName, "-j", "ACCEPT"},
+	}
+	for _, rule := range rules {
+		if err := ensureIP6TablesRule(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureIP6TablesRule appends an ip6tables rule unless it already exists.
+// rule is the chain and match, optionally preceded by "-t <table>".
+func ensureIP6TablesRule(rule []string) error {
+	var table []string
+	if rule[0] == "-t" {
+		table, rule = rule[:2], rule[2:]
+	}
+	check := append(append(append([]string{}, table...), "-C"), rule...)
+	if exec.Command("ip6tables", check...).Run() == nil {
+		return nil
+	}
+	add := append(append(append([]string{}, table...), "-A"), rule...)
+	if err := exec.Command("ip6tables", add...).Run(); err != nil {
+		return fmt.Errorf("failed to add ip6tables rule %v: %w", rule, err)
+	}
+	return nil
+}
+
+// startRADVD starts radvd on the bridge unless one started by an earlier
+// worker run is still alive
+func (m *Manager) startRADVD() error {
+	if pid, err := os.ReadFile(radvdPIDPath); err == nil {
+		if exec.Command("kill", "-0", strings.TrimSpace(string(pid))).Run() == nil {
+			return nil
+		}
+	}
+
+	if _, err := exec.LookPath("radvd"); err != nil {
+		return fmt.Errorf("radvd is not installed (needed for ipv6 mode %q)", IPv6ModeSLAAC)
+	}
+	if err := os.MkdirAll(filepath.Dir(radvdConfigPath), 0755); err != nil {
+		return fmt.Errorf("failed to create radvd config directory: %w", err)
+	}
+	config := fmt.Sprintf(radvdConfig, m.config.BridgeName, m.config.SubnetCIDR6)
+	if err := os.WriteFile(radvdConfigPath, []byte(config), 0644); err != nil {
+		return fmt.Errorf("failed to write radvd config: %w", err)
+	}
+
+	// radvd daemonizes and outlives the worker, like the VMs it serves
+	if output, err := exec.Command("radvd", "-C", radvdConfigPath, "-p", radvdPIDPath).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to start radvd: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	log.Printf("Network: Started radvd on %s", m.config.BridgeName)
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net"
 	"os/exec"
+	"strings"
 	"sync"
 
 	"github.com/aetherium/aetherium/libs/common/pkg/config"
@@ -19,24 +20,33 @@ type NetworkConfig struct {
 	TapPrefix     string
 	EnableNAT     bool
 	HostInterface string
+
+	// Dual-stack settings; VMs are IPv4-only when SubnetCIDR6 is empty
+	BridgeIP6   string // e.g. "fd00:ae::1/64"
+	SubnetCIDR6 string // a /64, e.g. "fd00:ae::/64"
+	IPv6Mode    string // IPv6ModeStatic (default) or IPv6ModeSLAAC
 }
 
 // Manager manages network resources for VMs
 type Manager struct {
-	config       NetworkConfig
-	tapDevices   map[string]*TAPDevice
-	ipAllocator  *IPAllocator
-	proxyManager *ProxyManager
-	mu           sync.Mutex
-	bridgeSetup  bool
+	config        NetworkConfig
+	tapDevices    map[string]*TAPDevice
+	ipAllocator   *IPAllocator
+	ipv6Allocator *IPv6Allocator // nil unless IPv6 is enabled
+	proxyManager  *ProxyManager
+	mu            sync.Mutex
+	bridgeSetup   bool
+	firewallReady bool // nftables table created, see ensureFirewallTable
 }
 
 // TAPDevice represents a TAP network device
 type TAPDevice struct {
-	Name      string
-	IPAddress string
-	Gateway   string
-	MACAddr   string
+	Name        string
+	IPAddress   string
+	Gateway     string
+	MACAddr     string
+	IPv6Address string // empty unless IPv6 is enabled
+	Gateway6    string
 }
 
 // IPAllocator manages IP address allocation
@@ -54,7 +64,7 @@ func NewManager(config NetworkConfig) (*Manager, error) {
 		return nil, fmt.Errorf("invalid subnet CIDR: %w", err)
 	}
 
-	return &Manager{
+	manager := &Manager{
 		config:      config,
 		tapDevices:  make(map[string]*TAPDevice),
 		ipAllocator: &IPAllocator{
@@ -62,7 +72,12 @@ func NewManager(config NetworkConfig) (*Manager, error) {
 			allocated:  make(map[string]bool),
 			nextOffset: 2, // Start from .2 (.1 is gateway)
 		},
-	}, nil
+	}
+	if err := manager.initIPv6(); err != nil {
+		return nil, err
+	}
+
+	return manager, nil
 }
 
 // NewManagerWithProxy creates a new network manager with proxy support
@@ -81,6 +96,9 @@ func NewManagerWithProxy(netConfig NetworkConfig, proxyConfig config.ProxyConfig
 			nextOffset: 2, // Start from .2 (.1 is gateway)
 		},
 	}
+	if err := manager.initIPv6(); err != nil {
+		return nil, err
+	}
 
 	// Initialize proxy manager if enabled
 	if proxyConfig.Enabled {
@@ -88,12 +106,45 @@ func NewManagerWithProxy(netConfig NetworkConfig, proxyConfig config.ProxyConfig
 		if err != nil {
 			return nil, fmt.Errorf("failed to create proxy manager: %w", err)
 		}
+		if manager.IPv6Enabled() {
+			if err := proxyMgr.SetIPv6(netConfig.BridgeIP6, netConfig.SubnetCIDR6); err != nil {
+				return nil, fmt.Errorf("failed to enable proxy IPv6: %w", err)
+			}
+		}
 		manager.proxyManager = proxyMgr
 	}
 
 	return manager, nil
 }
 
+// initIPv6 validates the dual-stack settings and creates the IPv6 allocator
+func (m *Manager) initIPv6() error {
+	if m.config.SubnetCIDR6 == "" {
+		return nil
+	}
+
+	allocator, err := NewIPv6Allocator(m.config.SubnetCIDR6)
+	if err != nil {
+		return err
+	}
+	if _, bridgeNet, err := net.ParseCIDR(m.config.BridgeIP6); err != nil || bridgeNet.String() != allocator.subnet.String() {
+		return fmt.Errorf("invalid IPv6 bridge address %q: must be in %s", m.config.BridgeIP6, m.config.SubnetCIDR6)
+	}
+	switch m.config.IPv6Mode {
+	case "", IPv6ModeStatic, IPv6ModeSLAAC:
+	default:
+		return fmt.Errorf("invalid IPv6 mode %q: must be %q or %q", m.config.IPv6Mode, IPv6ModeStatic, IPv6ModeSLAAC)
+	}
+
+	m.ipv6Allocator = allocator
+	return nil
+}
+
+// BridgeName returns the name of the bridge VMs' TAP devices are attached to
+func (m *Manager) BridgeName() string {
+	return m.config.BridgeName
+}
+
 // SetupBridge creates and configures the bridge interface
 func (m *Manager) SetupBridge() error {
 	m.mu.Lock()
@@ -110,6 +161,11 @@ func (m *Manager) SetupBridge() error {
 		if iface.Flags&net.FlagUp != 0 {
 			// Bridge is already up and configured
 			fmt.Printf("✓ Using existing bridge %s\n", m.config.BridgeName)
+			if m.IPv6Enabled() {
+				if err := m.setupIPv6(); err != nil {
+					return err
+				}
+			}
 			m.bridgeSetup = true
 			return nil
 		}
@@ -146,6 +202,12 @@ func (m *Manager) SetupBridge() error {
 		}
 	}
 
+	if m.IPv6Enabled() {
+		if err := m.setupIPv6(); err != nil {
+			return err
+		}
+	}
+
 	// Start proxy if enabled
 	if m.proxyManager != nil {
 		ctx := context.Background()
@@ -285,6 +347,22 @@ func (m *Manager) CreateTAPDevice(vmID string) (*TAPDevice, error) {
 		MACAddr:   macAddr,
 	}
 
+	if m.IPv6Enabled() {
+		var ip6 string
+		if m.IPv6Mode() == IPv6ModeSLAAC {
+			ip6, err = m.ipv6Allocator.AllocateEUI64(macAddr)
+		} else {
+			ip6, err = m.ipv6Allocator.AllocateIP()
+		}
+		if err != nil {
+			exec.Command("ip", "link", "delete", tapName).Run()
+			m.ipAllocator.ReleaseIP(ip)
+			return nil, fmt.Errorf("failed to allocate IPv6 address: %w", err)
+		}
+		tap.IPv6Address = ip6
+		tap.Gateway6 = m.config.BridgeIP6
+	}
+
 	m.tapDevices[vmID] = tap
 	return tap, nil
 }
@@ -299,6 +377,8 @@ func (m *Manager) DeleteTAPDevice(vmID string) error {
 		return nil
 	}
 
+	m.removeFirewall(tap.Name)
+
 	// Delete TAP device
 	if err := exec.Command("ip", "link", "delete", tap.Name).Run(); err != nil {
 		// Ignore error if device doesn't exist
@@ -306,11 +386,27 @@ func (m *Manager) DeleteTAPDevice(vmID string) error {
 
 	// Release IP
 	m.ipAllocator.ReleaseIP(tap.IPAddress)
+	if m.ipv6Allocator != nil && tap.IPv6Address != "" {
+		m.ipv6Allocator.ReleaseIP(tap.IPv6Address)
+	}
 
 	delete(m.tapDevices, vmID)
 	return nil
 }
 
+// RestoreTAPDevice registers a TAP device created by a previous worker run,
+// so its IP isn't handed out again and DeleteTAPDevice can remove it
+func (m *Manager) RestoreTAPDevice(vmID string, tap *TAPDevice) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ipAllocator.ReserveIP(tap.IPAddress)
+	if m.ipv6Allocator != nil && tap.IPv6Address != "" {
+		m.ipv6Allocator.ReserveIP(tap.IPv6Address)
+	}
+	m.tapDevices[vmID] = tap
+}
+
 // AllocateIP allocates an IP address from the subnet
 func (a *IPAllocator) AllocateIP() (string, error) {
 	a.mu.Lock()
@@ -357,6 +453,19 @@ func (a *IPAllocator) ReleaseIP(ipWithMask string) {
 	delete(a.allocated, ip)
 }
 
+// ReserveIP marks an already assigned IP address as allocated
+func (a *IPAllocator) ReserveIP(ipWithMask string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ip := ipWithMask
+	if idx := len(ipWithMask) - 3; idx > 0 && ipWithMask[idx:] == "/24" {
+		ip = ipWithMask[:idx]
+	}
+
+	a.allocated[ip] = true
+}
+
 // getDefaultInterface returns the default network interface
 func getDefaultInterface() (string, error) {
 	// Get default route
@@ -426,7 +535,12 @@ func (m *Manager) RegisterVMWithProxy(vmID, vmName string, domains []string) err
 		vmIP = vmIP[:idx]
 	}
 
-	return m.proxyManager.UpdateVMWhitelist(vmID, vmName, vmIP, domains)
+	return m.proxyManager.UpdateVMWhitelistData(vmID, VMWhitelistData{
+		Name:    vmName,
+		IP:      vmIP,
+		IPv6:    strings.TrimSuffix(tap.IPv6Address, "/64"),
+		Domains: domains,
+	})
 }
 
 // UnregisterVMFromProxy removes a VM from the proxy whitelist
@@ -18,6 +18,8 @@ type ProxyManager struct {
 	config       config.ProxyConfig
 	bridgeIP     string
 	subnetCIDR   string
+	bridgeIP6    string // empty unless IPv6 is enabled
+	subnetCIDR6  string
 	squidManager *SquidManager
 	mu           sync.RWMutex
 	running      bool
@@ -37,6 +39,7 @@ type ProxyStats struct {
 type VMWhitelistData struct {
 	Name    string
 	IP      string
+	IPv6    string // empty for IPv4-only VMs
 	Domains []string
 }
 
@@ -71,6 +74,21 @@ func NewProxyManager(proxyConfig config.ProxyConfig, bridgeIP, subnetCIDR string
 	}, nil
 }
 
+// SetIPv6 makes the proxy dual-stack: it also listens on the bridge's IPv6
+// address and accepts requests from the IPv6 VM subnet. Call it before Start.
+func (pm *ProxyManager) SetIPv6(bridgeIP6, subnetCIDR6 string) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.bridgeIP6 = bridgeIP6
+	pm.subnetCIDR6 = subnetCIDR6
+
+	if pm.squidManager != nil {
+		return pm.squidManager.SetIPv6(bridgeIP6, subnetCIDR6)
+	}
+	return nil
+}
+
 // Start starts the proxy service
 func (pm *ProxyManager) Start(ctx context.Context) error {
 	pm.mu.Lock()
@@ -178,6 +196,16 @@ func (pm *ProxyManager) UpdateWhitelist(domains []string) error {
 
 // UpdateVMWhitelist updates whitelist for a specific VM
 func (pm *ProxyManager) UpdateVMWhitelist(vmID, vmName, vmIP string, domains []string) error {
+	return pm.UpdateVMWhitelistData(vmID, VMWhitelistData{
+		Name:    vmName,
+		IP:      vmIP,
+		Domains: domains,
+	})
+}
+
+// UpdateVMWhitelistData updates whitelist for a specific VM, including its
+// IPv6 address on dual-stack deployments
+func (pm *ProxyManager) UpdateVMWhitelistData(vmID string, vmData VMWhitelistData) error {
 	pm.mu.Lock()
 
 	if !pm.config.Enabled || !pm.running {
@@ -186,11 +214,6 @@ func (pm *ProxyManager) UpdateVMWhitelist(vmID, vmName, vmIP string, domains []s
 	}
 
 	if pm.squidManager != nil {
-		vmData := VMWhitelistData{
-			Name:    vmName,
-			IP:      vmIP,
-			Domains: domains,
-		}
 		if err := pm.squidManager.UpdateVMWhitelist(vmID, vmData); err != nil {
 			pm.mu.Unlock()
 			return fmt.Errorf("failed to update VM whitelist: %w", err)
@@ -263,12 +286,14 @@ func (pm *ProxyManager) setupTransparentProxy() error {
 
 		// Check if rule exists
 		checkRule := append([]string{"-t", "nat", "-C", "PREROUTING"}, rule[4:]...)
-		if err := exec.Command("iptables", checkRule...).Run(); err != nil {
-			// Rule doesn't exist, add it
-			if err := exec.Command("iptables", rule...).Run(); err != nil {
-				return fmt.Errorf("failed to add HTTP redirect rule: %w", err)
+		for _, tool := range pm.iptablesCommands() {
+			if err := exec.Command(tool, checkRule...).Run(); err != nil {
+				// Rule doesn't exist, add it
+				if err := exec.Command(tool, rule...).Run(); err != nil {
+					return fmt.Errorf("failed to add HTTP redirect rule: %w", err)
+				}
+				fmt.Printf("✓ HTTP redirect rule added (%s)\n", tool)
 			}
-			fmt.Println("✓ HTTP redirect rule added")
 		}
 	}
 
@@ -287,12 +312,14 @@ func (pm *ProxyManager) setupTransparentProxy() error {
 
 		// Check if rule exists
 		checkRule := append([]string{"-t", "nat", "-C", "PREROUTING"}, rule[4:]...)
-		if err := exec.Command("iptables", checkRule...).Run(); err != nil {
-			// Rule doesn't exist, add it
-			if err := exec.Command("iptables", rule...).Run(); err != nil {
-				return fmt.Errorf("failed to add HTTPS redirect rule: %w", err)
+		for _, tool := range pm.iptablesCommands() {
+			if err := exec.Command(tool, checkRule...).Run(); err != nil {
+				// Rule doesn't exist, add it
+				if err := exec.Command(tool, rule...).Run(); err != nil {
+					return fmt.Errorf("failed to add HTTPS redirect rule: %w", err)
+				}
+				fmt.Printf("✓ HTTPS redirect rule added (%s)\n", tool)
 			}
-			fmt.Println("✓ HTTPS redirect rule added")
 		}
 	}
 
@@ -314,7 +341,9 @@ func (pm *ProxyManager) removeTransparentProxyRules() {
 			"-j", "REDIRECT",
 			"--to-port", strconv.Itoa(pm.config.Port),
 		}
-		exec.Command("iptables", rule...).Run() // Ignore errors on cleanup
+		for _, tool := range pm.iptablesCommands() {
+			exec.Command(tool, rule...).Run() // Ignore errors on cleanup
+		}
 	}
 
 	// Remove HTTPS redirect rule
@@ -329,12 +358,23 @@ func (pm *ProxyManager) removeTransparentProxyRules() {
 			"-j", "REDIRECT",
 			"--to-port", strconv.Itoa(httpsPort),
 		}
-		exec.Command("iptables", rule...).Run() // Ignore errors on cleanup
+		for _, tool := range pm.iptablesCommands() {
+			exec.Command(tool, rule...).Run() // Ignore errors on cleanup
+		}
 	}
 
 	fmt.Println("✓ Proxy iptables rules removed")
 }
 
+// iptablesCommands returns the iptables binaries redirect rules are set up
+// with: ip6tables too when the proxy is dual-stack
+func (pm *ProxyManager) iptablesCommands() []string {
+	if pm.subnetCIDR6 != "" {
+		return []string{"iptables", "ip6tables"}
+	}
+	return []string{"iptables"}
+}
+
 // checkSquidInstalled checks if Squid is installed on the system
 func checkSquidInstalled() error {
 	if _, err := exec.LookPath("squid"); err != nil {
@@ -21,6 +21,8 @@ type SquidManager struct {
 	config        config.ProxyConfig
 	bridgeIP      string
 	subnetCIDR    string
+	bridgeIP6     string
+	subnetCIDR6   string
 	process       *exec.Cmd
 	pid           int
 	globalDomains []string
@@ -60,6 +62,20 @@ func NewSquidManager(proxyConfig config.ProxyConfig, bridgeIP, subnetCIDR string
 	return sm, nil
 }
 
+// SetIPv6 adds the bridge's IPv6 address and VM subnet to the configuration
+func (sm *SquidManager) SetIPv6(bridgeIP6, subnetCIDR6 string) error {
+	sm.mu.Lock()
+	sm.bridgeIP6 = extractIP(bridgeIP6)
+	sm.subnetCIDR6 = subnetCIDR6
+	sm.mu.Unlock()
+
+	if err := sm.GenerateConfig(); err != nil {
+		return fmt.Errorf("failed to regenerate config: %w", err)
+	}
+
+	return nil
+}
+
 // Start starts the Squid proxy process
 func (sm *SquidManager) Start(ctx context.Context) error {
 	sm.mu.Lock()
@@ -191,6 +207,8 @@ func (sm *SquidManager) GenerateConfig() error {
 		"Port":          sm.config.Port,
 		"HTTPSPort":     sm.config.Port + 1,
 		"SubnetCIDR":    sm.subnetCIDR,
+		"BridgeIP6":     sm.bridgeIP6,
+		"SubnetCIDR6":   sm.subnetCIDR6,
 		"GlobalDomains": sm.globalDomains,
 		"VMWhitelists":  sm.vmWhitelists,
 		"CacheDir":      sm.config.Squid.CacheDir,
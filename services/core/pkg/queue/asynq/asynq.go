@@ -3,7 +3,9 @@ package asynq
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -19,12 +21,17 @@ type Config struct {
 	RedisDB       int
 	Concurrency   int // Number of worker goroutines
 	Queues        map[string]int // Queue name -> priority
+	Policies      queue.Policies // Retry, backoff and timeout per task type (see queue.DefaultPolicies)
+
+	// Lanes enqueues each workload class on queues of its own and reserves
+	// concurrency for it; nil puts every class on the same queues
+	Lanes queue.Lanes
 }
 
 // AsynqQueue implements queue.Queue using Asynq
 type AsynqQueue struct {
 	client   *asynq.Client
-	server   *asynq.Server
+	servers  []*asynq.Server // One for the shared concurrency, one per lane with reserved slots
 	mux      *asynq.ServeMux
 	handlers map[queue.TaskType]queue.TaskHandler
 	mu       sync.RWMutex
@@ -55,29 +62,80 @@ func NewQueue(config Config) (*AsynqQueue, error) {
 		config.Concurrency = 10
 	}
 
-	server := asynq.NewServer(
+	var servers []*asynq.Server
+	if config.Lanes == nil {
+		servers = append(servers, newServer(redisOpt, config, config.Concurrency, config.Queues))
+	} else {
+		shared := config.Concurrency - config.Lanes.Reserved()
+		if shared < 0 {
+			return nil, fmt.Errorf("queue lanes reserve %d slots, more than the concurrency of %d", config.Lanes.Reserved(), config.Concurrency)
+		}
+		if shared > 0 {
+			servers = append(servers, newServer(redisOpt, config, shared, laneQueues(config.Queues, queue.WorkloadClasses...)))
+		}
+		for _, class := range queue.WorkloadClasses {
+			if slots := config.Lanes[class]; slots > 0 {
+				servers = append(servers, newServer(redisOpt, config, slots, laneQueues(config.Queues, class)))
+			}
+		}
+		config.Queues = laneQueues(config.Queues, queue.WorkloadClasses...)
+	}
+
+	return &AsynqQueue{
+		client:   client,
+		servers:  servers,
+		mux:      asynq.NewServeMux(),
+		handlers: make(map[queue.TaskType]queue.TaskHandler),
+		config:   config,
+	}, nil
+}
+
+// laneQueues returns the queues of the workload classes' lanes, keeping
+// their priorities. Interactive lanes weigh twice as much, so a server
+// shared with batch lanes picks their tasks first.
+func laneQueues(queues map[string]int, classes ...queue.WorkloadClass) map[string]int {
+	lanes := make(map[string]int, len(queues)*len(classes))
+	for _, class := range classes {
+		for name, priority := range queues {
+			if class == queue.WorkloadInteractive {
+				priority *= 2
+			}
+			lanes[queue.LaneQueue(class, name)] = priority
+		}
+	}
+	return lanes
+}
+
+// newServer creates a server processing the given queues
+func newServer(redisOpt asynq.RedisClientOpt, config Config, concurrency int, queues map[string]int) *asynq.Server {
+	return asynq.NewServer(
 		redisOpt,
 		asynq.Config{
-			Concurrency: config.Concurrency,
-			Queues:      config.Queues,
+			Concurrency: concurrency,
+			Queues:      queues,
+			// n is how often the task has been retried so far
+			RetryDelayFunc: func(n int, err error, task *asynq.Task) time.Duration {
+				return config.Policies.For(queue.TaskType(task.Type())).RetryDelay(n + 1)
+			},
 			ErrorHandler: asynq.ErrorHandlerFunc(func(ctx context.Context, task *asynq.Task, err error) {
 				// Log error (in production, send to logging system)
 				fmt.Printf("Error processing task %s: %v\n", task.Type(), err)
 			}),
 		},
 	)
-
-	return &AsynqQueue{
-		client:   client,
-		server:   server,
-		mux:      asynq.NewServeMux(),
-		handlers: make(map[queue.TaskType]queue.TaskHandler),
-		config:   config,
-	}, nil
 }
 
 // Enqueue adds a task to the queue
 func (q *AsynqQueue) Enqueue(ctx context.Context, task *queue.Task, opts *queue.TaskOptions) error {
+	if err := queue.ValidateTask(task); err != nil {
+		return err
+	}
+
+	task.EnqueuedAt = time.Now()
+	if opts != nil && opts.ProcessAt.After(task.EnqueuedAt) {
+		task.EnqueuedAt = opts.ProcessAt
+	}
+
 	payload, err := json.Marshal(task)
 	if err != nil {
 		return fmt.Errorf("failed to marshal task: %w", err)
@@ -85,37 +143,51 @@ func (q *AsynqQueue) Enqueue(ctx context.Context, task *queue.Task, opts *queue.
 
 	asynqTask := asynq.NewTask(string(task.Type), payload)
 
-	// Build options
-	var asynqOpts []asynq.Option
+	// Build options. Retries and timeout come from the task type's policy
+	// unless the caller overrides them.
+	policy := q.config.Policies.For(task.Type)
+	maxRetry, timeout := policy.MaxRetry, policy.Timeout
+	if opts != nil && opts.MaxRetry > 0 {
+		maxRetry = opts.MaxRetry
+	}
+	if opts != nil && opts.Timeout > 0 {
+		timeout = opts.Timeout
+	}
+	asynqOpts := []asynq.Option{asynq.MaxRetry(maxRetry), asynq.Timeout(timeout)}
+	queueName := "default"
 
 	if opts != nil {
 		if !opts.ProcessAt.IsZero() {
 			asynqOpts = append(asynqOpts, asynq.ProcessAt(opts.ProcessAt))
 		}
-		if opts.MaxRetry > 0 {
-			asynqOpts = append(asynqOpts, asynq.MaxRetry(opts.MaxRetry))
-		} else {
-			asynqOpts = append(asynqOpts, asynq.MaxRetry(3)) // Default
-		}
-		if opts.Timeout > 0 {
-			asynqOpts = append(asynqOpts, asynq.Timeout(opts.Timeout))
-		} else {
-			asynqOpts = append(asynqOpts, asynq.Timeout(10*time.Minute)) // Default
-		}
 		if opts.Queue != "" {
-			asynqOpts = append(asynqOpts, asynq.Queue(opts.Queue))
+			queueName = opts.Queue
 		}
 		if opts.Priority > 0 {
 			// Map priority to queue
-			queueName := q.getQueueForPriority(opts.Priority)
-			asynqOpts = append(asynqOpts, asynq.Queue(queueName))
+			queueName = q.getQueueForPriority(opts.Priority)
+		}
+		if opts.UniqueKey != "" {
+			asynqOpts = append(asynqOpts, asynq.TaskID(queue.UniqueTaskID(task.Type, opts.UniqueKey)))
 		}
-	} else {
-		asynqOpts = append(asynqOpts, asynq.MaxRetry(3))
-		asynqOpts = append(asynqOpts, asynq.Timeout(10*time.Minute))
 	}
+	if q.config.Lanes != nil {
+		class := queue.DefaultWorkloadClass(task.Type)
+		if opts != nil && opts.Class != "" {
+			class = opts.Class
+		}
+		queueName = queue.LaneQueue(class, queueName)
+	}
+	asynqOpts = append(asynqOpts, asynq.Queue(queueName))
 
 	_, err = q.client.EnqueueContext(ctx, asynqTask, asynqOpts...)
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		uniqueID := queue.UniqueTaskID(task.Type, opts.UniqueKey)
+		if !q.releaseTaskID(queueName, uniqueID) {
+			return fmt.Errorf("%w: %s", queue.ErrDuplicateTask, uniqueID)
+		}
+		_, err = q.client.EnqueueContext(ctx, asynqTask, asynqOpts...)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to enqueue task: %w", err)
 	}
@@ -123,6 +195,24 @@ func (q *AsynqQueue) Enqueue(ctx context.Context, task *queue.Task, opts *queue.
 	return nil
 }
 
+// releaseTaskID frees a unique task ID held by a task that has finished.
+// Asynq keeps archived tasks (failed after all retries) and retained
+// completed tasks, and both still block their ID. Reports whether the ID
+// is free.
+func (q *AsynqQueue) releaseTaskID(queueName, taskID string) bool {
+	inspector := q.newInspector()
+	defer inspector.Close()
+
+	info, err := inspector.GetTaskInfo(queueName, taskID)
+	if err != nil {
+		return errors.Is(err, asynq.ErrTaskNotFound)
+	}
+	if info.State != asynq.TaskStateArchived && info.State != asynq.TaskStateCompleted {
+		return false
+	}
+	return inspector.DeleteTask(queueName, taskID) == nil
+}
+
 // RegisterHandler registers a handler for a task type
 func (q *AsynqQueue) RegisterHandler(taskType queue.TaskType, handler queue.TaskHandler) error {
 	q.mu.Lock()
@@ -138,17 +228,37 @@ func (q *AsynqQueue) RegisterHandler(taskType queue.TaskType, handler queue.Task
 	q.mux.HandleFunc(string(taskType), func(ctx context.Context, asynqTask *asynq.Task) error {
 		var task queue.Task
 		if err := json.Unmarshal(asynqTask.Payload(), &task); err != nil {
-			return fmt.Errorf("failed to unmarshal task: %w", err)
+			return fmt.Errorf("failed to unmarshal task: %v: %w", err, asynq.SkipRetry)
+		}
+
+		// A payload from a newer release is retried, leaving it to an
+		// upgraded worker; a malformed one fails the same way on every attempt
+		if err := queue.PrepareTask(&task); err != nil {
+			if queue.IsRetryable(err) {
+				return err
+			}
+			return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+		}
+		if err := queue.ValidateTask(&task); err != nil {
+			return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
 		}
 
+		task.Retried, _ = asynq.GetRetryCount(ctx)
+		task.MaxRetry, _ = asynq.GetMaxRetry(ctx)
 		startTime := time.Now()
 
 		result, err := handler(ctx, &task)
 		if err != nil {
+			if !queue.IsRetryable(err) {
+				return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+			}
 			return err
 		}
 
 		if result != nil && !result.Success {
+			if result.Terminal {
+				return fmt.Errorf("task failed: %s: %w", result.Error, asynq.SkipRetry)
+			}
 			return fmt.Errorf("task failed: %s", result.Error)
 		}
 
@@ -163,11 +273,13 @@ func (q *AsynqQueue) RegisterHandler(taskType queue.TaskType, handler queue.Task
 
 // Start starts processing tasks
 func (q *AsynqQueue) Start(ctx context.Context) error {
-	go func() {
-		if err := q.server.Run(q.mux); err != nil {
-			fmt.Printf("Asynq server error: %v\n", err)
-		}
-	}()
+	for _, server := range q.servers {
+		go func(server *asynq.Server) {
+			if err := server.Run(q.mux); err != nil {
+				fmt.Printf("Asynq server error: %v\n", err)
+			}
+		}(server)
+	}
 
 	// Wait for context cancellation
 	<-ctx.Done()
@@ -177,7 +289,9 @@ func (q *AsynqQueue) Start(ctx context.Context) error {
 
 // Stop gracefully stops the queue
 func (q *AsynqQueue) Stop(ctx context.Context) error {
-	q.server.Shutdown()
+	for _, server := range q.servers {
+		server.Shutdown()
+	}
 	if err := q.client.Close(); err != nil {
 		return fmt.Errorf("failed to close client: %w", err)
 	}
@@ -186,11 +300,7 @@ func (q *AsynqQueue) Stop(ctx context.Context) error {
 
 // Stats returns queue statistics
 func (q *AsynqQueue) Stats(ctx context.Context) (*queue.QueueStats, error) {
-	inspector := asynq.NewInspector(asynq.RedisClientOpt{
-		Addr:     q.config.RedisAddr,
-		Password: q.config.RedisPassword,
-		DB:       q.config.RedisDB,
-	})
+	inspector := q.newInspector()
 	defer inspector.Close()
 
 	stats := &queue.QueueStats{
@@ -200,6 +310,9 @@ func (q *AsynqQueue) Stats(ctx context.Context) (*queue.QueueStats, error) {
 	// Get stats for all queues
 	for queueName := range q.config.Queues {
 		info, err := inspector.GetQueueInfo(queueName)
+		if errors.Is(err, asynq.ErrQueueNotFound) {
+			continue // Nothing has been enqueued on it yet
+		}
 		if err != nil {
 			return nil, fmt.Errorf("failed to get queue info: %w", err)
 		}
@@ -213,6 +326,87 @@ func (q *AsynqQueue) Stats(ctx context.Context) (*queue.QueueStats, error) {
 	return stats, nil
 }
 
+// Inspect returns the state of every queue and of the servers consuming them
+func (q *AsynqQueue) Inspect(ctx context.Context) (*queue.Overview, error) {
+	inspector := q.newInspector()
+	defer inspector.Close()
+
+	// Configured queues are listed even before they first receive a task
+	names, err := inspector.Queues()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queues: %w", err)
+	}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+	for name := range q.config.Queues {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	overview := &queue.Overview{
+		Queues:    make([]*queue.QueueInfo, 0, len(names)),
+		Consumers: []*queue.ConsumerInfo{},
+	}
+
+	for _, name := range names {
+		if !seen[name] {
+			overview.Queues = append(overview.Queues, &queue.QueueInfo{Name: name})
+			continue
+		}
+
+		info, err := inspector.GetQueueInfo(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get info for queue %s: %w", name, err)
+		}
+		overview.Queues = append(overview.Queues, &queue.QueueInfo{
+			Name:                 name,
+			Pending:              info.Pending,
+			Active:               info.Active,
+			Scheduled:            info.Scheduled,
+			Retry:                info.Retry,
+			Archived:             info.Archived,
+			Completed:            info.Completed,
+			Paused:               info.Paused,
+			OldestTaskAgeSeconds: info.Latency.Seconds(),
+			ProcessedToday:       info.Processed,
+			FailedToday:          info.Failed,
+		})
+	}
+
+	servers, err := inspector.Servers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queue servers: %w", err)
+	}
+	for _, server := range servers {
+		overview.Consumers = append(overview.Consumers, &queue.ConsumerInfo{
+			ID:            server.ID,
+			Host:          server.Host,
+			PID:           server.PID,
+			Concurrency:   server.Concurrency,
+			ActiveWorkers: len(server.ActiveWorkers),
+			Queues:        server.Queues,
+			Status:        server.Status,
+			StartedAt:     server.Started,
+		})
+		overview.TotalConcurrency += server.Concurrency
+		overview.ActiveWorkers += len(server.ActiveWorkers)
+	}
+
+	return overview, nil
+}
+
+func (q *AsynqQueue) newInspector() *asynq.Inspector {
+	return asynq.NewInspector(asynq.RedisClientOpt{
+		Addr:     q.config.RedisAddr,
+		Password: q.config.RedisPassword,
+		DB:       q.config.RedisDB,
+	})
+}
+
 // getQueueForPriority maps priority to queue name
 func (q *AsynqQueue) getQueueForPriority(priority int) string {
 	switch {
@@ -235,3 +429,6 @@ func CreateTask(taskType queue.TaskType, payload map[string]interface{}) *queue.
 		Payload: payload,
 	}
 }
+
+// Ensure AsynqQueue implements queue.Inspector
+var _ queue.Inspector = (*AsynqQueue)(nil)
@@ -0,0 +1,101 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// historyQueue records every task it enqueues in the tasks table, linked to
+// the VM, workspace and prompt its payload names, so each has a history of
+// the tasks that acted on it. Workers record how the tasks end.
+type historyQueue struct {
+	Queue
+	tasks storage.TaskRepository
+}
+
+// inspectingHistoryQueue is a historyQueue over a queue that implements
+// Inspector
+type inspectingHistoryQueue struct {
+	*historyQueue
+	Inspector
+}
+
+// WithHistory returns q recording the tasks it enqueues in tasks. Failing to
+// record a task doesn't stop it being enqueued.
+func WithHistory(q Queue, tasks storage.TaskRepository) Queue {
+	h := &historyQueue{Queue: q, tasks: tasks}
+	if inspector, ok := q.(Inspector); ok {
+		return &inspectingHistoryQueue{historyQueue: h, Inspector: inspector}
+	}
+	return h
+}
+
+// Enqueue records the task as pending, then enqueues it. The record is
+// removed if the task couldn't be enqueued, e.g. as a duplicate.
+func (h *historyQueue) Enqueue(ctx context.Context, task *Task, opts *TaskOptions) error {
+	record := historyRecord(task, opts)
+	recorded := true
+	if err := h.tasks.Create(ctx, record); err != nil {
+		log.Printf("Warning: Failed to record task %s (%s) in task history: %v", task.ID, task.Type, err)
+		recorded = false
+	}
+
+	err := h.Queue.Enqueue(ctx, task, opts)
+	if err != nil && recorded {
+		if delErr := h.tasks.Delete(context.Background(), task.ID); delErr != nil {
+			log.Printf("Warning: Failed to remove task %s from task history: %v", task.ID, delErr)
+		}
+	}
+	return err
+}
+
+// historyRecord builds the tasks row for a task about to be enqueued
+func historyRecord(task *Task, opts *TaskOptions) *storage.Task {
+	// Configured policy overrides live with the queue; the built-in policy
+	// is close enough for the history
+	maxRetry := Policies(nil).For(task.Type).MaxRetry
+	scheduledAt := time.Now()
+	priority := task.Priority
+	if opts != nil {
+		if opts.MaxRetry > 0 {
+			maxRetry = opts.MaxRetry
+		}
+		if opts.ProcessAt.After(scheduledAt) {
+			scheduledAt = opts.ProcessAt
+		}
+		if opts.Priority > 0 {
+			priority = opts.Priority
+		}
+	}
+
+	return &storage.Task{
+		ID:          task.ID,
+		Type:        string(task.Type),
+		Status:      storage.TaskStatusPending,
+		Priority:    priority,
+		Payload:     storage.JSONB(task.Payload),
+		VMID:        payloadUUID(task.Payload, "vm_id"),
+		WorkspaceID: payloadUUID(task.Payload, "workspace_id"),
+		PromptID:    payloadUUID(task.Payload, "prompt_id"),
+		MaxRetries:  maxRetry,
+		ScheduledAt: scheduledAt,
+		Metadata:    storage.JSONB{},
+	}
+}
+
+// payloadUUID returns the UUID in a payload field, or nil if it has none
+func payloadUUID(payload map[string]interface{}, key string) *uuid.UUID {
+	s, ok := payload[key].(string)
+	if !ok {
+		return nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
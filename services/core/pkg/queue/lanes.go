@@ -0,0 +1,93 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// WorkloadClass separates work someone is waiting on from background work.
+// With lanes enabled, each class is enqueued on queues of its own, and
+// workers can reserve concurrency for a class so that interactive
+// workspace sessions never wait behind a flood of batch prompts.
+type WorkloadClass string
+
+const (
+	WorkloadInteractive WorkloadClass = "interactive"
+	WorkloadBatch       WorkloadClass = "batch"
+)
+
+// WorkloadClasses lists the workload classes
+var WorkloadClasses = []WorkloadClass{WorkloadInteractive, WorkloadBatch}
+
+// ErrInvalidWorkloadClass is returned for unknown workload class names
+var ErrInvalidWorkloadClass = errors.New("invalid workload class")
+
+// ParseWorkloadClass converts a class name to a WorkloadClass. The empty
+// name is returned as is, leaving the class to DefaultWorkloadClass.
+func ParseWorkloadClass(s string) (WorkloadClass, error) {
+	class := WorkloadClass(strings.ToLower(strings.TrimSpace(s)))
+	if class == "" {
+		return "", nil
+	}
+	for _, known := range WorkloadClasses {
+		if class == known {
+			return class, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q (use interactive or batch)", ErrInvalidWorkloadClass, s)
+}
+
+// DefaultWorkloadClass returns the class of tasks enqueued without one.
+// Prompts, jobs, integrations and workspace snapshots and relocations are
+// batch work; creating, deleting and running commands in VMs and
+// workspaces is interactive.
+func DefaultWorkloadClass(taskType TaskType) WorkloadClass {
+	switch taskType {
+	case TaskTypePromptExecute, TaskTypeJobExecute, TaskTypeIntegration,
+		TaskTypeWorkspaceSnapshot, TaskTypeWorkspaceRelocate:
+		return WorkloadBatch
+	default:
+		return WorkloadInteractive
+	}
+}
+
+// LaneQueue returns the queue a task of the class is enqueued on in place
+// of name. Batch tasks keep the name, so the queues that existed before
+// lanes are the batch lane.
+func LaneQueue(class WorkloadClass, name string) string {
+	if class == WorkloadInteractive {
+		return string(WorkloadInteractive) + ":" + name
+	}
+	return name
+}
+
+// Lanes is the concurrency each workload class has reserved on a worker.
+// Reserved slots only take tasks of their class; the rest of the worker's
+// concurrency is shared, with interactive tasks weighted ahead of batch.
+type Lanes map[WorkloadClass]int
+
+// Reserved returns the slots reserved across all classes
+func (l Lanes) Reserved() int {
+	total := 0
+	for _, slots := range l {
+		total += slots
+	}
+	return total
+}
+
+// NewLanes converts reserved slots keyed by class name to Lanes
+func NewLanes(slots map[string]int) (Lanes, error) {
+	lanes := make(Lanes, len(slots))
+	for name, n := range slots {
+		class, err := ParseWorkloadClass(name)
+		if err != nil {
+			return nil, err
+		}
+		if class == "" || n < 0 {
+			return nil, fmt.Errorf("invalid lane %q: %d slots", name, n)
+		}
+		lanes[class] = n
+	}
+	return lanes, nil
+}
@@ -0,0 +1,292 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/google/uuid"
+)
+
+// LocalQueue is an in-process implementation of queue.Queue. Tasks are
+// handled by goroutines in the same process that enqueued them, so it suits
+// tests and single-binary demos where Redis isn't available.
+type LocalQueue struct {
+	tasks       chan *queue.Task
+	handlers    map[queue.TaskType]queue.TaskHandler
+	concurrency int
+
+	pending   int
+	active    int
+	completed int
+	failed    int
+	byType    map[string]int
+
+	// Unique task IDs of queued and running tasks, by task ID
+	uniqueIDs map[uuid.UUID]string
+	held      map[string]bool
+
+	started bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+}
+
+// NewLocalQueue creates an in-process task queue with the given buffer
+// size and number of worker goroutines
+func NewLocalQueue(bufferSize int, concurrency int) *LocalQueue {
+	if bufferSize <= 0 {
+		bufferSize = 100
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	return &LocalQueue{
+		tasks:       make(chan *queue.Task, bufferSize),
+		handlers:    make(map[queue.TaskType]queue.TaskHandler),
+		concurrency: concurrency,
+		byType:      make(map[string]int),
+		uniqueIDs:   make(map[uuid.UUID]string),
+		held:        make(map[string]bool),
+		done:        make(chan struct{}),
+	}
+}
+
+// Enqueue adds a task to the queue. Tasks with a ProcessAt in the future
+// are held until they are due.
+func (q *LocalQueue) Enqueue(ctx context.Context, task *queue.Task, opts *queue.TaskOptions) error {
+	if task == nil {
+		return fmt.Errorf("task cannot be nil")
+	}
+	if err := queue.ValidateTask(task); err != nil {
+		return err
+	}
+	if task.ID == uuid.Nil {
+		task.ID = uuid.New()
+	}
+
+	q.mu.Lock()
+	if opts != nil && opts.UniqueKey != "" {
+		uniqueID := queue.UniqueTaskID(task.Type, opts.UniqueKey)
+		if q.held[uniqueID] {
+			q.mu.Unlock()
+			return fmt.Errorf("%w: %s", queue.ErrDuplicateTask, uniqueID)
+		}
+		q.held[uniqueID] = true
+		q.uniqueIDs[task.ID] = uniqueID
+	}
+	q.pending++
+	q.byType[string(task.Type)]++
+	q.mu.Unlock()
+
+	if opts != nil && time.Until(opts.ProcessAt) > 0 {
+		time.AfterFunc(time.Until(opts.ProcessAt), func() {
+			q.push(context.Background(), task)
+		})
+		return nil
+	}
+
+	return q.push(ctx, task)
+}
+
+func (q *LocalQueue) push(ctx context.Context, task *queue.Task) error {
+	task.EnqueuedAt = time.Now()
+
+	select {
+	case q.tasks <- task:
+		return nil
+	case <-ctx.Done():
+		q.dropPending(task)
+		return ctx.Err()
+	case <-q.done:
+		q.dropPending(task)
+		return fmt.Errorf("queue is stopped")
+	}
+}
+
+func (q *LocalQueue) dropPending(task *queue.Task) {
+	q.mu.Lock()
+	q.pending--
+	q.byType[string(task.Type)]--
+	q.releaseUniqueID(task)
+	q.mu.Unlock()
+}
+
+// releaseUniqueID lets the task's unique key be enqueued again. Callers hold q.mu.
+func (q *LocalQueue) releaseUniqueID(task *queue.Task) {
+	if uniqueID, ok := q.uniqueIDs[task.ID]; ok {
+		delete(q.held, uniqueID)
+		delete(q.uniqueIDs, task.ID)
+	}
+}
+
+// RegisterHandler registers a handler for a task type
+func (q *LocalQueue) RegisterHandler(taskType queue.TaskType, handler queue.TaskHandler) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, exists := q.handlers[taskType]; exists {
+		return fmt.Errorf("handler for task type '%s' already registered", taskType)
+	}
+
+	q.handlers[taskType] = handler
+	return nil
+}
+
+// Start starts the worker goroutines
+func (q *LocalQueue) Start(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.started {
+		return fmt.Errorf("queue already started")
+	}
+	q.started = true
+
+	for i := 0; i < q.concurrency; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+
+	return nil
+}
+
+func (q *LocalQueue) work() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case task := <-q.tasks:
+			q.process(task)
+		case <-q.done:
+			return
+		}
+	}
+}
+
+func (q *LocalQueue) process(task *queue.Task) {
+	q.mu.Lock()
+	handler, exists := q.handlers[task.Type]
+	q.pending--
+	q.byType[string(task.Type)]--
+	q.active++
+	q.mu.Unlock()
+
+	var err error
+	if !exists {
+		err = fmt.Errorf("no handler registered for task type: %s", task.Type)
+	} else {
+		var result *queue.TaskResult
+		result, err = handler(context.Background(), task)
+		if err == nil && result != nil && !result.Success {
+			err = fmt.Errorf("%s", result.Error)
+		}
+	}
+
+	q.mu.Lock()
+	q.active--
+	q.releaseUniqueID(task)
+	if err != nil {
+		q.failed++
+	} else {
+		q.completed++
+	}
+	q.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Task %s (%s) failed: %v", task.ID, task.Type, err)
+	}
+}
+
+// Stop stops the worker goroutines, waiting for in-flight tasks to finish.
+// Tasks still waiting in the queue are dropped.
+func (q *LocalQueue) Stop(ctx context.Context) error {
+	q.mu.Lock()
+	select {
+	case <-q.done:
+		q.mu.Unlock()
+		return nil
+	default:
+		close(q.done)
+	}
+	q.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns queue statistics
+func (q *LocalQueue) Stats(ctx context.Context) (*queue.QueueStats, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	byType := make(map[string]int, len(q.byType))
+	for taskType, count := range q.byType {
+		if count > 0 {
+			byType[taskType] = count
+		}
+	}
+
+	return &queue.QueueStats{
+		Pending:   q.pending,
+		Active:    q.active,
+		Completed: q.completed,
+		Failed:    q.failed,
+		ByType:    byType,
+	}, nil
+}
+
+// Inspect reports the local queue as a single queue named "local", consumed
+// by this process. Processed and failed counts cover the queue's lifetime.
+func (q *LocalQueue) Inspect(ctx context.Context) (*queue.Overview, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	hostname, _ := os.Hostname()
+	overview := &queue.Overview{
+		Queues: []*queue.QueueInfo{{
+			Name:           "local",
+			Pending:        q.pending,
+			Active:         q.active,
+			ProcessedToday: q.completed + q.failed,
+			FailedToday:    q.failed,
+		}},
+		Consumers: []*queue.ConsumerInfo{},
+	}
+	if q.started {
+		overview.Consumers = append(overview.Consumers, &queue.ConsumerInfo{
+			ID:            "local",
+			Host:          hostname,
+			PID:           os.Getpid(),
+			Concurrency:   q.concurrency,
+			ActiveWorkers: q.active,
+			Queues:        map[string]int{"local": 1},
+			Status:        "active",
+		})
+		overview.TotalConcurrency = q.concurrency
+		overview.ActiveWorkers = q.active
+	}
+
+	return overview, nil
+}
+
+// Ensure LocalQueue implements queue.Queue and queue.Inspector
+var (
+	_ queue.Queue     = (*LocalQueue)(nil)
+	_ queue.Inspector = (*LocalQueue)(nil)
+)
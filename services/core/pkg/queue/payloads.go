@@ -0,0 +1,317 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/google/uuid"
+)
+
+// Payload is a typed task payload. Validate reports missing or malformed fields.
+type Payload interface {
+	Validate() error
+}
+
+// PayloadError reports a task whose payload doesn't match its task type.
+// Retrying such a task can't succeed, so queues fail it immediately.
+type PayloadError struct {
+	TaskType TaskType
+	Err      error
+}
+
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("invalid %s payload: %v", e.TaskType, e.Err)
+}
+
+func (e *PayloadError) Unwrap() error {
+	return e.Err
+}
+
+// IsPayloadError reports whether err was caused by an invalid task payload
+func IsPayloadError(err error) bool {
+	var payloadErr *PayloadError
+	return errors.As(err, &payloadErr)
+}
+
+// payloadTypes maps task types to their payload struct
+var payloadTypes = map[TaskType]func() Payload{
+	TaskTypeVMCreate:          func() Payload { return &VMCreatePayload{} },
+	TaskTypeVMExecute:         func() Payload { return &VMExecutePayload{} },
+	TaskTypeContainerRun:      func() Payload { return &ContainerRunPayload{} },
+	TaskTypeVMDelete:          func() Payload { return &VMDeletePayload{} },
+	TaskTypeVMSnapshot:        func() Payload { return &VMSnapshotPayload{} },
+	TaskTypeVMRestore:         func() Payload { return &VMSnapshotPayload{} },
+	TaskTypeWorkspaceCreate:   func() Payload { return &WorkspaceCreatePayload{} },
+	TaskTypeWorkspaceDelete:   func() Payload { return &WorkspaceDeletePayload{} },
+	TaskTypeWorkspaceSnapshot: func() Payload { return &WorkspaceSnapshotPayload{} },
+	TaskTypeWorkspaceRelocate: func() Payload { return &WorkspaceRelocatePayload{} },
+	TaskTypePromptExecute:     func() Payload { return &PromptExecutePayload{} },
+}
+
+// NewTask validates payload and returns a task carrying it
+func NewTask(taskType TaskType, payload Payload) (*Task, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, &PayloadError{TaskType: taskType, Err: err}
+	}
+
+	data, err := MarshalPayload(payload)
+	if err != nil {
+		return nil, &PayloadError{TaskType: taskType, Err: err}
+	}
+
+	return &Task{
+		ID:      uuid.New(),
+		Type:    taskType,
+		Payload: data,
+		Version: PayloadVersion,
+	}, nil
+}
+
+// DecodePayload decodes a task's payload into v and validates it
+func DecodePayload(task *Task, v Payload) error {
+	if err := UnmarshalPayload(task.Payload, v); err != nil {
+		return &PayloadError{TaskType: task.Type, Err: err}
+	}
+	if err := v.Validate(); err != nil {
+		return &PayloadError{TaskType: task.Type, Err: err}
+	}
+	return nil
+}
+
+// ValidateTask checks that this release reads a task's payload version
+// (see CheckPayloadVersion), then checks the payload against the payload
+// struct for its type. Task types without a payload struct, and payloads
+// converted to an older version for older workers, aren't checked.
+func ValidateTask(task *Task) error {
+	if err := CheckPayloadVersion(task); err != nil {
+		return err
+	}
+	if taskVersion(task) != PayloadVersion {
+		return nil
+	}
+	newPayload, ok := payloadTypes[task.Type]
+	if !ok {
+		return nil
+	}
+	return DecodePayload(task, newPayload())
+}
+
+// VMCreatePayload is the payload of vm:create tasks
+type VMCreatePayload struct {
+	Name            string            `json:"name"`
+	VCPUs           int               `json:"vcpus"`
+	MemoryMB        int               `json:"memory_mb"`
+	AdditionalTools []string          `json:"additional_tools,omitempty"`
+	ToolVersions    map[string]string `json:"tool_versions,omitempty"`
+
+	// Sandbox profile applied at boot (optional)
+	Sandbox *storage.SandboxProfile `json:"sandbox,omitempty"`
+
+	// Project used to pick the VM's garbage collection policy (optional)
+	Project string `json:"project,omitempty"`
+}
+
+// Validate checks the payload's required fields
+func (p *VMCreatePayload) Validate() error {
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	if p.VCPUs <= 0 {
+		return fmt.Errorf("vcpus must be positive, got %d", p.VCPUs)
+	}
+	if p.MemoryMB <= 0 {
+		return fmt.Errorf("memory_mb must be positive, got %d", p.MemoryMB)
+	}
+	return nil
+}
+
+// VMExecutePayload is the payload of vm:execute tasks
+type VMExecutePayload struct {
+	VMID    string   `json:"vm_id"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+
+	// Result caching (optional)
+	Cache      bool   `json:"cache,omitempty"`
+	CacheImage string `json:"cache_image,omitempty"`
+	InputsHash string `json:"inputs_hash,omitempty"`
+}
+
+// Validate checks the payload's required fields
+func (p *VMExecutePayload) Validate() error {
+	if p.VMID == "" {
+		return errors.New("vm_id is required")
+	}
+	if p.Command == "" {
+		return errors.New("command is required")
+	}
+	return nil
+}
+
+// ContainerRunPayload is the payload of container:run tasks: a command run
+// in a throwaway container of an image, without a VM
+type ContainerRunPayload struct {
+	Image   string   `json:"image"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+
+	// Sandbox profile applied to the container (optional)
+	Sandbox *storage.SandboxProfile `json:"sandbox,omitempty"`
+}
+
+// Validate checks the payload's required fields
+func (p *ContainerRunPayload) Validate() error {
+	if err := vmm.ValidateImage(p.Image); err != nil {
+		return err
+	}
+	if p.Command == "" {
+		return errors.New("command is required")
+	}
+	return nil
+}
+
+// VMDeletePayload is the payload of vm:delete tasks
+type VMDeletePayload struct {
+	VMID string `json:"vm_id"`
+}
+
+// Validate checks the payload's required fields
+func (p *VMDeletePayload) Validate() error {
+	if p.VMID == "" {
+		return errors.New("vm_id is required")
+	}
+	return nil
+}
+
+// VMSnapshotPayload is the payload of vm:snapshot and vm:restore tasks:
+// the VM and the snapshot to take or to restore it to
+type VMSnapshotPayload struct {
+	VMID       string `json:"vm_id"`
+	SnapshotID string `json:"snapshot_id"`
+}
+
+// Validate checks the payload's required fields
+func (p *VMSnapshotPayload) Validate() error {
+	if err := requireUUID("vm_id", p.VMID); err != nil {
+		return err
+	}
+	return requireUUID("snapshot_id", p.SnapshotID)
+}
+
+// WorkspaceCreatePayload is the payload of workspace:create tasks
+type WorkspaceCreatePayload struct {
+	WorkspaceID       string                 `json:"workspace_id"`
+	Name              string                 `json:"name"`
+	VCPUs             int                    `json:"vcpus"`
+	MemoryMB          int                    `json:"memory_mb"`
+	AIAssistant       string                 `json:"ai_assistant"`
+	AIAssistantConfig map[string]interface{} `json:"ai_assistant_config,omitempty"`
+	WorkingDir        string                 `json:"working_dir"`
+	AdditionalTools   []string               `json:"additional_tools,omitempty"`
+	ToolVersions      map[string]string      `json:"tool_versions,omitempty"`
+	CloneFrom         string                 `json:"clone_from,omitempty"` // Workspace whose working tree is copied
+}
+
+// Validate checks the payload's required fields
+func (p *WorkspaceCreatePayload) Validate() error {
+	if err := requireUUID("workspace_id", p.WorkspaceID); err != nil {
+		return err
+	}
+	if p.CloneFrom != "" {
+		if err := requireUUID("clone_from", p.CloneFrom); err != nil {
+			return err
+		}
+	}
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	if p.VCPUs <= 0 {
+		return fmt.Errorf("vcpus must be positive, got %d", p.VCPUs)
+	}
+	if p.MemoryMB <= 0 {
+		return fmt.Errorf("memory_mb must be positive, got %d", p.MemoryMB)
+	}
+	return nil
+}
+
+// WorkspaceDeletePayload is the payload of workspace:delete tasks
+type WorkspaceDeletePayload struct {
+	WorkspaceID string     `json:"workspace_id"`
+	VMID        *uuid.UUID `json:"vm_id,omitempty"`
+}
+
+// Validate checks the payload's required fields
+func (p *WorkspaceDeletePayload) Validate() error {
+	return requireUUID("workspace_id", p.WorkspaceID)
+}
+
+// WorkspaceSnapshotPayload is the payload of workspace:snapshot tasks
+type WorkspaceSnapshotPayload struct {
+	WorkspaceID   string `json:"workspace_id"`
+	VMID          string `json:"vm_id"`
+	EnvironmentID string `json:"environment_id"`
+}
+
+// Validate checks the payload's required fields
+func (p *WorkspaceSnapshotPayload) Validate() error {
+	if err := requireUUID("workspace_id", p.WorkspaceID); err != nil {
+		return err
+	}
+	if err := requireUUID("vm_id", p.VMID); err != nil {
+		return err
+	}
+	return requireUUID("environment_id", p.EnvironmentID)
+}
+
+// WorkspaceRelocatePayload is the payload of workspace:relocate tasks. The
+// task runs on the worker hosting VMID, which discards the VM and recreates
+// the workspace on TargetWorkerID.
+type WorkspaceRelocatePayload struct {
+	WorkspaceID    string `json:"workspace_id"`
+	VMID           string `json:"vm_id"`
+	TargetWorkerID string `json:"target_worker_id"`
+}
+
+// Validate checks the payload's required fields
+func (p *WorkspaceRelocatePayload) Validate() error {
+	if err := requireUUID("workspace_id", p.WorkspaceID); err != nil {
+		return err
+	}
+	if err := requireUUID("vm_id", p.VMID); err != nil {
+		return err
+	}
+	if p.TargetWorkerID == "" {
+		return errors.New("target_worker_id is required")
+	}
+	return nil
+}
+
+// PromptExecutePayload is the payload of prompt:execute tasks
+type PromptExecutePayload struct {
+	PromptID    string `json:"prompt_id"`
+	WorkspaceID string `json:"workspace_id"`
+
+	// Attempt of the prompt the task runs; 0 for the first. Tasks of
+	// earlier attempts are dropped.
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// Validate checks the payload's required fields
+func (p *PromptExecutePayload) Validate() error {
+	if err := requireUUID("prompt_id", p.PromptID); err != nil {
+		return err
+	}
+	return requireUUID("workspace_id", p.WorkspaceID)
+}
+
+func requireUUID(field, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s is required", field)
+	}
+	if _, err := uuid.Parse(value); err != nil {
+		return fmt.Errorf("%s is not a valid UUID: %q", field, value)
+	}
+	return nil
+}
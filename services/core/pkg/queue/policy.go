@@ -0,0 +1,83 @@
+package queue
+
+import "time"
+
+// Backoff strategies between retries
+const (
+	BackoffExponential = "exponential"
+	BackoffConstant    = "constant"
+)
+
+// Policy is how a task type is retried and how long each attempt may run.
+// Queues apply it to every task of the type unless TaskOptions override it.
+type Policy struct {
+	MaxRetry    int           // Retries after the first attempt (0 = none)
+	Timeout     time.Duration // Per attempt
+	Backoff     string        // BackoffExponential or BackoffConstant
+	BackoffBase time.Duration // Delay before the first retry
+	BackoffMax  time.Duration // Cap on the delay between retries
+}
+
+// DefaultPolicy applies to task types without a policy of their own
+var DefaultPolicy = Policy{
+	MaxRetry:    3,
+	Timeout:     10 * time.Minute,
+	Backoff:     BackoffExponential,
+	BackoffBase: 10 * time.Second,
+	BackoffMax:  5 * time.Minute,
+}
+
+// DefaultPolicies are the built-in policies per task type. Prompts aren't
+// retried: a prompt that fails part way may already have changed the
+// workspace, and the user decides whether to run it again. Prompts that
+// fail for an infrastructure reason are instead requeued by the workspace
+// service as a new attempt, in a fresh VM on another worker.
+var DefaultPolicies = map[TaskType]Policy{
+	TaskTypeVMCreate:          {MaxRetry: 3, Timeout: 25 * time.Minute, Backoff: BackoffExponential, BackoffBase: 15 * time.Second, BackoffMax: 5 * time.Minute},
+	TaskTypeVMExecute:         {MaxRetry: 2, Timeout: 10 * time.Minute, Backoff: BackoffExponential, BackoffBase: 5 * time.Second, BackoffMax: time.Minute},
+	TaskTypeContainerRun:      {MaxRetry: 2, Timeout: 10 * time.Minute, Backoff: BackoffExponential, BackoffBase: 5 * time.Second, BackoffMax: time.Minute},
+	TaskTypeVMDelete:          {MaxRetry: 2, Timeout: 2 * time.Minute, Backoff: BackoffConstant, BackoffBase: 30 * time.Second},
+	TaskTypeVMSnapshot:        {MaxRetry: 0, Timeout: 15 * time.Minute},
+	TaskTypeVMRestore:         {MaxRetry: 0, Timeout: 10 * time.Minute},
+	TaskTypeWorkspaceCreate:   {MaxRetry: 2, Timeout: 30 * time.Minute, Backoff: BackoffExponential, BackoffBase: 30 * time.Second, BackoffMax: 5 * time.Minute},
+	TaskTypeWorkspaceDelete:   {MaxRetry: 5, Timeout: 5 * time.Minute, Backoff: BackoffExponential, BackoffBase: 10 * time.Second, BackoffMax: 5 * time.Minute},
+	TaskTypeWorkspaceSnapshot: {MaxRetry: 1, Timeout: 15 * time.Minute, Backoff: BackoffConstant, BackoffBase: time.Minute},
+	TaskTypeWorkspaceRelocate: {MaxRetry: 1, Timeout: 5 * time.Minute, Backoff: BackoffConstant, BackoffBase: 30 * time.Second},
+	TaskTypePromptExecute:     {MaxRetry: 0, Timeout: 30 * time.Minute},
+}
+
+// Policies maps task types to their policy
+type Policies map[TaskType]Policy
+
+// For returns the policy of a task type
+func (p Policies) For(taskType TaskType) Policy {
+	if policy, ok := p[taskType]; ok {
+		return policy
+	}
+	if policy, ok := DefaultPolicies[taskType]; ok {
+		return policy
+	}
+	return DefaultPolicy
+}
+
+// RetryDelay returns how long to wait before the nth retry (1 = first)
+func (p Policy) RetryDelay(n int) time.Duration {
+	delay := p.BackoffBase
+	if delay <= 0 {
+		delay = DefaultPolicy.BackoffBase
+	}
+	if p.Backoff == BackoffConstant {
+		return delay
+	}
+
+	for i := 1; i < n; i++ {
+		delay *= 2
+		if p.BackoffMax > 0 && delay >= p.BackoffMax {
+			return p.BackoffMax
+		}
+	}
+	if p.BackoffMax > 0 && delay > p.BackoffMax {
+		return p.BackoffMax
+	}
+	return delay
+}
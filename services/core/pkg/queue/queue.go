@@ -3,6 +3,7 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,13 +19,20 @@ const (
 	TaskTypeVMStop      TaskType = "vm:stop"
 	TaskTypeVMDelete    TaskType = "vm:delete"
 	TaskTypeVMExecute   TaskType = "vm:execute"
+	TaskTypeVMSnapshot  TaskType = "vm:snapshot"
+	TaskTypeVMRestore   TaskType = "vm:restore"
 	TaskTypeJobExecute  TaskType = "job:execute"
 	TaskTypeIntegration TaskType = "integration:run"
 
+	// Container task types (workers with the docker capability)
+	TaskTypeContainerRun TaskType = "container:run"
+
 	// Workspace task types
-	TaskTypeWorkspaceCreate TaskType = "workspace:create"
-	TaskTypeWorkspaceDelete TaskType = "workspace:delete"
-	TaskTypePromptExecute   TaskType = "prompt:execute"
+	TaskTypeWorkspaceCreate   TaskType = "workspace:create"
+	TaskTypeWorkspaceDelete   TaskType = "workspace:delete"
+	TaskTypePromptExecute     TaskType = "prompt:execute"
+	TaskTypeWorkspaceSnapshot TaskType = "workspace:snapshot"
+	TaskTypeWorkspaceRelocate TaskType = "workspace:relocate"
 )
 
 // Task represents a distributed task
@@ -33,6 +41,17 @@ type Task struct {
 	Type     TaskType               `json:"type"`
 	Payload  map[string]interface{} `json:"payload"`
 	Priority int                    `json:"priority"`
+
+	// Version of the payload's format, see PayloadVersion (0 = 1)
+	Version int `json:"version,omitempty"`
+
+	// Set by the queue when the task becomes due; used to measure queue lag
+	EnqueuedAt time.Time `json:"enqueued_at,omitempty"`
+
+	// Set by the queue when handing the task to a handler: retries so far,
+	// and how many are allowed. Both are 0 for queues that don't retry.
+	Retried  int `json:"-"`
+	MaxRetry int `json:"-"`
 }
 
 // TaskResult represents the result of a task execution
@@ -43,6 +62,10 @@ type TaskResult struct {
 	Error     string                 `json:"error,omitempty"`
 	Duration  time.Duration          `json:"duration"`
 	StartedAt time.Time              `json:"started_at"`
+
+	// Terminal marks a failure that retrying can't fix, e.g. a command that
+	// exited non-zero. Queues fail such tasks without retrying them.
+	Terminal bool `json:"terminal,omitempty"`
 }
 
 // TaskHandler is a function that processes a task
@@ -51,10 +74,76 @@ type TaskHandler func(ctx context.Context, task *Task) (*TaskResult, error)
 // TaskOptions configures task enqueueing
 type TaskOptions struct {
 	ProcessAt   time.Time     // Schedule task for future processing
-	MaxRetry    int           // Max number of retries
-	Timeout     time.Duration // Task execution timeout
+	MaxRetry    int           // Max number of retries (0 = the task type's Policy)
+	Timeout     time.Duration // Task execution timeout (0 = the task type's Policy)
 	Queue       string        // Queue name (default: "default")
 	Priority    int           // Priority (higher = more important)
+
+	// Class is the task's workload class (default: DefaultWorkloadClass of
+	// the task type). Queues with lanes enqueue it on its class's lane.
+	Class WorkloadClass
+
+	// UniqueKey identifies the work the task does, e.g. a workspace ID.
+	// While a task of the same type and key is queued or running in the same
+	// queue, enqueueing another fails with ErrDuplicateTask.
+	UniqueKey string
+}
+
+// ErrDuplicateTask is returned by Enqueue when a task with the same type and
+// unique key is already queued or running
+var ErrDuplicateTask = errors.New("task already enqueued")
+
+// TerminalError wraps a handler error that retrying can't fix, such as the
+// resource a task acts on no longer existing
+type TerminalError struct {
+	Err error
+}
+
+func (e *TerminalError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TerminalError) Unwrap() error {
+	return e.Err
+}
+
+// Terminal marks err as a failure that retrying can't fix
+func Terminal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &TerminalError{Err: err}
+}
+
+// IsRetryable reports whether a task that failed with err may succeed when
+// retried. Terminal and payload errors can't; anything else is assumed to
+// be transient.
+func IsRetryable(err error) bool {
+	var terminal *TerminalError
+	return !errors.As(err, &terminal) && !IsPayloadError(err)
+}
+
+// WorkerQueue returns the name of the queue only the given worker consumes.
+// Tasks that must run on a particular worker, such as tearing down a VM it
+// hosts, are enqueued there with no priority so the queue name is kept.
+func WorkerQueue(workerID string) string {
+	return "worker:" + workerID
+}
+
+// ZoneQueue returns the name of the queue consumed by every worker in a zone
+func ZoneQueue(zone string) string {
+	return "zone:" + zone
+}
+
+// CapabilityQueue returns the name of the queue consumed by every worker
+// with a capability, e.g. "docker" for workers running the Docker backend
+func CapabilityQueue(capability string) string {
+	return "capability:" + capability
+}
+
+// UniqueTaskID returns the identifier queues use to enforce a unique key
+func UniqueTaskID(taskType TaskType, key string) string {
+	return string(taskType) + ":" + key
 }
 
 // Queue interface for distributed task processing
@@ -86,6 +175,52 @@ type QueueStats struct {
 	Throughput float64        `json:"throughput"` // tasks/second
 }
 
+// QueueInfo is the state of one named queue
+type QueueInfo struct {
+	Name      string `json:"name"`
+	Pending   int    `json:"pending"`
+	Active    int    `json:"active"`
+	Scheduled int    `json:"scheduled"`
+	Retry     int    `json:"retry"`
+	Archived  int    `json:"archived"`
+	Completed int    `json:"completed"`
+	Paused    bool   `json:"paused"`
+
+	// Seconds the oldest pending task has been waiting; 0 when none are pending
+	OldestTaskAgeSeconds float64 `json:"oldest_task_age_seconds"`
+
+	// Tasks processed and failed since midnight UTC
+	ProcessedToday int `json:"processed_today"`
+	FailedToday    int `json:"failed_today"`
+}
+
+// ConsumerInfo describes a process consuming tasks from the queues
+type ConsumerInfo struct {
+	ID            string         `json:"id"`
+	Host          string         `json:"host"`
+	PID           int            `json:"pid"`
+	Concurrency   int            `json:"concurrency"`
+	ActiveWorkers int            `json:"active_workers"`
+	Queues        map[string]int `json:"queues"` // Queue name -> priority
+	Status        string         `json:"status"`
+	StartedAt     time.Time      `json:"started_at"`
+}
+
+// Overview is a snapshot of every queue and the processes consuming them
+type Overview struct {
+	Queues    []*QueueInfo    `json:"queues"`
+	Consumers []*ConsumerInfo `json:"consumers"`
+
+	// Totals across consumers
+	TotalConcurrency int `json:"total_concurrency"`
+	ActiveWorkers    int `json:"active_workers"`
+}
+
+// Inspector is implemented by queues that can report per-queue state
+type Inspector interface {
+	Inspect(ctx context.Context) (*Overview, error)
+}
+
 // MarshalPayload marshals a payload to JSON
 func MarshalPayload(v interface{}) (map[string]interface{}, error) {
 	data, err := json.Marshal(v)
@@ -0,0 +1,190 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Task payload versions. Gateways (control plane) and workers (data plane)
+// are upgraded separately, so for a while both releases run side by side.
+// A worker reads payloads from MinPayloadVersion to PayloadVersion, and a
+// gateway writes each task at the highest version the workers that may run
+// it read, down to the oldest version it can convert payloads to.
+//
+// Bump PayloadVersion only for changes old workers would misread, such as
+// a renamed or reinterpreted field; adding an optional field doesn't need
+// it. With a bump, register the conversions between the new version and
+// the previous one in payloadConversions and keep MinPayloadVersion at the
+// previous version for a release.
+const (
+	PayloadVersion    = 1
+	MinPayloadVersion = 1
+)
+
+// Worker metadata keys advertising the payload versions a worker reads.
+// Workers from before payload versioning don't set them and read version 1.
+const (
+	MetadataPayloadVersionMin = "payload_version_min"
+	MetadataPayloadVersionMax = "payload_version_max"
+)
+
+// ErrPayloadVersionTooNew is returned for a task written by a newer release
+// than the worker's. It is retryable, so the task is left for an upgraded
+// worker.
+var ErrPayloadVersionTooNew = errors.New("task payload version is newer than this worker reads")
+
+// ErrNoCompatibleWorker is returned when no worker that may run a task reads
+// a payload version the gateway can write
+var ErrNoCompatibleWorker = errors.New("no worker reads a payload version this release writes")
+
+// payloadConversion converts payloads between a version and the one before it
+type payloadConversion struct {
+	Upgrade   func(task *Task) error // From the previous version
+	Downgrade func(task *Task) error // To the previous version
+}
+
+// payloadConversions are keyed by the newer of the two versions converted
+// between
+var payloadConversions = map[int]payloadConversion{}
+
+// PayloadVersionRange is the payload versions a worker reads
+type PayloadVersionRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// LocalPayloadVersions is the range this release reads
+func LocalPayloadVersions() PayloadVersionRange {
+	return PayloadVersionRange{Min: MinPayloadVersion, Max: PayloadVersion}
+}
+
+// Reads reports whether the range includes version
+func (r PayloadVersionRange) Reads(version int) bool {
+	return version >= r.Min && version <= r.Max
+}
+
+// Metadata returns the worker metadata advertising the range
+func (r PayloadVersionRange) Metadata() map[string]string {
+	return map[string]string{
+		MetadataPayloadVersionMin: strconv.Itoa(r.Min),
+		MetadataPayloadVersionMax: strconv.Itoa(r.Max),
+	}
+}
+
+// WorkerPayloadVersions reads the range a worker advertises in its metadata.
+// Without a valid maximum it reads just its minimum.
+func WorkerPayloadVersions(metadata map[string]interface{}) PayloadVersionRange {
+	r := PayloadVersionRange{Min: 1, Max: 1}
+	if v, err := strconv.Atoi(fmt.Sprint(metadata[MetadataPayloadVersionMin])); err == nil && v > 0 {
+		r.Min, r.Max = v, v
+	}
+	if v, err := strconv.Atoi(fmt.Sprint(metadata[MetadataPayloadVersionMax])); err == nil && v >= r.Min {
+		r.Max = v
+	}
+	return r
+}
+
+// taskVersion returns a task's payload version. Tasks without one were
+// written before payload versioning, at version 1.
+func taskVersion(task *Task) int {
+	if task.Version == 0 {
+		return 1
+	}
+	return task.Version
+}
+
+// CheckPayloadVersion checks that this release reads a task's payload. A
+// task from a newer release fails with ErrPayloadVersionTooNew; one older
+// than MinPayloadVersion with a PayloadError, as no worker of this release
+// can run it.
+func CheckPayloadVersion(task *Task) error {
+	version := taskVersion(task)
+	if version > PayloadVersion {
+		return fmt.Errorf("%w: version %d, reads up to %d", ErrPayloadVersionTooNew, version, PayloadVersion)
+	}
+	if version < MinPayloadVersion {
+		return &PayloadError{TaskType: task.Type, Err: fmt.Errorf("payload version %d is no longer supported (oldest %d)", version, MinPayloadVersion)}
+	}
+	return nil
+}
+
+// PrepareTask checks that this release reads a task's payload and converts
+// an older payload to PayloadVersion. Queues call it before handing a task
+// to its handler.
+func PrepareTask(task *Task) error {
+	if err := CheckPayloadVersion(task); err != nil {
+		return err
+	}
+	return upgradeTask(task, PayloadVersion)
+}
+
+// upgradeTask converts a task's payload to a newer version
+func upgradeTask(task *Task, target int) error {
+	for version := taskVersion(task) + 1; version <= target; version++ {
+		upgrade := payloadConversions[version].Upgrade
+		if upgrade == nil {
+			return &PayloadError{TaskType: task.Type, Err: fmt.Errorf("can't convert payload from version %d to %d", version-1, version)}
+		}
+		if err := upgrade(task); err != nil {
+			return &PayloadError{TaskType: task.Type, Err: err}
+		}
+		task.Version = version
+	}
+	return nil
+}
+
+// oldestWritableVersion is the lowest version payloads can be downgraded to
+func oldestWritableVersion() int {
+	version := PayloadVersion
+	for payloadConversions[version].Downgrade != nil {
+		version--
+	}
+	return version
+}
+
+// NegotiatePayloadVersion picks the version to write a task at for workers
+// reading the given ranges: the highest version this release writes that
+// all of them read, or failing that, that any of them reads, so the task
+// waits for those workers instead of failing. Without workers it is
+// PayloadVersion.
+func NegotiatePayloadVersion(workers []PayloadVersionRange) (int, error) {
+	if len(workers) == 0 {
+		return PayloadVersion, nil
+	}
+
+	oldest := oldestWritableVersion()
+	for version := PayloadVersion; version >= oldest; version-- {
+		all := true
+		for _, r := range workers {
+			all = all && r.Reads(version)
+		}
+		if all {
+			return version, nil
+		}
+	}
+	for version := PayloadVersion; version >= oldest; version-- {
+		for _, r := range workers {
+			if r.Reads(version) {
+				return version, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("%w (writes %d to %d)", ErrNoCompatibleWorker, oldest, PayloadVersion)
+}
+
+// DowngradeTask converts a task's payload to an older version
+func DowngradeTask(task *Task, version int) error {
+	for current := taskVersion(task); current > version; current-- {
+		downgrade := payloadConversions[current].Downgrade
+		if downgrade == nil {
+			return &PayloadError{TaskType: task.Type, Err: fmt.Errorf("can't convert payload from version %d to %d", current, current-1)}
+		}
+		if err := downgrade(task); err != nil {
+			return &PayloadError{TaskType: task.Type, Err: err}
+		}
+		task.Version = current - 1
+	}
+	return nil
+}
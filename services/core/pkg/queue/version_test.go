@@ -0,0 +1,197 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// withConversion registers a payload conversion for the length of a test
+func withConversion(t *testing.T, version int, conversion payloadConversion) {
+	t.Helper()
+	previous, existed := payloadConversions[version]
+	payloadConversions[version] = conversion
+	t.Cleanup(func() {
+		if existed {
+			payloadConversions[version] = previous
+		} else {
+			delete(payloadConversions, version)
+		}
+	})
+}
+
+// TestNegotiatePayloadVersion tests the version picked for mixed worker
+// ranges
+func TestNegotiatePayloadVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers []PayloadVersionRange
+		want    int
+		wantErr error
+	}{
+		{"no workers", nil, PayloadVersion, nil},
+		{"current workers", []PayloadVersionRange{LocalPayloadVersions(), LocalPayloadVersions()}, PayloadVersion, nil},
+		{"newer worker reads ours too", []PayloadVersionRange{
+			LocalPayloadVersions(),
+			{Min: PayloadVersion, Max: PayloadVersion + 1},
+		}, PayloadVersion, nil},
+		{"some workers read it", []PayloadVersionRange{
+			{Min: PayloadVersion + 1, Max: PayloadVersion + 2},
+			LocalPayloadVersions(),
+		}, PayloadVersion, nil},
+		{"only newer workers", []PayloadVersionRange{
+			{Min: PayloadVersion + 1, Max: PayloadVersion + 1},
+			{Min: PayloadVersion + 1, Max: PayloadVersion + 2},
+		}, 0, ErrNoCompatibleWorker},
+	}
+
+	for _, tt := range tests {
+		got, err := NegotiatePayloadVersion(tt.workers)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected version %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestWorkerPayloadVersions tests reading the range workers advertise,
+// including workers from before payload versioning
+func TestWorkerPayloadVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]interface{}
+		want     PayloadVersionRange
+	}{
+		{"nil metadata", nil, PayloadVersionRange{Min: 1, Max: 1}},
+		{"no version keys", map[string]interface{}{"zone": "a"}, PayloadVersionRange{Min: 1, Max: 1}},
+		{"strings", map[string]interface{}{
+			MetadataPayloadVersionMin: "1",
+			MetadataPayloadVersionMax: "3",
+		}, PayloadVersionRange{Min: 1, Max: 3}},
+		{"JSON numbers", map[string]interface{}{
+			MetadataPayloadVersionMin: float64(2),
+			MetadataPayloadVersionMax: float64(4),
+		}, PayloadVersionRange{Min: 2, Max: 4}},
+		{"minimum only", map[string]interface{}{MetadataPayloadVersionMin: "2"}, PayloadVersionRange{Min: 2, Max: 2}},
+		{"maximum below minimum", map[string]interface{}{
+			MetadataPayloadVersionMin: "3",
+			MetadataPayloadVersionMax: "2",
+		}, PayloadVersionRange{Min: 3, Max: 3}},
+		{"invalid values", map[string]interface{}{
+			MetadataPayloadVersionMin: "x",
+			MetadataPayloadVersionMax: "-1",
+		}, PayloadVersionRange{Min: 1, Max: 1}},
+	}
+
+	for _, tt := range tests {
+		if got := WorkerPayloadVersions(tt.metadata); got != tt.want {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestPrepareTask tests that payloads from newer releases are left for
+// upgraded workers while ones too old for any worker fail for good
+func TestPrepareTask(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     int
+		wantTooNew  bool
+		wantPayload bool
+	}{
+		{"unversioned", 0, false, false},
+		{"current", PayloadVersion, false, false},
+		{"too new", PayloadVersion + 1, true, false},
+		// Version 0 means 1, so below MinPayloadVersion (1) only a corrupt
+		// version is too old
+		{"too old", -1, false, true},
+	}
+
+	for _, tt := range tests {
+		task := &Task{Type: TaskTypeVMCreate, Version: tt.version}
+		err := PrepareTask(task)
+
+		var payloadErr *PayloadError
+		if errors.Is(err, ErrPayloadVersionTooNew) != tt.wantTooNew {
+			t.Errorf("%s: expected ErrPayloadVersionTooNew %v, got %v", tt.name, tt.wantTooNew, err)
+		}
+		if errors.As(err, &payloadErr) != tt.wantPayload {
+			t.Errorf("%s: expected PayloadError %v, got %v", tt.name, tt.wantPayload, err)
+		}
+		if err == nil && taskVersion(task) != PayloadVersion {
+			t.Errorf("%s: expected version %d after prepare, got %d", tt.name, PayloadVersion, taskVersion(task))
+		}
+	}
+}
+
+// TestConversionRoundTrip tests that a registered upgrade and downgrade
+// pair converts a payload down and back up unchanged
+func TestConversionRoundTrip(t *testing.T) {
+	// Version 3 renames the command field
+	version := PayloadVersion + 2
+	withConversion(t, version, payloadConversion{
+		Upgrade: func(task *Task) error {
+			cmd, ok := task.Payload["cmd"]
+			if !ok {
+				return fmt.Errorf("missing cmd")
+			}
+			delete(task.Payload, "cmd")
+			task.Payload["command"] = cmd
+			return nil
+		},
+		Downgrade: func(task *Task) error {
+			task.Payload["cmd"] = task.Payload["command"]
+			delete(task.Payload, "command")
+			return nil
+		},
+	})
+	withConversion(t, version-1, payloadConversion{
+		Upgrade:   func(task *Task) error { return nil },
+		Downgrade: func(task *Task) error { return nil },
+	})
+
+	task := &Task{
+		Type:    TaskTypeVMExecute,
+		Version: version,
+		Payload: map[string]interface{}{"command": "ls"},
+	}
+
+	if err := DowngradeTask(task, version-2); err != nil {
+		t.Fatalf("DowngradeTask: %v", err)
+	}
+	if task.Version != version-2 || task.Payload["cmd"] != "ls" || task.Payload["command"] != nil {
+		t.Fatalf("unexpected downgraded task: version %d, payload %v", task.Version, task.Payload)
+	}
+
+	if err := upgradeTask(task, version); err != nil {
+		t.Fatalf("upgradeTask: %v", err)
+	}
+	if task.Version != version || task.Payload["command"] != "ls" || task.Payload["cmd"] != nil {
+		t.Fatalf("unexpected upgraded task: version %d, payload %v", task.Version, task.Payload)
+	}
+
+	// A failed conversion can't be retried into success
+	task.Version = version - 1
+	delete(task.Payload, "command")
+	var payloadErr *PayloadError
+	if err := upgradeTask(task, version); !errors.As(err, &payloadErr) {
+		t.Errorf("expected PayloadError from a failed upgrade, got %v", err)
+	}
+}
+
+// TestDowngradeTaskWithoutConversion tests that a payload can't be written
+// at a version no conversion reaches
+func TestDowngradeTaskWithoutConversion(t *testing.T) {
+	task := &Task{Type: TaskTypeVMCreate, Version: PayloadVersion + 1}
+
+	var payloadErr *PayloadError
+	if err := DowngradeTask(task, PayloadVersion); !errors.As(err, &payloadErr) {
+		t.Errorf("expected PayloadError, got %v", err)
+	}
+	if task.Version != PayloadVersion+1 {
+		t.Errorf("expected version to stay %d, got %d", PayloadVersion+1, task.Version)
+	}
+}
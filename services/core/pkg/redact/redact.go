@@ -0,0 +1,130 @@
+// Package redact masks secrets in command and prompt output before it is
+// stored or returned: known secret values, and tokens in common formats
+// (API keys, bearer tokens, private keys, credentials in URLs).
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Mask replaces each secret found in output
+const Mask = "[REDACTED]"
+
+// MinSecretLength is the shortest secret value masked. Shorter values, such
+// as "true" or a port number, would mask ordinary output.
+const MinSecretLength = 6
+
+// maxPatterns and maxPatternLength bound the extra patterns of a policy
+const (
+	maxPatterns      = 20
+	maxPatternLength = 512
+)
+
+// replacement keeps the "keep" and "rest" groups of a match around the mask,
+// e.g. "Bearer " before a token; patterns without them mask the whole match
+const replacement = "${keep}" + Mask + "${rest}"
+
+// tokenPatterns match credentials in widely used formats
+var tokenPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`),                                        // AWS access key ID
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),                                     // GitHub token
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`),                                   // GitHub fine-grained token
+	regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`),                                         // GitLab token
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`),                                            // Anthropic and OpenAI API keys
+	regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`),                                    // Slack token
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),                                          // Google API key
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`), // JWT
+	regexp.MustCompile(`(?i)(?P<keep>\bbearer\s+)[A-Za-z0-9._~+/-]{20,}=*`),
+	regexp.MustCompile(`(?P<keep>[a-z][a-z0-9+.-]*://[^:/\s@]+:)[^@\s/]{3,}(?P<rest>@)`), // Password in a URL
+}
+
+// Policy selects what a Redactor masks. The zero Policy masks known secret
+// values and tokens in common formats.
+type Policy struct {
+	// Disabled masks nothing
+	Disabled bool `json:"disabled,omitempty"`
+
+	// SkipPatterns masks only known secret values, not tokens in common
+	// formats
+	SkipPatterns bool `json:"skip_patterns,omitempty"`
+
+	// Patterns are extra regular expressions to mask (see ValidatePatterns)
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// Redactor masks secrets in output. A nil Redactor masks nothing.
+type Redactor struct {
+	secrets  *strings.Replacer
+	patterns []*regexp.Regexp
+}
+
+// New returns a Redactor masking the given secret values and whatever
+// policy selects. Invalid extra patterns are skipped; check them with
+// ValidatePatterns when they are set.
+func New(secrets []string, policy Policy) *Redactor {
+	if policy.Disabled {
+		return nil
+	}
+
+	r := &Redactor{}
+	if !policy.SkipPatterns {
+		r.patterns = append(r.patterns, tokenPatterns...)
+	}
+	for _, pattern := range policy.Patterns {
+		if re, err := regexp.Compile(pattern); err == nil {
+			r.patterns = append(r.patterns, re)
+		}
+	}
+
+	// Longest first, so a secret containing another is masked whole
+	values := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		if len(secret) >= MinSecretLength {
+			values = append(values, secret)
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	if len(values) > 0 {
+		pairs := make([]string, 0, 2*len(values))
+		for _, value := range values {
+			pairs = append(pairs, value, Mask)
+		}
+		r.secrets = strings.NewReplacer(pairs...)
+	}
+	return r
+}
+
+// String returns s with its secrets masked
+func (r *Redactor) String(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	if r.secrets != nil {
+		s = r.secrets.Replace(s)
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, replacement)
+	}
+	return s
+}
+
+// ValidatePatterns checks that extra patterns compile and are few and short
+// enough to run over every command's output
+func ValidatePatterns(patterns []string) error {
+	if len(patterns) > maxPatterns {
+		return fmt.Errorf("at most %d patterns are allowed", maxPatterns)
+	}
+	for _, pattern := range patterns {
+		if pattern == "" || len(pattern) > maxPatternLength {
+			return fmt.Errorf("patterns must be 1 to %d characters long", maxPatternLength)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Built-in strategy names
+const (
+	StrategyBinpack      = "binpack"       // Fill the busiest workers first, leaving others free for large VMs
+	StrategySpread       = "spread"        // Put each VM on the least loaded worker
+	StrategyZoneAffinity = "zone-affinity" // Stay in the requested zone when it has room, spreading within it
+)
+
+// DefaultStrategy is used when no strategy is configured
+const DefaultStrategy = StrategySpread
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]func() Strategy)
+)
+
+func init() {
+	Register(StrategyBinpack, func() Strategy { return binpack{} })
+	Register(StrategySpread, func() Strategy { return spread{} })
+	Register(StrategyZoneAffinity, func() Strategy { return zoneAffinity{} })
+}
+
+// Register makes a strategy selectable by name. Custom strategies register
+// from an init function in a package compiled into the gateway, e.g. a file
+// added to this package or a package imported for its side effects. It
+// panics if the name is taken, like database/sql.Register.
+func Register(name string, factory func() Strategy) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" || factory == nil {
+		panic("scheduler: Register needs a name and a factory")
+	}
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("scheduler: strategy %s registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// Lookup returns a new instance of the named strategy
+func Lookup(name string) (Strategy, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown scheduling strategy %q (available: %s)", name, strings.Join(Strategies(), ", "))
+	}
+	return factory(), nil
+}
+
+// Strategies returns the names of the registered strategies, sorted
+func Strategies() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
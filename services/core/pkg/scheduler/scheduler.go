@@ -0,0 +1,222 @@
+// Package scheduler places VMs on workers. Placement runs in two phases,
+// as in Kubernetes: filters drop the workers that can't host the VM, then
+// the strategy scores the rest and the highest score wins.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/gateway/pkg/discovery"
+)
+
+// HeartbeatTimeout is how long since its last heartbeat a worker is still
+// considered for placement
+const HeartbeatTimeout = 1 * time.Minute
+
+// MetadataHostHealth is the worker metadata key holding the host health
+// its worker reports every heartbeat: "healthy" is false, with the
+// "problems" why, while the host is overheated, IO saturated or overloaded
+const MetadataHostHealth = "host_health"
+
+// MaxScore is the highest score a strategy gives a worker
+const MaxScore = 100.0
+
+// ErrNoWorkers is returned when no worker passes the filters
+var ErrNoWorkers = errors.New("no worker can host the VM")
+
+// Request describes the VM to place
+type Request struct {
+	VCPUs        int
+	MemoryMB     int
+	Capabilities []string // The worker must have all of them
+
+	// Zone is the zone the VM should run in, e.g. the zone of the
+	// workspace it belongs to. With ZoneRequired set, other zones are
+	// filtered out; otherwise it is a preference for strategies to weigh.
+	Zone         string
+	ZoneRequired bool
+
+	// ExcludeWorkers are workers the VM must not run on, e.g. the one a
+	// prompt just failed on
+	ExcludeWorkers []string
+}
+
+// Strategy decides where VMs go. Filter rejects a worker that passed the
+// built-in filters, with the reason; Score rates one that passed all
+// filters, from 0 to MaxScore.
+type Strategy interface {
+	Name() string
+	Filter(req *Request, worker *storage.Worker) error
+	Score(req *Request, worker *storage.Worker) float64
+}
+
+// Placement is the outcome of scheduling a VM
+type Placement struct {
+	Worker   *storage.Worker
+	Score    float64
+	Strategy string
+
+	// Rejected holds why each filtered out worker was rejected, by worker ID
+	Rejected map[string]string
+}
+
+// Scheduler picks a worker for a VM
+type Scheduler interface {
+	Schedule(ctx context.Context, req *Request, workers []*storage.Worker) (*Placement, error)
+}
+
+// strategyScheduler runs the built-in filters and one strategy
+type strategyScheduler struct {
+	strategy Strategy
+	now      func() time.Time
+}
+
+// New returns a scheduler placing VMs with the named strategy (see
+// Register). An empty name selects DefaultStrategy.
+func New(strategy string) (Scheduler, error) {
+	if strategy == "" {
+		strategy = DefaultStrategy
+	}
+	s, err := Lookup(strategy)
+	if err != nil {
+		return nil, err
+	}
+	return &strategyScheduler{strategy: s, now: time.Now}, nil
+}
+
+// Schedule filters the workers and returns the best scoring one. Ties go to
+// the worker with the fewest VMs, then the lowest ID, so placement is
+// deterministic.
+func (s *strategyScheduler) Schedule(ctx context.Context, req *Request, workers []*storage.Worker) (*Placement, error) {
+	placement := &Placement{
+		Strategy: s.strategy.Name(),
+		Rejected: make(map[string]string),
+	}
+
+	type candidate struct {
+		worker *storage.Worker
+		score  float64
+	}
+	var candidates []candidate
+	for _, worker := range workers {
+		if err := s.filter(req, worker); err != nil {
+			placement.Rejected[worker.ID] = err.Error()
+			continue
+		}
+		candidates = append(candidates, candidate{worker, s.strategy.Score(req, worker)})
+	}
+	if len(candidates) == 0 {
+		return placement, fmt.Errorf("%w (%s)", ErrNoWorkers, describeRejections(placement.Rejected))
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if a.worker.VMCount != b.worker.VMCount {
+			return a.worker.VMCount < b.worker.VMCount
+		}
+		return a.worker.ID < b.worker.ID
+	})
+	placement.Worker = candidates[0].worker
+	placement.Score = candidates[0].score
+	return placement, nil
+}
+
+// filter runs the built-in filters, then the strategy's. vCPUs may be
+// overcommitted, so only VM slots and memory are checked; workers still
+// refuse VMs they can't admit.
+func (s *strategyScheduler) filter(req *Request, worker *storage.Worker) error {
+	if worker.Status != string(discovery.WorkerStatusActive) {
+		return fmt.Errorf("worker is %s", worker.Status)
+	}
+	for _, id := range req.ExcludeWorkers {
+		if worker.ID == id {
+			return fmt.Errorf("excluded")
+		}
+	}
+	if s.now().Sub(worker.LastSeen) > HeartbeatTimeout {
+		return fmt.Errorf("no heartbeat since %s", worker.LastSeen.Format(time.RFC3339))
+	}
+	if problems, unhealthy := HostProblems(worker); unhealthy {
+		return fmt.Errorf("host unhealthy: %s", problems)
+	}
+	if worker.MaxVMs > 0 && worker.VMCount >= worker.MaxVMs {
+		return fmt.Errorf("at its limit of %d VMs", worker.MaxVMs)
+	}
+	if worker.MemoryMB > 0 && freeMemoryMB(worker) < int64(req.MemoryMB) {
+		return fmt.Errorf("%d MB of memory free, %d MB needed", freeMemoryMB(worker), req.MemoryMB)
+	}
+	for _, capability := range req.Capabilities {
+		if !hasCapability(worker, capability) {
+			return fmt.Errorf("missing capability %s", capability)
+		}
+	}
+	if req.ZoneRequired && req.Zone != "" && worker.Zone != req.Zone {
+		return fmt.Errorf("in zone %s, not %s", worker.Zone, req.Zone)
+	}
+	return s.strategy.Filter(req, worker)
+}
+
+// describeRejections lists why workers were rejected, for errors
+func describeRejections(rejected map[string]string) string {
+	if len(rejected) == 0 {
+		return "no workers registered"
+	}
+	ids := make([]string, 0, len(rejected))
+	for id := range rejected {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	reasons := make([]string, len(ids))
+	for i, id := range ids {
+		reasons[i] = id + ": " + rejected[id]
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// HostProblems reports whether the worker last reported its host as
+// unhealthy, and why. Workers that don't report host health are healthy.
+func HostProblems(worker *storage.Worker) (string, bool) {
+	health, ok := worker.Metadata[MetadataHostHealth].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	if healthy, ok := health["healthy"].(bool); !ok || healthy {
+		return "", false
+	}
+
+	var problems []string
+	if list, ok := health["problems"].([]interface{}); ok {
+		for _, p := range list {
+			if s, ok := p.(string); ok {
+				problems = append(problems, s)
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return "reported by worker", true
+	}
+	return strings.Join(problems, ", "), true
+}
+
+func freeMemoryMB(worker *storage.Worker) int64 {
+	return worker.MemoryMB - worker.UsedMemoryMB
+}
+
+func hasCapability(worker *storage.Worker, capability string) bool {
+	for _, c := range worker.Capabilities {
+		if s, ok := c.(string); ok && s == capability {
+			return true
+		}
+	}
+	return false
+}
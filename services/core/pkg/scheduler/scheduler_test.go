@@ -0,0 +1,167 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+func testWorkers() []*storage.Worker {
+	now := time.Now()
+	return []*storage.Worker{
+		{ID: "busy", Status: "active", LastSeen: now, Zone: "a", MemoryMB: 8192, UsedMemoryMB: 6144, VMCount: 6, MaxVMs: 10},
+		{ID: "quiet", Status: "active", LastSeen: now, Zone: "b", MemoryMB: 8192, UsedMemoryMB: 1024, VMCount: 1, MaxVMs: 10},
+		{ID: "quiet-a", Status: "active", LastSeen: now, Zone: "a", MemoryMB: 8192, UsedMemoryMB: 2048, VMCount: 2, MaxVMs: 10},
+		{ID: "full", Status: "active", LastSeen: now, Zone: "a", MemoryMB: 8192, VMCount: 10, MaxVMs: 10},
+		{ID: "stale", Status: "active", LastSeen: now.Add(-time.Hour), Zone: "a", MemoryMB: 8192},
+		{ID: "draining", Status: "draining", LastSeen: now, Zone: "a", MemoryMB: 8192},
+	}
+}
+
+// TestSchedulePicksByStrategy tests that each built-in strategy picks the
+// expected worker
+func TestSchedulePicksByStrategy(t *testing.T) {
+	tests := []struct {
+		strategy string
+		req      Request
+		want     string
+	}{
+		{StrategyBinpack, Request{MemoryMB: 512}, "busy"},
+		{StrategySpread, Request{MemoryMB: 512}, "quiet"},
+		{StrategyZoneAffinity, Request{MemoryMB: 512, Zone: "a"}, "quiet-a"},
+		{StrategySpread, Request{MemoryMB: 512, Zone: "a", ZoneRequired: true}, "quiet-a"},
+		{StrategyBinpack, Request{MemoryMB: 4096}, "quiet-a"}, // busy has 2048 MB free
+		{StrategyBinpack, Request{MemoryMB: 512, ExcludeWorkers: []string{"busy"}}, "quiet-a"},
+	}
+
+	for _, tt := range tests {
+		sched, err := New(tt.strategy)
+		if err != nil {
+			t.Fatalf("New(%s): %v", tt.strategy, err)
+		}
+		placement, err := sched.Schedule(context.Background(), &tt.req, testWorkers())
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.strategy, err)
+			continue
+		}
+		if placement.Worker.ID != tt.want {
+			t.Errorf("%s with %+v: expected %s, got %s", tt.strategy, tt.req, tt.want, placement.Worker.ID)
+		}
+		for _, id := range []string{"full", "stale", "draining"} {
+			if _, ok := placement.Rejected[id]; !ok {
+				t.Errorf("%s: expected worker %s to be rejected", tt.strategy, id)
+			}
+		}
+	}
+}
+
+// TestScheduleNoWorkers tests that a VM no worker can host isn't placed
+func TestScheduleNoWorkers(t *testing.T) {
+	sched, err := New("")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	_, err = sched.Schedule(context.Background(), &Request{MemoryMB: 16384}, testWorkers())
+	if !errors.Is(err, ErrNoWorkers) {
+		t.Errorf("Expected ErrNoWorkers, got %v", err)
+	}
+}
+
+// TestScheduleSkipsUnhealthyHosts tests that workers reporting an unhealthy
+// host are filtered out, with the problems they reported
+func TestScheduleSkipsUnhealthyHosts(t *testing.T) {
+	sched, err := New(StrategySpread)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	workers := testWorkers()
+	workers[1].Metadata = storage.JSONB{MetadataHostHealth: map[string]interface{}{
+		"healthy":  false,
+		"problems": []interface{}{"temperature 96°C over 90°C"},
+	}}
+	workers[2].Metadata = storage.JSONB{MetadataHostHealth: map[string]interface{}{"healthy": true}}
+
+	placement, err := sched.Schedule(context.Background(), &Request{MemoryMB: 512}, workers)
+	if err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+	if placement.Worker.ID != "quiet-a" {
+		t.Errorf("Expected quiet-a, got %s", placement.Worker.ID)
+	}
+	if reason := placement.Rejected["quiet"]; reason != "host unhealthy: temperature 96°C over 90°C" {
+		t.Errorf("Expected quiet to be rejected as unhealthy, got %q", reason)
+	}
+}
+
+// TestRegister tests registering and looking up a custom strategy
+func TestRegister(t *testing.T) {
+	Register("test-first", func() Strategy { return firstByID{} })
+
+	sched, err := New("test-first")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	placement, err := sched.Schedule(context.Background(), &Request{MemoryMB: 512}, testWorkers())
+	if err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+	// All score 0, so the worker with the fewest VMs wins
+	if placement.Worker.ID != "quiet" {
+		t.Errorf("Expected quiet, got %s", placement.Worker.ID)
+	}
+
+	if _, err := Lookup("no-such-strategy"); err == nil {
+		t.Error("Expected error for unknown strategy")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic registering a strategy twice")
+		}
+	}()
+	Register(StrategySpread, func() Strategy { return spread{} })
+}
+
+// TestSimulation tests that simulated VMs are charged to their workers,
+// so later ones see the load, and that the real workers are left alone
+func TestSimulation(t *testing.T) {
+	sched, err := New(StrategySpread)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	workers := testWorkers()
+	sim := NewSimulation(workers)
+
+	// quiet and quiet-a have 7168 and 6144 MB free; four 3072 MB VMs fill both
+	var placed []string
+	for i := 0; i < 4; i++ {
+		placement, err := sim.Place(context.Background(), sched, &Request{MemoryMB: 3072})
+		if err != nil {
+			t.Fatalf("VM %d: unexpected error: %v", i, err)
+		}
+		placed = append(placed, placement.Worker.ID)
+	}
+	want := []string{"quiet", "quiet-a", "quiet", "quiet-a"}
+	for i := range want {
+		if placed[i] != want[i] {
+			t.Errorf("Expected placements %v, got %v", want, placed)
+			break
+		}
+	}
+
+	if _, err := sim.Place(context.Background(), sched, &Request{MemoryMB: 3072}); !errors.Is(err, ErrNoWorkers) {
+		t.Errorf("Expected ErrNoWorkers once the cluster is full, got %v", err)
+	}
+	if workers[1].VMCount != 1 || workers[1].UsedMemoryMB != 1024 {
+		t.Errorf("Simulation modified the workers passed in: %+v", workers[1])
+	}
+}
+
+// firstByID scores all workers the same, so ties decide
+type firstByID struct{}
+
+func (firstByID) Name() string                            { return "test-first" }
+func (firstByID) Filter(*Request, *storage.Worker) error  { return nil }
+func (firstByID) Score(*Request, *storage.Worker) float64 { return 0 }
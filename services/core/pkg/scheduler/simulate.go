@@ -0,0 +1,42 @@
+package scheduler
+
+import (
+	"context"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+// Simulation places hypothetical VMs without starting them. It holds copies
+// of the workers, and each VM placed is charged to its worker's copy, so the
+// VMs placed after it see the load it adds.
+type Simulation struct {
+	workers []*storage.Worker
+}
+
+// NewSimulation starts a simulation from the given cluster state. The
+// workers passed in aren't modified.
+func NewSimulation(workers []*storage.Worker) *Simulation {
+	copies := make([]*storage.Worker, len(workers))
+	for i, w := range workers {
+		worker := *w
+		copies[i] = &worker
+	}
+	return &Simulation{workers: copies}
+}
+
+// Place schedules a VM on the simulated workers and, if it fits, charges it
+// to the chosen worker. The placement's Worker is that worker's copy.
+func (s *Simulation) Place(ctx context.Context, sched Scheduler, req *Request) (*Placement, error) {
+	placement, err := sched.Schedule(ctx, req, s.workers)
+	if err != nil {
+		return placement, err
+	}
+	placement.Worker.VMCount++
+	placement.Worker.UsedMemoryMB += int64(req.MemoryMB)
+	return placement, nil
+}
+
+// Workers returns the simulated workers with the VMs placed so far
+func (s *Simulation) Workers() []*storage.Worker {
+	return s.workers
+}
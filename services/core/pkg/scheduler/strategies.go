@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+// binpack scores workers by how full they'd be with the VM
+type binpack struct{}
+
+func (binpack) Name() string { return StrategyBinpack }
+
+func (binpack) Filter(*Request, *storage.Worker) error { return nil }
+
+func (binpack) Score(req *Request, worker *storage.Worker) float64 {
+	return loadAfter(req, worker) * MaxScore
+}
+
+// spread scores workers by how much room they'd have left with the VM
+type spread struct{}
+
+func (spread) Name() string { return StrategySpread }
+
+func (spread) Filter(*Request, *storage.Worker) error { return nil }
+
+func (spread) Score(req *Request, worker *storage.Worker) float64 {
+	return (1 - loadAfter(req, worker)) * MaxScore
+}
+
+// zoneAffinity scores workers in the requested zone above all others, and
+// spreads VMs among the workers of a zone
+type zoneAffinity struct{}
+
+func (zoneAffinity) Name() string { return StrategyZoneAffinity }
+
+func (zoneAffinity) Filter(*Request, *storage.Worker) error { return nil }
+
+func (zoneAffinity) Score(req *Request, worker *storage.Worker) float64 {
+	score := spread{}.Score(req, worker) / 2
+	if req.Zone != "" && worker.Zone == req.Zone {
+		score += MaxScore / 2
+	}
+	return score
+}
+
+// loadAfter is the share of the worker's VM slots or memory in use once the
+// VM is placed on it, whichever is highest, from 0 to 1. Limits a worker
+// doesn't report are left out.
+func loadAfter(req *Request, worker *storage.Worker) float64 {
+	load := 0.0
+	if worker.MaxVMs > 0 {
+		load = max(load, float64(worker.VMCount+1)/float64(worker.MaxVMs))
+	}
+	if worker.MemoryMB > 0 {
+		load = max(load, float64(worker.UsedMemoryMB+int64(req.MemoryMB))/float64(worker.MemoryMB))
+	}
+	return min(load, 1)
+}
@@ -0,0 +1,417 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/gateway/pkg/discovery"
+	"github.com/google/uuid"
+)
+
+// Alert rule kinds
+const (
+	AlertKindThreshold = "threshold"
+	AlertKindAbsence   = "absence"
+)
+
+// Threshold rule metrics
+const (
+	AlertMetricPromptFailureRate = "prompt_failure_rate" // % of prompts finished in the window that failed or timed out
+	AlertMetricCPUUsage          = "cpu_usage"           // % of a worker's CPU cores in use
+	AlertMetricMemoryUsage       = "memory_usage"        // % of a worker's memory in use
+	AlertMetricDiskUsage         = "disk_usage"          // % of a worker's disk pool in use
+	AlertMetricErrorEvents       = "error_events"        // Error cluster events in the window
+)
+
+// Absence rule metrics. An absence rule on "event:<topic>" fires when no
+// cluster event of that topic was recorded for threshold seconds.
+const (
+	AlertMetricWorkerHeartbeat = "worker_heartbeat"
+	alertMetricEventPrefix     = "event:"
+)
+
+// DefaultAlertWindow is used by rate and count metrics of rules without a window
+const DefaultAlertWindow = time.Hour
+
+// AlertNotifier delivers an alert notification to a target
+type AlertNotifier func(ctx context.Context, target storage.AlertTarget, notification *types.Notification) error
+
+// AlertService evaluates alert rules and notifies their targets when a rule
+// starts firing or resolves
+type AlertService struct {
+	store    storage.Store
+	notifier AlertNotifier
+	eventBus events.EventBus
+}
+
+// NewAlertService creates a new alert service
+func NewAlertService(s storage.Store) *AlertService {
+	return &AlertService{store: s}
+}
+
+// SetNotifier sets how alerts are delivered to rule targets (optional)
+func (s *AlertService) SetNotifier(fn AlertNotifier) {
+	s.notifier = fn
+}
+
+// SetEventBus sets the event bus alert events are published on (optional)
+func (s *AlertService) SetEventBus(bus events.EventBus) {
+	s.eventBus = bus
+}
+
+// ValidateAlertRule checks a rule's kind, metric, operator and severity, and
+// fills in the default severity
+func ValidateAlertRule(rule *storage.AlertRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if rule.WindowSeconds < 0 {
+		return fmt.Errorf("window_seconds must not be negative")
+	}
+
+	switch rule.Kind {
+	case AlertKindThreshold:
+		switch rule.Metric {
+		case AlertMetricPromptFailureRate, AlertMetricCPUUsage, AlertMetricMemoryUsage,
+			AlertMetricDiskUsage, AlertMetricErrorEvents:
+		default:
+			return fmt.Errorf("unknown threshold metric %q", rule.Metric)
+		}
+		switch rule.Operator {
+		case ">", ">=", "<", "<=":
+		default:
+			return fmt.Errorf("operator must be one of >, >=, <, <=")
+		}
+	case AlertKindAbsence:
+		topic, isEvent := strings.CutPrefix(rule.Metric, alertMetricEventPrefix)
+		if rule.Metric != AlertMetricWorkerHeartbeat && !(isEvent && events.IsTimelineTopic(topic)) {
+			return fmt.Errorf("unknown absence metric %q", rule.Metric)
+		}
+		if rule.Operator != "" {
+			return fmt.Errorf("absence rules take no operator")
+		}
+		if rule.Threshold <= 0 {
+			return fmt.Errorf("absence rules need a threshold in seconds")
+		}
+	default:
+		return fmt.Errorf("kind must be %s or %s", AlertKindThreshold, AlertKindAbsence)
+	}
+
+	switch rule.Severity {
+	case "":
+		rule.Severity = "warning"
+	case "info", "warning", "error":
+	default:
+		return fmt.Errorf("severity must be info, warning or error")
+	}
+
+	for _, target := range rule.Notify {
+		if target.Integration == "" {
+			return fmt.Errorf("notify targets need an integration")
+		}
+	}
+
+	return nil
+}
+
+// Run evaluates the alert rules every interval until ctx is cancelled
+func (s *AlertService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Evaluate(ctx); err != nil {
+			log.Printf("Warning: Failed to evaluate alert rules: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// alertResult is the outcome of evaluating a rule
+type alertResult struct {
+	firing  bool
+	value   *float64
+	details []string // What breached the rule, e.g. the workers over a threshold
+}
+
+// Evaluate evaluates every enabled rule, recording and delivering alerts for
+// rules that start firing or resolve
+func (s *AlertService) Evaluate(ctx context.Context) error {
+	rules, err := s.store.AlertRules().List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if !rule.Enabled {
+			if rule.Firing {
+				s.store.AlertRules().UpdateState(ctx, rule.ID, false, rule.LastValue, nil)
+			}
+			continue
+		}
+
+		result, err := s.evaluateRule(ctx, rule)
+		if err != nil {
+			log.Printf("Warning: Failed to evaluate alert rule %s: %v", rule.Name, err)
+			continue
+		}
+
+		var firedAt *time.Time
+		switch {
+		case result.firing && !rule.Firing:
+			now := time.Now()
+			firedAt = &now
+			s.alert(ctx, rule, result, events.TopicAlertFiring)
+		case !result.firing && rule.Firing:
+			s.alert(ctx, rule, result, events.TopicAlertResolved)
+		}
+
+		if err := s.store.AlertRules().UpdateState(ctx, rule.ID, result.firing, result.value, firedAt); err != nil {
+			log.Printf("Warning: Failed to record alert rule %s state: %v", rule.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// evaluateRule computes a rule's metric and whether it breaches the rule
+func (s *AlertService) evaluateRule(ctx context.Context, rule *storage.AlertRule) (*alertResult, error) {
+	window := time.Duration(rule.WindowSeconds) * time.Second
+	if window <= 0 {
+		window = DefaultAlertWindow
+	}
+
+	switch rule.Metric {
+	case AlertMetricPromptFailureRate:
+		counts, err := s.store.PromptTasks().CountFinishedSince(ctx, time.Now().Add(-window))
+		if err != nil {
+			return nil, err
+		}
+		total := 0
+		for _, count := range counts {
+			total += count
+		}
+		if total == 0 {
+			return &alertResult{}, nil // No prompts, no rate
+		}
+		failed := counts[storage.PromptStatusFailed] + counts[storage.PromptStatusTimedOut]
+		rate := float64(failed) / float64(total) * 100
+		return &alertResult{
+			firing:  compareAlertValue(rate, rule.Operator, rule.Threshold),
+			value:   &rate,
+			details: []string{fmt.Sprintf("%d of %d prompts failed in the last %v", failed, total, window)},
+		}, nil
+
+	case AlertMetricCPUUsage, AlertMetricMemoryUsage, AlertMetricDiskUsage:
+		return s.evaluateWorkerUsage(ctx, rule)
+
+	case AlertMetricErrorEvents:
+		clusterEvents, err := s.store.ClusterEvents().List(ctx, map[string]interface{}{
+			"severity": "error",
+			"since":    time.Now().Add(-window),
+			"limit":    10000,
+		})
+		if err != nil {
+			return nil, err
+		}
+		count := float64(len(clusterEvents))
+		return &alertResult{
+			firing:  compareAlertValue(count, rule.Operator, rule.Threshold),
+			value:   &count,
+			details: []string{fmt.Sprintf("%d error events in the last %v", len(clusterEvents), window)},
+		}, nil
+
+	case AlertMetricWorkerHeartbeat:
+		return s.evaluateHeartbeats(ctx, rule)
+	}
+
+	if topic, ok := strings.CutPrefix(rule.Metric, alertMetricEventPrefix); ok {
+		threshold := time.Duration(rule.Threshold * float64(time.Second))
+		clusterEvents, err := s.store.ClusterEvents().List(ctx, map[string]interface{}{
+			"types": []string{topic},
+			"since": time.Now().Add(-threshold),
+			"limit": 1,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(clusterEvents) > 0 {
+			return &alertResult{}, nil
+		}
+		return &alertResult{
+			firing:  true,
+			details: []string{fmt.Sprintf("no %s events in the last %v", topic, threshold)},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown metric %q", rule.Metric)
+}
+
+// evaluateWorkerUsage checks each live worker's resource usage against the
+// rule. The value is the highest usage across workers.
+func (s *AlertService) evaluateWorkerUsage(ctx context.Context, rule *storage.AlertRule) (*alertResult, error) {
+	workers, err := s.store.Workers().List(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workers: %w", err)
+	}
+
+	result := &alertResult{}
+	for _, w := range workers {
+		if w.Status == string(discovery.WorkerStatusOffline) {
+			continue
+		}
+
+		var used, total float64
+		switch rule.Metric {
+		case AlertMetricCPUUsage:
+			used, total = float64(w.UsedCPUCores), float64(w.CPUCores)
+		case AlertMetricMemoryUsage:
+			used, total = float64(w.UsedMemoryMB), float64(w.MemoryMB)
+		case AlertMetricDiskUsage:
+			used, total = float64(w.UsedDiskGB), float64(w.DiskGB)
+		}
+		if total <= 0 {
+			continue
+		}
+
+		usage := used / total * 100
+		if result.value == nil || usage > *result.value {
+			result.value = &usage
+		}
+		if compareAlertValue(usage, rule.Operator, rule.Threshold) {
+			result.firing = true
+			result.details = append(result.details, fmt.Sprintf("worker %s: %.1f%%", w.ID, usage))
+		}
+	}
+
+	return result, nil
+}
+
+// evaluateHeartbeats fires for live workers that haven't sent a heartbeat for
+// threshold seconds. The value is the oldest heartbeat's age in seconds.
+func (s *AlertService) evaluateHeartbeats(ctx context.Context, rule *storage.AlertRule) (*alertResult, error) {
+	workers, err := s.store.Workers().List(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workers: %w", err)
+	}
+
+	result := &alertResult{}
+	for _, w := range workers {
+		if w.Status == string(discovery.WorkerStatusOffline) {
+			continue
+		}
+
+		since := time.Since(w.LastSeen)
+		age := since.Seconds()
+		if result.value == nil || age > *result.value {
+			result.value = &age
+		}
+		if age > rule.Threshold {
+			result.firing = true
+			result.details = append(result.details, fmt.Sprintf("worker %s: last heartbeat %v ago", w.ID, since.Round(time.Second)))
+		}
+	}
+
+	return result, nil
+}
+
+func compareAlertValue(value float64, operator string, threshold float64) bool {
+	switch operator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	}
+	return false
+}
+
+// alert records a rule firing or resolving in the cluster timeline and
+// delivers it to the rule's targets
+func (s *AlertService) alert(ctx context.Context, rule *storage.AlertRule, result *alertResult, topic string) {
+	state, severity := "FIRING", rule.Severity
+	if topic == events.TopicAlertResolved {
+		state, severity = "RESOLVED", "info"
+	}
+
+	message := fmt.Sprintf("[%s] %s: %s", state, rule.Name, describeAlertRule(rule))
+	sort.Strings(result.details)
+	if len(result.details) > 0 {
+		message += "\n" + strings.Join(result.details, "\n")
+	}
+
+	data := map[string]interface{}{
+		"rule_id":   rule.ID.String(),
+		"rule_name": rule.Name,
+		"metric":    rule.Metric,
+		"threshold": rule.Threshold,
+		"details":   result.details,
+	}
+	if result.value != nil {
+		data["value"] = *result.value
+	}
+
+	event := &storage.ClusterEvent{
+		ID:           uuid.New(),
+		Type:         topic,
+		Severity:     severity,
+		ResourceType: "alert_rule",
+		ResourceID:   rule.ID.String(),
+		Message:      message,
+		Data:         data,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.store.ClusterEvents().Create(ctx, event); err != nil {
+		log.Printf("Warning: Failed to record %s event: %v", topic, err)
+	}
+
+	if s.eventBus != nil {
+		busEvent := &types.Event{
+			ID:        event.ID.String(),
+			Type:      topic,
+			Timestamp: event.CreatedAt,
+			Data:      data,
+		}
+		if err := s.eventBus.Publish(ctx, topic, busEvent); err != nil {
+			log.Printf("Warning: Failed to publish %s event: %v", topic, err)
+		}
+	}
+
+	if s.notifier == nil {
+		return
+	}
+	for _, target := range rule.Notify {
+		notification := &types.Notification{
+			Type:    topic,
+			Target:  target.Target,
+			Message: message,
+			Data:    data,
+		}
+		if err := s.notifier(ctx, target, notification); err != nil {
+			log.Printf("Warning: Failed to deliver alert %s via %s: %v", rule.Name, target.Integration, err)
+		}
+	}
+}
+
+// describeAlertRule renders a rule's condition, e.g. "disk_usage > 90"
+func describeAlertRule(rule *storage.AlertRule) string {
+	if rule.Kind == AlertKindAbsence {
+		return fmt.Sprintf("no %s for %gs", rule.Metric, rule.Threshold)
+	}
+	return fmt.Sprintf("%s %s %g", rule.Metric, rule.Operator, rule.Threshold)
+}
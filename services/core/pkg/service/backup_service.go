@@ -0,0 +1,296 @@
+package service
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+// BackupFormatVersion is the archive layout version written to manifests
+const BackupFormatVersion = 1
+
+// Archive entries: a manifest plus one JSON Lines file per table
+const (
+	backupManifestFile = "manifest.json"
+	backupTablesDir    = "tables"
+)
+
+// DefaultBackupMaxBytes caps the uncompressed size of an imported archive.
+// Imports are held in memory, and gzip lets a small upload expand far past
+// the request body limit.
+const DefaultBackupMaxBytes int64 = 1 << 30
+
+// ErrBackupUnsupported is returned when the storage provider can't export or import tables
+var ErrBackupUnsupported = errors.New("storage does not support backups")
+
+// ErrInvalidBackup wraps errors caused by the archive rather than the database
+var ErrInvalidBackup = errors.New("invalid backup archive")
+
+// BackupManifest describes a backup archive
+type BackupManifest struct {
+	FormatVersion int            `json:"format_version"`
+	SchemaVersion uint           `json:"schema_version"` // Migration version of the exported database
+	CreatedAt     time.Time      `json:"created_at"`
+	Tables        map[string]int `json:"tables"` // Rows per table
+}
+
+// RestoreResult reports what a restore inserted. Rows that already existed,
+// or whose workspace was missing, are counted as skipped.
+type RestoreResult struct {
+	Manifest *BackupManifest `json:"manifest"`
+	Restored map[string]int  `json:"restored"`
+	Skipped  map[string]int  `json:"skipped"`
+}
+
+// BackupService exports and imports control-plane state (environments,
+// workspaces, secrets ciphertext, workers, policies, alert rules, clusters
+// and integration configs) as a portable tar.gz archive, for disaster
+// recovery and moving between databases. Secrets, integration options and
+// cluster tokens stay encrypted, so the target needs the same
+// WORKSPACE_ENCRYPTION_KEY.
+type BackupService struct {
+	store    storage.Store
+	maxBytes int64 // Uncompressed size limit of imports; negative for none
+}
+
+// NewBackupService creates a new backup service
+func NewBackupService(s storage.Store) *BackupService {
+	return &BackupService{store: s, maxBytes: DefaultBackupMaxBytes}
+}
+
+// SetMaxBytes sets the uncompressed size limit of imported archives; a
+// negative limit removes it
+func (s *BackupService) SetMaxBytes(maxBytes int64) {
+	s.maxBytes = maxBytes
+}
+
+func (s *BackupService) backuper() (storage.Backuper, error) {
+	backuper, ok := s.store.(storage.Backuper)
+	if !ok {
+		return nil, ErrBackupUnsupported
+	}
+	return backuper, nil
+}
+
+// Export writes a backup archive of the storage.BackupTables to w
+func (s *BackupService) Export(ctx context.Context, w io.Writer) (*BackupManifest, error) {
+	backuper, err := s.backuper()
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := backuper.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read every table before writing, so a failed export doesn't leave a
+	// truncated archive that looks complete
+	manifest := &BackupManifest{
+		FormatVersion: BackupFormatVersion,
+		SchemaVersion: version,
+		CreatedAt:     time.Now().UTC(),
+		Tables:        make(map[string]int, len(storage.BackupTables)),
+	}
+	tables := make(map[string][]json.RawMessage, len(storage.BackupTables))
+	for _, table := range storage.BackupTables {
+		rows, err := backuper.ExportRows(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+		tables[table] = rows
+		manifest.Tables[table] = len(rows)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := writeBackupEntry(tw, backupManifestFile, manifestJSON, manifest.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	for _, table := range storage.BackupTables {
+		var buf bytes.Buffer
+		for _, row := range tables[table] {
+			buf.Write(row)
+			buf.WriteByte('\n')
+		}
+		name := path.Join(backupTablesDir, table+".jsonl")
+		if err := writeBackupEntry(tw, name, buf.Bytes(), manifest.CreatedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+
+	return manifest, nil
+}
+
+func writeBackupEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Import restores a backup archive read from r. The archive must come from a
+// database at the same schema version; rows that already exist are skipped,
+// so importing into a live control plane only adds what is missing.
+func (s *BackupService) Import(ctx context.Context, r io.Reader) (*RestoreResult, error) {
+	backuper, err := s.backuper()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, tables, err := readBackupArchive(r, s.maxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := backuper.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.SchemaVersion != version {
+		return nil, fmt.Errorf("%w: archive is at schema version %d but the database is at %d, migrate the database to the same version first",
+			ErrInvalidBackup, manifest.SchemaVersion, version)
+	}
+
+	restored, err := backuper.ImportRows(ctx, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RestoreResult{
+		Manifest: manifest,
+		Restored: make(map[string]int, len(tables)),
+		Skipped:  make(map[string]int, len(tables)),
+	}
+	for table, rows := range tables {
+		result.Restored[table] = restored[table]
+		result.Skipped[table] = len(rows) - restored[table]
+	}
+
+	return result, nil
+}
+
+// readBackupArchive reads and checks a backup archive's manifest and tables.
+// No more than maxBytes are decompressed, unless it is negative.
+func readBackupArchive(r io.Reader, maxBytes int64) (*BackupManifest, map[string][]json.RawMessage, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+	}
+	defer gz.Close()
+
+	var archive io.Reader = gz
+	if maxBytes >= 0 {
+		archive = io.LimitReader(gz, maxBytes)
+	}
+
+	known := make(map[string]bool, len(storage.BackupTables))
+	for _, table := range storage.BackupTables {
+		known[table] = true
+	}
+
+	var manifest *BackupManifest
+	tables := make(map[string][]json.RawMessage)
+
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+		}
+		if maxBytes >= 0 && header.Size > maxBytes {
+			return nil, nil, fmt.Errorf("%w: %s is %d bytes, over the %d byte limit", ErrInvalidBackup, header.Name, header.Size, maxBytes)
+		}
+
+		switch {
+		case header.Name == backupManifestFile:
+			manifest = &BackupManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, nil, fmt.Errorf("%w: bad manifest: %w", ErrInvalidBackup, err)
+			}
+		case path.Dir(header.Name) == backupTablesDir && strings.HasSuffix(header.Name, ".jsonl"):
+			table := strings.TrimSuffix(path.Base(header.Name), ".jsonl")
+			if !known[table] {
+				return nil, nil, fmt.Errorf("%w: unknown table %s", ErrInvalidBackup, table)
+			}
+			rows, err := readBackupRows(tr)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: %s: %w", ErrInvalidBackup, header.Name, err)
+			}
+			tables[table] = rows
+		}
+	}
+
+	if manifest == nil {
+		return nil, nil, fmt.Errorf("%w: missing %s", ErrInvalidBackup, backupManifestFile)
+	}
+	if manifest.FormatVersion != BackupFormatVersion {
+		return nil, nil, fmt.Errorf("%w: unsupported format version %d", ErrInvalidBackup, manifest.FormatVersion)
+	}
+	for table, count := range manifest.Tables {
+		if len(tables[table]) != count {
+			return nil, nil, fmt.Errorf("%w: %s has %d rows, manifest lists %d", ErrInvalidBackup, table, len(tables[table]), count)
+		}
+	}
+
+	return manifest, tables, nil
+}
+
+// readBackupRows reads one JSON object per line
+func readBackupRows(r io.Reader) ([]json.RawMessage, error) {
+	var rows []json.RawMessage
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			return nil, fmt.Errorf("line %d is not valid JSON", len(rows)+1)
+		}
+		rows = append(rows, json.RawMessage(append([]byte(nil), line...)))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/gateway/pkg/discovery"
+	"github.com/google/uuid"
+)
+
+// Capacity policies applied to VM requests when the cluster is saturated
+const (
+	CapacityPolicyReject = "reject"
+	CapacityPolicyQueue  = "queue"
+	CapacityPolicyBurst  = "burst"
+)
+
+// defaultCapacityProject is the policy used for projects without their own
+const defaultCapacityProject = "default"
+
+// defaultRetryAfter is used when no capacity policy is stored at all
+const defaultRetryAfter = 30 * time.Second
+
+// CapacityService checks cluster capacity before VM requests are enqueued
+type CapacityService struct {
+	queue    queue.Queue
+	store    storage.Store
+	eventBus events.EventBus
+}
+
+// NewCapacityService creates a new capacity service
+func NewCapacityService(q queue.Queue, s storage.Store) *CapacityService {
+	return &CapacityService{
+		queue: q,
+		store: s,
+	}
+}
+
+// SetEventBus sets the event bus used to notify the autoscaler (optional)
+func (s *CapacityService) SetEventBus(bus events.EventBus) {
+	s.eventBus = bus
+}
+
+// AdmissionDecision describes how a VM request should be handled
+type AdmissionDecision struct {
+	Saturated     bool          // No live worker can fit the VM right now
+	Policy        string        // Policy applied when saturated
+	Admitted      bool          // False means the request must be rejected
+	RetryAfter    time.Duration // Set when rejected
+	QueuePosition int           // Set when queued: pending tasks ahead of this one, plus one
+}
+
+// IsValidCapacityPolicy reports whether a policy name is supported
+func IsValidCapacityPolicy(policy string) bool {
+	switch policy {
+	case CapacityPolicyReject, CapacityPolicyQueue, CapacityPolicyBurst:
+		return true
+	}
+	return false
+}
+
+// Admit decides whether a VM needing memoryMB can be enqueued for a project
+func (s *CapacityService) Admit(ctx context.Context, project string, memoryMB int) (*AdmissionDecision, error) {
+	saturated, err := s.clusterSaturated(ctx, memoryMB)
+	if err != nil {
+		return nil, err
+	}
+	if !saturated {
+		return &AdmissionDecision{Admitted: true}, nil
+	}
+
+	policy := s.policyFor(ctx, project)
+	decision := &AdmissionDecision{
+		Saturated: true,
+		Policy:    policy.Policy,
+	}
+
+	if project == "" {
+		project = defaultCapacityProject
+	}
+	data := map[string]interface{}{
+		"project":   project,
+		"memory_mb": memoryMB,
+		"policy":    policy.Policy,
+	}
+
+	switch policy.Policy {
+	case CapacityPolicyQueue:
+		decision.Admitted = true
+		decision.QueuePosition = 1
+		if stats, err := s.queue.Stats(ctx); err == nil {
+			decision.QueuePosition = stats.Pending + 1
+		}
+	case CapacityPolicyBurst:
+		decision.Admitted = true
+		s.recordEvent(ctx, events.TopicClusterScaleRequested, "warning", project,
+			fmt.Sprintf("Cluster saturated, requesting more capacity for project %s (%dMB)", project, memoryMB), data)
+		return decision, nil
+	default:
+		decision.RetryAfter = time.Duration(policy.RetryAfterSeconds) * time.Second
+	}
+
+	s.recordEvent(ctx, events.TopicClusterSaturated, "warning", project,
+		fmt.Sprintf("Cluster saturated, VM request for project %s handled with policy %s", project, policy.Policy), data)
+
+	return decision, nil
+}
+
+// clusterSaturated reports whether no live worker can fit a VM of the given size.
+// Clusters without registered workers (single-node mode) are never saturated.
+func (s *CapacityService) clusterSaturated(ctx context.Context, memoryMB int) (bool, error) {
+	workers, err := s.store.Workers().List(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to list workers: %w", err)
+	}
+	if len(workers) == 0 {
+		return false, nil
+	}
+
+	for _, w := range workers {
+		if w.Status != string(discovery.WorkerStatusActive) || time.Since(w.LastSeen) > 1*time.Minute {
+			continue
+		}
+		if w.MaxVMs > 0 && w.VMCount >= w.MaxVMs {
+			continue
+		}
+		if w.MemoryMB > 0 && w.UsedMemoryMB+int64(memoryMB) > w.MemoryMB {
+			continue
+		}
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// policyFor returns the project's capacity policy, falling back to the default
+func (s *CapacityService) policyFor(ctx context.Context, project string) *storage.CapacityPolicy {
+	if project != "" {
+		if policy, err := s.store.CapacityPolicies().Get(ctx, project); err == nil {
+			return policy
+		}
+	}
+	if policy, err := s.store.CapacityPolicies().Get(ctx, defaultCapacityProject); err == nil {
+		return policy
+	}
+
+	return &storage.CapacityPolicy{
+		Project:           defaultCapacityProject,
+		Policy:            CapacityPolicyReject,
+		RetryAfterSeconds: int(defaultRetryAfter.Seconds()),
+	}
+}
+
+// recordEvent adds a capacity event to the cluster timeline and publishes it if an event bus is set
+func (s *CapacityService) recordEvent(ctx context.Context, topic, severity, project, message string, data map[string]interface{}) {
+	event := &storage.ClusterEvent{
+		ID:           uuid.New(),
+		Type:         topic,
+		Severity:     severity,
+		ResourceType: "project",
+		ResourceID:   project,
+		Message:      message,
+		Data:         data,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.store.ClusterEvents().Create(ctx, event); err != nil {
+		log.Printf("Warning: Failed to record %s event: %v", topic, err)
+	}
+
+	if s.eventBus == nil {
+		return
+	}
+
+	busEvent := &types.Event{
+		ID:        event.ID.String(),
+		Type:      topic,
+		Timestamp: event.CreatedAt,
+		Data:      data,
+	}
+	if err := s.eventBus.Publish(ctx, topic, busEvent); err != nil {
+		log.Printf("Warning: Failed to publish %s event: %v", topic, err)
+	}
+}
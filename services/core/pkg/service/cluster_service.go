@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+// ErrNoClusterKey is returned when a federated cluster's token is saved or
+// read without WORKSPACE_ENCRYPTION_KEY
+var ErrNoClusterKey = errors.New("WORKSPACE_ENCRYPTION_KEY is required for cluster tokens")
+
+// ClusterService stores federated clusters. Their bearer tokens are sealed
+// with the workspace secret key, so neither the database nor backups hold
+// them in plaintext. As with integration configs there is no generated
+// fallback key.
+type ClusterService struct {
+	store storage.Store
+	key   []byte // AES-256 key; nil when not configured
+}
+
+// NewClusterService creates a new cluster service. An empty key still
+// allows clusters without a token.
+func NewClusterService(s storage.Store, encryptionKeyHex string) (*ClusterService, error) {
+	key, err := parseEncryptionKey(encryptionKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	return &ClusterService{store: s, key: key}, nil
+}
+
+// Save seals token into the cluster and creates or replaces it. An empty
+// token leaves the cluster's sealed token as it is.
+func (s *ClusterService) Save(ctx context.Context, cluster *storage.Cluster, token string) error {
+	if token != "" {
+		if s.key == nil {
+			return ErrNoClusterKey
+		}
+		ciphertext, nonce, err := sealSecret(s.key, []byte(token))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt token: %w", err)
+		}
+		cluster.EncryptedToken = ciphertext
+		cluster.TokenNonce = nonce
+	}
+	return s.store.Clusters().Upsert(ctx, cluster)
+}
+
+// Token decrypts a cluster's bearer token; empty if it has none
+func (s *ClusterService) Token(cluster *storage.Cluster) (string, error) {
+	if len(cluster.EncryptedToken) == 0 {
+		return "", nil
+	}
+	if s.key == nil {
+		return "", ErrNoClusterKey
+	}
+	plaintext, err := openSecret(s.key, cluster.EncryptedToken, cluster.TokenNonce)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt token of cluster %s: %w", cluster.Name, err)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/tools"
+	"github.com/google/uuid"
+)
+
+// EnvironmentService pins the tools of environments to exact releases
+type EnvironmentService struct {
+	store    storage.Store
+	resolver *tools.Resolver
+}
+
+// NewEnvironmentService creates a new environment service
+func NewEnvironmentService(s storage.Store) *EnvironmentService {
+	return &EnvironmentService{
+		store:    s,
+		resolver: tools.NewResolver(),
+	}
+}
+
+// LockTools resolves the exact release of every tool installed in the
+// environment's VMs and stores them as its tool lock, replacing any earlier
+// one. versions sets the version constraint of individual tools; the others
+// keep the constraint they were last locked with, or "latest".
+func (s *EnvironmentService) LockTools(ctx context.Context, envID uuid.UUID, versions map[string]string) (*storage.EnvironmentLockfile, error) {
+	env, err := s.store.Environments().Get(ctx, envID)
+	if err != nil {
+		return nil, err
+	}
+
+	envTools := tools.EnvironmentTools(env.RequestedTools())
+	for name := range versions {
+		if !containsString(envTools, name) {
+			return nil, fmt.Errorf("tool %s is not installed by environment %s", name, env.Name)
+		}
+	}
+
+	lock := &storage.EnvironmentLockfile{
+		Tools:                make([]storage.LockedTool, 0, len(envTools)),
+		EnvironmentUpdatedAt: env.UpdatedAt,
+	}
+	for _, name := range envTools {
+		constraint := versions[name]
+		if constraint == "" && env.ToolLock != nil {
+			if locked := env.ToolLock.Tool(name); locked != nil {
+				constraint = locked.Constraint
+			}
+		}
+		if constraint == "" {
+			constraint = "latest"
+		}
+
+		release, err := s.resolver.Resolve(ctx, name, constraint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s@%s: %w", name, constraint, err)
+		}
+		lock.Tools = append(lock.Tools, storage.LockedTool{
+			Name:       name,
+			Constraint: constraint,
+			Version:    release.Version,
+			Artifact:   release.Artifact,
+			Checksum:   release.Checksum,
+		})
+	}
+	sort.Slice(lock.Tools, func(i, j int) bool { return lock.Tools[i].Name < lock.Tools[j].Name })
+	lock.ResolvedAt = time.Now()
+
+	if err := s.store.Environments().SetToolLock(ctx, envID, lock); err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// UnlockTools removes an environment's tool lock, so its VMs install the
+// latest releases again
+func (s *EnvironmentService) UnlockTools(ctx context.Context, envID uuid.UUID) error {
+	return s.store.Environments().SetToolLock(ctx, envID, nil)
+}
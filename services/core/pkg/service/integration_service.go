@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+// ErrNoEncryptionKey is returned when integration configs are saved or read
+// without WORKSPACE_ENCRYPTION_KEY
+var ErrNoEncryptionKey = errors.New("WORKSPACE_ENCRYPTION_KEY is required for integration configs")
+
+// IntegrationService stores the configs of integrations set up at runtime.
+// Their options are sealed with the workspace secret key. Unlike workspace
+// secrets there is no generated fallback key: configs sealed with one
+// couldn't be read after a restart.
+type IntegrationService struct {
+	store storage.Store
+	key   []byte // AES-256 key; nil when not configured
+}
+
+// NewIntegrationService creates a new integration service. An empty key
+// leaves listing possible but refuses to store or read options.
+func NewIntegrationService(s storage.Store, encryptionKeyHex string) (*IntegrationService, error) {
+	key, err := parseEncryptionKey(encryptionKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	return &IntegrationService{store: s, key: key}, nil
+}
+
+// parseEncryptionKey decodes a hex AES-256 key; empty gives a nil key
+func parseEncryptionKey(encryptionKeyHex string) ([]byte, error) {
+	if encryptionKeyHex == "" {
+		return nil, nil
+	}
+
+	key, err := hex.DecodeString(encryptionKeyHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes (64 hex characters)")
+	}
+	return key, nil
+}
+
+// List returns all integration configs
+func (s *IntegrationService) List(ctx context.Context) ([]*storage.IntegrationConfig, error) {
+	return s.store.IntegrationConfigs().List(ctx)
+}
+
+// Get returns an integration config by name
+func (s *IntegrationService) Get(ctx context.Context, name string) (*storage.IntegrationConfig, error) {
+	return s.store.IntegrationConfigs().Get(ctx, name)
+}
+
+// Options decrypts a config's options
+func (s *IntegrationService) Options(config *storage.IntegrationConfig) (map[string]interface{}, error) {
+	if s.key == nil {
+		return nil, ErrNoEncryptionKey
+	}
+	plaintext, err := openSecret(s.key, config.EncryptedOptions, config.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt options of integration %s: %w", config.Name, err)
+	}
+
+	var options map[string]interface{}
+	if err := json.Unmarshal(plaintext, &options); err != nil {
+		return nil, fmt.Errorf("failed to parse options of integration %s: %w", config.Name, err)
+	}
+	if options == nil {
+		options = make(map[string]interface{})
+	}
+	return options, nil
+}
+
+// Save encrypts the options and creates or replaces the config
+func (s *IntegrationService) Save(ctx context.Context, name, integrationType string, enabled bool, options map[string]interface{}) (*storage.IntegrationConfig, error) {
+	if s.key == nil {
+		return nil, ErrNoEncryptionKey
+	}
+	plaintext, err := json.Marshal(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode options: %w", err)
+	}
+	ciphertext, nonce, err := sealSecret(s.key, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt options: %w", err)
+	}
+
+	config := &storage.IntegrationConfig{
+		Name:             name,
+		Type:             integrationType,
+		Enabled:          enabled,
+		EncryptedOptions: ciphertext,
+		Nonce:            nonce,
+	}
+	if err := s.store.IntegrationConfigs().Upsert(ctx, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Delete removes an integration config
+func (s *IntegrationService) Delete(ctx context.Context, name string) error {
+	return s.store.IntegrationConfigs().Delete(ctx, name)
+}
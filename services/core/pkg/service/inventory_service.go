@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+// Inventory is a snapshot of the cluster's workers and VMs, exported to
+// external monitoring and CMDBs
+type Inventory struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Workers     []*InventoryWorker `json:"workers"`
+	VMs         []*InventoryVM     `json:"vms"`
+}
+
+// InventoryWorker is a worker in the inventory
+type InventoryWorker struct {
+	ID           string            `json:"id"`
+	Hostname     string            `json:"hostname"`
+	Address      string            `json:"address"`
+	Zone         string            `json:"zone"`
+	Status       string            `json:"status"`
+	Capabilities []string          `json:"capabilities"`
+	Labels       map[string]string `json:"labels"`
+	CPUCores     int               `json:"cpu_cores"`
+	MemoryMB     int64             `json:"memory_mb"`
+	VMCount      int               `json:"vm_count"`
+	LastSeen     time.Time         `json:"last_seen"`
+}
+
+// InventoryVM is a VM in the inventory. Workspace, environment and project
+// are set when the VM belongs to one.
+type InventoryVM struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Status        string    `json:"status"`
+	Orchestrator  string    `json:"orchestrator"`
+	WorkerID      string    `json:"worker_id,omitempty"`
+	Zone          string    `json:"zone,omitempty"`
+	VCPUs         int       `json:"vcpus,omitempty"`
+	MemoryMB      int       `json:"memory_mb,omitempty"`
+	WorkspaceID   string    `json:"workspace_id,omitempty"`
+	EnvironmentID string    `json:"environment_id,omitempty"`
+	Project       string    `json:"project,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// PrometheusTargetGroup is an entry of Prometheus HTTP service discovery
+// (http_sd_configs): targets to scrape and the labels attached to them
+type PrometheusTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// InventoryService reports the cluster's inventory
+type InventoryService struct {
+	store storage.Store
+}
+
+// NewInventoryService creates a new inventory service
+func NewInventoryService(s storage.Store) *InventoryService {
+	return &InventoryService{store: s}
+}
+
+// Snapshot returns the current inventory, workers by ID and VMs oldest first
+func (s *InventoryService) Snapshot(ctx context.Context) (*Inventory, error) {
+	workers, err := s.store.Workers().List(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workers: %w", err)
+	}
+	vms, err := s.store.VMs().List(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VMs: %w", err)
+	}
+
+	inv := &Inventory{
+		GeneratedAt: time.Now().UTC(),
+		Workers:     make([]*InventoryWorker, 0, len(workers)),
+		VMs:         make([]*InventoryVM, 0, len(vms)),
+	}
+
+	zones := make(map[string]string, len(workers))
+	for _, w := range workers {
+		zones[w.ID] = w.Zone
+		worker := &InventoryWorker{
+			ID:           w.ID,
+			Hostname:     w.Hostname,
+			Address:      w.Address,
+			Zone:         w.Zone,
+			Status:       w.Status,
+			Capabilities: make([]string, 0, len(w.Capabilities)),
+			Labels:       make(map[string]string, len(w.Labels)),
+			CPUCores:     w.CPUCores,
+			MemoryMB:     w.MemoryMB,
+			VMCount:      w.VMCount,
+			LastSeen:     w.LastSeen,
+		}
+		for _, c := range w.Capabilities {
+			if capability, ok := c.(string); ok {
+				worker.Capabilities = append(worker.Capabilities, capability)
+			}
+		}
+		for k, v := range w.Labels {
+			if value, ok := v.(string); ok {
+				worker.Labels[k] = value
+			}
+		}
+		inv.Workers = append(inv.Workers, worker)
+	}
+	sort.Slice(inv.Workers, func(i, j int) bool { return inv.Workers[i].ID < inv.Workers[j].ID })
+
+	for _, v := range vms {
+		vm := &InventoryVM{
+			ID:           v.ID.String(),
+			Name:         v.Name,
+			Status:       v.Status,
+			Orchestrator: v.Orchestrator,
+			CreatedAt:    v.CreatedAt,
+		}
+		if v.WorkerID != nil {
+			vm.WorkerID = *v.WorkerID
+			vm.Zone = zones[*v.WorkerID]
+		}
+		if v.VCPUCount != nil {
+			vm.VCPUs = *v.VCPUCount
+		}
+		if v.MemoryMB != nil {
+			vm.MemoryMB = *v.MemoryMB
+		}
+		vm.WorkspaceID, _ = v.Metadata["workspace_id"].(string)
+		vm.EnvironmentID, _ = v.Metadata["environment_id"].(string)
+		vm.Project, _ = v.Metadata["project"].(string)
+		inv.VMs = append(inv.VMs, vm)
+	}
+	sort.Slice(inv.VMs, func(i, j int) bool { return inv.VMs[i].CreatedAt.Before(inv.VMs[j].CreatedAt) })
+
+	return inv, nil
+}
+
+// PrometheusVMTargets returns a target group per running VM on a known
+// worker. VMs aren't reachable from outside their worker, so each VM's
+// exporter on port is scraped through its worker's preview proxy: the
+// target is the worker and __metrics_path__ the proxied /metrics. Scrape
+// configs must send the workers' preview secret as a bearer token.
+func PrometheusVMTargets(inv *Inventory, port int) []*PrometheusTargetGroup {
+	addresses := make(map[string]string, len(inv.Workers))
+	for _, w := range inv.Workers {
+		addresses[w.ID] = w.Address
+	}
+
+	groups := []*PrometheusTargetGroup{}
+	for _, vm := range inv.VMs {
+		address := addresses[vm.WorkerID]
+		if address == "" {
+			continue
+		}
+		if status, err := types.ParseVMStatus(vm.Status); err != nil || status != types.VMStatusRunning {
+			continue
+		}
+		labels := map[string]string{
+			"__metrics_path__":      fmt.Sprintf("/preview/%s/%d/metrics", vm.ID, port),
+			"aetherium_vm_id":       vm.ID,
+			"aetherium_vm_name":     vm.Name,
+			"aetherium_worker_id":   vm.WorkerID,
+			"aetherium_zone":        vm.Zone,
+			"aetherium_vcpus":       strconv.Itoa(vm.VCPUs),
+			"aetherium_memory_mb":   strconv.Itoa(vm.MemoryMB),
+			"aetherium_workspace":   vm.WorkspaceID,
+			"aetherium_environment": vm.EnvironmentID,
+			"aetherium_project":     vm.Project,
+		}
+		groups = append(groups, &PrometheusTargetGroup{Targets: []string{address}, Labels: labels})
+	}
+	return groups
+}
+
+// PrometheusWorkerTargets returns a target group per worker, at its
+// address, labelled with its zone, status and capabilities
+func PrometheusWorkerTargets(inv *Inventory) []*PrometheusTargetGroup {
+	groups := []*PrometheusTargetGroup{}
+	for _, w := range inv.Workers {
+		if w.Address == "" {
+			continue
+		}
+		labels := map[string]string{
+			"aetherium_worker_id":    w.ID,
+			"aetherium_hostname":     w.Hostname,
+			"aetherium_zone":         w.Zone,
+			"aetherium_status":       w.Status,
+			"aetherium_capabilities": "," + joinSorted(w.Capabilities) + ",",
+		}
+		// Worker labels are arbitrary keys; only valid label names are kept
+		for k, v := range w.Labels {
+			if prometheusLabelName(k) {
+				labels["aetherium_label_"+k] = v
+			}
+		}
+		groups = append(groups, &PrometheusTargetGroup{Targets: []string{w.Address}, Labels: labels})
+	}
+	return groups
+}
+
+// joinSorted joins values with commas, sorted
+func joinSorted(values []string) string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// prometheusLabelName reports whether name is a valid Prometheus label name
+// suffix: letters, digits and underscores
+func prometheusLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/scheduler"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// scheduleQueue places a VM on a worker with the named scheduling strategy
+// and returns that worker's queue. It returns "" when no strategy is set or
+// no worker fits, leaving the VM to whichever worker takes it from the
+// shared queues.
+func scheduleQueue(ctx context.Context, store storage.Store, strategy string, req *scheduler.Request) string {
+	if strategy == "" {
+		return ""
+	}
+	sched, err := scheduler.New(strategy)
+	if err != nil {
+		log.Printf("Warning: Not scheduling VM: %v", err)
+		return ""
+	}
+
+	workers, err := store.Workers().List(ctx, nil)
+	if err != nil {
+		log.Printf("Warning: Not scheduling VM, failed to list workers: %v", err)
+		return ""
+	}
+
+	placement, err := sched.Schedule(ctx, req, workers)
+	if err != nil {
+		log.Printf("Warning: Not scheduling VM with %s, leaving it to the shared queue: %v", strategy, err)
+		return ""
+	}
+	log.Printf("Scheduled VM (%d vCPUs, %d MB) on worker %s with %s (score %.1f)",
+		req.VCPUs, req.MemoryMB, placement.Worker.ID, placement.Strategy, placement.Score)
+	return queue.WorkerQueue(placement.Worker.ID)
+}
+
+// environmentPlacement applies an environment's placement settings to the
+// request for one of its VMs and returns the strategy to schedule it with
+func environmentPlacement(env *storage.Environment, req *scheduler.Request, strategy string) string {
+	if env.SchedulingStrategy != "" {
+		strategy = env.SchedulingStrategy
+	}
+	req.ZoneRequired = req.ZoneRequired && !env.CanFailOver()
+	if capability := environmentCapability(env); capability != "" {
+		req.Capabilities = []string{capability}
+	}
+	return strategy
+}
+
+// environmentCapability returns the worker capability an environment's VMs
+// need, or "" if any worker can boot them
+func environmentCapability(env *storage.Environment) string {
+	if env.IsWindows() {
+		return vmm.CapabilityDockerWindows
+	}
+	return ""
+}
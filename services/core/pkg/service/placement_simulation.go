@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/scheduler"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/gateway/pkg/discovery"
+	"github.com/google/uuid"
+)
+
+// Limits on one simulation, counting every copy
+const (
+	MaxSimulatedVMs     = 1000
+	MaxSimulatedWorkers = 100 // Hypothetical workers added
+)
+
+// ErrInvalidSimulation is returned for a simulation request that can't be
+// run, such as one naming an unknown strategy or environment
+var ErrInvalidSimulation = errors.New("invalid placement simulation")
+
+// SimulatedVM is a group of identical hypothetical VMs to place. With an
+// environment, its resources, strategy and capabilities apply as they would
+// to its workspaces, and VCPUs and MemoryMB default to the environment's.
+type SimulatedVM struct {
+	Name          string     `json:"name,omitempty"`  // Label for the group, e.g. the team
+	Count         int        `json:"count,omitempty"` // Default 1
+	VCPUs         int        `json:"vcpus,omitempty"`
+	MemoryMB      int        `json:"memory_mb,omitempty"`
+	EnvironmentID *uuid.UUID `json:"environment_id,omitempty"`
+	Zone          string     `json:"zone,omitempty"`
+	ZoneRequired  bool       `json:"zone_required,omitempty"`
+	Capabilities  []string   `json:"capabilities,omitempty"`
+}
+
+// SimulatedWorker is a hypothetical worker added to the cluster, e.g. to see
+// whether buying more capacity makes a team's VMs fit
+type SimulatedWorker struct {
+	ID           string   `json:"id,omitempty"`    // Default simulated-1, simulated-2, ...
+	Count        int      `json:"count,omitempty"` // Default 1; copies get a numbered ID
+	Zone         string   `json:"zone,omitempty"`
+	MemoryMB     int64    `json:"memory_mb"`
+	MaxVMs       int      `json:"max_vms"`
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// SimulationOptions is a placement simulation: VMs to place, in order, on
+// the current workers plus any hypothetical ones
+type SimulationOptions struct {
+	// Strategy places VMs whose environment doesn't pick one. It defaults
+	// to the configured strategy, or scheduler.DefaultStrategy without one.
+	Strategy   string            `json:"strategy,omitempty"`
+	VMs        []SimulatedVM     `json:"vms"`
+	AddWorkers []SimulatedWorker `json:"add_workers,omitempty"`
+}
+
+// SimulatedPlacement is where one hypothetical VM would go. Unschedulable
+// VMs have no WorkerID and a Reason, and Rejected tells why each worker
+// was passed over.
+type SimulatedPlacement struct {
+	Name     string            `json:"name,omitempty"`
+	Index    int               `json:"index"` // Within its group
+	VCPUs    int               `json:"vcpus"`
+	MemoryMB int               `json:"memory_mb"`
+	Strategy string            `json:"strategy"`
+	WorkerID string            `json:"worker_id,omitempty"`
+	Score    float64           `json:"score,omitempty"`
+	Reason   string            `json:"reason,omitempty"`
+	Rejected map[string]string `json:"rejected,omitempty"`
+}
+
+// SimulationResult is the outcome of a placement simulation, with each
+// worker's load before and after the VMs placed
+type SimulationResult struct {
+	Placements    []*SimulatedPlacement `json:"placements"`
+	Scheduled     int                   `json:"scheduled"`
+	Unschedulable int                   `json:"unschedulable"`
+	Before        []*WorkerLoad         `json:"before"`
+	After         []*WorkerLoad         `json:"after"`
+}
+
+// SimulatePlacement works out where hypothetical VMs would be placed on the
+// cluster as it is now, without creating anything. VMs are placed one after
+// another, each seeing the load of those before it, with the same filters,
+// strategies and environment settings as real workspace VMs. Unlike real
+// placement, VMs are scheduled even when no strategy is configured, with
+// scheduler.DefaultStrategy, as they'd otherwise go to whichever worker
+// polls first.
+func (s *WorkspaceService) SimulatePlacement(ctx context.Context, opts SimulationOptions) (*SimulationResult, error) {
+	defaultStrategy := opts.Strategy
+	if defaultStrategy == "" {
+		defaultStrategy = s.schedulingStrategy
+	}
+	if defaultStrategy == "" {
+		defaultStrategy = scheduler.DefaultStrategy
+	}
+	if _, err := scheduler.Lookup(defaultStrategy); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSimulation, err)
+	}
+
+	total := 0
+	for _, vm := range opts.VMs {
+		if vm.Count < 0 {
+			return nil, fmt.Errorf("%w: count must not be negative", ErrInvalidSimulation)
+		}
+		total += max(vm.Count, 1)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("%w: no VMs to place", ErrInvalidSimulation)
+	}
+	if total > MaxSimulatedVMs {
+		return nil, fmt.Errorf("%w: %d VMs, at most %d", ErrInvalidSimulation, total, MaxSimulatedVMs)
+	}
+
+	workers, err := s.store.Workers().List(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workers: %w", err)
+	}
+	added, err := simulatedWorkers(opts.AddWorkers, workers)
+	if err != nil {
+		return nil, err
+	}
+	workers = append(workers, added...)
+
+	sim := scheduler.NewSimulation(workers)
+	result := &SimulationResult{
+		Placements: make([]*SimulatedPlacement, 0, total),
+		Before:     simulatedLoads(sim.Workers()),
+	}
+	schedulers := make(map[string]scheduler.Scheduler)
+
+	for _, vm := range opts.VMs {
+		req := &scheduler.Request{
+			VCPUs:        vm.VCPUs,
+			MemoryMB:     vm.MemoryMB,
+			Zone:         vm.Zone,
+			ZoneRequired: vm.ZoneRequired && vm.Zone != "",
+		}
+		strategy := defaultStrategy
+		if vm.EnvironmentID != nil {
+			env, err := s.store.Environments().Get(ctx, *vm.EnvironmentID)
+			if err != nil {
+				return nil, fmt.Errorf("%w: environment %s: %v", ErrInvalidSimulation, vm.EnvironmentID, err)
+			}
+			if req.VCPUs == 0 {
+				req.VCPUs = env.VCPUs
+			}
+			if req.MemoryMB == 0 {
+				req.MemoryMB = env.MemoryMB
+			}
+			strategy = environmentPlacement(env, req, strategy)
+		}
+		req.Capabilities = append(req.Capabilities, vm.Capabilities...)
+		if req.VCPUs < 1 {
+			req.VCPUs = 1
+		}
+		if req.MemoryMB < 128 {
+			req.MemoryMB = 512
+		}
+
+		sched, ok := schedulers[strategy]
+		if !ok {
+			if sched, err = scheduler.New(strategy); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidSimulation, err)
+			}
+			schedulers[strategy] = sched
+		}
+
+		for i := 0; i < max(vm.Count, 1); i++ {
+			p := &SimulatedPlacement{
+				Name:     vm.Name,
+				Index:    i,
+				VCPUs:    req.VCPUs,
+				MemoryMB: req.MemoryMB,
+				Strategy: strategy,
+			}
+			placement, err := sim.Place(ctx, sched, req)
+			if placement != nil && len(placement.Rejected) > 0 {
+				p.Rejected = placement.Rejected
+			}
+			if err != nil {
+				p.Reason = err.Error()
+				result.Unschedulable++
+			} else {
+				p.WorkerID = placement.Worker.ID
+				p.Score = placement.Score
+				result.Scheduled++
+			}
+			result.Placements = append(result.Placements, p)
+		}
+	}
+
+	result.After = simulatedLoads(sim.Workers())
+	return result, nil
+}
+
+// simulatedWorkers builds the hypothetical workers to add, checking their
+// IDs don't clash with the existing workers'
+func simulatedWorkers(specs []SimulatedWorker, existing []*storage.Worker) ([]*storage.Worker, error) {
+	ids := make(map[string]bool, len(existing))
+	for _, w := range existing {
+		ids[w.ID] = true
+	}
+
+	var workers []*storage.Worker
+	now := time.Now()
+	for n, spec := range specs {
+		if spec.MemoryMB <= 0 || spec.MaxVMs <= 0 {
+			return nil, fmt.Errorf("%w: added workers need memory_mb and max_vms", ErrInvalidSimulation)
+		}
+		count := max(spec.Count, 1)
+		if len(workers)+count > MaxSimulatedWorkers {
+			return nil, fmt.Errorf("%w: at most %d added workers", ErrInvalidSimulation, MaxSimulatedWorkers)
+		}
+		for i := 0; i < count; i++ {
+			id := spec.ID
+			switch {
+			case id == "":
+				id = fmt.Sprintf("simulated-%d", len(workers)+1)
+			case count > 1:
+				id = fmt.Sprintf("%s-%d", spec.ID, i+1)
+			}
+			if ids[id] {
+				return nil, fmt.Errorf("%w: added worker %d: ID %s is taken", ErrInvalidSimulation, n+1, id)
+			}
+			ids[id] = true
+
+			capabilities := make(storage.JSONBArray, len(spec.Capabilities))
+			for j, c := range spec.Capabilities {
+				capabilities[j] = c
+			}
+			workers = append(workers, &storage.Worker{
+				ID:           id,
+				Hostname:     id,
+				Status:       string(discovery.WorkerStatusActive),
+				LastSeen:     now,
+				StartedAt:    now,
+				Zone:         spec.Zone,
+				Capabilities: capabilities,
+				MemoryMB:     spec.MemoryMB,
+				MaxVMs:       spec.MaxVMs,
+			})
+		}
+	}
+	return workers, nil
+}
+
+// simulatedLoads reports the load of the workers that can take VMs
+func simulatedLoads(workers []*storage.Worker) []*WorkerLoad {
+	loads := make([]*WorkerLoad, 0, len(workers))
+	for _, w := range workers {
+		if w.Status != string(discovery.WorkerStatusActive) || time.Since(w.LastSeen) > scheduler.HeartbeatTimeout {
+			continue
+		}
+		load := &WorkerLoad{
+			WorkerID:     w.ID,
+			Hostname:     w.Hostname,
+			VMCount:      w.VMCount,
+			MaxVMs:       w.MaxVMs,
+			UsedMemoryMB: w.UsedMemoryMB,
+			MemoryMB:     w.MemoryMB,
+		}
+		load.LoadPercent = loadPercent(load)
+		loads = append(loads, load)
+	}
+	return loads
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// AttachmentUploadTTL is how long an upload waits to be submitted with a
+// prompt before it is deleted
+const AttachmentUploadTTL = 24 * time.Hour
+
+// Attachment errors
+var (
+	ErrInvalidAttachment  = errors.New("invalid attachment")
+	ErrAttachmentTooLarge = errors.New("attachment too large")
+)
+
+// UploadAttachment stores a file for a prompt to be submitted to the
+// workspace. It is attached by passing the returned ID in the prompt's
+// attachments.
+func (s *WorkspaceService) UploadAttachment(ctx context.Context, workspaceID uuid.UUID, name string, content io.Reader) (*storage.PromptAttachment, error) {
+	if err := storage.ValidateAttachmentName(name); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAttachment, err)
+	}
+	if _, err := s.store.Workspaces().Get(ctx, workspaceID); err != nil {
+		return nil, fmt.Errorf("workspace not found: %w", err)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(content, storage.MaxAttachmentBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+	if len(data) > storage.MaxAttachmentBytes {
+		return nil, fmt.Errorf("%w: files must be at most %d bytes", ErrAttachmentTooLarge, storage.MaxAttachmentBytes)
+	}
+
+	sum := sha256.Sum256(data)
+	attachment := &storage.PromptAttachment{
+		ID:          uuid.New(),
+		WorkspaceID: workspaceID,
+		Name:        name,
+		SizeBytes:   int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		CreatedAt:   time.Now(),
+	}
+	if err := s.store.PromptAttachments().Create(ctx, attachment, data); err != nil {
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// checkAttachments checks that uploads can be attached to a prompt of the
+// workspace: they are its own, not attached yet, and within the limits
+func (s *WorkspaceService) checkAttachments(ctx context.Context, workspaceID uuid.UUID, ids []uuid.UUID) error {
+	if len(ids) > storage.MaxPromptAttachments {
+		return fmt.Errorf("%w: at most %d attachments per prompt", ErrInvalidAttachment, storage.MaxPromptAttachments)
+	}
+
+	names := make(map[string]bool, len(ids))
+	var total int64
+	for _, id := range ids {
+		attachment, err := s.store.PromptAttachments().Get(ctx, id)
+		if err != nil || attachment.WorkspaceID != workspaceID {
+			return fmt.Errorf("%w: %s is not an upload of this workspace", ErrInvalidAttachment, id)
+		}
+		if attachment.PromptID != nil {
+			return fmt.Errorf("%w: %s is already attached to prompt %s", ErrInvalidAttachment, id, attachment.PromptID)
+		}
+		if names[attachment.Name] {
+			return fmt.Errorf("%w: two attachments are named %s", ErrInvalidAttachment, attachment.Name)
+		}
+		names[attachment.Name] = true
+		total += attachment.SizeBytes
+	}
+	if total > storage.MaxPromptAttachmentBytes {
+		return fmt.Errorf("%w: attachments total %d bytes, at most %d", ErrAttachmentTooLarge, total, storage.MaxPromptAttachmentBytes)
+	}
+
+	return nil
+}
+
+// ListPromptAttachments lists the files attached to a prompt
+func (s *WorkspaceService) ListPromptAttachments(ctx context.Context, promptID uuid.UUID) ([]*storage.PromptAttachment, error) {
+	return s.store.PromptAttachments().ListByPrompt(ctx, promptID)
+}
+
+// PruneAttachments deletes uploads that were never submitted with a prompt
+func (s *WorkspaceService) PruneAttachments(ctx context.Context) (int64, error) {
+	return s.store.PromptAttachments().DeleteUnattached(ctx, time.Now().Add(-AttachmentUploadTTL))
+}
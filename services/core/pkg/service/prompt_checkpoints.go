@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// GetPromptCheckpoint returns the latest checkpoint of a prompt, or nil if
+// none has been taken
+func (s *WorkspaceService) GetPromptCheckpoint(ctx context.Context, promptID uuid.UUID) (*storage.PromptCheckpoint, error) {
+	return s.store.PromptCheckpoints().Get(ctx, promptID)
+}
+
+// SealCheckpointDiff keeps diff, a checkpoint's working directory diff before
+// redaction, sealed in the checkpoint like workspace secrets. Its Diff only
+// holds the redacted copy shown to clients, which can't be applied.
+func (s *WorkspaceService) SealCheckpointDiff(checkpoint *storage.PromptCheckpoint, diff string) error {
+	ciphertext, nonce, err := s.encryptSecret([]byte(diff))
+	if err != nil {
+		return fmt.Errorf("failed to seal checkpoint diff: %w", err)
+	}
+	checkpoint.SealedDiff = ciphertext
+	checkpoint.SealedDiffNonce = nonce
+	return nil
+}
+
+// CheckpointDiff returns the unredacted diff sealed by SealCheckpointDiff
+func (s *WorkspaceService) CheckpointDiff(checkpoint *storage.PromptCheckpoint) (string, error) {
+	if checkpoint.SealedDiff == nil {
+		return "", fmt.Errorf("checkpoint has no sealed diff")
+	}
+	plaintext, err := s.decryptSecret(checkpoint.SealedDiff, checkpoint.SealedDiffNonce)
+	if err != nil {
+		return "", fmt.Errorf("failed to open checkpoint diff: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// partialPromptResult fills in a failed prompt's output from its latest
+// checkpoint when the failure left none
+func (s *WorkspaceService) partialPromptResult(ctx context.Context, promptID uuid.UUID, result *storage.PromptResult) *storage.PromptResult {
+	checkpoint, err := s.store.PromptCheckpoints().Get(ctx, promptID)
+	if err == nil {
+		result.WithCheckpoint(checkpoint)
+	}
+	return result
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// DefaultPromptRetries is how many times a prompt failing for an
+// infrastructure reason is retried unless configured otherwise
+const DefaultPromptRetries = 2
+
+// SetPromptRetries sets how many times a prompt failing for an
+// infrastructure reason is retried on another worker (0 = never)
+func (s *WorkspaceService) SetPromptRetries(retries int) {
+	if retries < 0 {
+		retries = 0
+	}
+	s.promptRetries = retries
+}
+
+// CanRetryPrompt reports whether a prompt failing for reason would be
+// retried: the failure must be the infrastructure's, the prompt must have
+// attempts left, and its workspace must be able to respawn its VM from an
+// environment elsewhere
+func (s *WorkspaceService) CanRetryPrompt(prompt *storage.PromptTask, workspace *storage.Workspace, reason string) bool {
+	return storage.IsInfrastructureFailure(reason) &&
+		prompt.Attempt <= s.promptRetries &&
+		workspace.EnvironmentID != nil
+}
+
+// RetryPrompt records a failed attempt of a prompt and queues the next one,
+// placed away from the worker it failed on. The workspace must already be
+// without a VM, so the next attempt spawns a fresh one. It reports false
+// when the prompt can't be retried, or with an error when the next attempt
+// couldn't be queued; callers then fail the prompt as they would without
+// retries. storage.ErrPromptAttemptPassed means another caller retried or
+// finished the attempt first, and the prompt must be left alone.
+func (s *WorkspaceService) RetryPrompt(ctx context.Context, prompt *storage.PromptTask, failure *storage.PromptAttempt) (bool, error) {
+	workspace, err := s.store.Workspaces().Get(ctx, prompt.WorkspaceID)
+	if err != nil {
+		return false, fmt.Errorf("workspace not found: %w", err)
+	}
+	if !s.CanRetryPrompt(prompt, workspace, failure.FailureReason) {
+		return false, nil
+	}
+
+	failure.PromptID = prompt.ID
+	failure.Attempt = prompt.Attempt
+	if err := s.store.PromptTasks().Retry(ctx, failure); err != nil {
+		return false, err
+	}
+	next := prompt.Attempt + 1
+
+	task, err := queue.NewTask(queue.TaskTypePromptExecute, &queue.PromptExecutePayload{
+		PromptID:    prompt.ID.String(),
+		WorkspaceID: workspace.ID.String(),
+		Attempt:     next,
+	})
+	if err != nil {
+		return false, err
+	}
+	task.Priority = prompt.Priority
+
+	timeoutSeconds := 0
+	if prompt.TimeoutSeconds != nil {
+		timeoutSeconds = *prompt.TimeoutSeconds
+	}
+	opts := &queue.TaskOptions{
+		Timeout:  s.promptTaskTimeout(ctx, workspace, timeoutSeconds),
+		Queue:    "default",
+		Priority: prompt.Priority,
+		Class:    queue.WorkloadClass(prompt.WorkloadClass),
+	}
+	var exclude []string
+	if failure.WorkerID != nil {
+		exclude = append(exclude, *failure.WorkerID)
+	}
+	queueName := s.promptQueue(ctx, workspace)
+	if env, err := s.store.Environments().Get(ctx, *workspace.EnvironmentID); err == nil {
+		if placed := s.placementQueue(ctx, workspace, env.VCPUs, env.MemoryMB, exclude...); placed != "" {
+			queueName = placed
+		}
+	}
+	if queueName != "" {
+		opts.Queue = queueName
+		opts.Priority = 0
+	}
+
+	if err := s.queue.Enqueue(ctx, task, opts); err != nil {
+		return false, fmt.Errorf("failed to enqueue attempt %d of prompt %s: %w", next, prompt.ID, err)
+	}
+
+	log.Printf("Retrying prompt %s (attempt %d of %d) after %s",
+		prompt.ID, next, s.promptRetries+1, failure.FailureReason)
+	return true, nil
+}
+
+// promptWorkerLostAfter is how long a worker running a prompt may go
+// without a heartbeat before the prompt is considered lost with it
+const promptWorkerLostAfter = 3 * time.Minute
+
+// RecoverLostPrompts finds running prompts whose worker stopped sending
+// heartbeats, unlinks the VM that died with it and retries them elsewhere,
+// or fails them with worker_lost when they can't be retried. It returns
+// how many prompts were recovered.
+func (s *WorkspaceService) RecoverLostPrompts(ctx context.Context) (int, error) {
+	prompts, err := s.store.PromptTasks().ListByStatus(ctx, storage.PromptStatusRunning)
+	if err != nil {
+		return 0, err
+	}
+	if len(prompts) == 0 {
+		return 0, nil
+	}
+	workers, err := s.store.Workers().List(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list workers: %w", err)
+	}
+	lastSeen := make(map[string]time.Time, len(workers))
+	for _, w := range workers {
+		lastSeen[w.ID] = w.LastSeen
+	}
+
+	recovered := 0
+	for _, prompt := range prompts {
+		workspace, err := s.store.Workspaces().Get(ctx, prompt.WorkspaceID)
+		if err != nil {
+			continue
+		}
+		workerID, vmID := s.promptPlacement(ctx, prompt, workspace)
+		if workerID == "" {
+			continue
+		}
+		seen, ok := lastSeen[workerID]
+		if ok && time.Since(seen) < promptWorkerLostAfter {
+			continue
+		}
+
+		detail := fmt.Sprintf("worker %s is gone", workerID)
+		if ok {
+			detail = fmt.Sprintf("worker %s has sent no heartbeat since %s", workerID, seen.Format(time.RFC3339))
+		}
+		log.Printf("Prompt %s was lost: %s", prompt.ID, detail)
+		if err := s.recoverLostPrompt(ctx, prompt, workspace, workerID, vmID, detail); err != nil {
+			log.Printf("Warning: Failed to recover prompt %s: %v", prompt.ID, err)
+			continue
+		}
+		recovered++
+	}
+	return recovered, nil
+}
+
+// promptPlacement returns the worker and VM a running prompt was sent to
+func (s *WorkspaceService) promptPlacement(ctx context.Context, prompt *storage.PromptTask, workspace *storage.Workspace) (string, *uuid.UUID) {
+	if env := prompt.ExecutionEnv; env != nil && env.WorkerID != "" {
+		if id, err := uuid.Parse(env.VMID); err == nil {
+			return env.WorkerID, &id
+		}
+		return env.WorkerID, nil
+	}
+	// The prompt hasn't recorded its execution environment yet
+	if workspace.VMID == nil {
+		return "", nil
+	}
+	vm, err := s.store.VMs().Get(ctx, *workspace.VMID)
+	if err != nil || vm.WorkerID == nil {
+		return "", nil
+	}
+	return *vm.WorkerID, &vm.ID
+}
+
+// recoverLostPrompt unlinks the workspace's VM lost with its worker, then
+// retries the prompt or fails it
+func (s *WorkspaceService) recoverLostPrompt(ctx context.Context, prompt *storage.PromptTask, workspace *storage.Workspace, workerID string, vmID *uuid.UUID, detail string) error {
+	// Workspaces with an environment respawn their VM on the next prompt
+	if vmID != nil && workspace.VMID != nil && *workspace.VMID == *vmID && workspace.EnvironmentID != nil {
+		err := s.store.WithTx(ctx, func(tx storage.Store) error {
+			if err := tx.Workspaces().ClearVMID(ctx, workspace.ID); err != nil {
+				return err
+			}
+			if err := tx.Workspaces().UpdateStatus(ctx, workspace.ID, storage.WorkspaceStatusIdle,
+				fmt.Sprintf("VM %s lost with its worker: %s", *vmID, detail)); err != nil {
+				return err
+			}
+			if err := tx.VMs().Delete(ctx, *vmID); err != nil {
+				log.Printf("Warning: Failed to delete VM from database: %v", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to unlink VM %s: %w", *vmID, err)
+		}
+	}
+
+	message := "prompt lost: " + detail
+	retried, err := s.RetryPrompt(ctx, prompt, &storage.PromptAttempt{
+		WorkerID:      &workerID,
+		VMID:          vmID,
+		FailureReason: storage.PromptFailureWorkerLost,
+		Error:         &message,
+	})
+	if errors.Is(err, storage.ErrPromptAttemptPassed) || retried {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to retry prompt %s: %v", prompt.ID, err)
+	}
+	return s.store.PromptTasks().UpdateStatus(ctx, prompt.ID, storage.PromptStatusFailed, s.partialPromptResult(ctx, prompt.ID, &storage.PromptResult{
+		Error:         message,
+		FailureReason: storage.PromptFailureWorkerLost,
+		FailureDetail: detail,
+	}))
+}
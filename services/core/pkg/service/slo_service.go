@@ -0,0 +1,481 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// SLO objectives
+const (
+	SLOObjectiveAvailability = "availability"
+	SLOObjectiveLatency      = "latency"
+)
+
+// Error budget states
+const (
+	SLOStatusOK        = "ok"
+	SLOStatusAtRisk    = "at_risk"   // Burning fast enough to run out early
+	SLOStatusExhausted = "exhausted" // Nothing left for the window
+)
+
+// sloBucket is how long API request counts are kept in memory before a
+// bucket of them is written
+const sloBucket = 5 * time.Minute
+
+// sloKVNamespace holds each objective's last budget state, so only one
+// gateway emits an event when it changes
+const sloKVNamespace = "slo"
+
+// Burn rate windows. A budget is at risk when it burns at the fast rate
+// over the short window or at the slow rate over the long one.
+const (
+	sloFastWindow = time.Hour
+	sloSlowWindow = 6 * time.Hour
+)
+
+// SLOTarget is a service level objective for API requests or for tasks
+type SLOTarget struct {
+	Name string
+	// Endpoint selects API requests: "*", "/api/v1/vms/{id}" or
+	// "POST /api/v1/vms". Empty for task targets.
+	Endpoint string
+	// TaskType selects tasks: "*" or a type. Empty for API targets.
+	TaskType string
+	// Availability is the % of requests or tasks that must succeed (0 = no
+	// availability objective)
+	Availability float64
+	// Latency is how fast successful ones must be (0 = no latency
+	// objective). Tasks are timed from being enqueued until they finish.
+	Latency time.Duration
+	// LatencyTarget is the % that must succeed within Latency
+	LatencyTarget float64
+}
+
+// SLOSettings configures the SLO service
+type SLOSettings struct {
+	Window       time.Duration // Error budget window
+	FastBurnRate float64       // At risk when burning this fast over 1h
+	SlowBurnRate float64       // At risk when burning this fast over 6h
+	Targets      []SLOTarget   // Defaults to DefaultSLOTargets
+}
+
+// DefaultSLOTargets track all API requests and all tasks
+var DefaultSLOTargets = []SLOTarget{
+	{Name: "api", Endpoint: "*", Availability: 99.9, Latency: time.Second, LatencyTarget: 99},
+	{Name: "tasks", TaskType: "*", Availability: 99},
+}
+
+// ValidateSLOTarget checks a target's selector and objectives, and fills in
+// the default latency target
+func ValidateSLOTarget(target *SLOTarget) error {
+	if target.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if (target.Endpoint == "") == (target.TaskType == "") {
+		return fmt.Errorf("SLO %s needs either an endpoint or a task type", target.Name)
+	}
+	if target.Availability == 0 && target.Latency == 0 {
+		return fmt.Errorf("SLO %s needs an availability or a latency objective", target.Name)
+	}
+	if target.Availability < 0 || target.Availability >= 100 {
+		return fmt.Errorf("SLO %s: availability must be below 100%%", target.Name)
+	}
+	if target.Latency < 0 {
+		return fmt.Errorf("SLO %s: latency must not be negative", target.Name)
+	}
+	if target.Latency > 0 && target.LatencyTarget == 0 {
+		target.LatencyTarget = 99
+	}
+	if target.LatencyTarget < 0 || target.LatencyTarget >= 100 {
+		return fmt.Errorf("SLO %s: latency target must be below 100%%", target.Name)
+	}
+	return nil
+}
+
+// matchesRequest reports whether an API target selects a request
+func (t *SLOTarget) matchesRequest(method, route string) bool {
+	switch {
+	case t.Endpoint == "":
+		return false
+	case t.Endpoint == "*":
+		return true
+	}
+	if m, pattern, ok := strings.Cut(t.Endpoint, " "); ok {
+		return strings.EqualFold(m, method) && pattern == route
+	}
+	return t.Endpoint == route
+}
+
+// SLOObjectiveReport is the state of one objective of a target
+type SLOObjectiveReport struct {
+	Target    string
+	Endpoint  string
+	TaskType  string
+	Objective string        // availability or latency
+	Goal      float64       // % that must be good
+	Latency   time.Duration // Latency objectives only
+
+	Total int64   // Requests or tasks in the window
+	Bad   int64   // Of which failed or were too slow
+	SLI   float64 // % good in the window (100 without any)
+
+	// BudgetRemaining is the % of the window's error budget left; negative
+	// once overspent
+	BudgetRemaining float64
+	// Burn rates: how many times faster than the budget allows errors
+	// happened over the last hour, six hours and the window
+	BurnRate1h     float64
+	BurnRate6h     float64
+	BurnRateWindow float64
+
+	Status string // ok, at_risk or exhausted
+}
+
+// SLOReport is the state of every SLO's error budget
+type SLOReport struct {
+	Window      time.Duration
+	Objectives  []*SLOObjectiveReport
+	GeneratedAt time.Time
+}
+
+// sloBucketKey identifies a target's pending request counts
+type sloBucketKey struct {
+	target string
+	bucket time.Time
+}
+
+// SLOService tracks API requests and tasks against service level
+// objectives. API request counts are kept in memory and written in buckets
+// every gateway adds to; task counts come from the task history.
+type SLOService struct {
+	store    storage.Store
+	eventBus events.EventBus
+	settings SLOSettings
+
+	mu      sync.Mutex
+	pending map[sloBucketKey]*storage.SLOCounts
+}
+
+// NewSLOService creates a new SLO service
+func NewSLOService(s storage.Store, settings SLOSettings) (*SLOService, error) {
+	if settings.Window <= 0 {
+		settings.Window = 30 * 24 * time.Hour
+	}
+	if settings.FastBurnRate <= 0 {
+		settings.FastBurnRate = 14.4
+	}
+	if settings.SlowBurnRate <= 0 {
+		settings.SlowBurnRate = 6
+	}
+	if len(settings.Targets) == 0 {
+		settings.Targets = DefaultSLOTargets
+	}
+
+	targets := make([]SLOTarget, len(settings.Targets))
+	names := make(map[string]bool)
+	for i, target := range settings.Targets {
+		if err := ValidateSLOTarget(&target); err != nil {
+			return nil, err
+		}
+		if names[target.Name] {
+			return nil, fmt.Errorf("duplicate SLO %s", target.Name)
+		}
+		names[target.Name] = true
+		targets[i] = target
+	}
+	settings.Targets = targets
+
+	return &SLOService{
+		store:    s,
+		settings: settings,
+		pending:  make(map[sloBucketKey]*storage.SLOCounts),
+	}, nil
+}
+
+// SetEventBus sets the event bus budget events are published on (optional)
+func (s *SLOService) SetEventBus(bus events.EventBus) {
+	s.eventBus = bus
+}
+
+// RecordRequest counts an API request against the targets selecting its
+// method and route pattern. Requests with a 5xx status failed.
+func (s *SLOService) RecordRequest(method, route string, status int, latency time.Duration) {
+	bucket := time.Now().UTC().Truncate(sloBucket)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.settings.Targets {
+		target := &s.settings.Targets[i]
+		if !target.matchesRequest(method, route) {
+			continue
+		}
+
+		key := sloBucketKey{target: target.Name, bucket: bucket}
+		counts := s.pending[key]
+		if counts == nil {
+			counts = &storage.SLOCounts{}
+			s.pending[key] = counts
+		}
+		counts.Total++
+		if status < 500 {
+			counts.Good++
+			if target.Latency == 0 || latency <= target.Latency {
+				counts.Fast++
+			}
+		}
+	}
+}
+
+// Flush writes the request counts kept in memory. Counts that fail to be
+// written are kept for the next flush.
+func (s *SLOService) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[sloBucketKey]*storage.SLOCounts)
+	s.mu.Unlock()
+
+	var errs []error
+	for key, counts := range pending {
+		if err := s.store.SLO().AddRequests(ctx, key.target, key.bucket, *counts); err != nil {
+			errs = append(errs, err)
+			s.mu.Lock()
+			if kept := s.pending[key]; kept != nil {
+				kept.Add(*counts)
+			} else {
+				s.pending[key] = counts
+			}
+			s.mu.Unlock()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Report computes every objective's error budget and burn rates. This
+// gateway's pending request counts are written first.
+func (s *SLOService) Report(ctx context.Context) (*SLOReport, error) {
+	if err := s.Flush(ctx); err != nil {
+		log.Printf("Warning: Failed to write SLO request counts: %v", err)
+	}
+
+	now := time.Now()
+	report := &SLOReport{Window: s.settings.Window, GeneratedAt: now}
+	for i := range s.settings.Targets {
+		target := &s.settings.Targets[i]
+
+		var windows [3]storage.SLOCounts // 1h, 6h, window
+		for j, since := range []time.Time{now.Add(-sloFastWindow), now.Add(-sloSlowWindow), now.Add(-s.settings.Window)} {
+			counts, err := s.count(ctx, target, since)
+			if err != nil {
+				return nil, fmt.Errorf("failed to count SLO %s: %w", target.Name, err)
+			}
+			windows[j] = counts
+		}
+
+		if target.Availability > 0 {
+			report.Objectives = append(report.Objectives, s.objective(target, SLOObjectiveAvailability, target.Availability, windows,
+				func(c storage.SLOCounts) int64 { return c.Total - c.Good }))
+		}
+		if target.Latency > 0 {
+			report.Objectives = append(report.Objectives, s.objective(target, SLOObjectiveLatency, target.LatencyTarget, windows,
+				func(c storage.SLOCounts) int64 { return c.Total - c.Fast }))
+		}
+	}
+
+	return report, nil
+}
+
+// count returns a target's counts since the given time
+func (s *SLOService) count(ctx context.Context, target *SLOTarget, since time.Time) (storage.SLOCounts, error) {
+	if target.TaskType == "" {
+		return s.store.SLO().CountRequests(ctx, target.Name, since)
+	}
+	taskType := target.TaskType
+	if taskType == "*" {
+		taskType = ""
+	}
+	return s.store.SLO().CountTasks(ctx, taskType, since, target.Latency)
+}
+
+// objective computes an objective's budget and burn rates from the counts
+// over the last hour, six hours and the window
+func (s *SLOService) objective(target *SLOTarget, objective string, goal float64, windows [3]storage.SLOCounts, bad func(storage.SLOCounts) int64) *SLOObjectiveReport {
+	allowed := 1 - goal/100
+	burnRate := func(c storage.SLOCounts) float64 {
+		if c.Total == 0 {
+			return 0
+		}
+		return float64(bad(c)) / float64(c.Total) / allowed
+	}
+
+	window := windows[2]
+	r := &SLOObjectiveReport{
+		Target:          target.Name,
+		Endpoint:        target.Endpoint,
+		TaskType:        target.TaskType,
+		Objective:       objective,
+		Goal:            goal,
+		Total:           window.Total,
+		Bad:             bad(window),
+		SLI:             100,
+		BudgetRemaining: 100,
+		BurnRate1h:      burnRate(windows[0]),
+		BurnRate6h:      burnRate(windows[1]),
+		BurnRateWindow:  burnRate(window),
+		Status:          SLOStatusOK,
+	}
+	if objective == SLOObjectiveLatency {
+		r.Latency = target.Latency
+	}
+	if r.Total > 0 {
+		r.SLI = float64(r.Total-r.Bad) / float64(r.Total) * 100
+		r.BudgetRemaining = (1 - r.BurnRateWindow) * 100
+	}
+
+	switch {
+	case r.Total > 0 && r.BudgetRemaining <= 0:
+		r.Status = SLOStatusExhausted
+	case r.BurnRate1h >= s.settings.FastBurnRate, r.BurnRate6h >= s.settings.SlowBurnRate:
+		r.Status = SLOStatusAtRisk
+	}
+	return r
+}
+
+// Run writes request counts, evaluates the error budgets and prunes request
+// counts past the window every interval until ctx is cancelled
+func (s *SLOService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Evaluate(ctx); err != nil {
+			log.Printf("Warning: Failed to evaluate SLOs: %v", err)
+		}
+		if _, err := s.store.SLO().DeleteRequestsBefore(ctx, time.Now().Add(-s.settings.Window-sloBucket)); err != nil {
+			log.Printf("Warning: Failed to prune SLO request counts: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			// Keep the last counts of a gateway shutting down
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			s.Flush(flushCtx)
+			cancel()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Evaluate reports the error budgets and emits an event for each objective
+// whose budget state changed
+func (s *SLOService) Evaluate(ctx context.Context) error {
+	report, err := s.Report(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, objective := range report.Objectives {
+		changed, previous, err := s.swapStatus(ctx, objective)
+		if err != nil {
+			log.Printf("Warning: Failed to record SLO %s %s state: %v", objective.Target, objective.Objective, err)
+			continue
+		}
+		if changed {
+			s.budgetEvent(ctx, objective, previous)
+		}
+	}
+
+	return nil
+}
+
+// swapStatus records an objective's budget state, reporting whether this
+// gateway changed it and what it was. Gateways race to record a change;
+// only the one that wins emits its event.
+func (s *SLOService) swapStatus(ctx context.Context, objective *SLOObjectiveReport) (bool, string, error) {
+	key := objective.Target + "/" + objective.Objective
+	entry := &storage.KVEntry{Namespace: sloKVNamespace, Key: key, Value: []byte(objective.Status)}
+
+	current, err := s.store.KV().Get(ctx, sloKVNamespace, key)
+	if errors.Is(err, storage.ErrKVNotFound) {
+		if objective.Status == SLOStatusOK {
+			return false, SLOStatusOK, nil // Nothing to recover from
+		}
+		set, err := s.store.KV().SetIfAbsent(ctx, entry, s.settings.Window)
+		return set, SLOStatusOK, err
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	previous := string(current.Value)
+	if previous == objective.Status {
+		return false, previous, nil
+	}
+	entry.Version = current.Version
+	swapped, err := s.store.KV().CompareAndSwap(ctx, entry, s.settings.Window)
+	return swapped, previous, err
+}
+
+// budgetEvent records an objective's budget state change in the cluster
+// timeline and publishes it on the event bus
+func (s *SLOService) budgetEvent(ctx context.Context, objective *SLOObjectiveReport, previous string) {
+	topic, severity := events.TopicSLOBudgetAtRisk, "warning"
+	switch objective.Status {
+	case SLOStatusExhausted:
+		topic, severity = events.TopicSLOBudgetExhausted, "error"
+	case SLOStatusOK:
+		topic, severity = events.TopicSLOBudgetRecovered, "info"
+	}
+
+	message := fmt.Sprintf("SLO %s %s error budget is %s: %.1f%% left, burning %.1fx over 1h and %.1fx over 6h",
+		objective.Target, objective.Objective, strings.ReplaceAll(objective.Status, "_", " "),
+		objective.BudgetRemaining, objective.BurnRate1h, objective.BurnRate6h)
+
+	data := map[string]interface{}{
+		"target":           objective.Target,
+		"objective":        objective.Objective,
+		"status":           objective.Status,
+		"previous_status":  previous,
+		"goal":             objective.Goal,
+		"sli":              objective.SLI,
+		"budget_remaining": objective.BudgetRemaining,
+		"burn_rate_1h":     objective.BurnRate1h,
+		"burn_rate_6h":     objective.BurnRate6h,
+	}
+
+	event := &storage.ClusterEvent{
+		ID:           uuid.New(),
+		Type:         topic,
+		Severity:     severity,
+		ResourceType: "slo",
+		ResourceID:   objective.Target,
+		Message:      message,
+		Data:         data,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.store.ClusterEvents().Create(ctx, event); err != nil {
+		log.Printf("Warning: Failed to record %s event: %v", topic, err)
+	}
+
+	if s.eventBus != nil {
+		busEvent := &types.Event{
+			ID:        event.ID.String(),
+			Type:      topic,
+			Timestamp: event.CreatedAt,
+			Data:      data,
+		}
+		if err := s.eventBus.Publish(ctx, topic, busEvent); err != nil {
+			log.Printf("Warning: Failed to publish %s event: %v", topic, err)
+		}
+	}
+}
@@ -2,10 +2,12 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"time"
 
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
 	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/scheduler"
 	"github.com/aetherium/aetherium/services/core/pkg/storage"
 	"github.com/google/uuid"
 )
@@ -14,6 +16,12 @@ import (
 type TaskService struct {
 	queue queue.Queue
 	store storage.Store
+
+	// schedulingStrategy places new VMs on workers ("" = shared queues)
+	schedulingStrategy string
+
+	// eventBus wakes WaitForTask on task progress (optional)
+	eventBus events.EventBus
 }
 
 // NewTaskService creates a new task service
@@ -24,6 +32,18 @@ func NewTaskService(q queue.Queue, s storage.Store) *TaskService {
 	}
 }
 
+// SetSchedulingStrategy sets the scheduling strategy placing new VMs on
+// workers ("" = none: any worker may take them from the shared queues)
+func (s *TaskService) SetSchedulingStrategy(strategy string) error {
+	if strategy != "" {
+		if _, err := scheduler.Lookup(strategy); err != nil {
+			return err
+		}
+	}
+	s.schedulingStrategy = strategy
+	return nil
+}
+
 // CreateVMTask submits a VM creation task
 func (s *TaskService) CreateVMTask(ctx context.Context, name string, vcpus, memoryMB int) (uuid.UUID, error) {
 	return s.CreateVMTaskWithTools(ctx, name, vcpus, memoryMB, nil, nil)
@@ -31,57 +51,121 @@ func (s *TaskService) CreateVMTask(ctx context.Context, name string, vcpus, memo
 
 // CreateVMTaskWithTools submits a VM creation task with additional tools
 func (s *TaskService) CreateVMTaskWithTools(ctx context.Context, name string, vcpus, memoryMB int, additionalTools []string, toolVersions map[string]string) (uuid.UUID, error) {
-	payload := map[string]interface{}{
-		"name":      name,
-		"vcpus":     vcpus,
-		"memory_mb": memoryMB,
+	return s.CreateVMTaskWithOptions(ctx, name, vcpus, memoryMB, &VMCreateOptions{
+		AdditionalTools: additionalTools,
+		ToolVersions:    toolVersions,
+	})
+}
+
+// VMCreateOptions holds optional settings for VM creation tasks
+type VMCreateOptions struct {
+	AdditionalTools []string
+	ToolVersions    map[string]string
+	// Sandbox profile applied at boot
+	Sandbox *storage.SandboxProfile
+	// Project used to pick the VM's garbage collection policy
+	Project string
+}
+
+// CreateVMTaskWithOptions submits a VM creation task with creation options
+func (s *TaskService) CreateVMTaskWithOptions(ctx context.Context, name string, vcpus, memoryMB int, opts *VMCreateOptions) (uuid.UUID, error) {
+	if opts == nil {
+		opts = &VMCreateOptions{}
+	}
+
+	task, err := queue.NewTask(queue.TaskTypeVMCreate, &queue.VMCreatePayload{
+		Name:            name,
+		VCPUs:           vcpus,
+		MemoryMB:        memoryMB,
+		AdditionalTools: opts.AdditionalTools,
+		ToolVersions:    opts.ToolVersions,
+		Sandbox:         opts.Sandbox,
+		Project:         opts.Project,
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// VM names are unique, so a second request for the same name is a duplicate
+	taskOpts := &queue.TaskOptions{
+		Queue:     "default",
+		Priority:  5,
+		UniqueKey: name,
 	}
+	if queueName := scheduleQueue(ctx, s.store, s.schedulingStrategy, &scheduler.Request{VCPUs: vcpus, MemoryMB: memoryMB}); queueName != "" {
+		taskOpts.Queue = queueName
+		taskOpts.Priority = 0
+	}
+	if err := s.queue.Enqueue(ctx, task, taskOpts); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to enqueue VM creation task: %w", err)
+	}
+
+	return task.ID, nil
+}
+
+// ExecuteOptions holds optional settings for command execution tasks
+type ExecuteOptions struct {
+	// Cache allows the worker to return a cached result for an identical execution
+	Cache bool
+	// CacheImage identifies the VM image for cache keying (defaults to the VM ID)
+	CacheImage string
+	// InputsHash is a caller-supplied hash of any inputs the command depends on
+	InputsHash string
+}
+
+// ExecuteCommandTask submits a command execution task
+func (s *TaskService) ExecuteCommandTask(ctx context.Context, vmID, command string, args []string) (uuid.UUID, error) {
+	return s.ExecuteCommandTaskWithOptions(ctx, vmID, command, args, nil)
+}
 
-	if len(additionalTools) > 0 {
-		payload["additional_tools"] = additionalTools
+// ExecuteCommandTaskWithOptions submits a command execution task with execution options
+func (s *TaskService) ExecuteCommandTaskWithOptions(ctx context.Context, vmID, command string, args []string, opts *ExecuteOptions) (uuid.UUID, error) {
+	payload := &queue.VMExecutePayload{
+		VMID:    vmID,
+		Command: command,
+		Args:    args,
 	}
 
-	if len(toolVersions) > 0 {
-		payload["tool_versions"] = toolVersions
+	if opts != nil && opts.Cache {
+		payload.Cache = true
+		payload.CacheImage = opts.CacheImage
+		payload.InputsHash = opts.InputsHash
 	}
 
-	task := &queue.Task{
-		ID:      uuid.New(),
-		Type:    queue.TaskTypeVMCreate,
-		Payload: payload,
+	task, err := queue.NewTask(queue.TaskTypeVMExecute, payload)
+	if err != nil {
+		return uuid.Nil, err
 	}
 
 	if err := s.queue.Enqueue(ctx, task, &queue.TaskOptions{
-		MaxRetry: 3,
-		Timeout:  25 * time.Minute, // Increased for tool installation
 		Queue:    "default",
 		Priority: 5,
 	}); err != nil {
-		return uuid.Nil, fmt.Errorf("failed to enqueue VM creation task: %w", err)
+		return uuid.Nil, fmt.Errorf("failed to enqueue execution task: %w", err)
 	}
 
 	return task.ID, nil
 }
 
-// ExecuteCommandTask submits a command execution task
-func (s *TaskService) ExecuteCommandTask(ctx context.Context, vmID, command string, args []string) (uuid.UUID, error) {
-	task := &queue.Task{
-		ID:   uuid.New(),
-		Type: queue.TaskTypeVMExecute,
-		Payload: map[string]interface{}{
-			"vm_id":   vmID,
-			"command": command,
-			"args":    args,
-		},
+// RunContainerTask submits a command to run in a throwaway container of the
+// given image. It goes to the docker capability queue, so only workers with
+// the Docker backend pick it up.
+func (s *TaskService) RunContainerTask(ctx context.Context, image, command string, args []string, sandbox *storage.SandboxProfile) (uuid.UUID, error) {
+	task, err := queue.NewTask(queue.TaskTypeContainerRun, &queue.ContainerRunPayload{
+		Image:   image,
+		Command: command,
+		Args:    args,
+		Sandbox: sandbox,
+	})
+	if err != nil {
+		return uuid.Nil, err
 	}
 
 	if err := s.queue.Enqueue(ctx, task, &queue.TaskOptions{
-		MaxRetry: 2,
-		Timeout:  10 * time.Minute,
-		Queue:    "default",
+		Queue:    queue.CapabilityQueue("docker"),
 		Priority: 5,
 	}); err != nil {
-		return uuid.Nil, fmt.Errorf("failed to enqueue execution task: %w", err)
+		return uuid.Nil, fmt.Errorf("failed to enqueue container task: %w", err)
 	}
 
 	return task.ID, nil
@@ -89,19 +173,15 @@ func (s *TaskService) ExecuteCommandTask(ctx context.Context, vmID, command stri
 
 // DeleteVMTask submits a VM deletion task
 func (s *TaskService) DeleteVMTask(ctx context.Context, vmID string) (uuid.UUID, error) {
-	task := &queue.Task{
-		ID:   uuid.New(),
-		Type: queue.TaskTypeVMDelete,
-		Payload: map[string]interface{}{
-			"vm_id": vmID,
-		},
+	task, err := queue.NewTask(queue.TaskTypeVMDelete, &queue.VMDeletePayload{VMID: vmID})
+	if err != nil {
+		return uuid.Nil, err
 	}
 
 	if err := s.queue.Enqueue(ctx, task, &queue.TaskOptions{
-		MaxRetry: 2,
-		Timeout:  2 * time.Minute,
-		Queue:    "default",
-		Priority: 5,
+		Queue:     "default",
+		Priority:  5,
+		UniqueKey: vmID,
 	}); err != nil {
 		return uuid.Nil, fmt.Errorf("failed to enqueue deletion task: %w", err)
 	}
@@ -109,6 +189,18 @@ func (s *TaskService) DeleteVMTask(ctx context.Context, vmID string) (uuid.UUID,
 	return task.ID, nil
 }
 
+// ErrQueueInspectionUnsupported is returned when the task queue can't report per-queue state
+var ErrQueueInspectionUnsupported = errors.New("task queue does not support inspection")
+
+// GetQueueOverview returns the state of the task queues and their consumers
+func (s *TaskService) GetQueueOverview(ctx context.Context) (*queue.Overview, error) {
+	inspector, ok := s.queue.(queue.Inspector)
+	if !ok {
+		return nil, ErrQueueInspectionUnsupported
+	}
+	return inspector.Inspect(ctx)
+}
+
 // GetVM retrieves VM information from storage
 func (s *TaskService) GetVM(ctx context.Context, vmID uuid.UUID) (*storage.VM, error) {
 	return s.store.VMs().Get(ctx, vmID)
@@ -128,3 +220,37 @@ func (s *TaskService) ListVMs(ctx context.Context) ([]*storage.VM, error) {
 func (s *TaskService) GetExecutions(ctx context.Context, vmID uuid.UUID) ([]*storage.Execution, error) {
 	return s.store.Executions().ListByVM(ctx, vmID)
 }
+
+// GetTask retrieves a task from the task history
+func (s *TaskService) GetTask(ctx context.Context, taskID uuid.UUID) (*storage.Task, error) {
+	return s.store.Tasks().Get(ctx, taskID)
+}
+
+// ListTasks lists tasks of a type and status ("" = any), newest first
+func (s *TaskService) ListTasks(ctx context.Context, taskType, status string, limit int) ([]*storage.Task, error) {
+	filters := map[string]interface{}{"limit": limit}
+	if taskType != "" {
+		filters["type"] = taskType
+	}
+	if status != "" {
+		filters["status"] = status
+	}
+	return s.store.Tasks().List(ctx, filters)
+}
+
+// ListVMTasks lists the tasks that acted on a VM, newest first. The history
+// outlives the VM.
+func (s *TaskService) ListVMTasks(ctx context.Context, vmID uuid.UUID, limit int) ([]*storage.Task, error) {
+	return s.store.Tasks().ListByVM(ctx, vmID, limit)
+}
+
+// ListWorkspaceTasks lists the tasks that acted on a workspace, newest
+// first. The history outlives the workspace.
+func (s *TaskService) ListWorkspaceTasks(ctx context.Context, workspaceID uuid.UUID, limit int) ([]*storage.Task, error) {
+	return s.store.Tasks().ListByWorkspace(ctx, workspaceID, limit)
+}
+
+// GetExecutionByTask retrieves the execution produced by a command task
+func (s *TaskService) GetExecutionByTask(ctx context.Context, taskID uuid.UUID) (*storage.Execution, error) {
+	return s.store.Executions().GetByTaskID(ctx, taskID)
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// How often WaitForTask re-reads the task history
+const (
+	taskWaitPollInterval  = 1 * time.Second // Without an event bus
+	taskWaitCheckInterval = 5 * time.Second // With one, in case progress events were missed
+)
+
+// ErrTaskWaitTimeout is returned by WaitForTask when the task doesn't finish
+// in time
+var ErrTaskWaitTimeout = errors.New("timed out waiting for task")
+
+// SetEventBus lets WaitForTask wake on the state transitions workers publish
+// (see events.TaskProgressTopic) instead of polling the task history
+func (s *TaskService) SetEventBus(bus events.EventBus) {
+	s.eventBus = bus
+}
+
+// WaitForTask waits until a task completes or fails and returns it as
+// recorded in the task history. Retried attempts are waited for. Returns
+// ErrTaskWaitTimeout if the task is still unfinished after timeout, or ctx's
+// error if ctx ends first.
+func (s *TaskService) WaitForTask(ctx context.Context, taskID uuid.UUID, timeout time.Duration) (*storage.Task, error) {
+	// The task's row was written just before it was enqueued
+	ctx = storage.WithPrimaryReads(ctx)
+
+	// Subscribe before the first read, so no transition falls in between
+	wake := make(chan struct{}, 1)
+	interval := taskWaitPollInterval
+	if s.eventBus != nil {
+		topic := events.TaskProgressTopic(taskID.String())
+		subID, err := s.eventBus.Subscribe(ctx, topic, func(_ context.Context, event *types.Event) error {
+			if event.Data["kind"] == events.TaskProgressState {
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Warning: Failed to subscribe to progress of task %s, polling: %v", taskID, err)
+		} else {
+			defer s.eventBus.Unsubscribe(context.Background(), topic, subID)
+			interval = taskWaitCheckInterval
+		}
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	check := time.NewTicker(interval)
+	defer check.Stop()
+
+	for {
+		task, err := s.store.Tasks().Get(ctx, taskID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		switch task.Status {
+		case storage.TaskStatusCompleted, storage.TaskStatusFailed:
+			return task, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline.C:
+			return nil, ErrTaskWaitTimeout
+		case <-wake:
+		case <-check.C:
+		}
+	}
+}
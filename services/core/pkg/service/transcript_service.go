@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/transcript"
+	"github.com/google/uuid"
+)
+
+// transcriptPage is how many entries verification reads at a time
+const transcriptPage = 1000
+
+// TranscriptRecordIssue is a chained record that no longer matches its
+// latest entry
+type TranscriptRecordIssue struct {
+	Kind     string
+	RecordID uuid.UUID
+	Seq      int64  // Latest entry of the record
+	Reason   string // "modified" or why the record couldn't be checked
+}
+
+// TranscriptVerification is the outcome of verifying the transcript chain
+type TranscriptVerification struct {
+	Valid    bool
+	Entries  int64 // Entries verified
+	HeadSeq  int64
+	HeadHash string
+	// Break is where the chain's links stop verifying, if they do
+	Break *transcript.Break
+	// Anchors checked against the chain, and those that don't match it
+	Anchors         int
+	AnchorMismatch  []int64
+	ModifiedRecords []TranscriptRecordIssue
+	// Records deleted since they were chained, e.g. with their workspace.
+	// Deleting records is allowed; their entries keep the chain intact.
+	MissingRecords int
+	// Prompts being retried since they were chained
+	InProgressRecords int
+	VerifiedAt        time.Time
+}
+
+// TranscriptService verifies and anchors the transcript chain that stores
+// with TranscriptChain enabled keep over executions and finished prompts
+type TranscriptService struct {
+	store    storage.Store
+	eventBus events.EventBus
+}
+
+// NewTranscriptService creates a new transcript service
+func NewTranscriptService(s storage.Store) *TranscriptService {
+	return &TranscriptService{store: s}
+}
+
+// SetEventBus sets the event bus anchors and failed verifications are
+// published on (optional)
+func (s *TranscriptService) SetEventBus(bus events.EventBus) {
+	s.eventBus = bus
+}
+
+// ListEntries lists the chain's entries after afterSeq, or a record's
+// entries when recordID is set
+func (s *TranscriptService) ListEntries(ctx context.Context, recordID *uuid.UUID, afterSeq int64, limit int) ([]*storage.TranscriptEntry, error) {
+	if recordID != nil {
+		return s.store.Transcripts().ListByRecord(ctx, *recordID)
+	}
+	return s.store.Transcripts().List(ctx, afterSeq, limit)
+}
+
+// Verify walks the whole chain: each entry must follow the one before and
+// hash to its hash, each anchor must match the entry it anchored, and each
+// record that still exists must match the content hash of its latest entry.
+// A failed verification is recorded as a cluster event.
+func (s *TranscriptService) Verify(ctx context.Context) (*TranscriptVerification, error) {
+	ctx = storage.WithPrimaryReads(ctx)
+
+	anchors, err := s.store.Transcripts().ListAnchors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	anchored := make(map[int64]string, len(anchors))
+	for _, anchor := range anchors {
+		anchored[anchor.Seq] = anchor.Hash
+	}
+
+	result := &TranscriptVerification{Anchors: len(anchors), VerifiedAt: time.Now()}
+	latest := make(map[uuid.UUID]*storage.TranscriptEntry)
+	var verifier transcript.Verifier
+
+walk:
+	for {
+		var after int64
+		if head := verifier.Head(); head != nil {
+			after = head.Seq
+		}
+		entries, err := s.store.Transcripts().List(ctx, after, transcriptPage)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if err := verifier.Next(entry); err != nil {
+				errors.As(err, &result.Break)
+				break walk
+			}
+			result.Entries++
+			latest[entry.RecordID] = entry
+			if hash, ok := anchored[entry.Seq]; ok && hash != entry.Hash {
+				result.AnchorMismatch = append(result.AnchorMismatch, entry.Seq)
+			}
+		}
+		if len(entries) < transcriptPage {
+			break
+		}
+	}
+
+	if head := verifier.Head(); head != nil {
+		result.HeadSeq, result.HeadHash = head.Seq, head.Hash
+	}
+	if result.Break == nil {
+		// Anchors past the head mean entries were removed from the end
+		for _, anchor := range anchors {
+			if anchor.Seq > result.HeadSeq {
+				result.AnchorMismatch = append(result.AnchorMismatch, anchor.Seq)
+			}
+		}
+	}
+
+	for _, entry := range latest {
+		s.checkRecord(ctx, entry, result)
+	}
+
+	result.Valid = result.Break == nil && len(result.AnchorMismatch) == 0 && len(result.ModifiedRecords) == 0
+	if !result.Valid {
+		s.verificationFailed(ctx, result)
+	}
+	return result, nil
+}
+
+// checkRecord compares a record with the content hash of its latest entry
+func (s *TranscriptService) checkRecord(ctx context.Context, entry *storage.TranscriptEntry, result *TranscriptVerification) {
+	var hash string
+	var err error
+	switch entry.Kind {
+	case storage.TranscriptKindExecution:
+		var execution *storage.Execution
+		if execution, err = s.store.Executions().Get(ctx, entry.RecordID); err == nil {
+			hash, err = transcript.ExecutionHash(execution)
+		}
+	case storage.TranscriptKindPrompt:
+		var prompt *storage.PromptTask
+		if prompt, err = s.store.PromptTasks().Get(ctx, entry.RecordID); err == nil {
+			if !storage.IsTerminalPromptStatus(prompt.Status) {
+				result.InProgressRecords++
+				return
+			}
+			hash, err = transcript.PromptHash(prompt)
+		}
+	default:
+		err = fmt.Errorf("unknown record kind %q", entry.Kind)
+	}
+
+	switch {
+	case err != nil && strings.Contains(err.Error(), "not found"):
+		result.MissingRecords++
+	case err != nil:
+		result.ModifiedRecords = append(result.ModifiedRecords, TranscriptRecordIssue{
+			Kind: entry.Kind, RecordID: entry.RecordID, Seq: entry.Seq, Reason: err.Error(),
+		})
+	case hash != entry.ContentHash:
+		result.ModifiedRecords = append(result.ModifiedRecords, TranscriptRecordIssue{
+			Kind: entry.Kind, RecordID: entry.RecordID, Seq: entry.Seq, Reason: "modified",
+		})
+	}
+}
+
+// Anchor records the chain's head as an anchor and publishes it, unless
+// it was anchored already. Subscribers keeping anchors outside the database
+// can later prove the chain up to the head wasn't rewritten.
+func (s *TranscriptService) Anchor(ctx context.Context) (*storage.TranscriptAnchor, error) {
+	head, err := s.store.Transcripts().Head(storage.WithPrimaryReads(ctx))
+	if err != nil || head == nil {
+		return nil, err
+	}
+
+	anchor := &storage.TranscriptAnchor{Seq: head.Seq, Hash: head.Hash, CreatedAt: time.Now()}
+	created, err := s.store.Transcripts().Anchor(ctx, anchor)
+	if err != nil || !created {
+		return nil, err
+	}
+
+	s.event(ctx, events.TopicTranscriptAnchored, "info",
+		fmt.Sprintf("Transcript chain anchored at entry %d: %s", anchor.Seq, anchor.Hash),
+		map[string]interface{}{"seq": anchor.Seq, "hash": anchor.Hash})
+	return anchor, nil
+}
+
+// Run anchors the chain's head every interval until ctx is cancelled
+func (s *TranscriptService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Anchor(ctx); err != nil {
+			log.Printf("Warning: Failed to anchor transcript chain: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// verificationFailed records what a failed verification found
+func (s *TranscriptService) verificationFailed(ctx context.Context, result *TranscriptVerification) {
+	var problems []string
+	if result.Break != nil {
+		problems = append(problems, result.Break.Error())
+	}
+	if len(result.AnchorMismatch) > 0 {
+		problems = append(problems, fmt.Sprintf("%d anchors don't match the chain", len(result.AnchorMismatch)))
+	}
+	if len(result.ModifiedRecords) > 0 {
+		problems = append(problems, fmt.Sprintf("%d records were modified", len(result.ModifiedRecords)))
+	}
+
+	s.event(ctx, events.TopicTranscriptVerificationFailed, "error",
+		"Transcript verification failed: "+strings.Join(problems, "; "),
+		map[string]interface{}{
+			"entries":          result.Entries,
+			"anchor_mismatch":  result.AnchorMismatch,
+			"modified_records": len(result.ModifiedRecords),
+			"problems":         problems,
+		})
+}
+
+// event records a transcript event in the cluster timeline and publishes it
+// on the event bus
+func (s *TranscriptService) event(ctx context.Context, topic, severity, message string, data map[string]interface{}) {
+	event := &storage.ClusterEvent{
+		ID:           uuid.New(),
+		Type:         topic,
+		Severity:     severity,
+		ResourceType: "transcript",
+		Message:      message,
+		Data:         data,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.store.ClusterEvents().Create(ctx, event); err != nil {
+		log.Printf("Warning: Failed to record %s event: %v", topic, err)
+	}
+
+	if s.eventBus != nil {
+		busEvent := &types.Event{
+			ID:        event.ID.String(),
+			Type:      topic,
+			Timestamp: event.CreatedAt,
+			Data:      data,
+		}
+		if err := s.eventBus.Publish(ctx, topic, busEvent); err != nil {
+			log.Printf("Warning: Failed to publish %s event: %v", topic, err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/scheduler"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+// workerVersionsTTL is how long the payload versions of the workers are
+// cached between enqueues
+const workerVersionsTTL = 15 * time.Second
+
+// VersionedQueue negotiates task payload versions for a gateway whose
+// workers may run another release, as during a rolling upgrade: each task
+// is written at the highest version the workers that may run it read (see
+// queue.NegotiatePayloadVersion). Tasks routed to a worker's own queue are
+// negotiated with that worker alone.
+type VersionedQueue struct {
+	queue.Queue
+	store storage.Store
+
+	mu       sync.Mutex
+	workers  map[string]queue.PayloadVersionRange // Live workers, by ID
+	loadedAt time.Time
+}
+
+// NewVersionedQueue wraps q for the gateway
+func NewVersionedQueue(q queue.Queue, store storage.Store) *VersionedQueue {
+	return &VersionedQueue{Queue: q, store: store}
+}
+
+// Enqueue writes the task at the negotiated version. If the workers' versions
+// can't be read, the task keeps this release's version.
+func (q *VersionedQueue) Enqueue(ctx context.Context, task *queue.Task, opts *queue.TaskOptions) error {
+	workers, err := q.liveWorkers(ctx)
+	if err != nil {
+		log.Printf("Warning: Not negotiating payload version of %s task: %v", task.Type, err)
+		return q.Queue.Enqueue(ctx, task, opts)
+	}
+
+	var candidates []queue.PayloadVersionRange
+	if opts != nil && strings.HasPrefix(opts.Queue, queue.WorkerQueue("")) {
+		if r, ok := workers[strings.TrimPrefix(opts.Queue, queue.WorkerQueue(""))]; ok {
+			candidates = append(candidates, r)
+		}
+	} else {
+		for _, r := range workers {
+			candidates = append(candidates, r)
+		}
+	}
+
+	version, err := queue.NegotiatePayloadVersion(candidates)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue %s task: %w", task.Type, err)
+	}
+	if err := queue.DowngradeTask(task, version); err != nil {
+		return fmt.Errorf("failed to enqueue %s task: %w", task.Type, err)
+	}
+
+	return q.Queue.Enqueue(ctx, task, opts)
+}
+
+// Inspect passes through to the wrapped queue
+func (q *VersionedQueue) Inspect(ctx context.Context) (*queue.Overview, error) {
+	inspector, ok := q.Queue.(queue.Inspector)
+	if !ok {
+		return nil, ErrQueueInspectionUnsupported
+	}
+	return inspector.Inspect(ctx)
+}
+
+// liveWorkers returns the payload versions of the workers that have sent a
+// heartbeat recently
+func (q *VersionedQueue) liveWorkers(ctx context.Context) (map[string]queue.PayloadVersionRange, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.workers != nil && time.Since(q.loadedAt) < workerVersionsTTL {
+		return q.workers, nil
+	}
+
+	workers, err := q.store.Workers().List(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workers: %w", err)
+	}
+
+	live := make(map[string]queue.PayloadVersionRange, len(workers))
+	for _, w := range workers {
+		if time.Since(w.LastSeen) > scheduler.HeartbeatTimeout {
+			continue
+		}
+		live[w.ID] = queue.WorkerPayloadVersions(w.Metadata)
+	}
+	q.workers = live
+	q.loadedAt = time.Now()
+
+	return live, nil
+}
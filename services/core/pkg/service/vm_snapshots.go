@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrVMSnapshotNotFound is returned for VMs and snapshots that don't exist
+	ErrVMSnapshotNotFound = errors.New("not found")
+	// ErrVMSnapshotConflict is returned when the VM or snapshot isn't in a
+	// state to snapshot or restore, or the VM's worker can't snapshot VMs
+	ErrVMSnapshotConflict = errors.New("conflict")
+)
+
+// snapshotCapability is the worker capability needed to snapshot VMs
+const snapshotCapability = "firecracker"
+
+// SnapshotVM records a new snapshot of a running VM and enqueues a
+// vm:snapshot task on the VM's worker to take it. The snapshot is pending
+// until the task finishes.
+func (s *TaskService) SnapshotVM(ctx context.Context, vmID uuid.UUID, name string) (*storage.VMSnapshot, uuid.UUID, error) {
+	vm, err := s.snapshotTarget(ctx, vmID)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	if vm.Status != string(types.VMStatusRunning) {
+		return nil, uuid.Nil, fmt.Errorf("%w: VM %s is %s, only running VMs can be snapshotted", ErrVMSnapshotConflict, vmID, vm.Status)
+	}
+
+	now := time.Now()
+	if name == "" {
+		name = "snapshot-" + now.UTC().Format("20060102-150405")
+	}
+	snapshot := &storage.VMSnapshot{
+		ID:        uuid.New(),
+		VMID:      vmID,
+		WorkerID:  vm.WorkerID,
+		Name:      name,
+		Status:    storage.VMSnapshotStatusPending,
+		CreatedAt: now,
+	}
+	if err := s.store.VMSnapshots().Create(ctx, snapshot); err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	taskID, err := s.enqueueSnapshotTask(ctx, queue.TaskTypeVMSnapshot, vm, snapshot.ID)
+	if err != nil {
+		s.store.VMSnapshots().Fail(ctx, snapshot.ID, err.Error())
+		return nil, uuid.Nil, err
+	}
+
+	return snapshot, taskID, nil
+}
+
+// RestoreVM enqueues a vm:restore task returning a running or paused VM to
+// one of its ready snapshots
+func (s *TaskService) RestoreVM(ctx context.Context, vmID, snapshotID uuid.UUID) (uuid.UUID, error) {
+	vm, err := s.snapshotTarget(ctx, vmID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if vm.Status != string(types.VMStatusRunning) && vm.Status != string(types.VMStatusPaused) {
+		return uuid.Nil, fmt.Errorf("%w: VM %s is %s, only running or paused VMs can be restored", ErrVMSnapshotConflict, vmID, vm.Status)
+	}
+
+	snapshot, err := s.store.VMSnapshots().Get(ctx, snapshotID)
+	if err != nil || snapshot.VMID != vmID {
+		return uuid.Nil, fmt.Errorf("%w: snapshot %s of VM %s", ErrVMSnapshotNotFound, snapshotID, vmID)
+	}
+	if snapshot.Status != storage.VMSnapshotStatusReady {
+		return uuid.Nil, fmt.Errorf("%w: snapshot %s is %s", ErrVMSnapshotConflict, snapshotID, snapshot.Status)
+	}
+	// The snapshot's files stay on the worker that took it
+	if snapshot.WorkerID != nil && (vm.WorkerID == nil || *vm.WorkerID != *snapshot.WorkerID) {
+		return uuid.Nil, fmt.Errorf("%w: snapshot %s is on worker %s, which no longer hosts the VM", ErrVMSnapshotConflict, snapshotID, *snapshot.WorkerID)
+	}
+
+	return s.enqueueSnapshotTask(ctx, queue.TaskTypeVMRestore, vm, snapshotID)
+}
+
+// ListVMSnapshots returns a VM's snapshots, newest first
+func (s *TaskService) ListVMSnapshots(ctx context.Context, vmID uuid.UUID) ([]*storage.VMSnapshot, error) {
+	if _, err := s.store.VMs().Get(ctx, vmID); err != nil {
+		return nil, fmt.Errorf("%w: VM %s", ErrVMSnapshotNotFound, vmID)
+	}
+	return s.store.VMSnapshots().ListByVM(ctx, vmID)
+}
+
+// snapshotTarget loads a VM to snapshot or restore, checking that its
+// worker can snapshot VMs
+func (s *TaskService) snapshotTarget(ctx context.Context, vmID uuid.UUID) (*storage.VM, error) {
+	vm, err := s.store.VMs().Get(ctx, vmID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: VM %s", ErrVMSnapshotNotFound, vmID)
+	}
+	if vm.WorkerID == nil {
+		return vm, nil
+	}
+
+	worker, err := s.store.Workers().Get(ctx, *vm.WorkerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worker %s of VM %s: %w", *vm.WorkerID, vmID, err)
+	}
+	for _, capability := range worker.Capabilities {
+		if capability == snapshotCapability {
+			return vm, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: worker %s of VM %s can't snapshot VMs, only firecracker workers can", ErrVMSnapshotConflict, worker.ID, vmID)
+}
+
+// enqueueSnapshotTask enqueues a vm:snapshot or vm:restore task on the
+// queue of the VM's worker. Only one of each may be queued per VM.
+func (s *TaskService) enqueueSnapshotTask(ctx context.Context, taskType queue.TaskType, vm *storage.VM, snapshotID uuid.UUID) (uuid.UUID, error) {
+	task, err := queue.NewTask(taskType, &queue.VMSnapshotPayload{
+		VMID:       vm.ID.String(),
+		SnapshotID: snapshotID.String(),
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	queueName := "default"
+	if vm.WorkerID != nil {
+		queueName = queue.WorkerQueue(*vm.WorkerID)
+	}
+	if err := s.queue.Enqueue(ctx, task, &queue.TaskOptions{
+		Queue:     queueName,
+		UniqueKey: vm.ID.String(),
+	}); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to enqueue %s task: %w", taskType, err)
+	}
+
+	return task.ID, nil
+}
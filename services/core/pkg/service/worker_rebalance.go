@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+)
+
+// Rebalancing defaults
+const (
+	DefaultRebalanceMaxMoves  = 10
+	DefaultRebalanceThreshold = 20.0 // Load difference in percentage points
+)
+
+// RebalanceOptions configures a cluster rebalance
+type RebalanceOptions struct {
+	DryRun    bool    `json:"dry_run"`
+	MaxMoves  int     `json:"max_moves"` // Maximum workspaces to move (default 10)
+	Threshold float64 `json:"threshold"` // Minimum load difference between two workers, in percentage points (default 20)
+}
+
+// WorkerLoad is a worker's load as seen by the rebalancer. LoadPercent is the
+// higher of its VM slot and memory usage.
+type WorkerLoad struct {
+	WorkerID     string  `json:"worker_id"`
+	Hostname     string  `json:"hostname"`
+	VMCount      int     `json:"vm_count"`
+	MaxVMs       int     `json:"max_vms"`
+	UsedMemoryMB int64   `json:"used_memory_mb"`
+	MemoryMB     int64   `json:"memory_mb"`
+	LoadPercent  float64 `json:"load_percent"`
+
+	capabilities []string
+}
+
+// RebalanceMove moves one idle workspace VM between workers. TaskID and
+// Error are set once the move has been submitted.
+type RebalanceMove struct {
+	WorkspaceID   string `json:"workspace_id"`
+	WorkspaceName string `json:"workspace_name"`
+	VMID          string `json:"vm_id"`
+	MemoryMB      int    `json:"memory_mb"`
+	FromWorkerID  string `json:"from_worker_id"`
+	ToWorkerID    string `json:"to_worker_id"`
+	TaskID        string `json:"task_id,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// RebalancePlan is the outcome of a rebalance: the moves and the expected
+// load of each worker before and after them
+type RebalancePlan struct {
+	DryRun bool             `json:"dry_run"`
+	Moves  []*RebalanceMove `json:"moves"`
+	Before []*WorkerLoad    `json:"before"`
+	After  []*WorkerLoad    `json:"after"`
+}
+
+// Rebalance plans moving idle workspace VMs from the most loaded active
+// workers to the least loaded ones and, unless opts.DryRun is set, submits
+// the moves. Each move runs as a workspace:relocate task on the worker
+// hosting the VM, which discards it and recreates the workspace on the
+// target worker. Only ready workspaces with no prompt running are moved;
+// workspaces backed by an environment are skipped since they respawn their
+// VMs on demand.
+func (s *WorkerService) Rebalance(ctx context.Context, opts RebalanceOptions) (*RebalancePlan, error) {
+	if opts.MaxMoves <= 0 {
+		opts.MaxMoves = DefaultRebalanceMaxMoves
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = DefaultRebalanceThreshold
+	}
+	if !opts.DryRun && s.queue == nil {
+		return nil, fmt.Errorf("task queue not configured")
+	}
+
+	loads, err := s.workerLoads(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &RebalancePlan{
+		DryRun: opts.DryRun,
+		Moves:  []*RebalanceMove{},
+		Before: copyLoads(loads),
+	}
+
+	candidates, err := s.relocatableWorkspaces(ctx, loads)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*WorkerLoad, len(loads))
+	for _, load := range loads {
+		byID[load.WorkerID] = load
+	}
+
+	for len(plan.Moves) < opts.MaxMoves {
+		move := nextMove(loads, candidates, opts.Threshold)
+		if move == nil {
+			break
+		}
+		from, to := byID[move.FromWorkerID], byID[move.ToWorkerID]
+		from.VMCount--
+		from.UsedMemoryMB -= int64(move.MemoryMB)
+		to.VMCount++
+		to.UsedMemoryMB += int64(move.MemoryMB)
+		from.LoadPercent, to.LoadPercent = loadPercent(from), loadPercent(to)
+		plan.Moves = append(plan.Moves, move)
+	}
+	plan.After = copyLoads(loads)
+
+	if opts.DryRun {
+		return plan, nil
+	}
+
+	for _, move := range plan.Moves {
+		taskID, err := s.submitMove(ctx, move)
+		if err != nil {
+			move.Error = err.Error()
+			continue
+		}
+		move.TaskID = taskID
+	}
+
+	return plan, nil
+}
+
+// workerLoads returns the load of every active, healthy worker, using the VM
+// distribution for VM counts and the latest heartbeat for memory usage
+func (s *WorkerService) workerLoads(ctx context.Context) ([]*WorkerLoad, error) {
+	workers, err := s.store.Workers().ListActive(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active workers: %w", err)
+	}
+
+	distribution, err := s.GetVMDistribution(ctx)
+	if err != nil {
+		return nil, err
+	}
+	vmCounts := make(map[string]int, len(distribution))
+	for _, d := range distribution {
+		vmCounts[d.WorkerID] = d.VMCount
+	}
+
+	loads := make([]*WorkerLoad, 0, len(workers))
+	for _, w := range workers {
+		if time.Since(w.LastSeen) > 1*time.Minute {
+			continue
+		}
+		stats := s.workerToStats(w)
+		load := &WorkerLoad{
+			WorkerID:     w.ID,
+			Hostname:     w.Hostname,
+			VMCount:      vmCounts[w.ID],
+			MaxVMs:       w.MaxVMs,
+			UsedMemoryMB: w.UsedMemoryMB,
+			MemoryMB:     w.MemoryMB,
+			capabilities: stats.Capabilities,
+		}
+		load.LoadPercent = loadPercent(load)
+		loads = append(loads, load)
+	}
+
+	return loads, nil
+}
+
+// relocatableWorkspaces returns the moves possible for idle workspaces on
+// the given workers, oldest idle first, without a target worker
+func (s *WorkerService) relocatableWorkspaces(ctx context.Context, loads []*WorkerLoad) ([]*RebalanceMove, error) {
+	onWorker := make(map[string]bool, len(loads))
+	for _, load := range loads {
+		onWorker[load.WorkerID] = true
+	}
+
+	workspaces, err := s.store.Workspaces().ListIdleWithVMs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list idle workspaces: %w", err)
+	}
+
+	var candidates []*RebalanceMove
+	for _, workspace := range workspaces {
+		if workspace.EnvironmentID != nil {
+			continue
+		}
+		vm, err := s.store.VMs().Get(ctx, *workspace.VMID)
+		if err != nil || vm.WorkerID == nil || !onWorker[*vm.WorkerID] {
+			continue
+		}
+		memoryMB := 0
+		if vm.MemoryMB != nil {
+			memoryMB = *vm.MemoryMB
+		}
+		candidates = append(candidates, &RebalanceMove{
+			WorkspaceID:   workspace.ID.String(),
+			WorkspaceName: workspace.Name,
+			VMID:          vm.ID.String(),
+			MemoryMB:      memoryMB,
+			FromWorkerID:  *vm.WorkerID,
+		})
+	}
+
+	return candidates, nil
+}
+
+// nextMove picks the next workspace to move: the oldest idle workspace on
+// the most loaded worker that has one, sent to the least loaded worker that
+// can host it. Returns nil when no move narrows the gap by enough.
+func nextMove(loads []*WorkerLoad, candidates []*RebalanceMove, threshold float64) *RebalanceMove {
+	sorted := copyLoads(loads)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].LoadPercent > sorted[j].LoadPercent })
+
+	for _, from := range sorted {
+		for _, candidate := range candidates {
+			if candidate.FromWorkerID != from.WorkerID || candidate.ToWorkerID != "" {
+				continue
+			}
+			for i := len(sorted) - 1; i >= 0; i-- {
+				to := sorted[i]
+				if from.LoadPercent-to.LoadPercent < threshold {
+					break
+				}
+				if !canHost(to, from, candidate) {
+					continue
+				}
+				candidate.ToWorkerID = to.WorkerID
+				return candidate
+			}
+		}
+	}
+
+	return nil
+}
+
+// canHost reports whether a workspace can move to the target without leaving
+// it more loaded than the source was, or exceeding its capacity
+func canHost(to, from *WorkerLoad, move *RebalanceMove) bool {
+	if to.MaxVMs > 0 && to.VMCount >= to.MaxVMs {
+		return false
+	}
+	if to.MemoryMB > 0 && to.UsedMemoryMB+int64(move.MemoryMB) > to.MemoryMB {
+		return false
+	}
+	for _, capability := range from.capabilities {
+		if !containsString(to.capabilities, capability) {
+			return false
+		}
+	}
+
+	after := *to
+	after.VMCount++
+	after.UsedMemoryMB += int64(move.MemoryMB)
+	return loadPercent(&after) < from.LoadPercent
+}
+
+// submitMove enqueues a workspace:relocate task on the queue of the worker
+// hosting the workspace VM
+func (s *WorkerService) submitMove(ctx context.Context, move *RebalanceMove) (string, error) {
+	task, err := queue.NewTask(queue.TaskTypeWorkspaceRelocate, &queue.WorkspaceRelocatePayload{
+		WorkspaceID:    move.WorkspaceID,
+		VMID:           move.VMID,
+		TargetWorkerID: move.ToWorkerID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.queue.Enqueue(ctx, task, &queue.TaskOptions{
+		Queue:     queue.WorkerQueue(move.FromWorkerID),
+		UniqueKey: move.WorkspaceID,
+	}); err != nil {
+		return "", fmt.Errorf("failed to enqueue workspace relocation task: %w", err)
+	}
+
+	return task.ID.String(), nil
+}
+
+func loadPercent(load *WorkerLoad) float64 {
+	percent := 0.0
+	if load.MaxVMs > 0 {
+		percent = float64(load.VMCount) / float64(load.MaxVMs) * 100
+	}
+	if load.MemoryMB > 0 {
+		if memory := float64(load.UsedMemoryMB) / float64(load.MemoryMB) * 100; memory > percent {
+			percent = memory
+		}
+	}
+	return percent
+}
+
+func copyLoads(loads []*WorkerLoad) []*WorkerLoad {
+	copied := make([]*WorkerLoad, len(loads))
+	for i, load := range loads {
+		c := *load
+		copied[i] = &c
+	}
+	return copied
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
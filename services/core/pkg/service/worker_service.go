@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/aetherium/aetherium/services/gateway/pkg/discovery"
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/scheduler"
 	"github.com/aetherium/aetherium/services/core/pkg/storage"
 )
 
@@ -13,13 +15,16 @@ import (
 type WorkerService struct {
 	store    storage.Store
 	registry discovery.ServiceRegistry
+	queue    queue.Queue
 }
 
-// NewWorkerService creates a new worker service
-func NewWorkerService(store storage.Store, registry discovery.ServiceRegistry) *WorkerService {
+// NewWorkerService creates a new worker service. The queue is used to move
+// workspaces between workers when rebalancing and may be nil.
+func NewWorkerService(store storage.Store, registry discovery.ServiceRegistry, q queue.Queue) *WorkerService {
 	return &WorkerService{
 		store:    store,
 		registry: registry,
+		queue:    q,
 	}
 }
 
@@ -54,6 +59,12 @@ type WorkerStats struct {
 
 	// Health
 	IsHealthy bool `json:"is_healthy"`
+
+	// Build and restart state
+	Version         string                    `json:"version,omitempty"`
+	Commit          string                    `json:"commit,omitempty"`
+	PayloadVersions queue.PayloadVersionRange `json:"payload_versions"` // Task payload versions the worker reads
+	RestartPending  bool                      `json:"restart_pending"`
 }
 
 // ClusterStats represents overall cluster statistics
@@ -78,6 +89,22 @@ type ClusterStats struct {
 	MaxVMs      int `json:"max_vms"`
 	AvailableVMSlots int `json:"available_vm_slots"`
 
+	// Scheduling pressure (from each worker's latest heartbeat metrics)
+	TasksInProgress   int     `json:"tasks_in_progress"`
+	TasksPerMinute    float64 `json:"tasks_per_minute"`
+	AvgQueueLatencyMs float64 `json:"avg_queue_latency_ms"`
+	RecentErrors      int     `json:"recent_errors"`
+
+	// Host health (from each worker's latest heartbeat metrics, over the
+	// workers reporting each signal). Unhealthy hosts are skipped by
+	// scheduling strategies.
+	UnhealthyWorkers   int      `json:"unhealthy_workers"`
+	AvgLoadAvg1m       *float64 `json:"avg_load_avg_1m,omitempty"`
+	MaxCPUStealPercent *float64 `json:"max_cpu_steal_percent,omitempty"`
+	MaxDiskIOPercent   *float64 `json:"max_disk_io_percent,omitempty"`
+	MaxTemperatureC    *float64 `json:"max_temperature_c,omitempty"`
+	MaxGPUTemperatureC *float64 `json:"max_gpu_temperature_c,omitempty"`
+
 	// Zones
 	Zones map[string]int `json:"zones"` // zone -> worker count
 }
@@ -167,6 +194,11 @@ func (s *WorkerService) GetClusterStats(ctx context.Context) (*ClusterStats, err
 		Zones: make(map[string]int),
 	}
 
+	var latencySum float64
+	latencyWorkers := 0
+	var loadSum float64
+	loadWorkers := 0
+
 	for _, w := range workers {
 		stats.TotalWorkers++
 
@@ -193,6 +225,41 @@ func (s *WorkerService) GetClusterStats(ctx context.Context) (*ClusterStats, err
 		if w.Zone != "" {
 			stats.Zones[w.Zone]++
 		}
+
+		// Aggregate scheduling metrics from the latest heartbeat of live workers
+		if w.Status == string(discovery.WorkerStatusOffline) || time.Since(w.LastSeen) > 1*time.Minute {
+			continue
+		}
+		if _, unhealthy := scheduler.HostProblems(w); unhealthy {
+			stats.UnhealthyWorkers++
+		}
+		metrics, err := s.store.WorkerMetrics().ListByWorker(ctx, w.ID, 1)
+		if err != nil || len(metrics) == 0 || time.Since(metrics[0].Timestamp) > 2*time.Minute {
+			continue
+		}
+		stats.TasksInProgress += metrics[0].TasksInProgress
+		stats.TasksPerMinute += metrics[0].TasksPerMinute
+		stats.RecentErrors += metrics[0].ErrorCount
+		if metrics[0].QueueLatencyMs > 0 {
+			latencySum += metrics[0].QueueLatencyMs
+			latencyWorkers++
+		}
+		if metrics[0].LoadAvg1m != nil {
+			loadSum += *metrics[0].LoadAvg1m
+			loadWorkers++
+		}
+		stats.MaxCPUStealPercent = maxReading(stats.MaxCPUStealPercent, metrics[0].CPUStealPercent)
+		stats.MaxDiskIOPercent = maxReading(stats.MaxDiskIOPercent, metrics[0].DiskIOPercent)
+		stats.MaxTemperatureC = maxReading(stats.MaxTemperatureC, metrics[0].TemperatureC)
+		stats.MaxGPUTemperatureC = maxReading(stats.MaxGPUTemperatureC, metrics[0].GPUTemperatureC)
+	}
+
+	if latencyWorkers > 0 {
+		stats.AvgQueueLatencyMs = latencySum / float64(latencyWorkers)
+	}
+	if loadWorkers > 0 {
+		avg := loadSum / float64(loadWorkers)
+		stats.AvgLoadAvg1m = &avg
 	}
 
 	// Calculate available resources
@@ -211,6 +278,14 @@ func (s *WorkerService) GetClusterStats(ctx context.Context) (*ClusterStats, err
 	return stats, nil
 }
 
+// maxReading returns the higher of two optional readings
+func maxReading(current, reading *float64) *float64 {
+	if reading == nil || (current != nil && *current >= *reading) {
+		return current
+	}
+	return reading
+}
+
 // GetVMDistribution returns VM distribution across all workers
 func (s *WorkerService) GetVMDistribution(ctx context.Context) ([]*VMDistribution, error) {
 	workers, err := s.store.Workers().List(ctx, nil)
@@ -316,6 +391,26 @@ func (s *WorkerService) ActivateWorker(ctx context.Context, workerID string) err
 	return nil
 }
 
+// RestartWorker drains a worker and asks it to restart once its tasks finish or
+// the drain timeout expires. The worker picks the request up on its next heartbeat
+// and exits gracefully so its supervisor can start the new binary.
+func (s *WorkerService) RestartWorker(ctx context.Context, workerID string, drainTimeout time.Duration) error {
+	if err := s.DrainWorker(ctx, workerID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	metadata := map[string]interface{}{
+		"restart_requested_at": now.Format(time.RFC3339),
+		"restart_deadline":     now.Add(drainTimeout).Format(time.RFC3339),
+	}
+	if err := s.store.Workers().UpdateMetadata(ctx, workerID, metadata); err != nil {
+		return fmt.Errorf("failed to request worker restart: %w", err)
+	}
+
+	return nil
+}
+
 // Helper: convert storage.Worker to WorkerStats
 func (s *WorkerService) workerToStats(w *storage.Worker) *WorkerStats {
 	// Convert capabilities
@@ -350,6 +445,10 @@ func (s *WorkerService) workerToStats(w *storage.Worker) *WorkerStats {
 	// Check if healthy (last seen within 1 minute)
 	isHealthy := time.Since(w.LastSeen) < 1*time.Minute
 
+	version, _ := w.Metadata["version"].(string)
+	commit, _ := w.Metadata["commit"].(string)
+	_, restartPending := w.Metadata["restart_requested_at"]
+
 	return &WorkerStats{
 		ID:                 w.ID,
 		Hostname:           w.Hostname,
@@ -372,5 +471,9 @@ func (s *WorkerService) workerToStats(w *storage.Worker) *WorkerStats {
 		LastSeen:           w.LastSeen,
 		Uptime:             uptime,
 		IsHealthy:          isHealthy,
+		Version:            version,
+		Commit:             commit,
+		PayloadVersions:    queue.WorkerPayloadVersions(w.Metadata),
+		RestartPending:     restartPending,
 	}
 }
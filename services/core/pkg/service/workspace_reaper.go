@@ -0,0 +1,365 @@
+package service
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// DefaultReapProject is the policy applied to workspaces without a project,
+// and to projects without a policy of their own
+const DefaultReapProject = "default"
+
+// Workspace metadata recorded by the reaper
+const (
+	reapStaleAtKey    = "stale_at"    // When the owner was notified
+	reapArchivedAtKey = "archived_at" // When the workspace was archived and its deletion queued
+)
+
+// WorkspaceArchive is what is kept of a workspace the reaper deletes. Secret
+// values and the files in the VM aren't kept.
+type WorkspaceArchive struct {
+	Workspace     *storage.Workspace               `json:"workspace"`
+	StatusHistory []*storage.WorkspaceStatusChange `json:"status_history"`
+	PrepSteps     []*storage.PrepStep              `json:"prep_steps"`
+	Prompts       []*storage.PromptTask            `json:"prompts"`
+	Secrets       []*storage.WorkspaceSecret       `json:"secrets"` // Names and types only
+	LastActivity  time.Time                        `json:"last_activity"`
+	ArchivedAt    time.Time                        `json:"archived_at"`
+}
+
+// WorkspaceReaper flags workspaces that haven't been used for their
+// project's stale_after_seconds, notifies their owner, and archives them
+// (export, then delete) once the grace period has passed without activity
+type WorkspaceReaper struct {
+	store      storage.Store
+	workspaces *WorkspaceService
+	archiveDir string
+	notifier   AlertNotifier
+	eventBus   events.EventBus
+}
+
+// NewWorkspaceReaper creates a reaper writing archives to archiveDir.
+// Without an archive directory stale workspaces are flagged but never
+// deleted.
+func NewWorkspaceReaper(s storage.Store, workspaces *WorkspaceService, archiveDir string) *WorkspaceReaper {
+	return &WorkspaceReaper{store: s, workspaces: workspaces, archiveDir: archiveDir}
+}
+
+// SetNotifier sets how notices are delivered to policy targets (optional)
+func (r *WorkspaceReaper) SetNotifier(fn AlertNotifier) {
+	r.notifier = fn
+}
+
+// SetEventBus sets the event bus reaper events are published on (optional)
+func (r *WorkspaceReaper) SetEventBus(bus events.EventBus) {
+	r.eventBus = bus
+}
+
+// ValidateReapPolicy checks a policy's durations and targets, and fills in
+// the default grace period. A disabled policy, which only opts its project
+// out, needs no stale_after_seconds.
+func ValidateReapPolicy(policy *storage.WorkspaceReapPolicy) error {
+	if policy.StaleAfterSeconds < 0 || policy.GraceSeconds < 0 {
+		return fmt.Errorf("durations must not be negative")
+	}
+	if policy.Enabled && policy.StaleAfterSeconds == 0 {
+		return fmt.Errorf("stale_after_seconds is required")
+	}
+	if policy.GraceSeconds == 0 {
+		policy.GraceSeconds = 7 * 24 * 3600
+	}
+	for _, target := range policy.Notify {
+		if target.Integration == "" {
+			return fmt.Errorf("notify targets need an integration")
+		}
+	}
+	return nil
+}
+
+// Run reaps stale workspaces every interval until ctx is cancelled
+func (r *WorkspaceReaper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Reap(ctx); err != nil {
+			log.Printf("Warning: Failed to reap stale workspaces: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reap applies the reap policies to every workspace: unused ones are
+// flagged and their owner notified, flagged ones used since are cleared,
+// and flagged ones past the grace period are archived
+func (r *WorkspaceReaper) Reap(ctx context.Context) error {
+	policies, err := r.store.WorkspaceReapPolicies().List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list reap policies: %w", err)
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+	policyByProject := make(map[string]*storage.WorkspaceReapPolicy, len(policies))
+	for _, p := range policies {
+		policyByProject[p.Project] = p
+	}
+
+	activity, err := r.store.Workspaces().ListActivity(ctx)
+	if err != nil {
+		return err
+	}
+	lastActivity := make(map[uuid.UUID]time.Time, len(activity))
+	for _, a := range activity {
+		lastActivity[a.WorkspaceID] = a.LastActivityAt
+	}
+
+	workspaces, err := r.store.Workspaces().List(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list workspaces: %w", err)
+	}
+
+	now := time.Now()
+	for _, workspace := range workspaces {
+		if archivedAt, _ := workspace.Metadata[reapArchivedAtKey].(string); archivedAt != "" {
+			continue
+		}
+		// Workspaces being created aren't stale, however long it takes
+		switch workspace.Status {
+		case storage.WorkspaceStatusCreating, storage.WorkspaceStatusPreparing, storage.WorkspaceStatusSpawning:
+			continue
+		}
+
+		project := DefaultReapProject
+		if p, ok := workspace.Metadata["project"].(string); ok && p != "" {
+			project = p
+		}
+		policy, ok := policyByProject[project]
+		if !ok {
+			policy, ok = policyByProject[DefaultReapProject]
+		}
+		if !ok || !policy.Enabled {
+			continue
+		}
+
+		last, ok := lastActivity[workspace.ID]
+		if !ok {
+			last = workspace.CreatedAt
+		}
+		staleAt := last.Add(time.Duration(policy.StaleAfterSeconds) * time.Second)
+
+		flagged, _ := workspace.Metadata[reapStaleAtKey].(string)
+		flaggedAt, _ := time.Parse(time.RFC3339, flagged)
+
+		switch {
+		case now.Before(staleAt):
+			if flagged != "" {
+				// Used after the notice; start over
+				if err := r.store.Workspaces().UpdateMetadata(ctx, workspace.ID, map[string]interface{}{reapStaleAtKey: nil}); err != nil {
+					log.Printf("Warning: Failed to clear stale flag of workspace %s: %v", workspace.ID, err)
+				}
+			}
+		case flagged == "" || flaggedAt.IsZero():
+			r.flag(ctx, workspace, policy, project, last, now)
+		case !now.Before(flaggedAt.Add(time.Duration(policy.GraceSeconds) * time.Second)):
+			r.archive(ctx, workspace, policy, project, last)
+		}
+	}
+
+	return nil
+}
+
+// flag records that a workspace is stale and notifies its owner of when it
+// will be archived
+func (r *WorkspaceReaper) flag(ctx context.Context, workspace *storage.Workspace, policy *storage.WorkspaceReapPolicy, project string, last, now time.Time) {
+	archiveAt := now.Add(time.Duration(policy.GraceSeconds) * time.Second)
+	if err := r.store.Workspaces().UpdateMetadata(ctx, workspace.ID, map[string]interface{}{
+		reapStaleAtKey: now.Format(time.RFC3339),
+	}); err != nil {
+		log.Printf("Warning: Failed to flag stale workspace %s: %v", workspace.ID, err)
+		return
+	}
+
+	log.Printf("Workspace %s (%s) is stale, archiving at %s", workspace.Name, workspace.ID, archiveAt.Format(time.RFC3339))
+
+	message := fmt.Sprintf("Workspace %s hasn't been used since %s and will be archived and deleted at %s unless it is used before then",
+		workspace.Name, last.Format(time.RFC3339), archiveAt.Format(time.RFC3339))
+	if r.archiveDir == "" {
+		message = fmt.Sprintf("Workspace %s hasn't been used since %s", workspace.Name, last.Format(time.RFC3339))
+	}
+	r.record(ctx, events.TopicWorkspaceStale, "warning", workspace, policy, message, map[string]interface{}{
+		"project":       project,
+		"last_activity": last,
+		"archive_at":    archiveAt,
+	})
+}
+
+// archive exports a stale workspace to the archive directory and deletes it
+func (r *WorkspaceReaper) archive(ctx context.Context, workspace *storage.Workspace, policy *storage.WorkspaceReapPolicy, project string, last time.Time) {
+	if r.archiveDir == "" {
+		return
+	}
+
+	path, err := r.export(ctx, workspace, last)
+	if err != nil {
+		log.Printf("Error archiving stale workspace %s: %v", workspace.ID, err)
+		return
+	}
+
+	taskID, err := r.workspaces.DeleteWorkspace(ctx, workspace.ID)
+	if err != nil {
+		log.Printf("Error deleting archived workspace %s: %v", workspace.ID, err)
+		return
+	}
+	if err := r.store.Workspaces().UpdateMetadata(ctx, workspace.ID, map[string]interface{}{
+		reapArchivedAtKey: time.Now().Format(time.RFC3339),
+	}); err != nil {
+		log.Printf("Warning: Failed to record archiving of workspace %s: %v", workspace.ID, err)
+	}
+
+	log.Printf("✓ Archived stale workspace %s (%s) to %s", workspace.Name, workspace.ID, path)
+
+	message := fmt.Sprintf("Workspace %s was archived and deleted after going unused since %s",
+		workspace.Name, last.Format(time.RFC3339))
+	r.record(ctx, events.TopicWorkspaceArchived, "info", workspace, policy, message, map[string]interface{}{
+		"project":       project,
+		"last_activity": last,
+		"archive":       filepath.Base(path),
+		"task_id":       taskID.String(),
+	})
+}
+
+// export writes a workspace's archive as gzipped JSON, returning its path
+func (r *WorkspaceReaper) export(ctx context.Context, workspace *storage.Workspace, last time.Time) (string, error) {
+	archive := &WorkspaceArchive{
+		Workspace:    workspace,
+		LastActivity: last,
+		ArchivedAt:   time.Now().UTC(),
+	}
+
+	var err error
+	if archive.StatusHistory, err = r.store.Workspaces().ListStatusHistory(ctx, workspace.ID); err != nil {
+		return "", err
+	}
+	if archive.PrepSteps, err = r.store.PrepSteps().ListByWorkspace(ctx, workspace.ID); err != nil {
+		return "", err
+	}
+	if archive.Prompts, err = r.store.PromptTasks().ListByWorkspace(ctx, workspace.ID, 0); err != nil {
+		return "", err
+	}
+	if archive.Secrets, err = r.store.Secrets().ListByWorkspace(ctx, workspace.ID); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(r.archiveDir, 0o750); err != nil {
+		return "", fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s-%s.json.gz", workspace.Name, workspace.ID, archive.ArchivedAt.Format("20060102T150405Z"))
+	path := filepath.Join(r.archiveDir, name)
+
+	// Written under a temporary name so a partial archive is never mistaken
+	// for a complete one
+	tmp, err := os.CreateTemp(r.archiveDir, ".archive-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	gz := gzip.NewWriter(tmp)
+	enc := json.NewEncoder(gz)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(archive); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	return path, nil
+}
+
+// record adds a reaper event to the cluster timeline and the event bus and
+// delivers it to the policy's targets. Targets without a target of their
+// own are sent to the workspace's owner annotation, e.g. a Slack @user.
+func (r *WorkspaceReaper) record(ctx context.Context, topic, severity string, workspace *storage.Workspace, policy *storage.WorkspaceReapPolicy, message string, data map[string]interface{}) {
+	owner := ""
+	if workspace.Annotations != nil {
+		owner = workspace.Annotations.Owner
+	}
+	data["workspace_id"] = workspace.ID.String()
+	data["workspace_name"] = workspace.Name
+	if owner != "" {
+		data["owner"] = owner
+	}
+
+	event := &storage.ClusterEvent{
+		ID:           uuid.New(),
+		Type:         topic,
+		Severity:     severity,
+		ResourceType: "workspace",
+		ResourceID:   workspace.ID.String(),
+		Message:      message,
+		Data:         data,
+		CreatedAt:    time.Now(),
+	}
+	if err := r.store.ClusterEvents().Create(ctx, event); err != nil {
+		log.Printf("Warning: Failed to record %s event: %v", topic, err)
+	}
+
+	if r.eventBus != nil {
+		busEvent := &types.Event{
+			ID:        event.ID.String(),
+			Type:      topic,
+			Timestamp: event.CreatedAt,
+			Data:      data,
+		}
+		if err := r.eventBus.Publish(ctx, topic, busEvent); err != nil {
+			log.Printf("Warning: Failed to publish %s event: %v", topic, err)
+		}
+	}
+
+	if r.notifier == nil {
+		return
+	}
+	for _, target := range policy.Notify {
+		if target.Target == "" {
+			if owner == "" {
+				continue
+			}
+			target.Target = owner
+		}
+		notification := &types.Notification{
+			Type:    topic,
+			Target:  target.Target,
+			Message: message,
+			Data:    data,
+		}
+		if err := r.notifier(ctx, target, notification); err != nil {
+			log.Printf("Warning: Failed to deliver %s notice for workspace %s via %s: %v", topic, workspace.Name, target.Integration, err)
+		}
+	}
+}
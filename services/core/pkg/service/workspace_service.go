@@ -8,10 +8,14 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"log"
+	"sort"
 	"time"
 
 	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+	"github.com/aetherium/aetherium/services/gateway/pkg/discovery"
 	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/scheduler"
 	"github.com/aetherium/aetherium/services/core/pkg/storage"
 	"github.com/google/uuid"
 )
@@ -21,6 +25,14 @@ type WorkspaceService struct {
 	queue         queue.Queue
 	store         storage.Store
 	encryptionKey []byte // AES-256 key for secret encryption
+
+	// schedulingStrategy places workspace VMs on workers unless their
+	// environment picks another ("" = shared queues)
+	schedulingStrategy string
+
+	// promptRetries is how many times a prompt failing for an
+	// infrastructure reason is retried
+	promptRetries int
 }
 
 // NewWorkspaceService creates a new workspace service
@@ -47,6 +59,7 @@ func NewWorkspaceService(q queue.Queue, s storage.Store, encryptionKeyHex string
 		queue:         q,
 		store:         s,
 		encryptionKey: encryptionKey,
+		promptRetries: DefaultPromptRetries,
 	}, nil
 }
 
@@ -58,10 +71,26 @@ func (s *WorkspaceService) CreateWorkspace(ctx context.Context, req *api.CreateW
 		ID:                workspaceID,
 		Name:              req.Name,
 		Description:       stringPtr(req.Description),
-		Status:            "creating",
+		Status:            storage.WorkspaceStatusCreating,
 		AIAssistant:       req.AIAssistant,
 		AIAssistantConfig: req.AIAssistantConfig,
 		WorkingDirectory:  req.WorkingDirectory,
+		Metadata:          storage.JSONB{},
+	}
+
+	// Remember the VM size so a failed creation can be retried
+	workspace.Metadata["vcpus"] = req.VCPUs
+	workspace.Metadata["memory_mb"] = req.MemoryMB
+
+	// Remember requested tools so the workspace can later be saved as an environment
+	if len(req.AdditionalTools) > 0 {
+		workspace.Metadata["additional_tools"] = req.AdditionalTools
+	}
+	if len(req.ToolVersions) > 0 {
+		workspace.Metadata["tool_versions"] = req.ToolVersions
+	}
+	if req.Project != "" {
+		workspace.Metadata["project"] = req.Project
 	}
 
 	// Handle environment_id if provided
@@ -77,19 +106,6 @@ func (s *WorkspaceService) CreateWorkspace(ctx context.Context, req *api.CreateW
 		workspace.WorkingDirectory = "/workspace"
 	}
 
-	if err := s.store.Workspaces().Create(ctx, workspace); err != nil {
-		return uuid.Nil, uuid.Nil, fmt.Errorf("failed to create workspace: %w", err)
-	}
-
-	// Store secrets (encrypted)
-	for _, secretReq := range req.Secrets {
-		if _, err := s.addSecret(ctx, workspaceID, &secretReq, "workspace"); err != nil {
-			// Cleanup on failure
-			s.store.Workspaces().Delete(ctx, workspaceID)
-			return uuid.Nil, uuid.Nil, fmt.Errorf("failed to store secret %s: %w", secretReq.Name, err)
-		}
-	}
-
 	// Store prep steps
 	prepSteps := make([]*storage.PrepStep, len(req.PrepSteps))
 	for i, stepReq := range req.PrepSteps {
@@ -103,50 +119,293 @@ func (s *WorkspaceService) CreateWorkspace(ctx context.Context, req *api.CreateW
 		}
 	}
 
-	if len(prepSteps) > 0 {
-		if err := s.store.PrepSteps().CreateBatch(ctx, prepSteps); err != nil {
-			s.store.Workspaces().Delete(ctx, workspaceID)
-			return uuid.Nil, uuid.Nil, fmt.Errorf("failed to store prep steps: %w", err)
+	// The workspace, its secrets (encrypted) and prep steps are written together
+	err = s.store.WithTx(ctx, func(tx storage.Store) error {
+		if err := tx.Workspaces().Create(ctx, workspace); err != nil {
+			return fmt.Errorf("failed to create workspace: %w", err)
 		}
+
+		for _, secretReq := range req.Secrets {
+			if _, err := s.addSecret(ctx, tx, workspaceID, &secretReq, "workspace"); err != nil {
+				return fmt.Errorf("failed to store secret %s: %w", secretReq.Name, err)
+			}
+		}
+
+		if len(prepSteps) > 0 {
+			if err := tx.PrepSteps().CreateBatch(ctx, prepSteps); err != nil {
+				return fmt.Errorf("failed to store prep steps: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
 	}
 
 	// Build task payload
-	payload := map[string]interface{}{
-		"workspace_id": workspaceID.String(),
-		"name":         req.Name,
-		"vcpus":        req.VCPUs,
-		"memory_mb":    req.MemoryMB,
-		"ai_assistant": req.AIAssistant,
-		"working_dir":  workspace.WorkingDirectory,
+	payload := &queue.WorkspaceCreatePayload{
+		WorkspaceID:       workspaceID.String(),
+		Name:              req.Name,
+		VCPUs:             req.VCPUs,
+		MemoryMB:          req.MemoryMB,
+		AIAssistant:       req.AIAssistant,
+		AIAssistantConfig: req.AIAssistantConfig,
+		WorkingDir:        workspace.WorkingDirectory,
+		AdditionalTools:   req.AdditionalTools,
+		ToolVersions:      req.ToolVersions,
 	}
 
-	if len(req.AdditionalTools) > 0 {
-		payload["additional_tools"] = req.AdditionalTools
+	taskID, err = s.enqueueCreate(ctx, payload, s.placementQueue(ctx, workspace, req.VCPUs, req.MemoryMB))
+	if err != nil {
+		s.store.Workspaces().Delete(ctx, workspaceID)
+		return uuid.Nil, uuid.Nil, err
 	}
-	if len(req.ToolVersions) > 0 {
-		payload["tool_versions"] = req.ToolVersions
+
+	return taskID, workspaceID, nil
+}
+
+// RetryWorkspace resubmits the creation task for a failed workspace. The
+// worker resumes after the last creation phase that completed.
+func (s *WorkspaceService) RetryWorkspace(ctx context.Context, workspaceID uuid.UUID) (uuid.UUID, error) {
+	workspace, err := s.store.Workspaces().Get(ctx, workspaceID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("workspace not found: %w", err)
+	}
+	if workspace.Status != storage.WorkspaceStatusFailed {
+		return uuid.Nil, fmt.Errorf("workspace is not failed (status: %s)", workspace.Status)
+	}
+
+	payload := createPayload(workspace)
+	return s.enqueueCreate(ctx, payload, s.placementQueue(ctx, workspace, payload.VCPUs, payload.MemoryMB))
+}
+
+// RecreateWorkspace submits a creation task for a workspace whose VM was
+// discarded, to be picked up only by the given worker. Used to move
+// workspaces between workers when rebalancing the cluster.
+func (s *WorkspaceService) RecreateWorkspace(ctx context.Context, workspaceID uuid.UUID, workerID string) (uuid.UUID, error) {
+	workspace, err := s.store.Workspaces().Get(ctx, workspaceID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("workspace not found: %w", err)
 	}
-	if req.AIAssistantConfig != nil {
-		payload["ai_assistant_config"] = req.AIAssistantConfig
+	return s.enqueueCreate(ctx, createPayload(workspace), queue.WorkerQueue(workerID))
+}
+
+// CloneWorkspace creates a workspace from a ready one: same environment,
+// assistant, VM size, secrets and prep steps, with a copy of its working
+// directory taken once the clone's VM is prepared. Git clone steps are
+// skipped, the copied tree already holds the repository.
+func (s *WorkspaceService) CloneWorkspace(ctx context.Context, sourceID uuid.UUID, req *api.CloneWorkspaceRequest) (taskID, workspaceID uuid.UUID, err error) {
+	source, err := s.store.Workspaces().Get(ctx, sourceID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("workspace not found: %w", err)
+	}
+	if source.Status != storage.WorkspaceStatusReady || source.VMID == nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("only ready workspaces can be cloned (status: %s)", source.Status)
 	}
 
-	task := &queue.Task{
-		ID:      uuid.New(),
-		Type:    queue.TaskTypeWorkspaceCreate,
-		Payload: payload,
+	name := req.Name
+	if name == "" {
+		name = source.Name + "-clone"
+	}
+	description := req.Description
+	if description == "" && source.Description != nil {
+		description = *source.Description
 	}
 
-	if err := s.queue.Enqueue(ctx, task, &queue.TaskOptions{
-		MaxRetry: 2,
-		Timeout:  30 * time.Minute, // Long timeout for VM + tools + prep steps
-		Queue:    "default",
-		Priority: 5,
-	}); err != nil {
+	workspaceID = uuid.New()
+	workspace := &storage.Workspace{
+		ID:                workspaceID,
+		Name:              name,
+		Description:       stringPtr(description),
+		Status:            storage.WorkspaceStatusCreating,
+		EnvironmentID:     source.EnvironmentID,
+		AIAssistant:       source.AIAssistant,
+		AIAssistantConfig: source.AIAssistantConfig,
+		WorkingDirectory:  source.WorkingDirectory,
+		Metadata:          storage.JSONB{"cloned_from": source.ID.String()},
+	}
+	for _, key := range []string{"vcpus", "memory_mb", "additional_tools", "tool_versions", "project"} {
+		if value, ok := source.Metadata[key]; ok {
+			workspace.Metadata[key] = value
+		}
+	}
+
+	secrets, err := s.store.Secrets().ListByWorkspace(ctx, sourceID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("failed to get secrets: %w", err)
+	}
+	sourceSteps, err := s.store.PrepSteps().ListByWorkspace(ctx, sourceID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("failed to get prep steps: %w", err)
+	}
+	var prepSteps []*storage.PrepStep
+	for _, step := range sourceSteps {
+		if step.StepType == "git_clone" {
+			continue
+		}
+		prepSteps = append(prepSteps, &storage.PrepStep{
+			ID:          uuid.New(),
+			WorkspaceID: workspaceID,
+			StepType:    step.StepType,
+			StepOrder:   step.StepOrder,
+			Config:      step.Config,
+			Status:      "pending",
+		})
+	}
+
+	// Secrets are copied still encrypted, under the same key
+	err = s.store.WithTx(ctx, func(tx storage.Store) error {
+		if err := tx.Workspaces().Create(ctx, workspace); err != nil {
+			return fmt.Errorf("failed to create workspace: %w", err)
+		}
+		for _, secret := range secrets {
+			secretCopy := *secret
+			secretCopy.ID = uuid.New()
+			secretCopy.WorkspaceID = &workspaceID
+			secretCopy.LastUsedAt = nil
+			if err := tx.Secrets().Create(ctx, &secretCopy); err != nil {
+				return fmt.Errorf("failed to copy secret %s: %w", secret.Name, err)
+			}
+		}
+		if len(prepSteps) > 0 {
+			if err := tx.PrepSteps().CreateBatch(ctx, prepSteps); err != nil {
+				return fmt.Errorf("failed to store prep steps: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	payload := createPayload(workspace)
+	taskID, err = s.enqueueCreate(ctx, payload, s.placementQueue(ctx, workspace, payload.VCPUs, payload.MemoryMB))
+	if err != nil {
 		s.store.Workspaces().Delete(ctx, workspaceID)
-		return uuid.Nil, uuid.Nil, fmt.Errorf("failed to enqueue workspace creation task: %w", err)
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	return taskID, workspaceID, nil
+}
+
+// createPayload rebuilds a workspace's creation payload from its record
+func createPayload(workspace *storage.Workspace) *queue.WorkspaceCreatePayload {
+	// Workspaces created before the VM size was recorded get the API defaults
+	vcpus, memoryMB := 1, 512
+	if v, ok := workspace.Metadata["vcpus"].(float64); ok && v > 0 {
+		vcpus = int(v)
+	}
+	if v, ok := workspace.Metadata["memory_mb"].(float64); ok && v > 0 {
+		memoryMB = int(v)
 	}
 
-	return task.ID, workspaceID, nil
+	payload := &queue.WorkspaceCreatePayload{
+		WorkspaceID:       workspace.ID.String(),
+		Name:              workspace.Name,
+		VCPUs:             vcpus,
+		MemoryMB:          memoryMB,
+		AIAssistant:       workspace.AIAssistant,
+		AIAssistantConfig: workspace.AIAssistantConfig,
+		WorkingDir:        workspace.WorkingDirectory,
+	}
+	if tools, ok := workspace.Metadata["additional_tools"].([]interface{}); ok {
+		for _, t := range tools {
+			if name, ok := t.(string); ok {
+				payload.AdditionalTools = append(payload.AdditionalTools, name)
+			}
+		}
+	}
+	if versions, ok := workspace.Metadata["tool_versions"].(map[string]interface{}); ok {
+		payload.ToolVersions = make(map[string]string, len(versions))
+		for tool, v := range versions {
+			if version, ok := v.(string); ok {
+				payload.ToolVersions[tool] = version
+			}
+		}
+	}
+	if source, ok := workspace.Metadata["cloned_from"].(string); ok {
+		payload.CloneFrom = source
+	}
+
+	return payload
+}
+
+// SetSchedulingStrategy sets the scheduling strategy placing workspace VMs
+// on workers, for environments without their own ("" = none: any worker may
+// take them from the shared queues)
+func (s *WorkspaceService) SetSchedulingStrategy(strategy string) error {
+	if strategy != "" {
+		if _, err := scheduler.Lookup(strategy); err != nil {
+			return err
+		}
+	}
+	s.schedulingStrategy = strategy
+	return nil
+}
+
+// placementQueue returns the queue of the worker a workspace's new VM is
+// scheduled on, or "" for the shared queues. The workspace's environment
+// may pick the strategy; a workspace placed in a zone stays there unless
+// its environment permits failover. VMs only some workers can boot, such
+// as Windows guests, go to those workers' capability queue when they
+// aren't scheduled. VMs that must avoid some workers are scheduled even
+// without a strategy.
+func (s *WorkspaceService) placementQueue(ctx context.Context, workspace *storage.Workspace, vcpus, memoryMB int, excludeWorkers ...string) string {
+	strategy := s.schedulingStrategy
+	req := &scheduler.Request{
+		VCPUs:          vcpus,
+		MemoryMB:       memoryMB,
+		Zone:           workspace.Zone(),
+		ZoneRequired:   workspace.Zone() != "",
+		ExcludeWorkers: excludeWorkers,
+	}
+	capability := ""
+	if workspace.EnvironmentID != nil {
+		if env, err := s.store.Environments().Get(ctx, *workspace.EnvironmentID); err == nil {
+			// A saved image only exists on the worker that saved it
+			if env.RootFSImageWorkerID != nil {
+				return queue.WorkerQueue(*env.RootFSImageWorkerID)
+			}
+			strategy = environmentPlacement(env, req, strategy)
+			capability = environmentCapability(env)
+		}
+	}
+	if strategy == "" && len(excludeWorkers) > 0 {
+		strategy = scheduler.DefaultStrategy
+	}
+	if queueName := scheduleQueue(ctx, s.store, strategy, req); queueName != "" {
+		return queueName
+	}
+	if capability != "" {
+		return queue.CapabilityQueue(capability)
+	}
+	return ""
+}
+
+// enqueueCreate submits a workspace creation task. An empty queueName lets
+// any worker pick it up.
+func (s *WorkspaceService) enqueueCreate(ctx context.Context, payload *queue.WorkspaceCreatePayload, queueName string) (uuid.UUID, error) {
+	task, err := queue.NewTask(queue.TaskTypeWorkspaceCreate, payload)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// One creation task per workspace, so a repeated retry can't boot a second VM
+	opts := &queue.TaskOptions{
+		Queue:     "default",
+		Priority:  5,
+		UniqueKey: payload.WorkspaceID,
+	}
+	if queueName != "" {
+		opts.Queue = queueName
+		opts.Priority = 0
+	}
+	if err := s.queue.Enqueue(ctx, task, opts); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to enqueue workspace creation task: %w", err)
+	}
+
+	return task.ID, nil
 }
 
 // DeleteWorkspace submits a workspace deletion task
@@ -157,20 +416,18 @@ func (s *WorkspaceService) DeleteWorkspace(ctx context.Context, workspaceID uuid
 		return uuid.Nil, fmt.Errorf("workspace not found: %w", err)
 	}
 
-	task := &queue.Task{
-		ID:   uuid.New(),
-		Type: queue.TaskTypeWorkspaceDelete,
-		Payload: map[string]interface{}{
-			"workspace_id": workspaceID.String(),
-			"vm_id":        workspace.VMID,
-		},
+	task, err := queue.NewTask(queue.TaskTypeWorkspaceDelete, &queue.WorkspaceDeletePayload{
+		WorkspaceID: workspaceID.String(),
+		VMID:        workspace.VMID,
+	})
+	if err != nil {
+		return uuid.Nil, err
 	}
 
 	if err := s.queue.Enqueue(ctx, task, &queue.TaskOptions{
-		MaxRetry: 2,
-		Timeout:  5 * time.Minute,
-		Queue:    "default",
-		Priority: 5,
+		Queue:     "default",
+		Priority:  5,
+		UniqueKey: workspaceID.String(),
 	}); err != nil {
 		return uuid.Nil, fmt.Errorf("failed to enqueue workspace deletion task: %w", err)
 	}
@@ -188,9 +445,15 @@ func (s *WorkspaceService) GetWorkspaceByName(ctx context.Context, name string)
 	return s.store.Workspaces().GetByName(ctx, name)
 }
 
-// ListWorkspaces lists all workspaces
-func (s *WorkspaceService) ListWorkspaces(ctx context.Context) ([]*storage.Workspace, error) {
-	return s.store.Workspaces().List(ctx, map[string]interface{}{})
+// ListWorkspaces lists workspaces, newest first, optionally filtered by
+// status, ai_assistant or owner
+func (s *WorkspaceService) ListWorkspaces(ctx context.Context, filters map[string]interface{}) ([]*storage.Workspace, error) {
+	return s.store.Workspaces().List(ctx, filters)
+}
+
+// GetStatusHistory retrieves a workspace's status changes, oldest first
+func (s *WorkspaceService) GetStatusHistory(ctx context.Context, workspaceID uuid.UUID) ([]*storage.WorkspaceStatusChange, error) {
+	return s.store.Workspaces().ListStatusHistory(ctx, workspaceID)
 }
 
 // GetPrepSteps retrieves prep steps for a workspace
@@ -198,6 +461,132 @@ func (s *WorkspaceService) GetPrepSteps(ctx context.Context, workspaceID uuid.UU
 	return s.store.PrepSteps().ListByWorkspace(ctx, workspaceID)
 }
 
+// SaveAsEnvironment captures a workspace's tools, env vars and MCP config into a new environment.
+// When req.SnapshotRootFS is set, a snapshot task is enqueued to copy the VM's rootfs into
+// the environment image and its task ID is returned.
+func (s *WorkspaceService) SaveAsEnvironment(ctx context.Context, workspaceID uuid.UUID, req *api.SaveAsEnvironmentRequest) (*storage.Environment, *uuid.UUID, error) {
+	workspace, err := s.store.Workspaces().Get(ctx, workspaceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("workspace not found: %w", err)
+	}
+
+	if req.SnapshotRootFS && workspace.VMID == nil {
+		return nil, nil, fmt.Errorf("workspace has no running VM to snapshot")
+	}
+
+	env := &storage.Environment{
+		Name:              req.Name,
+		Description:       stringPtr(req.Description),
+		WorkingDirectory:  workspace.WorkingDirectory,
+		EnvVars:           make(map[string]string),
+		SourceWorkspaceID: &workspace.ID,
+	}
+
+	// Start from the workspace's own environment, if it was created from one
+	if workspace.EnvironmentID != nil {
+		base, err := s.store.Environments().Get(ctx, *workspace.EnvironmentID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get source environment: %w", err)
+		}
+		env.VCPUs = base.VCPUs
+		env.MemoryMB = base.MemoryMB
+		env.GitRepoURL = base.GitRepoURL
+		env.GitBranch = base.GitBranch
+		env.Tools = append(env.Tools, base.Tools...)
+		env.MCPServers = base.MCPServers
+		env.IdleTimeoutSeconds = base.IdleTimeoutSeconds
+		env.RootFSImage = base.RootFSImage
+		env.RootFSImageWorkerID = base.RootFSImageWorkerID
+		env.Redaction = base.Redaction
+		env.Platform = base.Platform
+		for k, v := range base.EnvVars {
+			env.EnvVars[k] = v
+		}
+	}
+
+	// VM sizing from the workspace's current VM
+	if workspace.VMID != nil {
+		if vm, err := s.store.VMs().Get(ctx, *workspace.VMID); err == nil {
+			if vm.VCPUCount != nil {
+				env.VCPUs = *vm.VCPUCount
+			}
+			if vm.MemoryMB != nil {
+				env.MemoryMB = *vm.MemoryMB
+			}
+		}
+	}
+
+	// Tools requested at workspace creation, plus the AI assistant
+	if tools, ok := workspace.Metadata["additional_tools"].([]interface{}); ok {
+		for _, t := range tools {
+			if name, ok := t.(string); ok {
+				env.Tools = append(env.Tools, name)
+			}
+		}
+	}
+	if workspace.AIAssistant == "claude-code" || workspace.AIAssistant == "ampcode" {
+		env.Tools = append(env.Tools, workspace.AIAssistant)
+	}
+	env.Tools = uniqueStrings(env.Tools)
+
+	// Windows guests have no tools installed in them nor a rootfs to snapshot
+	if env.IsWindows() {
+		if req.SnapshotRootFS {
+			return nil, nil, fmt.Errorf("windows workspaces can't be snapshotted")
+		}
+		env.Tools = nil
+	}
+
+	// Non-secret env vars and the first repository from prep steps
+	prepSteps, err := s.store.PrepSteps().ListByWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get prep steps: %w", err)
+	}
+	for _, step := range prepSteps {
+		switch step.StepType {
+		case "env_var":
+			key, _ := step.Config["key"].(string)
+			value, _ := step.Config["value"].(string)
+			isSecret, _ := step.Config["is_secret"].(bool)
+			secretName, _ := step.Config["secret_name"].(string)
+			if key != "" && value != "" && !isSecret && secretName == "" {
+				env.EnvVars[key] = value
+			}
+		case "git_clone":
+			if env.GitRepoURL == "" {
+				env.GitRepoURL, _ = step.Config["url"].(string)
+				env.GitBranch, _ = step.Config["branch"].(string)
+			}
+		}
+	}
+
+	if err := s.store.Environments().Create(ctx, env); err != nil {
+		return nil, nil, fmt.Errorf("failed to create environment: %w", err)
+	}
+
+	if !req.SnapshotRootFS {
+		return env, nil, nil
+	}
+
+	task, err := queue.NewTask(queue.TaskTypeWorkspaceSnapshot, &queue.WorkspaceSnapshotPayload{
+		WorkspaceID:   workspaceID.String(),
+		VMID:          workspace.VMID.String(),
+		EnvironmentID: env.ID.String(),
+	})
+	if err != nil {
+		return env, nil, err
+	}
+
+	if err := s.queue.Enqueue(ctx, task, &queue.TaskOptions{
+		Queue:    "default",
+		Priority: 5,
+	}); err != nil {
+		return env, nil, fmt.Errorf("failed to enqueue rootfs snapshot task: %w", err)
+	}
+
+	return env, &task.ID, nil
+}
+
 // SubmitPrompt creates a prompt task and optionally enqueues it for execution
 func (s *WorkspaceService) SubmitPrompt(ctx context.Context, workspaceID uuid.UUID, req *api.SubmitPromptRequest) (uuid.UUID, error) {
 	// Verify workspace exists and is ready
@@ -206,7 +595,8 @@ func (s *WorkspaceService) SubmitPrompt(ctx context.Context, workspaceID uuid.UU
 		return uuid.Nil, fmt.Errorf("workspace not found: %w", err)
 	}
 
-	if workspace.Status != "ready" {
+	// Idle workspaces spawn a new VM for the prompt
+	if workspace.Status != storage.WorkspaceStatusReady && workspace.Status != storage.WorkspaceStatusIdle {
 		return uuid.Nil, fmt.Errorf("workspace is not ready (status: %s)", workspace.Status)
 	}
 
@@ -221,6 +611,18 @@ func (s *WorkspaceService) SubmitPrompt(ctx context.Context, workspaceID uuid.UU
 		workingDir = workspace.WorkingDirectory
 	}
 
+	if err := s.checkAttachments(ctx, workspaceID, req.Attachments); err != nil {
+		return uuid.Nil, err
+	}
+
+	class, err := queue.ParseWorkloadClass(req.WorkloadClass)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if class == "" {
+		class = queue.DefaultWorkloadClass(queue.TaskTypePromptExecute)
+	}
+
 	// Create prompt task record
 	promptID := uuid.New()
 	now := time.Now()
@@ -235,31 +637,60 @@ func (s *WorkspaceService) SubmitPrompt(ctx context.Context, workspaceID uuid.UU
 		Status:           "pending",
 		CreatedAt:        now,
 		ScheduledAt:      now,
+		WorkloadClass:    string(class),
+	}
+	if req.TimeoutSeconds > 0 {
+		promptTask.TimeoutSeconds = &req.TimeoutSeconds
 	}
 
-	if err := s.store.PromptTasks().Create(ctx, promptTask); err != nil {
-		return uuid.Nil, fmt.Errorf("failed to create prompt task: %w", err)
+	err = s.store.WithTx(ctx, func(tx storage.Store) error {
+		if err := tx.PromptTasks().Create(ctx, promptTask); err != nil {
+			return fmt.Errorf("failed to create prompt task: %w", err)
+		}
+		if len(req.Attachments) > 0 {
+			if err := tx.PromptAttachments().Attach(ctx, workspaceID, promptID, req.Attachments); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidAttachment, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return uuid.Nil, err
 	}
 
 	// Enqueue for execution
-	task := &queue.Task{
-		ID:   uuid.New(),
-		Type: queue.TaskTypePromptExecute,
-		Payload: map[string]interface{}{
-			"prompt_id":    promptID.String(),
-			"workspace_id": workspaceID.String(),
-		},
-		Priority: priority,
+	task, err := queue.NewTask(queue.TaskTypePromptExecute, &queue.PromptExecutePayload{
+		PromptID:    promptID.String(),
+		WorkspaceID: workspaceID.String(),
+	})
+	if err != nil {
+		return uuid.Nil, err
 	}
+	task.Priority = priority
 
-	if err := s.queue.Enqueue(ctx, task, &queue.TaskOptions{
-		MaxRetry: 1, // Prompts are idempotent, don't retry
-		Timeout:  30 * time.Minute,
+	opts := &queue.TaskOptions{
+		Timeout:  s.promptTaskTimeout(ctx, workspace, req.TimeoutSeconds),
 		Queue:    "default",
 		Priority: priority,
-	}); err != nil {
+		Class:    class,
+	}
+	queueName := s.promptQueue(ctx, workspace)
+	// An idle workspace's prompt spawns its VM, so the VM is scheduled here
+	if workspace.Status == storage.WorkspaceStatusIdle && workspace.EnvironmentID != nil {
+		if env, err := s.store.Environments().Get(ctx, *workspace.EnvironmentID); err == nil {
+			if placed := s.placementQueue(ctx, workspace, env.VCPUs, env.MemoryMB); placed != "" {
+				queueName = placed
+			}
+		}
+	}
+	if queueName != "" {
+		opts.Queue = queueName
+		opts.Priority = 0
+	}
+
+	if err := s.queue.Enqueue(ctx, task, opts); err != nil {
 		// Mark prompt as failed if enqueue fails
-		s.store.PromptTasks().UpdateStatus(ctx, promptID, "failed", &storage.PromptResult{
+		s.store.PromptTasks().UpdateStatus(ctx, promptID, storage.PromptStatusFailed, &storage.PromptResult{
 			Error: fmt.Sprintf("failed to enqueue: %v", err),
 		})
 		return uuid.Nil, fmt.Errorf("failed to enqueue prompt execution: %w", err)
@@ -268,19 +699,145 @@ func (s *WorkspaceService) SubmitPrompt(ctx context.Context, workspaceID uuid.UU
 	return promptID, nil
 }
 
+// promptTaskTimeout returns the queue timeout for a prompt's task: its time
+// limit (the prompt's, else its environment's) plus time to spawn a VM, and
+// never less than the default 30 minutes
+func (s *WorkspaceService) promptTaskTimeout(ctx context.Context, workspace *storage.Workspace, timeoutSeconds int) time.Duration {
+	if timeoutSeconds <= 0 && workspace.EnvironmentID != nil {
+		if env, err := s.store.Environments().Get(ctx, *workspace.EnvironmentID); err == nil {
+			timeoutSeconds = env.PromptTimeoutSeconds
+		}
+	}
+
+	timeout := time.Duration(timeoutSeconds)*time.Second + 10*time.Minute
+	if timeout < 30*time.Minute {
+		timeout = 30 * time.Minute
+	}
+	return timeout
+}
+
+// promptQueue returns the queue a workspace's prompts go to, or "" for the
+// shared queues. Workspaces whose VMs need a capability are served by the
+// workers that have it; a workspace placed in a zone by that zone's
+// workers. When none of them is healthy and the workspace's environment
+// permits failover, any worker may take the prompt and respawn the VM.
+func (s *WorkspaceService) promptQueue(ctx context.Context, workspace *storage.Workspace) string {
+	// Only workers with the capability can run the environment's VMs
+	if workspace.EnvironmentID != nil {
+		if env, err := s.store.Environments().Get(ctx, *workspace.EnvironmentID); err == nil {
+			if capability := environmentCapability(env); capability != "" {
+				return queue.CapabilityQueue(capability)
+			}
+		}
+	}
+
+	zone := workspace.Zone()
+	if zone == "" {
+		return ""
+	}
+	if workspace.EnvironmentID == nil || s.zoneHasHealthyWorkers(ctx, zone) {
+		return queue.ZoneQueue(zone)
+	}
+
+	env, err := s.store.Environments().Get(ctx, *workspace.EnvironmentID)
+	if err != nil || !env.CanFailOver() {
+		return queue.ZoneQueue(zone)
+	}
+	return ""
+}
+
+// zoneHasHealthyWorkers reports whether an active worker in the zone has
+// sent a heartbeat within the last minute. Errors count as healthy so a
+// database hiccup doesn't move workspaces out of their zone.
+func (s *WorkspaceService) zoneHasHealthyWorkers(ctx context.Context, zone string) bool {
+	workers, err := s.store.Workers().ListByZone(ctx, zone)
+	if err != nil {
+		return true
+	}
+	for _, w := range workers {
+		if w.Status == string(discovery.WorkerStatusActive) && time.Since(w.LastSeen) < 1*time.Minute {
+			return true
+		}
+	}
+	return false
+}
+
 // GetPrompt retrieves a prompt task
 func (s *WorkspaceService) GetPrompt(ctx context.Context, promptID uuid.UUID) (*storage.PromptTask, error) {
 	return s.store.PromptTasks().Get(ctx, promptID)
 }
 
+// ListPromptAttempts lists the earlier attempts of a retried prompt
+func (s *WorkspaceService) ListPromptAttempts(ctx context.Context, promptID uuid.UUID) ([]*storage.PromptAttempt, error) {
+	return s.store.PromptTasks().ListAttempts(ctx, promptID)
+}
+
+// promptDurationSamples is how many recent prompts EstimatePrompt averages
+const promptDurationSamples = 20
+
+// PromptEstimate is where a prompt stands in the queue and roughly when it
+// will finish
+type PromptEstimate struct {
+	Position int           // 1 = next to run, 0 once running
+	ETA      time.Duration // Until the prompt finishes, 0 when unknown
+}
+
+// EstimatePrompt estimates a pending or running prompt's queue position and
+// time to finish. The ETA assumes prompts take as long as the recent ones
+// using the same environment, and run as many at a time as are running now.
+// Finished prompts get nil.
+func (s *WorkspaceService) EstimatePrompt(ctx context.Context, prompt *storage.PromptTask) (*PromptEstimate, error) {
+	if prompt.Status != storage.PromptStatusPending && prompt.Status != storage.PromptStatusRunning {
+		return nil, nil
+	}
+
+	avg, err := s.store.PromptTasks().AverageDuration(ctx, prompt.WorkspaceID, promptDurationSamples)
+	if err != nil {
+		return nil, err
+	}
+
+	estimate := &PromptEstimate{}
+	if prompt.Status == storage.PromptStatusRunning {
+		if prompt.StartedAt != nil && avg > time.Since(*prompt.StartedAt) {
+			estimate.ETA = avg - time.Since(*prompt.StartedAt)
+		}
+		return estimate, nil
+	}
+
+	ahead, err := s.store.PromptTasks().CountPendingAhead(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	running, err := s.store.PromptTasks().CountByStatus(ctx, storage.PromptStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	if running < 1 {
+		running = 1
+	}
+
+	estimate.Position = ahead + 1
+	if avg > 0 {
+		rounds := (ahead + running - 1) / running // Rounds of prompts to wait for
+		estimate.ETA = time.Duration(rounds+1) * avg
+	}
+	return estimate, nil
+}
+
 // ListPrompts lists prompts for a workspace
 func (s *WorkspaceService) ListPrompts(ctx context.Context, workspaceID uuid.UUID) ([]*storage.PromptTask, error) {
 	return s.store.PromptTasks().ListByWorkspace(ctx, workspaceID, 100) // Default limit of 100
 }
 
-// CancelPrompt cancels a pending prompt
+// CancelPrompt cancels a pending prompt, dropping its attachments' content
 func (s *WorkspaceService) CancelPrompt(ctx context.Context, promptID uuid.UUID) error {
-	return s.store.PromptTasks().Cancel(ctx, promptID)
+	if err := s.store.PromptTasks().Cancel(ctx, promptID); err != nil {
+		return err
+	}
+	if err := s.store.PromptAttachments().ClearContent(ctx, promptID); err != nil {
+		log.Printf("Warning: Failed to clean up attachments of cancelled prompt %s: %v", promptID, err)
+	}
+	return nil
 }
 
 // AddSecret adds a secret to a workspace
@@ -297,15 +854,30 @@ func (s *WorkspaceService) AddSecret(ctx context.Context, workspaceID uuid.UUID,
 		Description: req.Description,
 	}
 
-	return s.addSecret(ctx, workspaceID, secretReq, scope)
+	return s.addSecret(ctx, s.store, workspaceID, secretReq, scope)
 }
 
 // addSecret is an internal method to add an encrypted secret
-func (s *WorkspaceService) addSecret(ctx context.Context, workspaceID uuid.UUID, req *api.SecretRequest, scope string) (uuid.UUID, error) {
+func (s *WorkspaceService) addSecret(ctx context.Context, store storage.Store, workspaceID uuid.UUID, req *api.SecretRequest, scope string) (uuid.UUID, error) {
+	secret, err := s.newSecret(req, scope)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	secret.WorkspaceID = &workspaceID
+
+	if err := store.Secrets().Create(ctx, secret); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to store secret: %w", err)
+	}
+
+	return secret.ID, nil
+}
+
+// newSecret encrypts a secret request into a record without an owner
+func (s *WorkspaceService) newSecret(req *api.SecretRequest, scope string) (*storage.WorkspaceSecret, error) {
 	// Encrypt the secret value
 	encryptedValue, nonce, err := s.encryptSecret([]byte(req.Value))
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("failed to encrypt secret: %w", err)
+		return nil, fmt.Errorf("failed to encrypt secret: %w", err)
 	}
 
 	secretType := req.Type
@@ -313,9 +885,8 @@ func (s *WorkspaceService) addSecret(ctx context.Context, workspaceID uuid.UUID,
 		secretType = "api_key"
 	}
 
-	secret := &storage.WorkspaceSecret{
+	return &storage.WorkspaceSecret{
 		ID:              uuid.New(),
-		WorkspaceID:     &workspaceID,
 		Name:            req.Name,
 		Description:     stringPtr(req.Description),
 		SecretType:      secretType,
@@ -323,7 +894,32 @@ func (s *WorkspaceService) addSecret(ctx context.Context, workspaceID uuid.UUID,
 		EncryptionKeyID: "default",
 		Nonce:           nonce,
 		Scope:           scope,
+	}, nil
+}
+
+// ListSecrets lists secrets for a workspace (names only, no values)
+func (s *WorkspaceService) ListSecrets(ctx context.Context, workspaceID uuid.UUID) ([]*storage.WorkspaceSecret, error) {
+	return s.store.Secrets().ListByWorkspace(ctx, workspaceID)
+}
+
+// AddEnvironmentSecret adds a secret to an environment. Every workspace
+// created from the environment inherits it unless it has a secret of the
+// same name.
+func (s *WorkspaceService) AddEnvironmentSecret(ctx context.Context, environmentID uuid.UUID, req *api.AddSecretRequest) (uuid.UUID, error) {
+	if _, err := s.store.Environments().Get(ctx, environmentID); err != nil {
+		return uuid.Nil, fmt.Errorf("environment not found: %w", err)
+	}
+
+	secret, err := s.newSecret(&api.SecretRequest{
+		Name:        req.Name,
+		Value:       req.Value,
+		Type:        req.Type,
+		Description: req.Description,
+	}, "environment")
+	if err != nil {
+		return uuid.Nil, err
 	}
+	secret.EnvironmentID = &environmentID
 
 	if err := s.store.Secrets().Create(ctx, secret); err != nil {
 		return uuid.Nil, fmt.Errorf("failed to store secret: %w", err)
@@ -332,9 +928,71 @@ func (s *WorkspaceService) addSecret(ctx context.Context, workspaceID uuid.UUID,
 	return secret.ID, nil
 }
 
-// ListSecrets lists secrets for a workspace (names only, no values)
-func (s *WorkspaceService) ListSecrets(ctx context.Context, workspaceID uuid.UUID) ([]*storage.WorkspaceSecret, error) {
-	return s.store.Secrets().ListByWorkspace(ctx, workspaceID)
+// ListEnvironmentSecrets lists secrets for an environment (names only, no values)
+func (s *WorkspaceService) ListEnvironmentSecrets(ctx context.Context, environmentID uuid.UUID) ([]*storage.WorkspaceSecret, error) {
+	return s.store.Secrets().ListByEnvironment(ctx, environmentID)
+}
+
+// EffectiveSecrets lists the secrets a workspace's VM receives: its
+// environment's secrets, overridden by its own secrets of the same name
+func (s *WorkspaceService) EffectiveSecrets(ctx context.Context, workspaceID uuid.UUID) ([]*storage.WorkspaceSecret, error) {
+	workspace, err := s.store.Workspaces().Get(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("workspace not found: %w", err)
+	}
+
+	secrets, err := s.store.Secrets().ListByWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if workspace.EnvironmentID == nil {
+		return secrets, nil
+	}
+
+	inherited, err := s.store.Secrets().ListByEnvironment(ctx, *workspace.EnvironmentID)
+	if err != nil {
+		return nil, err
+	}
+	overridden := make(map[string]bool, len(secrets))
+	for _, secret := range secrets {
+		overridden[secret.Name] = true
+	}
+	for _, secret := range inherited {
+		if !overridden[secret.Name] {
+			secrets = append(secrets, secret)
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+	return secrets, nil
+}
+
+// RecordSecretUsage records secrets reaching a workspace's VM
+func (s *WorkspaceService) RecordSecretUsage(ctx context.Context, secrets []*storage.WorkspaceSecret, workspaceID uuid.UUID, vmID *uuid.UUID, requestType string) error {
+	now := time.Now()
+	for _, secret := range secrets {
+		usage := &storage.SecretUsage{
+			SecretID:    secret.ID,
+			WorkspaceID: &workspaceID,
+			VMID:        vmID,
+			RequestType: requestType,
+			UsedAt:      now,
+		}
+		if err := s.store.Secrets().RecordUsage(ctx, usage); err != nil {
+			return fmt.Errorf("failed to record usage of secret %s: %w", secret.Name, err)
+		}
+	}
+	return nil
+}
+
+// ListSecretUsage lists the latest usages of a secret, newest first
+func (s *WorkspaceService) ListSecretUsage(ctx context.Context, secretID uuid.UUID, limit int) ([]*storage.SecretUsage, error) {
+	return s.store.Secrets().ListUsage(ctx, secretID, limit)
+}
+
+// UnusedSecrets lists secrets that haven't reached a VM since a time, stale
+// credentials to consider revoking
+func (s *WorkspaceService) UnusedSecrets(ctx context.Context, since time.Time) ([]*storage.WorkspaceSecret, error) {
+	return s.store.Secrets().ListUnused(ctx, since)
 }
 
 // DeleteSecret deletes a secret
@@ -374,7 +1032,17 @@ func (s *WorkspaceService) GetDecryptedSecretByName(ctx context.Context, workspa
 
 // encryptSecret encrypts a secret value using AES-256-GCM
 func (s *WorkspaceService) encryptSecret(plaintext []byte) (ciphertext, nonce []byte, err error) {
-	block, err := aes.NewCipher(s.encryptionKey)
+	return sealSecret(s.encryptionKey, plaintext)
+}
+
+// decryptSecret decrypts a secret value using AES-256-GCM
+func (s *WorkspaceService) decryptSecret(ciphertext, nonce []byte) ([]byte, error) {
+	return openSecret(s.encryptionKey, ciphertext, nonce)
+}
+
+// sealSecret encrypts plaintext with an AES-256 key in GCM mode
+func sealSecret(key, plaintext []byte) (ciphertext, nonce []byte, err error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -393,9 +1061,9 @@ func (s *WorkspaceService) encryptSecret(plaintext []byte) (ciphertext, nonce []
 	return ciphertext, nonce, nil
 }
 
-// decryptSecret decrypts a secret value using AES-256-GCM
-func (s *WorkspaceService) decryptSecret(ciphertext, nonce []byte) ([]byte, error) {
-	block, err := aes.NewCipher(s.encryptionKey)
+// openSecret decrypts ciphertext sealed by sealSecret
+func openSecret(key, ciphertext, nonce []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -423,7 +1091,7 @@ func (s *WorkspaceService) CreateSession(ctx context.Context, workspaceID uuid.U
 		return uuid.Nil, fmt.Errorf("workspace not found: %w", err)
 	}
 
-	if workspace.Status != "ready" {
+	if workspace.Status != storage.WorkspaceStatusReady {
 		return uuid.Nil, fmt.Errorf("workspace is not ready (status: %s)", workspace.Status)
 	}
 
@@ -486,3 +1154,16 @@ func stringPtr(s string) *string {
 	}
 	return &s
 }
+
+// uniqueStrings removes duplicates while preserving order
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
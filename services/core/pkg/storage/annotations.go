@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// Annotation limits
+const (
+	MaxAnnotationLength = 256     // Owner, purpose and link titles, in bytes
+	MaxAnnotationLinks  = 20      // Links per workspace or environment
+	MaxNotesLength      = 1 << 16 // Notes, in bytes
+)
+
+// Annotations describe a workspace or environment to the people browsing
+// the cluster: who owns it, what it is for and where to read more. Nothing
+// acts on them.
+type Annotations struct {
+	Owner   string           `json:"owner,omitempty"`
+	Purpose string           `json:"purpose,omitempty"`
+	Links   []AnnotationLink `json:"links,omitempty"`
+	Notes   string           `json:"notes,omitempty"` // Markdown
+}
+
+// AnnotationLink points to a related page, e.g. a runbook or a ticket
+type AnnotationLink struct {
+	Title string `json:"title,omitempty"`
+	URL   string `json:"url"`
+}
+
+// IsEmpty reports whether no annotation is set
+func (a *Annotations) IsEmpty() bool {
+	return a == nil || (a.Owner == "" && a.Purpose == "" && len(a.Links) == 0 && a.Notes == "")
+}
+
+// ValidateAnnotations checks annotation sizes and that links are http(s)
+// URLs, since they end up as links in rendered pages
+func ValidateAnnotations(a *Annotations) error {
+	if a == nil {
+		return nil
+	}
+	if len(a.Owner) > MaxAnnotationLength || len(a.Purpose) > MaxAnnotationLength {
+		return fmt.Errorf("owner and purpose must be at most %d bytes", MaxAnnotationLength)
+	}
+	if len(a.Notes) > MaxNotesLength {
+		return fmt.Errorf("notes must be at most %d bytes", MaxNotesLength)
+	}
+	if len(a.Links) > MaxAnnotationLinks {
+		return fmt.Errorf("at most %d links", MaxAnnotationLinks)
+	}
+	for i, link := range a.Links {
+		if len(link.Title) > MaxAnnotationLength {
+			return fmt.Errorf("link %d: title must be at most %d bytes", i, MaxAnnotationLength)
+		}
+		u, err := url.Parse(link.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("link %d: %q must be an http or https URL", i, link.URL)
+		}
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface
+func (a *Annotations) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	return json.Marshal(a)
+}
+
+// Scan implements the sql.Scanner interface
+func (a *Annotations) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, a)
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// BackupTables are the control-plane tables included in backups, in the
+// order they are restored. Runtime state (VMs, tasks, prompts, sessions,
+// metrics and events) is left out.
+var BackupTables = []string{
+	"environments",
+	"workspaces",
+	"workspace_status_history",
+	"workspace_prep_steps",
+	"workspace_secrets",
+	"workers",
+	"vm_gc_policies",
+	"capacity_policies",
+	"alert_rules",
+	"clusters",
+	"integration_configs",
+	"workspace_reap_policies",
+}
+
+// Backuper is implemented by stores that can export and import whole tables
+// as portable JSON rows (see service.BackupService). Rows are JSON objects
+// keyed by column name; binary columns such as secret ciphertext are
+// encoded as strings and restored byte for byte.
+type Backuper interface {
+	// SchemaVersion returns the version of the last applied migration
+	SchemaVersion(ctx context.Context) (uint, error)
+
+	// ExportRows returns every row of one of the BackupTables
+	ExportRows(ctx context.Context, table string) ([]json.RawMessage, error)
+
+	// ImportRows inserts rows into the BackupTables in one transaction and
+	// returns the number inserted per table. Rows that conflict with an
+	// existing row (same ID or unique name) are skipped.
+	ImportRows(ctx context.Context, tables map[string][]json.RawMessage) (map[string]int, error)
+}
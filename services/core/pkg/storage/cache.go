@@ -0,0 +1,18 @@
+package storage
+
+// CacheStats reports a store's read cache activity since it started
+type CacheStats struct {
+	Enabled       bool    `json:"enabled"`
+	Listening     bool    `json:"listening"` // Invalidation listener connected; hits are only served while it is
+	Entries       int     `json:"entries"`
+	Hits          uint64  `json:"hits"`
+	Misses        uint64  `json:"misses"`
+	HitRate       float64 `json:"hit_rate"` // Hits / (hits + misses), 0 before any lookups
+	Invalidations uint64  `json:"invalidations"`
+	Flushes       uint64  `json:"flushes"` // Whole-cache flushes after the listener reconnected
+}
+
+// CacheReporter is implemented by stores with a read cache
+type CacheReporter interface {
+	CacheStats() CacheStats
+}
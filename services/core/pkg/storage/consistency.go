@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+type maxReplicaLagKey struct{}
+
+// WithPrimaryReads returns a context whose reads go to the primary database,
+// for callers that must see writes made just before (their own or another
+// component's). Stores without read replicas ignore it.
+func WithPrimaryReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, maxReplicaLagKey{}, time.Duration(0))
+}
+
+// WithMaxReplicaLag returns a context whose reads may only use replicas
+// lagging the primary by at most maxLag. It tightens, never loosens, the
+// store's configured limit.
+func WithMaxReplicaLag(ctx context.Context, maxLag time.Duration) context.Context {
+	if maxLag < 0 {
+		maxLag = 0
+	}
+	return context.WithValue(ctx, maxReplicaLagKey{}, maxLag)
+}
+
+// MaxReplicaLag returns the replica lag limit carried by ctx, if any. 0
+// means reads must go to the primary.
+func MaxReplicaLag(ctx context.Context) (time.Duration, bool) {
+	maxLag, ok := ctx.Value(maxReplicaLagKey{}).(time.Duration)
+	return maxLag, ok
+}
+
+// ReplicaStatus is a read replica's state as last checked by its store
+type ReplicaStatus struct {
+	Host       string    `json:"host"`
+	Healthy    bool      `json:"healthy"`
+	LagSeconds float64   `json:"lag_seconds"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// ReplicaReporter is implemented by stores with read replicas
+type ReplicaReporter interface {
+	ReplicaStatus() []ReplicaStatus
+}
@@ -2,8 +2,13 @@ package storage
 
 import (
 	"context"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/redact"
 	"github.com/google/uuid"
 )
 
@@ -34,6 +39,159 @@ type MCPServerConfig struct {
 	Env map[string]string `json:"env,omitempty"`
 }
 
+// SandboxProfile defines isolation applied to VMs at boot for running untrusted code
+type SandboxProfile struct {
+	// Mount the root filesystem read-only
+	ReadOnlyRootFS bool `json:"read_only_rootfs,omitempty"`
+
+	// Writable tmpfs mounted over this path (e.g. /workspace)
+	TmpfsWorkdir string `json:"tmpfs_workdir,omitempty"`
+	TmpfsSizeMB  int    `json:"tmpfs_size_mb,omitempty"`
+
+	// Boot without a network interface
+	NoNetwork bool `json:"no_network,omitempty"`
+
+	// Hide other users' processes in /proc
+	RestrictProc bool `json:"restrict_proc,omitempty"`
+}
+
+// DockerProfile runs a Docker daemon in the environment's VMs, so
+// workspaces can use docker and docker compose
+type DockerProfile struct {
+	// DiskSizeMB grows each VM's root filesystem to this size to make room
+	// for images and volumes (0 = keep the image's size)
+	DiskSizeMB int `json:"disk_size_mb,omitempty"`
+
+	// Registries are allowed through the egress proxy in addition to Docker
+	// Hub, e.g. "ghcr.io"
+	Registries []string `json:"registries,omitempty"`
+}
+
+// ServiceSpec declares a sidecar: an auxiliary VM (a database, cache or
+// cloud emulator) booted alongside each workspace VM spawned from an
+// environment and deleted with it
+type ServiceSpec struct {
+	// Name is the hostname the workspace VM reaches the service by
+	Name string `json:"name"`
+
+	// Command starts the service in the background of its VM, e.g.
+	// "redis-server --protected-mode no"
+	Command string `json:"command"`
+
+	// Ports the service listens on; the workspace VM waits until they accept
+	// connections
+	Ports []int `json:"ports,omitempty"`
+
+	// Env is exported to Command
+	Env map[string]string `json:"env,omitempty"`
+
+	// RootFSImage is a rootfs image with the service installed (default: the
+	// worker's template)
+	RootFSImage string `json:"rootfs_image,omitempty"`
+
+	VCPUs    int `json:"vcpus,omitempty"`     // Default 1
+	MemoryMB int `json:"memory_mb,omitempty"` // Default 512
+}
+
+// serviceName matches hostnames usable for a sidecar
+var serviceName = regexp.MustCompile(`^[a-z][a-z0-9-]{0,62}$`)
+
+// ValidateServices checks sidecar names, commands, ports and sizes
+func ValidateServices(services []ServiceSpec) error {
+	seen := make(map[string]bool, len(services))
+	for i, svc := range services {
+		if !serviceName.MatchString(svc.Name) {
+			return fmt.Errorf("service %d: name %q must be a lowercase hostname", i, svc.Name)
+		}
+		if seen[svc.Name] {
+			return fmt.Errorf("service %q is declared twice", svc.Name)
+		}
+		seen[svc.Name] = true
+		if strings.TrimSpace(svc.Command) == "" {
+			return fmt.Errorf("service %q has no command", svc.Name)
+		}
+		for _, port := range svc.Ports {
+			if port < 1 || port > 65535 {
+				return fmt.Errorf("service %q: invalid port %d", svc.Name, port)
+			}
+		}
+		if svc.VCPUs < 0 || svc.MemoryMB < 0 {
+			return fmt.Errorf("service %q: vcpus and memory_mb must not be negative", svc.Name)
+		}
+	}
+	return nil
+}
+
+// registryDomain matches a registry's domain name, e.g. "ghcr.io"
+var registryDomain = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)+$`)
+
+// dockerMinDiskSizeMB is the smallest rootfs worth growing for images
+const dockerMinDiskSizeMB = 2048
+
+// ValidateDocker checks a Docker profile's disk size and registry domains.
+// The domains end up in the egress proxy's config, so nothing but domain
+// names gets through.
+func ValidateDocker(docker *DockerProfile) error {
+	if docker == nil {
+		return nil
+	}
+	if docker.DiskSizeMB != 0 && docker.DiskSizeMB < dockerMinDiskSizeMB {
+		return fmt.Errorf("disk_size_mb must be 0 or at least %d", dockerMinDiskSizeMB)
+	}
+	for _, registry := range docker.Registries {
+		if !registryDomain.MatchString(registry) {
+			return fmt.Errorf("registry %q must be a domain name, e.g. ghcr.io", registry)
+		}
+	}
+	return nil
+}
+
+// Environment failover policies, deciding where a workspace's on-demand VM
+// may respawn when its zone has no healthy workers
+const (
+	EnvironmentFailoverNone    = "none"     // Wait for a worker in the workspace's zone
+	EnvironmentFailoverAnyZone = "any_zone" // Respawn in any zone with a healthy worker
+)
+
+// ValidFailoverPolicy reports whether policy is a known failover policy
+func ValidFailoverPolicy(policy string) bool {
+	return policy == EnvironmentFailoverNone || policy == EnvironmentFailoverAnyZone
+}
+
+// Environment platforms, the guest OS of an environment's VMs
+const (
+	EnvironmentPlatformLinux   = "linux"   // Firecracker VMs or Linux containers
+	EnvironmentPlatformWindows = "windows" // Windows containers on docker-windows workers
+)
+
+// ValidatePlatform checks an environment's platform, and that a Windows
+// environment uses none of the features only Linux guests have
+func ValidatePlatform(env *Environment) error {
+	switch env.Platform {
+	case "", EnvironmentPlatformLinux:
+		return nil
+	case EnvironmentPlatformWindows:
+	default:
+		return fmt.Errorf("platform must be %q or %q", EnvironmentPlatformLinux, EnvironmentPlatformWindows)
+	}
+
+	switch {
+	case len(env.Tools) > 0:
+		return fmt.Errorf("windows environments can't install tools; bake them into the worker's Windows image")
+	case env.Docker != nil:
+		return fmt.Errorf("windows environments can't run docker")
+	case len(env.Services) > 0:
+		return fmt.Errorf("windows environments can't run services")
+	case len(env.KernelArgs) > 0:
+		return fmt.Errorf("windows environments have no kernel args")
+	case env.RootFSImage != nil:
+		return fmt.Errorf("windows environments can't boot from a saved rootfs image")
+	case env.Sandbox != nil && (env.Sandbox.ReadOnlyRootFS || env.Sandbox.TmpfsWorkdir != "" || env.Sandbox.RestrictProc):
+		return fmt.Errorf("windows sandboxes only support no_network")
+	}
+	return nil
+}
+
 // Environment represents a reusable workspace template
 type Environment struct {
 	ID          uuid.UUID `db:"id" json:"id"`
@@ -63,10 +221,109 @@ type Environment struct {
 	// Idle timeout in seconds before VM is destroyed
 	IdleTimeoutSeconds int `db:"idle_timeout_seconds" json:"idle_timeout_seconds"`
 
+	// Default time limit for prompts in seconds (0 = the worker's default)
+	PromptTimeoutSeconds int `db:"prompt_timeout_seconds" json:"prompt_timeout_seconds,omitempty"`
+
+	// Sandbox profile applied to VMs (stored as JSONB object in DB, nil = none)
+	Sandbox *SandboxProfile `json:"sandbox,omitempty"`
+
+	// RootFSImage is a saved rootfs image used instead of the default template
+	RootFSImage *string `db:"rootfs_image" json:"rootfs_image,omitempty"`
+
+	// RootFSImageWorkerID is the worker whose disk holds RootFSImage, when
+	// only one does; workspaces booting from it are created there
+	RootFSImageWorkerID *string `db:"rootfs_image_worker_id" json:"rootfs_image_worker_id,omitempty"`
+
+	// SourceWorkspaceID is set when the environment was saved from a workspace
+	SourceWorkspaceID *uuid.UUID `db:"source_workspace_id" json:"source_workspace_id,omitempty"`
+
+	// KernelArgs are extra kernel boot args for the environment's VMs (stored
+	// as JSONB array in DB), checked with vmm.ValidateKernelArgs
+	KernelArgs []string `json:"kernel_args,omitempty"`
+
+	// Docker runs dockerd in the environment's VMs (stored as JSONB object
+	// in DB, nil = no Docker)
+	Docker *DockerProfile `json:"docker,omitempty"`
+
+	// Services are sidecar VMs started with each workspace VM (stored as
+	// JSONB array in DB), checked with ValidateServices
+	Services []ServiceSpec `json:"services,omitempty"`
+
+	// FailoverPolicy is one of the EnvironmentFailover* policies (default none)
+	FailoverPolicy string `db:"failover_policy" json:"failover_policy"`
+
+	// SchedulingStrategy places the environment's workspace VMs on workers,
+	// overriding the gateway's strategy (see the scheduler package). Empty
+	// uses the gateway's.
+	SchedulingStrategy string `db:"scheduling_strategy" json:"scheduling_strategy,omitempty"`
+
+	// Region routes workspace creation to the federated cluster registered
+	// for it (see Cluster). Empty or the gateway's own region means local.
+	Region string `db:"region" json:"region,omitempty"`
+
+	// Firewall holds L3/L4 rules programmed on the TAP device of each of the
+	// environment's VMs (stored as JSONB object in DB, nil = no filtering).
+	// Set with SetFirewall.
+	Firewall *types.FirewallPolicy `json:"firewall,omitempty"`
+
+	// ToolLock pins the versions of the tools installed in the environment's
+	// VMs (stored as JSONB object in DB, nil = unpinned). Set with SetToolLock.
+	ToolLock *EnvironmentLockfile `json:"tool_lock,omitempty"`
+
+	// Platform is one of the EnvironmentPlatform* platforms (default linux),
+	// checked with ValidatePlatform
+	Platform string `db:"platform" json:"platform"`
+
+	// Redaction masks secrets in the output of commands and prompts run in
+	// the environment's VMs before it is stored (stored as JSONB object in
+	// DB, nil = the default: the workspace's secrets and common token formats)
+	Redaction *redact.Policy `json:"redaction,omitempty"`
+
+	// Annotations describe the environment to people (stored as JSONB
+	// object in DB, nil = none). Set with SetAnnotations.
+	Annotations *Annotations `json:"annotations,omitempty"`
+
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 }
 
+// CanFailOver reports whether workspaces using the environment may respawn
+// their VM outside their zone. A saved rootfs image is a file on the disk of
+// the worker that saved it, so environments booting from one stay put.
+func (e *Environment) CanFailOver() bool {
+	return e.FailoverPolicy == EnvironmentFailoverAnyZone && e.RootFSImage == nil
+}
+
+// IsWindows reports whether the environment's VMs are Windows guests
+func (e *Environment) IsWindows() bool {
+	return e.Platform == EnvironmentPlatformWindows
+}
+
+// RedactionPolicy returns the policy masking secrets in output from the
+// environment's VMs
+func (e *Environment) RedactionPolicy() redact.Policy {
+	if e == nil || e.Redaction == nil {
+		return redact.Policy{}
+	}
+	return *e.Redaction
+}
+
+// RequestedTools returns the tools the environment installs in its VMs on
+// top of the defaults: its own, plus Docker when it runs dockerd
+func (e *Environment) RequestedTools() []string {
+	if e.Docker == nil {
+		return e.Tools
+	}
+	return append(append([]string{}, e.Tools...), "docker")
+}
+
+// EnvironmentUsage counts the workspaces created from an environment
+type EnvironmentUsage struct {
+	EnvironmentID uuid.UUID `db:"environment_id" json:"environment_id"`
+	Workspaces    int       `db:"workspaces" json:"workspaces"`
+	LastUsedAt    time.Time `db:"last_used_at" json:"last_used_at"`
+}
+
 // EnvironmentRepository defines environment data access operations
 type EnvironmentRepository interface {
 	// Create creates a new environment
@@ -81,9 +338,26 @@ type EnvironmentRepository interface {
 	// List retrieves all environments
 	List(ctx context.Context) ([]*Environment, error)
 
-	// Update updates an existing environment
+	// Update updates an existing environment. Its tool lock, firewall and
+	// annotations are left as is.
 	Update(ctx context.Context, env *Environment) error
 
+	// SetToolLock replaces an environment's tool lock (nil unlocks it)
+	// without changing its UpdatedAt
+	SetToolLock(ctx context.Context, id uuid.UUID, lock *EnvironmentLockfile) error
+
+	// SetFirewall replaces an environment's firewall policy (nil removes
+	// it) without changing its UpdatedAt
+	SetFirewall(ctx context.Context, id uuid.UUID, policy *types.FirewallPolicy) error
+
+	// SetAnnotations replaces an environment's annotations (nil removes
+	// them) without changing its UpdatedAt
+	SetAnnotations(ctx context.Context, id uuid.UUID, annotations *Annotations) error
+
 	// Delete deletes an environment by ID
 	Delete(ctx context.Context, id uuid.UUID) error
+
+	// ListUsage ranks environments by the workspaces created from them
+	// since the given time, most used first (limit <= 0 = all)
+	ListUsage(ctx context.Context, since time.Time, limit int) ([]*EnvironmentUsage, error)
 }
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"time"
+)
+
+// LockedTool pins one tool of an environment to an exact release
+type LockedTool struct {
+	Name       string `json:"name"`
+	Constraint string `json:"constraint"`         // Version asked for when resolving ("latest" if none)
+	Version    string `json:"version"`            // Exact version installed
+	Artifact   string `json:"artifact,omitempty"` // URL or package the version is installed from
+	Checksum   string `json:"checksum,omitempty"` // "<algorithm>:<hex digest>" of the artifact
+}
+
+// EnvironmentLockfile holds the resolved versions of an environment's tools.
+// Once set, every VM spawned from the environment installs exactly these
+// releases until the environment is locked again.
+type EnvironmentLockfile struct {
+	Tools []LockedTool `json:"tools"`
+
+	// UpdatedAt of the environment when it was locked; tools added to the
+	// environment since then are installed unpinned
+	EnvironmentUpdatedAt time.Time `json:"environment_updated_at"`
+	ResolvedAt           time.Time `json:"resolved_at"`
+}
+
+// Tool returns the locked release of a tool, or nil if it isn't locked
+func (l *EnvironmentLockfile) Tool(name string) *LockedTool {
+	for i := range l.Tools {
+		if l.Tools[i].Name == name {
+			return &l.Tools[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExecutionEnvironment fingerprints what a prompt ran against, so its result
+// can be reproduced after the workspace's environment template has changed
+type ExecutionEnvironment struct {
+	WorkerID string `json:"worker_id,omitempty"`
+	VMID     string `json:"vm_id"`
+
+	// Environment template as it was when the prompt ran
+	EnvironmentID        *uuid.UUID `json:"environment_id,omitempty"`
+	EnvironmentName      string     `json:"environment_name,omitempty"`
+	EnvironmentUpdatedAt *time.Time `json:"environment_updated_at,omitempty"`
+	GitRepoURL           string     `json:"git_repo_url,omitempty"`
+	GitBranch            string     `json:"git_branch,omitempty"`
+
+	// Image the VM booted from and its SHA-256 digest, when it is a file
+	RootFSImage       string `json:"rootfs_image,omitempty"`
+	RootFSImageSHA256 string `json:"rootfs_image_sha256,omitempty"`
+
+	// Resolved inside the VM just before the prompt ran
+	ToolVersions map[string]string `json:"tool_versions"`
+	AIAssistant  string            `json:"ai_assistant"`
+	AgentVersion string            `json:"agent_version,omitempty"`
+	GitCommit    string            `json:"git_commit,omitempty"` // HEAD of the working directory
+	EnvVarNames  []string          `json:"env_var_names"`        // Names only; values may be secrets
+	WorkingDir   string            `json:"working_directory,omitempty"`
+
+	CapturedAt time.Time `json:"captured_at"`
+}
+
+// Value implements the driver.Valuer interface
+func (e *ExecutionEnvironment) Value() (driver.Value, error) {
+	if e == nil {
+		return nil, nil
+	}
+	return json.Marshal(e)
+}
+
+// Scan implements the sql.Scanner interface
+func (e *ExecutionEnvironment) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, e)
+}
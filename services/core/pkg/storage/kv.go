@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrKVNotFound is returned when a key-value entry is missing or expired
+var ErrKVNotFound = errors.New("kv entry not found")
+
+// KVEntry is a piece of runtime coordination state, such as pool
+// membership, a lock or a schedule cursor. Each subsystem keeps its entries
+// in its own namespace. Entries past their expiry count as missing.
+type KVEntry struct {
+	Namespace string     `db:"namespace" json:"namespace"`
+	Key       string     `db:"key" json:"key"`
+	Value     []byte     `db:"value" json:"value"`
+	Version   int64      `db:"version" json:"version"` // New on every write and never reused, see CompareAndSwap
+	ExpiresAt *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+	UpdatedAt time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// KVRepository stores key-value runtime state shared by workers and
+// gateways. Writes take a ttl after which the entry expires; 0 keeps it
+// until deleted. Writes fill in the entry's Version, ExpiresAt and
+// UpdatedAt. Expiry is judged by the database's clock, so hosts with
+// skewed clocks agree on it.
+type KVRepository interface {
+	// Get returns a live entry, or ErrKVNotFound
+	Get(ctx context.Context, namespace, key string) (*KVEntry, error)
+	// List returns the live entries of a namespace whose key starts with
+	// prefix, ordered by key
+	List(ctx context.Context, namespace, prefix string) ([]*KVEntry, error)
+
+	// Set creates or replaces an entry
+	Set(ctx context.Context, entry *KVEntry, ttl time.Duration) error
+	// SetIfAbsent creates an entry unless a live one exists, reporting
+	// whether it did. Locks are taken with it.
+	SetIfAbsent(ctx context.Context, entry *KVEntry, ttl time.Duration) (bool, error)
+	// CompareAndSwap replaces a live entry still at entry.Version,
+	// reporting whether it did. Locks are renewed with it.
+	CompareAndSwap(ctx context.Context, entry *KVEntry, ttl time.Duration) (bool, error)
+
+	// Delete removes an entry; a missing one is not an error
+	Delete(ctx context.Context, namespace, key string) error
+	// CompareAndDelete removes an entry still at version, reporting whether
+	// it did. Locks are released with it.
+	CompareAndDelete(ctx context.Context, namespace, key string, version int64) (bool, error)
+	// DeleteExpired prunes expired entries and returns how many it removed
+	DeleteExpired(ctx context.Context) (int64, error)
+}
@@ -200,6 +200,9 @@ func (m *MemoryStore) CreateVM(ctx context.Context, vm *types.VM) error {
 	if _, exists := m.vms[vm.ID]; exists {
 		return fmt.Errorf("VM with ID '%s' already exists", vm.ID)
 	}
+	if !vm.Status.Valid() {
+		return fmt.Errorf("invalid VM status: %q", vm.Status)
+	}
 
 	vm.CreatedAt = time.Now()
 	m.vms[vm.ID] = vm
@@ -222,9 +225,13 @@ func (m *MemoryStore) UpdateVM(ctx context.Context, vm *types.VM) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, exists := m.vms[vm.ID]; !exists {
+	existing, exists := m.vms[vm.ID]
+	if !exists {
 		return fmt.Errorf("VM with ID '%s' not found", vm.ID)
 	}
+	if err := existing.Status.TransitionTo(vm.Status); err != nil {
+		return fmt.Errorf("failed to update VM '%s': %w", vm.ID, err)
+	}
 
 	m.vms[vm.ID] = vm
 	return nil
@@ -0,0 +1,207 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+type alertRuleRepository struct {
+	db dbtx
+}
+
+// alertRuleRow is an alert_rules row; notify is a JSONB array of targets
+type alertRuleRow struct {
+	ID            uuid.UUID       `db:"id"`
+	Name          string          `db:"name"`
+	Kind          string          `db:"kind"`
+	Metric        string          `db:"metric"`
+	Operator      string          `db:"operator"`
+	Threshold     float64         `db:"threshold"`
+	WindowSeconds int             `db:"window_seconds"`
+	Severity      string          `db:"severity"`
+	Notify        []byte          `db:"notify"`
+	Enabled       bool            `db:"enabled"`
+	Firing        bool            `db:"firing"`
+	LastValue     sql.NullFloat64 `db:"last_value"`
+	LastFiredAt   sql.NullTime    `db:"last_fired_at"`
+	CreatedAt     time.Time       `db:"created_at"`
+	UpdatedAt     time.Time       `db:"updated_at"`
+}
+
+const alertRuleColumns = `
+	id, name, kind, metric, operator, threshold, window_seconds, severity,
+	notify, enabled, firing, last_value, last_fired_at, created_at, updated_at`
+
+func (r *alertRuleRow) toAlertRule() (*storage.AlertRule, error) {
+	rule := &storage.AlertRule{
+		ID:            r.ID,
+		Name:          r.Name,
+		Kind:          r.Kind,
+		Metric:        r.Metric,
+		Operator:      r.Operator,
+		Threshold:     r.Threshold,
+		WindowSeconds: r.WindowSeconds,
+		Severity:      r.Severity,
+		Enabled:       r.Enabled,
+		Firing:        r.Firing,
+		CreatedAt:     r.CreatedAt,
+		UpdatedAt:     r.UpdatedAt,
+	}
+	if r.LastValue.Valid {
+		rule.LastValue = &r.LastValue.Float64
+	}
+	if r.LastFiredAt.Valid {
+		rule.LastFiredAt = &r.LastFiredAt.Time
+	}
+	if len(r.Notify) > 0 {
+		if err := json.Unmarshal(r.Notify, &rule.Notify); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal notify: %w", err)
+		}
+	}
+
+	return rule, nil
+}
+
+// marshalAlertTargets converts alert targets to a JSON array, defaulting to []
+func marshalAlertTargets(targets []storage.AlertTarget) ([]byte, error) {
+	if len(targets) == 0 {
+		return []byte("[]"), nil
+	}
+	data, err := json.Marshal(targets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notify: %w", err)
+	}
+	return data, nil
+}
+
+func (r *alertRuleRepository) Create(ctx context.Context, rule *storage.AlertRule) error {
+	notifyJSON, err := marshalAlertTargets(rule.Notify)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO alert_rules (
+			id, name, kind, metric, operator, threshold, window_seconds,
+			severity, notify, enabled, created_at, updated_at
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW()
+		)
+		RETURNING created_at, updated_at
+	`
+
+	err = r.db.QueryRowContext(ctx, query,
+		rule.ID, rule.Name, rule.Kind, rule.Metric, rule.Operator, rule.Threshold,
+		rule.WindowSeconds, rule.Severity, notifyJSON, rule.Enabled,
+	).Scan(&rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create alert rule: %w", err)
+	}
+
+	return nil
+}
+
+func (r *alertRuleRepository) Get(ctx context.Context, id uuid.UUID) (*storage.AlertRule, error) {
+	var row alertRuleRow
+	query := `SELECT` + alertRuleColumns + ` FROM alert_rules WHERE id = $1`
+
+	err := r.db.GetContext(ctx, &row, query, id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("alert rule not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alert rule: %w", err)
+	}
+
+	return row.toAlertRule()
+}
+
+func (r *alertRuleRepository) List(ctx context.Context) ([]*storage.AlertRule, error) {
+	var rows []alertRuleRow
+	query := `SELECT` + alertRuleColumns + ` FROM alert_rules ORDER BY name`
+
+	if err := r.db.SelectContext(ctx, &rows, query); err != nil {
+		return nil, fmt.Errorf("failed to list alert rules: %w", err)
+	}
+
+	rules := make([]*storage.AlertRule, 0, len(rows))
+	for i := range rows {
+		rule, err := rows[i].toAlertRule()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func (r *alertRuleRepository) Update(ctx context.Context, rule *storage.AlertRule) error {
+	notifyJSON, err := marshalAlertTargets(rule.Notify)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE alert_rules SET
+			name = $2, kind = $3, metric = $4, operator = $5, threshold = $6,
+			window_seconds = $7, severity = $8, notify = $9, enabled = $10,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`
+
+	err = r.db.QueryRowContext(ctx, query,
+		rule.ID, rule.Name, rule.Kind, rule.Metric, rule.Operator, rule.Threshold,
+		rule.WindowSeconds, rule.Severity, notifyJSON, rule.Enabled,
+	).Scan(&rule.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("alert rule not found: %s", rule.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update alert rule: %w", err)
+	}
+
+	return nil
+}
+
+func (r *alertRuleRepository) UpdateState(ctx context.Context, id uuid.UUID, firing bool, value *float64, firedAt *time.Time) error {
+	query := `
+		UPDATE alert_rules SET
+			firing = $2,
+			last_value = $3,
+			last_fired_at = COALESCE($4, last_fired_at)
+		WHERE id = $1
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, id, firing, value, firedAt); err != nil {
+		return fmt.Errorf("failed to update alert rule state: %w", err)
+	}
+
+	return nil
+}
+
+func (r *alertRuleRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM alert_rules WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete alert rule: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("alert rule not found: %s", id)
+	}
+
+	return nil
+}
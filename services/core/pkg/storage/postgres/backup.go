@@ -0,0 +1,263 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// backupRef is a foreign key of a backup table. References to rows that
+// aren't in the database (e.g. VMs, which aren't backed up) are cleared, or
+// the row is skipped when it can't exist without its parent.
+type backupRef struct {
+	column   string
+	table    string
+	required bool // Skip the row instead of clearing the reference
+}
+
+var backupRefs = map[string][]backupRef{
+	"workspaces": {
+		{column: "environment_id", table: "environments"},
+		{column: "vm_id", table: "vms"},
+	},
+	"workspace_status_history": {{column: "workspace_id", table: "workspaces", required: true}},
+	"workspace_prep_steps":     {{column: "workspace_id", table: "workspaces", required: true}},
+	// A secret without its workspace or environment would otherwise become global
+	"workspace_secrets": {
+		{column: "workspace_id", table: "workspaces", required: true},
+		{column: "environment_id", table: "environments", required: true},
+	},
+}
+
+// isBackupTable reports whether table is one of storage.BackupTables. Table
+// names are interpolated into queries, so nothing else is accepted.
+func isBackupTable(table string) bool {
+	for _, t := range storage.BackupTables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+// SchemaVersion returns the version recorded by golang-migrate
+func (s *Store) SchemaVersion(ctx context.Context) (uint, error) {
+	var version uint
+	var dirty bool
+	err := s.db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	if dirty {
+		return 0, fmt.Errorf("schema version %d is dirty, fix the failed migration first", version)
+	}
+	return version, nil
+}
+
+// ExportRows returns every row of table as a JSON object
+func (s *Store) ExportRows(ctx context.Context, table string) ([]json.RawMessage, error) {
+	if !isBackupTable(table) {
+		return nil, fmt.Errorf("table %s is not backed up", table)
+	}
+
+	var q dbtx = s.db
+	if s.tx != nil {
+		q = s.tx
+	}
+
+	var rows []string
+	query := fmt.Sprintf(`SELECT row_to_json(t)::text FROM %s t`, pq.QuoteIdentifier(table))
+	if err := q.SelectContext(ctx, &rows, query); err != nil {
+		return nil, fmt.Errorf("failed to export %s: %w", table, err)
+	}
+
+	result := make([]json.RawMessage, len(rows))
+	for i, row := range rows {
+		result[i] = json.RawMessage(row)
+	}
+	return result, nil
+}
+
+// ImportRows inserts exported rows in storage.BackupTables order in one
+// transaction. Environments' source_workspace_id points the other way, so it
+// is set once the workspaces are in. Restored workspaces left without a VM
+// are marked idle, and ones that were still being created are marked failed,
+// since their tasks aren't part of the backup.
+func (s *Store) ImportRows(ctx context.Context, tables map[string][]json.RawMessage) (map[string]int, error) {
+	for table := range tables {
+		if !isBackupTable(table) {
+			return nil, fmt.Errorf("table %s is not backed up", table)
+		}
+	}
+
+	counts := make(map[string]int, len(tables))
+	err := s.WithTx(ctx, func(txStore storage.Store) error {
+		tx := txStore.(*Store).tx
+
+		sourceWorkspaces := make(map[uuid.UUID]uuid.UUID) // Environment ID -> workspace ID
+		var restoredWorkspaces []uuid.UUID
+
+		for _, table := range storage.BackupTables {
+			for _, raw := range tables[table] {
+				var row map[string]json.RawMessage
+				if err := json.Unmarshal(raw, &row); err != nil {
+					return fmt.Errorf("invalid %s row: %w", table, err)
+				}
+
+				keep, err := resolveBackupRefs(ctx, tx, table, row)
+				if err != nil {
+					return err
+				}
+				if !keep {
+					continue
+				}
+
+				if table == "environments" {
+					if ref, ok := row["source_workspace_id"]; ok && string(ref) != "null" {
+						var envID, workspaceID uuid.UUID
+						if err := json.Unmarshal(row["id"], &envID); err != nil {
+							return fmt.Errorf("invalid environments.id: %w", err)
+						}
+						if err := json.Unmarshal(ref, &workspaceID); err != nil {
+							return fmt.Errorf("invalid environments.source_workspace_id: %w", err)
+						}
+						sourceWorkspaces[envID] = workspaceID
+						row["source_workspace_id"] = json.RawMessage("null")
+					}
+				}
+
+				inserted, err := insertBackupRow(ctx, tx, table, row)
+				if err != nil {
+					return err
+				}
+				if !inserted {
+					continue
+				}
+				counts[table]++
+
+				if table == "workspaces" {
+					var id uuid.UUID
+					if err := json.Unmarshal(row["id"], &id); err != nil {
+						return fmt.Errorf("invalid workspaces.id: %w", err)
+					}
+					restoredWorkspaces = append(restoredWorkspaces, id)
+				}
+			}
+		}
+
+		for envID, workspaceID := range sourceWorkspaces {
+			query := `
+				UPDATE environments SET source_workspace_id = $2
+				WHERE id = $1 AND EXISTS (SELECT 1 FROM workspaces WHERE id = $2)
+			`
+			if _, err := tx.ExecContext(ctx, query, envID, workspaceID); err != nil {
+				return fmt.Errorf("failed to restore environment source workspace: %w", err)
+			}
+		}
+
+		for _, id := range restoredWorkspaces {
+			if err := resetRestoredWorkspace(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// resetRestoredWorkspace moves a restored workspace out of states it can't
+// continue from: without a VM a ready workspace is idle, and creation that
+// was in progress has no task left to finish it
+func resetRestoredWorkspace(ctx context.Context, tx dbtx, id uuid.UUID) error {
+	var ws struct {
+		Status string     `db:"status"`
+		VMID   *uuid.UUID `db:"vm_id"`
+	}
+	if err := tx.GetContext(ctx, &ws, `SELECT status, vm_id FROM workspaces WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to get restored workspace: %w", err)
+	}
+
+	var status string
+	switch ws.Status {
+	case storage.WorkspaceStatusCreating, storage.WorkspaceStatusPreparing, storage.WorkspaceStatusSpawning:
+		status = storage.WorkspaceStatusFailed
+	case storage.WorkspaceStatusReady:
+		if ws.VMID != nil {
+			return nil
+		}
+		status = storage.WorkspaceStatusIdle
+	default:
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE workspaces SET status = $2 WHERE id = $1`, id, status); err != nil {
+		return fmt.Errorf("failed to update restored workspace status: %w", err)
+	}
+	return recordWorkspaceStatus(ctx, tx, id, &ws.Status, status, "restored from backup")
+}
+
+// resolveBackupRefs clears or checks row's foreign keys and reports whether
+// the row should be inserted
+func resolveBackupRefs(ctx context.Context, tx dbtx, table string, row map[string]json.RawMessage) (bool, error) {
+	for _, ref := range backupRefs[table] {
+		value, ok := row[ref.column]
+		if !ok || string(value) == "null" {
+			continue
+		}
+
+		var id string
+		if err := json.Unmarshal(value, &id); err != nil {
+			return false, fmt.Errorf("invalid %s.%s: %w", table, ref.column, err)
+		}
+
+		var exists bool
+		query := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1)`, pq.QuoteIdentifier(ref.table))
+		if err := tx.GetContext(ctx, &exists, query, id); err != nil {
+			return false, fmt.Errorf("failed to check %s.%s: %w", table, ref.column, err)
+		}
+		if exists {
+			continue
+		}
+		if ref.required {
+			return false, nil
+		}
+		row[ref.column] = json.RawMessage("null")
+	}
+	return true, nil
+}
+
+// insertBackupRow inserts row unless it conflicts with an existing one.
+// json_populate_record maps the object onto the table's columns, so rows
+// from the same schema version restore every column as exported.
+func insertBackupRow(ctx context.Context, tx dbtx, table string, row map[string]json.RawMessage) (bool, error) {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode %s row: %w", table, err)
+	}
+
+	quoted := pq.QuoteIdentifier(table)
+	query := fmt.Sprintf(
+		`INSERT INTO %s SELECT * FROM json_populate_record(NULL::%s, $1) ON CONFLICT DO NOTHING`,
+		quoted, quoted,
+	)
+
+	result, err := tx.ExecContext(ctx, query, string(data))
+	if err != nil {
+		return false, fmt.Errorf("failed to restore %s row: %w", table, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,344 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// cacheChannel is the channel the triggers from migration 000024 notify
+// with '<table>:<id>' when a cached row changes
+const cacheChannel = "aetherium_cache"
+
+// maxCacheEntries bounds the cache; lookups past it go to the database
+const maxCacheEntries = 10000
+
+// readCache is a read-through cache for environments and workspaces by ID.
+// Entries are stored as JSON so every hit returns a fresh copy callers may
+// modify. Hits are only served while the LISTEN connection is up, since
+// invalidations can be missed otherwise; the TTL bounds staleness if a
+// notification is ever lost.
+type readCache struct {
+	ttl      time.Duration
+	listener *pq.Listener
+
+	mu         sync.Mutex
+	entries    map[string]cacheEntry
+	generation uint64 // Bumped on every invalidation, see put
+
+	listening     atomic.Bool
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	invalidations atomic.Uint64
+	flushes       atomic.Uint64
+}
+
+type cacheEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+func newReadCache(ttl time.Duration) *readCache {
+	return &readCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func cacheKey(table string, id uuid.UUID) string {
+	return table + ":" + id.String()
+}
+
+// listen subscribes to invalidations on a dedicated connection. The
+// listener reconnects on its own; the cache is flushed on reconnect since
+// notifications sent in between are lost.
+func (c *readCache) listen(dsn string) error {
+	c.listener = pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventConnected:
+			c.listening.Store(true)
+		case pq.ListenerEventDisconnected:
+			c.listening.Store(false)
+			log.Printf("Warning: Storage cache listener disconnected, serving reads from the database: %v", err)
+		case pq.ListenerEventReconnected:
+			c.flush()
+			c.listening.Store(true)
+		}
+	})
+	if err := c.listener.Listen(cacheChannel); err != nil {
+		c.listener.Close()
+		return err
+	}
+	c.listening.Store(true)
+
+	go func() {
+		for n := range c.listener.Notify {
+			if n == nil {
+				// Sent after a reconnect
+				c.flush()
+				continue
+			}
+			c.invalidateKey(n.Extra)
+		}
+	}()
+	return nil
+}
+
+// get decodes the cached value for key into v and reports whether it was found
+func (c *readCache) get(key string, v interface{}) bool {
+	if !c.listening.Load() {
+		c.misses.Add(1)
+		return false
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if !ok || json.Unmarshal(entry.data, v) != nil {
+		c.misses.Add(1)
+		return false
+	}
+	c.hits.Add(1)
+	return true
+}
+
+// currentGeneration is read before loading a value from the database
+func (c *readCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// put caches v unless anything was invalidated since generation was read,
+// in which case v may already be stale
+func (c *readCache) put(key string, v interface{}, generation uint64) {
+	if !c.listening.Load() {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generation != generation {
+		return
+	}
+	if len(c.entries) >= maxCacheEntries {
+		now := time.Now()
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			return
+		}
+	}
+	c.entries[key] = cacheEntry{data: data, expires: time.Now().Add(c.ttl)}
+}
+
+func (c *readCache) invalidate(table string, id uuid.UUID) {
+	c.invalidateKey(cacheKey(table, id))
+}
+
+func (c *readCache) invalidateKey(key string) {
+	if !strings.Contains(key, ":") {
+		return
+	}
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.generation++
+	c.mu.Unlock()
+	c.invalidations.Add(1)
+}
+
+func (c *readCache) flush() {
+	c.mu.Lock()
+	c.entries = make(map[string]cacheEntry)
+	c.generation++
+	c.mu.Unlock()
+	c.flushes.Add(1)
+}
+
+func (c *readCache) close() error {
+	if c.listener == nil {
+		return nil
+	}
+	c.listening.Store(false)
+	return c.listener.Close()
+}
+
+func (c *readCache) stats() storage.CacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	stats := storage.CacheStats{
+		Enabled:       true,
+		Listening:     c.listening.Load(),
+		Entries:       entries,
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Invalidations: c.invalidations.Load(),
+		Flushes:       c.flushes.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// cachedEnvironmentRepository serves Get from the cache. Misses load from
+// the primary, as a lagging replica could return a row whose invalidation
+// has already been processed. Writes through it invalidate right away
+// rather than waiting for the notification. Stores
+// inside a transaction only invalidate (reads must see the transaction).
+type cachedEnvironmentRepository struct {
+	storage.EnvironmentRepository
+	cache *readCache
+	reads bool
+}
+
+func (r *cachedEnvironmentRepository) Get(ctx context.Context, id uuid.UUID) (*storage.Environment, error) {
+	if !r.reads {
+		return r.EnvironmentRepository.Get(ctx, id)
+	}
+
+	key := cacheKey("environments", id)
+	var env storage.Environment
+	if r.cache.get(key, &env) {
+		return &env, nil
+	}
+
+	generation := r.cache.currentGeneration()
+	loaded, err := r.EnvironmentRepository.Get(storage.WithPrimaryReads(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.put(key, loaded, generation)
+	return loaded, nil
+}
+
+func (r *cachedEnvironmentRepository) Update(ctx context.Context, env *storage.Environment) error {
+	defer r.cache.invalidate("environments", env.ID)
+	return r.EnvironmentRepository.Update(ctx, env)
+}
+
+func (r *cachedEnvironmentRepository) SetToolLock(ctx context.Context, id uuid.UUID, lock *storage.EnvironmentLockfile) error {
+	defer r.cache.invalidate("environments", id)
+	return r.EnvironmentRepository.SetToolLock(ctx, id, lock)
+}
+
+func (r *cachedEnvironmentRepository) SetFirewall(ctx context.Context, id uuid.UUID, policy *types.FirewallPolicy) error {
+	defer r.cache.invalidate("environments", id)
+	return r.EnvironmentRepository.SetFirewall(ctx, id, policy)
+}
+
+func (r *cachedEnvironmentRepository) SetAnnotations(ctx context.Context, id uuid.UUID, annotations *storage.Annotations) error {
+	defer r.cache.invalidate("environments", id)
+	return r.EnvironmentRepository.SetAnnotations(ctx, id, annotations)
+}
+
+func (r *cachedEnvironmentRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	defer r.cache.invalidate("environments", id)
+	return r.EnvironmentRepository.Delete(ctx, id)
+}
+
+// cachedWorkspaceRepository is cachedEnvironmentRepository for workspaces
+type cachedWorkspaceRepository struct {
+	storage.WorkspaceRepository
+	cache *readCache
+	reads bool
+}
+
+func (r *cachedWorkspaceRepository) Get(ctx context.Context, id uuid.UUID) (*storage.Workspace, error) {
+	if !r.reads {
+		return r.WorkspaceRepository.Get(ctx, id)
+	}
+
+	key := cacheKey("workspaces", id)
+	var workspace storage.Workspace
+	if r.cache.get(key, &workspace) {
+		return &workspace, nil
+	}
+
+	generation := r.cache.currentGeneration()
+	loaded, err := r.WorkspaceRepository.Get(storage.WithPrimaryReads(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.put(key, loaded, generation)
+	return loaded, nil
+}
+
+func (r *cachedWorkspaceRepository) Update(ctx context.Context, workspace *storage.Workspace) error {
+	defer r.cache.invalidate("workspaces", workspace.ID)
+	return r.WorkspaceRepository.Update(ctx, workspace)
+}
+
+func (r *cachedWorkspaceRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status, reason string) error {
+	defer r.cache.invalidate("workspaces", id)
+	return r.WorkspaceRepository.UpdateStatus(ctx, id, status, reason)
+}
+
+func (r *cachedWorkspaceRepository) UpdateIdleSince(ctx context.Context, id uuid.UUID, idleSince *time.Time) error {
+	defer r.cache.invalidate("workspaces", id)
+	return r.WorkspaceRepository.UpdateIdleSince(ctx, id, idleSince)
+}
+
+func (r *cachedWorkspaceRepository) SetVMID(ctx context.Context, id uuid.UUID, vmID uuid.UUID) error {
+	defer r.cache.invalidate("workspaces", id)
+	return r.WorkspaceRepository.SetVMID(ctx, id, vmID)
+}
+
+func (r *cachedWorkspaceRepository) ClearVMID(ctx context.Context, id uuid.UUID) error {
+	defer r.cache.invalidate("workspaces", id)
+	return r.WorkspaceRepository.ClearVMID(ctx, id)
+}
+
+func (r *cachedWorkspaceRepository) SetEnvironmentID(ctx context.Context, id uuid.UUID, environmentID uuid.UUID) error {
+	defer r.cache.invalidate("workspaces", id)
+	return r.WorkspaceRepository.SetEnvironmentID(ctx, id, environmentID)
+}
+
+func (r *cachedWorkspaceRepository) SetReady(ctx context.Context, id uuid.UUID, reason string) error {
+	defer r.cache.invalidate("workspaces", id)
+	return r.WorkspaceRepository.SetReady(ctx, id, reason)
+}
+
+func (r *cachedWorkspaceRepository) SetCreatePhase(ctx context.Context, id uuid.UUID, phase string) error {
+	defer r.cache.invalidate("workspaces", id)
+	return r.WorkspaceRepository.SetCreatePhase(ctx, id, phase)
+}
+
+func (r *cachedWorkspaceRepository) UpdateMetadata(ctx context.Context, id uuid.UUID, metadata map[string]interface{}) error {
+	defer r.cache.invalidate("workspaces", id)
+	return r.WorkspaceRepository.UpdateMetadata(ctx, id, metadata)
+}
+
+func (r *cachedWorkspaceRepository) SetAnnotations(ctx context.Context, id uuid.UUID, annotations *storage.Annotations) error {
+	defer r.cache.invalidate("workspaces", id)
+	return r.WorkspaceRepository.SetAnnotations(ctx, id, annotations)
+}
+
+func (r *cachedWorkspaceRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	defer r.cache.invalidate("workspaces", id)
+	return r.WorkspaceRepository.Delete(ctx, id)
+}
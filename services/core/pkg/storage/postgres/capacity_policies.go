@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+type capacityPolicyRepository struct {
+	db dbtx
+}
+
+func (r *capacityPolicyRepository) Get(ctx context.Context, project string) (*storage.CapacityPolicy, error) {
+	var policy storage.CapacityPolicy
+	query := `
+		SELECT project, policy, retry_after_seconds, created_at, updated_at
+		FROM capacity_policies
+		WHERE project = $1
+	`
+
+	err := r.db.GetContext(ctx, &policy, query, project)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("capacity policy not found: %s", project)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get capacity policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+func (r *capacityPolicyRepository) List(ctx context.Context) ([]*storage.CapacityPolicy, error) {
+	var policies []*storage.CapacityPolicy
+	query := `
+		SELECT project, policy, retry_after_seconds, created_at, updated_at
+		FROM capacity_policies
+		ORDER BY project
+	`
+
+	if err := r.db.SelectContext(ctx, &policies, query); err != nil {
+		return nil, fmt.Errorf("failed to list capacity policies: %w", err)
+	}
+
+	return policies, nil
+}
+
+func (r *capacityPolicyRepository) Upsert(ctx context.Context, policy *storage.CapacityPolicy) error {
+	query := `
+		INSERT INTO capacity_policies (
+			project, policy, retry_after_seconds, created_at, updated_at
+		) VALUES (
+			$1, $2, $3, NOW(), NOW()
+		)
+		ON CONFLICT (project) DO UPDATE SET
+			policy = EXCLUDED.policy,
+			retry_after_seconds = EXCLUDED.retry_after_seconds,
+			updated_at = NOW()
+		RETURNING created_at, updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		policy.Project, policy.Policy, policy.RetryAfterSeconds,
+	).Scan(&policy.CreatedAt, &policy.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to upsert capacity policy: %w", err)
+	}
+
+	return nil
+}
+
+func (r *capacityPolicyRepository) Delete(ctx context.Context, project string) error {
+	query := `DELETE FROM capacity_policies WHERE project = $1`
+
+	result, err := r.db.ExecContext(ctx, query, project)
+	if err != nil {
+		return fmt.Errorf("failed to delete capacity policy: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("capacity policy not found: %s", project)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type clusterEventRepository struct {
+	db dbtx
+}
+
+func (r *clusterEventRepository) Create(ctx context.Context, event *storage.ClusterEvent) error {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if event.Severity == "" {
+		event.Severity = "info"
+	}
+
+	query := `
+		INSERT INTO cluster_events (
+			id, type, severity, resource_type, resource_id,
+			worker_id, message, data, created_at
+		) VALUES (
+			:id, :type, :severity, :resource_type, :resource_id,
+			:worker_id, :message, :data, :created_at
+		)
+	`
+	_, err := r.db.NamedExecContext(ctx, query, event)
+	if err != nil {
+		return fmt.Errorf("failed to create cluster event: %w", err)
+	}
+	return nil
+}
+
+func (r *clusterEventRepository) List(ctx context.Context, filters map[string]interface{}) ([]*storage.ClusterEvent, error) {
+	query := `
+		SELECT id, type, severity, resource_type, resource_id,
+		       worker_id, message, data, created_at
+		FROM cluster_events
+		WHERE 1=1`
+	args := []interface{}{}
+	argIndex := 1
+
+	if types, ok := filters["types"].([]string); ok && len(types) > 0 {
+		query += fmt.Sprintf(" AND type = ANY($%d)", argIndex)
+		args = append(args, pq.Array(types))
+		argIndex++
+	}
+
+	for _, column := range []string{"severity", "resource_type", "resource_id", "worker_id"} {
+		if value, ok := filters[column].(string); ok && value != "" {
+			query += fmt.Sprintf(" AND %s = $%d", column, argIndex)
+			args = append(args, value)
+			argIndex++
+		}
+	}
+
+	if since, ok := filters["since"].(time.Time); ok {
+		query += fmt.Sprintf(" AND created_at >= $%d", argIndex)
+		args = append(args, since)
+		argIndex++
+	}
+
+	if until, ok := filters["until"].(time.Time); ok {
+		query += fmt.Sprintf(" AND created_at <= $%d", argIndex)
+		args = append(args, until)
+		argIndex++
+	}
+
+	query += " ORDER BY created_at DESC"
+
+	if limit, ok := filters["limit"].(int); ok && limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d", argIndex)
+		args = append(args, limit)
+	}
+
+	var events []*storage.ClusterEvent
+	if err := r.db.SelectContext(ctx, &events, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list cluster events: %w", err)
+	}
+	return events, nil
+}
+
+func (r *clusterEventRepository) DeleteOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM cluster_events WHERE created_at < $1`
+	result, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old cluster events: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+type clusterRepository struct {
+	db dbtx
+}
+
+func (r *clusterRepository) Get(ctx context.Context, name string) (*storage.Cluster, error) {
+	var cluster storage.Cluster
+	query := `
+		SELECT name, region, url, encrypted_token, token_nonce, enabled, created_at, updated_at
+		FROM clusters
+		WHERE name = $1
+	`
+
+	err := r.db.GetContext(ctx, &cluster, query, name)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("cluster not found: %s", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster: %w", err)
+	}
+
+	return &cluster, nil
+}
+
+func (r *clusterRepository) List(ctx context.Context) ([]*storage.Cluster, error) {
+	var clusters []*storage.Cluster
+	query := `
+		SELECT name, region, url, encrypted_token, token_nonce, enabled, created_at, updated_at
+		FROM clusters
+		ORDER BY name
+	`
+
+	if err := r.db.SelectContext(ctx, &clusters, query); err != nil {
+		return nil, fmt.Errorf("failed to list clusters: %w", err)
+	}
+
+	return clusters, nil
+}
+
+func (r *clusterRepository) Upsert(ctx context.Context, cluster *storage.Cluster) error {
+	query := `
+		INSERT INTO clusters (
+			name, region, url, encrypted_token, token_nonce, enabled, created_at, updated_at
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, NOW(), NOW()
+		)
+		ON CONFLICT (name) DO UPDATE SET
+			region = EXCLUDED.region,
+			url = EXCLUDED.url,
+			encrypted_token = EXCLUDED.encrypted_token,
+			token_nonce = EXCLUDED.token_nonce,
+			enabled = EXCLUDED.enabled,
+			updated_at = NOW()
+		RETURNING created_at, updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		cluster.Name, cluster.Region, cluster.URL, cluster.EncryptedToken, cluster.TokenNonce, cluster.Enabled,
+	).Scan(&cluster.CreatedAt, &cluster.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to upsert cluster: %w", err)
+	}
+
+	return nil
+}
+
+func (r *clusterRepository) Delete(ctx context.Context, name string) error {
+	query := `DELETE FROM clusters WHERE name = $1`
+
+	result, err := r.db.ExecContext(ctx, query, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete cluster: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("cluster not found: %s", name)
+	}
+
+	return nil
+}
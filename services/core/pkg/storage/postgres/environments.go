@@ -7,14 +7,15 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/redact"
 	"github.com/aetherium/aetherium/services/core/pkg/storage"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 )
 
 // environmentRepository implements storage.EnvironmentRepository
 type environmentRepository struct {
-	db *sqlx.DB
+	db dbtx
 }
 
 // environmentRow represents a database row for environments
@@ -31,6 +32,22 @@ type environmentRow struct {
 	EnvVars            []byte         `db:"env_vars"`
 	MCPServers         []byte         `db:"mcp_servers"`
 	IdleTimeoutSeconds int            `db:"idle_timeout_seconds"`
+	PromptTimeout      int            `db:"prompt_timeout_seconds"`
+	RootFSImage        sql.NullString `db:"rootfs_image"`
+	RootFSImageWorker  sql.NullString `db:"rootfs_image_worker_id"`
+	SourceWorkspaceID  *uuid.UUID     `db:"source_workspace_id"`
+	Sandbox            []byte         `db:"sandbox"`
+	FailoverPolicy     string         `db:"failover_policy"`
+	Region             string         `db:"region"`
+	SchedulingStrategy string         `db:"scheduling_strategy"`
+	Platform           string         `db:"platform"`
+	Redaction          []byte         `db:"redaction"`
+	ToolLock           []byte         `db:"tool_lock"`
+	KernelArgs         []byte         `db:"kernel_args"`
+	Firewall           []byte         `db:"firewall"`
+	Services           []byte         `db:"services"`
+	Docker             []byte         `db:"docker"`
+	Annotations        []byte         `db:"annotations"`
 	CreatedAt          time.Time      `db:"created_at"`
 	UpdatedAt          time.Time      `db:"updated_at"`
 }
@@ -38,15 +55,23 @@ type environmentRow struct {
 // toEnvironment converts a database row to an Environment
 func (r *environmentRow) toEnvironment() (*storage.Environment, error) {
 	env := &storage.Environment{
-		ID:                 r.ID,
-		Name:               r.Name,
-		VCPUs:              r.VCPUs,
-		MemoryMB:           r.MemoryMB,
-		GitBranch:          r.GitBranch,
-		WorkingDirectory:   r.WorkingDirectory,
-		IdleTimeoutSeconds: r.IdleTimeoutSeconds,
-		CreatedAt:          r.CreatedAt,
-		UpdatedAt:          r.UpdatedAt,
+		ID:                   r.ID,
+		Name:                 r.Name,
+		VCPUs:                r.VCPUs,
+		MemoryMB:             r.MemoryMB,
+		GitBranch:            r.GitBranch,
+		WorkingDirectory:     r.WorkingDirectory,
+		IdleTimeoutSeconds:   r.IdleTimeoutSeconds,
+		PromptTimeoutSeconds: r.PromptTimeout,
+		RootFSImage:          fromNullString(r.RootFSImage),
+		RootFSImageWorkerID:  fromNullString(r.RootFSImageWorker),
+		SourceWorkspaceID:    r.SourceWorkspaceID,
+		FailoverPolicy:       r.FailoverPolicy,
+		Region:               r.Region,
+		SchedulingStrategy:   r.SchedulingStrategy,
+		Platform:             r.Platform,
+		CreatedAt:            r.CreatedAt,
+		UpdatedAt:            r.UpdatedAt,
 	}
 
 	if r.Description.Valid {
@@ -84,6 +109,68 @@ func (r *environmentRow) toEnvironment() (*storage.Environment, error) {
 		env.MCPServers = []storage.MCPServerConfig{}
 	}
 
+	// Parse sandbox JSON object (NULL = no sandbox)
+	if len(r.Sandbox) > 0 {
+		env.Sandbox = &storage.SandboxProfile{}
+		if err := json.Unmarshal(r.Sandbox, env.Sandbox); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal sandbox: %w", err)
+		}
+	}
+
+	// Parse kernel_args JSON array
+	if len(r.KernelArgs) > 0 {
+		if err := json.Unmarshal(r.KernelArgs, &env.KernelArgs); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal kernel_args: %w", err)
+		}
+	}
+
+	// Parse services JSON array
+	if len(r.Services) > 0 {
+		if err := json.Unmarshal(r.Services, &env.Services); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal services: %w", err)
+		}
+	}
+
+	// Parse docker JSON object (NULL = no Docker)
+	if len(r.Docker) > 0 {
+		env.Docker = &storage.DockerProfile{}
+		if err := json.Unmarshal(r.Docker, env.Docker); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal docker: %w", err)
+		}
+	}
+
+	// Parse redaction JSON object (NULL = the default policy)
+	if len(r.Redaction) > 0 {
+		env.Redaction = &redact.Policy{}
+		if err := json.Unmarshal(r.Redaction, env.Redaction); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal redaction: %w", err)
+		}
+	}
+
+	// Parse firewall JSON object (NULL = no filtering)
+	if len(r.Firewall) > 0 {
+		env.Firewall = &types.FirewallPolicy{}
+		if err := json.Unmarshal(r.Firewall, env.Firewall); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal firewall: %w", err)
+		}
+	}
+
+	// Parse annotations JSON object (NULL = none)
+	if len(r.Annotations) > 0 {
+		env.Annotations = &storage.Annotations{}
+		if err := json.Unmarshal(r.Annotations, env.Annotations); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal annotations: %w", err)
+		}
+	}
+
+	// Parse tool_lock JSON object (NULL = unpinned)
+	if len(r.ToolLock) > 0 {
+		env.ToolLock = &storage.EnvironmentLockfile{}
+		if err := json.Unmarshal(r.ToolLock, env.ToolLock); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal tool_lock: %w", err)
+		}
+	}
+
 	return env, nil
 }
 
@@ -121,6 +208,31 @@ func (r *environmentRepository) Create(ctx context.Context, env *storage.Environ
 		}
 	}
 
+	sandboxJSON, err := marshalSandbox(env.Sandbox)
+	if err != nil {
+		return err
+	}
+
+	kernelArgsJSON, err := marshalKernelArgs(env.KernelArgs)
+	if err != nil {
+		return err
+	}
+
+	servicesJSON, err := marshalServices(env.Services)
+	if err != nil {
+		return err
+	}
+
+	dockerJSON, err := marshalDocker(env.Docker)
+	if err != nil {
+		return err
+	}
+
+	redactionJSON, err := marshalRedaction(env.Redaction)
+	if err != nil {
+		return err
+	}
+
 	// Set defaults
 	if env.VCPUs <= 0 {
 		env.VCPUs = 2
@@ -137,23 +249,33 @@ func (r *environmentRepository) Create(ctx context.Context, env *storage.Environ
 	if env.IdleTimeoutSeconds <= 0 {
 		env.IdleTimeoutSeconds = 1800 // 30 minutes
 	}
+	if env.FailoverPolicy == "" {
+		env.FailoverPolicy = storage.EnvironmentFailoverNone
+	}
+	if env.Platform == "" {
+		env.Platform = storage.EnvironmentPlatformLinux
+	}
 
 	query := `
 		INSERT INTO environments (
 			id, name, description, vcpus, memory_mb,
 			git_repo_url, git_branch, working_directory,
 			tools, env_vars, mcp_servers, idle_timeout_seconds,
-			created_at, updated_at
+			rootfs_image, source_workspace_id, sandbox, failover_policy,
+			kernel_args, prompt_timeout_seconds, region, services, docker, scheduling_strategy, redaction, platform,
+			rootfs_image_worker_id, created_at, updated_at
 		) VALUES (
 			$1, $2, $3, $4, $5,
 			$6, $7, $8,
 			$9, $10, $11, $12,
-			NOW(), NOW()
+			$13, $14, $15, $16,
+			$17, $18, $19, $20, $21, $22, $23, $24,
+			$25, NOW(), NOW()
 		)
 		RETURNING created_at, updated_at
 	`
 
-	err := r.db.QueryRowContext(ctx, query,
+	err = r.db.QueryRowContext(ctx, query,
 		env.ID,
 		env.Name,
 		toNullString(env.Description),
@@ -166,6 +288,19 @@ func (r *environmentRepository) Create(ctx context.Context, env *storage.Environ
 		envVarsJSON,
 		mcpServersJSON,
 		env.IdleTimeoutSeconds,
+		toNullString(env.RootFSImage),
+		env.SourceWorkspaceID,
+		sandboxJSON,
+		env.FailoverPolicy,
+		kernelArgsJSON,
+		env.PromptTimeoutSeconds,
+		env.Region,
+		servicesJSON,
+		dockerJSON,
+		env.SchedulingStrategy,
+		redactionJSON,
+		env.Platform,
+		toNullString(env.RootFSImageWorkerID),
 	).Scan(&env.CreatedAt, &env.UpdatedAt)
 
 	if err != nil {
@@ -180,8 +315,9 @@ func (r *environmentRepository) Get(ctx context.Context, id uuid.UUID) (*storage
 	query := `
 		SELECT id, name, description, vcpus, memory_mb,
 			   git_repo_url, git_branch, working_directory,
-			   tools, env_vars, mcp_servers, idle_timeout_seconds,
-			   created_at, updated_at
+			   tools, env_vars, mcp_servers, idle_timeout_seconds, prompt_timeout_seconds,
+			   rootfs_image, rootfs_image_worker_id, source_workspace_id, sandbox, failover_policy,
+			   tool_lock, kernel_args, region, scheduling_strategy, redaction, platform, firewall, services, docker, annotations, created_at, updated_at
 		FROM environments
 		WHERE id = $1
 	`
@@ -202,8 +338,9 @@ func (r *environmentRepository) GetByName(ctx context.Context, name string) (*st
 	query := `
 		SELECT id, name, description, vcpus, memory_mb,
 			   git_repo_url, git_branch, working_directory,
-			   tools, env_vars, mcp_servers, idle_timeout_seconds,
-			   created_at, updated_at
+			   tools, env_vars, mcp_servers, idle_timeout_seconds, prompt_timeout_seconds,
+			   rootfs_image, rootfs_image_worker_id, source_workspace_id, sandbox, failover_policy,
+			   tool_lock, kernel_args, region, scheduling_strategy, redaction, platform, firewall, services, docker, annotations, created_at, updated_at
 		FROM environments
 		WHERE name = $1
 	`
@@ -224,8 +361,9 @@ func (r *environmentRepository) List(ctx context.Context) ([]*storage.Environmen
 	query := `
 		SELECT id, name, description, vcpus, memory_mb,
 			   git_repo_url, git_branch, working_directory,
-			   tools, env_vars, mcp_servers, idle_timeout_seconds,
-			   created_at, updated_at
+			   tools, env_vars, mcp_servers, idle_timeout_seconds, prompt_timeout_seconds,
+			   rootfs_image, rootfs_image_worker_id, source_workspace_id, sandbox, failover_policy,
+			   tool_lock, kernel_args, region, scheduling_strategy, redaction, platform, firewall, services, docker, annotations, created_at, updated_at
 		FROM environments
 		ORDER BY created_at DESC
 	`
@@ -265,6 +403,31 @@ func (r *environmentRepository) Update(ctx context.Context, env *storage.Environ
 		return fmt.Errorf("failed to marshal mcp_servers: %w", err)
 	}
 
+	sandboxJSON, err := marshalSandbox(env.Sandbox)
+	if err != nil {
+		return err
+	}
+
+	kernelArgsJSON, err := marshalKernelArgs(env.KernelArgs)
+	if err != nil {
+		return err
+	}
+
+	servicesJSON, err := marshalServices(env.Services)
+	if err != nil {
+		return err
+	}
+
+	dockerJSON, err := marshalDocker(env.Docker)
+	if err != nil {
+		return err
+	}
+
+	redactionJSON, err := marshalRedaction(env.Redaction)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE environments
 		SET name = $2,
@@ -278,6 +441,18 @@ func (r *environmentRepository) Update(ctx context.Context, env *storage.Environ
 			env_vars = $10,
 			mcp_servers = $11,
 			idle_timeout_seconds = $12,
+			rootfs_image = $13,
+			sandbox = $14,
+			failover_policy = $15,
+			kernel_args = $16,
+			prompt_timeout_seconds = $17,
+			region = $18,
+			services = $19,
+			docker = $20,
+			scheduling_strategy = $21,
+			redaction = $22,
+			platform = $23,
+			rootfs_image_worker_id = $24,
 			updated_at = NOW()
 		WHERE id = $1
 		RETURNING updated_at
@@ -296,6 +471,18 @@ func (r *environmentRepository) Update(ctx context.Context, env *storage.Environ
 		envVarsJSON,
 		mcpServersJSON,
 		env.IdleTimeoutSeconds,
+		toNullString(env.RootFSImage),
+		sandboxJSON,
+		env.FailoverPolicy,
+		kernelArgsJSON,
+		env.PromptTimeoutSeconds,
+		env.Region,
+		servicesJSON,
+		dockerJSON,
+		env.SchedulingStrategy,
+		redactionJSON,
+		env.Platform,
+		toNullString(env.RootFSImageWorkerID),
 	).Scan(&env.UpdatedAt)
 
 	if err != nil {
@@ -308,6 +495,81 @@ func (r *environmentRepository) Update(ctx context.Context, env *storage.Environ
 	return nil
 }
 
+// SetToolLock replaces an environment's tool lock
+func (r *environmentRepository) SetToolLock(ctx context.Context, id uuid.UUID, lock *storage.EnvironmentLockfile) error {
+	var lockJSON []byte
+	if lock != nil {
+		var err error
+		lockJSON, err = json.Marshal(lock)
+		if err != nil {
+			return fmt.Errorf("failed to marshal tool_lock: %w", err)
+		}
+	}
+
+	result, err := r.db.ExecContext(ctx, `UPDATE environments SET tool_lock = $2 WHERE id = $1`, id, lockJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set tool lock: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("environment not found: %s", id)
+	}
+
+	return nil
+}
+
+// SetFirewall replaces an environment's firewall policy
+func (r *environmentRepository) SetFirewall(ctx context.Context, id uuid.UUID, policy *types.FirewallPolicy) error {
+	var policyJSON []byte
+	if policy != nil {
+		var err error
+		policyJSON, err = json.Marshal(policy)
+		if err != nil {
+			return fmt.Errorf("failed to marshal firewall: %w", err)
+		}
+	}
+
+	result, err := r.db.ExecContext(ctx, `UPDATE environments SET firewall = $2 WHERE id = $1`, id, policyJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set firewall: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("environment not found: %s", id)
+	}
+
+	return nil
+}
+
+// SetAnnotations replaces an environment's annotations
+func (r *environmentRepository) SetAnnotations(ctx context.Context, id uuid.UUID, annotations *storage.Annotations) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE environments SET annotations = $2 WHERE id = $1`, id, annotations)
+	if err != nil {
+		return fmt.Errorf("failed to set annotations: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("environment not found: %s", id)
+	}
+
+	return nil
+}
+
 // Delete deletes an environment by ID
 func (r *environmentRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	query := `DELETE FROM environments WHERE id = $1`
@@ -328,3 +590,86 @@ func (r *environmentRepository) Delete(ctx context.Context, id uuid.UUID) error
 
 	return nil
 }
+
+// ListUsage ranks environments by the workspaces created from them since a given time
+func (r *environmentRepository) ListUsage(ctx context.Context, since time.Time, limit int) ([]*storage.EnvironmentUsage, error) {
+	query := `
+		SELECT environment_id, COUNT(*) AS workspaces, MAX(created_at) AS last_used_at
+		FROM workspaces
+		WHERE environment_id IS NOT NULL AND created_at >= $1
+		GROUP BY environment_id
+		ORDER BY workspaces DESC, last_used_at DESC
+	`
+	args := []interface{}{since}
+	if limit > 0 {
+		query += " LIMIT $2"
+		args = append(args, limit)
+	}
+
+	var usage []*storage.EnvironmentUsage
+	if err := r.db.SelectContext(ctx, &usage, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list environment usage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// marshalSandbox converts a sandbox profile to JSON, returning nil (SQL NULL) when unset
+func marshalSandbox(sandbox *storage.SandboxProfile) ([]byte, error) {
+	if sandbox == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(sandbox)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal sandbox: %w", err)
+	}
+	return data, nil
+}
+
+// marshalKernelArgs converts kernel args to a JSON array, defaulting to []
+func marshalKernelArgs(args []string) ([]byte, error) {
+	if len(args) == 0 {
+		return []byte("[]"), nil
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal kernel_args: %w", err)
+	}
+	return data, nil
+}
+
+// marshalDocker converts a Docker profile to JSON, returning nil (SQL NULL) when unset
+func marshalDocker(docker *storage.DockerProfile) ([]byte, error) {
+	if docker == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(docker)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal docker: %w", err)
+	}
+	return data, nil
+}
+
+// marshalRedaction converts a redaction policy to JSON, returning nil (SQL NULL) when unset
+func marshalRedaction(policy *redact.Policy) ([]byte, error) {
+	if policy == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal redaction: %w", err)
+	}
+	return data, nil
+}
+
+// marshalServices converts sidecar specs to a JSON array, defaulting to []
+func marshalServices(services []storage.ServiceSpec) ([]byte, error) {
+	if len(services) == 0 {
+		return []byte("[]"), nil
+	}
+	data, err := json.Marshal(services)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal services: %w", err)
+	}
+	return data, nil
+}
@@ -6,35 +6,51 @@ import (
 	"fmt"
 
 	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/transcript"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 )
 
 type executionRepository struct {
-	db *sqlx.DB
+	db    dbtx
+	chain bool // Append executions to the transcript chain
 }
 
 func (r *executionRepository) Create(ctx context.Context, execution *storage.Execution) error {
 	query := `
 		INSERT INTO executions (
-			id, job_id, vm_id, command, args, env,
+			id, job_id, task_id, vm_id, command, args, env,
 			exit_code, stdout, stderr, error,
 			started_at, completed_at, duration_ms, metadata
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15
 		)`
 
-	_, err := r.db.ExecContext(ctx, query,
-		execution.ID, execution.JobID, execution.VMID, execution.Command,
+	args := []interface{}{
+		execution.ID, execution.JobID, execution.TaskID, execution.VMID, execution.Command,
 		execution.Args, execution.Env, execution.ExitCode, execution.Stdout,
 		execution.Stderr, execution.Error, execution.StartedAt, execution.CompletedAt,
 		execution.DurationMS, execution.Metadata,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create execution: %w", err)
 	}
 
-	return nil
+	if !r.chain {
+		if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to create execution: %w", err)
+		}
+		return nil
+	}
+
+	// Chain the execution as stored, in the transaction creating it
+	return runInTx(ctx, r.db, func(tx dbtx) error {
+		var stored storage.Execution
+		if err := tx.GetContext(ctx, &stored, query+" RETURNING *", args...); err != nil {
+			return fmt.Errorf("failed to create execution: %w", err)
+		}
+		hash, err := transcript.ExecutionHash(&stored)
+		if err != nil {
+			return err
+		}
+		return appendTranscript(ctx, tx, storage.TranscriptKindExecution, stored.ID, hash)
+	})
 }
 
 func (r *executionRepository) Get(ctx context.Context, id uuid.UUID) (*storage.Execution, error) {
@@ -52,6 +68,26 @@ func (r *executionRepository) Get(ctx context.Context, id uuid.UUID) (*storage.E
 	return &execution, nil
 }
 
+func (r *executionRepository) GetByTaskID(ctx context.Context, taskID uuid.UUID) (*storage.Execution, error) {
+	var execution storage.Execution
+	query := `
+		SELECT * FROM executions
+		WHERE task_id = $1
+		ORDER BY started_at DESC
+		LIMIT 1
+	`
+
+	err := r.db.GetContext(ctx, &execution, query, taskID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("execution not found for task: %s", taskID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get execution by task: %w", err)
+	}
+
+	return &execution, nil
+}
+
 func (r *executionRepository) ListByJob(ctx context.Context, jobID uuid.UUID) ([]*storage.Execution, error) {
 	var executions []*storage.Execution
 	query := `SELECT * FROM executions WHERE job_id = $1 ORDER BY started_at ASC`
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+type integrationConfigRepository struct {
+	db dbtx
+}
+
+func (r *integrationConfigRepository) Get(ctx context.Context, name string) (*storage.IntegrationConfig, error) {
+	var config storage.IntegrationConfig
+	query := `
+		SELECT name, type, enabled, encrypted_options, nonce, created_at, updated_at
+		FROM integration_configs
+		WHERE name = $1
+	`
+
+	err := r.db.GetContext(ctx, &config, query, name)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("integration not found: %s", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get integration: %w", err)
+	}
+
+	return &config, nil
+}
+
+func (r *integrationConfigRepository) List(ctx context.Context) ([]*storage.IntegrationConfig, error) {
+	var configs []*storage.IntegrationConfig
+	query := `
+		SELECT name, type, enabled, encrypted_options, nonce, created_at, updated_at
+		FROM integration_configs
+		ORDER BY name
+	`
+
+	if err := r.db.SelectContext(ctx, &configs, query); err != nil {
+		return nil, fmt.Errorf("failed to list integrations: %w", err)
+	}
+
+	return configs, nil
+}
+
+func (r *integrationConfigRepository) Upsert(ctx context.Context, config *storage.IntegrationConfig) error {
+	query := `
+		INSERT INTO integration_configs (
+			name, type, enabled, encrypted_options, nonce, created_at, updated_at
+		) VALUES (
+			$1, $2, $3, $4, $5, NOW(), NOW()
+		)
+		ON CONFLICT (name) DO UPDATE SET
+			type = EXCLUDED.type,
+			enabled = EXCLUDED.enabled,
+			encrypted_options = EXCLUDED.encrypted_options,
+			nonce = EXCLUDED.nonce,
+			updated_at = NOW()
+		RETURNING created_at, updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		config.Name, config.Type, config.Enabled, config.EncryptedOptions, config.Nonce,
+	).Scan(&config.CreatedAt, &config.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to upsert integration: %w", err)
+	}
+
+	return nil
+}
+
+func (r *integrationConfigRepository) Delete(ctx context.Context, name string) error {
+	query := `DELETE FROM integration_configs WHERE name = $1`
+
+	result, err := r.db.ExecContext(ctx, query, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete integration: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("integration not found: %s", name)
+	}
+
+	return nil
+}
@@ -7,11 +7,10 @@ import (
 
 	"github.com/aetherium/aetherium/services/core/pkg/storage"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 )
 
 type jobRepository struct {
-	db *sqlx.DB
+	db dbtx
 }
 
 func (r *jobRepository) Create(ctx context.Context, job *storage.Job) error {
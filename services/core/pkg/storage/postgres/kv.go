@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+// kvRepository implements storage.KVRepository. Reads go to the primary:
+// coordination state read from a lagging replica would hand out locks twice.
+type kvRepository struct {
+	db dbtx
+}
+
+// kvColumns are the columns entries are read and returned with
+const kvColumns = `namespace, key, value, version, expires_at, updated_at`
+
+// kvLive matches entries that haven't expired
+const kvLive = `(expires_at IS NULL OR expires_at > NOW())`
+
+// kvTTL converts a ttl to milliseconds for queries, where NULL (ttl 0)
+// keeps the entry until deleted
+func kvTTL(ttl time.Duration) *int64 {
+	if ttl <= 0 {
+		return nil
+	}
+	ms := ttl.Milliseconds()
+	return &ms
+}
+
+func (r *kvRepository) Get(ctx context.Context, namespace, key string) (*storage.KVEntry, error) {
+	var entry storage.KVEntry
+	query := `SELECT ` + kvColumns + ` FROM kv_entries WHERE namespace = $1 AND key = $2 AND ` + kvLive
+
+	err := r.db.GetContext(storage.WithPrimaryReads(ctx), &entry, query, namespace, key)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s/%s", storage.ErrKVNotFound, namespace, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kv entry: %w", err)
+	}
+
+	return &entry, nil
+}
+
+func (r *kvRepository) List(ctx context.Context, namespace, prefix string) ([]*storage.KVEntry, error) {
+	var entries []*storage.KVEntry
+	query := `
+		SELECT ` + kvColumns + ` FROM kv_entries
+		WHERE namespace = $1 AND starts_with(key, $2) AND ` + kvLive + `
+		ORDER BY key`
+
+	if err := r.db.SelectContext(storage.WithPrimaryReads(ctx), &entries, query, namespace, prefix); err != nil {
+		return nil, fmt.Errorf("failed to list kv entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (r *kvRepository) Set(ctx context.Context, entry *storage.KVEntry, ttl time.Duration) error {
+	query := `
+		INSERT INTO kv_entries (namespace, key, value, version, expires_at, updated_at)
+		VALUES ($1, $2, $3, nextval('kv_entries_version_seq'), NOW() + $4::float8 * INTERVAL '1 millisecond', NOW())
+		ON CONFLICT (namespace, key) DO UPDATE SET
+			value = EXCLUDED.value,
+			version = EXCLUDED.version,
+			expires_at = EXCLUDED.expires_at,
+			updated_at = NOW()
+		RETURNING version, expires_at, updated_at`
+
+	err := r.db.QueryRowContext(ctx, query, entry.Namespace, entry.Key, entry.Value, kvTTL(ttl)).
+		Scan(&entry.Version, &entry.ExpiresAt, &entry.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set kv entry: %w", err)
+	}
+
+	return nil
+}
+
+// SetIfAbsent takes over an expired entry in place with a new version, so
+// a holder that lost its entry to expiry can't swap or delete the new one
+func (r *kvRepository) SetIfAbsent(ctx context.Context, entry *storage.KVEntry, ttl time.Duration) (bool, error) {
+	query := `
+		INSERT INTO kv_entries (namespace, key, value, version, expires_at, updated_at)
+		VALUES ($1, $2, $3, nextval('kv_entries_version_seq'), NOW() + $4::float8 * INTERVAL '1 millisecond', NOW())
+		ON CONFLICT (namespace, key) DO UPDATE SET
+			value = EXCLUDED.value,
+			version = EXCLUDED.version,
+			expires_at = EXCLUDED.expires_at,
+			updated_at = NOW()
+		WHERE kv_entries.expires_at IS NOT NULL AND kv_entries.expires_at <= NOW()
+		RETURNING version, expires_at, updated_at`
+
+	err := r.db.QueryRowContext(ctx, query, entry.Namespace, entry.Key, entry.Value, kvTTL(ttl)).
+		Scan(&entry.Version, &entry.ExpiresAt, &entry.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to set kv entry: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *kvRepository) CompareAndSwap(ctx context.Context, entry *storage.KVEntry, ttl time.Duration) (bool, error) {
+	query := `
+		UPDATE kv_entries SET
+			value = $4,
+			version = nextval('kv_entries_version_seq'),
+			expires_at = NOW() + $5::float8 * INTERVAL '1 millisecond',
+			updated_at = NOW()
+		WHERE namespace = $1 AND key = $2 AND version = $3 AND ` + kvLive + `
+		RETURNING version, expires_at, updated_at`
+
+	err := r.db.QueryRowContext(ctx, query, entry.Namespace, entry.Key, entry.Version, entry.Value, kvTTL(ttl)).
+		Scan(&entry.Version, &entry.ExpiresAt, &entry.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to swap kv entry: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *kvRepository) Delete(ctx context.Context, namespace, key string) error {
+	query := `DELETE FROM kv_entries WHERE namespace = $1 AND key = $2`
+
+	if _, err := r.db.ExecContext(ctx, query, namespace, key); err != nil {
+		return fmt.Errorf("failed to delete kv entry: %w", err)
+	}
+
+	return nil
+}
+
+func (r *kvRepository) CompareAndDelete(ctx context.Context, namespace, key string, version int64) (bool, error) {
+	query := `DELETE FROM kv_entries WHERE namespace = $1 AND key = $2 AND version = $3 AND ` + kvLive
+
+	result, err := r.db.ExecContext(ctx, query, namespace, key, version)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete kv entry: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rows > 0, nil
+}
+
+func (r *kvRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM kv_entries WHERE expires_at IS NOT NULL AND expires_at <= NOW()`
+
+	result, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired kv entries: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -1,8 +1,11 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log"
+	"time"
 
 	"github.com/aetherium/aetherium/services/core/pkg/storage"
 	"github.com/golang-migrate/migrate/v4"
@@ -14,20 +17,39 @@ import (
 
 // Store implements storage.Store using PostgreSQL
 type Store struct {
-	db              *sqlx.DB
-	vms             storage.VMRepository
-	tasks           storage.TaskRepository
-	jobs            storage.JobRepository
-	executions      storage.ExecutionRepository
-	workers         storage.WorkerRepository
-	workerMetrics   storage.WorkerMetricRepository
-	environments    storage.EnvironmentRepository
-	workspaces      storage.WorkspaceRepository
-	secrets         storage.SecretRepository
-	prepSteps       storage.PrepStepRepository
-	promptTasks     storage.PromptTaskRepository
-	sessions        storage.SessionRepository
-	sessionMessages storage.SessionMessageRepository
+	db               *sqlx.DB
+	tx               *sqlx.Tx // Set on stores created by WithTx
+	vms              storage.VMRepository
+	vmSnapshots      storage.VMSnapshotRepository
+	vmGCPolicies     storage.VMGCPolicyRepository
+	reapPolicies     storage.WorkspaceReapPolicyRepository
+	capacityPolicies storage.CapacityPolicyRepository
+	alertRules       storage.AlertRuleRepository
+	clusters         storage.ClusterRepository
+	integrations     storage.IntegrationConfigRepository
+	tasks            storage.TaskRepository
+	jobs             storage.JobRepository
+	executions       storage.ExecutionRepository
+	smartExecutions  storage.SmartExecutionRepository
+	workers          storage.WorkerRepository
+	workerMetrics    storage.WorkerMetricRepository
+	environments     storage.EnvironmentRepository
+	workspaces       storage.WorkspaceRepository
+	secrets          storage.SecretRepository
+	prepSteps        storage.PrepStepRepository
+	promptTasks      storage.PromptTaskRepository
+	attachments      storage.PromptAttachmentRepository
+	checkpoints      storage.PromptCheckpointRepository
+	sessions         storage.SessionRepository
+	sessionMessages  storage.SessionMessageRepository
+	clusterEvents    storage.ClusterEventRepository
+	kv               storage.KVRepository
+	search           storage.SearchRepository
+	slo              storage.SLORepository
+	transcripts      storage.TranscriptRepository
+	chainTranscripts bool       // Executions and finished prompts are hash-chained
+	cache            *readCache // Nil when caching is off
+	replicas         *splitDB   // Nil without read replicas
 }
 
 // Config holds PostgreSQL configuration
@@ -40,6 +62,22 @@ type Config struct {
 	SSLMode      string
 	MaxOpenConns int
 	MaxIdleConns int
+
+	// CacheTTL enables a read cache for environments and workspaces by ID,
+	// invalidated through LISTEN/NOTIFY (migration 000024). 0 disables it.
+	CacheTTL time.Duration
+
+	// ReplicaDSNs are read replicas. Plain reads outside transactions are
+	// spread over them; writes, locking reads and transactions use the
+	// primary. Reads fall back to the primary when every replica is down or
+	// lags by more than MaxReplicaLag (default 5s).
+	ReplicaDSNs   []string
+	MaxReplicaLag time.Duration
+
+	// TranscriptChain appends every execution and finished prompt to the
+	// transcript hash chain (migration 000051), making their history
+	// tamper-evident. Appends are serialized across all writers.
+	TranscriptChain bool
 }
 
 // NewStore creates a new PostgreSQL store
@@ -61,26 +99,104 @@ func NewStore(config Config) (*Store, error) {
 		db.SetMaxIdleConns(config.MaxIdleConns)
 	}
 
-	store := &Store{
-		db:              db,
-		vms:             &vmRepository{db: db},
-		tasks:           &taskRepository{db: db},
-		jobs:            &jobRepository{db: db},
-		executions:      &executionRepository{db: db},
-		workers:         &workerRepository{db: db},
-		workerMetrics:   &workerMetricRepository{db: db},
-		environments:    &environmentRepository{db: db},
-		workspaces:      &workspaceRepository{db: db},
-		secrets:         &secretRepository{db: db},
-		prepSteps:       &prepStepRepository{db: db},
-		promptTasks:     &promptTaskRepository{db: db},
-		sessions:        &sessionRepository{db: db},
-		sessionMessages: &sessionMessageRepository{db: db},
+	var q dbtx = db
+	var replicas *splitDB
+	if len(config.ReplicaDSNs) > 0 {
+		replicas, err = newSplitDB(db, config.ReplicaDSNs, config)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		q = replicas
+	}
+
+	store := newStore(db, q)
+	store.replicas = replicas
+	if config.TranscriptChain {
+		store.setTranscriptChain(q)
+	}
+	if config.CacheTTL > 0 {
+		cache := newReadCache(config.CacheTTL)
+		if err := cache.listen(dsn); err != nil {
+			log.Printf("Warning: Storage cache disabled, failed to listen for invalidations: %v", err)
+		} else {
+			store.setCache(cache, true)
+		}
 	}
 
 	return store, nil
 }
 
+// setCache puts the read cache in front of the environment and workspace
+// repositories. Stores inside a transaction pass reads=false: they only
+// invalidate.
+func (s *Store) setCache(cache *readCache, reads bool) {
+	s.cache = cache
+	s.environments = &cachedEnvironmentRepository{EnvironmentRepository: s.environments, cache: cache, reads: reads}
+	s.workspaces = &cachedWorkspaceRepository{WorkspaceRepository: s.workspaces, cache: cache, reads: reads}
+}
+
+// setTranscriptChain makes the execution and prompt repositories, running
+// queries on q, append to the transcript chain
+func (s *Store) setTranscriptChain(q dbtx) {
+	s.chainTranscripts = true
+	s.executions = &executionRepository{db: q, chain: true}
+	s.promptTasks = &promptTaskRepository{db: q, chain: true}
+}
+
+// CacheStats reports the read cache's activity
+func (s *Store) CacheStats() storage.CacheStats {
+	if s.cache == nil {
+		return storage.CacheStats{}
+	}
+	return s.cache.stats()
+}
+
+// ReplicaStatus reports the read replicas' health and lag
+func (s *Store) ReplicaStatus() []storage.ReplicaStatus {
+	if s.replicas == nil {
+		return []storage.ReplicaStatus{}
+	}
+	return s.replicas.status()
+}
+
+// newStore builds a Store whose repositories run queries on q, which is
+// the connection pool, the pool split over read replicas, or a transaction
+// on the pool
+func newStore(db *sqlx.DB, q dbtx) *Store {
+	return &Store{
+		db:               db,
+		vms:              &vmRepository{db: q},
+		vmSnapshots:      &vmSnapshotRepository{db: q},
+		vmGCPolicies:     &vmGCPolicyRepository{db: q},
+		reapPolicies:     &workspaceReapPolicyRepository{db: q},
+		capacityPolicies: &capacityPolicyRepository{db: q},
+		alertRules:       &alertRuleRepository{db: q},
+		clusters:         &clusterRepository{db: q},
+		integrations:     &integrationConfigRepository{db: q},
+		tasks:            &taskRepository{db: q},
+		jobs:             &jobRepository{db: q},
+		executions:       &executionRepository{db: q},
+		smartExecutions:  &smartExecutionRepository{db: q},
+		workers:          &workerRepository{db: q},
+		workerMetrics:    &workerMetricRepository{db: q},
+		environments:     &environmentRepository{db: q},
+		workspaces:       &workspaceRepository{db: q},
+		secrets:          &secretRepository{db: q},
+		prepSteps:        &prepStepRepository{db: q},
+		promptTasks:      &promptTaskRepository{db: q},
+		attachments:      &promptAttachmentRepository{db: q},
+		checkpoints:      &promptCheckpointRepository{db: q},
+		sessions:         &sessionRepository{db: q},
+		sessionMessages:  &sessionMessageRepository{db: q},
+		clusterEvents:    &clusterEventRepository{db: q},
+		kv:               &kvRepository{db: q},
+		search:           &searchRepository{db: q},
+		slo:              &sloRepository{db: q},
+		transcripts:      &transcriptRepository{db: q},
+	}
+}
+
 // RunMigrations runs database migrations
 func (s *Store) RunMigrations(migrationsPath string) error {
 	driver, err := postgres.WithInstance(s.db.DB, &postgres.Config{})
@@ -109,6 +225,41 @@ func (s *Store) VMs() storage.VMRepository {
 	return s.vms
 }
 
+// VMSnapshots returns the VM snapshot repository
+func (s *Store) VMSnapshots() storage.VMSnapshotRepository {
+	return s.vmSnapshots
+}
+
+// VMGCPolicies returns the VM GC policy repository
+func (s *Store) VMGCPolicies() storage.VMGCPolicyRepository {
+	return s.vmGCPolicies
+}
+
+// WorkspaceReapPolicies returns the stale workspace policy repository
+func (s *Store) WorkspaceReapPolicies() storage.WorkspaceReapPolicyRepository {
+	return s.reapPolicies
+}
+
+// CapacityPolicies returns the capacity policy repository
+func (s *Store) CapacityPolicies() storage.CapacityPolicyRepository {
+	return s.capacityPolicies
+}
+
+// AlertRules returns the alert rule repository
+func (s *Store) AlertRules() storage.AlertRuleRepository {
+	return s.alertRules
+}
+
+// Clusters returns the federated cluster repository
+func (s *Store) Clusters() storage.ClusterRepository {
+	return s.clusters
+}
+
+// IntegrationConfigs returns the runtime integration config repository
+func (s *Store) IntegrationConfigs() storage.IntegrationConfigRepository {
+	return s.integrations
+}
+
 // Tasks returns the task repository
 func (s *Store) Tasks() storage.TaskRepository {
 	return s.tasks
@@ -124,6 +275,11 @@ func (s *Store) Executions() storage.ExecutionRepository {
 	return s.executions
 }
 
+// SmartExecutions returns the smart execution repository
+func (s *Store) SmartExecutions() storage.SmartExecutionRepository {
+	return s.smartExecutions
+}
+
 // Workers returns the worker repository
 func (s *Store) Workers() storage.WorkerRepository {
 	return s.workers
@@ -159,6 +315,16 @@ func (s *Store) PromptTasks() storage.PromptTaskRepository {
 	return s.promptTasks
 }
 
+// PromptAttachments returns the prompt attachment repository
+func (s *Store) PromptAttachments() storage.PromptAttachmentRepository {
+	return s.attachments
+}
+
+// PromptCheckpoints returns the prompt checkpoint repository
+func (s *Store) PromptCheckpoints() storage.PromptCheckpointRepository {
+	return s.checkpoints
+}
+
 // Sessions returns the session repository
 func (s *Store) Sessions() storage.SessionRepository {
 	return s.sessions
@@ -169,8 +335,48 @@ func (s *Store) SessionMessages() storage.SessionMessageRepository {
 	return s.sessionMessages
 }
 
-// Close closes the database connection
+// ClusterEvents returns the cluster event repository
+func (s *Store) ClusterEvents() storage.ClusterEventRepository {
+	return s.clusterEvents
+}
+
+// KV returns the key-value runtime state repository
+func (s *Store) KV() storage.KVRepository {
+	return s.kv
+}
+
+// Search returns the full-text search repository
+func (s *Store) Search() storage.SearchRepository {
+	return s.search
+}
+
+// SLO returns the SLO repository
+func (s *Store) SLO() storage.SLORepository {
+	return s.slo
+}
+
+// Transcripts returns the transcript chain repository
+func (s *Store) Transcripts() storage.TranscriptRepository {
+	return s.transcripts
+}
+
+// Ping checks that the database is reachable
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the database connection. The pool belongs to the parent
+// store, so closing a store passed to WithTx does nothing.
 func (s *Store) Close() error {
+	if s.tx != nil {
+		return nil
+	}
+	if s.cache != nil {
+		s.cache.close()
+	}
+	if s.replicas != nil {
+		s.replicas.close()
+	}
 	return s.db.Close()
 }
 
@@ -0,0 +1,138 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// promptAttachmentRepository implements storage.PromptAttachmentRepository.
+// Reads go to the primary: uploads are attached and read right after they
+// are made.
+type promptAttachmentRepository struct {
+	db dbtx
+}
+
+// promptAttachmentColumns are the columns attachments are read with; the
+// content is only read by GetContent
+const promptAttachmentColumns = `id, workspace_id, prompt_id, name, size_bytes, sha256, created_at, cleaned_at`
+
+func (r *promptAttachmentRepository) Create(ctx context.Context, attachment *storage.PromptAttachment, content []byte) error {
+	query := `
+		INSERT INTO prompt_attachments (id, workspace_id, name, size_bytes, sha256, content, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		attachment.ID, attachment.WorkspaceID, attachment.Name,
+		attachment.SizeBytes, attachment.SHA256, content, attachment.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create prompt attachment: %w", err)
+	}
+
+	return nil
+}
+
+func (r *promptAttachmentRepository) Get(ctx context.Context, id uuid.UUID) (*storage.PromptAttachment, error) {
+	var attachment storage.PromptAttachment
+	query := `SELECT ` + promptAttachmentColumns + ` FROM prompt_attachments WHERE id = $1`
+
+	err := r.db.GetContext(storage.WithPrimaryReads(ctx), &attachment, query, id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("prompt attachment not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prompt attachment: %w", err)
+	}
+
+	return &attachment, nil
+}
+
+func (r *promptAttachmentRepository) GetContent(ctx context.Context, id uuid.UUID) ([]byte, error) {
+	var content []byte
+	query := `SELECT content FROM prompt_attachments WHERE id = $1`
+
+	err := r.db.GetContext(storage.WithPrimaryReads(ctx), &content, query, id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("prompt attachment not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prompt attachment content: %w", err)
+	}
+	if content == nil {
+		return nil, fmt.Errorf("content of prompt attachment %s was cleaned up", id)
+	}
+
+	return content, nil
+}
+
+func (r *promptAttachmentRepository) ListByPrompt(ctx context.Context, promptID uuid.UUID) ([]*storage.PromptAttachment, error) {
+	var attachments []*storage.PromptAttachment
+	query := `
+		SELECT ` + promptAttachmentColumns + ` FROM prompt_attachments
+		WHERE prompt_id = $1
+		ORDER BY created_at, name`
+
+	if err := r.db.SelectContext(storage.WithPrimaryReads(ctx), &attachments, query, promptID); err != nil {
+		return nil, fmt.Errorf("failed to list prompt attachments: %w", err)
+	}
+
+	return attachments, nil
+}
+
+func (r *promptAttachmentRepository) Attach(ctx context.Context, workspaceID, promptID uuid.UUID, ids []uuid.UUID) error {
+	query := `
+		UPDATE prompt_attachments SET prompt_id = $3
+		WHERE id = ANY($1::uuid[]) AND workspace_id = $2 AND prompt_id IS NULL AND content IS NOT NULL
+	`
+
+	strIDs := make([]string, len(ids))
+	for i, id := range ids {
+		strIDs[i] = id.String()
+	}
+
+	result, err := r.db.ExecContext(ctx, query, pq.Array(strIDs), workspaceID, promptID)
+	if err != nil {
+		return fmt.Errorf("failed to attach prompt attachments: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows != int64(len(ids)) {
+		return fmt.Errorf("%d of %d attachments are not uploads of this workspace waiting for a prompt", int64(len(ids))-rows, len(ids))
+	}
+
+	return nil
+}
+
+func (r *promptAttachmentRepository) ClearContent(ctx context.Context, promptID uuid.UUID) error {
+	query := `
+		UPDATE prompt_attachments SET content = NULL, cleaned_at = NOW()
+		WHERE prompt_id = $1 AND content IS NOT NULL
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, promptID); err != nil {
+		return fmt.Errorf("failed to clear prompt attachments: %w", err)
+	}
+
+	return nil
+}
+
+func (r *promptAttachmentRepository) DeleteUnattached(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM prompt_attachments WHERE prompt_id IS NULL AND created_at < $1`
+
+	result, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete unattached prompt attachments: %w", err)
+	}
+
+	return result.RowsAffected()
+}
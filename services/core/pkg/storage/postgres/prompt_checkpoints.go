@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// promptCheckpointRepository implements storage.PromptCheckpointRepository
+type promptCheckpointRepository struct {
+	db dbtx
+}
+
+func (r *promptCheckpointRepository) Save(ctx context.Context, checkpoint *storage.PromptCheckpoint) error {
+	query := `
+		INSERT INTO prompt_checkpoints (prompt_id, attempt, sequence, stdout, stderr, diff, diff_truncated, created_at, sealed_diff, sealed_diff_nonce)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (prompt_id) DO UPDATE SET
+			attempt = EXCLUDED.attempt,
+			sequence = EXCLUDED.sequence,
+			stdout = EXCLUDED.stdout,
+			stderr = EXCLUDED.stderr,
+			diff = EXCLUDED.diff,
+			diff_truncated = EXCLUDED.diff_truncated,
+			created_at = EXCLUDED.created_at,
+			sealed_diff = EXCLUDED.sealed_diff,
+			sealed_diff_nonce = EXCLUDED.sealed_diff_nonce
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		checkpoint.PromptID, checkpoint.Attempt, checkpoint.Sequence,
+		checkpoint.Stdout, checkpoint.Stderr, checkpoint.Diff, checkpoint.DiffTruncated,
+		checkpoint.CreatedAt, checkpoint.SealedDiff, checkpoint.SealedDiffNonce,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save prompt checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+func (r *promptCheckpointRepository) Get(ctx context.Context, promptID uuid.UUID) (*storage.PromptCheckpoint, error) {
+	var checkpoint storage.PromptCheckpoint
+	query := `
+		SELECT prompt_id, attempt, sequence, stdout, stderr, diff, diff_truncated, created_at, sealed_diff, sealed_diff_nonce
+		FROM prompt_checkpoints WHERE prompt_id = $1`
+
+	err := r.db.GetContext(ctx, &checkpoint, query, promptID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prompt checkpoint: %w", err)
+	}
+
+	return &checkpoint, nil
+}
+
+func (r *promptCheckpointRepository) Delete(ctx context.Context, promptID uuid.UUID) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM prompt_checkpoints WHERE prompt_id = $1`, promptID); err != nil {
+		return fmt.Errorf("failed to delete prompt checkpoint: %w", err)
+	}
+
+	return nil
+}
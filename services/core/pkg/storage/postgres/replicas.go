@@ -0,0 +1,253 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// defaultMaxReplicaLag applies when Config.MaxReplicaLag is 0
+	defaultMaxReplicaLag = 5 * time.Second
+
+	// replicaCheckInterval is how often replica health and lag are measured
+	replicaCheckInterval = 2 * time.Second
+)
+
+// replicaLagQuery measures how far a standby is behind. A standby that has
+// replayed everything it received reports 0, since the last replayed
+// transaction's age says nothing about lag when the primary is idle.
+const replicaLagQuery = `
+	SELECT CASE
+		WHEN NOT pg_is_in_recovery() THEN 0
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END`
+
+// lockingClause matches SELECTs that take row locks and so must run on the
+// primary
+var lockingClause = regexp.MustCompile(`(?i)\bFOR\s+(UPDATE|NO\s+KEY\s+UPDATE|SHARE|KEY\s+SHARE)\b`)
+
+// isReadQuery reports whether query can run on a replica: a plain SELECT
+// without row locks. Anything else, including INSERT ... RETURNING run
+// through GetContext, goes to the primary.
+func isReadQuery(query string) bool {
+	trimmed := strings.TrimSpace(query)
+	if len(trimmed) < 6 || !strings.EqualFold(trimmed[:6], "SELECT") {
+		return false
+	}
+	return !lockingClause.MatchString(trimmed)
+}
+
+// replica is a read replica and its last measured state
+type replica struct {
+	host string
+	db   *sqlx.DB
+
+	mu     sync.Mutex
+	status storage.ReplicaStatus
+}
+
+// usable reports whether reads needing at most maxLag may use the replica
+func (r *replica) usable(maxLag time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status.Healthy && r.status.LagSeconds <= maxLag.Seconds()
+}
+
+func (r *replica) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, replicaCheckInterval)
+	defer cancel()
+
+	var lag float64
+	err := r.db.GetContext(ctx, &lag, replicaLagQuery)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	wasHealthy := r.status.Healthy
+	r.status.CheckedAt = time.Now()
+	if err != nil {
+		r.status.Healthy = false
+		r.status.Error = err.Error()
+		if wasHealthy {
+			log.Printf("Warning: Read replica %s unavailable, reading from the primary: %v", r.host, err)
+		}
+		return
+	}
+	r.status.Healthy = true
+	r.status.LagSeconds = lag
+	r.status.Error = ""
+}
+
+// splitDB is a dbtx that sends plain SELECTs to a replica and everything
+// else to the primary. A replica is only used while it is reachable and no
+// further behind than the store's lag limit, or the tighter limit set on
+// the context with storage.WithMaxReplicaLag; otherwise reads fall back to
+// the primary. Transactions always run on the primary (see WithTx and
+// runInTx).
+type splitDB struct {
+	primary  *sqlx.DB
+	replicas []*replica
+	maxLag   time.Duration
+	next     atomic.Uint64
+	stop     chan struct{}
+}
+
+func newSplitDB(primary *sqlx.DB, dsns []string, config Config) (*splitDB, error) {
+	s := &splitDB{
+		primary: primary,
+		maxLag:  config.MaxReplicaLag,
+		stop:    make(chan struct{}),
+	}
+	if s.maxLag <= 0 {
+		s.maxLag = defaultMaxReplicaLag
+	}
+
+	for _, dsn := range dsns {
+		// Opened lazily: a replica that is down at startup is skipped until
+		// a check reaches it
+		db, err := sqlx.Open("postgres", dsn)
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("invalid read replica DSN: %w", err)
+		}
+		if config.MaxOpenConns > 0 {
+			db.SetMaxOpenConns(config.MaxOpenConns)
+		}
+		if config.MaxIdleConns > 0 {
+			db.SetMaxIdleConns(config.MaxIdleConns)
+		}
+		r := &replica{host: dsnHost(dsn), db: db}
+		r.status.Host = r.host
+		s.replicas = append(s.replicas, r)
+	}
+
+	s.checkReplicas()
+	go s.monitor()
+	return s, nil
+}
+
+func (s *splitDB) monitor() {
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.checkReplicas()
+		}
+	}
+}
+
+func (s *splitDB) checkReplicas() {
+	var wg sync.WaitGroup
+	for _, r := range s.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			r.check(context.Background())
+		}(r)
+	}
+	wg.Wait()
+}
+
+// reader picks the database a query runs on
+func (s *splitDB) reader(ctx context.Context, query string) *sqlx.DB {
+	if !isReadQuery(query) {
+		return s.primary
+	}
+
+	maxLag := s.maxLag
+	if ctxLag, ok := storage.MaxReplicaLag(ctx); ok && ctxLag < maxLag {
+		maxLag = ctxLag
+	}
+	if maxLag <= 0 {
+		return s.primary
+	}
+
+	// Round-robin over the replicas, skipping unusable ones
+	start := s.next.Add(1)
+	for i := range s.replicas {
+		r := s.replicas[(int(start)+i)%len(s.replicas)]
+		if r.usable(maxLag) {
+			return r.db
+		}
+	}
+	return s.primary
+}
+
+func (s *splitDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return s.primary.ExecContext(ctx, query, args...)
+}
+
+func (s *splitDB) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	return s.primary.NamedExecContext(ctx, query, arg)
+}
+
+func (s *splitDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return s.reader(ctx, query).GetContext(ctx, dest, query, args...)
+}
+
+func (s *splitDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return s.reader(ctx, query).SelectContext(ctx, dest, query, args...)
+}
+
+func (s *splitDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return s.reader(ctx, query).QueryRowContext(ctx, query, args...)
+}
+
+func (s *splitDB) status() []storage.ReplicaStatus {
+	statuses := make([]storage.ReplicaStatus, len(s.replicas))
+	for i, r := range s.replicas {
+		r.mu.Lock()
+		statuses[i] = r.status
+		r.mu.Unlock()
+	}
+	return statuses
+}
+
+// close stops the monitor and closes the replica pools. The primary belongs
+// to the Store.
+func (s *splitDB) close() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	for _, r := range s.replicas {
+		r.db.Close()
+	}
+}
+
+// dsnHost returns the host of a URL or key=value DSN, for status reports
+// that must not include credentials
+func dsnHost(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+		return u.Host
+	}
+	host, port := "", ""
+	for _, field := range strings.Fields(dsn) {
+		if v, ok := strings.CutPrefix(field, "host="); ok {
+			host = v
+		} else if v, ok := strings.CutPrefix(field, "port="); ok {
+			port = v
+		}
+	}
+	if port != "" {
+		return host + ":" + port
+	}
+	return host
+}
@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+// searchRepository implements storage.SearchRepository with postgres
+// full-text search
+type searchRepository struct {
+	db dbtx
+}
+
+// Search vectors, matching the indexes of migration 000041
+const (
+	promptSearchVector = `(setweight(to_tsvector('english', p.prompt), 'A') ||
+		setweight(to_tsvector('english', left(coalesce(p.stdout, ''), 100000)), 'B'))`
+	stdoutSearchVector    = `to_tsvector('english', left(coalesce(stdout, ''), 100000))`
+	workspaceSearchVector = `to_tsvector('simple', w.name)`
+)
+
+// defaultSearchLimit applies when filters set no limit
+const defaultSearchLimit = 20
+
+// headlineOptions make ts_headline wrap matches in the storage markers and
+// return up to two short excerpts
+var headlineOptions = fmt.Sprintf(
+	`StartSel=%s, StopSel=%s, MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=" ... "`,
+	storage.HighlightStart, storage.HighlightStop)
+
+func searchLimit(filters *storage.SearchFilters) int {
+	if filters.Limit > 0 {
+		return filters.Limit
+	}
+	return defaultSearchLimit
+}
+
+// Prompts ranks matches before highlighting them, so ts_headline only runs
+// on the hits returned
+func (r *searchRepository) Prompts(ctx context.Context, query string, filters *storage.SearchFilters) ([]*storage.PromptSearchHit, error) {
+	if filters == nil {
+		filters = &storage.SearchFilters{}
+	}
+	sqlQuery := `
+		WITH q AS (SELECT websearch_to_tsquery('english', $1) AS query),
+		hits AS (
+			SELECT p.id, p.workspace_id, w.name AS workspace_name, p.status,
+				p.created_at, p.prompt, p.stdout,
+				ts_rank(` + promptSearchVector + `, q.query) AS rank
+			FROM prompt_tasks p
+			JOIN workspaces w ON w.id = p.workspace_id
+			CROSS JOIN q
+			WHERE ` + promptSearchVector + ` @@ q.query
+			  AND ($2 = '' OR w.metadata->>'project' = $2)
+			  AND ($3::uuid IS NULL OR p.workspace_id = $3)
+			ORDER BY rank DESC, p.created_at DESC
+			LIMIT $4
+		)
+		SELECT hits.id AS prompt_id, workspace_id, workspace_name, status, created_at, rank,
+			ts_headline('english', prompt, q.query, $5) AS prompt_highlight,
+			CASE WHEN ` + stdoutSearchVector + ` @@ q.query
+				THEN ts_headline('english', left(stdout, 100000), q.query, $5)
+				ELSE ''
+			END AS stdout_highlight
+		FROM hits CROSS JOIN q
+		ORDER BY rank DESC, created_at DESC`
+
+	var hits []*storage.PromptSearchHit
+	err := r.db.SelectContext(ctx, &hits, sqlQuery,
+		query, filters.Project, filters.WorkspaceID, searchLimit(filters), headlineOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search prompts: %w", err)
+	}
+
+	return hits, nil
+}
+
+func (r *searchRepository) Workspaces(ctx context.Context, query string, filters *storage.SearchFilters) ([]*storage.WorkspaceSearchHit, error) {
+	if filters == nil {
+		filters = &storage.SearchFilters{}
+	}
+	sqlQuery := `
+		SELECT w.id, w.name, w.status,
+			ts_rank(` + workspaceSearchVector + `, q.query) AS rank,
+			ts_headline('simple', w.name, q.query, $4) AS name_highlight
+		FROM workspaces w
+		CROSS JOIN websearch_to_tsquery('simple', $1) AS q(query)
+		WHERE ` + workspaceSearchVector + ` @@ q.query
+		  AND ($2 = '' OR w.metadata->>'project' = $2)
+		ORDER BY rank DESC, w.name
+		LIMIT $3`
+
+	var hits []*storage.WorkspaceSearchHit
+	err := r.db.SelectContext(ctx, &hits, sqlQuery, query, filters.Project, searchLimit(filters), headlineOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search workspaces: %w", err)
+	}
+
+	return hits, nil
+}
@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+// sloRepository implements storage.SLORepository
+type sloRepository struct {
+	db dbtx
+}
+
+func (r *sloRepository) AddRequests(ctx context.Context, target string, bucket time.Time, counts storage.SLOCounts) error {
+	query := `
+		INSERT INTO slo_request_counts (target, bucket, total, good, fast)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (target, bucket) DO UPDATE SET
+			total = slo_request_counts.total + EXCLUDED.total,
+			good = slo_request_counts.good + EXCLUDED.good,
+			fast = slo_request_counts.fast + EXCLUDED.fast
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, target, bucket, counts.Total, counts.Good, counts.Fast); err != nil {
+		return fmt.Errorf("failed to add SLO request counts: %w", err)
+	}
+
+	return nil
+}
+
+func (r *sloRepository) CountRequests(ctx context.Context, target string, since time.Time) (storage.SLOCounts, error) {
+	var counts storage.SLOCounts
+	query := `
+		SELECT COALESCE(SUM(total), 0) AS total, COALESCE(SUM(good), 0) AS good, COALESCE(SUM(fast), 0) AS fast
+		FROM slo_request_counts
+		WHERE target = $1 AND bucket >= $2`
+
+	if err := r.db.GetContext(ctx, &counts, query, target, since); err != nil {
+		return counts, fmt.Errorf("failed to count SLO requests: %w", err)
+	}
+
+	return counts, nil
+}
+
+func (r *sloRepository) DeleteRequestsBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM slo_request_counts WHERE bucket < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune SLO request counts: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (r *sloRepository) CountTasks(ctx context.Context, taskType string, since time.Time, latency time.Duration) (storage.SLOCounts, error) {
+	var counts storage.SLOCounts
+	query := `
+		SELECT
+			COUNT(*) AS total,
+			COUNT(*) FILTER (WHERE status = 'completed') AS good,
+			COUNT(*) FILTER (WHERE status = 'completed' AND completed_at - created_at <= $3::bigint * INTERVAL '1 millisecond') AS fast
+		FROM tasks
+		WHERE completed_at >= $1 AND status IN ('completed', 'failed') AND ($2 = '' OR type = $2)`
+
+	if err := r.db.GetContext(ctx, &counts, query, since, taskType, latency.Milliseconds()); err != nil {
+		return counts, fmt.Errorf("failed to count SLO tasks: %w", err)
+	}
+
+	return counts, nil
+}
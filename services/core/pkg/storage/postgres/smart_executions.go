@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+type smartExecutionRepository struct {
+	db dbtx
+}
+
+// smartExecutionSelect joins each smart execution with the latest execution
+// of its task
+const smartExecutionSelect = `
+	SELECT s.id, s.task_id, s.vm_id, s.vm_name, s.image, s.vm_created, s.vm_reused,
+	       s.command, s.args, s.environment, s.project, s.created_at,
+	       e.id AS execution_id, e.exit_code, e.error, e.completed_at, e.duration_ms
+	FROM smart_executions s
+	LEFT JOIN LATERAL (
+		SELECT id, exit_code, error, completed_at, duration_ms
+		FROM executions
+		WHERE task_id = s.task_id
+		ORDER BY started_at DESC
+		LIMIT 1
+	) e ON TRUE`
+
+func (r *smartExecutionRepository) Create(ctx context.Context, execution *storage.SmartExecution) error {
+	if execution.ID == uuid.Nil {
+		execution.ID = uuid.New()
+	}
+	if execution.CreatedAt.IsZero() {
+		execution.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO smart_executions (
+			id, task_id, vm_id, vm_name, image, vm_created, vm_reused,
+			command, args, environment, project, created_at
+		) VALUES (
+			:id, :task_id, :vm_id, :vm_name, :image, :vm_created, :vm_reused,
+			:command, :args, :environment, :project, :created_at
+		)
+	`
+	_, err := r.db.NamedExecContext(ctx, query, execution)
+	if err != nil {
+		return fmt.Errorf("failed to create smart execution: %w", err)
+	}
+	return nil
+}
+
+func (r *smartExecutionRepository) Get(ctx context.Context, id uuid.UUID) (*storage.SmartExecution, error) {
+	var execution storage.SmartExecution
+	query := smartExecutionSelect + ` WHERE s.id = $1`
+
+	err := r.db.GetContext(ctx, &execution, query, id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("smart execution not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get smart execution: %w", err)
+	}
+	return &execution, nil
+}
+
+func (r *smartExecutionRepository) List(ctx context.Context, filters map[string]interface{}) ([]*storage.SmartExecution, error) {
+	query := smartExecutionSelect + ` WHERE 1=1`
+	args := []interface{}{}
+	argIndex := 1
+
+	if vmID, ok := filters["vm_id"].(uuid.UUID); ok {
+		query += fmt.Sprintf(" AND s.vm_id = $%d", argIndex)
+		args = append(args, vmID)
+		argIndex++
+	}
+
+	if created, ok := filters["vm_created"].(bool); ok {
+		query += fmt.Sprintf(" AND s.vm_created = $%d", argIndex)
+		args = append(args, created)
+		argIndex++
+	}
+
+	for _, column := range []string{"environment", "project"} {
+		if value, ok := filters[column].(string); ok && value != "" {
+			query += fmt.Sprintf(" AND s.%s = $%d", column, argIndex)
+			args = append(args, value)
+			argIndex++
+		}
+	}
+
+	switch filters["status"] {
+	case storage.SmartExecutionPending:
+		query += " AND e.id IS NULL"
+	case storage.SmartExecutionCompleted:
+		query += " AND e.id IS NOT NULL AND e.error IS NULL"
+	case storage.SmartExecutionFailed:
+		query += " AND e.error IS NOT NULL"
+	}
+
+	if since, ok := filters["since"].(time.Time); ok {
+		query += fmt.Sprintf(" AND s.created_at >= $%d", argIndex)
+		args = append(args, since)
+		argIndex++
+	}
+
+	if until, ok := filters["until"].(time.Time); ok {
+		query += fmt.Sprintf(" AND s.created_at <= $%d", argIndex)
+		args = append(args, until)
+		argIndex++
+	}
+
+	query += " ORDER BY s.created_at DESC"
+
+	if limit, ok := filters["limit"].(int); ok && limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d", argIndex)
+		args = append(args, limit)
+	}
+
+	var executions []*storage.SmartExecution
+	if err := r.db.SelectContext(ctx, &executions, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list smart executions: %w", err)
+	}
+	return executions, nil
+}
@@ -8,26 +8,26 @@ import (
 
 	"github.com/aetherium/aetherium/services/core/pkg/storage"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 )
 
 type taskRepository struct {
-	db *sqlx.DB
+	db dbtx
 }
 
 func (r *taskRepository) Create(ctx context.Context, task *storage.Task) error {
 	query := `
 		INSERT INTO tasks (
-			id, type, status, priority, payload, vm_id, worker_id,
-			max_retries, retry_count, scheduled_at, metadata
+			id, type, status, priority, payload, vm_id, workspace_id,
+			prompt_id, worker_id, max_retries, retry_count, scheduled_at,
+			metadata
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
 		)`
 
 	_, err := r.db.ExecContext(ctx, query,
 		task.ID, task.Type, task.Status, task.Priority, task.Payload,
-		task.VMID, task.WorkerID, task.MaxRetries, task.RetryCount,
-		task.ScheduledAt, task.Metadata,
+		task.VMID, task.WorkspaceID, task.PromptID, task.WorkerID,
+		task.MaxRetries, task.RetryCount, task.ScheduledAt, task.Metadata,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create task: %w", err)
@@ -74,7 +74,7 @@ func (r *taskRepository) List(ctx context.Context, filters map[string]interface{
 		argIndex++
 	}
 
-	query += " ORDER BY priority DESC, scheduled_at ASC"
+	query += " ORDER BY created_at DESC"
 
 	if limit, ok := filters["limit"].(int); ok && limit > 0 {
 		query += fmt.Sprintf(" LIMIT $%d", argIndex)
@@ -94,16 +94,17 @@ func (r *taskRepository) Update(ctx context.Context, task *storage.Task) error {
 	query := `
 		UPDATE tasks SET
 			type = $2, status = $3, priority = $4, payload = $5,
-			result = $6, error = $7, vm_id = $8, worker_id = $9,
-			max_retries = $10, retry_count = $11, scheduled_at = $12,
-			started_at = $13, completed_at = $14, metadata = $15
+			result = $6, error = $7, vm_id = $8, workspace_id = $9,
+			prompt_id = $10, worker_id = $11, max_retries = $12,
+			retry_count = $13, scheduled_at = $14, started_at = $15,
+			completed_at = $16, metadata = $17
 		WHERE id = $1`
 
 	result, err := r.db.ExecContext(ctx, query,
 		task.ID, task.Type, task.Status, task.Priority, task.Payload,
-		task.Result, task.Error, task.VMID, task.WorkerID,
-		task.MaxRetries, task.RetryCount, task.ScheduledAt,
-		task.StartedAt, task.CompletedAt, task.Metadata,
+		task.Result, task.Error, task.VMID, task.WorkspaceID,
+		task.PromptID, task.WorkerID, task.MaxRetries, task.RetryCount,
+		task.ScheduledAt, task.StartedAt, task.CompletedAt, task.Metadata,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update task: %w", err)
@@ -163,7 +164,7 @@ func (r *taskRepository) MarkProcessing(ctx context.Context, id uuid.UUID, worke
 	query := `
 		UPDATE tasks SET
 			status = 'processing',
-			worker_id = $2,
+			worker_id = NULLIF($2, ''),
 			started_at = NOW()
 		WHERE id = $1`
 
@@ -208,59 +209,114 @@ func (r *taskRepository) MarkCompleted(ctx context.Context, id uuid.UUID, result
 }
 
 func (r *taskRepository) MarkFailed(ctx context.Context, id uuid.UUID, taskErr error) error {
-	tx, err := r.db.BeginTxx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback()
-
-	// Get current retry count
-	var task storage.Task
-	query := `SELECT * FROM tasks WHERE id = $1 FOR UPDATE`
-	err = tx.GetContext(ctx, &task, query, id)
-	if err != nil {
-		return fmt.Errorf("failed to get task: %w", err)
-	}
-
-	task.RetryCount++
-	errorMsg := taskErr.Error()
-	task.Error = &errorMsg
+	return runInTx(ctx, r.db, func(tx dbtx) error {
+		// Get current retry count
+		var task storage.Task
+		query := `SELECT * FROM tasks WHERE id = $1 FOR UPDATE`
+		err := tx.GetContext(ctx, &task, query, id)
+		if err != nil {
+			return fmt.Errorf("failed to get task: %w", err)
+		}
+
+		task.RetryCount++
+		errorMsg := taskErr.Error()
+		task.Error = &errorMsg
+
+		// Determine new status
+		newStatus := "failed"
+		var completedAt *time.Time
+		now := time.Now()
+
+		if task.RetryCount < task.MaxRetries {
+			newStatus = "retrying"
+			// Schedule retry with exponential backoff
+			delay := time.Duration(task.RetryCount*task.RetryCount) * time.Second
+			scheduledAt := now.Add(delay)
+			task.ScheduledAt = scheduledAt
+		} else {
+			completedAt = &now
+		}
+
+		// Update task
+		updateQuery := `
+			UPDATE tasks SET
+				status = $2,
+				error = $3,
+				retry_count = $4,
+				scheduled_at = $5,
+				completed_at = $6
+			WHERE id = $1`
+
+		_, err = tx.ExecContext(ctx, updateQuery,
+			id, newStatus, task.Error, task.RetryCount, task.ScheduledAt, completedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update task: %w", err)
+		}
+
+		return nil
+	})
+}
 
-	// Determine new status
-	newStatus := "failed"
+func (r *taskRepository) Finish(ctx context.Context, id uuid.UUID, outcome *storage.TaskOutcome) error {
+	// A task that will be retried isn't complete yet
 	var completedAt *time.Time
-	now := time.Now()
-
-	if task.RetryCount < task.MaxRetries {
-		newStatus = "retrying"
-		// Schedule retry with exponential backoff
-		delay := time.Duration(task.RetryCount*task.RetryCount) * time.Second
-		scheduledAt := now.Add(delay)
-		task.ScheduledAt = scheduledAt
-	} else {
+	if outcome.Status != storage.TaskStatusRetrying {
+		now := time.Now()
 		completedAt = &now
 	}
 
-	// Update task
-	updateQuery := `
+	query := `
 		UPDATE tasks SET
 			status = $2,
-			error = $3,
-			retry_count = $4,
-			scheduled_at = $5,
-			completed_at = $6
+			result = $3,
+			error = $4,
+			retry_count = $5,
+			vm_id = COALESCE(vm_id, $6),
+			completed_at = $7
 		WHERE id = $1`
 
-	_, err = tx.ExecContext(ctx, updateQuery,
-		id, newStatus, task.Error, task.RetryCount, task.ScheduledAt, completedAt,
+	result, err := r.db.ExecContext(ctx, query,
+		id, outcome.Status, outcome.Result, outcome.Error, outcome.RetryCount,
+		outcome.VMID, completedAt,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to update task: %w", err)
+		return fmt.Errorf("failed to finish task: %w", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("task not found: %s", id)
 	}
 
 	return nil
 }
+
+func (r *taskRepository) ListByVM(ctx context.Context, vmID uuid.UUID, limit int) ([]*storage.Task, error) {
+	return r.listBy(ctx, "vm_id", vmID, limit)
+}
+
+func (r *taskRepository) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, limit int) ([]*storage.Task, error) {
+	return r.listBy(ctx, "workspace_id", workspaceID, limit)
+}
+
+// listBy lists the tasks linked to an entity through column, newest first
+func (r *taskRepository) listBy(ctx context.Context, column string, id uuid.UUID, limit int) ([]*storage.Task, error) {
+	query := fmt.Sprintf(`SELECT * FROM tasks WHERE %s = $1 ORDER BY created_at DESC`, column)
+	args := []interface{}{id}
+	if limit > 0 {
+		query += " LIMIT $2"
+		args = append(args, limit)
+	}
+
+	var tasks []*storage.Task
+	err := r.db.SelectContext(ctx, &tasks, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+
+	return tasks, nil
+}
@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/transcript"
+	"github.com/google/uuid"
+)
+
+// transcriptLockKey is the advisory lock appends to the transcript chain
+// hold, so concurrent writers link their entries one after another
+const transcriptLockKey = 0x7472616e73637269 // "transcri"
+
+// transcriptRepository implements storage.TranscriptRepository
+type transcriptRepository struct {
+	db dbtx
+}
+
+func (r *transcriptRepository) List(ctx context.Context, afterSeq int64, limit int) ([]*storage.TranscriptEntry, error) {
+	var entries []*storage.TranscriptEntry
+	query := `SELECT * FROM transcript_entries WHERE seq > $1 ORDER BY seq LIMIT $2`
+
+	if err := r.db.SelectContext(ctx, &entries, query, afterSeq, limit); err != nil {
+		return nil, fmt.Errorf("failed to list transcript entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (r *transcriptRepository) ListByRecord(ctx context.Context, recordID uuid.UUID) ([]*storage.TranscriptEntry, error) {
+	var entries []*storage.TranscriptEntry
+	query := `SELECT * FROM transcript_entries WHERE record_id = $1 ORDER BY seq`
+
+	if err := r.db.SelectContext(ctx, &entries, query, recordID); err != nil {
+		return nil, fmt.Errorf("failed to list transcript entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (r *transcriptRepository) Head(ctx context.Context) (*storage.TranscriptEntry, error) {
+	return transcriptHead(ctx, r.db)
+}
+
+func (r *transcriptRepository) Anchor(ctx context.Context, anchor *storage.TranscriptAnchor) (bool, error) {
+	query := `
+		INSERT INTO transcript_anchors (seq, hash, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (seq) DO NOTHING`
+
+	result, err := r.db.ExecContext(ctx, query, anchor.Seq, anchor.Hash, anchor.CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to anchor transcript: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rows > 0, nil
+}
+
+func (r *transcriptRepository) ListAnchors(ctx context.Context) ([]*storage.TranscriptAnchor, error) {
+	var anchors []*storage.TranscriptAnchor
+	query := `SELECT * FROM transcript_anchors ORDER BY seq`
+
+	if err := r.db.SelectContext(ctx, &anchors, query); err != nil {
+		return nil, fmt.Errorf("failed to list transcript anchors: %w", err)
+	}
+
+	return anchors, nil
+}
+
+// transcriptHead returns the chain's last entry, or nil while it's empty
+func transcriptHead(ctx context.Context, db dbtx) (*storage.TranscriptEntry, error) {
+	var head storage.TranscriptEntry
+	err := db.GetContext(ctx, &head, `SELECT * FROM transcript_entries ORDER BY seq DESC LIMIT 1`)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transcript head: %w", err)
+	}
+	return &head, nil
+}
+
+// appendTranscript links a record into the transcript chain. tx must be a
+// transaction, the one that wrote the record.
+func appendTranscript(ctx context.Context, tx dbtx, kind string, recordID uuid.UUID, contentHash string) error {
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, int64(transcriptLockKey)); err != nil {
+		return fmt.Errorf("failed to lock transcript chain: %w", err)
+	}
+
+	prev, err := transcriptHead(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	entry := &storage.TranscriptEntry{
+		Kind:        kind,
+		RecordID:    recordID,
+		ContentHash: contentHash,
+		CreatedAt:   time.Now(),
+	}
+	transcript.Seal(entry, prev)
+
+	query := `
+		INSERT INTO transcript_entries (seq, kind, record_id, content_hash, prev_hash, hash, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	if _, err := tx.ExecContext(ctx, query,
+		entry.Seq, entry.Kind, entry.RecordID, entry.ContentHash, entry.PrevHash, entry.Hash, entry.CreatedAt,
+	); err != nil {
+		return fmt.Errorf("failed to append transcript entry: %w", err)
+	}
+
+	return nil
+}
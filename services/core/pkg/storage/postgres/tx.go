@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+// dbtx is the query interface shared by *sqlx.DB and *sqlx.Tx, so the same
+// repositories work inside and outside a transaction
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// WithTx runs fn with a Store whose repositories share one transaction. The
+// transaction is committed if fn returns nil and rolled back otherwise.
+// Calling WithTx on the Store passed to fn runs in the same transaction.
+func (s *Store) WithTx(ctx context.Context, fn func(tx storage.Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	txStore := newStore(s.db, tx)
+	txStore.tx = tx
+	if s.cache != nil {
+		txStore.setCache(s.cache, false)
+	}
+	if s.chainTranscripts {
+		txStore.setTranscriptChain(tx)
+	}
+	if err := fn(txStore); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// runInTx runs fn in a transaction on the primary. When db already belongs
+// to one (the repository was obtained inside WithTx), fn joins it and the
+// outer WithTx commits.
+func runInTx(ctx context.Context, db dbtx, fn func(tx dbtx) error) error {
+	var sqlDB *sqlx.DB
+	switch db := db.(type) {
+	case *sqlx.DB:
+		sqlDB = db
+	case *splitDB:
+		sqlDB = db.primary
+	default:
+		return fn(db)
+	}
+
+	tx, err := sqlDB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+type vmGCPolicyRepository struct {
+	db dbtx
+}
+
+func (r *vmGCPolicyRepository) Get(ctx context.Context, project string) (*storage.VMGCPolicy, error) {
+	var policy storage.VMGCPolicy
+	query := `
+		SELECT project, max_age_seconds, max_idle_seconds, warning_seconds,
+		       enabled, created_at, updated_at
+		FROM vm_gc_policies
+		WHERE project = $1
+	`
+
+	err := r.db.GetContext(ctx, &policy, query, project)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("VM GC policy not found: %s", project)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VM GC policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+func (r *vmGCPolicyRepository) List(ctx context.Context) ([]*storage.VMGCPolicy, error) {
+	var policies []*storage.VMGCPolicy
+	query := `
+		SELECT project, max_age_seconds, max_idle_seconds, warning_seconds,
+		       enabled, created_at, updated_at
+		FROM vm_gc_policies
+		ORDER BY project
+	`
+
+	if err := r.db.SelectContext(ctx, &policies, query); err != nil {
+		return nil, fmt.Errorf("failed to list VM GC policies: %w", err)
+	}
+
+	return policies, nil
+}
+
+func (r *vmGCPolicyRepository) Upsert(ctx context.Context, policy *storage.VMGCPolicy) error {
+	query := `
+		INSERT INTO vm_gc_policies (
+			project, max_age_seconds, max_idle_seconds, warning_seconds, enabled,
+			created_at, updated_at
+		) VALUES (
+			$1, $2, $3, $4, $5, NOW(), NOW()
+		)
+		ON CONFLICT (project) DO UPDATE SET
+			max_age_seconds = EXCLUDED.max_age_seconds,
+			max_idle_seconds = EXCLUDED.max_idle_seconds,
+			warning_seconds = EXCLUDED.warning_seconds,
+			enabled = EXCLUDED.enabled,
+			updated_at = NOW()
+		RETURNING created_at, updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		policy.Project, policy.MaxAgeSeconds, policy.MaxIdleSeconds,
+		policy.WarningSeconds, policy.Enabled,
+	).Scan(&policy.CreatedAt, &policy.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to upsert VM GC policy: %w", err)
+	}
+
+	return nil
+}
+
+func (r *vmGCPolicyRepository) Delete(ctx context.Context, project string) error {
+	query := `DELETE FROM vm_gc_policies WHERE project = $1`
+
+	result, err := r.db.ExecContext(ctx, query, project)
+	if err != nil {
+		return fmt.Errorf("failed to delete VM GC policy: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("VM GC policy not found: %s", project)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// vmSnapshotRepository implements storage.VMSnapshotRepository. Reads go
+// to the primary: snapshots are restored right after they are taken.
+type vmSnapshotRepository struct {
+	db dbtx
+}
+
+func (r *vmSnapshotRepository) Create(ctx context.Context, snapshot *storage.VMSnapshot) error {
+	query := `
+		INSERT INTO vm_snapshots (id, vm_id, worker_id, name, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		snapshot.ID, snapshot.VMID, snapshot.WorkerID, snapshot.Name,
+		snapshot.Status, snapshot.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create VM snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func (r *vmSnapshotRepository) Get(ctx context.Context, id uuid.UUID) (*storage.VMSnapshot, error) {
+	var snapshot storage.VMSnapshot
+	query := `SELECT * FROM vm_snapshots WHERE id = $1`
+
+	err := r.db.GetContext(storage.WithPrimaryReads(ctx), &snapshot, query, id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("VM snapshot not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VM snapshot: %w", err)
+	}
+
+	return &snapshot, nil
+}
+
+func (r *vmSnapshotRepository) ListByVM(ctx context.Context, vmID uuid.UUID) ([]*storage.VMSnapshot, error) {
+	var snapshots []*storage.VMSnapshot
+	query := `SELECT * FROM vm_snapshots WHERE vm_id = $1 ORDER BY created_at DESC`
+
+	if err := r.db.SelectContext(storage.WithPrimaryReads(ctx), &snapshots, query, vmID); err != nil {
+		return nil, fmt.Errorf("failed to list VM snapshots: %w", err)
+	}
+
+	return snapshots, nil
+}
+
+func (r *vmSnapshotRepository) Complete(ctx context.Context, id uuid.UUID, sizeBytes int64) error {
+	query := `
+		UPDATE vm_snapshots
+		SET status = $2, size_bytes = $3, error = NULL, completed_at = NOW()
+		WHERE id = $1
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, id, storage.VMSnapshotStatusReady, sizeBytes); err != nil {
+		return fmt.Errorf("failed to complete VM snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func (r *vmSnapshotRepository) Fail(ctx context.Context, id uuid.UUID, reason string) error {
+	query := `
+		UPDATE vm_snapshots
+		SET status = $2, error = $3, completed_at = NOW()
+		WHERE id = $1
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, id, storage.VMSnapshotStatusFailed, reason); err != nil {
+		return fmt.Errorf("failed to fail VM snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func (r *vmSnapshotRepository) MarkRestored(ctx context.Context, id uuid.UUID) error {
+	if _, err := r.db.ExecContext(ctx, `UPDATE vm_snapshots SET restored_at = NOW() WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to mark VM snapshot restored: %w", err)
+	}
+
+	return nil
+}
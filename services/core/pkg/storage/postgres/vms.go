@@ -6,16 +6,22 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
 	"github.com/aetherium/aetherium/services/core/pkg/storage"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 )
 
 type vmRepository struct {
-	db *sqlx.DB
+	db dbtx
 }
 
 func (r *vmRepository) Create(ctx context.Context, vm *storage.VM) error {
+	status, err := types.ParseVMStatus(vm.Status)
+	if err != nil {
+		return fmt.Errorf("failed to create VM: %w", err)
+	}
+	vm.Status = string(status)
+
 	query := `
 		INSERT INTO vms (
 			id, name, orchestrator, status, kernel_path, rootfs_path, socket_path,
@@ -26,7 +32,6 @@ func (r *vmRepository) Create(ctx context.Context, vm *storage.VM) error {
 
 	// Marshal metadata to JSON
 	var metadataJSON []byte
-	var err error
 	if vm.Metadata != nil {
 		metadataJSON, err = json.Marshal(vm.Metadata)
 		if err != nil {
@@ -99,6 +104,12 @@ func (r *vmRepository) List(ctx context.Context, filters map[string]interface{})
 		argIndex++
 	}
 
+	if workspaceID, ok := filters["workspace_id"].(string); ok {
+		query += fmt.Sprintf(" AND metadata->>'workspace_id' = $%d", argIndex)
+		args = append(args, workspaceID)
+		argIndex++
+	}
+
 	query += " ORDER BY created_at DESC"
 
 	if limit, ok := filters["limit"].(int); ok && limit > 0 {
@@ -115,18 +126,37 @@ func (r *vmRepository) List(ctx context.Context, filters map[string]interface{})
 	return vms, nil
 }
 
+// Update saves a VM, rejecting status changes the VM state machine doesn't allow
 func (r *vmRepository) Update(ctx context.Context, vm *storage.VM) error {
+	next, err := types.ParseVMStatus(vm.Status)
+	if err != nil {
+		return fmt.Errorf("failed to update VM: %w", err)
+	}
+	vm.Status = string(next)
+
+	var current string
+	err = r.db.GetContext(ctx, &current, `SELECT status FROM vms WHERE id = $1`, vm.ID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("VM not found: %s", vm.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get VM status: %w", err)
+	}
+	if err := types.VMStatus(current).TransitionTo(next); err != nil {
+		return fmt.Errorf("failed to update VM %s: %w", vm.ID, err)
+	}
+
+	// The status guard makes a concurrent transition fail instead of being overwritten
 	query := `
 		UPDATE vms SET
 			name = $2, orchestrator = $3, status = $4,
 			kernel_path = $5, rootfs_path = $6, socket_path = $7,
 			vcpu_count = $8, memory_mb = $9,
 			started_at = $10, stopped_at = $11, metadata = $12
-		WHERE id = $1`
+		WHERE id = $1 AND status = $13`
 
 	// Marshal metadata to JSON
 	var metadataJSON []byte
-	var err error
 	if vm.Metadata != nil {
 		metadataJSON, err = json.Marshal(vm.Metadata)
 		if err != nil {
@@ -138,7 +168,7 @@ func (r *vmRepository) Update(ctx context.Context, vm *storage.VM) error {
 		vm.ID, vm.Name, vm.Orchestrator, vm.Status,
 		vm.KernelPath, vm.RootFSPath, vm.SocketPath,
 		vm.VCPUCount, vm.MemoryMB,
-		vm.StartedAt, vm.StoppedAt, metadataJSON,
+		vm.StartedAt, vm.StoppedAt, metadataJSON, current,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update VM: %w", err)
@@ -149,7 +179,7 @@ func (r *vmRepository) Update(ctx context.Context, vm *storage.VM) error {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 	if rows == 0 {
-		return fmt.Errorf("VM not found: %s", vm.ID)
+		return fmt.Errorf("VM %s status changed concurrently from %s", vm.ID, current)
 	}
 
 	return nil
@@ -173,3 +203,22 @@ func (r *vmRepository) Delete(ctx context.Context, id uuid.UUID) error {
 
 	return nil
 }
+
+func (r *vmRepository) UpdateLastUsed(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE vms SET last_used_at = NOW() WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to update VM last used: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("VM not found: %s", id)
+	}
+
+	return nil
+}
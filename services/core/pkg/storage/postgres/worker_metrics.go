@@ -7,11 +7,10 @@ import (
 
 	"github.com/aetherium/aetherium/services/core/pkg/storage"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 )
 
 type workerMetricRepository struct {
-	db *sqlx.DB
+	db dbtx
 }
 
 func (r *workerMetricRepository) Create(ctx context.Context, metric *storage.WorkerMetric) error {
@@ -24,13 +23,21 @@ func (r *workerMetricRepository) Create(ctx context.Context, metric *storage.Wor
 			id, worker_id, timestamp,
 			cpu_usage, memory_usage, disk_usage,
 			vm_count, tasks_processed,
+			tasks_in_progress, tasks_per_minute, queue_latency_ms, error_count,
 			network_in_mb, network_out_mb,
+			load_avg_1m, load_avg_5m, load_avg_15m,
+			cpu_steal_percent, disk_io_percent, temperature_c,
+			gpu_temperature_c, gpu_utilization_percent,
 			metadata
 		) VALUES (
 			:id, :worker_id, :timestamp,
 			:cpu_usage, :memory_usage, :disk_usage,
 			:vm_count, :tasks_processed,
+			:tasks_in_progress, :tasks_per_minute, :queue_latency_ms, :error_count,
 			:network_in_mb, :network_out_mb,
+			:load_avg_1m, :load_avg_5m, :load_avg_15m,
+			:cpu_steal_percent, :disk_io_percent, :temperature_c,
+			:gpu_temperature_c, :gpu_utilization_percent,
 			:metadata
 		)
 	`
@@ -47,7 +54,11 @@ func (r *workerMetricRepository) Get(ctx context.Context, id uuid.UUID) (*storag
 		SELECT id, worker_id, timestamp,
 		       cpu_usage, memory_usage, disk_usage,
 		       vm_count, tasks_processed,
+		       tasks_in_progress, tasks_per_minute, queue_latency_ms, error_count,
 		       network_in_mb, network_out_mb,
+		       load_avg_1m, load_avg_5m, load_avg_15m,
+		       cpu_steal_percent, disk_io_percent, temperature_c,
+		       gpu_temperature_c, gpu_utilization_percent,
 		       metadata
 		FROM worker_metrics
 		WHERE id = $1
@@ -67,7 +78,11 @@ func (r *workerMetricRepository) ListByWorker(ctx context.Context, workerID stri
 		SELECT id, worker_id, timestamp,
 		       cpu_usage, memory_usage, disk_usage,
 		       vm_count, tasks_processed,
+		       tasks_in_progress, tasks_per_minute, queue_latency_ms, error_count,
 		       network_in_mb, network_out_mb,
+		       load_avg_1m, load_avg_5m, load_avg_15m,
+		       cpu_steal_percent, disk_io_percent, temperature_c,
+		       gpu_temperature_c, gpu_utilization_percent,
 		       metadata
 		FROM worker_metrics
 		WHERE worker_id = $1
@@ -87,7 +102,11 @@ func (r *workerMetricRepository) ListByWorkerInTimeRange(ctx context.Context, wo
 		SELECT id, worker_id, timestamp,
 		       cpu_usage, memory_usage, disk_usage,
 		       vm_count, tasks_processed,
+		       tasks_in_progress, tasks_per_minute, queue_latency_ms, error_count,
 		       network_in_mb, network_out_mb,
+		       load_avg_1m, load_avg_5m, load_avg_15m,
+		       cpu_steal_percent, disk_io_percent, temperature_c,
+		       gpu_temperature_c, gpu_utilization_percent,
 		       metadata
 		FROM worker_metrics
 		WHERE worker_id = $1 AND timestamp >= $2 AND timestamp <= $3
@@ -5,11 +5,10 @@ import (
 	"fmt"
 
 	"github.com/aetherium/aetherium/services/core/pkg/storage"
-	"github.com/jmoiron/sqlx"
 )
 
 type workerRepository struct {
-	db *sqlx.DB
+	db dbtx
 }
 
 func (r *workerRepository) Create(ctx context.Context, worker *storage.Worker) error {
@@ -180,6 +179,28 @@ func (r *workerRepository) UpdateLastSeen(ctx context.Context, id string) error
 	return nil
 }
 
+func (r *workerRepository) UpdateMetadata(ctx context.Context, id string, metadata map[string]interface{}) error {
+	query := `
+		UPDATE workers SET
+			metadata = COALESCE(metadata, '{}'::jsonb) || $2::jsonb
+		WHERE id = $1
+	`
+	result, err := r.db.ExecContext(ctx, query, id, storage.JSONB(metadata))
+	if err != nil {
+		return fmt.Errorf("failed to update worker metadata: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("worker not found: %s", id)
+	}
+
+	return nil
+}
+
 func (r *workerRepository) Delete(ctx context.Context, id string) error {
 	query := `DELETE FROM workers WHERE id = $1`
 	result, err := r.db.ExecContext(ctx, query, id)
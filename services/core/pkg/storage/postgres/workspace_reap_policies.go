@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+type workspaceReapPolicyRepository struct {
+	db dbtx
+}
+
+func (r *workspaceReapPolicyRepository) Get(ctx context.Context, project string) (*storage.WorkspaceReapPolicy, error) {
+	var policy storage.WorkspaceReapPolicy
+	query := `
+		SELECT project, stale_after_seconds, grace_seconds, notify, enabled,
+		       created_at, updated_at
+		FROM workspace_reap_policies
+		WHERE project = $1
+	`
+
+	err := r.db.GetContext(ctx, &policy, query, project)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("workspace reap policy not found: %s", project)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace reap policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+func (r *workspaceReapPolicyRepository) List(ctx context.Context) ([]*storage.WorkspaceReapPolicy, error) {
+	var policies []*storage.WorkspaceReapPolicy
+	query := `
+		SELECT project, stale_after_seconds, grace_seconds, notify, enabled,
+		       created_at, updated_at
+		FROM workspace_reap_policies
+		ORDER BY project
+	`
+
+	if err := r.db.SelectContext(ctx, &policies, query); err != nil {
+		return nil, fmt.Errorf("failed to list workspace reap policies: %w", err)
+	}
+
+	return policies, nil
+}
+
+func (r *workspaceReapPolicyRepository) Upsert(ctx context.Context, policy *storage.WorkspaceReapPolicy) error {
+	query := `
+		INSERT INTO workspace_reap_policies (
+			project, stale_after_seconds, grace_seconds, notify, enabled,
+			created_at, updated_at
+		) VALUES (
+			$1, $2, $3, $4, $5, NOW(), NOW()
+		)
+		ON CONFLICT (project) DO UPDATE SET
+			stale_after_seconds = EXCLUDED.stale_after_seconds,
+			grace_seconds = EXCLUDED.grace_seconds,
+			notify = EXCLUDED.notify,
+			enabled = EXCLUDED.enabled,
+			updated_at = NOW()
+		RETURNING created_at, updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		policy.Project, policy.StaleAfterSeconds, policy.GraceSeconds,
+		policy.Notify, policy.Enabled,
+	).Scan(&policy.CreatedAt, &policy.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to upsert workspace reap policy: %w", err)
+	}
+
+	return nil
+}
+
+func (r *workspaceReapPolicyRepository) Delete(ctx context.Context, project string) error {
+	query := `DELETE FROM workspace_reap_policies WHERE project = $1`
+
+	result, err := r.db.ExecContext(ctx, query, project)
+	if err != nil {
+		return fmt.Errorf("failed to delete workspace reap policy: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("workspace reap policy not found: %s", project)
+	}
+
+	return nil
+}
@@ -8,15 +8,19 @@ import (
 	"time"
 
 	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/transcript"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 )
 
 type workspaceRepository struct {
-	db *sqlx.DB
+	db dbtx
 }
 
 func (r *workspaceRepository) Create(ctx context.Context, workspace *storage.Workspace) error {
+	if !storage.ValidWorkspaceStatus(workspace.Status) {
+		return fmt.Errorf("failed to create workspace: unknown status %q", workspace.Status)
+	}
+
 	query := `
 		INSERT INTO workspaces (
 			id, name, description, vm_id, status, ai_assistant, ai_assistant_config,
@@ -44,16 +48,18 @@ func (r *workspaceRepository) Create(ctx context.Context, workspace *storage.Wor
 		}
 	}
 
-	_, err = r.db.ExecContext(ctx, query,
-		workspace.ID, workspace.Name, workspace.Description, workspace.VMID,
-		workspace.Status, workspace.AIAssistant, configJSON,
-		workspace.WorkingDirectory, workspace.EnvironmentID, metadataJSON,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create workspace: %w", err)
-	}
+	return runInTx(ctx, r.db, func(tx dbtx) error {
+		_, err := tx.ExecContext(ctx, query,
+			workspace.ID, workspace.Name, workspace.Description, workspace.VMID,
+			workspace.Status, workspace.AIAssistant, configJSON,
+			workspace.WorkingDirectory, workspace.EnvironmentID, metadataJSON,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create workspace: %w", err)
+		}
 
-	return nil
+		return recordWorkspaceStatus(ctx, tx, workspace.ID, nil, workspace.Status, "workspace created")
+	})
 }
 
 func (r *workspaceRepository) Get(ctx context.Context, id uuid.UUID) (*storage.Workspace, error) {
@@ -118,6 +124,12 @@ func (r *workspaceRepository) List(ctx context.Context, filters map[string]inter
 		argIndex++
 	}
 
+	if owner, ok := filters["owner"].(string); ok {
+		query += fmt.Sprintf(" AND annotations->>'owner' = $%d", argIndex)
+		args = append(args, owner)
+		argIndex++
+	}
+
 	query += " ORDER BY created_at DESC"
 
 	if limit, ok := filters["limit"].(int); ok && limit > 0 {
@@ -161,13 +173,23 @@ func (r *workspaceRepository) Update(ctx context.Context, workspace *storage.Wor
 		}
 	}
 
-	result, err := r.db.ExecContext(ctx, query,
+	return r.transition(ctx, workspace.ID, workspace.Status, "workspace updated", query,
 		workspace.ID, workspace.Name, workspace.Description, workspace.VMID,
 		workspace.Status, workspace.AIAssistant, configJSON, workspace.WorkingDirectory,
 		workspace.ReadyAt, workspace.StoppedAt, metadataJSON,
 	)
+}
+
+func (r *workspaceRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status, reason string) error {
+	return r.transition(ctx, id, status, reason, `UPDATE workspaces SET status = $2 WHERE id = $1`, id, status)
+}
+
+func (r *workspaceRepository) SetVMID(ctx context.Context, id uuid.UUID, vmID uuid.UUID) error {
+	query := `UPDATE workspaces SET vm_id = $2 WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id, vmID)
 	if err != nil {
-		return fmt.Errorf("failed to update workspace: %w", err)
+		return fmt.Errorf("failed to set workspace VM ID: %w", err)
 	}
 
 	rows, err := result.RowsAffected()
@@ -175,18 +197,23 @@ func (r *workspaceRepository) Update(ctx context.Context, workspace *storage.Wor
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 	if rows == 0 {
-		return fmt.Errorf("workspace not found: %s", workspace.ID)
+		return fmt.Errorf("workspace not found: %s", id)
 	}
 
 	return nil
 }
 
-func (r *workspaceRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status string) error {
-	query := `UPDATE workspaces SET status = $2 WHERE id = $1`
+func (r *workspaceRepository) SetReady(ctx context.Context, id uuid.UUID, reason string) error {
+	query := `UPDATE workspaces SET status = $2, ready_at = $3 WHERE id = $1`
+	return r.transition(ctx, id, storage.WorkspaceStatusReady, reason, query, id, storage.WorkspaceStatusReady, time.Now())
+}
+
+func (r *workspaceRepository) SetCreatePhase(ctx context.Context, id uuid.UUID, phase string) error {
+	query := `UPDATE workspaces SET create_phase = $2 WHERE id = $1`
 
-	result, err := r.db.ExecContext(ctx, query, id, status)
+	result, err := r.db.ExecContext(ctx, query, id, phase)
 	if err != nil {
-		return fmt.Errorf("failed to update workspace status: %w", err)
+		return fmt.Errorf("failed to set workspace create phase: %w", err)
 	}
 
 	rows, err := result.RowsAffected()
@@ -200,12 +227,16 @@ func (r *workspaceRepository) UpdateStatus(ctx context.Context, id uuid.UUID, st
 	return nil
 }
 
-func (r *workspaceRepository) SetVMID(ctx context.Context, id uuid.UUID, vmID uuid.UUID) error {
-	query := `UPDATE workspaces SET vm_id = $2 WHERE id = $1`
-
-	result, err := r.db.ExecContext(ctx, query, id, vmID)
+// UpdateMetadata merges the given keys into the workspace's metadata
+func (r *workspaceRepository) UpdateMetadata(ctx context.Context, id uuid.UUID, metadata map[string]interface{}) error {
+	query := `
+		UPDATE workspaces SET
+			metadata = COALESCE(metadata, '{}'::jsonb) || $2::jsonb
+		WHERE id = $1
+	`
+	result, err := r.db.ExecContext(ctx, query, id, storage.JSONB(metadata))
 	if err != nil {
-		return fmt.Errorf("failed to set workspace VM ID: %w", err)
+		return fmt.Errorf("failed to update workspace metadata: %w", err)
 	}
 
 	rows, err := result.RowsAffected()
@@ -219,12 +250,11 @@ func (r *workspaceRepository) SetVMID(ctx context.Context, id uuid.UUID, vmID uu
 	return nil
 }
 
-func (r *workspaceRepository) SetReady(ctx context.Context, id uuid.UUID) error {
-	query := `UPDATE workspaces SET status = 'ready', ready_at = $2 WHERE id = $1`
-
-	result, err := r.db.ExecContext(ctx, query, id, time.Now())
+// SetAnnotations replaces the workspace's annotations
+func (r *workspaceRepository) SetAnnotations(ctx context.Context, id uuid.UUID, annotations *storage.Annotations) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE workspaces SET annotations = $2 WHERE id = $1`, id, annotations)
 	if err != nil {
-		return fmt.Errorf("failed to set workspace ready: %w", err)
+		return fmt.Errorf("failed to set workspace annotations: %w", err)
 	}
 
 	rows, err := result.RowsAffected()
@@ -238,6 +268,160 @@ func (r *workspaceRepository) SetReady(ctx context.Context, id uuid.UUID) error
 	return nil
 }
 
+// transition validates a status change against the current row, runs the
+// update query and records the change in the status history, all in one
+// transaction. The row is locked so concurrent transitions are serialized.
+func (r *workspaceRepository) transition(ctx context.Context, id uuid.UUID, status, reason, query string, args ...interface{}) error {
+	return runInTx(ctx, r.db, func(tx dbtx) error {
+		var current string
+		err := tx.GetContext(ctx, &current, `SELECT status FROM workspaces WHERE id = $1 FOR UPDATE`, id)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("workspace not found: %s", id)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get workspace status: %w", err)
+		}
+		if err := storage.CheckWorkspaceTransition(current, status); err != nil {
+			return fmt.Errorf("failed to update workspace %s: %w", id, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to update workspace status: %w", err)
+		}
+
+		if current == status {
+			return nil
+		}
+		return recordWorkspaceStatus(ctx, tx, id, &current, status, reason)
+	})
+}
+
+func recordWorkspaceStatus(ctx context.Context, tx dbtx, id uuid.UUID, from *string, to, reason string) error {
+	query := `
+		INSERT INTO workspace_status_history (id, workspace_id, from_status, to_status, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	if _, err := tx.ExecContext(ctx, query, uuid.New(), id, from, to, reason, time.Now()); err != nil {
+		return fmt.Errorf("failed to record workspace status change: %w", err)
+	}
+	return nil
+}
+
+func (r *workspaceRepository) ListStatusHistory(ctx context.Context, id uuid.UUID) ([]*storage.WorkspaceStatusChange, error) {
+	query := `SELECT * FROM workspace_status_history WHERE workspace_id = $1 ORDER BY created_at ASC`
+
+	var history []*storage.WorkspaceStatusChange
+	err := r.db.SelectContext(ctx, &history, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspace status history: %w", err)
+	}
+
+	return history, nil
+}
+
+// ListUsage summarizes workspace activity since a given time. Statuses
+// entered before since only count from since on.
+func (r *workspaceRepository) ListUsage(ctx context.Context, filters map[string]interface{}, since time.Time) ([]*storage.WorkspaceUsage, error) {
+	query := `
+		WITH transitions AS (
+			SELECT workspace_id, to_status, created_at AS entered_at,
+				   LEAD(created_at, 1, NOW()) OVER (PARTITION BY workspace_id ORDER BY created_at) AS left_at
+			FROM workspace_status_history
+		),
+		vm_time AS (
+			SELECT workspace_id, SUM(EXTRACT(EPOCH FROM left_at - GREATEST(entered_at, $1)))::float8 AS vm_seconds
+			FROM transitions
+			WHERE to_status IN ('spawning', 'preparing', 'ready') AND left_at > $1
+			GROUP BY workspace_id
+		),
+		prompts AS (
+			SELECT workspace_id,
+				   COUNT(*) AS prompts,
+				   COUNT(*) FILTER (WHERE status IN ('completed', 'failed', 'timed_out')) AS finished_prompts,
+				   COUNT(*) FILTER (WHERE status IN ('failed', 'timed_out')) AS failed_prompts,
+				   AVG(duration_ms)::float8 AS avg_duration_ms,
+				   (SUM(duration_ms) / 1000.0)::float8 AS busy_seconds
+			FROM prompt_tasks
+			WHERE created_at >= $1
+			GROUP BY workspace_id
+		)
+		SELECT w.id AS workspace_id, w.name, w.environment_id, w.status,
+			   COALESCE(p.prompts, 0) AS prompts,
+			   COALESCE(p.finished_prompts, 0) AS finished_prompts,
+			   COALESCE(p.failed_prompts, 0) AS failed_prompts,
+			   COALESCE(p.avg_duration_ms, 0) AS avg_duration_ms,
+			   COALESCE(p.busy_seconds, 0) AS busy_seconds,
+			   COALESCE(v.vm_seconds, 0) AS vm_seconds
+		FROM workspaces w
+		LEFT JOIN prompts p ON p.workspace_id = w.id
+		LEFT JOIN vm_time v ON v.workspace_id = w.id
+		WHERE 1=1`
+	args := []interface{}{since}
+
+	if environmentID, ok := filters["environment_id"].(uuid.UUID); ok {
+		query += " AND w.environment_id = $2"
+		args = append(args, environmentID)
+	}
+
+	query += " ORDER BY prompts DESC, vm_seconds DESC, w.name"
+
+	var usage []*storage.WorkspaceUsage
+	if err := r.db.SelectContext(ctx, &usage, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list workspace usage: %w", err)
+	}
+
+	var daily []struct {
+		WorkspaceID uuid.UUID `db:"workspace_id"`
+		storage.DailyPrompts
+	}
+	err := r.db.SelectContext(ctx, &daily, `
+		SELECT workspace_id, date_trunc('day', created_at AT TIME ZONE 'UTC') AS day, COUNT(*) AS prompts
+		FROM prompt_tasks
+		WHERE created_at >= $1
+		GROUP BY workspace_id, day
+		ORDER BY day`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daily prompts: %w", err)
+	}
+
+	byWorkspace := make(map[uuid.UUID]*storage.WorkspaceUsage, len(usage))
+	for _, u := range usage {
+		byWorkspace[u.WorkspaceID] = u
+	}
+	for _, d := range daily {
+		if u, ok := byWorkspace[d.WorkspaceID]; ok {
+			u.Daily = append(u.Daily, d.DailyPrompts)
+		}
+	}
+
+	return usage, nil
+}
+
+func (r *workspaceRepository) ListActivity(ctx context.Context) ([]*storage.WorkspaceActivity, error) {
+	query := `
+		SELECT w.id AS workspace_id,
+			   GREATEST(w.created_at, w.ready_at, p.last_prompt_at, s.last_session_at) AS last_activity_at
+		FROM workspaces w
+		LEFT JOIN (
+			SELECT workspace_id, MAX(created_at) AS last_prompt_at
+			FROM prompt_tasks
+			GROUP BY workspace_id
+		) p ON p.workspace_id = w.id
+		LEFT JOIN (
+			SELECT workspace_id, MAX(last_activity) AS last_session_at
+			FROM workspace_sessions
+			GROUP BY workspace_id
+		) s ON s.workspace_id = w.id
+		ORDER BY last_activity_at`
+
+	var activity []*storage.WorkspaceActivity
+	if err := r.db.SelectContext(ctx, &activity, query); err != nil {
+		return nil, fmt.Errorf("failed to list workspace activity: %w", err)
+	}
+
+	return activity, nil
+}
+
 func (r *workspaceRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	query := `DELETE FROM workspaces WHERE id = $1`
 
@@ -345,20 +529,20 @@ func (r *workspaceRepository) SetEnvironmentID(ctx context.Context, id uuid.UUID
 
 // secretRepository implements storage.SecretRepository
 type secretRepository struct {
-	db *sqlx.DB
+	db dbtx
 }
 
 func (r *secretRepository) Create(ctx context.Context, secret *storage.WorkspaceSecret) error {
 	query := `
 		INSERT INTO workspace_secrets (
-			id, workspace_id, name, description, secret_type,
+			id, workspace_id, environment_id, name, description, secret_type,
 			encrypted_value, encryption_key_id, nonce, scope
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10
 		)`
 
 	_, err := r.db.ExecContext(ctx, query,
-		secret.ID, secret.WorkspaceID, secret.Name, secret.Description,
+		secret.ID, secret.WorkspaceID, secret.EnvironmentID, secret.Name, secret.Description,
 		secret.SecretType, secret.EncryptedValue, secret.EncryptionKeyID,
 		secret.Nonce, secret.Scope,
 	)
@@ -390,7 +574,7 @@ func (r *secretRepository) GetByName(ctx context.Context, workspaceID *uuid.UUID
 	var args []interface{}
 
 	if workspaceID == nil {
-		query = `SELECT * FROM workspace_secrets WHERE workspace_id IS NULL AND name = $1`
+		query = `SELECT * FROM workspace_secrets WHERE workspace_id IS NULL AND environment_id IS NULL AND name = $1`
 		args = []interface{}{name}
 	} else {
 		query = `SELECT * FROM workspace_secrets WHERE workspace_id = $1 AND name = $2`
@@ -420,6 +604,18 @@ func (r *secretRepository) ListByWorkspace(ctx context.Context, workspaceID uuid
 	return secrets, nil
 }
 
+func (r *secretRepository) ListByEnvironment(ctx context.Context, environmentID uuid.UUID) ([]*storage.WorkspaceSecret, error) {
+	query := `SELECT * FROM workspace_secrets WHERE environment_id = $1 ORDER BY name`
+
+	var secrets []*storage.WorkspaceSecret
+	err := r.db.SelectContext(ctx, &secrets, query, environmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environment secrets: %w", err)
+	}
+
+	return secrets, nil
+}
+
 func (r *secretRepository) ListGlobal(ctx context.Context) ([]*storage.WorkspaceSecret, error) {
 	query := `SELECT * FROM workspace_secrets WHERE scope = 'global' ORDER BY name`
 
@@ -432,6 +628,62 @@ func (r *secretRepository) ListGlobal(ctx context.Context) ([]*storage.Workspace
 	return secrets, nil
 }
 
+func (r *secretRepository) ListUnused(ctx context.Context, since time.Time) ([]*storage.WorkspaceSecret, error) {
+	query := `
+		SELECT * FROM workspace_secrets
+		WHERE created_at < $1 AND (last_used_at IS NULL OR last_used_at < $1)
+		ORDER BY last_used_at NULLS FIRST, name`
+
+	var secrets []*storage.WorkspaceSecret
+	err := r.db.SelectContext(ctx, &secrets, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unused secrets: %w", err)
+	}
+
+	return secrets, nil
+}
+
+func (r *secretRepository) RecordUsage(ctx context.Context, usage *storage.SecretUsage) error {
+	if usage.ID == uuid.Nil {
+		usage.ID = uuid.New()
+	}
+	if usage.UsedAt.IsZero() {
+		usage.UsedAt = time.Now()
+	}
+
+	query := `
+		WITH usage AS (
+			INSERT INTO secret_usages (id, secret_id, workspace_id, vm_id, request_type, used_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING secret_id, used_at
+		)
+		UPDATE workspace_secrets s SET last_used_at = usage.used_at
+		FROM usage
+		WHERE s.id = usage.secret_id AND (s.last_used_at IS NULL OR s.last_used_at < usage.used_at)`
+
+	_, err := r.db.ExecContext(ctx, query,
+		usage.ID, usage.SecretID, usage.WorkspaceID, usage.VMID,
+		usage.RequestType, usage.UsedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record secret usage: %w", err)
+	}
+
+	return nil
+}
+
+func (r *secretRepository) ListUsage(ctx context.Context, secretID uuid.UUID, limit int) ([]*storage.SecretUsage, error) {
+	query := `SELECT * FROM secret_usages WHERE secret_id = $1 ORDER BY used_at DESC LIMIT $2`
+
+	var usages []*storage.SecretUsage
+	err := r.db.SelectContext(ctx, &usages, query, secretID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secret usage: %w", err)
+	}
+
+	return usages, nil
+}
+
 func (r *secretRepository) Update(ctx context.Context, secret *storage.WorkspaceSecret) error {
 	query := `
 		UPDATE workspace_secrets SET
@@ -481,7 +733,7 @@ func (r *secretRepository) Delete(ctx context.Context, id uuid.UUID) error {
 
 // prepStepRepository implements storage.PrepStepRepository
 type prepStepRepository struct {
-	db *sqlx.DB
+	db dbtx
 }
 
 func (r *prepStepRepository) Create(ctx context.Context, step *storage.PrepStep) error {
@@ -608,18 +860,34 @@ func (r *prepStepRepository) UpdateStatus(ctx context.Context, id uuid.UUID, sta
 	return nil
 }
 
+func (r *prepStepRepository) ResetByWorkspace(ctx context.Context, workspaceID uuid.UUID) error {
+	query := `
+		UPDATE workspace_prep_steps SET
+			status = 'pending', exit_code = NULL, stdout = NULL, stderr = NULL,
+			error = NULL, started_at = NULL, completed_at = NULL, duration_ms = NULL
+		WHERE workspace_id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, workspaceID); err != nil {
+		return fmt.Errorf("failed to reset prep steps: %w", err)
+	}
+
+	return nil
+}
+
 // promptTaskRepository implements storage.PromptTaskRepository
 type promptTaskRepository struct {
-	db *sqlx.DB
+	db    dbtx
+	chain bool // Append finished prompts to the transcript chain
 }
 
 func (r *promptTaskRepository) Create(ctx context.Context, task *storage.PromptTask) error {
 	query := `
 		INSERT INTO prompt_tasks (
 			id, workspace_id, prompt, system_prompt, working_directory,
-			environment, priority, status, metadata
+			environment, priority, status, metadata, timeout_seconds,
+			workload_class
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
 		)`
 
 	// Initialize with empty JSON object as default for JSONB columns
@@ -641,9 +909,15 @@ func (r *promptTaskRepository) Create(ctx context.Context, task *storage.PromptT
 		}
 	}
 
+	workloadClass := task.WorkloadClass
+	if workloadClass == "" {
+		workloadClass = "batch"
+	}
+
 	_, err = r.db.ExecContext(ctx, query,
 		task.ID, task.WorkspaceID, task.Prompt, task.SystemPrompt,
 		task.WorkingDirectory, envJSON, task.Priority, task.Status, metadataJSON,
+		task.TimeoutSeconds, workloadClass,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create prompt task: %w", err)
@@ -712,11 +986,16 @@ func (r *promptTaskRepository) UpdateStatus(ctx context.Context, id uuid.UUID, s
 		query = `
 			UPDATE prompt_tasks SET
 				status = $2, exit_code = $3, stdout = $4, stderr = $5,
-				error = $6, completed_at = $7, duration_ms = $8
+				error = $6, completed_at = $7, duration_ms = $8,
+				failure_reason = NULLIF($9, ''), failure_detail = NULLIF($10, '')
 			WHERE id = $1`
 		args = []interface{}{
 			id, status, result.ExitCode, result.Stdout, result.Stderr,
 			result.Error, time.Now(), result.DurationMS,
+			result.FailureReason, result.FailureDetail,
+		}
+		if r.chain {
+			return r.finishChained(ctx, id, query, args)
 		}
 	} else {
 		query = `UPDATE prompt_tasks SET status = $2, started_at = $3 WHERE id = $1`
@@ -739,6 +1018,45 @@ func (r *promptTaskRepository) UpdateStatus(ctx context.Context, id uuid.UUID, s
 	return nil
 }
 
+// finishChained records a prompt's result and chains the prompt as stored,
+// in one transaction
+func (r *promptTaskRepository) finishChained(ctx context.Context, id uuid.UUID, query string, args []interface{}) error {
+	return runInTx(ctx, r.db, func(tx dbtx) error {
+		var stored storage.PromptTask
+		err := tx.GetContext(ctx, &stored, query+" RETURNING *", args...)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("prompt task not found: %s", id)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update prompt task status: %w", err)
+		}
+		hash, err := transcript.PromptHash(&stored)
+		if err != nil {
+			return err
+		}
+		return appendTranscript(ctx, tx, storage.TranscriptKindPrompt, stored.ID, hash)
+	})
+}
+
+func (r *promptTaskRepository) SetExecutionEnv(ctx context.Context, id uuid.UUID, env *storage.ExecutionEnvironment) error {
+	query := `UPDATE prompt_tasks SET execution_env = $2 WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id, env)
+	if err != nil {
+		return fmt.Errorf("failed to set prompt execution environment: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("prompt task not found: %s", id)
+	}
+
+	return nil
+}
+
 func (r *promptTaskRepository) Cancel(ctx context.Context, id uuid.UUID) error {
 	query := `UPDATE prompt_tasks SET status = 'cancelled' WHERE id = $1 AND status = 'pending'`
 
@@ -758,17 +1076,143 @@ func (r *promptTaskRepository) Cancel(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+func (r *promptTaskRepository) CountPendingAhead(ctx context.Context, task *storage.PromptTask) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM prompt_tasks
+		WHERE status = 'pending' AND id <> $1
+		  AND (priority > $2 OR (priority = $2 AND scheduled_at < $3))`
+
+	var count int
+	if err := r.db.GetContext(ctx, &count, query, task.ID, task.Priority, task.ScheduledAt); err != nil {
+		return 0, fmt.Errorf("failed to count pending prompt tasks: %w", err)
+	}
+
+	return count, nil
+}
+
+func (r *promptTaskRepository) CountByStatus(ctx context.Context, status string) (int, error) {
+	var count int
+	if err := r.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM prompt_tasks WHERE status = $1`, status); err != nil {
+		return 0, fmt.Errorf("failed to count prompt tasks: %w", err)
+	}
+
+	return count, nil
+}
+
+func (r *promptTaskRepository) CountFinishedSince(ctx context.Context, since time.Time) (map[string]int, error) {
+	var rows []struct {
+		Status string `db:"status"`
+		Count  int    `db:"count"`
+	}
+	query := `
+		SELECT status, COUNT(*) AS count FROM prompt_tasks
+		WHERE completed_at >= $1
+		GROUP BY status`
+
+	if err := r.db.SelectContext(ctx, &rows, query, since); err != nil {
+		return nil, fmt.Errorf("failed to count finished prompt tasks: %w", err)
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+
+	return counts, nil
+}
+
+func (r *promptTaskRepository) AverageDuration(ctx context.Context, workspaceID uuid.UUID, limit int) (time.Duration, error) {
+	query := `
+		SELECT COALESCE(AVG(duration_ms), 0) FROM (
+			SELECT p.duration_ms FROM prompt_tasks p
+			JOIN workspaces w ON w.id = p.workspace_id
+			WHERE p.duration_ms IS NOT NULL
+			  AND p.status IN ('completed', 'failed', 'timed_out')
+			  AND (w.id = $1 OR w.environment_id = (SELECT environment_id FROM workspaces WHERE id = $1))
+			ORDER BY p.completed_at DESC
+			LIMIT $2
+		) recent`
+
+	var avgMS float64
+	if err := r.db.GetContext(ctx, &avgMS, query, workspaceID, limit); err != nil {
+		return 0, fmt.Errorf("failed to average prompt durations: %w", err)
+	}
+
+	return time.Duration(avgMS) * time.Millisecond, nil
+}
+
+func (r *promptTaskRepository) ListByStatus(ctx context.Context, status string) ([]*storage.PromptTask, error) {
+	query := `SELECT * FROM prompt_tasks WHERE status = $1 ORDER BY scheduled_at ASC`
+
+	var tasks []*storage.PromptTask
+	if err := r.db.SelectContext(ctx, &tasks, query, status); err != nil {
+		return nil, fmt.Errorf("failed to list prompt tasks: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// Retry records the attempt and resets the prompt in one statement, so two
+// callers retrying the same attempt (a worker and the gateway's sweeper)
+// can't both succeed
+func (r *promptTaskRepository) Retry(ctx context.Context, attempt *storage.PromptAttempt) error {
+	query := `
+		WITH failed AS (
+			INSERT INTO prompt_attempts (
+				prompt_id, attempt, worker_id, vm_id, failure_reason, error, started_at
+			)
+			SELECT id, attempt, $3, $4, $5, $6, started_at FROM prompt_tasks
+			WHERE id = $1 AND attempt = $2 AND status IN ('pending', 'running')
+			RETURNING prompt_id
+		)
+		UPDATE prompt_tasks SET
+			status = 'pending', attempt = attempt + 1, started_at = NULL,
+			completed_at = NULL, exit_code = NULL, stdout = NULL, stderr = NULL,
+			error = NULL, duration_ms = NULL, failure_reason = NULL,
+			failure_detail = NULL, execution_env = NULL
+		WHERE id IN (SELECT prompt_id FROM failed)`
+
+	result, err := r.db.ExecContext(ctx, query,
+		attempt.PromptID, attempt.Attempt, attempt.WorkerID, attempt.VMID,
+		attempt.FailureReason, attempt.Error,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to retry prompt task: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: %s attempt %d", storage.ErrPromptAttemptPassed, attempt.PromptID, attempt.Attempt)
+	}
+
+	return nil
+}
+
+func (r *promptTaskRepository) ListAttempts(ctx context.Context, promptID uuid.UUID) ([]*storage.PromptAttempt, error) {
+	query := `SELECT * FROM prompt_attempts WHERE prompt_id = $1 ORDER BY attempt ASC`
+
+	var attempts []*storage.PromptAttempt
+	if err := r.db.SelectContext(ctx, &attempts, query, promptID); err != nil {
+		return nil, fmt.Errorf("failed to list prompt attempts: %w", err)
+	}
+
+	return attempts, nil
+}
+
 // sessionRepository implements storage.SessionRepository
 type sessionRepository struct {
-	db *sqlx.DB
+	db dbtx
 }
 
 func (r *sessionRepository) Create(ctx context.Context, session *storage.WorkspaceSession) error {
 	query := `
 		INSERT INTO workspace_sessions (
-			id, workspace_id, status, client_ip, user_agent, metadata
+			id, workspace_id, status, gateway_id, client_ip, user_agent, metadata
 		) VALUES (
-			$1, $2, $3, $4, $5, $6
+			$1, $2, $3, $4, $5, $6, $7
 		)`
 
 	var metadataJSON []byte
@@ -782,7 +1226,7 @@ func (r *sessionRepository) Create(ctx context.Context, session *storage.Workspa
 	}
 
 	_, err = r.db.ExecContext(ctx, query,
-		session.ID, session.WorkspaceID, session.Status,
+		session.ID, session.WorkspaceID, session.Status, session.GatewayID,
 		session.ClientIP, session.UserAgent, metadataJSON,
 	)
 	if err != nil {
@@ -849,6 +1293,26 @@ func (r *sessionRepository) UpdateStatus(ctx context.Context, id uuid.UUID, stat
 	return nil
 }
 
+func (r *sessionRepository) DisconnectByGateway(ctx context.Context, gatewayID string) (int64, error) {
+	query := `
+		UPDATE workspace_sessions
+		SET status = 'disconnected', disconnected_at = $2
+		WHERE gateway_id = $1 AND status = 'active'
+	`
+
+	result, err := r.db.ExecContext(ctx, query, gatewayID, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to disconnect gateway sessions: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rows, nil
+}
+
 func (r *sessionRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	query := `DELETE FROM workspace_sessions WHERE id = $1`
 
@@ -870,7 +1334,7 @@ func (r *sessionRepository) Delete(ctx context.Context, id uuid.UUID) error {
 
 // sessionMessageRepository implements storage.SessionMessageRepository
 type sessionMessageRepository struct {
-	db *sqlx.DB
+	db dbtx
 }
 
 func (r *sessionMessageRepository) Create(ctx context.Context, message *storage.SessionMessage) error {
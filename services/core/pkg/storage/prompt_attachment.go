@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Prompt attachment limits
+const (
+	MaxAttachmentBytes       = 10 << 20 // One file
+	MaxPromptAttachments     = 10       // Files per prompt
+	MaxPromptAttachmentBytes = 25 << 20 // All files of a prompt
+	MaxAttachmentNameLength  = 255
+)
+
+// PromptAttachment is a file uploaded to the gateway for a prompt. It is
+// copied into the VM's working directory before the prompt runs. Content is
+// only kept until the prompt finishes; the rest is kept as a record.
+type PromptAttachment struct {
+	ID          uuid.UUID  `db:"id" json:"id"`
+	WorkspaceID uuid.UUID  `db:"workspace_id" json:"workspace_id"`
+	PromptID    *uuid.UUID `db:"prompt_id" json:"prompt_id,omitempty"` // Nil until submitted with a prompt
+	Name        string     `db:"name" json:"name"`
+	SizeBytes   int64      `db:"size_bytes" json:"size_bytes"`
+	SHA256      string     `db:"sha256" json:"sha256"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	CleanedAt   *time.Time `db:"cleaned_at" json:"cleaned_at,omitempty"` // When the content was removed
+}
+
+// ValidateAttachmentName checks that an attachment name is a plain file
+// name, since it becomes a path in the VM
+func ValidateAttachmentName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("name is required")
+	case len(name) > MaxAttachmentNameLength:
+		return fmt.Errorf("name must be at most %d bytes", MaxAttachmentNameLength)
+	case name == "." || name == "..":
+		return fmt.Errorf("invalid name %q", name)
+	case strings.ContainsAny(name, "/\\\x00"):
+		return fmt.Errorf("name %q must not contain slashes", name)
+	}
+	return nil
+}
+
+// PromptAttachmentRepository handles prompt attachment storage operations.
+// Lists and gets return attachments without their content.
+type PromptAttachmentRepository interface {
+	Create(ctx context.Context, attachment *PromptAttachment, content []byte) error
+	Get(ctx context.Context, id uuid.UUID) (*PromptAttachment, error)
+	// GetContent returns an attachment's content, or an error once it has
+	// been cleaned up
+	GetContent(ctx context.Context, id uuid.UUID) ([]byte, error)
+	ListByPrompt(ctx context.Context, promptID uuid.UUID) ([]*PromptAttachment, error)
+	// Attach assigns uploads of the workspace that aren't attached yet to a
+	// prompt, failing unless all of them are
+	Attach(ctx context.Context, workspaceID, promptID uuid.UUID, ids []uuid.UUID) error
+	// ClearContent drops the content of a prompt's attachments
+	ClearContent(ctx context.Context, promptID uuid.UUID) error
+	// DeleteUnattached deletes uploads never attached to a prompt that were
+	// made before the given time
+	DeleteUnattached(ctx context.Context, before time.Time) (int64, error)
+}
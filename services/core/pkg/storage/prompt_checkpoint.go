@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxCheckpointDiffBytes bounds the working directory diff kept in a
+// checkpoint; larger diffs are truncated
+const MaxCheckpointDiffBytes = 4 << 20
+
+// PromptCheckpoint is a snapshot of a running prompt, taken periodically by
+// its worker: the output so far and the uncommitted changes it made. If the
+// prompt's worker or VM dies, its next attempt resumes from the checkpoint,
+// and a prompt that can't be retried reports it as its partial result.
+type PromptCheckpoint struct {
+	PromptID      uuid.UUID `db:"prompt_id" json:"prompt_id"`
+	Attempt       int       `db:"attempt" json:"attempt"`   // Attempt of the prompt it was taken in
+	Sequence      int       `db:"sequence" json:"sequence"` // Checkpoints taken of the attempt, counting this one
+	Stdout        string    `db:"stdout" json:"stdout"`
+	Stderr        string    `db:"stderr" json:"stderr"`
+	Diff          string    `db:"diff" json:"diff"` // git diff of the working directory against HEAD, untracked files included; redacted
+	DiffTruncated bool      `db:"diff_truncated" json:"diff_truncated"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+
+	// The diff before redaction, sealed with the workspace secret key, to
+	// restore the working directory from. Nil for checkpoints taken without
+	// a key.
+	SealedDiff      []byte `db:"sealed_diff" json:"-"`
+	SealedDiffNonce []byte `db:"sealed_diff_nonce" json:"-"`
+}
+
+// WithCheckpoint fills in the output of a result that has none from a
+// checkpoint of the prompt, noting where it came from
+func (r *PromptResult) WithCheckpoint(checkpoint *PromptCheckpoint) {
+	if checkpoint == nil || r.Stdout != "" || r.Stderr != "" {
+		return
+	}
+	r.Stdout = checkpoint.Stdout
+	r.Stderr = checkpoint.Stderr
+	r.Error += fmt.Sprintf(" (partial output from checkpoint at %s)", checkpoint.CreatedAt.Format(time.RFC3339))
+}
+
+// PromptCheckpointRepository handles prompt checkpoint storage operations
+type PromptCheckpointRepository interface {
+	// Save replaces the prompt's checkpoint
+	Save(ctx context.Context, checkpoint *PromptCheckpoint) error
+	// Get returns the prompt's latest checkpoint, or nil if it has none
+	Get(ctx context.Context, promptID uuid.UUID) (*PromptCheckpoint, error)
+	Delete(ctx context.Context, promptID uuid.UUID) error
+}
@@ -0,0 +1,54 @@
+package storage
+
+import "errors"
+
+// Prompt failure reasons, classified by the worker from the prompt's
+// output and the state of its VM
+const (
+	PromptFailureToolMissing    = "tool_missing"    // A command the prompt ran isn't installed
+	PromptFailureAuth           = "auth_error"      // The AI assistant or a service rejected its credentials
+	PromptFailureOutOfMemory    = "out_of_memory"   // The kernel killed a process for lack of memory
+	PromptFailureDiskFull       = "disk_full"       // A filesystem in the VM ran out of space or inodes
+	PromptFailureNetworkBlocked = "network_blocked" // A host couldn't be reached, usually blocked by the proxy
+	PromptFailureAssistantCrash = "assistant_crash" // The AI assistant died on a signal or an unhandled error
+	PromptFailureAgentError     = "agent_error"     // The prompt couldn't be run in the VM
+	PromptFailureSpawnFailed    = "spawn_failed"    // No VM could be started for the prompt
+	PromptFailureWorkerLost     = "worker_lost"     // The worker running the prompt stopped sending heartbeats
+	PromptFailureTimeout        = "timeout"         // The prompt ran past its time limit
+	PromptFailureUnknown        = "unknown"
+)
+
+// promptFailureRemediations suggests a fix for each failure reason
+var promptFailureRemediations = map[string]string{
+	PromptFailureToolMissing:    "Add the missing tool to the environment's tools, or install it in a prep step",
+	PromptFailureAuth:           "Check the AI assistant's API key and other credentials in the workspace or environment secrets",
+	PromptFailureOutOfMemory:    "Raise the environment's memory_mb, or split the prompt into smaller tasks",
+	PromptFailureDiskFull:       "Clean up build artifacts and caches in the workspace, or raise the environment's disk_size_mb",
+	PromptFailureNetworkBlocked: "Add the host to the proxy whitelist, or to the environment's firewall rules",
+	PromptFailureAssistantCrash: "Retry the prompt; if it keeps crashing, check the AI assistant's version in the environment's tool lock",
+	PromptFailureAgentError:     "Check that the workspace's VM is running; the next prompt respawns it if it's gone",
+	PromptFailureSpawnFailed:    "Check the environment's rootfs image and that workers have room for its VMs",
+	PromptFailureWorkerLost:     "Check the worker's health; the next prompt respawns the workspace's VM",
+	PromptFailureTimeout:        "Raise the prompt's timeout_seconds or the environment's prompt timeout, or split the prompt",
+	PromptFailureUnknown:        "Check the prompt's stdout and stderr",
+}
+
+// PromptFailureRemediation suggests how to fix a prompt failure reason
+func PromptFailureRemediation(reason string) string {
+	return promptFailureRemediations[reason]
+}
+
+// IsInfrastructureFailure reports whether a failure reason is the
+// platform's fault rather than the prompt's: it says nothing about the
+// prompt, so running it again on another worker may succeed
+func IsInfrastructureFailure(reason string) bool {
+	switch reason {
+	case PromptFailureAgentError, PromptFailureSpawnFailed, PromptFailureWorkerLost:
+		return true
+	}
+	return false
+}
+
+// ErrPromptAttemptPassed is returned when retrying an attempt of a prompt
+// that was already retried, or finished
+var ErrPromptAttemptPassed = errors.New("prompt has moved past the attempt")
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Highlighted search matches are wrapped in these markers. They are private
+// use characters, which don't occur in prompts or output, so callers can
+// escape the text for display and then replace them.
+const (
+	HighlightStart = "\ue000"
+	HighlightStop  = "\ue001"
+)
+
+// SearchFilters scope a search
+type SearchFilters struct {
+	Project     string     // Only workspaces with this project in their metadata
+	WorkspaceID *uuid.UUID // Only this workspace's prompts
+	Limit       int
+}
+
+// PromptSearchHit is a prompt matching a search, with excerpts of its text
+// and output around the matches
+type PromptSearchHit struct {
+	PromptID        uuid.UUID `db:"prompt_id"`
+	WorkspaceID     uuid.UUID `db:"workspace_id"`
+	WorkspaceName   string    `db:"workspace_name"`
+	Status          string    `db:"status"`
+	CreatedAt       time.Time `db:"created_at"`
+	Rank            float64   `db:"rank"`
+	PromptHighlight string    `db:"prompt_highlight"`
+	StdoutHighlight string    `db:"stdout_highlight"` // Empty when the output didn't match
+}
+
+// WorkspaceSearchHit is a workspace whose name matches a search
+type WorkspaceSearchHit struct {
+	ID            uuid.UUID `db:"id"`
+	Name          string    `db:"name"`
+	Status        string    `db:"status"`
+	Rank          float64   `db:"rank"`
+	NameHighlight string    `db:"name_highlight"`
+}
+
+// SearchRepository runs full-text searches. Queries use web search syntax:
+// words, "quoted phrases", OR and -excluded words. Hits are ordered by
+// relevance; matches are wrapped in HighlightStart and HighlightStop.
+type SearchRepository interface {
+	// Prompts searches prompt text and output
+	Prompts(ctx context.Context, query string, filters *SearchFilters) ([]*PromptSearchHit, error)
+	// Workspaces searches workspace names
+	Workspaces(ctx context.Context, query string, filters *SearchFilters) ([]*WorkspaceSearchHit, error)
+}
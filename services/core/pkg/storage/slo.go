@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// SLOCounts are the requests or tasks measured against a service level
+// objective
+type SLOCounts struct {
+	Total int64 `db:"total" json:"total"`
+	Good  int64 `db:"good" json:"good"` // Succeeded
+	Fast  int64 `db:"fast" json:"fast"` // Succeeded within the objective's latency
+}
+
+// Add adds other's counts to c
+func (c *SLOCounts) Add(other SLOCounts) {
+	c.Total += other.Total
+	c.Good += other.Good
+	c.Fast += other.Fast
+}
+
+// SLORepository stores the API request counts of SLO targets, in time
+// buckets every gateway adds to, and counts finished tasks from the task
+// history
+type SLORepository interface {
+	// AddRequests adds to a target's counts in the bucket starting at bucket
+	AddRequests(ctx context.Context, target string, bucket time.Time, counts SLOCounts) error
+	// CountRequests sums a target's counts in buckets since the given time
+	CountRequests(ctx context.Context, target string, since time.Time) (SLOCounts, error)
+	// DeleteRequestsBefore prunes buckets before the given time
+	DeleteRequestsBefore(ctx context.Context, before time.Time) (int64, error)
+
+	// CountTasks counts tasks of a type ("" = any) that completed or
+	// failed since the given time. Completed tasks that finished within
+	// latency of being created count as fast.
+	CountTasks(ctx context.Context, taskType string, since time.Time, latency time.Duration) (SLOCounts, error)
+}
@@ -23,6 +23,82 @@ type VM struct {
 	StartedAt    *time.Time `db:"started_at" json:"started_at,omitempty"`
 	StoppedAt    *time.Time `db:"stopped_at" json:"stopped_at,omitempty"`
 	Metadata     JSONB      `db:"metadata" json:"metadata"`
+	LastUsedAt   *time.Time `db:"last_used_at" json:"last_used_at,omitempty"`
+}
+
+// VMGCPolicy defines when non-workspace VMs of a project are garbage collected
+type VMGCPolicy struct {
+	Project        string    `db:"project" json:"project"`
+	MaxAgeSeconds  int       `db:"max_age_seconds" json:"max_age_seconds"`   // 0 = no age limit
+	MaxIdleSeconds int       `db:"max_idle_seconds" json:"max_idle_seconds"` // 0 = no idle limit
+	WarningSeconds int       `db:"warning_seconds" json:"warning_seconds"`   // Advance warning before deletion
+	Enabled        bool      `db:"enabled" json:"enabled"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// CapacityPolicy decides what happens to VM requests for a project when the cluster is saturated
+type CapacityPolicy struct {
+	Project           string    `db:"project" json:"project"`
+	Policy            string    `db:"policy" json:"policy"` // reject, queue, burst
+	RetryAfterSeconds int       `db:"retry_after_seconds" json:"retry_after_seconds"`
+	CreatedAt         time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt         time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// AlertRule is a threshold or absence rule over worker metrics and cluster
+// events. Rules are evaluated periodically (see service.AlertService); a rule
+// notifies its targets when it starts firing and when it resolves.
+type AlertRule struct {
+	ID            uuid.UUID     `db:"id" json:"id"`
+	Name          string        `db:"name" json:"name"`
+	Kind          string        `db:"kind" json:"kind"`                   // threshold, absence
+	Metric        string        `db:"metric" json:"metric"`               // See service.AlertMetric*
+	Operator      string        `db:"operator" json:"operator,omitempty"` // >, >=, <, <= (threshold rules)
+	Threshold     float64       `db:"threshold" json:"threshold"`         // Absence rules: seconds without data
+	WindowSeconds int           `db:"window_seconds" json:"window_seconds"`
+	Severity      string        `db:"severity" json:"severity"` // info, warning, error
+	Notify        []AlertTarget `db:"-" json:"notify"`
+	Enabled       bool          `db:"enabled" json:"enabled"`
+	Firing        bool          `db:"firing" json:"firing"`
+	LastValue     *float64      `db:"last_value" json:"last_value,omitempty"`
+	LastFiredAt   *time.Time    `db:"last_fired_at" json:"last_fired_at,omitempty"`
+	CreatedAt     time.Time     `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time     `db:"updated_at" json:"updated_at"`
+}
+
+// AlertTarget is where an alert is delivered: a notification integration and
+// its target within it (e.g. a Slack channel)
+type AlertTarget struct {
+	Integration string `json:"integration"`
+	Target      string `json:"target"`
+}
+
+// Cluster is a remote Aetherium deployment registered with the gateway for
+// federation. Workspaces whose environment's region matches the cluster's
+// are created there, and federated list requests fan out to it.
+type Cluster struct {
+	Name           string    `db:"name" json:"name"`
+	Region         string    `db:"region" json:"region"`
+	URL            string    `db:"url" json:"url"`           // Base URL of the cluster's gateway
+	EncryptedToken []byte    `db:"encrypted_token" json:"-"` // AES-256-GCM sealed bearer token sent to the cluster; nil without one
+	TokenNonce     []byte    `db:"token_nonce" json:"-"`
+	Enabled        bool      `db:"enabled" json:"enabled"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// IntegrationConfig is an integration configured at runtime through the
+// API rather than the gateway's environment. Its options hold tokens, so
+// they are stored encrypted with the workspace secret key.
+type IntegrationConfig struct {
+	Name             string    `db:"name" json:"name"` // Registry name, e.g. slack-acme
+	Type             string    `db:"type" json:"type"` // github or slack
+	Enabled          bool      `db:"enabled" json:"enabled"`
+	EncryptedOptions []byte    `db:"encrypted_options" json:"-"` // AES-256-GCM sealed JSON
+	Nonce            []byte    `db:"nonce" json:"-"`
+	CreatedAt        time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt        time.Time `db:"updated_at" json:"updated_at"`
 }
 
 // Task represents a distributed task in the queue
@@ -35,6 +111,8 @@ type Task struct {
 	Result      JSONB      `db:"result" json:"result,omitempty"`
 	Error       *string    `db:"error" json:"error,omitempty"`
 	VMID        *uuid.UUID `db:"vm_id" json:"vm_id,omitempty"`
+	WorkspaceID *uuid.UUID `db:"workspace_id" json:"workspace_id,omitempty"`
+	PromptID    *uuid.UUID `db:"prompt_id" json:"prompt_id,omitempty"`
 	WorkerID    *string    `db:"worker_id" json:"worker_id,omitempty"`
 	MaxRetries  int        `db:"max_retries" json:"max_retries"`
 	RetryCount  int        `db:"retry_count" json:"retry_count"`
@@ -64,6 +142,7 @@ type Job struct {
 type Execution struct {
 	ID          uuid.UUID  `db:"id" json:"id"`
 	JobID       *uuid.UUID `db:"job_id" json:"job_id,omitempty"`
+	TaskID      *uuid.UUID `db:"task_id" json:"task_id,omitempty"` // Queue task that ran the command
 	VMID        *uuid.UUID `db:"vm_id" json:"vm_id,omitempty"`
 	Command     string     `db:"command" json:"command"`
 	Args        JSONBArray `db:"args" json:"args,omitempty"`
@@ -78,6 +157,50 @@ type Execution struct {
 	Metadata    JSONB      `db:"metadata" json:"metadata"`
 }
 
+// SmartExecution records a smart-execute request: the VM it picked, whether
+// that VM was created or reused, and the command task it queued. The result
+// columns come from the task's execution and are empty until it finishes.
+type SmartExecution struct {
+	ID          uuid.UUID  `db:"id" json:"id"`
+	TaskID      uuid.UUID  `db:"task_id" json:"task_id"`
+	VMID        *uuid.UUID `db:"vm_id" json:"vm_id,omitempty"` // Cleared when the VM is deleted
+	VMName      string     `db:"vm_name" json:"vm_name"`       // Empty for container executions
+	Image       *string    `db:"image" json:"image,omitempty"` // Set when the command ran in a container instead of a VM
+	VMCreated   bool       `db:"vm_created" json:"vm_created"`
+	VMReused    bool       `db:"vm_reused" json:"vm_reused"`
+	Command     string     `db:"command" json:"command"`
+	Args        JSONBArray `db:"args" json:"args,omitempty"`
+	Environment *string    `db:"environment" json:"environment,omitempty"`
+	Project     *string    `db:"project" json:"project,omitempty"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+
+	// From the execution, once the command has run
+	ExecutionID *uuid.UUID `db:"execution_id" json:"execution_id,omitempty"`
+	ExitCode    *int       `db:"exit_code" json:"exit_code,omitempty"`
+	Error       *string    `db:"error" json:"error,omitempty"`
+	CompletedAt *time.Time `db:"completed_at" json:"completed_at,omitempty"`
+	DurationMS  *int       `db:"duration_ms" json:"duration_ms,omitempty"`
+}
+
+// Smart execution statuses, derived from the execution
+const (
+	SmartExecutionPending   = "pending"
+	SmartExecutionCompleted = "completed"
+	SmartExecutionFailed    = "failed"
+)
+
+// Status reports whether the command is still pending, completed or failed
+func (e *SmartExecution) Status() string {
+	switch {
+	case e.ExecutionID == nil:
+		return SmartExecutionPending
+	case e.Error != nil:
+		return SmartExecutionFailed
+	default:
+		return SmartExecutionCompleted
+	}
+}
+
 // Worker represents a distributed worker node in the database
 type Worker struct {
 	ID       string    `db:"id" json:"id"`
@@ -127,11 +250,40 @@ type WorkerMetric struct {
 	VMCount        int `db:"vm_count" json:"vm_count"`
 	TasksProcessed int `db:"tasks_processed" json:"tasks_processed"`
 
+	// Scheduling metrics (since the previous heartbeat)
+	TasksInProgress int     `db:"tasks_in_progress" json:"tasks_in_progress"`
+	TasksPerMinute  float64 `db:"tasks_per_minute" json:"tasks_per_minute"`
+	QueueLatencyMs  float64 `db:"queue_latency_ms" json:"queue_latency_ms"` // Average enqueue-to-start delay
+	ErrorCount      int     `db:"error_count" json:"error_count"`
+
 	// Network metrics (optional)
 	NetworkInMB  *float64               `db:"network_in_mb" json:"network_in_mb,omitempty"`
 	NetworkOutMB *float64               `db:"network_out_mb" json:"network_out_mb,omitempty"`
 
-	Metadata map[string]interface{} `db:"metadata" json:"metadata"`
+	// Host health (optional, nil where the host doesn't expose it)
+	LoadAvg1m             *float64 `db:"load_avg_1m" json:"load_avg_1m,omitempty"`
+	LoadAvg5m             *float64 `db:"load_avg_5m" json:"load_avg_5m,omitempty"`
+	LoadAvg15m            *float64 `db:"load_avg_15m" json:"load_avg_15m,omitempty"`
+	CPUStealPercent       *float64 `db:"cpu_steal_percent" json:"cpu_steal_percent,omitempty"` // CPU time taken by the hypervisor
+	DiskIOPercent         *float64 `db:"disk_io_percent" json:"disk_io_percent,omitempty"`     // Busiest disk's time spent on IO
+	TemperatureC          *float64 `db:"temperature_c" json:"temperature_c,omitempty"`         // Hottest sensor
+	GPUTemperatureC       *float64 `db:"gpu_temperature_c" json:"gpu_temperature_c,omitempty"`
+	GPUUtilizationPercent *float64 `db:"gpu_utilization_percent" json:"gpu_utilization_percent,omitempty"`
+
+	Metadata JSONB `db:"metadata" json:"metadata"`
+}
+
+// ClusterEvent represents a significant event in the cluster events timeline
+type ClusterEvent struct {
+	ID           uuid.UUID `db:"id" json:"id"`
+	Type         string    `db:"type" json:"type"`         // Event topic (see events.Topic*)
+	Severity     string    `db:"severity" json:"severity"` // info, warning, error
+	ResourceType string    `db:"resource_type" json:"resource_type"`
+	ResourceID   string    `db:"resource_id" json:"resource_id"`
+	WorkerID     *string   `db:"worker_id" json:"worker_id,omitempty"`
+	Message      string    `db:"message" json:"message"`
+	Data         JSONB     `db:"data" json:"data,omitempty"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
 }
 
 // Workspace represents an AI workspace that extends a VM
@@ -149,13 +301,20 @@ type Workspace struct {
 	CreatedAt         time.Time  `db:"created_at" json:"created_at"`
 	ReadyAt           *time.Time `db:"ready_at" json:"ready_at,omitempty"`
 	StoppedAt         *time.Time `db:"stopped_at" json:"stopped_at,omitempty"`
+	CreatePhase       string     `db:"create_phase" json:"create_phase,omitempty"` // Last completed creation phase
 	Metadata          JSONB      `db:"metadata" json:"metadata"`
+
+	// Annotations describe the workspace to people (nil = none). Set with
+	// SetAnnotations.
+	Annotations *Annotations `db:"annotations" json:"annotations,omitempty"`
 }
 
-// WorkspaceSecret represents an encrypted secret for a workspace
+// WorkspaceSecret represents an encrypted secret for a workspace, or for an
+// environment whose workspaces inherit it
 type WorkspaceSecret struct {
 	ID              uuid.UUID  `db:"id" json:"id"`
 	WorkspaceID     *uuid.UUID `db:"workspace_id" json:"workspace_id,omitempty"`
+	EnvironmentID   *uuid.UUID `db:"environment_id" json:"environment_id,omitempty"`
 	Name            string     `db:"name" json:"name"`
 	Description     *string    `db:"description" json:"description,omitempty"`
 	SecretType      string     `db:"secret_type" json:"secret_type"`
@@ -165,6 +324,23 @@ type WorkspaceSecret struct {
 	Scope           string     `db:"scope" json:"scope"`
 	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
 	UpdatedAt       time.Time  `db:"updated_at" json:"updated_at"`
+	LastUsedAt      *time.Time `db:"last_used_at" json:"last_used_at,omitempty"`
+}
+
+// Ways a secret reaches a VM
+const (
+	SecretUsageVMBoot = "vm_boot" // Fetched by the VM's agent over vsock at boot
+	SecretUsagePrompt = "prompt"  // In the environment of a prompt's command
+)
+
+// SecretUsage records a secret reaching a VM
+type SecretUsage struct {
+	ID          uuid.UUID  `db:"id" json:"id"`
+	SecretID    uuid.UUID  `db:"secret_id" json:"secret_id"`
+	WorkspaceID *uuid.UUID `db:"workspace_id" json:"workspace_id,omitempty"`
+	VMID        *uuid.UUID `db:"vm_id" json:"vm_id,omitempty"`
+	RequestType string     `db:"request_type" json:"request_type"`
+	UsedAt      time.Time  `db:"used_at" json:"used_at"`
 }
 
 // PrepStep represents a workspace preparation step
@@ -214,15 +390,67 @@ type PromptTask struct {
 	CompletedAt      *time.Time `db:"completed_at" json:"completed_at,omitempty"`
 	DurationMS       *int       `db:"duration_ms" json:"duration_ms,omitempty"`
 	Metadata         JSONB      `db:"metadata" json:"metadata"`
+
+	// What the prompt ran against, captured before it started
+	ExecutionEnv *ExecutionEnvironment `db:"execution_env" json:"execution_env,omitempty"`
+
+	// TimeoutSeconds overrides the environment's prompt timeout (nil = use it)
+	TimeoutSeconds *int `db:"timeout_seconds" json:"timeout_seconds,omitempty"`
+
+	// Why a failed prompt failed (one of the PromptFailure* reasons) and the
+	// output or event it was classified from
+	FailureReason *string `db:"failure_reason" json:"failure_reason,omitempty"`
+	FailureDetail *string `db:"failure_detail" json:"failure_detail,omitempty"`
+
+	// Attempt the prompt is on, counting from 1. Prompts that fail for
+	// infrastructure reasons are retried; see PromptAttempt.
+	Attempt int `db:"attempt" json:"attempt"`
+
+	// Workload class the prompt is queued in (see queue.WorkloadClass)
+	WorkloadClass string `db:"workload_class" json:"workload_class"`
+}
+
+// Prompt statuses. A prompt ends completed, failed, cancelled or timed out.
+const (
+	PromptStatusPending   = "pending"
+	PromptStatusRunning   = "running"
+	PromptStatusCompleted = "completed"
+	PromptStatusFailed    = "failed"
+	PromptStatusCancelled = "cancelled"
+	PromptStatusTimedOut  = "timed_out" // Killed at its time limit
+)
+
+// IsTerminalPromptStatus reports whether a prompt with status has finished
+func IsTerminalPromptStatus(status string) bool {
+	switch status {
+	case PromptStatusCompleted, PromptStatusFailed, PromptStatusCancelled, PromptStatusTimedOut:
+		return true
+	}
+	return false
+}
+
+// PromptAttempt is an earlier attempt of a prompt that failed for an
+// infrastructure reason (see IsInfrastructureFailure) and was retried
+type PromptAttempt struct {
+	PromptID      uuid.UUID  `db:"prompt_id" json:"prompt_id"`
+	Attempt       int        `db:"attempt" json:"attempt"`
+	WorkerID      *string    `db:"worker_id" json:"worker_id,omitempty"`
+	VMID          *uuid.UUID `db:"vm_id" json:"vm_id,omitempty"`
+	FailureReason string     `db:"failure_reason" json:"failure_reason"`
+	Error         *string    `db:"error" json:"error,omitempty"`
+	StartedAt     *time.Time `db:"started_at" json:"started_at,omitempty"`
+	FinishedAt    time.Time  `db:"finished_at" json:"finished_at"`
 }
 
 // PromptResult holds execution results for a prompt
 type PromptResult struct {
-	ExitCode   int
-	Stdout     string
-	Stderr     string
-	Error      string
-	DurationMS int
+	ExitCode      int
+	Stdout        string
+	Stderr        string
+	Error         string
+	DurationMS    int
+	FailureReason string // Empty unless the prompt failed
+	FailureDetail string
 }
 
 // WorkspaceSession represents a WebSocket session
@@ -230,6 +458,7 @@ type WorkspaceSession struct {
 	ID             uuid.UUID  `db:"id" json:"id"`
 	WorkspaceID    uuid.UUID  `db:"workspace_id" json:"workspace_id"`
 	Status         string     `db:"status" json:"status"`
+	GatewayID      *string    `db:"gateway_id" json:"gateway_id,omitempty"` // Gateway replica holding the connection
 	ClientIP       *string    `db:"client_ip" json:"client_ip,omitempty"`
 	UserAgent      *string    `db:"user_agent" json:"user_agent,omitempty"`
 	ConnectedAt    time.Time  `db:"connected_at" json:"connected_at"`
@@ -257,12 +486,50 @@ type VMRepository interface {
 	List(ctx context.Context, filters map[string]interface{}) ([]*VM, error)
 	Update(ctx context.Context, vm *VM) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	UpdateLastUsed(ctx context.Context, id uuid.UUID) error
+}
+
+// VMGCPolicyRepository handles VM garbage collection policy storage
+type VMGCPolicyRepository interface {
+	Get(ctx context.Context, project string) (*VMGCPolicy, error)
+	List(ctx context.Context) ([]*VMGCPolicy, error)
+	Upsert(ctx context.Context, policy *VMGCPolicy) error
+	Delete(ctx context.Context, project string) error
+}
+
+// WorkspaceReapPolicyRepository handles stale workspace policy storage
+type WorkspaceReapPolicyRepository interface {
+	Get(ctx context.Context, project string) (*WorkspaceReapPolicy, error)
+	List(ctx context.Context) ([]*WorkspaceReapPolicy, error)
+	Upsert(ctx context.Context, policy *WorkspaceReapPolicy) error
+	Delete(ctx context.Context, project string) error
+}
+
+// CapacityPolicyRepository handles per-project capacity policy storage operations
+type CapacityPolicyRepository interface {
+	Get(ctx context.Context, project string) (*CapacityPolicy, error)
+	List(ctx context.Context) ([]*CapacityPolicy, error)
+	Upsert(ctx context.Context, policy *CapacityPolicy) error
+	Delete(ctx context.Context, project string) error
+}
+
+// AlertRuleRepository handles alert rule storage operations
+type AlertRuleRepository interface {
+	Create(ctx context.Context, rule *AlertRule) error
+	Get(ctx context.Context, id uuid.UUID) (*AlertRule, error)
+	List(ctx context.Context) ([]*AlertRule, error)
+	Update(ctx context.Context, rule *AlertRule) error
+	// UpdateState records the outcome of evaluating a rule
+	UpdateState(ctx context.Context, id uuid.UUID, firing bool, value *float64, firedAt *time.Time) error
+	Delete(ctx context.Context, id uuid.UUID) error
 }
 
 // TaskRepository handles task storage operations
 type TaskRepository interface {
 	Create(ctx context.Context, task *Task) error
 	Get(ctx context.Context, id uuid.UUID) (*Task, error)
+	// List returns the tasks matching the type, status and vm_id filters,
+	// newest first, up to limit
 	List(ctx context.Context, filters map[string]interface{}) ([]*Task, error)
 	Update(ctx context.Context, task *Task) error
 	Delete(ctx context.Context, id uuid.UUID) error
@@ -270,6 +537,31 @@ type TaskRepository interface {
 	MarkProcessing(ctx context.Context, id uuid.UUID, workerID string) error
 	MarkCompleted(ctx context.Context, id uuid.UUID, result map[string]interface{}) error
 	MarkFailed(ctx context.Context, id uuid.UUID, err error) error
+
+	// Finish records how an attempt at a task ended
+	Finish(ctx context.Context, id uuid.UUID, outcome *TaskOutcome) error
+	// ListByVM and ListByWorkspace return the tasks that acted on a VM or
+	// workspace, newest first
+	ListByVM(ctx context.Context, vmID uuid.UUID, limit int) ([]*Task, error)
+	ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, limit int) ([]*Task, error)
+}
+
+// Task statuses recorded in the task history
+const (
+	TaskStatusPending    = "pending"
+	TaskStatusProcessing = "processing"
+	TaskStatusCompleted  = "completed"
+	TaskStatusRetrying   = "retrying" // Failed, and will be retried
+	TaskStatusFailed     = "failed"
+)
+
+// TaskOutcome is how an attempt at a task ended
+type TaskOutcome struct {
+	Status     string // TaskStatusCompleted, TaskStatusRetrying or TaskStatusFailed
+	Result     JSONB
+	Error      *string
+	RetryCount int        // Retries so far, including any this outcome leads to
+	VMID       *uuid.UUID // The VM the task created, if it had none yet
 }
 
 // JobRepository handles job storage operations
@@ -285,10 +577,20 @@ type JobRepository interface {
 type ExecutionRepository interface {
 	Create(ctx context.Context, execution *Execution) error
 	Get(ctx context.Context, id uuid.UUID) (*Execution, error)
+	GetByTaskID(ctx context.Context, taskID uuid.UUID) (*Execution, error) // Latest execution for a queue task
 	ListByJob(ctx context.Context, jobID uuid.UUID) ([]*Execution, error)
 	ListByVM(ctx context.Context, vmID uuid.UUID) ([]*Execution, error)
 }
 
+// SmartExecutionRepository handles smart execution storage operations
+type SmartExecutionRepository interface {
+	Create(ctx context.Context, execution *SmartExecution) error
+	Get(ctx context.Context, id uuid.UUID) (*SmartExecution, error)
+	// List returns smart executions newest first. Filters: vm_id (uuid.UUID), vm_created (bool),
+	// status, environment, project (string), since, until (time.Time), limit (int)
+	List(ctx context.Context, filters map[string]interface{}) ([]*SmartExecution, error)
+}
+
 // WorkerRepository handles worker storage operations
 type WorkerRepository interface {
 	Create(ctx context.Context, worker *Worker) error
@@ -298,6 +600,7 @@ type WorkerRepository interface {
 	UpdateResources(ctx context.Context, id string, resources map[string]interface{}) error
 	UpdateStatus(ctx context.Context, id string, status string) error
 	UpdateLastSeen(ctx context.Context, id string) error
+	UpdateMetadata(ctx context.Context, id string, metadata map[string]interface{}) error // Merges keys into existing metadata
 	Delete(ctx context.Context, id string) error
 	ListByZone(ctx context.Context, zone string) ([]*Worker, error)
 	ListActive(ctx context.Context) ([]*Worker, error)
@@ -322,12 +625,26 @@ type WorkspaceRepository interface {
 	ListByEnvironment(ctx context.Context, environmentID uuid.UUID) ([]*Workspace, error)
 	ListIdleWithVMs(ctx context.Context) ([]*Workspace, error)
 	Update(ctx context.Context, workspace *Workspace) error
-	UpdateStatus(ctx context.Context, id uuid.UUID, status string) error
+	// UpdateStatus moves the workspace to status, recording the change and
+	// its reason in the status history. Illegal transitions return
+	// ErrInvalidWorkspaceTransition.
+	UpdateStatus(ctx context.Context, id uuid.UUID, status, reason string) error
 	UpdateIdleSince(ctx context.Context, id uuid.UUID, idleSince *time.Time) error
 	SetVMID(ctx context.Context, id uuid.UUID, vmID uuid.UUID) error
 	ClearVMID(ctx context.Context, id uuid.UUID) error
 	SetEnvironmentID(ctx context.Context, id uuid.UUID, environmentID uuid.UUID) error
-	SetReady(ctx context.Context, id uuid.UUID) error
+	SetReady(ctx context.Context, id uuid.UUID, reason string) error
+	SetCreatePhase(ctx context.Context, id uuid.UUID, phase string) error
+	// UpdateMetadata merges the given keys into the workspace's metadata
+	UpdateMetadata(ctx context.Context, id uuid.UUID, metadata map[string]interface{}) error
+	// SetAnnotations replaces the workspace's annotations (nil removes them)
+	SetAnnotations(ctx context.Context, id uuid.UUID, annotations *Annotations) error
+	ListStatusHistory(ctx context.Context, id uuid.UUID) ([]*WorkspaceStatusChange, error)
+	// ListUsage summarizes each workspace's activity since the given time,
+	// optionally filtered by environment_id
+	ListUsage(ctx context.Context, filters map[string]interface{}, since time.Time) ([]*WorkspaceUsage, error)
+	// ListActivity returns when each workspace was last used
+	ListActivity(ctx context.Context) ([]*WorkspaceActivity, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
@@ -337,7 +654,13 @@ type SecretRepository interface {
 	Get(ctx context.Context, id uuid.UUID) (*WorkspaceSecret, error)
 	GetByName(ctx context.Context, workspaceID *uuid.UUID, name string) (*WorkspaceSecret, error)
 	ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]*WorkspaceSecret, error)
+	ListByEnvironment(ctx context.Context, environmentID uuid.UUID) ([]*WorkspaceSecret, error)
 	ListGlobal(ctx context.Context) ([]*WorkspaceSecret, error)
+	// ListUnused lists secrets created before since and not used since then
+	ListUnused(ctx context.Context, since time.Time) ([]*WorkspaceSecret, error)
+	// RecordUsage stores a usage and bumps the secret's LastUsedAt
+	RecordUsage(ctx context.Context, usage *SecretUsage) error
+	ListUsage(ctx context.Context, secretID uuid.UUID, limit int) ([]*SecretUsage, error)
 	Update(ctx context.Context, secret *WorkspaceSecret) error
 	Delete(ctx context.Context, id uuid.UUID) error
 }
@@ -350,6 +673,8 @@ type PrepStepRepository interface {
 	ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]*PrepStep, error)
 	GetNextPending(ctx context.Context, workspaceID uuid.UUID) (*PrepStep, error)
 	UpdateStatus(ctx context.Context, id uuid.UUID, status string, result *PrepStepResult) error
+	// ResetByWorkspace marks every step pending again, clearing its results
+	ResetByWorkspace(ctx context.Context, workspaceID uuid.UUID) error
 }
 
 // PromptTaskRepository handles prompt task storage operations
@@ -359,7 +684,26 @@ type PromptTaskRepository interface {
 	ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, limit int) ([]*PromptTask, error)
 	GetNextPending(ctx context.Context, workspaceID uuid.UUID) (*PromptTask, error)
 	UpdateStatus(ctx context.Context, id uuid.UUID, status string, result *PromptResult) error
+	SetExecutionEnv(ctx context.Context, id uuid.UUID, env *ExecutionEnvironment) error
 	Cancel(ctx context.Context, id uuid.UUID) error
+
+	// CountPendingAhead counts pending prompts, across all workspaces, that
+	// run before the given one (higher priority, or scheduled earlier)
+	CountPendingAhead(ctx context.Context, task *PromptTask) (int, error)
+	CountByStatus(ctx context.Context, status string) (int, error)
+	// CountFinishedSince counts prompts finished since the given time, by status
+	CountFinishedSince(ctx context.Context, since time.Time) (map[string]int, error)
+	// AverageDuration averages the latest limit finished prompts of the
+	// workspace and of other workspaces using its environment
+	AverageDuration(ctx context.Context, workspaceID uuid.UUID, limit int) (time.Duration, error)
+
+	// ListByStatus lists prompts with a status, oldest first
+	ListByStatus(ctx context.Context, status string) ([]*PromptTask, error)
+	// Retry records a failed attempt and sets the prompt pending on the
+	// next one, or returns ErrPromptAttemptPassed if the prompt has moved
+	// past attempt.Attempt.
+	Retry(ctx context.Context, attempt *PromptAttempt) error
+	ListAttempts(ctx context.Context, promptID uuid.UUID) ([]*PromptAttempt, error)
 }
 
 // SessionRepository handles workspace session storage operations
@@ -369,21 +713,56 @@ type SessionRepository interface {
 	GetActiveByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]*WorkspaceSession, error)
 	UpdateLastActivity(ctx context.Context, id uuid.UUID) error
 	UpdateStatus(ctx context.Context, id uuid.UUID, status string) error
+	DisconnectByGateway(ctx context.Context, gatewayID string) (int64, error) // Mark a replica's active sessions disconnected
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
+// ClusterRepository handles federated cluster storage operations
+type ClusterRepository interface {
+	Get(ctx context.Context, name string) (*Cluster, error)
+	List(ctx context.Context) ([]*Cluster, error)
+	Upsert(ctx context.Context, cluster *Cluster) error
+	Delete(ctx context.Context, name string) error
+}
+
+// IntegrationConfigRepository handles runtime integration config storage
+// operations
+type IntegrationConfigRepository interface {
+	Get(ctx context.Context, name string) (*IntegrationConfig, error)
+	List(ctx context.Context) ([]*IntegrationConfig, error)
+	Upsert(ctx context.Context, config *IntegrationConfig) error
+	Delete(ctx context.Context, name string) error
+}
+
 // SessionMessageRepository handles session message storage operations
 type SessionMessageRepository interface {
 	Create(ctx context.Context, message *SessionMessage) error
 	ListBySession(ctx context.Context, sessionID uuid.UUID, limit int) ([]*SessionMessage, error)
 }
 
+// ClusterEventRepository handles cluster event timeline storage operations
+type ClusterEventRepository interface {
+	Create(ctx context.Context, event *ClusterEvent) error
+	// List returns events newest first. Filters: types ([]string), severity, resource_type,
+	// resource_id, worker_id (string), since, until (time.Time), limit (int)
+	List(ctx context.Context, filters map[string]interface{}) ([]*ClusterEvent, error)
+	DeleteOlderThan(ctx context.Context, before time.Time) (int64, error)
+}
+
 // Store provides access to all repositories
 type Store interface {
 	VMs() VMRepository
+	VMSnapshots() VMSnapshotRepository
+	VMGCPolicies() VMGCPolicyRepository
+	WorkspaceReapPolicies() WorkspaceReapPolicyRepository
+	CapacityPolicies() CapacityPolicyRepository
+	AlertRules() AlertRuleRepository
+	Clusters() ClusterRepository
+	IntegrationConfigs() IntegrationConfigRepository
 	Tasks() TaskRepository
 	Jobs() JobRepository
 	Executions() ExecutionRepository
+	SmartExecutions() SmartExecutionRepository
 	Workers() WorkerRepository
 	WorkerMetrics() WorkerMetricRepository
 	Environments() EnvironmentRepository
@@ -391,7 +770,18 @@ type Store interface {
 	Secrets() SecretRepository
 	PrepSteps() PrepStepRepository
 	PromptTasks() PromptTaskRepository
+	PromptAttachments() PromptAttachmentRepository
+	PromptCheckpoints() PromptCheckpointRepository
 	Sessions() SessionRepository
 	SessionMessages() SessionMessageRepository
+	ClusterEvents() ClusterEventRepository
+	KV() KVRepository
+	Search() SearchRepository
+	SLO() SLORepository
+	Transcripts() TranscriptRepository
+	// WithTx runs fn with a Store whose repositories share one transaction,
+	// committing if fn returns nil and rolling back otherwise
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+	Ping(ctx context.Context) error
 	Close() error
 }
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Transcript record kinds
+const (
+	TranscriptKindExecution = "execution"
+	TranscriptKindPrompt    = "prompt"
+)
+
+// TranscriptEntry links an execution or a finished prompt into the
+// transcript chain. Each entry's hash covers the record's content hash and
+// the previous entry's hash, so changing, removing or reordering a record
+// breaks every hash after it (see package transcript).
+type TranscriptEntry struct {
+	Seq         int64     `db:"seq" json:"seq"` // 1, 2, 3... without gaps
+	Kind        string    `db:"kind" json:"kind"`
+	RecordID    uuid.UUID `db:"record_id" json:"record_id"`
+	ContentHash string    `db:"content_hash" json:"content_hash"`
+	PrevHash    string    `db:"prev_hash" json:"prev_hash"`
+	Hash        string    `db:"hash" json:"hash"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+// TranscriptAnchor is the chain's head as published at a point in time.
+// Copies kept outside the database prove the chain up to Seq hasn't been
+// rewritten since.
+type TranscriptAnchor struct {
+	Seq       int64     `db:"seq" json:"seq"`
+	Hash      string    `db:"hash" json:"hash"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// TranscriptRepository reads the transcript chain and its anchors. Entries
+// are appended by the execution and prompt repositories of stores with the
+// transcript chain enabled, in the transaction writing the record.
+type TranscriptRepository interface {
+	// List returns entries after afterSeq, in chain order, up to limit
+	List(ctx context.Context, afterSeq int64, limit int) ([]*TranscriptEntry, error)
+	// ListByRecord returns a record's entries in chain order
+	ListByRecord(ctx context.Context, recordID uuid.UUID) ([]*TranscriptEntry, error)
+	// Head returns the last entry, or nil while the chain is empty
+	Head(ctx context.Context) (*TranscriptEntry, error)
+
+	// Anchor records an anchor, reporting false if Seq was anchored already
+	Anchor(ctx context.Context, anchor *TranscriptAnchor) (bool, error)
+	// ListAnchors returns the anchors, oldest first
+	ListAnchors(ctx context.Context) ([]*TranscriptAnchor, error)
+}
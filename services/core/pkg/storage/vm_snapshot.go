@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VM snapshot statuses
+const (
+	VMSnapshotStatusPending = "pending" // Waiting for the VM's worker to take it
+	VMSnapshotStatusReady   = "ready"
+	VMSnapshotStatusFailed  = "failed"
+)
+
+// VMSnapshot is a checkpoint of a VM's memory, devices and disk that the VM
+// can be restored to. Its files are kept on the worker hosting the VM and
+// are deleted with the VM.
+type VMSnapshot struct {
+	ID          uuid.UUID  `db:"id" json:"id"`
+	VMID        uuid.UUID  `db:"vm_id" json:"vm_id"`
+	WorkerID    *string    `db:"worker_id" json:"worker_id,omitempty"`
+	Name        string     `db:"name" json:"name"`
+	Status      string     `db:"status" json:"status"`
+	SizeBytes   *int64     `db:"size_bytes" json:"size_bytes,omitempty"` // Memory and disk files, once ready
+	Error       *string    `db:"error" json:"error,omitempty"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	CompletedAt *time.Time `db:"completed_at" json:"completed_at,omitempty"`
+	RestoredAt  *time.Time `db:"restored_at" json:"restored_at,omitempty"` // Last time the VM was restored to it
+}
+
+// VMSnapshotRepository handles VM snapshot storage operations
+type VMSnapshotRepository interface {
+	Create(ctx context.Context, snapshot *VMSnapshot) error
+	Get(ctx context.Context, id uuid.UUID) (*VMSnapshot, error)
+	// ListByVM returns the VM's snapshots, newest first
+	ListByVM(ctx context.Context, vmID uuid.UUID) ([]*VMSnapshot, error)
+	// Complete marks a snapshot ready
+	Complete(ctx context.Context, id uuid.UUID, sizeBytes int64) error
+	// Fail marks a snapshot failed with the reason
+	Fail(ctx context.Context, id uuid.UUID, reason string) error
+	// MarkRestored records that the VM was restored to the snapshot
+	MarkRestored(ctx context.Context, id uuid.UUID) error
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Workspace metadata keys recording which zone the workspace's VMs run in
+const (
+	WorkspaceMetadataZone        = "zone"
+	WorkspaceMetadataZoneHistory = "zone_history"
+)
+
+// Zone placement reasons
+const (
+	PlacementInitial  = "initial"  // First VM of the workspace
+	PlacementRespawn  = "respawn"  // New VM in the same zone
+	PlacementFailover = "failover" // VM respawned in another zone because its zone had no healthy workers
+	PlacementMoved    = "moved"    // Workspace recreated on a worker in another zone
+)
+
+// maxZoneHistory bounds the placement history kept in workspace metadata
+const maxZoneHistory = 20
+
+// ZonePlacement is one entry in a workspace's zone placement history
+type ZonePlacement struct {
+	Zone     string    `json:"zone"`
+	WorkerID string    `json:"worker_id"`
+	VMID     string    `json:"vm_id"`
+	Reason   string    `json:"reason"`
+	PlacedAt time.Time `json:"placed_at"`
+}
+
+// Zone returns the zone the workspace's VMs are placed in, or "" if it has
+// never had a VM on a worker with a zone
+func (w *Workspace) Zone() string {
+	zone, _ := w.Metadata[WorkspaceMetadataZone].(string)
+	return zone
+}
+
+// ZoneHistory returns the workspace's zone placements, oldest first
+func (w *Workspace) ZoneHistory() []ZonePlacement {
+	raw, ok := w.Metadata[WorkspaceMetadataZoneHistory]
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var history []ZonePlacement
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil
+	}
+	return history
+}
+
+// PlacementMetadata returns the metadata keys recording a new placement of
+// the workspace, for WorkspaceRepository.UpdateMetadata. Only the latest
+// placements are kept.
+func (w *Workspace) PlacementMetadata(placement ZonePlacement) map[string]interface{} {
+	history := append(w.ZoneHistory(), placement)
+	if len(history) > maxZoneHistory {
+		history = history[len(history)-maxZoneHistory:]
+	}
+	return map[string]interface{}{
+		WorkspaceMetadataZone:        placement.Zone,
+		WorkspaceMetadataZoneHistory: history,
+	}
+}
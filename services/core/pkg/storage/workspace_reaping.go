@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WorkspaceReapPolicy defines when a project's unused workspaces are flagged
+// as stale and archived. Workspaces are assigned a project via
+// metadata->>'project'; projects without a policy use the "default" one, and
+// a disabled policy opts its project out.
+type WorkspaceReapPolicy struct {
+	Project           string       `db:"project" json:"project"`
+	StaleAfterSeconds int          `db:"stale_after_seconds" json:"stale_after_seconds"` // Without activity
+	GraceSeconds      int          `db:"grace_seconds" json:"grace_seconds"`             // Between the notice and archiving
+	Notify            AlertTargets `db:"notify" json:"notify"`
+	Enabled           bool         `db:"enabled" json:"enabled"`
+	CreatedAt         time.Time    `db:"created_at" json:"created_at"`
+	UpdatedAt         time.Time    `db:"updated_at" json:"updated_at"`
+}
+
+// AlertTargets is a JSONB array of notification targets
+type AlertTargets []AlertTarget
+
+// Value implements the driver.Valuer interface, storing nil as []
+func (t AlertTargets) Value() (driver.Value, error) {
+	if t == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(t)
+}
+
+// Scan implements the sql.Scanner interface
+func (t *AlertTargets) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, t)
+}
+
+// WorkspaceActivity is when a workspace was last used: the latest of its
+// creation, becoming ready, a prompt and session activity
+type WorkspaceActivity struct {
+	WorkspaceID    uuid.UUID `db:"workspace_id"`
+	LastActivityAt time.Time `db:"last_activity_at"`
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Workspace statuses
+const (
+	WorkspaceStatusCreating  = "creating"  // Record created, waiting for a worker
+	WorkspaceStatusPreparing = "preparing" // Worker is creating the VM and running prep steps
+	WorkspaceStatusSpawning  = "spawning"  // Worker is booting an on-demand VM from the environment
+	WorkspaceStatusReady     = "ready"     // VM is running and accepting prompts
+	WorkspaceStatusIdle      = "idle"      // VM was reclaimed; the next prompt spawns a new one
+	WorkspaceStatusFailed    = "failed"
+)
+
+// Workspace creation phases, in order. CreatePhase records the last phase
+// that completed so a retried create task can resume after it.
+const (
+	WorkspacePhaseVMCreated      = "vm_created"      // VM booted and linked to the workspace
+	WorkspacePhaseToolsInstalled = "tools_installed" // Default, AI assistant and additional tools installed
+	WorkspacePhasePrepared       = "prepared"        // All prep steps completed
+)
+
+// ErrInvalidWorkspaceTransition is returned when a workspace is moved to a
+// status it can't reach from its current one
+var ErrInvalidWorkspaceTransition = errors.New("invalid workspace status transition")
+
+// workspaceTransitions lists the statuses each workspace status may move to:
+//
+//	creating -> preparing -> ready <-> idle
+//	creating -> spawning  -> ready
+//	idle     -> spawning  -> ready
+//	spawning -> idle      (VM failed to spawn, prompt retried elsewhere)
+//	ready    -> creating  (VM moved to another worker)
+//
+// Any status may fail. A failed workspace can only move back to preparing,
+// when its creation is retried.
+var workspaceTransitions = map[string][]string{
+	WorkspaceStatusCreating:  {WorkspaceStatusPreparing, WorkspaceStatusSpawning, WorkspaceStatusReady, WorkspaceStatusFailed},
+	WorkspaceStatusPreparing: {WorkspaceStatusReady, WorkspaceStatusFailed},
+	WorkspaceStatusSpawning:  {WorkspaceStatusReady, WorkspaceStatusIdle, WorkspaceStatusFailed},
+	WorkspaceStatusReady:     {WorkspaceStatusIdle, WorkspaceStatusSpawning, WorkspaceStatusCreating, WorkspaceStatusFailed},
+	WorkspaceStatusIdle:      {WorkspaceStatusSpawning, WorkspaceStatusReady, WorkspaceStatusFailed},
+	WorkspaceStatusFailed:    {WorkspaceStatusPreparing},
+}
+
+// ValidWorkspaceStatus reports whether status is one of the defined workspace statuses
+func ValidWorkspaceStatus(status string) bool {
+	_, ok := workspaceTransitions[status]
+	return ok
+}
+
+// CheckWorkspaceTransition returns ErrInvalidWorkspaceTransition if a
+// workspace can't move from one status to the other. Staying in the same
+// status is always allowed.
+func CheckWorkspaceTransition(from, to string) error {
+	if !ValidWorkspaceStatus(to) {
+		return fmt.Errorf("unknown workspace status: %q", to)
+	}
+	if from == to {
+		return nil
+	}
+	for _, allowed := range workspaceTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrInvalidWorkspaceTransition, from, to)
+}
+
+// WorkspaceStatusChange is one entry in a workspace's status history
+type WorkspaceStatusChange struct {
+	ID          uuid.UUID `db:"id" json:"id"`
+	WorkspaceID uuid.UUID `db:"workspace_id" json:"workspace_id"`
+	FromStatus  *string   `db:"from_status" json:"from_status,omitempty"` // nil for the initial status
+	ToStatus    string    `db:"to_status" json:"to_status"`
+	Reason      string    `db:"reason" json:"reason"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
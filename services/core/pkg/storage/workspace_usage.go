@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WorkspaceUsage summarizes a workspace's prompts and VM time since a given
+// time. VM time is the time spent spawning, preparing or ready, taken from
+// the status history.
+type WorkspaceUsage struct {
+	WorkspaceID     uuid.UUID  `db:"workspace_id"`
+	Name            string     `db:"name"`
+	EnvironmentID   *uuid.UUID `db:"environment_id"`
+	Status          string     `db:"status"`
+	Prompts         int        `db:"prompts"`
+	FinishedPrompts int        `db:"finished_prompts"` // Completed, failed or timed out
+	FailedPrompts   int        `db:"failed_prompts"`   // Failed or timed out
+	AvgDurationMs   float64    `db:"avg_duration_ms"`  // Of prompts that ran
+	BusySeconds     float64    `db:"busy_seconds"`     // Spent running prompts
+	VMSeconds       float64    `db:"vm_seconds"`
+
+	// Daily holds the prompts submitted on each day with any, oldest first
+	Daily []DailyPrompts `db:"-"`
+}
+
+// DailyPrompts counts the prompts submitted to a workspace on a (UTC) day
+type DailyPrompts struct {
+	Day     time.Time `db:"day"`
+	Prompts int       `db:"prompts"`
+}
+
+// FailureRate is the share of finished prompts that failed
+func (u *WorkspaceUsage) FailureRate() float64 {
+	if u.FinishedPrompts == 0 {
+		return 0
+	}
+	return float64(u.FailedPrompts) / float64(u.FinishedPrompts)
+}
+
+// IdleRatio is the share of VM time no prompt was running
+func (u *WorkspaceUsage) IdleRatio() float64 {
+	if u.VMSeconds <= 0 {
+		return 0
+	}
+	idle := 1 - u.BusySeconds/u.VMSeconds
+	return min(max(idle, 0), 1)
+}
+
+// VMHours is the VM time in hours
+func (u *WorkspaceUsage) VMHours() float64 {
+	return u.VMSeconds / 3600
+}
@@ -4,15 +4,20 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/aetherium/aetherium/libs/common/pkg/logging"
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
 	"github.com/aetherium/aetherium/services/core/pkg/vmm"
 )
 
 // Installer handles tool installation in VMs
 type Installer struct {
 	orchestrator vmm.VMOrchestrator
+	logger       logging.Logger // optional; receives install output
+	mirrors      Mirrors        // optional; see SetMirrors
 }
 
 // NewInstaller creates a new tool installer
@@ -22,24 +27,54 @@ func NewInstaller(orchestrator vmm.VMOrchestrator) *Installer {
 	}
 }
 
+// SetLogger ships each tool's install output to logger, labelled with the VM ID
+func (i *Installer) SetLogger(logger logging.Logger) {
+	i.logger = logger
+}
+
+// Release is an exact release of a tool, as resolved by a Resolver. Artifact
+// and Checksum are optional; when Checksum is set the downloaded artifact is
+// verified before it is installed.
+type Release struct {
+	Version  string `json:"version"`
+	Artifact string `json:"artifact,omitempty"`
+	Checksum string `json:"checksum,omitempty"` // "<algorithm>:<hex digest>"
+}
+
 // InstallTools installs a list of tools in a VM
 func (i *Installer) InstallTools(ctx context.Context, vmID string, tools []string, versions map[string]string) error {
+	releases := make(map[string]Release, len(versions))
+	for tool, version := range versions {
+		releases[tool] = Release{Version: version}
+	}
+	return i.InstallReleases(ctx, vmID, tools, releases)
+}
+
+// InstallReleases installs a list of tools in a VM, each at its release in
+// releases. Tools without a release are installed at their default version.
+func (i *Installer) InstallReleases(ctx context.Context, vmID string, tools []string, releases map[string]Release) error {
 	if len(tools) == 0 {
 		return nil
 	}
 
 	log.Printf("Installing tools in VM %s: %v", vmID, tools)
 
+	// Installs still work from upstream if the mirrors can't be configured
+	if err := i.configureMirrors(ctx, vmID); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
 	var failedTools []string
 	for _, tool := range tools {
-		version := versions[tool]
-		if version == "" {
-			version = "latest"
+		release := releases[tool]
+		if release.Version == "" {
+			release.Version = "latest"
 		}
+		version := release.Version
 
 		log.Printf("Installing %s@%s...", tool, version)
 
-		if err := i.installTool(ctx, vmID, tool, version); err != nil {
+		if err := i.installTool(ctx, vmID, tool, release); err != nil {
 			log.Printf("✗ Failed to install %s@%s: %v", tool, version, err)
 			failedTools = append(failedTools, tool)
 			// Continue installing other tools instead of returning early
@@ -57,8 +92,8 @@ func (i *Installer) InstallTools(ctx context.Context, vmID string, tools []strin
 }
 
 // installTool installs a specific tool
-func (i *Installer) installTool(ctx context.Context, vmID string, tool string, version string) error {
-	script, err := getInstallScript(tool, version)
+func (i *Installer) installTool(ctx context.Context, vmID string, tool string, release Release) error {
+	script, err := getInstallScript(tool, release)
 	if err != nil {
 		return err
 	}
@@ -71,16 +106,48 @@ func (i *Installer) installTool(ctx context.Context, vmID string, tool string, v
 
 	result, err := i.orchestrator.ExecuteCommand(ctx, vmID, cmd)
 	if err != nil {
+		i.logInstall(ctx, vmID, tool, release, nil, err)
 		return fmt.Errorf("failed to execute install script: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		return fmt.Errorf("install script failed: %s\n%s", result.Stderr, result.Stdout)
+		err := fmt.Errorf("install script failed: %s\n%s", result.Stderr, result.Stdout)
+		i.logInstall(ctx, vmID, tool, release, result, err)
+		return err
 	}
 
+	i.logInstall(ctx, vmID, tool, release, result, nil)
 	return nil
 }
 
+// logInstall ships a tool install's outcome and output to the logger, if set
+func (i *Installer) logInstall(ctx context.Context, vmID, tool string, release Release, result *vmm.ExecResult, installErr error) {
+	if i.logger == nil {
+		return
+	}
+
+	fields := map[string]interface{}{
+		"vm_id":   vmID,
+		"tool":    tool,
+		"version": release.Version,
+	}
+	if result != nil {
+		fields["exit_code"] = result.ExitCode
+		fields["stdout"] = result.Stdout
+		fields["stderr"] = result.Stderr
+	}
+
+	level, message := types.LogLevelInfo, fmt.Sprintf("Installed %s@%s", tool, release.Version)
+	if installErr != nil {
+		level, message = types.LogLevelError, fmt.Sprintf("Failed to install %s@%s", tool, release.Version)
+		fields["error"] = installErr.Error()
+	}
+
+	if err := i.logger.Log(ctx, level, message, fields); err != nil {
+		log.Printf("Warning: Failed to ship install log for %s: %v", tool, err)
+	}
+}
+
 // VerifyTools checks if tools are installed
 func (i *Installer) VerifyTools(ctx context.Context, vmID string, tools []string) (map[string]bool, error) {
 	results := make(map[string]bool)
@@ -98,6 +165,54 @@ func (i *Installer) VerifyTools(ctx context.Context, vmID string, tools []string
 	return results, nil
 }
 
+// versionCommands print the version of each known tool, keyed by the name
+// the installer knows it by
+var versionCommands = map[string]string{
+	"nodejs":      "node --version",
+	"bun":         "bun --version",
+	"claude-code": "claude --version",
+	"ampcode":     "amp --version",
+	"go":          "go version",
+	"python":      "python3 --version",
+	"rust":        "cargo --version",
+	"git":         "git --version",
+	"docker":      "docker --version",
+}
+
+// DetectVersions reports the version of every known tool installed in a VM,
+// as printed by the tool itself. Tools that aren't installed are left out.
+func (i *Installer) DetectVersions(ctx context.Context, vmID string) (map[string]string, error) {
+	names := make([]string, 0, len(versionCommands))
+	for name := range versionCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var script strings.Builder
+	for _, name := range names {
+		command := versionCommands[name]
+		binary := strings.Fields(command)[0]
+		fmt.Fprintf(&script, "command -v %s >/dev/null 2>&1 && echo \"%s=$(%s 2>&1 | head -n 1)\"\n", binary, name, command)
+	}
+
+	result, err := i.orchestrator.ExecuteCommand(ctx, vmID, &vmm.Command{
+		Cmd:  "bash",
+		Args: []string{"-c", script.String()},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect tool versions: %w", err)
+	}
+
+	versions := make(map[string]string)
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		name, version, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok && version != "" {
+			versions[name] = version
+		}
+	}
+	return versions, nil
+}
+
 // isToolInstalled checks if a tool is installed
 func (i *Installer) isToolInstalled(ctx context.Context, vmID string, tool string) (bool, error) {
 	checkCmd := getVerifyCommand(tool)
@@ -116,24 +231,23 @@ func (i *Installer) isToolInstalled(ctx context.Context, vmID string, tool strin
 }
 
 // getInstallScript returns the installation script for a tool
-func getInstallScript(tool string, version string) (string, error) {
-	// Normalize tool name
-	tool = strings.ToLower(strings.TrimSpace(tool))
+func getInstallScript(tool string, release Release) (string, error) {
+	version, checksum := release.Version, release.Checksum
 
-	switch tool {
-	case "nodejs", "node":
-		return getNodeJSInstallScript(version), nil
+	switch CanonicalTool(tool) {
+	case "nodejs":
+		return getNodeJSInstallScript(version, checksum), nil
 	case "bun":
-		return getBunInstallScript(version), nil
-	case "claude-code", "claudecode":
-		return getClaudeCodeInstallScript(version), nil
-	case "ampcode", "amp":
-		return getAmpcodeInstallScript(version), nil
-	case "go", "golang":
-		return getGoInstallScript(version), nil
-	case "python", "python3":
+		return getBunInstallScript(version, checksum), nil
+	case "claude-code":
+		return getNPMInstallScript("Claude Code", "claude", claudeCodePackage, version, checksum), nil
+	case "ampcode":
+		return getNPMInstallScript("Ampcode", "amp", ampcodePackage, version, checksum), nil
+	case "go":
+		return getGoInstallScript(version, checksum), nil
+	case "python":
 		return getPythonInstallScript(version), nil
-	case "rust", "cargo":
+	case "rust":
 		return getRustInstallScript(version), nil
 	case "git":
 		return getGitInstallScript(), nil
@@ -144,6 +258,64 @@ func getInstallScript(tool string, version string) (string, error) {
 	}
 }
 
+// CanonicalTool returns the installer's name for a tool, resolving aliases
+// such as "node" or "golang"
+func CanonicalTool(tool string) string {
+	tool = strings.ToLower(strings.TrimSpace(tool))
+
+	switch tool {
+	case "nodejs", "node":
+		return "nodejs"
+	case "claude-code", "claudecode":
+		return "claude-code"
+	case "ampcode", "amp":
+		return "ampcode"
+	case "go", "golang":
+		return "go"
+	case "python", "python3":
+		return "python"
+	case "rust", "cargo":
+		return "rust"
+	default:
+		return tool
+	}
+}
+
+// npm packages of the AI assistants
+const (
+	claudeCodePackage = "@anthropic-ai/claude-code"
+	ampcodePackage    = "@anthropic-ai/amp"
+)
+
+// defaultVersions are installed when a tool is requested without a version
+var defaultVersions = map[string]string{
+	"nodejs": "20",
+	"go":     "1.23.0",
+	"python": "3.11",
+	"rust":   "stable",
+}
+
+// defaultVersion returns version, or the tool's default when it is unset
+func defaultVersion(tool, version string) string {
+	if version == "" || version == "latest" {
+		if v, ok := defaultVersions[tool]; ok {
+			return v
+		}
+		return "latest"
+	}
+	return version
+}
+
+// verifyChecksum returns a script line failing the install unless file
+// matches checksum, or nothing when there is no checksum to check
+func verifyChecksum(file, checksum string) string {
+	algorithm, digest, ok := strings.Cut(checksum, ":")
+	if !ok || digest == "" {
+		return ""
+	}
+	return fmt.Sprintf("echo \"%s  %s\" | %ssum -c -", digest, file, algorithm)
+}
+
 // getVerifyCommand returns the command to verify if a tool is installed
 func getVerifyCommand(tool string) string {
 	tool = strings.ToLower(strings.TrimSpace(tool))
@@ -174,10 +346,33 @@ func getVerifyCommand(tool string) string {
 
 // Tool-specific installation scripts
 
-func getNodeJSInstallScript(version string) string {
-	if version == "" || version == "latest" {
-		version = "20"
+func getNodeJSInstallScript(version, checksum string) string {
+	version = strings.TrimPrefix(defaultVersion("nodejs", version), "v")
+
+	// Exact versions come from the official tarball rather than NodeSource,
+	// which only tracks the latest release of each major version
+	if strings.Count(version, ".") == 2 {
+		archive := fmt.Sprintf("node-v%s-linux-x64.tar.xz", version)
+		return fmt.Sprintf(`
+set -e
+export DEBIAN_FRONTEND=noninteractive
+
+# xz is needed to unpack the tarball
+command -v xz >/dev/null 2>&1 || (apt-get update && apt-get install -y xz-utils)
+
+# Install Node.js from the official tarball
+cd /tmp
+curl -fsSLO https://nodejs.org/dist/v%s/%s
+%s
+tar -C /usr/local --strip-components=1 -xJf %s
+rm %s
+
+# Verify installation
+node --version
+npm --version
+`, version, archive, verifyChecksum(archive, checksum), archive, archive)
 	}
+
 	return fmt.Sprintf(`
 set -e
 export DEBIAN_FRONTEND=noninteractive
@@ -192,8 +387,28 @@ npm --version
 `, version)
 }
 
-func getBunInstallScript(version string) string {
-	return `
+func getBunInstallScript(version, checksum string) string {
+	install := `# Install Bun
+curl -fsSL https://bun.sh/install | bash`
+	if version != "" && version != "latest" {
+		version = strings.TrimPrefix(version, "bun-v")
+		install = fmt.Sprintf(`# Install Bun
+curl -fsSL https://bun.sh/install | bash -s "bun-v%s"`, version)
+
+		// A checksum pins the exact release archive, so install it by hand
+		if checksum != "" {
+			install = fmt.Sprintf(`# Install Bun from the release archive
+cd /tmp
+curl -fsSLO https://github.com/oven-sh/bun/releases/download/bun-v%s/bun-linux-x64.zip
+%s
+mkdir -p "$HOME/.bun/bin"
+unzip -o -j bun-linux-x64.zip bun-linux-x64/bun -d "$HOME/.bun/bin"
+chmod +x "$HOME/.bun/bin/bun"
+rm bun-linux-x64.zip`, version, verifyChecksum("bun-linux-x64.zip", checksum))
+		}
+	}
+
+	return fmt.Sprintf(`
 set -e
 
 # Ensure HOME is set (required for bun installer)
@@ -202,8 +417,7 @@ export HOME=${HOME:-/root}
 # Install unzip if not present
 apt-get update && apt-get install -y unzip curl
 
-# Install Bun
-curl -fsSL https://bun.sh/install | bash
+%s
 
 # Add to PATH
 export BUN_INSTALL="$HOME/.bun"
@@ -215,62 +429,55 @@ echo 'export PATH="$BUN_INSTALL/bin:$PATH"' >> ~/.bashrc
 
 # Verify installation
 ~/.bun/bin/bun --version
-`
+`, install)
 }
 
-func getClaudeCodeInstallScript(version string) string {
-	return `
-set -e
-
-# Ensure npm is available (Claude Code is installed via npm)
-if ! command -v npm &> /dev/null; then
-    echo "Error: npm is required to install claude-code"
-    exit 1
-fi
-
-# Install Claude Code CLI globally (official package from Anthropic)
-npm install -g @anthropic-ai/claude-code
-
-# Verify installation
-claude --version
-
-echo "Claude Code installed successfully"
-`
-}
+// getNPMInstallScript installs a CLI published on npm. With a checksum the
+// package tarball is fetched and verified before it is installed.
+func getNPMInstallScript(displayName, binary, pkg, version, checksum string) string {
+	spec := pkg + "@" + defaultVersion("", version)
+
+	install := fmt.Sprintf("npm install -g %s", spec)
+	if checksum != "" {
+		install = fmt.Sprintf(`cd /tmp
+tarball=$(npm pack %s --silent | tail -n 1)
+%s
+npm install -g "./$tarball"
+rm -f "$tarball"`, spec, verifyChecksum("$tarball", checksum))
+	}
 
-func getAmpcodeInstallScript(version string) string {
-	return `
+	return fmt.Sprintf(`
 set -e
 
-# Ensure npm is available (Ampcode is installed via npm)
+# Ensure npm is available (%s is installed via npm)
 if ! command -v npm &> /dev/null; then
-    echo "Error: npm is required to install ampcode"
+    echo "Error: npm is required to install %s"
     exit 1
 fi
 
-# Install Ampcode CLI globally
-npm install -g @anthropic-ai/amp
+# Install %s CLI globally
+%s
 
 # Verify installation
-amp --version
+%s --version
 
-echo "Ampcode installed successfully"
-`
+echo "%s installed successfully"
+`, displayName, pkg, displayName, install, binary, displayName)
 }
 
-func getGoInstallScript(version string) string {
-	if version == "" || version == "latest" {
-		version = "1.23.0"
-	}
+func getGoInstallScript(version, checksum string) string {
+	version = strings.TrimPrefix(defaultVersion("go", version), "go")
+	archive := fmt.Sprintf("go%s.linux-amd64.tar.gz", version)
 	return fmt.Sprintf(`
 set -e
 
 # Download and install Go
 cd /tmp
-wget https://go.dev/dl/go%s.linux-amd64.tar.gz
+wget https://go.dev/dl/%s
+%s
 rm -rf /usr/local/go
-tar -C /usr/local -xzf go%s.linux-amd64.tar.gz
-rm go%s.linux-amd64.tar.gz
+tar -C /usr/local -xzf %s
+rm %s
 
 # Add to PATH
 export PATH=$PATH:/usr/local/go/bin
@@ -278,13 +485,11 @@ echo 'export PATH=$PATH:/usr/local/go/bin' >> ~/.bashrc
 
 # Verify installation
 /usr/local/go/bin/go version
-`, version, version, version)
+`, archive, verifyChecksum(archive, checksum), archive, archive)
 }
 
 func getPythonInstallScript(version string) string {
-	if version == "" || version == "latest" {
-		version = "3.11"
-	}
+	version = defaultVersion("python", version)
 	return fmt.Sprintf(`
 set -e
 export DEBIAN_FRONTEND=noninteractive
@@ -305,11 +510,11 @@ pip3 --version
 }
 
 func getRustInstallScript(version string) string {
-	return `
+	return fmt.Sprintf(`
 set -e
 
 # Install Rust via rustup
-curl --proto '=https' --tlsv1.2 -sSf https://sh.rustup.rs | sh -s -- -y
+curl --proto '=https' --tlsv1.2 -sSf https://sh.rustup.rs | sh -s -- -y --default-toolchain %s
 
 # Source cargo environment
 source "$HOME/.cargo/env"
@@ -320,7 +525,7 @@ echo 'source "$HOME/.cargo/env"' >> ~/.bashrc
 # Verify installation
 ~/.cargo/bin/cargo --version
 ~/.cargo/bin/rustc --version
-`
+`, defaultVersion("rust", version))
 }
 
 func getGitInstallScript() string {
@@ -374,13 +579,22 @@ func GetDefaultTools() []string {
 
 // InstallToolsWithTimeout installs tools with a timeout
 func (i *Installer) InstallToolsWithTimeout(ctx context.Context, vmID string, tools []string, versions map[string]string, timeout time.Duration) error {
+	releases := make(map[string]Release, len(versions))
+	for tool, version := range versions {
+		releases[tool] = Release{Version: version}
+	}
+	return i.InstallReleasesWithTimeout(ctx, vmID, tools, releases, timeout)
+}
+
+// InstallReleasesWithTimeout installs tools at the given releases with a timeout
+func (i *Installer) InstallReleasesWithTimeout(ctx context.Context, vmID string, tools []string, releases map[string]Release, timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	errChan := make(chan error, 1)
 
 	go func() {
-		errChan <- i.InstallTools(ctx, vmID, tools, versions)
+		errChan <- i.InstallReleases(ctx, vmID, tools, releases)
 	}()
 
 	select {
@@ -390,3 +604,21 @@ func (i *Installer) InstallToolsWithTimeout(ctx context.Context, vmID string, to
 		return fmt.Errorf("tool installation timed out after %v", timeout)
 	}
 }
+
+// EnvironmentTools returns the tools installed in VMs spawned from an
+// environment listing envTools: the default tools, the environment's own
+// tools and claude-code, without duplicates
+func EnvironmentTools(envTools []string) []string {
+	allTools := append(GetDefaultTools(), envTools...)
+	allTools = append(allTools, "claude-code")
+
+	toolSet := make(map[string]bool)
+	uniqueTools := []string{}
+	for _, tool := range allTools {
+		if !toolSet[tool] {
+			toolSet[tool] = true
+			uniqueTools = append(uniqueTools, tool)
+		}
+	}
+	return uniqueTools
+}
@@ -0,0 +1,111 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// Mirrors are host-level caches that tool installs go through. Unset
+// fields leave the VM's default resolver or registry in place.
+type Mirrors struct {
+	DNS     string // Caching resolver address
+	APT     string // HTTP proxy for apt
+	NPM     string // npm registry URL
+	PyPI    string // pip index URL
+	GoProxy string // GOPROXY URL
+}
+
+// IsZero reports whether no mirror is set
+func (m Mirrors) IsZero() bool {
+	return m == Mirrors{}
+}
+
+// SetMirrors makes every later install configure the VM to use mirrors first
+func (i *Installer) SetMirrors(mirrors Mirrors) {
+	i.mirrors = mirrors
+}
+
+// configureMirrors points the VM's resolver and package managers at the
+// mirrors. It is idempotent, so it runs before each batch of installs.
+func (i *Installer) configureMirrors(ctx context.Context, vmID string) error {
+	script := getMirrorScript(i.mirrors)
+	if script == "" {
+		return nil
+	}
+
+	result, err := i.orchestrator.ExecuteCommand(ctx, vmID, &vmm.Command{
+		Cmd:  "bash",
+		Args: []string{"-c", script},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to configure mirrors: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("mirror configuration failed: %s", result.Stderr)
+	}
+
+	log.Printf("Configured package mirrors in VM %s", vmID)
+	return nil
+}
+
+// getMirrorScript returns the script configuring mirrors in a VM, or
+// nothing when no mirror is set
+func getMirrorScript(m Mirrors) string {
+	if m.IsZero() {
+		return ""
+	}
+
+	var script strings.Builder
+	script.WriteString("set -e\nexport HOME=${HOME:-/root}\n")
+
+	// resolv.conf is made immutable when the rootfs is built
+	if m.DNS != "" {
+		fmt.Fprintf(&script, `
+chattr -i /etc/resolv.conf 2>/dev/null || true
+printf 'nameserver %%s\n' %s > /etc/resolv.conf
+chattr +i /etc/resolv.conf 2>/dev/null || true
+`, shellQuote(m.DNS))
+	}
+
+	if m.APT != "" {
+		fmt.Fprintf(&script, `
+mkdir -p /etc/apt/apt.conf.d
+printf 'Acquire::http::Proxy "%%s";\n' %s > /etc/apt/apt.conf.d/01aetherium-mirror
+`, shellQuote(m.APT))
+	}
+
+	if m.NPM != "" {
+		fmt.Fprintf(&script, `
+touch "$HOME/.npmrc"
+sed -i '/^registry=/d' "$HOME/.npmrc"
+printf 'registry=%%s\n' %s >> "$HOME/.npmrc"
+`, shellQuote(m.NPM))
+	}
+
+	if m.PyPI != "" {
+		fmt.Fprintf(&script, `
+printf '[global]\nindex-url = %%s\n' %s > /etc/pip.conf
+`, shellQuote(m.PyPI))
+	}
+
+	// go reads its env file on every invocation, unlike .bashrc
+	if m.GoProxy != "" {
+		fmt.Fprintf(&script, `
+mkdir -p "$HOME/.config/go"
+touch "$HOME/.config/go/env"
+sed -i '/^GOPROXY=/d' "$HOME/.config/go/env"
+printf 'GOPROXY=%%s,direct\n' %s >> "$HOME/.config/go/env"
+`, shellQuote(m.GoProxy))
+	}
+
+	return script.String()
+}
+
+// shellQuote quotes s as a single shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
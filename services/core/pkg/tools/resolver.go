@@ -0,0 +1,369 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Upstream release indexes queried by the Resolver
+const (
+	nodeIndexURL     = "https://nodejs.org/dist/index.json"
+	nodeDistURL      = "https://nodejs.org/dist"
+	goIndexURL       = "https://go.dev/dl/?mode=json&include=all"
+	goDownloadURL    = "https://go.dev/dl"
+	npmRegistryURL   = "https://registry.npmjs.org"
+	bunLatestURL     = "https://api.github.com/repos/oven-sh/bun/releases/latest"
+	bunDownloadURL   = "https://github.com/oven-sh/bun/releases/download"
+	rustStableURL    = "https://static.rust-lang.org/dist/channel-rust-stable.toml"
+	resolverTimeout  = 30 * time.Second
+	resolverMaxBytes = 64 << 20
+)
+
+// Resolver resolves tool versions to exact releases from the tools' upstream
+// release indexes, so they can be pinned in an environment lockfile
+type Resolver struct {
+	client *http.Client
+}
+
+// NewResolver creates a new tool version resolver
+func NewResolver() *Resolver {
+	return &Resolver{
+		client: &http.Client{Timeout: resolverTimeout},
+	}
+}
+
+// Resolve returns the exact release that installing the tool at constraint
+// would get right now. constraint is "latest" (or empty) for the version an
+// unpinned install gets, a version prefix such as "20" or "1.23", or an
+// exact version.
+//
+// Tools installed with the VM's package manager (git, docker, python) can't
+// be resolved outside a VM; they are returned with the constraint as their
+// version and no checksum.
+func (r *Resolver) Resolve(ctx context.Context, tool, constraint string) (*Release, error) {
+	if constraint == "" {
+		constraint = "latest"
+	}
+
+	switch CanonicalTool(tool) {
+	case "nodejs":
+		return r.resolveNodeJS(ctx, defaultVersion("nodejs", constraint))
+	case "go":
+		return r.resolveGo(ctx, defaultVersion("go", constraint))
+	case "claude-code":
+		return r.resolveNPM(ctx, claudeCodePackage, constraint)
+	case "ampcode":
+		return r.resolveNPM(ctx, ampcodePackage, constraint)
+	case "bun":
+		return r.resolveBun(ctx, constraint)
+	case "rust":
+		return r.resolveRust(ctx, constraint)
+	case "python", "git", "docker":
+		return &Release{Version: defaultVersion(CanonicalTool(tool), constraint)}, nil
+	default:
+		return nil, fmt.Errorf("unknown tool: %s", tool)
+	}
+}
+
+func (r *Resolver) resolveNodeJS(ctx context.Context, constraint string) (*Release, error) {
+	var index []struct {
+		Version string `json:"version"`
+	}
+	if err := r.getJSON(ctx, nodeIndexURL, &index); err != nil {
+		return nil, err
+	}
+
+	versions := make([]string, len(index))
+	for i, release := range index {
+		versions[i] = strings.TrimPrefix(release.Version, "v")
+	}
+	version, err := matchVersion("nodejs", versions, strings.TrimPrefix(constraint, "v"))
+	if err != nil {
+		return nil, err
+	}
+
+	archive := fmt.Sprintf("node-v%s-linux-x64.tar.xz", version)
+	sums, err := r.get(ctx, fmt.Sprintf("%s/v%s/SHASUMS256.txt", nodeDistURL, version))
+	if err != nil {
+		return nil, err
+	}
+	digest, err := findChecksum(sums, archive)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Release{
+		Version:  version,
+		Artifact: fmt.Sprintf("%s/v%s/%s", nodeDistURL, version, archive),
+		Checksum: "sha256:" + digest,
+	}, nil
+}
+
+func (r *Resolver) resolveGo(ctx context.Context, constraint string) (*Release, error) {
+	var index []struct {
+		Version string `json:"version"`
+		Stable  bool   `json:"stable"`
+		Files   []struct {
+			Filename string `json:"filename"`
+			OS       string `json:"os"`
+			Arch     string `json:"arch"`
+			Kind     string `json:"kind"`
+			SHA256   string `json:"sha256"`
+		} `json:"files"`
+	}
+	if err := r.getJSON(ctx, goIndexURL, &index); err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, release := range index {
+		if release.Stable {
+			versions = append(versions, strings.TrimPrefix(release.Version, "go"))
+		}
+	}
+	version, err := matchVersion("go", versions, strings.TrimPrefix(constraint, "go"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, release := range index {
+		if release.Version != "go"+version {
+			continue
+		}
+		for _, file := range release.Files {
+			if file.OS == "linux" && file.Arch == "amd64" && file.Kind == "archive" {
+				return &Release{
+					Version:  version,
+					Artifact: fmt.Sprintf("%s/%s", goDownloadURL, file.Filename),
+					Checksum: "sha256:" + file.SHA256,
+				}, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("go %s has no linux-amd64 archive", version)
+}
+
+func (r *Resolver) resolveNPM(ctx context.Context, pkg, constraint string) (*Release, error) {
+	var metadata struct {
+		DistTags map[string]string `json:"dist-tags"`
+		Versions map[string]struct {
+			Dist struct {
+				Tarball   string `json:"tarball"`
+				Integrity string `json:"integrity"`
+			} `json:"dist"`
+		} `json:"versions"`
+	}
+	if err := r.getJSON(ctx, npmRegistryURL+"/"+url.PathEscape(pkg), &metadata); err != nil {
+		return nil, err
+	}
+
+	// Dist tags ("latest", "next", ...) first, then version numbers
+	version, ok := metadata.DistTags[constraint]
+	if !ok {
+		versions := make([]string, 0, len(metadata.Versions))
+		for v := range metadata.Versions {
+			versions = append(versions, v)
+		}
+		var err error
+		if version, err = matchVersion(pkg, versions, constraint); err != nil {
+			return nil, err
+		}
+	}
+
+	release, ok := metadata.Versions[version]
+	if !ok {
+		return nil, fmt.Errorf("%s has no version %s", pkg, version)
+	}
+
+	// Integrity is "sha512-<base64 digest>"; sha512sum prints hex
+	checksum := ""
+	if algorithm, digest, ok := strings.Cut(release.Dist.Integrity, "-"); ok {
+		if raw, err := base64.StdEncoding.DecodeString(digest); err == nil {
+			checksum = algorithm + ":" + hex.EncodeToString(raw)
+		}
+	}
+
+	return &Release{
+		Version:  version,
+		Artifact: release.Dist.Tarball,
+		Checksum: checksum,
+	}, nil
+}
+
+func (r *Resolver) resolveBun(ctx context.Context, constraint string) (*Release, error) {
+	version := strings.TrimPrefix(strings.TrimPrefix(constraint, "bun-"), "v")
+	if constraint == "latest" {
+		var latest struct {
+			TagName string `json:"tag_name"`
+		}
+		if err := r.getJSON(ctx, bunLatestURL, &latest); err != nil {
+			return nil, err
+		}
+		version = strings.TrimPrefix(latest.TagName, "bun-v")
+	} else if strings.Count(version, ".") != 2 {
+		return nil, fmt.Errorf("bun versions must be exact (e.g. 1.1.30) or latest, got %q", constraint)
+	}
+
+	sums, err := r.get(ctx, fmt.Sprintf("%s/bun-v%s/SHASUMS256.txt", bunDownloadURL, version))
+	if err != nil {
+		return nil, err
+	}
+	digest, err := findChecksum(sums, "bun-linux-x64.zip")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Release{
+		Version:  version,
+		Artifact: fmt.Sprintf("%s/bun-v%s/bun-linux-x64.zip", bunDownloadURL, version),
+		Checksum: "sha256:" + digest,
+	}, nil
+}
+
+// resolveRust resolves the stable toolchain's version. rustup verifies the
+// toolchains it downloads itself, so no checksum is recorded.
+func (r *Resolver) resolveRust(ctx context.Context, constraint string) (*Release, error) {
+	if constraint != "latest" && constraint != "stable" {
+		if strings.Count(constraint, ".") != 2 {
+			return nil, fmt.Errorf("rust versions must be exact (e.g. 1.82.0) or stable, got %q", constraint)
+		}
+		return &Release{Version: constraint}, nil
+	}
+
+	manifest, err := r.get(ctx, rustStableURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// The release's version is the first version line after [pkg.rust]
+	scanner := bufio.NewScanner(strings.NewReader(manifest))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	inRust := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inRust = line == "[pkg.rust]"
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "version = "); ok && inRust {
+			fields := strings.Fields(strings.Trim(value, `"`))
+			if len(fields) > 0 {
+				return &Release{Version: fields[0]}, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("rust stable manifest has no version")
+}
+
+func (r *Resolver) get(ctx context.Context, rawURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch %s: %s", rawURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, resolverMaxBytes))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", rawURL, err)
+	}
+	return string(body), nil
+}
+
+func (r *Resolver) getJSON(ctx context.Context, rawURL string, v interface{}) error {
+	body, err := r.get(ctx, rawURL)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(body), v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", rawURL, err)
+	}
+	return nil
+}
+
+// findChecksum finds a file's digest in a SHASUMS256.txt listing
+func findChecksum(sums, file string) (string, error) {
+	for _, line := range strings.Split(sums, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == file {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no checksum published for %s", file)
+}
+
+// matchVersion returns the newest release version equal to constraint or
+// within it ("1.23" matches 1.23.4). Pre-releases only match exactly.
+func matchVersion(tool string, versions []string, constraint string) (string, error) {
+	best := ""
+	for _, v := range versions {
+		if v == constraint {
+			return v, nil
+		}
+		if constraint != "latest" && !strings.HasPrefix(v, constraint+".") {
+			continue
+		}
+		if !isRelease(v) {
+			continue
+		}
+		if best == "" || compareVersions(v, best) > 0 {
+			best = v
+		}
+	}
+
+	if best == "" {
+		return "", fmt.Errorf("no %s release matches %q", tool, constraint)
+	}
+	return best, nil
+}
+
+// isRelease reports whether v is a plain dotted version number
+func isRelease(v string) bool {
+	for _, part := range strings.Split(v, ".") {
+		if _, err := strconv.Atoi(part); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// compareVersions compares dotted version numbers
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
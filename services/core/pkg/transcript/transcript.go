@@ -0,0 +1,214 @@
+// Package transcript hash-chains execution and prompt records so the history
+// of what ran in VMs and workspaces is tamper-evident. Each record gets a
+// content hash; each chain entry hashes its position, the record's content
+// hash and the previous entry's hash. Editing a record changes its content
+// hash, and editing, removing or reordering entries breaks the links after
+// them. Anchors, copies of the chain's head kept elsewhere, catch a chain
+// rewritten from scratch.
+package transcript
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// GenesisHash is the previous hash of the first entry
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+// executionContent is what an execution's content hash covers. Env and
+// metadata are left out: env may hold secrets, and metadata is annotated
+// after the command ran.
+type executionContent struct {
+	ID          string          `json:"id"`
+	JobID       string          `json:"job_id"`
+	TaskID      string          `json:"task_id"`
+	VMID        string          `json:"vm_id"`
+	Command     string          `json:"command"`
+	Args        json.RawMessage `json:"args"`
+	ExitCode    *int            `json:"exit_code"`
+	Stdout      string          `json:"stdout"`
+	Stderr      string          `json:"stderr"`
+	Error       string          `json:"error"`
+	StartedAt   string          `json:"started_at"`
+	CompletedAt string          `json:"completed_at"`
+	DurationMS  *int            `json:"duration_ms"`
+}
+
+// promptContent is what a finished prompt's content hash covers: what was
+// asked, where, and what came of it
+type promptContent struct {
+	ID               string `json:"id"`
+	WorkspaceID      string `json:"workspace_id"`
+	Prompt           string `json:"prompt"`
+	SystemPrompt     string `json:"system_prompt"`
+	WorkingDirectory string `json:"working_directory"`
+	Attempt          int    `json:"attempt"`
+	Status           string `json:"status"`
+	ExitCode         *int   `json:"exit_code"`
+	Stdout           string `json:"stdout"`
+	Stderr           string `json:"stderr"`
+	Error            string `json:"error"`
+	FailureReason    string `json:"failure_reason"`
+	StartedAt        string `json:"started_at"`
+	CompletedAt      string `json:"completed_at"`
+	DurationMS       *int   `json:"duration_ms"`
+}
+
+// ExecutionHash returns the content hash of an execution as stored
+func ExecutionHash(e *storage.Execution) (string, error) {
+	args, err := json.Marshal(e.Args)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode execution args: %w", err)
+	}
+	return contentHash(executionContent{
+		ID:          e.ID.String(),
+		JobID:       uuidString(e.JobID),
+		TaskID:      uuidString(e.TaskID),
+		VMID:        uuidString(e.VMID),
+		Command:     e.Command,
+		Args:        args,
+		ExitCode:    e.ExitCode,
+		Stdout:      deref(e.Stdout),
+		Stderr:      deref(e.Stderr),
+		Error:       deref(e.Error),
+		StartedAt:   timestamp(e.StartedAt),
+		CompletedAt: timestampPtr(e.CompletedAt),
+		DurationMS:  e.DurationMS,
+	})
+}
+
+// PromptHash returns the content hash of a prompt as stored
+func PromptHash(p *storage.PromptTask) (string, error) {
+	return contentHash(promptContent{
+		ID:               p.ID.String(),
+		WorkspaceID:      p.WorkspaceID.String(),
+		Prompt:           p.Prompt,
+		SystemPrompt:     deref(p.SystemPrompt),
+		WorkingDirectory: deref(p.WorkingDirectory),
+		Attempt:          p.Attempt,
+		Status:           p.Status,
+		ExitCode:         p.ExitCode,
+		Stdout:           deref(p.Stdout),
+		Stderr:           deref(p.Stderr),
+		Error:            deref(p.Error),
+		FailureReason:    deref(p.FailureReason),
+		StartedAt:        timestampPtr(p.StartedAt),
+		CompletedAt:      timestampPtr(p.CompletedAt),
+		DurationMS:       p.DurationMS,
+	})
+}
+
+func contentHash(content interface{}) (string, error) {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode record: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Link returns an entry's hash from its position, record, content hash,
+// previous hash and creation time
+func Link(entry *storage.TranscriptEntry) string {
+	h := sha256.New()
+	for _, field := range []string{
+		strconv.FormatInt(entry.Seq, 10),
+		entry.Kind,
+		entry.RecordID.String(),
+		entry.ContentHash,
+		entry.PrevHash,
+		timestamp(entry.CreatedAt),
+	} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Seal makes entry the one after prev (nil for the first entry), setting
+// its sequence number, previous hash and hash. CreatedAt is rounded to what
+// the database keeps.
+func Seal(entry *storage.TranscriptEntry, prev *storage.TranscriptEntry) {
+	entry.Seq, entry.PrevHash = 1, GenesisHash
+	if prev != nil {
+		entry.Seq, entry.PrevHash = prev.Seq+1, prev.Hash
+	}
+	entry.CreatedAt = entry.CreatedAt.UTC().Truncate(time.Microsecond)
+	entry.Hash = Link(entry)
+}
+
+// Break is where a chain stops verifying
+type Break struct {
+	Seq    int64  `json:"seq"`
+	Reason string `json:"reason"`
+}
+
+func (b *Break) Error() string {
+	return fmt.Sprintf("transcript chain broken at entry %d: %s", b.Seq, b.Reason)
+}
+
+// Verifier checks a chain's entries one at a time, in order, from the first
+type Verifier struct {
+	prev *storage.TranscriptEntry
+}
+
+// Next checks that entry follows the entries checked so far and that its
+// hash is intact, returning a *Break if not
+func (v *Verifier) Next(entry *storage.TranscriptEntry) error {
+	wantSeq, wantPrev := int64(1), GenesisHash
+	if v.prev != nil {
+		wantSeq, wantPrev = v.prev.Seq+1, v.prev.Hash
+	}
+
+	switch {
+	case entry.Seq != wantSeq:
+		return &Break{Seq: wantSeq, Reason: fmt.Sprintf("expected entry %d, found %d", wantSeq, entry.Seq)}
+	case entry.PrevHash != wantPrev:
+		return &Break{Seq: entry.Seq, Reason: "previous hash does not match the previous entry"}
+	case entry.Hash != Link(entry):
+		return &Break{Seq: entry.Seq, Reason: "hash does not match the entry"}
+	}
+
+	v.prev = entry
+	return nil
+}
+
+// Head returns the last entry checked, or nil before the first
+func (v *Verifier) Head() *storage.TranscriptEntry {
+	return v.prev
+}
+
+// timestamp formats a time the way the database returns it, in UTC with
+// microseconds
+func timestamp(t time.Time) string {
+	return t.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano)
+}
+
+func timestampPtr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return timestamp(*t)
+}
+
+func uuidString(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
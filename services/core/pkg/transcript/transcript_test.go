@@ -0,0 +1,143 @@
+package transcript
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// buildChain seals n entries into a chain
+func buildChain(n int) []*storage.TranscriptEntry {
+	var chain []*storage.TranscriptEntry
+	var prev *storage.TranscriptEntry
+	for i := 0; i < n; i++ {
+		entry := &storage.TranscriptEntry{
+			Kind:        storage.TranscriptKindExecution,
+			RecordID:    uuid.New(),
+			ContentHash: GenesisHash,
+			CreatedAt:   time.Now(),
+		}
+		Seal(entry, prev)
+		chain = append(chain, entry)
+		prev = entry
+	}
+	return chain
+}
+
+// verify runs a chain through a Verifier, returning the first break
+func verify(chain []*storage.TranscriptEntry) *Break {
+	var v Verifier
+	for _, entry := range chain {
+		if err := v.Next(entry); err != nil {
+			var b *Break
+			if !errors.As(err, &b) {
+				panic(err)
+			}
+			return b
+		}
+	}
+	return nil
+}
+
+// TestVerifyIntactChain tests that a sealed chain verifies
+func TestVerifyIntactChain(t *testing.T) {
+	chain := buildChain(5)
+	if b := verify(chain); b != nil {
+		t.Fatalf("Expected the chain to verify, broke at %d: %s", b.Seq, b.Reason)
+	}
+	if chain[0].Seq != 1 || chain[0].PrevHash != GenesisHash {
+		t.Errorf("Expected the first entry to follow the genesis hash, got seq %d prev %s", chain[0].Seq, chain[0].PrevHash)
+	}
+	if chain[4].Seq != 5 || chain[4].PrevHash != chain[3].Hash {
+		t.Errorf("Expected entry 5 to follow entry 4")
+	}
+}
+
+// TestVerifyTamperedChain tests that edits, removals and reordering break
+// the chain at the right entry
+func TestVerifyTamperedChain(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(chain []*storage.TranscriptEntry) []*storage.TranscriptEntry
+		wantSeq int64
+	}{
+		{"content edited", func(c []*storage.TranscriptEntry) []*storage.TranscriptEntry {
+			c[2].ContentHash = "edited"
+			return c
+		}, 3},
+		{"record swapped", func(c []*storage.TranscriptEntry) []*storage.TranscriptEntry {
+			c[1].RecordID = uuid.New()
+			return c
+		}, 2},
+		{"entry removed", func(c []*storage.TranscriptEntry) []*storage.TranscriptEntry {
+			return append(c[:2], c[3:]...)
+		}, 3},
+		{"entries reordered", func(c []*storage.TranscriptEntry) []*storage.TranscriptEntry {
+			c[1], c[2] = c[2], c[1]
+			return c
+		}, 2},
+		{"entry resealed", func(c []*storage.TranscriptEntry) []*storage.TranscriptEntry {
+			// Rehashing an edited entry still breaks the link to the next
+			c[1].ContentHash = "edited"
+			Seal(c[1], c[0])
+			return c
+		}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := verify(tt.tamper(buildChain(5)))
+			if b == nil {
+				t.Fatalf("Expected the chain to break")
+			}
+			if b.Seq != tt.wantSeq {
+				t.Errorf("Expected the break at entry %d, got %d (%s)", tt.wantSeq, b.Seq, b.Reason)
+			}
+		})
+	}
+}
+
+// TestContentHash tests that content hashes ignore what the database doesn't
+// keep and change with what the record says
+func TestContentHash(t *testing.T) {
+	started := time.Date(2025, 1, 15, 10, 30, 0, 123456789, time.FixedZone("CET", 3600))
+	stdout := "hello\n"
+	exitCode := 0
+	execution := &storage.Execution{
+		ID:        uuid.New(),
+		Command:   "echo",
+		Args:      storage.JSONBArray{"hello"},
+		ExitCode:  &exitCode,
+		Stdout:    &stdout,
+		StartedAt: started,
+	}
+
+	hash, err := ExecutionHash(execution)
+	if err != nil {
+		t.Fatalf("ExecutionHash failed: %v", err)
+	}
+
+	// As read back from the database: UTC, microseconds, new metadata
+	stored := *execution
+	stored.StartedAt = started.UTC().Truncate(time.Microsecond)
+	stored.Metadata = storage.JSONB{"annotated": true}
+	if got, _ := ExecutionHash(&stored); got != hash {
+		t.Errorf("Expected the stored execution to hash the same")
+	}
+
+	edited := stdout + "and more\n"
+	stored.Stdout = &edited
+	if got, _ := ExecutionHash(&stored); got == hash {
+		t.Errorf("Expected edited output to change the hash")
+	}
+
+	prompt := &storage.PromptTask{ID: uuid.New(), WorkspaceID: uuid.New(), Prompt: "fix the tests", Status: "completed"}
+	promptHash, _ := PromptHash(prompt)
+	prompt.Prompt = "delete the tests"
+	if got, _ := PromptHash(prompt); got == promptHash {
+		t.Errorf("Expected an edited prompt to change the hash")
+	}
+}
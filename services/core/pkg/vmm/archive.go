@@ -0,0 +1,21 @@
+package vmm
+
+import (
+	"context"
+	"io"
+)
+
+// DirectoryCopier is implemented by orchestrators that can copy directories
+// out of and into their VMs as gzipped tar streams. ArchiveDir streams a
+// directory's contents; ExtractDir unpacks an archive into a directory,
+// creating it if needed, and returns the number of files written. Used to
+// clone workspaces with their working tree.
+type DirectoryCopier interface {
+	ArchiveDir(ctx context.Context, vmID, dir string) (io.ReadCloser, error)
+	ExtractDir(ctx context.Context, vmID, dir string, archive io.Reader) (int, error)
+}
+
+// ArchiveRequest names the directory an archive is read from or extracted to
+type ArchiveRequest struct {
+	Dir string `json:"dir"`
+}
@@ -0,0 +1,65 @@
+package vmm
+
+import (
+	"strconv"
+	"strings"
+)
+
+// VMConfig metadata keys used to request a Docker daemon in a VM from an orchestrator
+const (
+	MetadataDockerEnabled    = "docker.enabled"
+	MetadataDockerDiskSizeMB = "docker.disk_size_mb"
+	MetadataDockerRegistries = "docker.registries"
+)
+
+// Minimum VM size for running dockerd next to the workspace's own processes
+const (
+	DockerMinVCPUs    = 2
+	DockerMinMemoryMB = 2048
+)
+
+// DockerHubDomains are the endpoints image pulls from Docker Hub go through.
+// The proxy matches subdomains, so docker.io covers registry-1 and auth.
+var DockerHubDomains = []string{
+	"docker.io",
+	"production.cloudflare.docker.com",
+}
+
+// DockerProfile describes the Docker daemon run in a VM
+type DockerProfile struct {
+	// DiskSizeMB is the size the VM's rootfs is grown to (0 = unchanged)
+	DiskSizeMB int
+	// Registries are whitelisted in the egress proxy next to Docker Hub
+	Registries []string
+}
+
+// ApplyToMetadata writes the profile into VMConfig metadata
+func (p *DockerProfile) ApplyToMetadata(metadata map[string]string) {
+	metadata[MetadataDockerEnabled] = "true"
+	if p.DiskSizeMB > 0 {
+		metadata[MetadataDockerDiskSizeMB] = strconv.Itoa(p.DiskSizeMB)
+	}
+	if len(p.Registries) > 0 {
+		metadata[MetadataDockerRegistries] = strings.Join(p.Registries, ",")
+	}
+}
+
+// Domains returns the registry domains the VM's daemon pulls images from
+func (p *DockerProfile) Domains() []string {
+	return append(append([]string{}, DockerHubDomains...), p.Registries...)
+}
+
+// DockerFromMetadata reads a Docker profile from VMConfig metadata
+// Returns nil if the VM doesn't run Docker
+func DockerFromMetadata(metadata map[string]string) *DockerProfile {
+	if metadata[MetadataDockerEnabled] != "true" {
+		return nil
+	}
+
+	p := &DockerProfile{}
+	p.DiskSizeMB, _ = strconv.Atoi(metadata[MetadataDockerDiskSizeMB])
+	if registries := metadata[MetadataDockerRegistries]; registries != "" {
+		p.Registries = strings.Split(registries, ",")
+	}
+	return p
+}
@@ -22,11 +22,18 @@ type DockerOrchestrator struct {
 type Config struct {
 	Network string
 	Image   string
+
+	// Windows allows Windows guests, for workers whose daemon runs Windows
+	// containers (the docker-windows capability)
+	Windows        bool
+	WindowsImage   string
+	WindowsNetwork string
 }
 
 type vmHandle struct {
 	containerID string
 	vm          *types.VM
+	platform    string // vmm.PlatformLinux or vmm.PlatformWindows
 }
 
 // NewDockerOrchestrator creates a new Docker-based orchestrator
@@ -34,6 +41,10 @@ func NewDockerOrchestrator(configMap map[string]interface{}) (*DockerOrchestrato
 	config := &Config{
 		Network: getStringOrDefault(configMap, "network", "bridge"),
 		Image:   getStringOrDefault(configMap, "image", "ubuntu:22.04"),
+
+		Windows:        configMap["windows"] == true,
+		WindowsImage:   getStringOrDefault(configMap, "windows_image", defaultWindowsImage),
+		WindowsNetwork: getStringOrDefault(configMap, "windows_network", defaultWindowsNetwork),
 	}
 
 	return &DockerOrchestrator{
@@ -45,12 +56,30 @@ func NewDockerOrchestrator(configMap map[string]interface{}) (*DockerOrchestrato
 // CreateVM creates a new Docker container
 func (d *DockerOrchestrator) CreateVM(ctx context.Context, config *types.VMConfig) (*types.VM, error) {
 	// Use docker run with sleep infinity to keep container alive
-	cmd := exec.CommandContext(ctx, "docker", "run",
-		"-d",                     // Detached
-		"--name", config.ID,      // Container name
-		"--network", d.config.Network,
-		d.config.Image,
-		"sleep", "infinity") // Keep alive
+	args := []string{"run",
+		"-d",                // Detached
+		"--name", config.ID, // Container name
+	}
+	platform := vmm.PlatformFromMetadata(config.Metadata)
+	sandbox := vmm.SandboxFromMetadata(config.Metadata)
+	if platform == vmm.PlatformWindows {
+		if !d.config.Windows {
+			return nil, fmt.Errorf("windows guests need a worker with the %s capability", vmm.CapabilityDockerWindows)
+		}
+		args = append(args, "--platform", vmm.PlatformWindows)
+		args = append(args, windowsSandboxArgs(sandbox, d.config.WindowsNetwork)...)
+		args = append(args, d.config.WindowsImage)
+		args = append(args, windowsKeepAlive...)
+	} else {
+		sandboxFlags, err := sandboxArgs(sandbox, d.config.Network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sandbox profile: %w", err)
+		}
+		args = append(args, sandboxFlags...)
+		args = append(args, d.config.Image, "sleep", "infinity") // Keep alive
+	}
+
+	cmd := exec.CommandContext(ctx, "docker", args...)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -69,6 +98,7 @@ func (d *DockerOrchestrator) CreateVM(ctx context.Context, config *types.VMConfi
 	d.vms[config.ID] = &vmHandle{
 		containerID: containerID,
 		vm:          vm,
+		platform:    platform,
 	}
 
 	return vm, nil
@@ -82,7 +112,12 @@ func (d *DockerOrchestrator) StartVM(ctx context.Context, vmID string) error {
 	}
 
 	// Container is already running, just update status
-	handle.vm.Status = types.VMStatusRunning
+	if err := handle.vm.Transition(types.VMStatusStarting); err != nil {
+		return err
+	}
+	if err := handle.vm.Transition(types.VMStatusRunning); err != nil {
+		return err
+	}
 	now := time.Now()
 	handle.vm.StartedAt = &now
 
@@ -96,6 +131,10 @@ func (d *DockerOrchestrator) StopVM(ctx context.Context, vmID string, force bool
 		return fmt.Errorf("VM %s not found", vmID)
 	}
 
+	if err := handle.vm.Transition(types.VMStatusStopping); err != nil {
+		return err
+	}
+
 	var cmd *exec.Cmd
 	if force {
 		cmd = exec.CommandContext(ctx, "docker", "kill", handle.containerID)
@@ -104,16 +143,57 @@ func (d *DockerOrchestrator) StopVM(ctx context.Context, vmID string, force bool
 	}
 
 	if err := cmd.Run(); err != nil {
+		handle.vm.Transition(types.VMStatusFailed)
 		return fmt.Errorf("failed to stop container: %w", err)
 	}
 
-	handle.vm.Status = types.VMStatusStopped
+	if err := handle.vm.Transition(types.VMStatusStopped); err != nil {
+		return err
+	}
 	now := time.Now()
 	handle.vm.StoppedAt = &now
 
 	return nil
 }
 
+// PauseVM freezes a container's processes. Unlike Firecracker, their
+// memory stays resident until the container is unpaused.
+func (d *DockerOrchestrator) PauseVM(ctx context.Context, vmID string) error {
+	handle, exists := d.vms[vmID]
+	if !exists {
+		return fmt.Errorf("VM %s not found", vmID)
+	}
+
+	if err := handle.vm.Status.TransitionTo(types.VMStatusPaused); err != nil {
+		return fmt.Errorf("VM %s: %w", vmID, err)
+	}
+	if output, err := exec.CommandContext(ctx, "docker", "pause", handle.containerID).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to pause container: %w, output: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return handle.vm.Transition(types.VMStatusPaused)
+}
+
+// ResumeVM unfreezes a paused container
+func (d *DockerOrchestrator) ResumeVM(ctx context.Context, vmID string) error {
+	handle, exists := d.vms[vmID]
+	if !exists {
+		return fmt.Errorf("VM %s not found", vmID)
+	}
+
+	if handle.vm.Status != types.VMStatusPaused {
+		return fmt.Errorf("VM %s is %s, only paused VMs can be resumed", vmID, handle.vm.Status)
+	}
+	if output, err := exec.CommandContext(ctx, "docker", "unpause", handle.containerID).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to unpause container: %w, output: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	if err := handle.vm.Transition(types.VMStatusStarting); err != nil {
+		return err
+	}
+	return handle.vm.Transition(types.VMStatusRunning)
+}
+
 // GetVMStatus returns the current status of a VM
 func (d *DockerOrchestrator) GetVMStatus(ctx context.Context, vmID string) (*types.VM, error) {
 	handle, exists := d.vms[vmID]
@@ -128,14 +208,23 @@ func (d *DockerOrchestrator) GetVMStatus(ctx context.Context, vmID string) (*typ
 		return nil, fmt.Errorf("failed to get container status: %w", err)
 	}
 
+	// Reflect the container's actual state; this is observed, not a transition
 	status := strings.TrimSpace(string(output))
 	switch status {
+	case "created":
+		handle.vm.Status = types.VMStatusCreated
+	case "restarting":
+		handle.vm.Status = types.VMStatusStarting
 	case "running":
 		handle.vm.Status = types.VMStatusRunning
+	case "paused":
+		handle.vm.Status = types.VMStatusPaused
+	case "removing":
+		handle.vm.Status = types.VMStatusStopping
 	case "exited":
 		handle.vm.Status = types.VMStatusStopped
 	default:
-		handle.vm.Status = types.VMStatus(strings.ToUpper(status))
+		handle.vm.Status = types.VMStatusFailed
 	}
 
 	return handle.vm, nil
@@ -204,14 +293,19 @@ func (d *DockerOrchestrator) StreamLogs(ctx context.Context, vmID string) (<-cha
 
 // ExecuteCommand executes a command in a Docker container
 func (d *DockerOrchestrator) ExecuteCommand(ctx context.Context, vmID string, cmd *vmm.Command) (*vmm.ExecResult, error) {
-	_, exists := d.vms[vmID]
+	handle, exists := d.vms[vmID]
 	if !exists {
 		return nil, fmt.Errorf("VM %s not found", vmID)
 	}
 
 	// Build docker exec command - use VM ID (container name) instead of container ID
-	args := []string{"exec", vmID, cmd.Cmd}
-	args = append(args, cmd.Args...)
+	args := []string{"exec", vmID}
+	if handle.platform == vmm.PlatformWindows {
+		args = append(args, windowsCommand(cmd)...)
+	} else {
+		args = append(args, cmd.Cmd)
+		args = append(args, cmd.Args...)
+	}
 
 	execCmd := exec.CommandContext(ctx, "docker", args...)
 
@@ -236,6 +330,52 @@ func (d *DockerOrchestrator) ExecuteCommand(ctx context.Context, vmID string, cm
 	}, nil
 }
 
+// RunContainer runs a command in a new container of image and removes the
+// container when the command exits
+func (d *DockerOrchestrator) RunContainer(ctx context.Context, image string, cmd *vmm.Command, sandbox *vmm.SandboxProfile) (*vmm.ExecResult, error) {
+	if err := vmm.ValidateImage(image); err != nil {
+		return nil, err
+	}
+	sandboxFlags, err := sandboxArgs(sandbox, d.config.Network)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sandbox profile: %w", err)
+	}
+	args := []string{"run", "--rm"}
+	args = append(args, sandboxFlags...)
+	for key, value := range cmd.Env {
+		args = append(args, "-e", key+"="+value)
+	}
+	// End of docker's flags, so the image is never read as one
+	args = append(args, "--", image, cmd.Cmd)
+	args = append(args, cmd.Args...)
+
+	runCmd := exec.CommandContext(ctx, "docker", args...)
+
+	var stdout, stderr bytes.Buffer
+	runCmd.Stdout = &stdout
+	runCmd.Stderr = &stderr
+
+	err = runCmd.Run()
+	exitCode := 0
+	if err != nil {
+		exitError, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, fmt.Errorf("failed to run container: %w", err)
+		}
+		// docker run exits 125 when the container couldn't be created (bad image, pull failure)
+		if exitError.ExitCode() == 125 {
+			return nil, fmt.Errorf("failed to run container: %s", strings.TrimSpace(stderr.String()))
+		}
+		exitCode = exitError.ExitCode()
+	}
+
+	return &vmm.ExecResult{
+		ExitCode: exitCode,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+	}, nil
+}
+
 // Health returns the health status of the orchestrator
 func (d *DockerOrchestrator) Health(ctx context.Context) error {
 	cmd := exec.CommandContext(ctx, "docker", "info")
@@ -245,6 +385,39 @@ func (d *DockerOrchestrator) Health(ctx context.Context) error {
 	return nil
 }
 
+// sandboxArgs maps a sandbox profile onto docker run flags
+func sandboxArgs(sandbox *vmm.SandboxProfile, network string) ([]string, error) {
+	if sandbox == nil {
+		return []string{"--network", network}, nil
+	}
+	// A bad workdir would add --tmpfs options of its own
+	if err := sandbox.Validate(); err != nil {
+		return nil, err
+	}
+
+	var args []string
+	if sandbox.NoNetwork {
+		args = append(args, "--network", "none")
+	} else {
+		args = append(args, "--network", network)
+	}
+	if sandbox.ReadOnlyRootFS {
+		args = append(args, "--read-only", "--tmpfs", "/tmp")
+	}
+	if sandbox.TmpfsWorkdir != "" {
+		opts := sandbox.TmpfsWorkdir
+		if sandbox.TmpfsSizeMB > 0 {
+			opts += fmt.Sprintf(":size=%dm", sandbox.TmpfsSizeMB)
+		}
+		args = append(args, "--tmpfs", opts)
+	}
+	if sandbox.RestrictProc {
+		// Docker already masks sensitive /proc paths; also block privilege escalation
+		args = append(args, "--security-opt", "no-new-privileges")
+	}
+	return args, nil
+}
+
 func getStringOrDefault(m map[string]interface{}, key, defaultVal string) string {
 	if val, ok := m[key].(string); ok {
 		return val
@@ -252,5 +425,18 @@ func getStringOrDefault(m map[string]interface{}, key, defaultVal string) string
 	return defaultVal
 }
 
-// Ensure DockerOrchestrator implements vmm.VMOrchestrator
-var _ vmm.VMOrchestrator = (*DockerOrchestrator)(nil)
+func init() {
+	vmm.Register("docker", func(config map[string]interface{}) (vmm.VMOrchestrator, error) {
+		orchestrator, err := NewDockerOrchestrator(config)
+		if err != nil {
+			return nil, err
+		}
+		return orchestrator, nil
+	})
+}
+
+// Ensure DockerOrchestrator implements vmm.VMOrchestrator and vmm.ContainerRunner
+var (
+	_ vmm.VMOrchestrator  = (*DockerOrchestrator)(nil)
+	_ vmm.ContainerRunner = (*DockerOrchestrator)(nil)
+)
@@ -0,0 +1,26 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// TestSandboxArgs tests the docker flags for a sandbox profile, and that
+// tmpfs workdirs which would add mount options of their own are rejected
+func TestSandboxArgs(t *testing.T) {
+	args, err := sandboxArgs(&vmm.SandboxProfile{TmpfsWorkdir: "/workspace", TmpfsSizeMB: 256}, "bridge")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, want := strings.Join(args, " "), "--network bridge --tmpfs /workspace:size=256m"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	for _, dir := range []string{"/w:exec", "/w,exec", "/w size=1g", "relative", "/w/../x"} {
+		if _, err := sandboxArgs(&vmm.SandboxProfile{TmpfsWorkdir: dir}, "bridge"); err == nil {
+			t.Errorf("Expected tmpfs workdir %q to be rejected", dir)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package docker
+
+import (
+	"path"
+	"strings"
+
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// Defaults for Windows guests. Windows containers attach to the nat network
+// rather than bridge, and Server Core ships PowerShell.
+const (
+	defaultWindowsImage   = "mcr.microsoft.com/windows/servercore:ltsc2022"
+	defaultWindowsNetwork = "nat"
+)
+
+// windowsKeepAlive keeps a Windows container running, like sleep infinity
+var windowsKeepAlive = []string{"powershell", "-NoProfile", "-Command", "while ($true) { Start-Sleep -Seconds 3600 }"}
+
+// windowsCommand shims a command written for Linux guests to run in a
+// Windows container. Shell scripts ("sh -c" or "bash -c") run as PowerShell
+// scripts, anything else through PowerShell's call operator so aliases such
+// as ls and cat resolve, with absolute paths translated (see windowsPath).
+// PowerShell and cmd invocations are left as they are.
+func windowsCommand(cmd *vmm.Command) []string {
+	switch strings.TrimSuffix(strings.ToLower(path.Base(cmd.Cmd)), ".exe") {
+	case "powershell", "pwsh", "cmd":
+		return append([]string{cmd.Cmd}, cmd.Args...)
+	case "sh", "bash":
+		if len(cmd.Args) == 2 && (cmd.Args[0] == "-c" || cmd.Args[0] == "-lc") {
+			return powershellCommand(cmd.Args[1])
+		}
+	}
+
+	script := "& " + powershellQuote(windowsPath(cmd.Cmd))
+	for _, arg := range cmd.Args {
+		script += " " + powershellQuote(windowsPath(arg))
+	}
+	// Native commands' exit codes are otherwise collapsed to 0 or 1
+	return powershellCommand(script + "; exit $LASTEXITCODE")
+}
+
+// powershellCommand runs a PowerShell script
+func powershellCommand(script string) []string {
+	return []string{"powershell", "-NoProfile", "-NonInteractive", "-Command", script}
+}
+
+// powershellQuote quotes s as a literal PowerShell string
+func powershellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// windowsPath translates an absolute POSIX path to the same path on drive
+// C:, e.g. /workspace/src to C:\workspace\src. Other strings are returned
+// as they are, including Windows switches such as /s or /ad.
+func windowsPath(p string) string {
+	if p == "/" {
+		return `C:\`
+	}
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.ContainsAny(p, " \t") {
+		return p
+	}
+	if first, _, _ := strings.Cut(p[1:], "/"); len(first) <= 2 {
+		return p
+	}
+	return "C:" + strings.ReplaceAll(p, "/", `\`)
+}
+
+// windowsSandboxArgs maps a sandbox profile onto docker run flags for a
+// Windows container. Read-only roots, tmpfs mounts and no-new-privileges
+// are Linux features, so only network isolation applies.
+func windowsSandboxArgs(sandbox *vmm.SandboxProfile, network string) []string {
+	if sandbox != nil && sandbox.NoNetwork {
+		return []string{"--network", "none"}
+	}
+	return []string{"--network", network}
+}
@@ -0,0 +1,58 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// TestWindowsCommand tests shimming Linux commands to PowerShell
+func TestWindowsCommand(t *testing.T) {
+	tests := []struct {
+		cmd  *vmm.Command
+		want []string
+	}{
+		{
+			&vmm.Command{Cmd: "bash", Args: []string{"-c", "echo hi"}},
+			[]string{"powershell", "-NoProfile", "-NonInteractive", "-Command", "echo hi"},
+		},
+		{
+			&vmm.Command{Cmd: "git", Args: []string{"clone", "https://github.com/org/repo", "/workspace"}},
+			[]string{"powershell", "-NoProfile", "-NonInteractive", "-Command",
+				`& 'git' 'clone' 'https://github.com/org/repo' 'C:\workspace'; exit $LASTEXITCODE`},
+		},
+		{
+			&vmm.Command{Cmd: "echo", Args: []string{"it's"}},
+			[]string{"powershell", "-NoProfile", "-NonInteractive", "-Command", `& 'echo' 'it''s'; exit $LASTEXITCODE`},
+		},
+		{
+			&vmm.Command{Cmd: "cmd.exe", Args: []string{"/c", "dir"}},
+			[]string{"cmd.exe", "/c", "dir"},
+		},
+	}
+	for _, tt := range tests {
+		if got := windowsCommand(tt.cmd); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("windowsCommand(%s %v) = %q, expected %q", tt.cmd.Cmd, tt.cmd.Args, got, tt.want)
+		}
+	}
+}
+
+// TestWindowsPath tests translating POSIX paths to drive C:
+func TestWindowsPath(t *testing.T) {
+	tests := map[string]string{
+		"/":                 `C:\`,
+		"/workspace/src":    `C:\workspace\src`,
+		"/tmp":              `C:\tmp`,
+		"/s":                "/s",
+		"/ad":               "/ad",
+		"//server/share":    "//server/share",
+		"relative/path":     "relative/path",
+		"/path with spaces": "/path with spaces",
+	}
+	for in, want := range tests {
+		if got := windowsPath(in); got != want {
+			t.Errorf("windowsPath(%q) = %q, expected %q", in, got, want)
+		}
+	}
+}
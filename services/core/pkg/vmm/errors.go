@@ -0,0 +1,78 @@
+package vmm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrVMStopped is returned by Supervisor.RestartVM when the crashed VM was
+// stopped or deleted before it could be restarted
+var ErrVMStopped = errors.New("VM was stopped or deleted")
+
+// APITimeoutError is returned when a VMM's control API didn't answer in
+// time: its socket never appeared or a call ran past its timeout. Slow or
+// overloaded hosts cause these; retrying later may succeed.
+type APITimeoutError struct {
+	Op       string // What was being done, e.g. "start VM"
+	Attempts int
+	Err      error
+}
+
+func (e *APITimeoutError) Error() string {
+	return fmt.Sprintf("%s: VMM API timed out after %d attempt(s): %v", e.Op, e.Attempts, e.Err)
+}
+
+func (e *APITimeoutError) Unwrap() error { return e.Err }
+
+// APIRefusedError is returned when a VMM's control API refused the
+// connection, usually because the VMM process is gone
+type APIRefusedError struct {
+	Op       string
+	Attempts int
+	Err      error
+}
+
+func (e *APIRefusedError) Error() string {
+	return fmt.Sprintf("%s: VMM API refused the connection after %d attempt(s): %v", e.Op, e.Attempts, e.Err)
+}
+
+func (e *APIRefusedError) Unwrap() error { return e.Err }
+
+// API error kinds reported in task results
+const (
+	APIErrorTimeout = "vmm_api_timeout"
+	APIErrorRefused = "vmm_api_refused"
+)
+
+// APIErrorKind returns the kind of VMM API error wrapped in err, or "" if
+// it isn't one
+func APIErrorKind(err error) string {
+	var timeout *APITimeoutError
+	if errors.As(err, &timeout) {
+		return APIErrorTimeout
+	}
+	var refused *APIRefusedError
+	if errors.As(err, &refused) {
+		return APIErrorRefused
+	}
+	return ""
+}
+
+// IntegrityError is returned when a rootfs template or the agent binary in
+// it failed verification. VMs aren't booted from such images; retrying
+// won't help until the image is replaced.
+type IntegrityError struct {
+	Component string // IntegrityRootFS or IntegrityAgent
+	Path      string // Rootfs template the component was checked in
+	Reason    string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("%s integrity check failed for %s: %s", e.Component, e.Path, e.Reason)
+}
+
+// Components checked by integrity verification
+const (
+	IntegrityRootFS = "rootfs"
+	IntegrityAgent  = "agent"
+)
@@ -0,0 +1,225 @@
+package firecracker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/network"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// defaultStateDir is where per-VM runtime state is kept when no state_dir is configured
+const defaultStateDir = "/var/firecracker/state"
+
+// vmState is the runtime information persisted for each running or paused
+// VM, so a restarted worker can re-attach to the firecracker process or
+// resume it from its snapshot
+type vmState struct {
+	VM        types.VM           `json:"vm"`
+	PID       int                `json:"pid"`
+	IPAddress string             `json:"ip_address,omitempty"`
+	TAP       *network.TAPDevice `json:"tap,omitempty"`
+}
+
+func (f *FirecrackerOrchestrator) vmStatePath(vmID string) string {
+	return filepath.Join(f.config.StateDir, vmID+".json")
+}
+
+// saveVMState writes the VM's runtime state to the state directory
+func (f *FirecrackerOrchestrator) saveVMState(handle *vmHandle) error {
+	if err := os.MkdirAll(f.config.StateDir, 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	data, err := json.Marshal(vmState{
+		VM:        *handle.vm,
+		PID:       handle.pid,
+		IPAddress: handle.ipAddress,
+		TAP:       handle.tap,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal VM state: %w", err)
+	}
+
+	// Rename into place so Adopt never reads a half-written file
+	path := f.vmStatePath(handle.vm.ID)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write VM state: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return fmt.Errorf("failed to write VM state: %w", err)
+	}
+
+	return nil
+}
+
+// removeVMState deletes the VM's runtime state, if any
+func (f *FirecrackerOrchestrator) removeVMState(vmID string) {
+	if err := os.Remove(f.vmStatePath(vmID)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: failed to remove state for VM %s: %v", vmID, err)
+	}
+}
+
+// Adopt re-attaches to VMs started by a previous worker process. Each VM
+// whose firecracker process is still alive is tracked again as running, and
+// paused VMs whose snapshot is intact as paused; state left behind by VMs
+// that have since exited is cleaned up.
+func (f *FirecrackerOrchestrator) Adopt(ctx context.Context) ([]*types.VM, error) {
+	paths, err := filepath.Glob(filepath.Join(f.config.StateDir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VM state: %w", err)
+	}
+
+	adopted := make([]*types.VM, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Warning: failed to read VM state %s: %v", path, err)
+			continue
+		}
+
+		var state vmState
+		if err := json.Unmarshal(data, &state); err != nil {
+			log.Printf("Warning: discarding unreadable VM state %s: %v", path, err)
+			os.Remove(path)
+			continue
+		}
+
+		vm := state.VM
+		if _, err := f.lookup(vm.ID); err == nil {
+			continue
+		}
+
+		// Paused VMs have no process, only a snapshot to resume from
+		if vm.Status == types.VMStatusPaused && f.hasSnapshot(vm.ID) {
+			if state.TAP != nil {
+				f.networkManager.RestoreTAPDevice(vm.ID, state.TAP)
+			}
+			f.mu.Lock()
+			f.vms[vm.ID] = &vmHandle{
+				vm:        &vm,
+				ipAddress: state.IPAddress,
+				tap:       state.TAP,
+			}
+			f.mu.Unlock()
+			adopted = append(adopted, &vm)
+			log.Printf("Adopted paused VM %s", vm.ID)
+			continue
+		}
+
+		if !firecrackerRunning(state.PID, vm.Config.SocketPath) {
+			log.Printf("VM %s (pid %d) exited while the worker was down, cleaning up", vm.ID, state.PID)
+			if state.TAP != nil {
+				f.networkManager.RestoreTAPDevice(vm.ID, state.TAP)
+				f.networkManager.DeleteTAPDevice(vm.ID)
+			}
+			os.Remove(vm.Config.SocketPath)
+			os.Remove(vm.Config.SocketPath + ".vsock")
+			os.Remove(path)
+			f.removeSnapshot(vm.ID)
+			f.removeVMSnapshots(vm.ID)
+			continue
+		}
+
+		if state.TAP != nil {
+			f.networkManager.RestoreTAPDevice(vm.ID, state.TAP)
+		}
+		handle := &vmHandle{
+			vm:        &vm,
+			ipAddress: state.IPAddress,
+			tap:       state.TAP,
+			pid:       state.PID,
+			boots:     1,
+		}
+		f.mu.Lock()
+		f.vms[vm.ID] = handle
+		f.mu.Unlock()
+		adopted = append(adopted, &vm)
+
+		pid, socketPath := state.PID, vm.Config.SocketPath
+		go f.supervise(handle, handle.boots, func() error {
+			return waitForAdoptedExit(pid, socketPath)
+		})
+
+		log.Printf("Adopted running VM %s (pid %d)", vm.ID, state.PID)
+	}
+
+	return adopted, nil
+}
+
+// Detach saves the state of every running and paused VM, so the next
+// worker run adopts them instead of finding them lost. The VMs keep running.
+func (f *FirecrackerOrchestrator) Detach(ctx context.Context) error {
+	f.mu.RLock()
+	handles := make([]*vmHandle, 0, len(f.vms))
+	for _, handle := range f.vms {
+		handles = append(handles, handle)
+	}
+	f.mu.RUnlock()
+
+	var errs []error
+	for _, handle := range handles {
+		handle.mu.Lock()
+		var err error
+		switch {
+		case handle.deleted:
+		case handle.vm.Status == types.VMStatusRunning && handle.pid > 0,
+			handle.vm.Status == types.VMStatusPaused:
+			err = f.saveVMState(handle)
+		}
+		handle.mu.Unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("VM %s: %w", handle.vm.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// firecrackerRunning reports whether pid is a live firecracker process
+// serving socketPath. Matching the command line guards against the pid
+// having been reused by an unrelated process.
+func firecrackerRunning(pid int, socketPath string) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	cmdline, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return false
+	}
+
+	args := strings.Split(string(cmdline), "\x00")
+	for _, arg := range args {
+		if arg == socketPath {
+			return true
+		}
+	}
+	return false
+}
+
+// stopAdoptedVM stops a VM that has no SDK machine. A graceful stop asks
+// the guest to shut down through the API socket, like Machine.Shutdown;
+// a forced stop sends SIGTERM, like Machine.StopVMM.
+func stopAdoptedVM(handle *vmHandle, force bool) error {
+	if !force {
+		return NewFirecrackerClient(handle.vm.Config.SocketPath).SendCtrlAltDel()
+	}
+
+	if err := syscall.Kill(handle.pid, syscall.SIGTERM); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	return nil
+}
+
+// Ensure FirecrackerOrchestrator implements vmm.Adopter
+var _ vmm.Adopter = (*FirecrackerOrchestrator)(nil)
@@ -0,0 +1,47 @@
+package firecracker
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+)
+
+func TestDetachSavesState(t *testing.T) {
+	f := &FirecrackerOrchestrator{
+		config: &Config{StateDir: t.TempDir()},
+		vms:    make(map[string]*vmHandle),
+	}
+	for id, status := range map[string]types.VMStatus{
+		"running-vm": types.VMStatusRunning,
+		"paused-vm":  types.VMStatusPaused,
+		"stopped-vm": types.VMStatusStopped,
+	} {
+		f.vms[id] = &vmHandle{
+			vm:  &types.VM{ID: id, Status: status},
+			pid: 4242,
+		}
+	}
+	f.vms["deleted-vm"] = &vmHandle{
+		vm:      &types.VM{ID: "deleted-vm", Status: types.VMStatusRunning},
+		pid:     4243,
+		deleted: true,
+	}
+
+	if err := f.Detach(context.Background()); err != nil {
+		t.Fatalf("Detach() error = %v", err)
+	}
+
+	for id, want := range map[string]bool{
+		"running-vm": true,
+		"paused-vm":  true,
+		"stopped-vm": false,
+		"deleted-vm": false,
+	} {
+		_, err := os.Stat(f.vmStatePath(id))
+		if got := err == nil; got != want {
+			t.Errorf("state of %s saved = %v, want %v", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package firecracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+)
+
+// Firecracker API defaults. The timeouts match the SDK's own defaults.
+const (
+	defaultSocketWaitTimeout = 3 * time.Second
+	defaultAPITimeout        = 500 * time.Millisecond
+	defaultAPIRetries        = 2
+	defaultAPIRetryBackoff   = 1 * time.Second
+)
+
+// The SDK only reads its timeouts from the environment, when a machine's
+// API client is created
+const (
+	sdkInitTimeoutEnv    = "FIRECRACKER_GO_SDK_INIT_TIMEOUT_SECONDS"
+	sdkRequestTimeoutEnv = "FIRECRACKER_GO_SDK_REQUEST_TIMEOUT_MILLISECONDS"
+)
+
+// applyAPIOptions reads the API timeout and retry options from the config map,
+// falling back to the defaults, and passes the timeouts on to the SDK
+func applyAPIOptions(config *Config, configMap map[string]interface{}) error {
+	config.SocketWaitTimeout = time.Duration(intOption(configMap, "socket_wait_timeout_seconds")) * time.Second
+	if config.SocketWaitTimeout <= 0 {
+		config.SocketWaitTimeout = defaultSocketWaitTimeout
+	}
+	config.APITimeout = time.Duration(intOption(configMap, "api_timeout_ms")) * time.Millisecond
+	if config.APITimeout <= 0 {
+		config.APITimeout = defaultAPITimeout
+	}
+	config.APIRetries = intOption(configMap, "api_retries")
+	if config.APIRetries == 0 {
+		config.APIRetries = defaultAPIRetries
+	} else if config.APIRetries < 0 {
+		config.APIRetries = 0 // Negative values disable retries
+	}
+	config.APIRetryBackoff = time.Duration(intOption(configMap, "api_retry_backoff_ms")) * time.Millisecond
+	if config.APIRetryBackoff <= 0 {
+		config.APIRetryBackoff = defaultAPIRetryBackoff
+	}
+
+	// The SDK waits for the socket in whole seconds
+	waitSeconds := int((config.SocketWaitTimeout + time.Second - 1) / time.Second)
+	if err := os.Setenv(sdkInitTimeoutEnv, strconv.Itoa(waitSeconds)); err != nil {
+		return fmt.Errorf("failed to set socket wait timeout: %w", err)
+	}
+	if err := os.Setenv(sdkRequestTimeoutEnv, strconv.FormatInt(config.APITimeout.Milliseconds(), 10)); err != nil {
+		return fmt.Errorf("failed to set API timeout: %w", err)
+	}
+	return nil
+}
+
+// intOption reads an integer from a config map, which may hold it as an int
+// or, when decoded from JSON, a float64
+func intOption(configMap map[string]interface{}, key string) int {
+	switch v := configMap[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+// startMachine boots a VM's machine, retrying with a fresh machine when
+// firecracker's API times out or refuses the connection. Each retry waits
+// twice as long as the one before.
+func (f *FirecrackerOrchestrator) startMachine(ctx context.Context, handle *vmHandle) error {
+	backoff := f.config.APIRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := handle.machine.Start(context.Background())
+		if err == nil {
+			return nil
+		}
+
+		apiErr := classifyAPIError("start VM", attempt, err)
+		if vmm.APIErrorKind(apiErr) == "" || attempt > f.config.APIRetries || handle.fcConfig == nil {
+			return apiErr
+		}
+
+		log.Printf("Warning: VM %s failed to start (attempt %d/%d), retrying in %v: %v",
+			handle.vm.ID, attempt, f.config.APIRetries+1, backoff, err)
+
+		// A machine only starts once: stop what's left of this one and
+		// boot a new one from the same configuration
+		handle.machine.StopVMM()
+		os.Remove(handle.fcConfig.SocketPath)
+		os.Remove(handle.fcConfig.SocketPath + ".vsock")
+
+		select {
+		case <-ctx.Done():
+			return apiErr
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+
+		machine, err := firecracker.NewMachine(context.Background(), *handle.fcConfig)
+		if err != nil {
+			return fmt.Errorf("failed to create firecracker machine: %w", err)
+		}
+		handle.machine = machine
+	}
+}
+
+// classifyAPIError wraps errors talking to firecracker's API in a
+// vmm.APITimeoutError or vmm.APIRefusedError. Other errors are returned as is.
+func classifyAPIError(op string, attempts int, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return &vmm.APITimeoutError{Op: op, Attempts: attempts, Err: err}
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ENOENT):
+		return &vmm.APIRefusedError{Op: op, Attempts: attempts, Err: err}
+	default:
+		return err
+	}
+}
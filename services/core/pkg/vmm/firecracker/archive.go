@@ -0,0 +1,63 @@
+package firecracker
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// ArchiveDir streams a gzipped tar of a directory in a VM. The agent sends
+// the archive after accepting the request and closes the connection at its
+// end.
+func (f *FirecrackerOrchestrator) ArchiveDir(ctx context.Context, vmID, dir string) (io.ReadCloser, error) {
+	conn, err := f.handOver(ctx, vmID, "archive", &vmm.ArchiveRequest{Dir: dir})
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	return &archiveReader{streamConn: conn, stop: stop}, nil
+}
+
+// archiveReader closes the agent connection when done or when the context
+// ArchiveDir was called with is cancelled
+type archiveReader struct {
+	*streamConn
+	stop func() bool
+}
+
+func (r *archiveReader) Close() error {
+	r.stop()
+	return r.streamConn.Close()
+}
+
+// ExtractDir unpacks a gzipped tar into a directory in a VM. The agent reads
+// the archive up to the end of its gzip stream and then reports the result.
+func (f *FirecrackerOrchestrator) ExtractDir(ctx context.Context, vmID, dir string, archive io.Reader) (int, error) {
+	conn, err := f.handOver(ctx, vmID, "extract", &vmm.ArchiveRequest{Dir: dir})
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if _, err := io.Copy(conn, archive); err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, fmt.Errorf("failed to send archive: %w", err)
+	}
+
+	var result struct {
+		Files int `json:"files"`
+	}
+	if err := readAgentResult(conn.reader, &result); err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, err
+	}
+	return result.Files, nil
+}
@@ -97,6 +97,26 @@ func (c *FirecrackerClient) SendCtrlAltDel() error {
 	return c.makeRequest("PUT", "/actions", body)
 }
 
+// PauseVM pauses the guest's vCPUs
+func (c *FirecrackerClient) PauseVM() error {
+	return c.makeRequest("PATCH", "/vm", VMState{State: VMStatePaused})
+}
+
+// ResumeVM resumes a paused guest
+func (c *FirecrackerClient) ResumeVM() error {
+	return c.makeRequest("PATCH", "/vm", VMState{State: VMStateResumed})
+}
+
+// CreateSnapshot writes a paused VM's memory and device state to files
+func (c *FirecrackerClient) CreateSnapshot(memFilePath, snapshotPath string) error {
+	body := SnapshotCreateParams{
+		MemFilePath:  memFilePath,
+		SnapshotPath: snapshotPath,
+	}
+
+	return c.makeRequest("PUT", "/snapshot/create", body)
+}
+
 // GetInstanceInfo retrieves VM state information
 func (c *FirecrackerClient) GetInstanceInfo() (*InstanceInfo, error) {
 	req, err := http.NewRequest("GET", "http://localhost/", nil)
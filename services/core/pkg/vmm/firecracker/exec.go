@@ -23,6 +23,8 @@ type commandResponse struct {
 	Stdout   string `json:"stdout"`
 	Stderr   string `json:"stderr"`
 	Error    string `json:"error,omitempty"`
+
+	Resources *vmm.ResourceEvents `json:"resources,omitempty"`
 }
 
 const (
@@ -34,13 +36,9 @@ const (
 
 // ExecuteCommand executes a command in a Firecracker VM
 func (f *FirecrackerOrchestrator) ExecuteCommand(ctx context.Context, vmID string, cmd *vmm.Command) (*vmm.ExecResult, error) {
-	handle, exists := f.vms[vmID]
-	if !exists {
-		return nil, fmt.Errorf("VM %s not found", vmID)
-	}
-
-	if handle.vm.Status != "RUNNING" {
-		return nil, fmt.Errorf("VM %s is not running (status: %s)", vmID, handle.vm.Status)
+	handle, err := f.runningHandle(vmID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Try vsock first, then fall back to network
@@ -165,7 +163,13 @@ func (f *FirecrackerOrchestrator) sendCommandAndWait(ctx context.Context, conn n
 		return nil, fmt.Errorf("failed to send command: %w", err)
 	}
 
-	// Read response with timeout
+	// Read response with timeout. Callers that set a deadline (such as a
+	// prompt's time limit) get that instead of the default.
+	timeout := 30 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
 	respCh := make(chan *commandResponse, 1)
 	errCh := make(chan error, 1)
 
@@ -190,21 +194,23 @@ func (f *FirecrackerOrchestrator) sendCommandAndWait(ctx context.Context, conn n
 	case resp := <-respCh:
 		if resp.Error != "" {
 			return &vmm.ExecResult{
-				ExitCode: resp.ExitCode,
-				Stdout:   resp.Stdout,
-				Stderr:   resp.Stderr + "\nAgent error: " + resp.Error,
+				ExitCode:  resp.ExitCode,
+				Stdout:    resp.Stdout,
+				Stderr:    resp.Stderr + "\nAgent error: " + resp.Error,
+				Resources: resp.Resources,
 			}, nil
 		}
 		return &vmm.ExecResult{
-			ExitCode: resp.ExitCode,
-			Stdout:   resp.Stdout,
-			Stderr:   resp.Stderr,
+			ExitCode:  resp.ExitCode,
+			Stdout:    resp.Stdout,
+			Stderr:    resp.Stderr,
+			Resources: resp.Resources,
 		}, nil
 	case err := <-errCh:
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	case <-ctx.Done():
 		return nil, ctx.Err()
-	case <-time.After(30 * time.Second):
+	case <-time.After(timeout):
 		return nil, fmt.Errorf("command execution timeout")
 	}
 }
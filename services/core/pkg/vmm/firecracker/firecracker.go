@@ -3,6 +3,7 @@ package firecracker
 import (
 	"bufio"
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -10,6 +11,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aetherium/aetherium/services/core/pkg/network"
@@ -23,8 +26,11 @@ import (
 // FirecrackerOrchestrator implements vmm.VMOrchestrator using the official Firecracker SDK
 type FirecrackerOrchestrator struct {
 	config         *Config
+	mu             sync.RWMutex // Guards vms; each handle guards itself
 	vms            map[string]*vmHandle
 	networkManager *network.Manager
+	exitHandler    func(exit vmm.VMExit) // See SetExitHandler in supervise.go
+	templates      templateRegistry      // See integrity.go
 }
 
 // Config represents Firecracker-specific configuration
@@ -32,14 +38,66 @@ type Config struct {
 	KernelPath      string
 	RootFSTemplate  string
 	SocketDir       string
+	StateDir        string // Per-VM runtime state, read by Adopt after a worker restart
 	DefaultVCPU     int
 	DefaultMemoryMB int
+
+	// API socket timeouts and boot retries (see api.go)
+	SocketWaitTimeout time.Duration // Wait for firecracker to create its API socket
+	APITimeout        time.Duration // Per API call
+	APIRetries        int           // Boot retries after an API timeout or refusal
+	APIRetryBackoff   time.Duration // Delay before the first retry, doubled for each one
+
+	// Integrity verification (see integrity.go); both optional
+	RootFSChecksum string            // Expected "sha256:<hex>" of the default template
+	AgentPublicKey ed25519.PublicKey // The agent binary in templates must be signed with it
 }
 
+// vmHandle is a VM tracked by the orchestrator. mu is held while the VM's
+// state, machine or process changes, including by the supervisor when the
+// process exits, so those never interleave.
 type vmHandle struct {
+	mu        sync.Mutex
 	vm        *types.VM
-	machine   *firecracker.Machine
-	ipAddress string // VM's IP address for TCP fallback
+	machine   *firecracker.Machine // nil for VMs adopted from a previous worker run
+	ipAddress string               // VM's IP address for TCP fallback
+	tap       *network.TAPDevice
+	pid       int
+	fcConfig  *firecracker.Config // Kept to restart the VM after a crash; nil for adopted VMs
+	boots     int                 // Processes started, so supervise ignores exits of replaced ones
+	deleted   bool                // Removed by DeleteVM
+}
+
+// status returns the VM's current status
+func (h *vmHandle) status() types.VMStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.vm.Status
+}
+
+// lookup returns a VM's handle, unlocked
+func (f *FirecrackerOrchestrator) lookup(vmID string) (*vmHandle, error) {
+	f.mu.RLock()
+	handle, exists := f.vms[vmID]
+	f.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("VM %s not found", vmID)
+	}
+	return handle, nil
+}
+
+// lockVM returns a VM's handle, locked. The caller must unlock it.
+func (f *FirecrackerOrchestrator) lockVM(vmID string) (*vmHandle, error) {
+	handle, err := f.lookup(vmID)
+	if err != nil {
+		return nil, err
+	}
+	handle.mu.Lock()
+	if handle.deleted {
+		handle.mu.Unlock()
+		return nil, fmt.Errorf("VM %s not found", vmID)
+	}
+	return handle, nil
 }
 
 // NewFirecrackerOrchestrator creates a new Firecracker VMM orchestrator using the official SDK
@@ -51,16 +109,34 @@ func NewFirecrackerOrchestrator(configMap map[string]interface{}) (*FirecrackerO
 		DefaultVCPU:     configMap["default_vcpu"].(int),
 		DefaultMemoryMB: configMap["default_memory_mb"].(int),
 	}
+	if stateDir, ok := configMap["state_dir"].(string); ok && stateDir != "" {
+		config.StateDir = stateDir
+	} else {
+		config.StateDir = defaultStateDir
+	}
+	if err := applyAPIOptions(config, configMap); err != nil {
+		return nil, err
+	}
+	if err := applyIntegrityOptions(config, configMap); err != nil {
+		return nil, err
+	}
 
 	// Create network manager
-	netMgr, err := network.NewManager(network.NetworkConfig{
+	netConfig := network.NetworkConfig{
 		BridgeName:    "aetherium0",
 		BridgeIP:      "172.16.0.1/24",
 		SubnetCIDR:    "172.16.0.0/24",
 		TapPrefix:     "aether-",
 		EnableNAT:     true,
 		HostInterface: "", // Auto-detect
-	})
+	}
+	// IPv6 settings are only present on dual-stack deployments
+	if subnet6, ok := configMap["ipv6_subnet_cidr"].(string); ok && subnet6 != "" {
+		netConfig.SubnetCIDR6 = subnet6
+		netConfig.BridgeIP6, _ = configMap["ipv6_bridge_ip"].(string)
+		netConfig.IPv6Mode, _ = configMap["ipv6_mode"].(string)
+	}
+	netMgr, err := network.NewManager(netConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create network manager: %w", err)
 	}
@@ -74,6 +150,7 @@ func NewFirecrackerOrchestrator(configMap map[string]interface{}) (*FirecrackerO
 		config:         config,
 		vms:            make(map[string]*vmHandle),
 		networkManager: netMgr,
+		templates:      templateRegistry{records: make(map[string]*templateRecord)},
 	}, nil
 }
 
@@ -87,18 +164,30 @@ func NewFirecrackerOrchestratorWithNetwork(configMap map[string]interface{}, net
 		DefaultVCPU:     configMap["default_vcpu"].(int),
 		DefaultMemoryMB: configMap["default_memory_mb"].(int),
 	}
+	if stateDir, ok := configMap["state_dir"].(string); ok && stateDir != "" {
+		config.StateDir = stateDir
+	} else {
+		config.StateDir = defaultStateDir
+	}
+	if err := applyAPIOptions(config, configMap); err != nil {
+		return nil, err
+	}
+	if err := applyIntegrityOptions(config, configMap); err != nil {
+		return nil, err
+	}
 
 	return &FirecrackerOrchestrator{
 		config:         config,
 		vms:            make(map[string]*vmHandle),
 		networkManager: netMgr,
+		templates:      templateRegistry{records: make(map[string]*templateRecord)},
 	}, nil
 }
 
 // createVMRootfs creates a per-VM copy of the rootfs template
 // This ensures VM isolation - each VM gets its own rootfs copy to prevent corruption
-func (f *FirecrackerOrchestrator) createVMRootfs(ctx context.Context, vmID string) (string, error) {
-	templatePath := "/var/firecracker/rootfs-template.ext4"
+// from templatePath, the default template or e.g. a saved environment image
+func (f *FirecrackerOrchestrator) createVMRootfs(ctx context.Context, vmID, templatePath string) (string, error) {
 	vmRootfsPath := fmt.Sprintf("/var/firecracker/rootfs-vm-%s.ext4", vmID)
 
 	// Check if template exists
@@ -126,8 +215,75 @@ func (f *FirecrackerOrchestrator) createVMRootfs(ctx context.Context, vmID strin
 	return vmRootfsPath, nil
 }
 
+// growRootfs enlarges a per-VM rootfs to sizeMB, leaving larger images as
+// they are. The file is sparse, so unused space costs nothing on the host.
+func growRootfs(ctx context.Context, rootfsPath string, sizeMB int) error {
+	info, err := os.Stat(rootfsPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat VM rootfs: %w", err)
+	}
+	size := int64(sizeMB) * 1024 * 1024
+	if info.Size() >= size {
+		return nil
+	}
+
+	if err := os.Truncate(rootfsPath, size); err != nil {
+		return fmt.Errorf("failed to grow VM rootfs: %w", err)
+	}
+	// resize2fs insists on a freshly checked filesystem
+	if output, err := exec.CommandContext(ctx, "e2fsck", "-fy", rootfsPath).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to check VM rootfs: %w, output: %s", err, string(output))
+	}
+	if output, err := exec.CommandContext(ctx, "resize2fs", rootfsPath).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to resize VM rootfs filesystem: %w, output: %s", err, string(output))
+	}
+
+	log.Printf("Grew VM rootfs %s to %d MB", rootfsPath, sizeMB)
+	return nil
+}
+
+// sandboxKernelArgs encodes guest-side sandbox settings as kernel parameters
+// These are read from /proc/cmdline by fc-agent at boot
+func sandboxKernelArgs(sandbox *vmm.SandboxProfile) (string, error) {
+	if sandbox == nil {
+		return "", nil
+	}
+	// The profile comes from environment settings; a bad workdir would add
+	// boot parameters of its own
+	if err := sandbox.Validate(); err != nil {
+		return "", err
+	}
+
+	args := ""
+	if sandbox.TmpfsWorkdir != "" {
+		args += fmt.Sprintf(" aetherium.tmpfs=%s", sandbox.TmpfsWorkdir)
+		if sandbox.TmpfsSizeMB > 0 {
+			args += fmt.Sprintf(":%d", sandbox.TmpfsSizeMB)
+		}
+	}
+	if sandbox.ReadOnlyRootFS {
+		// Writable scratch space so tools that expect /tmp keep working
+		args += " aetherium.readonly=1"
+	}
+	if sandbox.RestrictProc {
+		args += " aetherium.hidepid=2"
+	}
+	return args, nil
+}
+
 // CreateVM creates a new Firecracker VM
 func (f *FirecrackerOrchestrator) CreateVM(ctx context.Context, config *types.VMConfig) (*types.VM, error) {
+	if err := vmm.ValidateKernelArgs(config.KernelArgs); err != nil {
+		return nil, fmt.Errorf("invalid kernel args: %w", err)
+	}
+
+	// Sandbox profile (read-only rootfs, tmpfs workdir, no network, restricted /proc)
+	sandbox := vmm.SandboxFromMetadata(config.Metadata)
+	sandboxArgs, err := sandboxKernelArgs(sandbox)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sandbox profile: %w", err)
+	}
+
 	// Validate that kernel exists
 	if _, err := os.Stat(config.KernelPath); os.IsNotExist(err) {
 		return nil, fmt.Errorf("kernel not found: %s", config.KernelPath)
@@ -136,10 +292,22 @@ func (f *FirecrackerOrchestrator) CreateVM(ctx context.Context, config *types.VM
 	// Create per-VM rootfs from template (for isolation)
 	// If config.RootFSPath is empty or points to old shared rootfs, create new per-VM copy
 	if config.RootFSPath == "" || config.RootFSPath == "/var/firecracker/rootfs.ext4" {
-		vmRootfsPath, err := f.createVMRootfs(ctx, config.ID)
+		// Templates must pass integrity verification before anything boots from them
+		template := templatePath(config.Metadata["rootfs_template"])
+		if err := f.verifyTemplate(ctx, template); err != nil {
+			return nil, err
+		}
+
+		vmRootfsPath, err := f.createVMRootfs(ctx, config.ID, template)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create per-VM rootfs: %w", err)
 		}
+		if docker := vmm.DockerFromMetadata(config.Metadata); docker != nil && docker.DiskSizeMB > 0 {
+			if err := growRootfs(ctx, vmRootfsPath, docker.DiskSizeMB); err != nil {
+				os.Remove(vmRootfsPath)
+				return nil, err
+			}
+		}
 		config.RootFSPath = vmRootfsPath
 	} else {
 		// Validate custom rootfs path exists (for backwards compatibility)
@@ -159,18 +327,72 @@ func (f *FirecrackerOrchestrator) CreateVM(ctx context.Context, config *types.VM
 	vcpuCount := int64(config.VCPUCount)
 	memSizeMib := int64(config.MemoryMB)
 
-	// Create TAP device for network
-	tapDevice, err := f.networkManager.CreateTAPDevice(config.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create TAP device: %w", err)
-	}
+	docker := vmm.DockerFromMetadata(config.Metadata)
 
 	// Create log file for Firecracker logs (not VM console output)
 	logPath := config.SocketPath + ".log"
 
-	// Build kernel args with network configuration
-	kernelArgs := fmt.Sprintf("console=ttyS0 reboot=k panic=1 pci=off root=/dev/vda rw ip=%s::172.16.0.1:255.255.255.0::eth0:off:8.8.8.8",
-		tapDevice.IPAddress[:len(tapDevice.IPAddress)-3]) // Remove /24 suffix
+	rootMode := "rw"
+	if sandbox != nil && sandbox.ReadOnlyRootFS {
+		rootMode = "ro"
+	}
+
+	// Build kernel args
+	kernelArgs := fmt.Sprintf("console=ttyS0 reboot=k panic=1 pci=off root=/dev/vda %s", rootMode)
+	kernelArgs += sandboxArgs
+	if docker != nil {
+		// fc-agent starts dockerd at boot when the rootfs has it
+		kernelArgs += " aetherium.docker=1"
+	}
+	if len(config.KernelArgs) > 0 {
+		kernelArgs += " " + strings.Join(config.KernelArgs, " ")
+	}
+
+	// Create TAP device for network (skipped in no-network sandboxes)
+	var tapDevice *network.TAPDevice
+	var networkInterfaces []firecracker.NetworkInterface
+	if sandbox == nil || !sandbox.NoNetwork {
+		var err error
+		tapDevice, err = f.networkManager.CreateTAPDevice(config.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create TAP device: %w", err)
+		}
+
+		if config.Firewall != nil {
+			if err := f.networkManager.ApplyFirewall(config.ID, config.Firewall); err != nil {
+				f.networkManager.DeleteTAPDevice(config.ID)
+				return nil, err
+			}
+		}
+
+		// Image pulls leave through the egress proxy like other traffic;
+		// whitelist the registries for this VM
+		if docker != nil {
+			if err := f.networkManager.RegisterVMWithProxy(config.ID, config.ID, docker.Domains()); err != nil {
+				log.Printf("Warning: Failed to whitelist Docker registries for VM %s: %v", config.ID, err)
+			}
+		}
+
+		kernelArgs += fmt.Sprintf(" ip=%s::172.16.0.1:255.255.255.0::eth0:off:8.8.8.8",
+			tapDevice.IPAddress[:len(tapDevice.IPAddress)-3]) // Remove /24 suffix
+
+		// The kernel's ip= only configures IPv4; fc-agent adds the static
+		// IPv6 address. With SLAAC the guest configures itself from router
+		// advertisements.
+		if tapDevice.IPv6Address != "" && f.networkManager.IPv6Mode() == network.IPv6ModeStatic {
+			kernelArgs += fmt.Sprintf(" aetherium.ipv6=%s,%s",
+				tapDevice.IPv6Address, strings.Split(tapDevice.Gateway6, "/")[0])
+		}
+
+		networkInterfaces = []firecracker.NetworkInterface{
+			{
+				StaticConfiguration: &firecracker.StaticNetworkConfiguration{
+					MacAddress:  tapDevice.MACAddr,
+					HostDevName: tapDevice.Name,
+				},
+			},
+		}
+	}
 
 	fcConfig := firecracker.Config{
 		SocketPath:      config.SocketPath,
@@ -181,22 +403,14 @@ func (f *FirecrackerOrchestrator) CreateVM(ctx context.Context, config *types.VM
 				DriveID:      firecracker.String("rootfs"),
 				PathOnHost:   firecracker.String(config.RootFSPath),
 				IsRootDevice: firecracker.Bool(true),
-				IsReadOnly:   firecracker.Bool(false),
+				IsReadOnly:   firecracker.Bool(sandbox != nil && sandbox.ReadOnlyRootFS),
 			},
 		},
 		MachineCfg: models.MachineConfiguration{
 			VcpuCount:  firecracker.Int64(vcpuCount),
 			MemSizeMib: firecracker.Int64(memSizeMib),
 		},
-		// Add network interface
-		NetworkInterfaces: []firecracker.NetworkInterface{
-			{
-				StaticConfiguration: &firecracker.StaticNetworkConfiguration{
-					MacAddress:  tapDevice.MACAddr,
-					HostDevName: tapDevice.Name,
-				},
-			},
-		},
+		NetworkInterfaces: networkInterfaces,
 		// Add vsock device for agent communication
 		VsockDevices: []firecracker.VsockDevice{
 			{
@@ -207,6 +421,9 @@ func (f *FirecrackerOrchestrator) CreateVM(ctx context.Context, config *types.VM
 		// Enable logging
 		LogPath:  logPath,
 		LogLevel: "Debug",
+		// Don't pass the worker's SIGTERM/SIGINT on to firecracker, so VMs
+		// keep running across a worker restart and can be adopted
+		ForwardSignals: []os.Signal{},
 	}
 
 	// Create the machine (doesn't start it yet)
@@ -217,105 +434,164 @@ func (f *FirecrackerOrchestrator) CreateVM(ctx context.Context, config *types.VM
 	}
 
 	// Extract IP address (remove CIDR suffix like /24)
-	vmIP := tapDevice.IPAddress
-	if idx := len(vmIP) - 3; idx > 0 && vmIP[idx] == '/' {
-		vmIP = vmIP[:idx]
+	// No-network sandboxes have no IP and are reached over vsock only
+	var vmIP string
+	if tapDevice != nil {
+		vmIP = tapDevice.IPAddress
+		if idx := len(vmIP) - 3; idx > 0 && vmIP[idx] == '/' {
+			vmIP = vmIP[:idx]
+		}
 	}
 
+	f.mu.Lock()
 	f.vms[config.ID] = &vmHandle{
 		vm:        vm,
 		machine:   machine,
 		ipAddress: vmIP,
+		tap:       tapDevice,
+		fcConfig:  &fcConfig,
 	}
+	f.mu.Unlock()
 
 	return vm, nil
 }
 
 // StartVM starts a Firecracker VM
 func (f *FirecrackerOrchestrator) StartVM(ctx context.Context, vmID string) error {
-	handle, exists := f.vms[vmID]
-	if !exists {
-		return fmt.Errorf("VM %s not found", vmID)
+	handle, err := f.lockVM(vmID)
+	if err != nil {
+		return err
 	}
+	defer handle.mu.Unlock()
 
-	if handle.vm.Status != types.VMStatusCreated {
-		return fmt.Errorf("VM %s is not in created state (current: %s)", vmID, handle.vm.Status)
-	}
+	return f.startVM(ctx, handle)
+}
 
-	handle.vm.Status = types.VMStatusStarting
+// startVM boots a VM's machine. The handle must be locked.
+func (f *FirecrackerOrchestrator) startVM(ctx context.Context, handle *vmHandle) error {
+	vmID := handle.vm.ID
+	if err := handle.vm.Transition(types.VMStatusStarting); err != nil {
+		return err
+	}
 
 	// Start the VM using the SDK
 	// Use context.Background() so VM process outlives the creation task
 	// The VM should continue running after the task completes
-	if err := handle.machine.Start(context.Background()); err != nil {
-		handle.vm.Status = types.VMStatusFailed
+	if err := f.startMachine(ctx, handle); err != nil {
+		handle.vm.Transition(types.VMStatusFailed)
 		return fmt.Errorf("failed to start VM: %w", err)
 	}
 
-	handle.vm.Status = types.VMStatusRunning
+	if err := handle.vm.Transition(types.VMStatusRunning); err != nil {
+		return err
+	}
 	now := time.Now()
 	handle.vm.StartedAt = &now
 
+	// Persist runtime info so a restarted worker can adopt the VM
+	if pid, err := handle.machine.PID(); err == nil {
+		handle.pid = pid
+		if err := f.saveVMState(handle); err != nil {
+			log.Printf("Warning: failed to save state for VM %s (it won't survive a worker restart): %v", vmID, err)
+		}
+	}
+
+	machine := handle.machine
+	handle.boots++
+	go f.supervise(handle, handle.boots, func() error {
+		return machine.Wait(context.Background())
+	})
+
 	return nil
 }
 
 // StopVM stops a Firecracker VM
 func (f *FirecrackerOrchestrator) StopVM(ctx context.Context, vmID string, force bool) error {
-	handle, exists := f.vms[vmID]
-	if !exists {
-		return fmt.Errorf("VM %s not found", vmID)
+	handle, err := f.lockVM(vmID)
+	if err != nil {
+		return err
 	}
+	defer handle.mu.Unlock()
 
-	if handle.vm.Status != types.VMStatusRunning {
-		return fmt.Errorf("VM %s is not running (status: %s)", vmID, handle.vm.Status)
-	}
+	return f.stopVM(ctx, handle, force)
+}
 
-	handle.vm.Status = types.VMStatusStopping
+// stopVM stops a VM's machine. The handle must be locked.
+func (f *FirecrackerOrchestrator) stopVM(ctx context.Context, handle *vmHandle, force bool) error {
+	vmID := handle.vm.ID
+	if handle.vm.Status == types.VMStatusCrashed {
+		// The process is already gone; this keeps it from being restarted
+		return handle.vm.Transition(types.VMStatusStopped)
+	}
+	paused := handle.vm.Status == types.VMStatusPaused
+	if err := handle.vm.Transition(types.VMStatusStopping); err != nil {
+		return err
+	}
 
 	var err error
-	if force {
+	if paused {
+		// No process left to stop, only the snapshot to discard
+		f.removeSnapshot(vmID)
+	} else if handle.machine == nil {
+		// Adopted VM: no SDK machine, signal the process directly
+		err = stopAdoptedVM(handle, force)
+	} else if force {
 		// Force stop using StopVMM
 		err = handle.machine.StopVMM()
 	} else {
 		// Graceful shutdown
-		err = handle.machine.Shutdown(ctx)
+		err = classifyAPIError("shut down VM", 1, handle.machine.Shutdown(ctx))
 	}
 
 	if err != nil {
+		handle.vm.Transition(types.VMStatusFailed)
 		return fmt.Errorf("failed to stop VM: %w", err)
 	}
 
-	handle.vm.Status = types.VMStatusStopped
+	if err := handle.vm.Transition(types.VMStatusStopped); err != nil {
+		return err
+	}
 	now := time.Now()
 	handle.vm.StoppedAt = &now
+	f.removeVMState(vmID)
 
 	return nil
 }
 
 // GetVMStatus returns the current status of a VM
 func (f *FirecrackerOrchestrator) GetVMStatus(ctx context.Context, vmID string) (*types.VM, error) {
-	handle, exists := f.vms[vmID]
-	if !exists {
-		return nil, fmt.Errorf("VM %s not found", vmID)
+	handle, err := f.lockVM(vmID)
+	if err != nil {
+		return nil, err
 	}
+	defer handle.mu.Unlock()
 
-	return handle.vm, nil
+	// A copy, so callers don't read the VM while it changes
+	vm := *handle.vm
+	return &vm, nil
 }
 
 // DeleteVM destroys a VM and cleans up resources
 func (f *FirecrackerOrchestrator) DeleteVM(ctx context.Context, vmID string) error {
-	handle, exists := f.vms[vmID]
-	if !exists {
-		return fmt.Errorf("VM %s not found", vmID)
+	handle, err := f.lockVM(vmID)
+	if err != nil {
+		return err
 	}
+	defer handle.mu.Unlock()
 
 	// Stop if running
 	if handle.vm.Status == types.VMStatusRunning {
-		if err := f.StopVM(ctx, vmID, true); err != nil {
+		if err := f.stopVM(ctx, handle, true); err != nil {
 			return fmt.Errorf("failed to stop VM during delete: %w", err)
 		}
 	}
 
+	if vmm.DockerFromMetadata(handle.vm.Config.Metadata) != nil {
+		if err := f.networkManager.UnregisterVMFromProxy(vmID); err != nil {
+			log.Printf("Warning: Failed to remove proxy whitelist of VM %s: %v", vmID, err)
+		}
+	}
+
 	// Clean up TAP device
 	if err := f.networkManager.DeleteTAPDevice(vmID); err != nil {
 		// Log but don't fail - TAP device might not exist
@@ -325,6 +601,9 @@ func (f *FirecrackerOrchestrator) DeleteVM(ctx context.Context, vmID string) err
 	// Clean up sockets
 	os.Remove(handle.vm.Config.SocketPath)
 	os.Remove(handle.vm.Config.SocketPath + ".vsock")
+	f.removeVMState(vmID)
+	f.removeSnapshot(vmID)
+	f.removeVMSnapshots(vmID)
 
 	// Clean up per-VM rootfs (self-healing)
 	// Only delete if it's a per-VM rootfs (matches pattern rootfs-vm-{id}.ext4)
@@ -339,17 +618,63 @@ func (f *FirecrackerOrchestrator) DeleteVM(ctx context.Context, vmID string) err
 		}
 	}
 
-	// Remove from map
+	// Remove from map; a supervisor still waiting on the handle sees it's gone
+	handle.deleted = true
+	f.mu.Lock()
 	delete(f.vms, vmID)
+	f.mu.Unlock()
 
 	return nil
 }
 
+// SnapshotRootFS copies a VM's rootfs to destPath so it can be used as a template for new VMs
+func (f *FirecrackerOrchestrator) SnapshotRootFS(ctx context.Context, vmID, destPath string) error {
+	handle, err := f.lookup(vmID)
+	if err != nil {
+		return err
+	}
+
+	if err := copyRootFS(ctx, handle.vm.Config.RootFSPath, destPath); err != nil {
+		return err
+	}
+
+	log.Printf("Saved rootfs snapshot of VM %s to %s", vmID, destPath)
+	return nil
+}
+
+// copyRootFS copies a rootfs image, sharing blocks where the filesystem
+// supports it. The copy is renamed into place, so a half-written image is
+// never used.
+func copyRootFS(ctx context.Context, srcPath, destPath string) error {
+	tmpPath := destPath + ".tmp"
+	cmd := exec.CommandContext(ctx, "cp", "--reflink=auto", srcPath, tmpPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to copy rootfs: %w, output: %s", err, string(output))
+	}
+
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to save rootfs image: %w", err)
+	}
+	return nil
+}
+
 // ListVMs returns all VMs
 func (f *FirecrackerOrchestrator) ListVMs(ctx context.Context) ([]*types.VM, error) {
-	vms := make([]*types.VM, 0, len(f.vms))
+	f.mu.RLock()
+	handles := make([]*vmHandle, 0, len(f.vms))
 	for _, handle := range f.vms {
-		vms = append(vms, handle.vm)
+		handles = append(handles, handle)
+	}
+	f.mu.RUnlock()
+
+	vms := make([]*types.VM, 0, len(handles))
+	for _, handle := range handles {
+		handle.mu.Lock()
+		vm := *handle.vm
+		handle.mu.Unlock()
+		vms = append(vms, &vm)
 	}
 	return vms, nil
 }
@@ -378,15 +703,15 @@ func (f *FirecrackerOrchestrator) Health(ctx context.Context) error {
 	}
 
 	// Check if rootfs template exists (per-VM isolation system)
-	templatePath := "/var/firecracker/rootfs-template.ext4"
-	if _, err := os.Stat(templatePath); os.IsNotExist(err) {
-		return fmt.Errorf("rootfs template not found: %s (init container may not have run)", templatePath)
+	if _, err := os.Stat(defaultRootFSTemplate); os.IsNotExist(err) {
+		return fmt.Errorf("rootfs template not found: %s (init container may not have run)", defaultRootFSTemplate)
 	}
 
 	// Check for excessive orphaned rootfs files
 	orphanedCount := 0
 	vmRootfsFiles, _ := filepath.Glob("/var/firecracker/rootfs-vm-*.ext4")
 
+	f.mu.RLock()
 	activeVMs := len(f.vms)
 
 	// Count orphaned files (VM rootfs exists but VM not in memory)
@@ -400,6 +725,7 @@ func (f *FirecrackerOrchestrator) Health(ctx context.Context) error {
 			orphanedCount++
 		}
 	}
+	f.mu.RUnlock()
 
 	// Warn if orphaned files exceed threshold (may indicate init container cleanup issue)
 	if orphanedCount > 10 {
@@ -447,9 +773,8 @@ func (f *FirecrackerOrchestrator) ProvideSecretsOnBoot(ctx context.Context, vmID
 	log.Printf("Preparing to provide %d secrets to VM %s", len(secrets), vmID)
 
 	// Get VM handle to verify it exists
-	_, exists := f.vms[vmID]
-	if !exists {
-		return fmt.Errorf("VM %s not found", vmID)
+	if _, err := f.lookup(vmID); err != nil {
+		return err
 	}
 
 	// Create vsock listener on host for VM to connect to
@@ -547,5 +872,15 @@ func (f *FirecrackerOrchestrator) ProvideSecretsOnBoot(ctx context.Context, vmID
 	return nil
 }
 
+func init() {
+	vmm.Register("firecracker", func(config map[string]interface{}) (vmm.VMOrchestrator, error) {
+		orchestrator, err := NewFirecrackerOrchestrator(config)
+		if err != nil {
+			return nil, err
+		}
+		return orchestrator, nil
+	})
+}
+
 // Ensure FirecrackerOrchestrator implements vmm.VMOrchestrator
 var _ vmm.VMOrchestrator = (*FirecrackerOrchestrator)(nil)
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
 )
 
 func TestFirecrackerOrchestrator_CreateVM(t *testing.T) {
@@ -184,3 +185,33 @@ func TestFirecrackerOrchestrator_DeleteVM(t *testing.T) {
 		t.Error("Expected error when getting status of deleted VM, got nil")
 	}
 }
+
+// TestSandboxKernelArgs tests that tmpfs workdirs which would add boot
+// parameters of their own are rejected
+func TestSandboxKernelArgs(t *testing.T) {
+	args, err := sandboxKernelArgs(&vmm.SandboxProfile{TmpfsWorkdir: "/workspace", TmpfsSizeMB: 256, RestrictProc: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := " aetherium.tmpfs=/workspace:256 aetherium.hidepid=2"; args != want {
+		t.Errorf("Expected %q, got %q", want, args)
+	}
+
+	for _, dir := range []string{
+		"/w init=/bin/sh",
+		"/w\tinit=/bin/sh",
+		"/w\ninit=/bin/sh",
+		"/w=x",
+		"/w:1024",
+		"/w,exec",
+		`/w"`,
+		"workspace",
+		"/workspace/",
+		"/a/../etc",
+		"/",
+	} {
+		if _, err := sandboxKernelArgs(&vmm.SandboxProfile{TmpfsWorkdir: dir}); err == nil {
+			t.Errorf("Expected tmpfs workdir %q to be rejected", dir)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package firecracker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// minFreeDiskBytes is the free space CheckHost wants where per-VM rootfs
+// copies and snapshots are kept
+const minFreeDiskBytes = 5 << 30
+
+// CheckHost checks that this host can run firecracker VMs: KVM is usable,
+// vsock is available for the agent, the firecracker binary, kernel and
+// rootfs template are present, the VM bridge is up and there is disk space
+// for VM rootfs copies.
+func (f *FirecrackerOrchestrator) CheckHost(ctx context.Context) []vmm.HostCheck {
+	return []vmm.HostCheck{
+		checkKVM(),
+		checkVsock(),
+		checkFirecrackerBinary(),
+		checkFile("kernel", f.config.KernelPath),
+		checkFile("rootfs", defaultRootFSTemplate),
+		checkBridge(f.networkManager.BridgeName()),
+		checkDiskSpace(filepath.Dir(defaultRootFSTemplate), minFreeDiskBytes),
+	}
+}
+
+func checkKVM() vmm.HostCheck {
+	check := vmm.HostCheck{Name: "kvm"}
+	kvm, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0)
+	switch {
+	case os.IsNotExist(err):
+		check.Detail = "/dev/kvm not found: enable virtualization in the BIOS, or nested virtualization on cloud VMs"
+	case err != nil:
+		check.Detail = fmt.Sprintf("/dev/kvm not accessible: %v (add the worker's user to the kvm group)", err)
+	default:
+		kvm.Close()
+		check.OK = true
+		check.Detail = "/dev/kvm is accessible"
+	}
+	return check
+}
+
+func checkVsock() vmm.HostCheck {
+	check := vmm.HostCheck{Name: "vhost-vsock"}
+	if _, err := os.Stat("/dev/vhost-vsock"); err != nil {
+		check.Detail = "/dev/vhost-vsock not found: load the vhost_vsock module (modprobe vhost_vsock)"
+		return check
+	}
+	check.OK = true
+	check.Detail = "/dev/vhost-vsock is present"
+	return check
+}
+
+func checkFirecrackerBinary() vmm.HostCheck {
+	check := vmm.HostCheck{Name: "firecracker"}
+	path := findFirecrackerBinary()
+	if path == "" {
+		check.Detail = "firecracker binary not found in /usr/local/bin, /usr/bin or PATH"
+		return check
+	}
+	check.OK = true
+	check.Detail = path
+	return check
+}
+
+func checkFile(name, path string) vmm.HostCheck {
+	check := vmm.HostCheck{Name: name}
+	info, err := os.Stat(path)
+	switch {
+	case err != nil:
+		check.Detail = fmt.Sprintf("%s not found", path)
+	case info.IsDir():
+		check.Detail = fmt.Sprintf("%s is a directory", path)
+	default:
+		check.OK = true
+		check.Detail = fmt.Sprintf("%s (%d MB)", path, info.Size()>>20)
+	}
+	return check
+}
+
+func checkBridge(name string) vmm.HostCheck {
+	check := vmm.HostCheck{Name: "bridge"}
+	iface, err := net.InterfaceByName(name)
+	switch {
+	case err != nil:
+		check.Detail = fmt.Sprintf("bridge %s not found", name)
+	case iface.Flags&net.FlagUp == 0:
+		check.Detail = fmt.Sprintf("bridge %s is down", name)
+	default:
+		check.OK = true
+		check.Detail = fmt.Sprintf("bridge %s is up", name)
+	}
+	return check
+}
+
+func checkDiskSpace(dir string, minFree uint64) vmm.HostCheck {
+	check := vmm.HostCheck{Name: "disk"}
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		check.Detail = fmt.Sprintf("can't check free space in %s: %v", dir, err)
+		return check
+	}
+
+	free := stat.Bavail * uint64(stat.Bsize)
+	check.Detail = fmt.Sprintf("%d GB free in %s", free>>30, dir)
+	if free < minFree {
+		check.Detail += fmt.Sprintf(", need at least %d GB", minFree>>30)
+		return check
+	}
+	check.OK = true
+	return check
+}
+
+// Ensure FirecrackerOrchestrator implements vmm.HostChecker
+var _ vmm.HostChecker = (*FirecrackerOrchestrator)(nil)
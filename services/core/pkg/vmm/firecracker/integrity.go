@@ -0,0 +1,264 @@
+package firecracker
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// defaultRootFSTemplate is copied for VMs that don't name a template
+const defaultRootFSTemplate = "/var/firecracker/rootfs-template.ext4"
+
+// Where prepare-rootfs-with-tools.sh installs the agent and its signature
+const (
+	agentBinaryPath    = "/usr/local/bin/fc-agent"
+	agentSignaturePath = "/usr/local/bin/fc-agent.sig"
+)
+
+// templateRecord is the registered checksum of a rootfs template. The
+// file's size and change times are kept so that templates which haven't
+// changed since they were verified aren't hashed for every VM.
+type templateRecord struct {
+	checksum string
+	size     int64
+	mtime    syscall.Timespec
+	ctime    syscall.Timespec
+}
+
+// templateRegistry holds the checksums of the rootfs templates in use
+type templateRegistry struct {
+	mu      sync.Mutex
+	records map[string]*templateRecord
+}
+
+// applyIntegrityOptions reads the expected default template checksum and the
+// agent signing key from the configuration; both are optional
+func applyIntegrityOptions(config *Config, configMap map[string]interface{}) error {
+	if checksum, ok := configMap["rootfs_checksum"].(string); ok && checksum != "" {
+		if _, _, err := parseChecksum(checksum); err != nil {
+			return fmt.Errorf("invalid rootfs_checksum: %w", err)
+		}
+		config.RootFSChecksum = strings.ToLower(checksum)
+	}
+
+	if path, ok := configMap["agent_public_key"].(string); ok && path != "" {
+		key, err := loadAgentPublicKey(path)
+		if err != nil {
+			return fmt.Errorf("invalid agent_public_key: %w", err)
+		}
+		config.AgentPublicKey = key
+	}
+	return nil
+}
+
+// loadAgentPublicKey reads a PEM encoded ed25519 public key, as written by
+// "openssl pkey -pubout"
+func loadAgentPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM encoded", path)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 public key", path)
+	}
+	return key, nil
+}
+
+// parseChecksum splits "sha256:<hex>", the only algorithm supported
+func parseChecksum(checksum string) (string, string, error) {
+	algorithm, digest, ok := strings.Cut(checksum, ":")
+	if !ok || algorithm != "sha256" {
+		return "", "", fmt.Errorf("expected sha256:<hex>, got %q", checksum)
+	}
+	if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+		return "", "", fmt.Errorf("invalid sha256 digest %q", digest)
+	}
+	return algorithm, digest, nil
+}
+
+// templatePath returns the template VMs are copied from, given the one
+// named in their metadata
+func templatePath(path string) string {
+	if path == "" {
+		return defaultRootFSTemplate
+	}
+	return path
+}
+
+// RegisterTemplate implements vmm.IntegrityVerifier
+func (f *FirecrackerOrchestrator) RegisterTemplate(ctx context.Context, path string) (string, error) {
+	path = templatePath(path)
+
+	record, err := f.checksumTemplate(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if err := f.verifyTemplateRecord(ctx, path, record); err != nil {
+		return record.checksum, err
+	}
+
+	f.templates.mu.Lock()
+	f.templates.records[path] = record
+	f.templates.mu.Unlock()
+
+	log.Printf("Registered rootfs template %s (%s)", path, record.checksum)
+	return record.checksum, nil
+}
+
+// verifyTemplate checks a template against its registered checksum before a
+// VM is created from it. Templates seen for the first time are registered.
+func (f *FirecrackerOrchestrator) verifyTemplate(ctx context.Context, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("rootfs template not found at %s - ensure init container ran successfully", path)
+	}
+
+	f.templates.mu.Lock()
+	registered := f.templates.records[path]
+	f.templates.mu.Unlock()
+
+	if registered == nil {
+		_, err := f.RegisterTemplate(ctx, path)
+		return err
+	}
+	if registered.unchanged(info) {
+		return nil
+	}
+
+	// The file was touched since it was verified, so hash it again
+	record, err := f.checksumTemplate(ctx, path)
+	if err != nil {
+		return err
+	}
+	if record.checksum != registered.checksum {
+		return &vmm.IntegrityError{
+			Component: vmm.IntegrityRootFS,
+			Path:      path,
+			Reason:    fmt.Sprintf("checksum %s doesn't match registered %s", record.checksum, registered.checksum),
+		}
+	}
+	if err := f.verifyTemplateRecord(ctx, path, record); err != nil {
+		return err
+	}
+
+	f.templates.mu.Lock()
+	f.templates.records[path] = record
+	f.templates.mu.Unlock()
+	return nil
+}
+
+// verifyTemplateRecord checks a freshly hashed template against the
+// configured checksum (default template only) and its agent's signature
+func (f *FirecrackerOrchestrator) verifyTemplateRecord(ctx context.Context, path string, record *templateRecord) error {
+	if path == defaultRootFSTemplate && f.config.RootFSChecksum != "" && record.checksum != f.config.RootFSChecksum {
+		return &vmm.IntegrityError{
+			Component: vmm.IntegrityRootFS,
+			Path:      path,
+			Reason:    fmt.Sprintf("checksum %s doesn't match configured %s", record.checksum, f.config.RootFSChecksum),
+		}
+	}
+	if f.config.AgentPublicKey != nil {
+		return verifyAgent(ctx, path, f.config.AgentPublicKey)
+	}
+	return nil
+}
+
+// checksumTemplate hashes a template file
+func (f *FirecrackerOrchestrator) checksumTemplate(ctx context.Context, path string) (*templateRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rootfs template: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat rootfs template: %w", err)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, &contextReader{ctx: ctx, r: file}); err != nil {
+		return nil, fmt.Errorf("failed to checksum rootfs template: %w", err)
+	}
+
+	record := &templateRecord{
+		checksum: "sha256:" + hex.EncodeToString(hash.Sum(nil)),
+		size:     info.Size(),
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		record.mtime, record.ctime = stat.Mtim, stat.Ctim
+	}
+	return record, nil
+}
+
+// unchanged reports whether a template file is as it was when hashed.
+// The change time can't be set by users, unlike the modification time.
+func (r *templateRecord) unchanged(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && info.Size() == r.size && stat.Mtim == r.mtime && stat.Ctim == r.ctime
+}
+
+// verifyAgent checks the ed25519 signature of the agent binary in a rootfs
+// image, reading both files out of the image with debugfs
+func verifyAgent(ctx context.Context, imagePath string, key ed25519.PublicKey) error {
+	binary, err := readImageFile(ctx, imagePath, agentBinaryPath)
+	if err != nil {
+		return &vmm.IntegrityError{Component: vmm.IntegrityAgent, Path: imagePath, Reason: err.Error()}
+	}
+	signature, err := readImageFile(ctx, imagePath, agentSignaturePath)
+	if err != nil {
+		return &vmm.IntegrityError{Component: vmm.IntegrityAgent, Path: imagePath, Reason: err.Error()}
+	}
+	if !ed25519.Verify(key, binary, signature) {
+		return &vmm.IntegrityError{Component: vmm.IntegrityAgent, Path: imagePath, Reason: "signature doesn't match the agent binary"}
+	}
+	return nil
+}
+
+// readImageFile returns a file from an ext4 image without mounting it
+func readImageFile(ctx context.Context, imagePath, filePath string) ([]byte, error) {
+	output, err := exec.CommandContext(ctx, "debugfs", "-R", "cat "+filePath, imagePath).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	// debugfs reports missing files on stderr and still exits 0
+	if len(output) == 0 {
+		return nil, fmt.Errorf("%s is missing or empty", filePath)
+	}
+	return output, nil
+}
+
+// contextReader stops a long read when ctx is cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
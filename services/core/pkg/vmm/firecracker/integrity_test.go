@@ -0,0 +1,84 @@
+package firecracker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+func newIntegrityOrchestrator() *FirecrackerOrchestrator {
+	return &FirecrackerOrchestrator{
+		config:    &Config{},
+		templates: templateRegistry{records: make(map[string]*templateRecord)},
+	}
+}
+
+func TestVerifyTemplateDetectsChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rootfs.ext4")
+	if err := os.WriteFile(path, []byte("original rootfs"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	orch := newIntegrityOrchestrator()
+	ctx := context.Background()
+
+	checksum, err := orch.RegisterTemplate(ctx, path)
+	if err != nil {
+		t.Fatalf("RegisterTemplate failed: %v", err)
+	}
+	if _, _, err := parseChecksum(checksum); err != nil {
+		t.Fatalf("RegisterTemplate returned invalid checksum %q: %v", checksum, err)
+	}
+
+	if err := orch.verifyTemplate(ctx, path); err != nil {
+		t.Fatalf("Unchanged template failed verification: %v", err)
+	}
+
+	// Touching the file without changing it keeps it valid
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := orch.verifyTemplate(ctx, path); err != nil {
+		t.Fatalf("Touched template failed verification: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("tampered rootfs"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = orch.verifyTemplate(ctx, path)
+	var integrityErr *vmm.IntegrityError
+	if !errors.As(err, &integrityErr) || integrityErr.Component != vmm.IntegrityRootFS {
+		t.Fatalf("Expected rootfs integrity error, got %v", err)
+	}
+}
+
+func TestApplyIntegrityOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  bool
+	}{
+		{"unset", "", false},
+		{"valid", "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", false},
+		{"uppercase", "sha256:E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855", false},
+		{"wrong algorithm", "md5:d41d8cd98f00b204e9800998ecf8427e", true},
+		{"short digest", "sha256:e3b0c442", true},
+		{"no algorithm", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{}
+			err := applyIntegrityOptions(config, map[string]interface{}{"rootfs_checksum": tt.checksum})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyIntegrityOptions(%q) error = %v, wantErr %v", tt.checksum, err, tt.wantErr)
+			}
+		})
+	}
+}
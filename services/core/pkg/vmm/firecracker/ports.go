@@ -0,0 +1,150 @@
+package firecracker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// agentRequest and agentResponse are the agent's typed protocol, used for
+// requests other than plain commands
+type agentRequest struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type agentResponse struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// ListPorts returns the TCP ports a VM listens on outside loopback, as
+// reported by its agent
+func (f *FirecrackerOrchestrator) ListPorts(ctx context.Context, vmID string) ([]int, error) {
+	var result struct {
+		Ports []int `json:"ports"`
+	}
+	if err := f.agentRequest(ctx, vmID, "list_ports", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Ports, nil
+}
+
+// ListSockets returns a VM's listening TCP sockets, as reported by its agent
+func (f *FirecrackerOrchestrator) ListSockets(ctx context.Context, vmID string) ([]vmm.SocketInfo, error) {
+	var result struct {
+		Sockets []vmm.SocketInfo `json:"sockets"`
+	}
+	if err := f.agentRequest(ctx, vmID, "list_ports", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Sockets, nil
+}
+
+// ListProcesses returns a VM's user-space processes, as reported by its agent
+func (f *FirecrackerOrchestrator) ListProcesses(ctx context.Context, vmID string) ([]vmm.ProcessInfo, error) {
+	var result struct {
+		Processes []vmm.ProcessInfo `json:"processes"`
+	}
+	if err := f.agentRequest(ctx, vmID, "list_processes", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Processes, nil
+}
+
+// SignalProcess sends a signal to a process in a VM through its agent
+func (f *FirecrackerOrchestrator) SignalProcess(ctx context.Context, vmID string, pid int, signal string) error {
+	payload := map[string]interface{}{"pid": pid, "signal": signal}
+	err := f.agentRequest(ctx, vmID, "signal_process", payload, nil)
+	if err != nil && strings.Contains(err.Error(), "no such process") {
+		return fmt.Errorf("%w: %d", vmm.ErrProcessNotFound, pid)
+	}
+	return err
+}
+
+// agentRequest sends a typed request to a VM's agent and decodes the
+// response payload into result, if given
+func (f *FirecrackerOrchestrator) agentRequest(ctx context.Context, vmID, requestType string, payload, result interface{}) error {
+	handle, err := f.runningHandle(vmID)
+	if err != nil {
+		return err
+	}
+
+	conn, err := f.connectViaVsock(ctx, handle, 5*time.Second)
+	if err != nil {
+		if handle.ipAddress == "" {
+			return err
+		}
+		if conn, err = f.connectViaTCP(ctx, handle, 10*time.Second); err != nil {
+			return err
+		}
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	req := agentRequest{Type: requestType}
+	if payload != nil {
+		if req.Payload, err = json.Marshal(payload); err != nil {
+			return fmt.Errorf("failed to marshal %s payload: %w", requestType, err)
+		}
+	}
+	data, _ := json.Marshal(req)
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	var resp agentResponse
+	if err := json.Unmarshal([]byte(line), &resp); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("agent error: %s", resp.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Payload, result); err != nil {
+		return fmt.Errorf("failed to parse %s response: %w", requestType, err)
+	}
+	return nil
+}
+
+// DialPort connects to a port of a VM over the bridge network
+func (f *FirecrackerOrchestrator) DialPort(ctx context.Context, vmID string, port int) (net.Conn, error) {
+	handle, err := f.runningHandle(vmID)
+	if err != nil {
+		return nil, err
+	}
+	if handle.ipAddress == "" {
+		return nil, fmt.Errorf("VM %s has no network", vmID)
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	return dialer.DialContext(ctx, "tcp", net.JoinHostPort(handle.ipAddress, strconv.Itoa(port)))
+}
+
+// runningHandle returns the handle of a running VM, unlocked. Commands
+// and connections to the guest don't change its state.
+func (f *FirecrackerOrchestrator) runningHandle(vmID string) (*vmHandle, error) {
+	handle, err := f.lookup(vmID)
+	if err != nil {
+		return nil, err
+	}
+	if status := handle.status(); status != types.VMStatusRunning {
+		return nil, fmt.Errorf("VM %s is not running (status: %s)", vmID, status)
+	}
+	return handle, nil
+}
@@ -0,0 +1,281 @@
+package firecracker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+	"github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+)
+
+// snapshotExitTimeout bounds waiting for a paused VM's process to exit
+const snapshotExitTimeout = 10 * time.Second
+
+// snapshotDir is where a paused VM's snapshot is kept
+func (f *FirecrackerOrchestrator) snapshotDir(vmID string) string {
+	return filepath.Join(f.config.StateDir, "snapshots", vmID)
+}
+
+// snapshotPaths returns the memory and VM state files of a VM's snapshot
+func (f *FirecrackerOrchestrator) snapshotPaths(vmID string) (memPath, statePath string) {
+	dir := f.snapshotDir(vmID)
+	return filepath.Join(dir, "mem"), filepath.Join(dir, "vmstate")
+}
+
+// hasSnapshot reports whether both files of a VM's snapshot exist
+func (f *FirecrackerOrchestrator) hasSnapshot(vmID string) bool {
+	memPath, statePath := f.snapshotPaths(vmID)
+	for _, path := range []string{memPath, statePath} {
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// removeSnapshot deletes a VM's snapshot, if any
+func (f *FirecrackerOrchestrator) removeSnapshot(vmID string) {
+	if err := os.RemoveAll(f.snapshotDir(vmID)); err != nil {
+		log.Printf("Warning: failed to remove snapshot of VM %s: %v", vmID, err)
+	}
+}
+
+// PauseVM snapshots a running VM to disk and stops its firecracker process,
+// freeing its CPU and memory. The rootfs and TAP device are kept, so
+// ResumeVM continues the guest with its disk, IP and open connections'
+// state as they were.
+func (f *FirecrackerOrchestrator) PauseVM(ctx context.Context, vmID string) error {
+	handle, err := f.lockVM(vmID)
+	if err != nil {
+		return err
+	}
+	defer handle.mu.Unlock()
+
+	if handle.vm.Status != types.VMStatusRunning {
+		return fmt.Errorf("VM %s is %s, only running VMs can be paused", vmID, handle.vm.Status)
+	}
+
+	dir := f.snapshotDir(vmID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	memPath, statePath := f.snapshotPaths(vmID)
+
+	if err := f.snapshotVM(ctx, handle, memPath, statePath); err != nil {
+		f.removeSnapshot(vmID)
+		return err
+	}
+
+	// Leave running first, so supervise doesn't report the exit as a crash
+	if err := handle.vm.Transition(types.VMStatusPaused); err != nil {
+		return err
+	}
+
+	if err := f.stopSnapshottedVM(handle); err != nil {
+		log.Printf("Warning: failed to stop firecracker process of paused VM %s: %v", vmID, err)
+	}
+	os.Remove(handle.vm.Config.SocketPath)
+	os.Remove(handle.vm.Config.SocketPath + ".vsock")
+	handle.machine = nil
+	handle.pid = 0
+
+	// Keep the state file, so a restarted worker can still resume the VM
+	if err := f.saveVMState(handle); err != nil {
+		log.Printf("Warning: failed to save state for VM %s (it can't be resumed after a worker restart): %v", vmID, err)
+	}
+
+	log.Printf("Paused VM %s, snapshot saved to %s", vmID, dir)
+	return nil
+}
+
+// snapshotVM pauses the guest and writes its snapshot. If the snapshot
+// fails, the guest is resumed.
+func (f *FirecrackerOrchestrator) snapshotVM(ctx context.Context, handle *vmHandle, memPath, statePath string) error {
+	var pause, snapshot func() error
+	if handle.machine == nil {
+		// Adopted VM: no SDK machine, use the API socket directly
+		client := NewFirecrackerClient(handle.vm.Config.SocketPath)
+		pause = client.PauseVM
+		snapshot = func() error { return client.CreateSnapshot(memPath, statePath) }
+	} else {
+		machine := handle.machine
+		pause = func() error { return machine.PauseVM(ctx) }
+		snapshot = func() error { return machine.CreateSnapshot(ctx, memPath, statePath) }
+	}
+
+	if err := pause(); err != nil {
+		return classifyAPIError("pause VM", 1, err)
+	}
+	if err := snapshot(); err != nil {
+		if resumeErr := resumeGuest(handle); resumeErr != nil {
+			log.Printf("Warning: failed to resume VM %s after its snapshot failed: %v", handle.vm.ID, resumeErr)
+		}
+		return classifyAPIError("snapshot VM", 1, err)
+	}
+	return nil
+}
+
+// resumeGuest continues a guest paused by snapshotVM
+func resumeGuest(handle *vmHandle) error {
+	if handle.machine == nil {
+		return NewFirecrackerClient(handle.vm.Config.SocketPath).ResumeVM()
+	}
+	return handle.machine.ResumeVM(context.Background())
+}
+
+// stopSnapshottedVM ends the firecracker process of a VM whose snapshot
+// was taken, and waits for it to exit so the snapshot's sockets are free
+func (f *FirecrackerOrchestrator) stopSnapshottedVM(handle *vmHandle) error {
+	if handle.machine != nil {
+		if err := handle.machine.StopVMM(); err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), snapshotExitTimeout)
+		defer cancel()
+		// The process exits with the kill's error; only the exit matters
+		handle.machine.Wait(ctx)
+		if ctx.Err() != nil {
+			return fmt.Errorf("process did not exit")
+		}
+		return nil
+	}
+
+	if err := syscall.Kill(handle.pid, syscall.SIGTERM); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	deadline := time.Now().Add(snapshotExitTimeout)
+	for firecrackerRunning(handle.pid, handle.vm.Config.SocketPath) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("process %d did not exit", handle.pid)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil
+}
+
+// ResumeVM boots a new firecracker process from a paused VM's snapshot and
+// resumes the guest. The snapshot is deleted once the VM is running again.
+func (f *FirecrackerOrchestrator) ResumeVM(ctx context.Context, vmID string) error {
+	handle, err := f.lockVM(vmID)
+	if err != nil {
+		return err
+	}
+	defer handle.mu.Unlock()
+
+	if handle.vm.Status != types.VMStatusPaused {
+		return fmt.Errorf("VM %s is %s, only paused VMs can be resumed", vmID, handle.vm.Status)
+	}
+	if !f.hasSnapshot(vmID) {
+		return fmt.Errorf("VM %s can't be resumed: its snapshot is missing", vmID)
+	}
+
+	memPath, statePath := f.snapshotPaths(vmID)
+	if err := f.bootSnapshot(ctx, handle, memPath, statePath); err != nil {
+		return err
+	}
+	f.removeSnapshot(vmID)
+
+	log.Printf("Resumed VM %s from its snapshot", vmID)
+	return nil
+}
+
+// bootSnapshot starts a new firecracker process for a paused VM from a
+// snapshot's memory and state files and resumes the guest. The handle must
+// be locked.
+func (f *FirecrackerOrchestrator) bootSnapshot(ctx context.Context, handle *vmHandle, memPath, statePath string) error {
+	if err := handle.vm.Transition(types.VMStatusStarting); err != nil {
+		return err
+	}
+
+	// The snapshot refers to the sockets by path; they must not exist yet
+	os.Remove(handle.vm.Config.SocketPath)
+	os.Remove(handle.vm.Config.SocketPath + ".vsock")
+
+	machine, err := firecracker.NewMachine(context.Background(), f.resumeConfig(handle),
+		firecracker.WithSnapshot(memPath, statePath))
+	if err != nil {
+		handle.vm.Transition(types.VMStatusFailed)
+		return fmt.Errorf("failed to create firecracker machine: %w", err)
+	}
+
+	// Use context.Background() so the VM process outlives the request
+	if err := machine.Start(context.Background()); err != nil {
+		machine.StopVMM()
+		handle.vm.Transition(types.VMStatusFailed)
+		return fmt.Errorf("failed to restore VM: %w", classifyAPIError("load snapshot", 1, err))
+	}
+	if err := machine.ResumeVM(ctx); err != nil {
+		machine.StopVMM()
+		handle.vm.Transition(types.VMStatusFailed)
+		return fmt.Errorf("failed to resume VM: %w", classifyAPIError("resume VM", 1, err))
+	}
+
+	handle.machine = machine
+	if err := handle.vm.Transition(types.VMStatusRunning); err != nil {
+		return err
+	}
+
+	if pid, err := machine.PID(); err == nil {
+		handle.pid = pid
+		if err := f.saveVMState(handle); err != nil {
+			log.Printf("Warning: failed to save state for VM %s (it won't survive a worker restart): %v", handle.vm.ID, err)
+		}
+	}
+
+	handle.boots++
+	go f.supervise(handle, handle.boots, func() error {
+		return machine.Wait(context.Background())
+	})
+	return nil
+}
+
+// resumeConfig returns the machine configuration a paused VM's snapshot is
+// loaded with. The snapshot holds the kernel, drives and devices; the
+// configuration only needs to match their paths. VMs adopted from a previous
+// worker run have no configuration kept, so one is rebuilt from the VM.
+func (f *FirecrackerOrchestrator) resumeConfig(handle *vmHandle) firecracker.Config {
+	if handle.fcConfig != nil {
+		return *handle.fcConfig
+	}
+
+	config := handle.vm.Config
+	fcConfig := firecracker.Config{
+		SocketPath:      config.SocketPath,
+		KernelImagePath: config.KernelPath,
+		Drives: []models.Drive{
+			{
+				DriveID:      firecracker.String("rootfs"),
+				PathOnHost:   firecracker.String(config.RootFSPath),
+				IsRootDevice: firecracker.Bool(true),
+				IsReadOnly:   firecracker.Bool(false),
+			},
+		},
+		MachineCfg: models.MachineConfiguration{
+			VcpuCount:  firecracker.Int64(int64(config.VCPUCount)),
+			MemSizeMib: firecracker.Int64(int64(config.MemoryMB)),
+		},
+		VsockDevices: []firecracker.VsockDevice{
+			{Path: config.SocketPath + ".vsock", CID: uint32(3)},
+		},
+		LogPath:        config.SocketPath + ".log",
+		LogLevel:       "Debug",
+		ForwardSignals: []os.Signal{},
+	}
+	if handle.tap != nil {
+		fcConfig.NetworkInterfaces = []firecracker.NetworkInterface{
+			{
+				StaticConfiguration: &firecracker.StaticNetworkConfiguration{
+					MacAddress:  handle.tap.MACAddr,
+					HostDevName: handle.tap.Name,
+				},
+			},
+		}
+	}
+	return fcConfig
+}
@@ -0,0 +1,118 @@
+package firecracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+)
+
+// adoptedPollInterval is how often an adopted VM's process is checked. It
+// isn't a child of this worker, so it can't be waited on.
+const adoptedPollInterval = 2 * time.Second
+
+// errAdoptedExit is reported for adopted VMs, whose exit status is unknown
+var errAdoptedExit = errors.New("process exited (exit status unavailable for adopted VMs)")
+
+// SetExitHandler sets the function called when a VM's firecracker process
+// exits without StopVM or DeleteVM having been called
+func (f *FirecrackerOrchestrator) SetExitHandler(fn func(exit vmm.VMExit)) {
+	f.exitHandler = fn
+}
+
+// supervise waits for a VM's firecracker process to exit. If the VM was
+// still meant to be running on that process, it is marked crashed, its stale
+// sockets and runtime state are removed and the exit handler is told. boot
+// is the handle's boot count when the process was started.
+func (f *FirecrackerOrchestrator) supervise(handle *vmHandle, boot int, wait func() error) {
+	err := wait()
+
+	handle.mu.Lock()
+	// StopVM, PauseVM and DeleteVM move the VM out of running before
+	// signalling the process, and hold the handle until they are done.
+	// A later boot has its own supervisor.
+	if handle.deleted || handle.boots != boot || handle.vm.Status != types.VMStatusRunning {
+		handle.mu.Unlock()
+		return
+	}
+
+	vmID := handle.vm.ID
+	reason := "process exited"
+	if err != nil {
+		reason = err.Error()
+	}
+	log.Printf("VM %s: firecracker process (pid %d) exited unexpectedly: %s", vmID, handle.pid, reason)
+
+	if err := handle.vm.Transition(types.VMStatusCrashed); err != nil {
+		handle.mu.Unlock()
+		log.Printf("Warning: failed to mark VM %s as crashed: %v", vmID, err)
+		return
+	}
+	now := time.Now()
+	handle.vm.StoppedAt = &now
+
+	os.Remove(handle.vm.Config.SocketPath)
+	os.Remove(handle.vm.Config.SocketPath + ".vsock")
+	f.removeVMState(vmID)
+	restartable := handle.fcConfig != nil
+	handle.mu.Unlock()
+
+	// Unlocked, as the handler may restart the VM
+	if f.exitHandler != nil {
+		f.exitHandler(vmm.VMExit{
+			VMID:        vmID,
+			Reason:      reason,
+			ExitedAt:    now,
+			Restartable: restartable,
+		})
+	}
+}
+
+// waitForAdoptedExit blocks until an adopted firecracker process is gone
+func waitForAdoptedExit(pid int, socketPath string) error {
+	for firecrackerRunning(pid, socketPath) {
+		time.Sleep(adoptedPollInterval)
+	}
+	return errAdoptedExit
+}
+
+// RestartVM boots a crashed VM again with its original machine configuration.
+// The rootfs and TAP device are reused, so the guest keeps its disk and IP.
+// VMs stopped or deleted since they crashed aren't restarted; vmm.ErrVMStopped
+// is returned.
+func (f *FirecrackerOrchestrator) RestartVM(ctx context.Context, vmID string) error {
+	handle, err := f.lockVM(vmID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", vmm.ErrVMStopped, err)
+	}
+	defer handle.mu.Unlock()
+
+	if handle.vm.Status == types.VMStatusStopped {
+		return fmt.Errorf("%w: VM %s", vmm.ErrVMStopped, vmID)
+	}
+	if handle.vm.Status != types.VMStatusCrashed {
+		return fmt.Errorf("VM %s is %s, only crashed VMs can be restarted", vmID, handle.vm.Status)
+	}
+	if handle.fcConfig == nil {
+		return fmt.Errorf("VM %s can't be restarted: its machine configuration is unknown", vmID)
+	}
+
+	machine, err := firecracker.NewMachine(context.Background(), *handle.fcConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create firecracker machine: %w", err)
+	}
+	handle.machine = machine
+	handle.pid = 0
+	handle.vm.StoppedAt = nil
+
+	return f.startVM(ctx, handle)
+}
+
+// Ensure FirecrackerOrchestrator implements vmm.Supervisor
+var _ vmm.Supervisor = (*FirecrackerOrchestrator)(nil)
@@ -0,0 +1,153 @@
+package firecracker
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// superviseSleep registers a running VM backed by a sleep process, standing
+// in for firecracker, and supervises it. The returned channel is closed
+// once supervise has returned.
+func superviseSleep(t *testing.T, f *FirecrackerOrchestrator, vmID string) (*exec.Cmd, <-chan struct{}) {
+	t.Helper()
+
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("sleep not available: %v", err)
+	}
+
+	handle := &vmHandle{
+		vm: &types.VM{
+			ID:     vmID,
+			Status: types.VMStatusRunning,
+			Config: types.VMConfig{
+				ID:         vmID,
+				SocketPath: filepath.Join(t.TempDir(), vmID+".sock"),
+			},
+		},
+		pid:   cmd.Process.Pid,
+		boots: 1,
+	}
+	f.mu.Lock()
+	f.vms[vmID] = handle
+	f.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.supervise(handle, handle.boots, cmd.Wait)
+	}()
+	return cmd, done
+}
+
+func newSupervisedOrchestrator(t *testing.T) (*FirecrackerOrchestrator, *[]vmm.VMExit, *sync.Mutex) {
+	var (
+		mu    sync.Mutex
+		exits []vmm.VMExit
+	)
+	f := &FirecrackerOrchestrator{
+		config: &Config{StateDir: t.TempDir()},
+		vms:    make(map[string]*vmHandle),
+	}
+	f.SetExitHandler(func(exit vmm.VMExit) {
+		mu.Lock()
+		exits = append(exits, exit)
+		mu.Unlock()
+	})
+	return f, &exits, &mu
+}
+
+func TestSuperviseReportsCrash(t *testing.T) {
+	f, exits, mu := newSupervisedOrchestrator(t)
+	cmd, done := superviseSleep(t, f, "crash-vm")
+
+	cmd.Process.Kill()
+	<-done
+
+	vm, err := f.GetVMStatus(context.Background(), "crash-vm")
+	if err != nil {
+		t.Fatalf("GetVMStatus() error = %v", err)
+	}
+	if vm.Status != types.VMStatusCrashed {
+		t.Errorf("status = %s, want %s", vm.Status, types.VMStatusCrashed)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(*exits) != 1 || (*exits)[0].VMID != "crash-vm" {
+		t.Fatalf("exits = %+v, want one for crash-vm", *exits)
+	}
+}
+
+func TestStopVMWhileProcessExits(t *testing.T) {
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		f, exits, mu := newSupervisedOrchestrator(t)
+		cmd, done := superviseSleep(t, f, "race-vm")
+
+		// The process dies on its own while StopVM signals it, and a
+		// status poll reads the VM throughout
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			syscall.Kill(cmd.Process.Pid, syscall.SIGKILL)
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				f.GetVMStatus(ctx, "race-vm")
+			}
+		}()
+		if err := f.StopVM(ctx, "race-vm", true); err != nil {
+			t.Fatalf("StopVM() error = %v", err)
+		}
+		wg.Wait()
+		<-done
+
+		vm, err := f.GetVMStatus(ctx, "race-vm")
+		if err != nil {
+			t.Fatalf("GetVMStatus() error = %v", err)
+		}
+		if vm.Status != types.VMStatusStopped {
+			t.Fatalf("status = %s, want %s", vm.Status, types.VMStatusStopped)
+		}
+
+		// If the crash was seen first, restarting must now be refused
+		mu.Lock()
+		crashed := len(*exits) > 0
+		mu.Unlock()
+		if crashed {
+			if err := f.RestartVM(ctx, "race-vm"); !errors.Is(err, vmm.ErrVMStopped) {
+				t.Fatalf("RestartVM() error = %v, want ErrVMStopped", err)
+			}
+		}
+	}
+}
+
+func TestRestartVMAfterStop(t *testing.T) {
+	f, _, _ := newSupervisedOrchestrator(t)
+	_, done := superviseSleep(t, f, "stopped-vm")
+	ctx := context.Background()
+
+	if err := f.StopVM(ctx, "stopped-vm", true); err != nil {
+		t.Fatalf("StopVM() error = %v", err)
+	}
+	<-done
+
+	if err := f.RestartVM(ctx, "stopped-vm"); !errors.Is(err, vmm.ErrVMStopped) {
+		t.Errorf("RestartVM() error = %v, want ErrVMStopped", err)
+	}
+	if err := f.RestartVM(ctx, "missing-vm"); !errors.Is(err, vmm.ErrVMStopped) {
+		t.Errorf("RestartVM() of unknown VM error = %v, want ErrVMStopped", err)
+	}
+}
@@ -0,0 +1,97 @@
+package firecracker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// streamConn is an agent connection handed over to a stream, such as a
+// terminal or an archive. Reads go through the reader the agent's response
+// was read with, which may hold the start of the stream.
+type streamConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *streamConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// OpenTerminal starts a shell on a pseudo-terminal in a VM through its
+// agent. Once the agent accepts, the connection carries terminal frames.
+func (f *FirecrackerOrchestrator) OpenTerminal(ctx context.Context, vmID string, req *vmm.TerminalRequest) (io.ReadWriteCloser, error) {
+	conn, err := f.handOver(ctx, vmID, "terminal", req)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// handOver sends a request that hands the agent connection over to a stream
+// and returns the connection once the agent accepts. The stream has no
+// deadline; it lasts until either side closes it.
+func (f *FirecrackerOrchestrator) handOver(ctx context.Context, vmID, requestType string, req interface{}) (*streamConn, error) {
+	handle, err := f.runningHandle(vmID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := f.connectViaVsock(ctx, handle, 5*time.Second)
+	if err != nil {
+		if handle.ipAddress == "" {
+			return nil, err
+		}
+		if conn, err = f.connectViaTCP(ctx, handle, 10*time.Second); err != nil {
+			return nil, err
+		}
+	}
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to marshal %s request: %w", requestType, err)
+	}
+	data, _ := json.Marshal(agentRequest{Type: requestType, Payload: payload})
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+	if err := readAgentResult(reader, nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	return &streamConn{Conn: conn, reader: reader}, nil
+}
+
+// readAgentResult reads an agent response, decoding its payload into v if set
+func readAgentResult(reader *bufio.Reader, v interface{}) error {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	var resp agentResponse
+	if err := json.Unmarshal([]byte(line), &resp); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("agent error: %s", resp.Error)
+	}
+	if v != nil && len(resp.Payload) > 0 {
+		if err := json.Unmarshal(resp.Payload, v); err != nil {
+			return fmt.Errorf("failed to parse response payload: %w", err)
+		}
+	}
+	return nil
+}
@@ -34,6 +34,24 @@ const (
 	ActionSendCtrlAltDel = "SendCtrlAltDel"
 )
 
+// VMState pauses or resumes a running VM
+type VMState struct {
+	State string `json:"state"` // VMStatePaused or VMStateResumed
+}
+
+// VM states
+const (
+	VMStatePaused  = "Paused"
+	VMStateResumed = "Resumed"
+)
+
+// SnapshotCreateParams saves a paused VM's memory and device state
+type SnapshotCreateParams struct {
+	MemFilePath  string `json:"mem_file_path"`
+	SnapshotPath string `json:"snapshot_path"`
+	SnapshotType string `json:"snapshot_type,omitempty"` // Full (default) or Diff
+}
+
 // InstanceInfo contains VM state information
 type InstanceInfo struct {
 	State        string `json:"state"`
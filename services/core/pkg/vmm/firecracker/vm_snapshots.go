@@ -0,0 +1,127 @@
+package firecracker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// vmSnapshotsDir is where the snapshots taken with SnapshotVM of a VM are kept
+func (f *FirecrackerOrchestrator) vmSnapshotsDir(vmID string) string {
+	return filepath.Join(f.config.StateDir, "vm-snapshots", vmID)
+}
+
+// vmSnapshotPaths returns the memory, VM state and rootfs files of a snapshot
+func (f *FirecrackerOrchestrator) vmSnapshotPaths(vmID, snapshotID string) (memPath, statePath, rootfsPath string) {
+	dir := filepath.Join(f.vmSnapshotsDir(vmID), snapshotID)
+	return filepath.Join(dir, "mem"), filepath.Join(dir, "vmstate"), filepath.Join(dir, "rootfs.ext4")
+}
+
+// removeVMSnapshots deletes all snapshots of a VM
+func (f *FirecrackerOrchestrator) removeVMSnapshots(vmID string) {
+	if err := os.RemoveAll(f.vmSnapshotsDir(vmID)); err != nil {
+		log.Printf("Warning: failed to remove snapshots of VM %s: %v", vmID, err)
+	}
+}
+
+// SnapshotVM checkpoints a running VM: its memory and device state, and a
+// copy of its rootfs taken while the guest is paused, so the disk matches
+// the memory. The guest is resumed afterwards.
+func (f *FirecrackerOrchestrator) SnapshotVM(ctx context.Context, vmID, snapshotID string) (int64, error) {
+	handle, err := f.lockVM(vmID)
+	if err != nil {
+		return 0, err
+	}
+	defer handle.mu.Unlock()
+
+	if handle.vm.Status != types.VMStatusRunning {
+		return 0, fmt.Errorf("VM %s is %s, only running VMs can be snapshotted", vmID, handle.vm.Status)
+	}
+
+	memPath, statePath, rootfsPath := f.vmSnapshotPaths(vmID, snapshotID)
+	dir := filepath.Dir(memPath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return 0, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	// snapshotVM leaves the guest paused when it succeeds
+	if err := f.snapshotVM(ctx, handle, memPath, statePath); err != nil {
+		os.RemoveAll(dir)
+		return 0, err
+	}
+	copyErr := copyRootFS(ctx, handle.vm.Config.RootFSPath, rootfsPath)
+	if err := resumeGuest(handle); err != nil {
+		log.Printf("Warning: failed to resume VM %s after its snapshot: %v", vmID, err)
+	}
+	if copyErr != nil {
+		os.RemoveAll(dir)
+		return 0, copyErr
+	}
+
+	var size int64
+	for _, path := range []string{memPath, statePath, rootfsPath} {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+
+	log.Printf("Snapshotted VM %s as %s (%d MB)", vmID, snapshotID, size>>20)
+	return size, nil
+}
+
+// RestoreVM returns a VM to a snapshot taken with SnapshotVM. The VM's
+// firecracker process is stopped, its rootfs replaced with the snapshot's
+// and a new process booted from the snapshot's memory. A paused VM's pause
+// snapshot is discarded. The snapshot is kept, so the VM can be restored to
+// it again.
+func (f *FirecrackerOrchestrator) RestoreVM(ctx context.Context, vmID, snapshotID string) error {
+	handle, err := f.lockVM(vmID)
+	if err != nil {
+		return err
+	}
+	defer handle.mu.Unlock()
+
+	memPath, statePath, rootfsPath := f.vmSnapshotPaths(vmID, snapshotID)
+	for _, path := range []string{memPath, statePath, rootfsPath} {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("snapshot %s of VM %s not found on this worker", snapshotID, vmID)
+		}
+	}
+
+	switch handle.vm.Status {
+	case types.VMStatusRunning:
+		// Leave running first, so supervise doesn't report the exit as a crash
+		if err := handle.vm.Transition(types.VMStatusPaused); err != nil {
+			return err
+		}
+		if err := f.stopSnapshottedVM(handle); err != nil {
+			handle.vm.Transition(types.VMStatusFailed)
+			return fmt.Errorf("failed to stop VM %s: %w", vmID, err)
+		}
+		handle.machine = nil
+		handle.pid = 0
+	case types.VMStatusPaused:
+		f.removeSnapshot(vmID)
+	default:
+		return fmt.Errorf("VM %s is %s, only running or paused VMs can be restored", vmID, handle.vm.Status)
+	}
+
+	if err := copyRootFS(ctx, rootfsPath, handle.vm.Config.RootFSPath); err != nil {
+		handle.vm.Transition(types.VMStatusFailed)
+		return err
+	}
+	if err := f.bootSnapshot(ctx, handle, memPath, statePath); err != nil {
+		return err
+	}
+
+	log.Printf("Restored VM %s to snapshot %s", vmID, snapshotID)
+	return nil
+}
+
+// Ensure FirecrackerOrchestrator implements vmm.Snapshotter
+var _ vmm.Snapshotter = (*FirecrackerOrchestrator)(nil)
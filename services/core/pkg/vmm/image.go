@@ -0,0 +1,32 @@
+package vmm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// imageReference matches a docker image reference: an optional registry
+// host and port, lowercase path components, then an optional tag and digest.
+// It follows the grammar of github.com/distribution/reference.
+var imageReference = regexp.MustCompile(`^` +
+	// Registry, e.g. registry.example.com:5000/
+	`(?:(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(?::[0-9]+)?/)?` +
+	// Repository path, e.g. library/ubuntu
+	`[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*` +
+	// Tag and digest
+	`(?::[\w][\w.-]{0,127})?(?:@[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,})?` +
+	`$`)
+
+// ValidateImage checks that image is a docker image reference. Images are
+// passed to docker run as an argument, so one that looks like a flag, such
+// as --privileged, must never get there.
+func ValidateImage(image string) error {
+	if image == "" {
+		return fmt.Errorf("image is required")
+	}
+	if strings.HasPrefix(image, "-") || len(image) > 512 || !imageReference.MatchString(image) {
+		return fmt.Errorf("invalid image reference %q", image)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package vmm
+
+import "testing"
+
+// TestValidateImage tests that image references are accepted and that
+// anything docker run could read as a flag is rejected
+func TestValidateImage(t *testing.T) {
+	valid := []string{
+		"ubuntu",
+		"ubuntu:22.04",
+		"library/python:3.12-slim",
+		"ghcr.io/acme/tools/builder:v1.2.3",
+		"registry.example.com:5000/team/app",
+		"localhost/app:dev",
+		"alpine@sha256:c5b1261d6d3e43071626931fc004f70149baeba2c8ec672bd4f27761f8e1ad6b",
+		"alpine:3.20@sha256:c5b1261d6d3e43071626931fc004f70149baeba2c8ec672bd4f27761f8e1ad6b",
+	}
+	for _, image := range valid {
+		if err := ValidateImage(image); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", image, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"--privileged",
+		"-v=/:/host",
+		"-it",
+		"Ubuntu",
+		"ubuntu latest",
+		"ubuntu:-tag",
+		"ubuntu:",
+		"/ubuntu",
+		"ubuntu/",
+		"ubuntu\n--privileged",
+		"alpine@sha256:xyz",
+	}
+	for _, image := range invalid {
+		if err := ValidateImage(image); err == nil {
+			t.Errorf("Expected %q to be rejected", image)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package vmm
 
 import (
 	"context"
+	"errors"
+	"net"
+	"time"
 
 	"github.com/aetherium/aetherium/libs/types/pkg/domain"
 )
@@ -27,6 +30,13 @@ type VMOrchestrator interface {
 	// ExecuteCommand executes a command inside a VM
 	ExecuteCommand(ctx context.Context, vmID string, cmd *Command) (*ExecResult, error)
 
+	// PauseVM suspends a running VM, saving its memory and device state so
+	// it stops using CPU and memory until resumed
+	PauseVM(ctx context.Context, vmID string) error
+
+	// ResumeVM continues a paused VM from where it was paused
+	ResumeVM(ctx context.Context, vmID string) error
+
 	// DeleteVM destroys a VM and cleans up resources
 	DeleteVM(ctx context.Context, vmID string) error
 
@@ -37,6 +47,127 @@ type VMOrchestrator interface {
 	Health(ctx context.Context) error
 }
 
+// Adopter is implemented by orchestrators whose VMs can outlive the worker
+// process. Adopt re-attaches to VMs left running by a previous run and
+// returns them; it should be called once, before any VMs are created.
+// Detach persists what the next run needs to adopt the current VMs and
+// leaves them running; it is called when the worker exits.
+type Adopter interface {
+	Adopt(ctx context.Context) ([]*types.VM, error)
+	Detach(ctx context.Context) error
+}
+
+// VMExit describes a VM whose process exited without being stopped
+type VMExit struct {
+	VMID     string
+	Reason   string // Exit status or error reported for the process
+	ExitedAt time.Time
+	// Restartable is false when the orchestrator can't boot the VM again,
+	// e.g. for VMs adopted from a previous worker run
+	Restartable bool
+}
+
+// Supervisor is implemented by orchestrators that watch their VM processes.
+// The exit handler is called from a background goroutine, after the VM has
+// moved to VMStatusCrashed. RestartVM boots a crashed VM again with the same
+// configuration and rootfs; it returns ErrVMStopped if the VM was stopped or
+// deleted in the meantime.
+type Supervisor interface {
+	SetExitHandler(fn func(exit VMExit))
+	RestartVM(ctx context.Context, vmID string) error
+}
+
+// PortForwarder is implemented by orchestrators that can reach the network
+// services of their VMs. ListPorts asks a VM's agent which TCP ports it
+// listens on; DialPort connects to one of them from the host.
+type PortForwarder interface {
+	ListPorts(ctx context.Context, vmID string) ([]int, error)
+	DialPort(ctx context.Context, vmID string, port int) (net.Conn, error)
+}
+
+// Inspector is implemented by orchestrators whose VM agents report what
+// runs inside the VM: its user-space processes and listening TCP sockets.
+// SignalProcess sends one of ProcessSignals to a process; it fails with
+// ErrProcessNotFound if the process is gone.
+type Inspector interface {
+	ListProcesses(ctx context.Context, vmID string) ([]ProcessInfo, error)
+	ListSockets(ctx context.Context, vmID string) ([]SocketInfo, error)
+	SignalProcess(ctx context.Context, vmID string, pid int, signal string) error
+}
+
+// ContainerRunner is implemented by orchestrators that can run a command in
+// a throwaway container of any image, without creating a VM first. The
+// container is removed once the command exits.
+type ContainerRunner interface {
+	RunContainer(ctx context.Context, image string, cmd *Command, sandbox *SandboxProfile) (*ExecResult, error)
+}
+
+// IntegrityVerifier is implemented by orchestrators that verify rootfs
+// templates, and the agent binary in them, before booting VMs from them.
+// Failures are returned from CreateVM as *IntegrityError.
+type IntegrityVerifier interface {
+	// RegisterTemplate checksums a rootfs template ("" = the default one),
+	// verifies it and records the checksum VMs created from it are checked
+	// against. It returns the checksum as "sha256:<hex>".
+	RegisterTemplate(ctx context.Context, path string) (string, error)
+}
+
+// Snapshotter is implemented by orchestrators that can checkpoint a VM's
+// memory, devices and disk, and later return the VM to the checkpoint.
+// Snapshots are kept on the VM's host and deleted with the VM.
+type Snapshotter interface {
+	// SnapshotVM checkpoints a running VM under snapshotID; the VM keeps
+	// running. It returns the bytes the snapshot's files take.
+	SnapshotVM(ctx context.Context, vmID, snapshotID string) (int64, error)
+
+	// RestoreVM returns a running or paused VM to a snapshot. Whatever the
+	// VM did since the snapshot, in memory and on disk, is lost.
+	RestoreVM(ctx context.Context, vmID, snapshotID string) error
+}
+
+// HostChecker is implemented by orchestrators whose host needs setting up
+// before VMs can run on it, e.g. KVM, a kernel and a network bridge.
+// CheckHost checks each prerequisite; failed checks say what is missing.
+type HostChecker interface {
+	CheckHost(ctx context.Context) []HostCheck
+}
+
+// HostCheck is the result of checking one host prerequisite
+type HostCheck struct {
+	Name   string `json:"name"` // e.g. kvm, kernel, bridge
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"` // What was found, or why the check failed
+}
+
+// ProcessSignals are the signals processes in a VM can be sent
+var ProcessSignals = []string{"TERM", "KILL", "INT"}
+
+// ErrProcessNotFound is returned when signaling a process that doesn't exist
+var ErrProcessNotFound = errors.New("process not found")
+
+// ProcessInfo is a process running in a VM
+type ProcessInfo struct {
+	PID       int       `json:"pid"`
+	PPID      int       `json:"ppid"`
+	User      string    `json:"user"`
+	Name      string    `json:"name"`
+	Command   string    `json:"command"`
+	State     string    `json:"state"` // As in /proc/<pid>/stat, e.g. S (sleeping)
+	RSSKB     int64     `json:"rss_kb"`
+	StartedAt time.Time `json:"started_at"`
+	Ports     []int     `json:"ports,omitempty"` // TCP ports it listens on
+}
+
+// SocketInfo is a listening TCP socket in a VM
+type SocketInfo struct {
+	Protocol string `json:"protocol"` // tcp or tcp6
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	Loopback bool   `json:"loopback,omitempty"` // Only reachable from inside the VM
+	PID      int    `json:"pid,omitempty"`
+	Process  string `json:"process,omitempty"`
+}
+
 // Command represents a command to execute in a VM
 type Command struct {
 	Cmd  string            `json:"cmd"`
@@ -49,6 +180,36 @@ type ExecResult struct {
 	ExitCode int    `json:"exit_code"`
 	Stdout   string `json:"stdout"`
 	Stderr   string `json:"stderr"`
+
+	// Resources is what the command ran out of, as seen by the VM's agent.
+	// Only set for failed commands, and only by agents that monitor them.
+	Resources *ResourceEvents `json:"resources,omitempty"`
+}
+
+// ResourceEvents are the resources a command ran out of in its VM
+type ResourceEvents struct {
+	OOMKills  []OOMKill   `json:"oom_kills,omitempty"`  // Processes killed while it ran
+	FullDisks []DiskUsage `json:"full_disks,omitempty"` // Filesystems full when it exited
+}
+
+// Exhausted reports whether the command ran out of anything
+func (r *ResourceEvents) Exhausted() bool {
+	return r != nil && (len(r.OOMKills) > 0 || len(r.FullDisks) > 0)
+}
+
+// OOMKill is a process the VM's kernel killed for lack of memory
+type OOMKill struct {
+	PID     int       `json:"pid"`
+	Process string    `json:"process"`
+	At      time.Time `json:"at"`
+}
+
+// DiskUsage is the space left on a full filesystem in a VM
+type DiskUsage struct {
+	Path       string `json:"path"` // Mount point
+	TotalBytes uint64 `json:"total_bytes"`
+	FreeBytes  uint64 `json:"free_bytes"`
+	FreeInodes uint64 `json:"free_inodes"`
 }
 
 // Config represents VMM configuration
@@ -0,0 +1,59 @@
+package vmm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// allowedKernelArgs lists the kernel parameters environments may add to a
+// VM's boot command line, with the values each accepts (nil = a flag that
+// takes no value). Parameters the orchestrator sets itself (console, root,
+// ip, aetherium.*) can't be overridden.
+var allowedKernelArgs = map[string][]string{
+	"quiet":                            nil,
+	"loglevel":                         {"0", "1", "2", "3", "4", "5", "6", "7"},
+	"systemd.unified_cgroup_hierarchy": {"0", "1"},
+	"cgroup_no_v1":                     {"all"},
+	"cgroup_enable":                    {"memory"},
+	"swapaccount":                      {"0", "1"},
+	"ipv6.disable":                     {"0", "1"},
+	"random.trust_cpu":                 {"on", "off"},
+	"transparent_hugepage":             {"always", "madvise", "never"},
+	"init_on_free":                     {"0", "1"},
+	"mitigations":                      {"auto", "auto,nosmt", "off"},
+}
+
+// ValidateKernelArgs checks extra kernel arguments against the allowlist
+func ValidateKernelArgs(args []string) error {
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"") {
+			return fmt.Errorf("invalid kernel arg %q", arg)
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		values, ok := allowedKernelArgs[name]
+		if !ok {
+			return fmt.Errorf("kernel arg %q is not allowed", name)
+		}
+
+		if values == nil {
+			if hasValue {
+				return fmt.Errorf("kernel arg %q takes no value", name)
+			}
+			continue
+		}
+		if !hasValue || !contains(values, value) {
+			return fmt.Errorf("kernel arg %q must be one of %s", name, strings.Join(values, ", "))
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
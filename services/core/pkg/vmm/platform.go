@@ -0,0 +1,24 @@
+package vmm
+
+// Guest platforms of a VM. Only the Docker backend runs Windows guests, as
+// Windows containers on workers with the docker-windows capability.
+const (
+	PlatformLinux   = "linux"
+	PlatformWindows = "windows"
+)
+
+// CapabilityDockerWindows is advertised by workers whose Docker daemon runs
+// Windows containers. Windows VMs are only placed on them.
+const CapabilityDockerWindows = "docker-windows"
+
+// MetadataPlatform is the VMConfig metadata key selecting the guest platform
+// (unset = Linux)
+const MetadataPlatform = "platform"
+
+// PlatformFromMetadata reads the guest platform from VMConfig metadata
+func PlatformFromMetadata(metadata map[string]string) string {
+	if metadata[MetadataPlatform] == PlatformWindows {
+		return PlatformWindows
+	}
+	return PlatformLinux
+}
@@ -0,0 +1,54 @@
+package vmm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Factory creates an orchestrator from backend-specific configuration
+type Factory func(config map[string]interface{}) (VMOrchestrator, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]Factory)
+)
+
+// Register makes an orchestrator backend available under name. Backend
+// packages call it from init, so a binary only contains the backends it
+// imports. Registering the same name twice panics.
+func Register(name string, factory Factory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if _, exists := backends[name]; exists {
+		panic(fmt.Sprintf("vmm: backend %q registered twice", name))
+	}
+	backends[name] = factory
+}
+
+// New creates an orchestrator with the named backend
+func New(name string, config map[string]interface{}) (VMOrchestrator, error) {
+	backendsMu.RLock()
+	factory, exists := backends[name]
+	backendsMu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown VM backend %q (built with: %s)", name, strings.Join(Backends(), ", "))
+	}
+	return factory(config)
+}
+
+// Backends returns the names of the registered backends, sorted
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
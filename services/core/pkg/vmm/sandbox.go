@@ -0,0 +1,100 @@
+package vmm
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// VMConfig metadata keys used to request a sandbox profile from an orchestrator
+const (
+	MetadataSandboxReadOnlyRootFS = "sandbox.read_only_rootfs"
+	MetadataSandboxTmpfsWorkdir   = "sandbox.tmpfs_workdir"
+	MetadataSandboxTmpfsSizeMB    = "sandbox.tmpfs_size_mb"
+	MetadataSandboxNoNetwork      = "sandbox.no_network"
+	MetadataSandboxRestrictProc   = "sandbox.restrict_proc"
+)
+
+// SandboxProfile describes isolation applied to a VM at boot for running untrusted code
+type SandboxProfile struct {
+	// ReadOnlyRootFS mounts the root filesystem read-only
+	ReadOnlyRootFS bool
+	// TmpfsWorkdir is a writable tmpfs mounted over this path (e.g. /workspace)
+	TmpfsWorkdir string
+	// TmpfsSizeMB limits the tmpfs size (0 = guest default)
+	TmpfsSizeMB int
+	// NoNetwork boots the VM without a network interface
+	NoNetwork bool
+	// RestrictProc hides other users' processes in /proc (hidepid=2)
+	RestrictProc bool
+}
+
+// ApplyToMetadata writes the profile into VMConfig metadata
+func (p *SandboxProfile) ApplyToMetadata(metadata map[string]string) {
+	if p.ReadOnlyRootFS {
+		metadata[MetadataSandboxReadOnlyRootFS] = "true"
+	}
+	if p.TmpfsWorkdir != "" {
+		metadata[MetadataSandboxTmpfsWorkdir] = p.TmpfsWorkdir
+		if p.TmpfsSizeMB > 0 {
+			metadata[MetadataSandboxTmpfsSizeMB] = strconv.Itoa(p.TmpfsSizeMB)
+		}
+	}
+	if p.NoNetwork {
+		metadata[MetadataSandboxNoNetwork] = "true"
+	}
+	if p.RestrictProc {
+		metadata[MetadataSandboxRestrictProc] = "true"
+	}
+}
+
+// SandboxFromMetadata reads a sandbox profile from VMConfig metadata
+// Returns nil if no sandbox settings are present
+func SandboxFromMetadata(metadata map[string]string) *SandboxProfile {
+	p := &SandboxProfile{
+		ReadOnlyRootFS: metadata[MetadataSandboxReadOnlyRootFS] == "true",
+		TmpfsWorkdir:   metadata[MetadataSandboxTmpfsWorkdir],
+		NoNetwork:      metadata[MetadataSandboxNoNetwork] == "true",
+		RestrictProc:   metadata[MetadataSandboxRestrictProc] == "true",
+	}
+	p.TmpfsSizeMB, _ = strconv.Atoi(metadata[MetadataSandboxTmpfsSizeMB])
+
+	if !p.ReadOnlyRootFS && p.TmpfsWorkdir == "" && !p.NoNetwork && !p.RestrictProc {
+		return nil
+	}
+	return p
+}
+
+// ValidateTmpfsWorkdir checks a tmpfs workdir. It is passed to guests on the
+// kernel command line and to docker in --tmpfs options, so it must be a
+// clean absolute path without whitespace or the separators they use.
+func ValidateTmpfsWorkdir(dir string) error {
+	if !path.IsAbs(dir) || path.Clean(dir) != dir || dir == "/" {
+		return fmt.Errorf("tmpfs workdir %q must be a clean absolute path below /", dir)
+	}
+	if strings.ContainsAny(dir, "=,:\"") || strings.ContainsFunc(dir, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}) {
+		return fmt.Errorf("tmpfs workdir %q can't contain whitespace, quotes, '=', ',' or ':'", dir)
+	}
+	return nil
+}
+
+// Validate checks the profile before an orchestrator builds boot arguments
+// from it. A nil profile is valid.
+func (p *SandboxProfile) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.TmpfsWorkdir != "" {
+		if err := ValidateTmpfsWorkdir(p.TmpfsWorkdir); err != nil {
+			return err
+		}
+	}
+	if p.TmpfsSizeMB < 0 {
+		return fmt.Errorf("tmpfs size can't be negative")
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package vmm
+
+import (
+	"context"
+	"io"
+)
+
+// Terminals is implemented by orchestrators whose VM agents run interactive
+// shells on a pseudo-terminal. OpenTerminal starts a shell and returns its
+// stream, which carries TerminalFrames as newline-delimited JSON in both
+// directions. Closing the stream hangs up the shell.
+type Terminals interface {
+	OpenTerminal(ctx context.Context, vmID string, req *TerminalRequest) (io.ReadWriteCloser, error)
+}
+
+// TerminalRequest describes a terminal to open
+type TerminalRequest struct {
+	Dir  string `json:"dir,omitempty"` // Working directory (default: the user's home)
+	Cols uint16 `json:"cols,omitempty"`
+	Rows uint16 `json:"rows,omitempty"`
+}
+
+// TerminalUpgrade is the HTTP Upgrade protocol of terminal streams proxied
+// by workers
+const TerminalUpgrade = "aetherium-terminal"
+
+// Terminal frame types. Input, resize, signal and file frames go to the
+// shell; output, exit and error frames come back from it.
+const (
+	TerminalFrameInput  = "input"  // Data is written to the terminal
+	TerminalFrameResize = "resize" // Cols and Rows set the window size
+	TerminalFrameSignal = "signal" // Signal (one of ProcessSignals) goes to the foreground process group
+	TerminalFrameFile   = "file"   // Data is written to Path; echoed back once EOF is set
+	TerminalFrameOutput = "output" // Data was read from the terminal
+	TerminalFrameExit   = "exit"   // The shell exited with ExitCode; the stream ends
+	TerminalFrameError  = "error"  // A frame failed, see Error (and Path for files)
+)
+
+// TerminalFrame is a message on a terminal stream
+type TerminalFrame struct {
+	Type     string `json:"type"`
+	Data     []byte `json:"data,omitempty"`
+	Cols     uint16 `json:"cols,omitempty"`
+	Rows     uint16 `json:"rows,omitempty"`
+	Signal   string `json:"signal,omitempty"`
+	Path     string `json:"path,omitempty"`   // Relative paths are in the terminal's directory
+	Append   bool   `json:"append,omitempty"` // Append Data to Path rather than replacing it
+	EOF      bool   `json:"eof,omitempty"`    // Last chunk of the file
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
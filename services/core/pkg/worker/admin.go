@@ -0,0 +1,192 @@
+package worker
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/services/gateway/pkg/discovery"
+)
+
+// ErrNotRegistered is returned for operations that need a registered
+// worker when running in legacy mode
+var ErrNotRegistered = errors.New("worker is not registered (legacy mode)")
+
+// AdminHandler serves the worker's admin API, for the gateway and for
+// operators reaching a worker directly. Requests must carry one of secrets
+// (WORKER_PEER_SECRET or WORKER_ADMIN_SECRET) as a bearer token.
+//
+//	GET  /admin/health
+//	GET  /admin/vms
+//	GET  /admin/host-checks
+//	POST /admin/reconcile
+//	POST /admin/drain
+//	POST /admin/activate
+func (w *Worker) AdminHandler(secrets ...string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/health", w.serveAdminHealth)
+	mux.HandleFunc("GET /admin/vms", w.serveAdminVMs)
+	mux.HandleFunc("GET /admin/host-checks", w.serveAdminHostChecks)
+	mux.HandleFunc("POST /admin/reconcile", w.reconcileNow)
+	mux.HandleFunc("POST /admin/drain", w.setStatusHandler(discovery.WorkerStatusDraining))
+	mux.HandleFunc("POST /admin/activate", w.setStatusHandler(discovery.WorkerStatusActive))
+	return requireBearer(mux, secrets...)
+}
+
+// requireBearer serves requests carrying one of secrets as a bearer token
+// with next; empty secrets are ignored, so with none set every request is
+// refused
+func requireBearer(next http.Handler, secrets ...string) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		for _, secret := range secrets {
+			if secret != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1 {
+				next.ServeHTTP(rw, r)
+				return
+			}
+		}
+		http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// AdminHealth is the worker's own view of its state
+type AdminHealth struct {
+	WorkerID           string    `json:"worker_id,omitempty"` // Empty in legacy mode
+	Status             string    `json:"status,omitempty"`
+	Version            string    `json:"version,omitempty"`
+	StartedAt          time.Time `json:"started_at,omitempty"`
+	VMCount            int       `json:"vm_count"`
+	UsedCPUCores       int       `json:"used_cpu_cores"`
+	UsedMemoryMB       int64     `json:"used_memory_mb"`
+	PendingVMs         int       `json:"pending_vms"`
+	TasksProcessed     int       `json:"tasks_processed"`
+	CapacityRejections int64     `json:"capacity_rejections"`
+	Orchestrator       string    `json:"orchestrator"` // "ok" or why it is unhealthy
+}
+
+// AdminVM is a VM as the worker's orchestrator sees it
+type AdminVM struct {
+	ID        string     `json:"id"`
+	Status    string     `json:"status"`
+	VCPUs     int        `json:"vcpus"`
+	MemoryMB  int        `json:"memory_mb"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	Tracked   bool       `json:"tracked"` // Counted in the worker's resource usage
+}
+
+// serveAdminHealth reports the worker's status, resource usage and whether
+// its orchestrator is healthy
+func (w *Worker) serveAdminHealth(rw http.ResponseWriter, r *http.Request) {
+	health := AdminHealth{Orchestrator: "ok"}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	if err := w.orchestrator.Health(ctx); err != nil {
+		health.Orchestrator = err.Error()
+	}
+
+	w.mu.RLock()
+	if w.workerInfo != nil {
+		health.WorkerID = w.workerInfo.ID
+		health.Status = string(w.workerInfo.Status)
+		health.Version = w.workerInfo.Metadata[MetadataVersion]
+		health.StartedAt = w.workerInfo.StartedAt
+	}
+	health.VMCount = len(w.runningVMs)
+	for _, vm := range w.runningVMs {
+		health.UsedCPUCores += vm.VCPUs
+		health.UsedMemoryMB += vm.MemoryMB
+	}
+	health.PendingVMs = w.pendingVMs
+	health.TasksProcessed = w.tasksProcessed
+	w.mu.RUnlock()
+	health.CapacityRejections = w.CapacityRejections()
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(health)
+}
+
+// serveAdminVMs lists the VMs the orchestrator runs on this worker
+func (w *Worker) serveAdminVMs(rw http.ResponseWriter, r *http.Request) {
+	vms, err := w.orchestrator.ListVMs(r.Context())
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	list := make([]AdminVM, 0, len(vms))
+	w.mu.RLock()
+	for _, vm := range vms {
+		_, tracked := w.runningVMs[vm.ID]
+		list = append(list, AdminVM{
+			ID:        vm.ID,
+			Status:    string(vm.Status),
+			VCPUs:     vm.Config.VCPUCount,
+			MemoryMB:  vm.Config.MemoryMB,
+			StartedAt: vm.StartedAt,
+			Tracked:   tracked,
+		})
+	}
+	w.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(map[string]interface{}{"vms": list, "total": len(list)})
+}
+
+// reconcileNow adopts untracked VMs and fails lost ones without waiting for
+// a restart
+func (w *Worker) reconcileNow(rw http.ResponseWriter, r *http.Request) {
+	report, err := w.ReconcileVMs(r.Context())
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(report)
+}
+
+// setStatusHandler returns a handler setting the worker's own status
+func (w *Worker) setStatusHandler(status discovery.WorkerStatus) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if err := w.SetStatus(r.Context(), status); err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, ErrNotRegistered) {
+				code = http.StatusConflict
+			}
+			http.Error(rw, err.Error(), code)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(map[string]string{"status": string(status)})
+	}
+}
+
+// SetStatus sets this worker's status, e.g. to draining so no new VMs are
+// placed on it. It fails in legacy mode, where workers have no status.
+func (w *Worker) SetStatus(ctx context.Context, status discovery.WorkerStatus) error {
+	if w.workerInfo == nil {
+		return ErrNotRegistered
+	}
+
+	if err := w.store.Workers().UpdateStatus(ctx, w.workerInfo.ID, string(status)); err != nil {
+		return fmt.Errorf("failed to update worker status: %w", err)
+	}
+	if w.registry != nil {
+		if err := w.registry.UpdateStatus(ctx, w.workerInfo.ID, status); err != nil {
+			return fmt.Errorf("failed to update worker status in service discovery: %w", err)
+		}
+	}
+
+	w.mu.Lock()
+	w.workerInfo.Status = status
+	w.mu.Unlock()
+	log.Printf("Worker %s is now %s", w.workerInfo.ID, status)
+	return nil
+}
@@ -0,0 +1,158 @@
+package worker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrInsufficientCapacity is returned when a worker can't fit a new VM
+var ErrInsufficientCapacity = errors.New("insufficient capacity")
+
+// DefaultMemoryReserveMB is the host memory kept free for the worker and OS
+const DefaultMemoryReserveMB = 512
+
+// Worker metadata keys reporting the capacity held back for the host
+const (
+	MetadataReservedMemoryMB = "reserved_memory_mb"
+	MetadataReservedCPUCores = "reserved_cpu_cores"
+)
+
+// reserveCapacity subtracts the host reservation from a worker's configured
+// capacity, so only what VMs may use is advertised to the scheduler
+func reserveCapacity(config *Config) (cpuCores int, memoryMB int64, err error) {
+	if config.CPUReserveCores < 0 || config.MemoryReserveMB < 0 {
+		return 0, 0, fmt.Errorf("host reservation can't be negative")
+	}
+
+	cpuCores = config.CPUCores - config.CPUReserveCores
+	if cpuCores < 1 {
+		return 0, 0, fmt.Errorf("CPU reserve of %d cores leaves no cores for VMs (host has %d)",
+			config.CPUReserveCores, config.CPUCores)
+	}
+
+	memoryMB = config.MemoryMB
+	if memoryMB > 0 {
+		memoryMB -= config.MemoryReserveMB
+		if memoryMB <= 0 {
+			return 0, 0, fmt.Errorf("memory reserve of %dMB leaves no memory for VMs (host has %dMB)",
+				config.MemoryReserveMB, config.MemoryMB)
+		}
+	}
+
+	return cpuCores, memoryMB, nil
+}
+
+// meminfoPath is the source for host memory availability
+const meminfoPath = "/proc/meminfo"
+
+// admitVM reserves capacity for a new VM or returns ErrInsufficientCapacity.
+// Successful admissions must be released with releaseVM when the create
+// handler returns. The advertised capacity it checks against already
+// excludes the host reservation. Warm pool VMs are deleted to make room.
+func (w *Worker) admitVM(vcpus, memoryMB int) error {
+	err := w.reserveVMCapacity(vcpus, memoryMB)
+	for errors.Is(err, ErrInsufficientCapacity) && w.evictWarmVM() {
+		err = w.reserveVMCapacity(vcpus, memoryMB)
+	}
+	if err != nil {
+		atomic.AddInt64(&w.capacityRejections, 1)
+	}
+	return err
+}
+
+// reserveVMCapacity is admitVM without making room
+func (w *Worker) reserveVMCapacity(vcpus, memoryMB int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	allocatedMB := w.reservedMemoryMB
+	allocatedVCPUs := w.reservedVCPUs
+	for _, vm := range w.runningVMs {
+		allocatedMB += vm.MemoryMB
+		allocatedVCPUs += vm.VCPUs
+	}
+	vmCount := len(w.runningVMs) + w.pendingVMs
+
+	var reason string
+	if w.workerInfo != nil {
+		res := w.workerInfo.Resources
+		if res.MaxVMs > 0 && vmCount+1 > res.MaxVMs {
+			reason = fmt.Sprintf("VM limit reached (%d/%d)", vmCount, res.MaxVMs)
+		} else if res.MemoryMB > 0 && allocatedMB+int64(memoryMB) > res.MemoryMB {
+			reason = fmt.Sprintf("requested %dMB, allocated %dMB of %dMB", memoryMB, allocatedMB, res.MemoryMB)
+		} else if w.cpuReserveCores > 0 && allocatedVCPUs+vcpus > res.CPUCores {
+			// vCPUs are only capped once cores are reserved for the host;
+			// otherwise they may be overcommitted as before
+			reason = fmt.Sprintf("requested %d vCPUs, allocated %d of %d cores (%d reserved)",
+				vcpus, allocatedVCPUs, res.CPUCores, w.cpuReserveCores)
+		}
+	}
+
+	if reason == "" {
+		// Memory already reserved for booting VMs isn't reflected in MemAvailable yet
+		if freeMB, err := hostAvailableMemoryMB(); err == nil {
+			if freeMB-w.reservedMemoryMB-w.memoryReserveMB < int64(memoryMB) {
+				reason = fmt.Sprintf("requested %dMB, host has %dMB available (%dMB pending, %dMB reserved)",
+					memoryMB, freeMB, w.reservedMemoryMB, w.memoryReserveMB)
+			}
+		} else {
+			log.Printf("Warning: Failed to read host memory, skipping host check: %v", err)
+		}
+	}
+
+	if reason != "" {
+		return fmt.Errorf("%w: %s", ErrInsufficientCapacity, reason)
+	}
+
+	w.reservedMemoryMB += int64(memoryMB)
+	w.reservedVCPUs += vcpus
+	w.pendingVMs++
+	return nil
+}
+
+// releaseVM drops a reservation made by admitVM
+func (w *Worker) releaseVM(vcpus, memoryMB int) {
+	w.mu.Lock()
+	w.reservedMemoryMB -= int64(memoryMB)
+	w.reservedVCPUs -= vcpus
+	w.pendingVMs--
+	w.mu.Unlock()
+}
+
+// CapacityRejections returns how many VM creations were rejected for lack of capacity
+func (w *Worker) CapacityRejections() int64 {
+	return atomic.LoadInt64(&w.capacityRejections)
+}
+
+// hostAvailableMemoryMB returns MemAvailable from /proc/meminfo in MB
+func hostAvailableMemoryMB() (int64, error) {
+	f, err := os.Open(meminfoPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid MemAvailable value: %w", err)
+		}
+		return kb / 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, fmt.Errorf("MemAvailable not found in %s", meminfoPath)
+}
@@ -0,0 +1,156 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// AdoptVMs re-attaches to VMs left running by a previous run of this worker,
+// when the orchestrator supports it, and tracks their resources again. VMs
+// recorded for this worker that weren't adopted have lost their process and
+// are marked failed. Call it before registering handlers.
+func (w *Worker) AdoptVMs(ctx context.Context) error {
+	adopter, ok := w.orchestrator.(vmm.Adopter)
+	if !ok {
+		return nil
+	}
+
+	vms, err := adopter.Adopt(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to adopt VMs: %w", err)
+	}
+
+	adopted := make(map[string]bool, len(vms))
+	w.mu.Lock()
+	for _, vm := range vms {
+		adopted[vm.ID] = true
+		if vm.Status == types.VMStatusPaused {
+			continue // Snapshotted to disk, using no CPU or memory
+		}
+		w.runningVMs[vm.ID] = &vmResourceUsage{
+			VCPUs:    vm.Config.VCPUCount,
+			MemoryMB: int64(vm.Config.MemoryMB),
+		}
+	}
+	w.mu.Unlock()
+
+	if len(vms) > 0 {
+		log.Printf("✓ Adopted %d running VMs", len(vms))
+	}
+
+	// VM records are only tied to a worker in distributed mode
+	if w.workerInfo == nil {
+		return nil
+	}
+
+	dbVMs, err := w.store.VMs().List(ctx, map[string]interface{}{"worker_id": w.workerInfo.ID})
+	if err != nil {
+		return fmt.Errorf("failed to list worker VMs: %w", err)
+	}
+
+	for _, dbVM := range dbVMs {
+		if adopted[dbVM.ID.String()] {
+			continue
+		}
+		status, err := types.ParseVMStatus(dbVM.Status)
+		if err != nil || status.IsTerminal() {
+			continue
+		}
+
+		dbVM.Status = string(types.VMStatusFailed)
+		if err := w.store.VMs().Update(ctx, dbVM); err != nil {
+			log.Printf("Warning: Failed to mark lost VM %s as failed: %v", dbVM.ID, err)
+			continue
+		}
+		log.Printf("VM %s was not running after restart, marked as failed", dbVM.ID)
+	}
+
+	w.updateWorkerResources(ctx)
+
+	return nil
+}
+
+// ReconcileReport lists what ReconcileVMs changed
+type ReconcileReport struct {
+	Adopted []string `json:"adopted"` // VMs found running that the worker didn't track
+	Failed  []string `json:"failed"`  // VMs recorded as running that the orchestrator doesn't have
+}
+
+// ReconcileVMs brings the worker's view of its VMs in line with the
+// orchestrator's while the worker runs. Untracked VMs the orchestrator can
+// adopt are tracked again, and VMs recorded as running on this worker that
+// the orchestrator doesn't have are marked failed. Unlike AdoptVMs, it
+// leaves VMs that are still being created alone.
+func (w *Worker) ReconcileVMs(ctx context.Context) (*ReconcileReport, error) {
+	report := &ReconcileReport{Adopted: []string{}, Failed: []string{}}
+
+	if adopter, ok := w.orchestrator.(vmm.Adopter); ok {
+		vms, err := adopter.Adopt(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to adopt VMs: %w", err)
+		}
+		w.mu.Lock()
+		for _, vm := range vms {
+			report.Adopted = append(report.Adopted, vm.ID)
+			if vm.Status == types.VMStatusPaused {
+				continue
+			}
+			w.runningVMs[vm.ID] = &vmResourceUsage{
+				VCPUs:    vm.Config.VCPUCount,
+				MemoryMB: int64(vm.Config.MemoryMB),
+			}
+		}
+		w.mu.Unlock()
+		if len(vms) > 0 {
+			log.Printf("✓ Adopted %d running VMs", len(vms))
+		}
+	}
+
+	// VM records are only tied to a worker in distributed mode
+	if w.workerInfo == nil {
+		return report, nil
+	}
+
+	vms, err := w.orchestrator.ListVMs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VMs: %w", err)
+	}
+	known := make(map[string]bool, len(vms))
+	for _, vm := range vms {
+		known[vm.ID] = true
+	}
+
+	dbVMs, err := w.store.VMs().List(ctx, map[string]interface{}{
+		"worker_id": w.workerInfo.ID,
+		"status":    string(types.VMStatusRunning),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worker VMs: %w", err)
+	}
+
+	for _, dbVM := range dbVMs {
+		id := dbVM.ID.String()
+		if known[id] {
+			continue
+		}
+
+		dbVM.Status = string(types.VMStatusFailed)
+		if err := w.store.VMs().Update(ctx, dbVM); err != nil {
+			log.Printf("Warning: Failed to mark lost VM %s as failed: %v", dbVM.ID, err)
+			continue
+		}
+		w.mu.Lock()
+		delete(w.runningVMs, id)
+		w.mu.Unlock()
+		report.Failed = append(report.Failed, id)
+		log.Printf("VM %s is no longer running, marked as failed", dbVM.ID)
+	}
+
+	w.updateWorkerResources(ctx)
+
+	return report, nil
+}
@@ -0,0 +1,122 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/google/uuid"
+)
+
+// SetPeerSecret sets the secret this worker authenticates to other workers
+// with (WORKER_PEER_SECRET). Needed to clone workspaces whose VM runs on
+// another worker.
+func (w *Worker) SetPeerSecret(secret string) {
+	w.peerSecret = secret
+}
+
+// serveVMArchive streams a gzipped tar of a directory in a VM, named by the
+// dir parameter
+func (w *Worker) serveVMArchive(rw http.ResponseWriter, r *http.Request) {
+	copier, ok := w.orchestrator.(vmm.DirectoryCopier)
+	if !ok {
+		http.Error(rw, "orchestrator does not support copying directories", http.StatusNotImplemented)
+		return
+	}
+	dir := r.URL.Query().Get("dir")
+	if dir == "" {
+		http.Error(rw, "dir is required", http.StatusBadRequest)
+		return
+	}
+
+	archive, err := copier.ArchiveDir(r.Context(), r.PathValue("id"), dir)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer archive.Close()
+
+	rw.Header().Set("Content-Type", "application/gzip")
+	io.Copy(rw, archive)
+}
+
+// copyWorkingTree copies the working directory of the workspace a clone was
+// made from into the clone's VM. The source VM may run on this worker or on
+// another one, which streams it over its preview handler.
+func (w *Worker) copyWorkingTree(ctx context.Context, vmID string, payload *WorkspaceCreatePayload) error {
+	copier, ok := w.orchestrator.(vmm.DirectoryCopier)
+	if !ok {
+		return fmt.Errorf("orchestrator does not support copying directories")
+	}
+
+	sourceID, err := uuid.Parse(payload.CloneFrom)
+	if err != nil {
+		return fmt.Errorf("invalid clone_from: %w", err)
+	}
+	source, err := w.store.Workspaces().Get(ctx, sourceID)
+	if err != nil {
+		return fmt.Errorf("source workspace not found: %w", err)
+	}
+	if source.VMID == nil {
+		return fmt.Errorf("source workspace %s has no VM", source.Name)
+	}
+	sourceVM, err := w.store.VMs().Get(ctx, *source.VMID)
+	if err != nil {
+		return fmt.Errorf("source VM not found: %w", err)
+	}
+	if sourceVM.WorkerID == nil {
+		return fmt.Errorf("source VM %s is not running on a worker", sourceVM.ID)
+	}
+
+	var archive io.ReadCloser
+	if w.workerInfo != nil && *sourceVM.WorkerID == w.workerInfo.ID {
+		archive, err = copier.ArchiveDir(ctx, sourceVM.ID.String(), source.WorkingDirectory)
+	} else {
+		archive, err = w.fetchArchive(ctx, *sourceVM.WorkerID, sourceVM.ID, source.WorkingDirectory)
+	}
+	if err != nil {
+		return fmt.Errorf("could not read working tree of workspace %s: %w", source.Name, err)
+	}
+	defer archive.Close()
+
+	files, err := copier.ExtractDir(ctx, vmID, payload.WorkingDir, archive)
+	if err != nil {
+		return fmt.Errorf("could not copy working tree of workspace %s: %w", source.Name, err)
+	}
+	log.Printf("✓ Copied %d files from workspace %s (%s) into VM %s", files, source.Name, source.WorkingDirectory, vmID)
+	return nil
+}
+
+// fetchArchive streams a directory of a VM running on another worker
+func (w *Worker) fetchArchive(ctx context.Context, workerID string, vmID uuid.UUID, dir string) (io.ReadCloser, error) {
+	if w.peerSecret == "" {
+		return nil, fmt.Errorf("VM %s runs on worker %s and WORKER_PEER_SECRET is not set", vmID, workerID)
+	}
+	peer, err := w.store.Workers().Get(ctx, workerID)
+	if err != nil {
+		return nil, fmt.Errorf("worker %s not found: %w", workerID, err)
+	}
+
+	target := fmt.Sprintf("http://%s/vms/%s/archive?dir=%s", peer.Address, vmID, url.QueryEscape(dir))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+w.peerSecret)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("worker %s unreachable: %w", workerID, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("worker %s returned %s: %s", workerID, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp.Body, nil
+}
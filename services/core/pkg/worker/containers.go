@@ -0,0 +1,128 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/redact"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/google/uuid"
+)
+
+// ContainerRunPayload is the payload of container:run tasks
+type ContainerRunPayload = queue.ContainerRunPayload
+
+// registerContainerHandler handles container:run tasks when the
+// orchestrator can run containers (the Docker backend)
+func (w *Worker) registerContainerHandler(q queue.Queue) error {
+	if _, ok := w.orchestrator.(vmm.ContainerRunner); !ok {
+		return nil
+	}
+	if err := q.RegisterHandler(queue.TaskTypeContainerRun, w.trackTask(w.HandleContainerRun)); err != nil {
+		return fmt.Errorf("failed to register container run handler: %w", err)
+	}
+	return nil
+}
+
+// HandleContainerRun runs a command in a throwaway container of the
+// requested image and records it as an execution without a VM
+func (w *Worker) HandleContainerRun(ctx context.Context, task *queue.Task) (*queue.TaskResult, error) {
+	startTime := time.Now()
+
+	var payload ContainerRunPayload
+	if err := queue.DecodePayload(task, &payload); err != nil {
+		return nil, err
+	}
+
+	runner, ok := w.orchestrator.(vmm.ContainerRunner)
+	if !ok {
+		return nil, fmt.Errorf("orchestrator does not support containers")
+	}
+
+	log.Printf("Running command in %s container: %s %v", payload.Image, payload.Command, payload.Args)
+
+	cmd := &vmm.Command{Cmd: payload.Command, Args: payload.Args}
+	var sandbox *vmm.SandboxProfile
+	if payload.Sandbox != nil {
+		sandbox = &vmm.SandboxProfile{
+			ReadOnlyRootFS: payload.Sandbox.ReadOnlyRootFS,
+			TmpfsWorkdir:   payload.Sandbox.TmpfsWorkdir,
+			TmpfsSizeMB:    payload.Sandbox.TmpfsSizeMB,
+			NoNetwork:      payload.Sandbox.NoNetwork,
+			RestrictProc:   payload.Sandbox.RestrictProc,
+		}
+	}
+
+	args := make(storage.JSONBArray, len(payload.Args))
+	for i, arg := range payload.Args {
+		args[i] = arg
+	}
+	execution := &storage.Execution{
+		ID:        uuid.New(),
+		TaskID:    &task.ID,
+		Command:   payload.Command,
+		Args:      args,
+		StartedAt: startTime,
+		Metadata: map[string]interface{}{
+			"image":   payload.Image,
+			"task_id": task.ID.String(),
+		},
+	}
+
+	execResult, err := runner.RunContainer(ctx, payload.Image, cmd, sandbox)
+	execution.CompletedAt = timePtr(time.Now())
+	execution.DurationMS = intPtr(int(time.Since(startTime).Milliseconds()))
+	if err != nil {
+		errMsg := err.Error()
+		execution.Error = &errMsg
+	} else {
+		// Containers get no secrets, but their output may still hold tokens
+		redactExecResult(redact.New(nil, redact.Policy{}), execResult)
+		execution.ExitCode = &execResult.ExitCode
+		execution.Stdout = &execResult.Stdout
+		execution.Stderr = &execResult.Stderr
+	}
+	if err := w.store.Executions().Create(ctx, execution); err != nil {
+		log.Printf("Warning: Failed to store execution: %v", err)
+	}
+
+	if err != nil {
+		return &queue.TaskResult{
+			TaskID:    task.ID,
+			Success:   false,
+			Error:     err.Error(),
+			Duration:  time.Since(startTime),
+			StartedAt: startTime,
+		}, nil
+	}
+
+	result := map[string]interface{}{
+		"image":     payload.Image,
+		"exit_code": execResult.ExitCode,
+		"stdout":    execResult.Stdout,
+		"stderr":    execResult.Stderr,
+	}
+	if execResult.ExitCode != 0 {
+		return &queue.TaskResult{
+			TaskID:    task.ID,
+			Success:   false,
+			Error:     fmt.Sprintf("command failed with exit code %d", execResult.ExitCode),
+			Result:    result,
+			Duration:  time.Since(startTime),
+			StartedAt: startTime,
+			Terminal:  true,
+		}, nil
+	}
+
+	return &queue.TaskResult{
+		TaskID:    task.ID,
+		Success:   true,
+		Result:    result,
+		Duration:  time.Since(startTime),
+		StartedAt: startTime,
+	}, nil
+}
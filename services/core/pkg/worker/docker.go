@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// dockerReadyTimeout bounds the wait for dockerd to answer after it starts
+const dockerReadyTimeout = time.Minute
+
+// environmentVMSize returns the vCPUs and memory of the environment's
+// workspace VMs, raised to what dockerd needs when the environment runs it
+func environmentVMSize(env *storage.Environment) (int, int) {
+	vcpus, memoryMB := env.VCPUs, env.MemoryMB
+	if env.Docker != nil {
+		vcpus = max(vcpus, vmm.DockerMinVCPUs)
+		memoryMB = max(memoryMB, vmm.DockerMinMemoryMB)
+	}
+	return vcpus, memoryMB
+}
+
+// applyDockerMetadata asks the orchestrator for a Docker-ready VM
+func applyDockerMetadata(docker *storage.DockerProfile, metadata map[string]string) {
+	if docker == nil {
+		return
+	}
+	profile := &vmm.DockerProfile{
+		DiskSizeMB: docker.DiskSizeMB,
+		Registries: docker.Registries,
+	}
+	profile.ApplyToMetadata(metadata)
+}
+
+// startDocker makes sure dockerd runs in the VM and waits until it answers.
+// fc-agent starts it at boot when the rootfs has Docker baked in; otherwise
+// it was just installed with the environment's tools.
+func (w *Worker) startDocker(ctx context.Context, vmID string) error {
+	script := fmt.Sprintf(`docker info > /dev/null 2>&1 || systemctl start --no-block docker 2> /dev/null || (setsid dockerd >> /var/log/dockerd.log 2>&1 < /dev/null &)
+i=0
+until docker info > /dev/null 2>&1; do
+	i=$((i+1))
+	if [ $i -ge %d ]; then echo "dockerd did not start" >&2; tail -n 20 /var/log/dockerd.log >&2; exit 1; fi
+	sleep 1
+done`, int(dockerReadyTimeout/time.Second))
+
+	return w.execInVM(ctx, vmID, &vmm.Command{Cmd: "sh", Args: []string{"-c", script}})
+}
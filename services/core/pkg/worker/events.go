@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// Cluster event severities
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// recordEvent stores a cluster timeline event, ships it to the logger and
+// publishes it on the event bus if they are configured
+func (w *Worker) recordEvent(ctx context.Context, topic, severity, resourceType, resourceID, message string, data map[string]interface{}) {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+
+	w.logEvent(ctx, topic, severity, resourceType, resourceID, message, data)
+
+	event := &storage.ClusterEvent{
+		ID:           uuid.New(),
+		Type:         topic,
+		Severity:     severity,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Message:      message,
+		Data:         data,
+		CreatedAt:    time.Now(),
+	}
+	if w.workerInfo != nil {
+		event.WorkerID = &w.workerInfo.ID
+	}
+
+	if err := w.store.ClusterEvents().Create(ctx, event); err != nil {
+		log.Printf("Warning: Failed to record %s event: %v", topic, err)
+	}
+
+	if w.eventBus == nil {
+		return
+	}
+
+	busEvent := &types.Event{
+		ID:        event.ID.String(),
+		Type:      topic,
+		Timestamp: event.CreatedAt,
+		Data:      data,
+	}
+	if err := w.eventBus.Publish(ctx, topic, busEvent); err != nil {
+		log.Printf("Warning: Failed to publish %s event: %v", topic, err)
+	}
+}
+
+// logEvent ships a cluster event to the logger, labelled with its VM or
+// workspace
+func (w *Worker) logEvent(ctx context.Context, topic, severity, resourceType, resourceID, message string, data map[string]interface{}) {
+	if w.logger == nil {
+		return
+	}
+
+	fields := make(map[string]interface{}, len(data)+2)
+	for k, v := range data {
+		fields[k] = v
+	}
+	fields["event"] = topic
+	switch resourceType {
+	case "vm":
+		fields["vm_id"] = resourceID
+	case "workspace":
+		fields["workspace_id"] = resourceID
+	}
+
+	level := types.LogLevelInfo
+	switch severity {
+	case SeverityWarning:
+		level = types.LogLevelWarn
+	case SeverityError:
+		level = types.LogLevelError
+	}
+	w.shipLog(ctx, level, message, fields)
+}
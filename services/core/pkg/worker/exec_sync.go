@@ -0,0 +1,148 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxSyncExecTimeout bounds how long a synchronous command may run
+	maxSyncExecTimeout = 30 * time.Second
+	// maxSyncExecOutput bounds the stdout and stderr returned for a
+	// synchronous command; the stored execution keeps the full output
+	maxSyncExecOutput = 1 << 20
+	// maxSyncExecRequest bounds the size of a synchronous command request
+	maxSyncExecRequest = 64 << 10
+)
+
+// SyncExecRequest is a command the gateway runs without going through the
+// task queue
+type SyncExecRequest struct {
+	Command   string   `json:"command"`
+	Args      []string `json:"args,omitempty"`
+	TimeoutMS int      `json:"timeout_ms,omitempty"`
+}
+
+// SyncExecResponse is the result of a synchronous command
+type SyncExecResponse struct {
+	ExecutionID uuid.UUID           `json:"execution_id"`
+	ExitCode    int                 `json:"exit_code"`
+	Stdout      string              `json:"stdout"`
+	Stderr      string              `json:"stderr"`
+	DurationMS  int64               `json:"duration_ms"`
+	Truncated   bool                `json:"truncated,omitempty"` // Stdout or stderr was cut to the size limit
+	Resources   *vmm.ResourceEvents `json:"resources,omitempty"`
+}
+
+// execVMSync runs a short command in a VM and responds with its result.
+// A command still running at the timeout fails with 504.
+func (w *Worker) execVMSync(rw http.ResponseWriter, r *http.Request) {
+	var req SyncExecRequest
+	if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxSyncExecRequest)).Decode(&req); err != nil {
+		http.Error(rw, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Command == "" {
+		http.Error(rw, "command is required", http.StatusBadRequest)
+		return
+	}
+	timeout := time.Duration(req.TimeoutMS) * time.Millisecond
+	if timeout <= 0 || timeout > maxSyncExecTimeout {
+		timeout = maxSyncExecTimeout
+	}
+
+	vmID := r.PathValue("id")
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	log.Printf("Executing command synchronously on VM %s: %s %v", vmID, req.Command, req.Args)
+	startTime := time.Now()
+	execResult, err := w.orchestrator.ExecuteCommand(ctx, vmID, &vmm.Command{Cmd: req.Command, Args: req.Args})
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		http.Error(rw, err.Error(), status)
+		return
+	}
+	duration := time.Since(startTime)
+
+	// The request may be gone by now, but the command ran
+	storeCtx := context.Background()
+	w.markVMUsed(storeCtx, vmID)
+	redactExecResult(w.vmRedactor(storeCtx, vmID), execResult)
+	executionID := w.storeSyncExecution(storeCtx, vmID, &req, execResult, startTime, duration)
+	w.recordResourceExhaustion(storeCtx, vmID, execResult.Resources)
+
+	resp := SyncExecResponse{
+		ExecutionID: executionID,
+		ExitCode:    execResult.ExitCode,
+		DurationMS:  duration.Milliseconds(),
+	}
+	var stdoutCut, stderrCut bool
+	resp.Stdout, stdoutCut = truncateOutput(execResult.Stdout, maxSyncExecOutput)
+	resp.Stderr, stderrCut = truncateOutput(execResult.Stderr, maxSyncExecOutput)
+	resp.Truncated = stdoutCut || stderrCut
+	if execResult.Resources.Exhausted() {
+		resp.Resources = execResult.Resources
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(resp)
+}
+
+// storeSyncExecution records a synchronous command like a queued one, so it
+// shows up in the VM's executions
+func (w *Worker) storeSyncExecution(ctx context.Context, vmID string, req *SyncExecRequest, execResult *vmm.ExecResult, startTime time.Time, duration time.Duration) uuid.UUID {
+	vmUUID, _ := uuid.Parse(vmID)
+	exitCode := execResult.ExitCode
+	stdout := execResult.Stdout
+	stderr := execResult.Stderr
+
+	args := make(storage.JSONBArray, len(req.Args))
+	for i, arg := range req.Args {
+		args[i] = arg
+	}
+
+	execution := &storage.Execution{
+		ID:          uuid.New(),
+		VMID:        &vmUUID,
+		Command:     req.Command,
+		Args:        args,
+		ExitCode:    &exitCode,
+		Stdout:      &stdout,
+		Stderr:      &stderr,
+		StartedAt:   startTime,
+		CompletedAt: timePtr(startTime.Add(duration)),
+		DurationMS:  intPtr(int(duration.Milliseconds())),
+		Metadata: map[string]interface{}{
+			"sync": true,
+		},
+	}
+	if execResult.Resources.Exhausted() {
+		execution.Metadata["resources"] = execResult.Resources
+	}
+
+	if err := w.store.Executions().Create(ctx, execution); err != nil {
+		log.Printf("Warning: Failed to store execution: %v", err)
+	}
+	return execution.ID
+}
+
+// truncateOutput cuts output to at most limit bytes and reports whether it
+// did
+func truncateOutput(output string, limit int) (string, bool) {
+	if len(output) <= limit {
+		return output, false
+	}
+	return output[:limit], true
+}
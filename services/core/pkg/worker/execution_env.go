@@ -0,0 +1,179 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/google/uuid"
+)
+
+// SetBaseImage sets the image VMs boot from when their environment has no
+// saved rootfs image: the rootfs template for Firecracker, the container
+// image for Docker. It is recorded in each prompt's execution environment.
+func (w *Worker) SetBaseImage(image string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.baseImage = image
+}
+
+// captureExecutionEnv records the environment a prompt is about to run in:
+// the environment template, the image the VM booted from, the tool versions
+// and environment variable names inside the VM and the commit checked out.
+// Anything that can't be resolved is left empty; a failure to capture never
+// fails the prompt.
+func (w *Worker) captureExecutionEnv(ctx context.Context, promptID uuid.UUID, workspace *storage.Workspace, env *storage.Environment, vmID, workingDir string) {
+	w.mu.RLock()
+	baseImage := w.baseImage
+	w.mu.RUnlock()
+
+	execEnv := &storage.ExecutionEnvironment{
+		VMID:         vmID,
+		RootFSImage:  baseImage,
+		ToolVersions: map[string]string{},
+		AIAssistant:  workspace.AIAssistant,
+		EnvVarNames:  []string{},
+		WorkingDir:   workingDir,
+		CapturedAt:   time.Now(),
+	}
+	if w.workerInfo != nil {
+		execEnv.WorkerID = w.workerInfo.ID
+	}
+
+	if env != nil {
+		updatedAt := env.UpdatedAt
+		execEnv.EnvironmentID = &env.ID
+		execEnv.EnvironmentName = env.Name
+		execEnv.EnvironmentUpdatedAt = &updatedAt
+		execEnv.GitRepoURL = env.GitRepoURL
+		execEnv.GitBranch = env.GitBranch
+		if env.RootFSImage != nil && *env.RootFSImage != "" {
+			execEnv.RootFSImage = *env.RootFSImage
+		}
+	}
+
+	if execEnv.RootFSImage != "" {
+		digest, err := imageDigests.digest(execEnv.RootFSImage)
+		if err != nil {
+			log.Printf("Warning: Failed to hash rootfs image %s: %v", execEnv.RootFSImage, err)
+		}
+		execEnv.RootFSImageSHA256 = digest
+	}
+
+	versions, err := w.toolInstaller.DetectVersions(ctx, vmID)
+	if err != nil {
+		log.Printf("Warning: Failed to detect tool versions for prompt %s: %v", promptID, err)
+	} else {
+		execEnv.ToolVersions = versions
+	}
+	execEnv.AgentVersion = execEnv.ToolVersions[agentTool(workspace.AIAssistant)]
+
+	if err := w.probeExecutionEnv(ctx, vmID, execEnv); err != nil {
+		log.Printf("Warning: Failed to inspect VM %s for prompt %s: %v", vmID, promptID, err)
+	}
+
+	if err := w.store.PromptTasks().SetExecutionEnv(ctx, promptID, execEnv); err != nil {
+		log.Printf("Warning: Failed to record execution environment for prompt %s: %v", promptID, err)
+	}
+}
+
+// probeExecutionEnv reads the names of the environment variables exported to
+// the agent and the commit checked out in the working directory
+func (w *Worker) probeExecutionEnv(ctx context.Context, vmID string, execEnv *storage.ExecutionEnvironment) error {
+	script := fmt.Sprintf(`cat /root/.bashrc /run/secrets/env 2>/dev/null | sed -n 's/^export \([A-Za-z_][A-Za-z0-9_]*\)=.*/env=\1/p'
+git -C '%s' rev-parse HEAD 2>/dev/null | sed 's/^/commit=/'
+true`, escapeShellArg(execEnv.WorkingDir))
+
+	result, err := w.orchestrator.ExecuteCommand(ctx, vmID, &vmm.Command{
+		Cmd:  "bash",
+		Args: []string{"-c", script},
+	})
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || value == "" {
+			continue
+		}
+		switch key {
+		case "env":
+			if !seen[value] {
+				seen[value] = true
+				execEnv.EnvVarNames = append(execEnv.EnvVarNames, value)
+			}
+		case "commit":
+			execEnv.GitCommit = value
+		}
+	}
+	sort.Strings(execEnv.EnvVarNames)
+	return nil
+}
+
+// agentTool returns the installer's name for a workspace's AI assistant
+func agentTool(aiAssistant string) string {
+	switch aiAssistant {
+	case "ampcode", "amp":
+		return "ampcode"
+	default:
+		return "claude-code"
+	}
+}
+
+// imageDigests caches rootfs image digests so multi-gigabyte images are only
+// hashed again when they change
+var imageDigests = &digestCache{entries: make(map[string]digestEntry)}
+
+type digestEntry struct {
+	size    int64
+	modTime time.Time
+	digest  string
+}
+
+type digestCache struct {
+	mu      sync.Mutex
+	entries map[string]digestEntry
+}
+
+// digest returns the SHA-256 of the file at path, or "" if the image is not
+// a local file (a container image reference, for instance)
+func (c *digestCache) digest(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[path]; ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		return entry.digest, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	digest := hex.EncodeToString(hash.Sum(nil))
+
+	c.entries[path] = digestEntry{size: info.Size(), modTime: info.ModTime(), digest: digest}
+	return digest, nil
+}
@@ -0,0 +1,107 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/google/uuid"
+)
+
+// describeResourceExhaustion says what a command ran out of, or "" if
+// nothing, e.g. "out of memory: node (pid 812) was OOM-killed"
+func describeResourceExhaustion(resources *vmm.ResourceEvents) string {
+	if !resources.Exhausted() {
+		return ""
+	}
+
+	var parts []string
+	if len(resources.OOMKills) > 0 {
+		var killed []string
+		for _, kill := range resources.OOMKills {
+			killed = append(killed, fmt.Sprintf("%s (pid %d)", kill.Process, kill.PID))
+		}
+		parts = append(parts, fmt.Sprintf("out of memory: %s OOM-killed", strings.Join(killed, ", ")))
+	}
+	for _, disk := range resources.FullDisks {
+		parts = append(parts, fmt.Sprintf("disk full: %s has %d MB free of %d MB (%d inodes free)",
+			disk.Path, disk.FreeBytes>>20, disk.TotalBytes>>20, disk.FreeInodes))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// classifyResourceExhaustion returns the failure reason of a command that
+// ran out of memory or disk, and what ran out. The reason is "" if neither.
+func classifyResourceExhaustion(resources *vmm.ResourceEvents) (string, string) {
+	switch {
+	case !resources.Exhausted():
+		return "", ""
+	case len(resources.OOMKills) > 0:
+		return storage.PromptFailureOutOfMemory, describeResourceExhaustion(&vmm.ResourceEvents{OOMKills: resources.OOMKills})
+	default:
+		return storage.PromptFailureDiskFull, describeResourceExhaustion(&vmm.ResourceEvents{FullDisks: resources.FullDisks})
+	}
+}
+
+// recordResourceExhaustion notes on a VM that a command in it ran out of
+// memory or disk, so the VM's status shows it, and records an event
+func (w *Worker) recordResourceExhaustion(ctx context.Context, vmID string, resources *vmm.ResourceEvents) {
+	if !resources.Exhausted() {
+		return
+	}
+	message := fmt.Sprintf("VM %s ran out of resources: %s", vmID, describeResourceExhaustion(resources))
+	log.Print(message)
+
+	if id, err := uuid.Parse(vmID); err == nil {
+		w.updateVMResourceMetadata(ctx, id, resources)
+	}
+
+	w.recordEvent(ctx, events.TopicVMResourceExhausted, SeverityWarning, "vm", vmID, message, map[string]interface{}{
+		"oom_kills":  resources.OOMKills,
+		"full_disks": resources.FullDisks,
+	})
+}
+
+// updateVMResourceMetadata counts a VM's OOM kills and keeps the latest OOM
+// kill and full disk in its metadata
+func (w *Worker) updateVMResourceMetadata(ctx context.Context, vmID uuid.UUID, resources *vmm.ResourceEvents) {
+	vm, err := w.store.VMs().Get(ctx, vmID)
+	if err != nil {
+		log.Printf("Warning: Failed to load VM %s: %v", vmID, err)
+		return
+	}
+	if vm.Metadata == nil {
+		vm.Metadata = make(map[string]interface{})
+	}
+
+	if len(resources.OOMKills) > 0 {
+		// Numbers read back from JSONB are float64
+		count, _ := vm.Metadata["oom_kills"].(float64)
+		kill := resources.OOMKills[len(resources.OOMKills)-1]
+		vm.Metadata["oom_kills"] = int(count) + len(resources.OOMKills)
+		vm.Metadata["last_oom_kill"] = map[string]interface{}{
+			"pid":     kill.PID,
+			"process": kill.Process,
+			"at":      kill.At.Format(time.RFC3339),
+		}
+	}
+	if len(resources.FullDisks) > 0 {
+		disk := resources.FullDisks[0]
+		vm.Metadata["last_disk_full"] = map[string]interface{}{
+			"path":        disk.Path,
+			"free_bytes":  disk.FreeBytes,
+			"total_bytes": disk.TotalBytes,
+			"free_inodes": disk.FreeInodes,
+			"at":          time.Now().Format(time.RFC3339),
+		}
+	}
+
+	if err := w.store.VMs().Update(ctx, vm); err != nil {
+		log.Printf("Warning: Failed to record resource exhaustion of VM %s: %v", vmID, err)
+	}
+}
@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// MetadataHostChecks is the worker metadata key holding its latest
+// HostReport, refreshed on registration and every heartbeat
+const MetadataHostChecks = "host_checks"
+
+// hostCheckTimeout bounds checking the host
+const hostCheckTimeout = 5 * time.Second
+
+// HostReport is the result of checking the worker host's prerequisites for
+// running VMs
+type HostReport struct {
+	Ready     bool            `json:"ready"` // Every check passed
+	Checks    []vmm.HostCheck `json:"checks"`
+	CheckedAt time.Time       `json:"checked_at"`
+}
+
+// Failed returns the names of the checks that failed
+func (r *HostReport) Failed() []string {
+	var failed []string
+	for _, check := range r.Checks {
+		if !check.OK {
+			failed = append(failed, check.Name)
+		}
+	}
+	return failed
+}
+
+// CheckHost checks whether this host can run VMs. Orchestrators that don't
+// implement vmm.HostChecker are only checked with their Health.
+func (w *Worker) CheckHost(ctx context.Context) *HostReport {
+	ctx, cancel := context.WithTimeout(ctx, hostCheckTimeout)
+	defer cancel()
+
+	var checks []vmm.HostCheck
+	if checker, ok := w.orchestrator.(vmm.HostChecker); ok {
+		checks = checker.CheckHost(ctx)
+	} else {
+		check := vmm.HostCheck{Name: "orchestrator", OK: true, Detail: "healthy"}
+		if err := w.orchestrator.Health(ctx); err != nil {
+			check.OK = false
+			check.Detail = err.Error()
+		}
+		checks = []vmm.HostCheck{check}
+	}
+
+	report := &HostReport{Ready: true, Checks: checks, CheckedAt: time.Now()}
+	for _, check := range checks {
+		if !check.OK {
+			report.Ready = false
+		}
+	}
+	return report
+}
+
+// reportHostChecks checks the host and records the report in the worker's
+// database record, so the gateway can explain why the worker can't run VMs.
+// Failed checks are logged when they change.
+func (w *Worker) reportHostChecks(ctx context.Context) {
+	if w.workerInfo == nil {
+		return
+	}
+
+	report := w.CheckHost(ctx)
+	failed := strings.Join(report.Failed(), ", ")
+	if failed != w.failedHostChecks {
+		if failed == "" {
+			log.Printf("✓ Host checks passed")
+		} else {
+			for _, check := range report.Checks {
+				if !check.OK {
+					log.Printf("Warning: Host check %s failed: %s", check.Name, check.Detail)
+				}
+			}
+		}
+		w.failedHostChecks = failed
+	}
+
+	if err := w.store.Workers().UpdateMetadata(ctx, w.workerInfo.ID, map[string]interface{}{MetadataHostChecks: report}); err != nil {
+		log.Printf("Warning: Failed to report host checks in database: %v", err)
+	}
+}
+
+// serveAdminHostChecks checks the host now
+func (w *Worker) serveAdminHostChecks(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(w.CheckHost(r.Context()))
+}
@@ -0,0 +1,359 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/scheduler"
+)
+
+// Host health sources
+const (
+	loadavgPath   = "/proc/loadavg"
+	procStatPath  = "/proc/stat"
+	diskstatsPath = "/proc/diskstats"
+	sysBlockPath  = "/sys/block"
+)
+
+// gpuQueryTimeout bounds asking nvidia-smi for GPU readings
+const gpuQueryTimeout = 5 * time.Second
+
+// HostHealthLimits are the readings past which a worker reports its host as
+// unhealthy, so schedulers place VMs elsewhere. A zero limit isn't checked.
+type HostHealthLimits struct {
+	MaxTemperatureC    float64 // Hottest CPU, board or GPU sensor
+	MaxDiskIOPercent   float64 // Busiest disk's time spent on IO
+	MaxCPUStealPercent float64 // CPU time taken by the hypervisor, for workers in VMs
+	MaxLoadPerCore     float64 // 1 minute load average per core
+}
+
+// DefaultHostHealthLimits returns the limits workers start with
+func DefaultHostHealthLimits() HostHealthLimits {
+	return HostHealthLimits{
+		MaxTemperatureC:    90,
+		MaxDiskIOPercent:   95,
+		MaxCPUStealPercent: 25,
+		MaxLoadPerCore:     2,
+	}
+}
+
+// HostHealth is a sample of the worker host's health signals. Readings the
+// host doesn't expose are nil; steal time and disk IO need a previous
+// sample, so they are nil on the first.
+type HostHealth struct {
+	Healthy  bool     `json:"healthy"`            // No reading is past its limit
+	Problems []string `json:"problems,omitempty"` // Readings past their limit
+
+	LoadAvg1m   *float64 `json:"load_avg_1m,omitempty"`
+	LoadAvg5m   *float64 `json:"load_avg_5m,omitempty"`
+	LoadAvg15m  *float64 `json:"load_avg_15m,omitempty"`
+	LoadPerCore *float64 `json:"load_per_core,omitempty"`
+
+	CPUStealPercent *float64 `json:"cpu_steal_percent,omitempty"`
+	DiskIOPercent   *float64 `json:"disk_io_percent,omitempty"`
+	DiskIODevice    string   `json:"disk_io_device,omitempty"` // The busiest disk
+
+	TemperatureC      *float64 `json:"temperature_c,omitempty"`
+	TemperatureSensor string   `json:"temperature_sensor,omitempty"` // The hottest sensor
+
+	GPUCount              int      `json:"gpu_count,omitempty"`
+	GPUTemperatureC       *float64 `json:"gpu_temperature_c,omitempty"`       // Hottest GPU
+	GPUUtilizationPercent *float64 `json:"gpu_utilization_percent,omitempty"` // Busiest GPU
+
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// hostHealthSampler samples host health, keeping the counters steal time
+// and disk IO are measured against
+type hostHealthSampler struct {
+	mu       sync.Mutex
+	limits   HostHealthLimits
+	problems string // Problems reported last, to log changes
+
+	sampledAt  time.Time
+	cpuSteal   uint64
+	cpuTotal   uint64
+	diskTicks  map[string]uint64 // Milliseconds spent on IO, by disk
+	nvidiaPath string            // nvidia-smi, if the host has it
+}
+
+func newHostHealthSampler() *hostHealthSampler {
+	s := &hostHealthSampler{limits: DefaultHostHealthLimits()}
+	s.nvidiaPath, _ = exec.LookPath("nvidia-smi")
+	return s
+}
+
+// SetHostHealthLimits sets the readings past which the host is reported as
+// unhealthy
+func (w *Worker) SetHostHealthLimits(limits HostHealthLimits) {
+	w.hostHealth.mu.Lock()
+	w.hostHealth.limits = limits
+	w.hostHealth.mu.Unlock()
+}
+
+// sample reads the host's health signals and checks them against the limits
+func (s *hostHealthSampler) sample(ctx context.Context) *HostHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	health := &HostHealth{CheckedAt: now}
+
+	if loads, err := readLoadAvg(); err == nil {
+		health.LoadAvg1m, health.LoadAvg5m, health.LoadAvg15m = &loads[0], &loads[1], &loads[2]
+		perCore := loads[0] / float64(runtime.NumCPU())
+		health.LoadPerCore = &perCore
+	}
+
+	if steal, total, err := readCPUSteal(); err == nil {
+		if s.cpuTotal > 0 && total > s.cpuTotal && steal >= s.cpuSteal {
+			percent := float64(steal-s.cpuSteal) / float64(total-s.cpuTotal) * 100
+			health.CPUStealPercent = &percent
+		}
+		s.cpuSteal, s.cpuTotal = steal, total
+	}
+
+	if ticks, err := readDiskTicks(); err == nil {
+		if elapsed := now.Sub(s.sampledAt).Milliseconds(); s.diskTicks != nil && elapsed > 0 {
+			for disk, t := range ticks {
+				prev, ok := s.diskTicks[disk]
+				if !ok || t < prev {
+					continue
+				}
+				percent := min(float64(t-prev)/float64(elapsed)*100, 100)
+				if health.DiskIOPercent == nil || percent > *health.DiskIOPercent {
+					health.DiskIOPercent, health.DiskIODevice = &percent, disk
+				}
+			}
+		}
+		s.diskTicks = ticks
+	}
+	s.sampledAt = now
+
+	if temp, sensor, ok := readTemperature(); ok {
+		health.TemperatureC, health.TemperatureSensor = &temp, sensor
+	}
+
+	if s.nvidiaPath != "" {
+		if err := s.sampleGPUs(ctx, health); err != nil {
+			log.Printf("Warning: Failed to read GPU health: %v", err)
+		}
+	}
+
+	health.Problems = s.check(health)
+	health.Healthy = len(health.Problems) == 0
+	return health
+}
+
+// check returns the readings past their limits
+func (s *hostHealthSampler) check(health *HostHealth) []string {
+	var problems []string
+	over := func(value *float64, limit float64, format string) {
+		if value != nil && limit > 0 && *value > limit {
+			problems = append(problems, fmt.Sprintf(format, *value, limit))
+		}
+	}
+	over(health.TemperatureC, s.limits.MaxTemperatureC, "temperature %.0f°C over %.0f°C")
+	over(health.GPUTemperatureC, s.limits.MaxTemperatureC, "GPU temperature %.0f°C over %.0f°C")
+	over(health.DiskIOPercent, s.limits.MaxDiskIOPercent, "disk IO %.0f%% over %.0f%%")
+	over(health.CPUStealPercent, s.limits.MaxCPUStealPercent, "CPU steal %.0f%% over %.0f%%")
+	over(health.LoadPerCore, s.limits.MaxLoadPerCore, "load %.2f per core over %.2f")
+	return problems
+}
+
+// sampleGPUs reads the hottest and busiest NVIDIA GPU
+func (s *hostHealthSampler) sampleGPUs(ctx context.Context, health *HostHealth) error {
+	ctx, cancel := context.WithTimeout(ctx, gpuQueryTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, s.nvidiaPath,
+		"--query-gpu=temperature.gpu,utilization.gpu", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) != 2 {
+			continue
+		}
+		health.GPUCount++
+		// Readings a GPU doesn't support are "[N/A]"
+		if temp, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64); err == nil {
+			if health.GPUTemperatureC == nil || temp > *health.GPUTemperatureC {
+				health.GPUTemperatureC = &temp
+			}
+		}
+		if util, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64); err == nil {
+			if health.GPUUtilizationPercent == nil || util > *health.GPUUtilizationPercent {
+				health.GPUUtilizationPercent = &util
+			}
+		}
+	}
+	return nil
+}
+
+// reportHostHealth samples the host's health and records it in the worker's
+// database record for schedulers. Problems are logged when they change.
+func (w *Worker) reportHostHealth(ctx context.Context) *HostHealth {
+	health := w.hostHealth.sample(ctx)
+
+	problems := strings.Join(health.Problems, ", ")
+	w.hostHealth.mu.Lock()
+	if problems != w.hostHealth.problems {
+		if problems == "" {
+			log.Printf("✓ Host healthy again")
+		} else {
+			log.Printf("Warning: Host unhealthy, schedulers will skip this worker: %s", problems)
+		}
+		w.hostHealth.problems = problems
+	}
+	w.hostHealth.mu.Unlock()
+
+	if w.workerInfo != nil {
+		if err := w.store.Workers().UpdateMetadata(ctx, w.workerInfo.ID, map[string]interface{}{scheduler.MetadataHostHealth: health}); err != nil {
+			log.Printf("Warning: Failed to report host health in database: %v", err)
+		}
+	}
+	return health
+}
+
+// readLoadAvg returns the 1, 5 and 15 minute load averages
+func readLoadAvg() ([3]float64, error) {
+	var loads [3]float64
+	data, err := os.ReadFile(loadavgPath)
+	if err != nil {
+		return loads, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return loads, fmt.Errorf("unexpected %s format", loadavgPath)
+	}
+	for i := range loads {
+		if loads[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return loads, fmt.Errorf("invalid load average: %w", err)
+		}
+	}
+	return loads, nil
+}
+
+// readCPUSteal returns the steal and total CPU time from /proc/stat, in
+// clock ticks
+func readCPUSteal() (steal, total uint64, err error) {
+	f, err := os.Open(procStatPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// cpu user nice system idle iowait irq softirq steal guest guest_nice
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 9 || fields[0] != "cpu" {
+			continue
+		}
+		// Guest time is already counted in user and nice
+		for i, field := range fields[1:9] {
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid CPU time: %w", err)
+			}
+			total += v
+			if i == 7 {
+				steal = v
+			}
+		}
+		return steal, total, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	return 0, 0, fmt.Errorf("CPU times not found in %s", procStatPath)
+}
+
+// readDiskTicks returns the milliseconds each whole disk has spent on IO.
+// Partitions, loop devices and RAM disks are skipped.
+func readDiskTicks() (map[string]uint64, error) {
+	f, err := os.Open(diskstatsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ticks := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// major minor name reads ... io_in_progress io_ticks ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 13 {
+			continue
+		}
+		name := fields[2]
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(sysBlockPath, name)); err != nil {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[12], 10, 64); err == nil {
+			ticks[name] = v
+		}
+	}
+	return ticks, scanner.Err()
+}
+
+// readTemperature returns the hottest reading of the host's thermal zones
+// and hardware monitors, in °C, with the sensor it came from
+func readTemperature() (float64, string, bool) {
+	var hottest float64
+	var sensor string
+	found := false
+	read := func(path, name string) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+		milli, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		// Sensors that aren't wired up read zero or less
+		if err != nil || milli <= 0 {
+			return
+		}
+		if temp := float64(milli) / 1000; !found || temp > hottest {
+			hottest, sensor, found = temp, name, true
+		}
+	}
+
+	zones, _ := filepath.Glob("/sys/class/thermal/thermal_zone*")
+	for _, zone := range zones {
+		read(filepath.Join(zone, "temp"), sensorName(zone, "type"))
+	}
+	inputs, _ := filepath.Glob("/sys/class/hwmon/hwmon*/temp*_input")
+	for _, input := range inputs {
+		read(input, sensorName(filepath.Dir(input), "name")+"/"+strings.TrimSuffix(filepath.Base(input), "_input"))
+	}
+	return hottest, sensor, found
+}
+
+// sensorName reads a sensor's name from file in its sysfs directory,
+// falling back to the directory's name
+func sensorName(dir, file string) string {
+	if data, err := os.ReadFile(filepath.Join(dir, file)); err == nil {
+		if name := strings.TrimSpace(string(data)); name != "" {
+			return name
+		}
+	}
+	return filepath.Base(dir)
+}
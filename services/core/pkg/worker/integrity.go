@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// RegisterRootFS records the checksum of the default rootfs template, which
+// the orchestrator verifies VMs against, in the worker's metadata. It fails
+// if the template doesn't pass verification; VMs then won't boot from it.
+func (w *Worker) RegisterRootFS(ctx context.Context) error {
+	verifier, ok := w.orchestrator.(vmm.IntegrityVerifier)
+	if !ok {
+		return nil
+	}
+
+	checksum, err := verifier.RegisterTemplate(ctx, "")
+	if err != nil {
+		w.reportIntegrityFailure(ctx, "", err)
+		return err
+	}
+
+	if w.workerInfo != nil {
+		if err := w.store.Workers().UpdateMetadata(ctx, w.workerInfo.ID, map[string]interface{}{
+			"rootfs_checksum": checksum,
+		}); err != nil {
+			log.Printf("Warning: Failed to record rootfs checksum: %v", err)
+		}
+	}
+	return nil
+}
+
+// createVM creates a VM, reporting rootfs and agent integrity failures as
+// events. They fail the task without retries, as the image must be fixed.
+func (w *Worker) createVM(ctx context.Context, config *types.VMConfig) (*types.VM, error) {
+	vm, err := w.orchestrator.CreateVM(ctx, config)
+	if err != nil && w.reportIntegrityFailure(ctx, config.ID, err) {
+		return nil, queue.Terminal(err)
+	}
+	return vm, err
+}
+
+// reportIntegrityFailure records an event if err is an integrity failure
+// and reports whether it was one
+func (w *Worker) reportIntegrityFailure(ctx context.Context, vmID string, err error) bool {
+	var integrityErr *vmm.IntegrityError
+	if !errors.As(err, &integrityErr) {
+		return false
+	}
+
+	resourceType, resourceID := "vm", vmID
+	if vmID == "" {
+		resourceType = "worker"
+		if w.workerInfo != nil {
+			resourceID = w.workerInfo.ID
+		}
+	}
+
+	log.Printf("✗ Integrity check failed: %v", integrityErr)
+	w.recordEvent(ctx, events.TopicVMIntegrityFailed, SeverityError, resourceType, resourceID,
+		fmt.Sprintf("Refusing to boot from %s: %s", integrityErr.Path, integrityErr.Reason), map[string]interface{}{
+			"component": integrityErr.Component,
+			"path":      integrityErr.Path,
+			"reason":    integrityErr.Reason,
+		})
+	return true
+}
@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"context"
+	"log"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/logging"
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+)
+
+// SetLogger ships task, VM event and tool install logs to logger (e.g. Loki),
+// labelled with the task, VM and workspace they belong to
+func (w *Worker) SetLogger(logger logging.Logger) {
+	w.logger = logger
+	w.toolInstaller.SetLogger(logger)
+}
+
+// taskLogContext returns ctx carrying the task's correlation fields, so every
+// log shipped while handling the task can be found by them
+func (w *Worker) taskLogContext(ctx context.Context, task *queue.Task) context.Context {
+	fields := map[string]interface{}{
+		"task_id":   task.ID.String(),
+		"task_type": string(task.Type),
+	}
+	if w.workerInfo != nil {
+		fields["worker_id"] = w.workerInfo.ID
+	}
+	for _, key := range []string{"vm_id", "workspace_id", "prompt_id"} {
+		if value, ok := task.Payload[key].(string); ok && value != "" {
+			fields[key] = value
+		}
+	}
+	return logging.WithFields(ctx, fields)
+}
+
+// shipLog sends a log entry to the logger, if one is set. Entries logged
+// while handling a task are also published on the task's progress topic.
+func (w *Worker) shipLog(ctx context.Context, level types.LogLevel, message string, fields map[string]interface{}) {
+	w.publishTaskLog(ctx, level, message, fields)
+	if w.logger == nil {
+		return
+	}
+	if err := w.logger.Log(ctx, level, message, fields); err != nil {
+		log.Printf("Warning: Failed to ship log: %v", err)
+	}
+}
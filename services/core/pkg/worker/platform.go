@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"fmt"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// canBootEnvironment checks that the worker can boot VMs for an
+// environment. Windows guests need the docker-windows capability, which only
+// workers registered in distributed mode advertise.
+func (w *Worker) canBootEnvironment(env *storage.Environment) error {
+	if !env.IsWindows() {
+		return nil
+	}
+	if w.workerInfo != nil {
+		for _, capability := range w.workerInfo.Capabilities {
+			if capability == vmm.CapabilityDockerWindows {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("windows VMs need a worker with the %s capability", vmm.CapabilityDockerWindows)
+}
+
+// applyPlatformMetadata asks the orchestrator for a VM of the environment's
+// guest platform
+func applyPlatformMetadata(env *storage.Environment, metadata map[string]string) {
+	if env.IsWindows() {
+		metadata[vmm.MetadataPlatform] = vmm.PlatformWindows
+	}
+}
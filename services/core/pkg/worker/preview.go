@@ -0,0 +1,190 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// PreviewHandler serves the gateway's workspace previews: HTTP (including
+// WebSocket upgrades) proxied to a port a VM listens on. Requests must carry
+// secret as a bearer token.
+//
+//	ANY /preview/{id}/{port}/{path...}
+func (w *Worker) PreviewHandler(secret string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/preview/{id}/{port}/{path...}", w.servePreview)
+	return requireBearer(mux, secret)
+}
+
+// PeerHandler serves the VM endpoints the gateway and other workers call:
+// the ports a VM listens on and the processes behind them, short commands
+// for the gateway's synchronous execute, terminals for workspace sessions
+// and VM directories streamed to workers cloning workspaces. Requests must
+// carry secret as a bearer token.
+//
+//	GET  /vms/{id}/ports
+//	GET  /vms/{id}/processes
+//	POST /vms/{id}/processes/{pid}/signal
+//	POST /vms/{id}/exec
+//	GET  /vms/{id}/terminal
+//	GET  /vms/{id}/archive
+func (w *Worker) PeerHandler(secret string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /vms/{id}/ports", w.serveVMPorts)
+	mux.HandleFunc("GET /vms/{id}/processes", w.serveVMProcesses)
+	mux.HandleFunc("POST /vms/{id}/processes/{pid}/signal", w.signalVMProcess)
+	mux.HandleFunc("POST /vms/{id}/exec", w.execVMSync)
+	mux.HandleFunc("GET /vms/{id}/terminal", w.serveVMTerminal)
+	mux.HandleFunc("GET /vms/{id}/archive", w.serveVMArchive)
+	return requireBearer(mux, secret)
+}
+
+func (w *Worker) portForwarder() (vmm.PortForwarder, error) {
+	forwarder, ok := w.orchestrator.(vmm.PortForwarder)
+	if !ok {
+		return nil, fmt.Errorf("orchestrator does not support previews")
+	}
+	return forwarder, nil
+}
+
+// serveVMPorts lists the ports a VM listens on
+func (w *Worker) serveVMPorts(rw http.ResponseWriter, r *http.Request) {
+	forwarder, err := w.portForwarder()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	ports, err := forwarder.ListPorts(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if ports == nil {
+		ports = []int{}
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(map[string][]int{"ports": ports})
+}
+
+// serveVMProcesses lists a VM's processes and listening sockets
+func (w *Worker) serveVMProcesses(rw http.ResponseWriter, r *http.Request) {
+	inspector, ok := w.orchestrator.(vmm.Inspector)
+	if !ok {
+		http.Error(rw, "orchestrator does not support process listing", http.StatusNotImplemented)
+		return
+	}
+
+	vmID := r.PathValue("id")
+	processes, err := inspector.ListProcesses(r.Context(), vmID)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadGateway)
+		return
+	}
+	sockets, err := inspector.ListSockets(r.Context(), vmID)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if processes == nil {
+		processes = []vmm.ProcessInfo{}
+	}
+	if sockets == nil {
+		sockets = []vmm.SocketInfo{}
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(struct {
+		Processes []vmm.ProcessInfo `json:"processes"`
+		Sockets   []vmm.SocketInfo  `json:"sockets"`
+	}{processes, sockets})
+}
+
+// signalVMProcess sends the signal named in the request body to a process
+// in a VM
+func (w *Worker) signalVMProcess(rw http.ResponseWriter, r *http.Request) {
+	inspector, ok := w.orchestrator.(vmm.Inspector)
+	if !ok {
+		http.Error(rw, "orchestrator does not support process signals", http.StatusNotImplemented)
+		return
+	}
+
+	pid, err := strconv.Atoi(r.PathValue("pid"))
+	if err != nil || pid < 1 {
+		http.Error(rw, "Invalid PID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Signal string `json:"signal"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(rw, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	vmID := r.PathValue("id")
+	if err := inspector.SignalProcess(r.Context(), vmID, pid, req.Signal); err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, vmm.ErrProcessNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(rw, err.Error(), status)
+		return
+	}
+	log.Printf("Sent SIG%s to process %d in VM %s", req.Signal, pid, vmID)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// servePreview proxies a request to a port of a VM. The app sees itself
+// served at / on localhost, the host most dev servers accept.
+func (w *Worker) servePreview(rw http.ResponseWriter, r *http.Request) {
+	forwarder, err := w.portForwarder()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	vmID := r.PathValue("id")
+	port, err := strconv.Atoi(r.PathValue("port"))
+	if err != nil || port < 1 || port > 65535 {
+		http.Error(rw, "Invalid port", http.StatusBadRequest)
+		return
+	}
+	path := "/" + r.PathValue("path")
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme = "http"
+			pr.Out.URL.Host = fmt.Sprintf("localhost:%d", port)
+			pr.Out.URL.Path = path
+			pr.Out.URL.RawPath = ""
+			pr.Out.Host = pr.Out.URL.Host
+			pr.Out.Header.Del("Authorization")
+			pr.Out.Header["X-Forwarded-For"] = pr.In.Header["X-Forwarded-For"]
+			pr.Out.Header["X-Forwarded-Host"] = pr.In.Header["X-Forwarded-Host"]
+			pr.Out.Header["X-Forwarded-Proto"] = pr.In.Header["X-Forwarded-Proto"]
+		},
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return forwarder.DialPort(ctx, vmID, port)
+			},
+			DisableKeepAlives: true,
+		},
+		FlushInterval: -1, // Event streams, e.g. dev server reloads
+		ErrorHandler: func(rw http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Preview of VM %s port %d failed: %v", vmID, port, err)
+			http.Error(rw, fmt.Sprintf("Nothing is answering on port %d: %v", port, err), http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(rw, r)
+}
@@ -0,0 +1,109 @@
+package worker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/google/uuid"
+)
+
+// promptAttachmentsDir is where a prompt's attachments are copied, relative
+// to the prompt's working directory
+func promptAttachmentsDir(promptID uuid.UUID) string {
+	return path.Join(".aetherium", "attachments", promptID.String())
+}
+
+// copyPromptAttachments copies a prompt's attachments into its working
+// directory in the VM
+func (w *Worker) copyPromptAttachments(ctx context.Context, vmID, workingDir string, promptID uuid.UUID, attachments []*storage.PromptAttachment) error {
+	copier, ok := w.orchestrator.(vmm.DirectoryCopier)
+	if !ok {
+		return fmt.Errorf("orchestrator does not support copying attachments into VMs")
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, a := range attachments {
+		content, err := w.store.PromptAttachments().GetContent(ctx, a.ID)
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Name:    a.Name,
+			Mode:    0644,
+			Size:    int64(len(content)),
+			ModTime: a.CreatedAt,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	dir := path.Join(workingDir, promptAttachmentsDir(promptID))
+	files, err := copier.ExtractDir(ctx, vmID, dir, &buf)
+	if err != nil {
+		return fmt.Errorf("could not copy attachments into VM %s: %w", vmID, err)
+	}
+	log.Printf("✓ Copied %d attachment(s) of prompt %s into %s", files, promptID, dir)
+	return nil
+}
+
+// cleanupPromptAttachments removes a prompt's attachments from the VM and,
+// once the prompt has finished for good, drops their content. A prompt
+// being retried keeps the content for its next attempt.
+func (w *Worker) cleanupPromptAttachments(ctx context.Context, vmID, workingDir string, promptID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+
+	dir := path.Join(workingDir, promptAttachmentsDir(promptID))
+	if _, err := w.orchestrator.ExecuteCommand(ctx, vmID, &vmm.Command{Cmd: "rm", Args: []string{"-rf", dir}}); err != nil {
+		log.Printf("Warning: Failed to remove attachments of prompt %s from VM %s: %v", promptID, vmID, err)
+	}
+
+	prompt, err := w.store.PromptTasks().Get(ctx, promptID)
+	if err != nil {
+		log.Printf("Warning: Failed to get prompt %s to clean up its attachments: %v", promptID, err)
+		return
+	}
+	if storage.IsTerminalPromptStatus(prompt.Status) {
+		if err := w.store.PromptAttachments().ClearContent(ctx, promptID); err != nil {
+			log.Printf("Warning: Failed to clean up attachments of prompt %s: %v", promptID, err)
+		}
+	}
+}
+
+// promptWithAttachments replaces {{attachment:NAME}} references in a prompt
+// with the attachment's path relative to the working directory, and lists
+// the attachments after the prompt so the assistant knows of them either way
+func promptWithAttachments(prompt string, promptID uuid.UUID, attachments []*storage.PromptAttachment) string {
+	dir := promptAttachmentsDir(promptID)
+
+	var list strings.Builder
+	list.WriteString("\n\nAttached files (paths relative to the working directory):")
+	for _, a := range attachments {
+		file := path.Join(dir, a.Name)
+		prompt = strings.ReplaceAll(prompt, "{{attachment:"+a.Name+"}}", file)
+		fmt.Fprintf(&list, "\n- %s (%d bytes)", file, a.SizeBytes)
+	}
+
+	return prompt + list.String()
+}
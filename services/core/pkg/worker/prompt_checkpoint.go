@@ -0,0 +1,249 @@
+package worker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/redact"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/google/uuid"
+)
+
+// DefaultPromptCheckpointInterval is how often a running prompt is
+// checkpointed unless configured otherwise
+const DefaultPromptCheckpointInterval = 30 * time.Second
+
+// promptCheckpointTimeout bounds taking one checkpoint
+const promptCheckpointTimeout = 20 * time.Second
+
+// maxResumeOutputBytes is how much of an interrupted attempt's output the
+// next attempt is shown
+const maxResumeOutputBytes = 16 << 10
+
+// SetPromptCheckpointInterval sets how often running prompts are
+// checkpointed (0 = DefaultPromptCheckpointInterval, negative = never)
+func (w *Worker) SetPromptCheckpointInterval(interval time.Duration) {
+	w.promptCheckpointInterval = interval
+}
+
+// startPromptCheckpoints checkpoints a running prompt periodically until the
+// returned function is called. Checkpoints are masked with redactor, and
+// only saved when the prompt made progress since the last one. The diff is
+// also kept unredacted but sealed, for resuming the prompt.
+func (w *Worker) startPromptCheckpoints(ctx context.Context, vmID, workingDir string, prompt *storage.PromptTask, redactor *redact.Redactor) (stop func()) {
+	interval := w.promptCheckpointInterval
+	if interval == 0 {
+		interval = DefaultPromptCheckpointInterval
+	}
+	if interval < 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var (
+			last     *storage.PromptCheckpoint
+			lastDiff string
+		)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			checkpoint, err := w.takePromptCheckpoint(ctx, vmID, workingDir, prompt.ID)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Warning: Failed to checkpoint prompt %s: %v", prompt.ID, err)
+				}
+				continue
+			}
+			diff := checkpoint.Diff
+			checkpoint.Stdout = redactor.String(checkpoint.Stdout)
+			checkpoint.Stderr = redactor.String(checkpoint.Stderr)
+			checkpoint.Diff = redactor.String(diff)
+			if last != nil && checkpoint.Stdout == last.Stdout && checkpoint.Stderr == last.Stderr && diff == lastDiff {
+				continue
+			}
+			// A redacted diff would restore the masks in place of the secrets
+			if diff != "" && w.workspaceService != nil {
+				if err := w.workspaceService.SealCheckpointDiff(checkpoint, diff); err != nil {
+					log.Printf("Warning: Failed to seal checkpoint diff of prompt %s: %v", prompt.ID, err)
+				}
+			}
+
+			checkpoint.Attempt = prompt.Attempt
+			checkpoint.Sequence = 1
+			if last != nil {
+				checkpoint.Sequence = last.Sequence + 1
+			}
+			if err := w.store.PromptCheckpoints().Save(ctx, checkpoint); err != nil {
+				log.Printf("Warning: Failed to save checkpoint of prompt %s: %v", prompt.ID, err)
+				continue
+			}
+			last = checkpoint
+			lastDiff = diff
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// takePromptCheckpoint reads a running prompt's output so far and the
+// uncommitted changes in its working directory from the VM
+func (w *Worker) takePromptCheckpoint(ctx context.Context, vmID, workingDir string, promptID uuid.UUID) (*storage.PromptCheckpoint, error) {
+	ctx, cancel := context.WithTimeout(ctx, promptCheckpointTimeout)
+	defer cancel()
+
+	outPath := promptOutputPath(promptID)
+	output, err := w.orchestrator.ExecuteCommand(ctx, vmID, &vmm.Command{
+		Cmd:  "bash",
+		Args: []string{"-c", fmt.Sprintf("cat %s.out 2>/dev/null; cat %s.err >&2 2>/dev/null; exit 0", outPath, outPath)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read output: %w", err)
+	}
+
+	// The working directory belongs to the prompt's user, not root
+	script := fmt.Sprintf(`
+cd %s 2>/dev/null || exit 0
+git -c safe.directory='*' rev-parse --git-dir >/dev/null 2>&1 || exit 0
+{
+    git -c safe.directory='*' diff --binary HEAD
+    git -c safe.directory='*' ls-files -z --others --exclude-standard |
+        xargs -0 -r -n1 git -c safe.directory='*' diff --binary --no-index /dev/null
+} 2>/dev/null | head -c %d
+exit 0
+`, workingDir, storage.MaxCheckpointDiffBytes+1)
+	diff, err := w.orchestrator.ExecuteCommand(ctx, vmID, &vmm.Command{Cmd: "bash", Args: []string{"-c", script}})
+	if err != nil {
+		return nil, fmt.Errorf("could not diff working directory: %w", err)
+	}
+
+	checkpoint := &storage.PromptCheckpoint{
+		PromptID:  promptID,
+		Stdout:    output.Stdout,
+		Stderr:    output.Stderr,
+		Diff:      diff.Stdout,
+		CreatedAt: time.Now(),
+	}
+	if len(checkpoint.Diff) > storage.MaxCheckpointDiffBytes {
+		checkpoint.Diff = checkpoint.Diff[:storage.MaxCheckpointDiffBytes]
+		checkpoint.DiffTruncated = true
+	}
+	return checkpoint, nil
+}
+
+// resumeFromCheckpoint prepares a retried prompt to pick up where an earlier
+// attempt was interrupted: the changes it had made are restored to the
+// working directory, and the prompt is extended with the end of its output.
+// Prompts without a checkpoint from an earlier attempt are returned as is.
+func (w *Worker) resumeFromCheckpoint(ctx context.Context, vmID, workingDir string, promptTask *storage.PromptTask, prompt string) string {
+	checkpoint, err := w.store.PromptCheckpoints().Get(ctx, promptTask.ID)
+	if err != nil {
+		log.Printf("Warning: Failed to get checkpoint of prompt %s: %v", promptTask.ID, err)
+		return prompt
+	}
+	if checkpoint == nil || checkpoint.Attempt >= promptTask.Attempt {
+		return prompt
+	}
+
+	restored := "Its changes to the working directory could not be restored."
+	if checkpoint.Diff == "" {
+		restored = "It had not changed the working directory yet."
+	} else if checkpoint.DiffTruncated {
+		log.Printf("Warning: Not restoring changes of prompt %s: its checkpoint diff was truncated", promptTask.ID)
+	} else if w.workspaceService == nil {
+		log.Printf("Warning: Not restoring changes of prompt %s: no workspace service to open its checkpoint diff", promptTask.ID)
+	} else if diff, err := w.workspaceService.CheckpointDiff(checkpoint); err != nil {
+		log.Printf("Warning: Not restoring changes of prompt %s: %v", promptTask.ID, err)
+	} else if err := w.restoreCheckpointDiff(ctx, vmID, workingDir, promptTask.ID, diff); err != nil {
+		log.Printf("Warning: Failed to restore changes of prompt %s: %v", promptTask.ID, err)
+	} else {
+		restored = "The changes it had made to the working directory have been restored."
+		log.Printf("✓ Restored changes of prompt %s from its attempt %d checkpoint", promptTask.ID, checkpoint.Attempt)
+	}
+
+	output := checkpoint.Stdout
+	if len(output) > maxResumeOutputBytes {
+		output = "..." + output[len(output)-maxResumeOutputBytes:]
+	}
+	return fmt.Sprintf("%s\n\nThis prompt was interrupted on an earlier attempt when its worker or VM failed. %s "+
+		"Continue from where it left off rather than starting over. Its output before it was interrupted ended with:\n\n%s",
+		prompt, restored, output)
+}
+
+// restoreCheckpointDiff applies a checkpoint's diff to the working directory
+func (w *Worker) restoreCheckpointDiff(ctx context.Context, vmID, workingDir string, promptID uuid.UUID, diff string) error {
+	copier, ok := w.orchestrator.(vmm.DirectoryCopier)
+	if !ok {
+		return fmt.Errorf("orchestrator does not support copying files into VMs")
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	name := promptID.String() + ".diff"
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(diff)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	if _, err := tw.Write([]byte(diff)); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	dir := "/tmp/aetherium-checkpoints"
+	if _, err := copier.ExtractDir(ctx, vmID, dir, &buf); err != nil {
+		return fmt.Errorf("could not copy diff into VM %s: %w", vmID, err)
+	}
+
+	file := path.Join(dir, name)
+	script := fmt.Sprintf(`
+mkdir -p %s && cd %s || exit 1
+git -c safe.directory='*' apply --binary --whitespace=nowarn %s
+status=$?
+rm -f %s
+exit $status
+`, workingDir, workingDir, file, file)
+	result, err := w.orchestrator.ExecuteCommand(ctx, vmID, &vmm.Command{Cmd: "bash", Args: []string{"-c", script}})
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("git apply exited with %d: %s", result.ExitCode, result.Stderr)
+	}
+	return nil
+}
+
+// withPromptCheckpoint fills in the output of a prompt that failed without
+// any from its latest checkpoint
+func (w *Worker) withPromptCheckpoint(ctx context.Context, promptID uuid.UUID, result *storage.PromptResult) *storage.PromptResult {
+	checkpoint, err := w.store.PromptCheckpoints().Get(ctx, promptID)
+	if err != nil {
+		log.Printf("Warning: Failed to get checkpoint of prompt %s: %v", promptID, err)
+		return result
+	}
+	result.WithCheckpoint(checkpoint)
+	return result
+}
@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// Exit codes of processes killed by a signal (128 + signal)
+const (
+	exitCodeNotFound = 127 // Shell: command not found
+	exitCodeSIGABRT  = 134
+	exitCodeSIGKILL  = 137 // What the OOM killer sends
+	exitCodeSIGSEGV  = 139
+)
+
+// maxFailureDetail bounds the output line kept as a failure's detail
+const maxFailureDetail = 300
+
+// failurePattern classifies failures whose output matches it
+type failurePattern struct {
+	reason string
+	re     *regexp.Regexp
+}
+
+// failurePatterns are checked in order against stderr, then stdout. The
+// specific causes come before crashes, which they often end in.
+var failurePatterns = []failurePattern{
+	{storage.PromptFailureOutOfMemory, regexp.MustCompile(`(?i)out of memory|cannot allocate memory|oom-kill|MemoryError|heap limit`)},
+	{storage.PromptFailureDiskFull, regexp.MustCompile(`(?i)no space left on device|ENOSPC|disk quota exceeded`)},
+	{storage.PromptFailureAuth, regexp.MustCompile(`(?i)invalid x-api-key|authentication_error|invalid api key|missing api key|api key not found|unauthori[sz]ed|please run /login|permission denied \(publickey\)|authentication failed`)},
+	{storage.PromptFailureNetworkBlocked, regexp.MustCompile(`(?i)x-squid-error|ERR_ACCESS_DENIED|TCP_DENIED|403 forbidden|could not resolve host|ENOTFOUND|EAI_AGAIN|ECONNREFUSED|ETIMEDOUT|ECONNRESET|network is unreachable|connection refused|failed to connect to|temporary failure in name resolution`)},
+	{storage.PromptFailureToolMissing, regexp.MustCompile(`(?i)command not found|executable file not found|: not found$`)},
+	{storage.PromptFailureAssistantCrash, regexp.MustCompile(`(?i)segmentation fault|core dumped|^panic:|traceback \(most recent call last\)|uncaught|unhandled(promise)?rejection|fatal error`)},
+}
+
+// oomKillPattern matches the kernel's OOM killer reports in dmesg
+var oomKillPattern = regexp.MustCompile(`(?i)out of memory: kill|oom-kill|killed process`)
+
+// classifyPromptFailure returns why a prompt that exited with exitCode
+// failed and the output line showing it. oomKilled reports whether the
+// VM's kernel killed a process for lack of memory during the prompt.
+func classifyPromptFailure(exitCode int, stdout, stderr string, oomKilled bool) (string, string) {
+	for _, output := range []string{stderr, stdout} {
+		for _, pattern := range failurePatterns {
+			if line := matchingLine(pattern.re, output); line != "" {
+				return pattern.reason, line
+			}
+		}
+	}
+
+	switch {
+	case exitCode == exitCodeSIGKILL && oomKilled:
+		return storage.PromptFailureOutOfMemory, "killed by the OOM killer (exit code 137)"
+	case exitCode == exitCodeNotFound:
+		return storage.PromptFailureToolMissing, "command not found (exit code 127)"
+	case exitCode == exitCodeSIGABRT || exitCode == exitCodeSIGSEGV:
+		return storage.PromptFailureAssistantCrash, fmt.Sprintf("killed by signal %d (exit code %d)", exitCode-128, exitCode)
+	}
+	return storage.PromptFailureUnknown, ""
+}
+
+// matchingLine returns the first line of output matching re, trimmed to
+// maxFailureDetail
+func matchingLine(re *regexp.Regexp, output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || !re.MatchString(line) {
+			continue
+		}
+		if len(line) > maxFailureDetail {
+			line = line[:maxFailureDetail] + "..."
+		}
+		return line
+	}
+	return ""
+}
+
+// diagnosePromptFailure sets the failure reason of a failed prompt's
+// result. What the agent saw the prompt run out of comes first; agents that
+// don't monitor resources leave processes killed by SIGKILL to be checked
+// against the VM's kernel log, as the OOM killer leaves no output behind.
+func (w *Worker) diagnosePromptFailure(ctx context.Context, vmID string, result *storage.PromptResult, resources *vmm.ResourceEvents) {
+	w.recordResourceExhaustion(ctx, vmID, resources)
+	if reason, detail := classifyResourceExhaustion(resources); reason != "" {
+		result.FailureReason, result.FailureDetail = reason, detail
+		log.Printf("Prompt failure classified as %s: %s", result.FailureReason, result.FailureDetail)
+		return
+	}
+
+	oomKilled := false
+	if result.ExitCode == exitCodeSIGKILL && resources == nil {
+		oomKilled = w.vmOOMKilled(ctx, vmID)
+	}
+
+	result.FailureReason, result.FailureDetail = classifyPromptFailure(result.ExitCode, result.Stdout, result.Stderr, oomKilled)
+	log.Printf("Prompt failure classified as %s: %s", result.FailureReason, result.FailureDetail)
+}
+
+// diagnoseAgentFailure sets the failure reason of a prompt that couldn't be
+// run in its VM, noting when the VM itself is gone
+func (w *Worker) diagnoseAgentFailure(ctx context.Context, vmID string, err error, result *storage.PromptResult) {
+	result.FailureReason = storage.PromptFailureAgentError
+	result.FailureDetail = err.Error()
+
+	vm, statusErr := w.orchestrator.GetVMStatus(ctx, vmID)
+	switch {
+	case statusErr != nil:
+		result.FailureDetail += fmt.Sprintf(" (VM status unavailable: %v)", statusErr)
+	case vm.Status != types.VMStatusRunning:
+		result.FailureDetail += fmt.Sprintf(" (VM is %s)", strings.ToLower(string(vm.Status)))
+	}
+}
+
+// vmOOMKilled reports whether the VM's kernel log has an OOM kill
+func (w *Worker) vmOOMKilled(ctx context.Context, vmID string) bool {
+	execResult, err := w.orchestrator.ExecuteCommand(ctx, vmID, &vmm.Command{
+		Cmd:  "bash",
+		Args: []string{"-c", "dmesg 2>/dev/null | tail -n 200"},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to read kernel log of VM %s: %v", vmID, err)
+		return false
+	}
+	return oomKillPattern.MatchString(execResult.Stdout)
+}
@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// canRetryPrompt reports whether a prompt failing for reason is retried
+// on another worker rather than failed
+func (w *Worker) canRetryPrompt(prompt *storage.PromptTask, workspace *storage.Workspace, reason string) bool {
+	return w.workspaceService != nil && w.workspaceService.CanRetryPrompt(prompt, workspace, reason)
+}
+
+// retryPrompt hands a prompt that failed here for an infrastructure reason
+// to another worker. The workspace must already be without a VM. It
+// reports false when the caller should fail the prompt instead.
+func (w *Worker) retryPrompt(ctx context.Context, prompt *storage.PromptTask, vmID string, result *storage.PromptResult) bool {
+	failure := &storage.PromptAttempt{
+		FailureReason: result.FailureReason,
+		Error:         &result.Error,
+	}
+	if w.workerInfo != nil {
+		failure.WorkerID = &w.workerInfo.ID
+	}
+	if id, err := uuid.Parse(vmID); err == nil {
+		failure.VMID = &id
+	}
+
+	retried, err := w.workspaceService.RetryPrompt(ctx, prompt, failure)
+	if errors.Is(err, storage.ErrPromptAttemptPassed) {
+		log.Printf("Prompt %s attempt %d was already retried elsewhere", prompt.ID, prompt.Attempt)
+		return true
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to retry prompt %s: %v", prompt.ID, err)
+		return false
+	}
+	return retried
+}
+
+// abandonWorkspaceVM discards the VM a prompt couldn't run in, leaving the
+// workspace idle so the prompt's next attempt spawns a fresh VM
+func (w *Worker) abandonWorkspaceVM(ctx context.Context, workspace *storage.Workspace, vmID, reason string) error {
+	if err := w.orchestrator.DeleteVM(ctx, vmID); err != nil {
+		log.Printf("Warning: Failed to delete VM %s: %v", vmID, err)
+	}
+	w.mu.Lock()
+	delete(w.runningVMs, vmID)
+	w.mu.Unlock()
+
+	// The workspace was read before an on-demand VM was spawned for it
+	if id, err := uuid.Parse(vmID); err == nil && workspace.VMID == nil {
+		workspace.VMID = &id
+	}
+	if err := w.forgetWorkspaceVM(ctx, workspace); err != nil {
+		return err
+	}
+	if err := w.store.Workspaces().UpdateStatus(ctx, workspace.ID, storage.WorkspaceStatusIdle, reason); err != nil {
+		return fmt.Errorf("failed to mark workspace %s idle: %w", workspace.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/redact"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/google/uuid"
+)
+
+// DefaultPromptTimeout limits prompts whose environment sets no timeout
+const DefaultPromptTimeout = 20 * time.Minute
+
+// promptTimeoutExitCode is reported for timed out prompts, as coreutils'
+// timeout does
+const promptTimeoutExitCode = 124
+
+// promptKillTimeout bounds killing a timed out prompt and collecting its output
+const promptKillTimeout = 30 * time.Second
+
+// SetPromptTimeout sets the time limit for prompts whose environment sets
+// none (0 = DefaultPromptTimeout)
+func (w *Worker) SetPromptTimeout(timeout time.Duration) {
+	w.promptTimeout = timeout
+}
+
+// promptTimeoutFor returns how long a prompt may run: its own timeout, else
+// its environment's, else the worker's
+func (w *Worker) promptTimeoutFor(prompt *storage.PromptTask, env *storage.Environment) time.Duration {
+	if prompt.TimeoutSeconds != nil && *prompt.TimeoutSeconds > 0 {
+		return time.Duration(*prompt.TimeoutSeconds) * time.Second
+	}
+	if env != nil && env.PromptTimeoutSeconds > 0 {
+		return time.Duration(env.PromptTimeoutSeconds) * time.Second
+	}
+	if w.promptTimeout > 0 {
+		return w.promptTimeout
+	}
+	return DefaultPromptTimeout
+}
+
+// promptOutputPath is where a prompt's output is copied in the VM, so it can
+// be collected if the prompt has to be killed
+func promptOutputPath(promptID uuid.UUID) string {
+	return fmt.Sprintf("/tmp/aetherium-prompt-%s", promptID)
+}
+
+// wrapPromptCommand runs a prompt's script in its own session, recording the
+// session ID and copying its output next to it in the VM. When the script is
+// killed (137) the files are left for killPrompt to collect.
+func wrapPromptCommand(promptID uuid.UUID, script string) string {
+	path := promptOutputPath(promptID)
+	return fmt.Sprintf(`
+setsid -w bash -c '%s' > >(tee %s.out) 2> >(tee %s.err >&2) &
+echo $! > %s.pid
+wait $!
+status=$?
+[ $status -ne 137 ] && rm -f %s.pid %s.out %s.err
+exit $status
+`, escapeShellArg(script), path, path, path, path, path, path)
+}
+
+// killPrompt kills a timed out prompt's process tree in the VM and returns
+// the output it had written so far
+func (w *Worker) killPrompt(ctx context.Context, vmID string, promptID uuid.UUID) (*vmm.ExecResult, error) {
+	path := promptOutputPath(promptID)
+	script := fmt.Sprintf(`
+if [ -f %s.pid ]; then
+    sid=$(cat %s.pid)
+    pkill -KILL -s "$sid" 2>/dev/null || kill -KILL -- -"$sid" 2>/dev/null
+    sleep 1
+fi
+cat %s.out 2>/dev/null
+cat %s.err >&2 2>/dev/null
+rm -f %s.pid %s.out %s.err
+exit 0
+`, path, path, path, path, path, path, path)
+
+	killCtx, cancel := context.WithTimeout(ctx, promptKillTimeout)
+	defer cancel()
+
+	return w.orchestrator.ExecuteCommand(killCtx, vmID, &vmm.Command{
+		Cmd:  "bash",
+		Args: []string{"-c", script},
+	})
+}
+
+// timeoutPromptResult kills a prompt that ran past its time limit and builds
+// its result from the output captured before it was killed
+func (w *Worker) timeoutPromptResult(ctx context.Context, vmID string, promptID uuid.UUID, timeout time.Duration, startTime time.Time) *storage.PromptResult {
+	result := &storage.PromptResult{
+		ExitCode:      promptTimeoutExitCode,
+		Error:         fmt.Sprintf("prompt timed out after %v", timeout),
+		FailureReason: storage.PromptFailureTimeout,
+		FailureDetail: fmt.Sprintf("ran past its %v time limit", timeout),
+	}
+
+	partial, err := w.killPrompt(ctx, vmID, promptID)
+	if err != nil {
+		log.Printf("Warning: Failed to kill timed out prompt %s on VM %s: %v", promptID, vmID, err)
+		result.Error += fmt.Sprintf(" (could not kill it: %v)", err)
+	} else {
+		result.Stdout = partial.Stdout
+		result.Stderr = partial.Stderr
+	}
+
+	result.DurationMS = int(time.Since(startTime).Milliseconds())
+	return result
+}
+
+// finishTimedOutPrompt kills a prompt that ran past its time limit, marks it
+// timed out with whatever output it produced and frees its workspace for the
+// next prompt. Its output is masked with redactor.
+func (w *Worker) finishTimedOutPrompt(ctx context.Context, task *queue.Task, promptID, workspaceID uuid.UUID, vmID string, timeout time.Duration, startTime time.Time, redactor *redact.Redactor) *queue.TaskResult {
+	log.Printf("✗ Prompt %s timed out after %v on workspace %s, killing it", promptID, timeout, workspaceID)
+
+	// The task's context may have run out along with the prompt
+	ctx = context.WithoutCancel(ctx)
+
+	result := w.timeoutPromptResult(ctx, vmID, promptID, timeout, startTime)
+	result.Stdout = redactor.String(result.Stdout)
+	result.Stderr = redactor.String(result.Stderr)
+	// The VM may have been too far gone to collect the output from
+	w.withPromptCheckpoint(ctx, promptID, result)
+	w.store.PromptTasks().UpdateStatus(ctx, promptID, storage.PromptStatusTimedOut, result)
+	w.recordPromptFailure(ctx, promptID, workspaceID, fmt.Sprintf("timed out after %v", timeout))
+
+	idleNow := time.Now()
+	w.store.Workspaces().UpdateIdleSince(ctx, workspaceID, &idleNow)
+
+	return &queue.TaskResult{
+		TaskID:  task.ID,
+		Success: false,
+		Error:   result.Error,
+		Result: map[string]interface{}{
+			"prompt_id":    promptID.String(),
+			"workspace_id": workspaceID.String(),
+			"exit_code":    result.ExitCode,
+			"stdout":       result.Stdout,
+			"stderr":       result.Stderr,
+			"timed_out":    true,
+		},
+		Duration:  time.Since(startTime),
+		StartedAt: startTime,
+	}
+}
@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"context"
+	"log"
+
+	"github.com/aetherium/aetherium/services/core/pkg/redact"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/google/uuid"
+)
+
+// outputRedactor returns the redactor for output of commands run for a
+// workspace: it masks the workspace's secrets and whatever its environment's
+// policy selects. A nil env uses the default policy.
+func (w *Worker) outputRedactor(ctx context.Context, workspaceID uuid.UUID, env *storage.Environment) *redact.Redactor {
+	policy := env.RedactionPolicy()
+	if policy.Disabled {
+		return nil
+	}
+
+	var values []string
+	if w.workspaceService != nil {
+		secrets, _, err := w.getWorkspaceSecrets(ctx, workspaceID)
+		if err != nil {
+			log.Printf("Warning: Not masking secrets of workspace %s: %v", workspaceID, err)
+		}
+		for _, value := range secrets {
+			values = append(values, value)
+		}
+	}
+	return redact.New(values, policy)
+}
+
+// workspaceRedactor returns the redactor for output of commands run for a
+// workspace, looking up its environment
+func (w *Worker) workspaceRedactor(ctx context.Context, workspaceID uuid.UUID) *redact.Redactor {
+	workspace, err := w.store.Workspaces().Get(ctx, workspaceID)
+	if err != nil {
+		return redact.New(nil, redact.Policy{})
+	}
+	return w.outputRedactor(ctx, workspaceID, w.workspaceEnvironment(ctx, workspace))
+}
+
+// vmRedactor returns the redactor for output of commands run in a VM. VMs
+// that belong to no workspace have no secrets to mask, only token formats.
+func (w *Worker) vmRedactor(ctx context.Context, vmID string) *redact.Redactor {
+	vmUUID, err := uuid.Parse(vmID)
+	if err != nil {
+		return redact.New(nil, redact.Policy{})
+	}
+	workspace, err := w.store.Workspaces().GetByVMID(ctx, vmUUID)
+	if err != nil {
+		return redact.New(nil, redact.Policy{})
+	}
+	return w.outputRedactor(ctx, workspace.ID, w.workspaceEnvironment(ctx, workspace))
+}
+
+// workspaceEnvironment returns a workspace's environment, or nil if it has
+// none or it can't be read
+func (w *Worker) workspaceEnvironment(ctx context.Context, workspace *storage.Workspace) *storage.Environment {
+	if workspace.EnvironmentID == nil {
+		return nil
+	}
+	env, err := w.store.Environments().Get(ctx, *workspace.EnvironmentID)
+	if err != nil {
+		return nil
+	}
+	return env
+}
+
+// redactExecResult masks secrets in a command's output in place
+func redactExecResult(r *redact.Redactor, result *vmm.ExecResult) {
+	if result == nil {
+		return
+	}
+	result.Stdout = r.String(result.Stdout)
+	result.Stderr = r.String(result.Stderr)
+}
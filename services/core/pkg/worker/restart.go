@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// Worker metadata keys used for version reporting and restart requests
+const (
+	MetadataVersion            = "version"
+	MetadataCommit             = "commit"
+	MetadataRestartRequestedAt = "restart_requested_at"
+	MetadataRestartDeadline    = "restart_deadline"
+)
+
+// SetRestartHandler sets the function called when the gateway requests a restart.
+// The handler should shut the process down gracefully so a supervisor can start
+// the new binary.
+func (w *Worker) SetRestartHandler(fn func()) {
+	w.restartHandler = fn
+}
+
+// checkRestartRequest triggers the restart handler once a requested restart is due:
+// either the worker is drained or the drain deadline has passed. Drained means no
+// tasks are running and no VMs are booting; VMs the orchestrator can adopt are
+// kept across the restart, other VMs must be gone too.
+func (w *Worker) checkRestartRequest(ctx context.Context) {
+	if w.restartHandler == nil || w.restarting {
+		return
+	}
+
+	dbWorker, err := w.store.Workers().Get(ctx, w.workerInfo.ID)
+	if err != nil {
+		log.Printf("Warning: Failed to check restart request: %v", err)
+		return
+	}
+
+	if _, ok := dbWorker.Metadata[MetadataRestartRequestedAt]; !ok {
+		return
+	}
+
+	_, keepsVMs := w.orchestrator.(vmm.Adopter)
+	w.mu.RLock()
+	vmCount := len(w.runningVMs)
+	w.mu.RUnlock()
+	drained := w.idle() && (keepsVMs || vmCount == 0)
+
+	deadlinePassed := false
+	if deadlineStr, ok := dbWorker.Metadata[MetadataRestartDeadline].(string); ok {
+		if deadline, err := time.Parse(time.RFC3339, deadlineStr); err == nil {
+			deadlinePassed = time.Now().After(deadline)
+		}
+	}
+
+	if !drained && !deadlinePassed {
+		if keepsVMs {
+			log.Println("Restart requested, waiting for running tasks to finish")
+		} else {
+			log.Printf("Restart requested, waiting for %d VMs to drain", vmCount)
+		}
+		return
+	}
+
+	switch {
+	case !drained:
+		log.Printf("Restart deadline passed before the worker drained (%d VMs running), restarting anyway", vmCount)
+	case keepsVMs && vmCount > 0:
+		log.Printf("Worker drained, restarting and keeping %d VMs", vmCount)
+	default:
+		log.Println("Worker drained, restarting")
+	}
+
+	w.restarting = true
+	w.restartHandler()
+}
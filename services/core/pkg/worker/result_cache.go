@@ -0,0 +1,110 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultResultCacheTTL is how long cached execution results stay valid
+	DefaultResultCacheTTL = 1 * time.Hour
+	// DefaultResultCacheMaxEntries bounds the number of cached results per worker
+	DefaultResultCacheMaxEntries = 1000
+)
+
+// cachedResult is a successful command execution kept for reuse
+type cachedResult struct {
+	ExitCode  int
+	Stdout    string
+	Stderr    string
+	CreatedAt time.Time
+}
+
+// ResultCache is a worker-local, content-addressed cache of command execution results.
+// Entries are keyed by (image, command, args, inputs hash) so that identical commands
+// against the same image and inputs can be answered without touching a VM.
+type ResultCache struct {
+	mu         sync.Mutex
+	entries    map[string]*cachedResult
+	ttl        time.Duration
+	maxEntries int
+	hits       int64
+	misses     int64
+}
+
+// NewResultCache creates a new result cache
+func NewResultCache(ttl time.Duration, maxEntries int) *ResultCache {
+	if ttl <= 0 {
+		ttl = DefaultResultCacheTTL
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultResultCacheMaxEntries
+	}
+
+	return &ResultCache{
+		entries:    make(map[string]*cachedResult),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+	}
+}
+
+// ResultCacheKey computes the content address for an execution
+func ResultCacheKey(image, command string, args []string, inputsHash string) string {
+	h := sha256.New()
+	h.Write([]byte(image))
+	h.Write([]byte{0})
+	h.Write([]byte(command))
+	h.Write([]byte{0})
+	h.Write([]byte(strings.Join(args, "\x00")))
+	h.Write([]byte{0})
+	h.Write([]byte(inputsHash))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns a cached result if present and not expired
+func (c *ResultCache) Get(key string) (*cachedResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Since(entry.CreatedAt) > c.ttl {
+		if ok {
+			delete(c.entries, key)
+		}
+		c.misses++
+		return nil, false
+	}
+
+	c.hits++
+	return entry, true
+}
+
+// Put stores a result, evicting the oldest entry when the cache is full
+func (c *ResultCache) Put(key string, result *cachedResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		var oldestKey string
+		var oldest time.Time
+		for k, e := range c.entries {
+			if oldestKey == "" || e.CreatedAt.Before(oldest) {
+				oldestKey = k
+				oldest = e.CreatedAt
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+
+	c.entries[key] = result
+}
+
+// Stats returns the number of entries, hits and misses
+func (c *ResultCache) Stats() (entries int, hits, misses int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries), c.hits, c.misses
+}
@@ -0,0 +1,249 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/google/uuid"
+)
+
+const (
+	// Sidecar sizes when the service spec leaves them unset
+	defaultServiceVCPUs    = 1
+	defaultServiceMemoryMB = 512
+
+	// serviceReadyTimeout bounds the wait for a sidecar's ports to open
+	serviceReadyTimeout = 2 * time.Minute
+
+	// serviceLogPath receives the sidecar command's output inside its VM
+	serviceLogPath = "/var/log/aetherium-service.log"
+)
+
+// sidecar is a running service VM of a workspace
+type sidecar struct {
+	name    string
+	vmID    string
+	address string
+}
+
+// startWorkspaceServices boots the environment's sidecar VMs, starts each
+// service and waits for its ports. If one fails, those already started are
+// deleted.
+func (w *Worker) startWorkspaceServices(ctx context.Context, workspace *storage.Workspace, env *storage.Environment) ([]sidecar, error) {
+	// Sidecars of an earlier VM of the workspace, e.g. one that crashed
+	w.destroyWorkspaceServices(ctx, workspace.ID)
+
+	var started []sidecar
+	for _, svc := range env.Services {
+		sc, err := w.startService(ctx, workspace, env, svc)
+		if err != nil {
+			w.destroyWorkspaceServices(ctx, workspace.ID)
+			return nil, fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+		started = append(started, *sc)
+		log.Printf("✓ Service %s of workspace %s is running at %s (vm=%s)", svc.Name, workspace.ID, sc.address, sc.vmID)
+	}
+	return started, nil
+}
+
+func (w *Worker) startService(ctx context.Context, workspace *storage.Workspace, env *storage.Environment, svc storage.ServiceSpec) (*sidecar, error) {
+	vcpus, memoryMB := svc.VCPUs, svc.MemoryMB
+	if vcpus == 0 {
+		vcpus = defaultServiceVCPUs
+	}
+	if memoryMB == 0 {
+		memoryMB = defaultServiceMemoryMB
+	}
+
+	if err := w.admitVM(vcpus, memoryMB); err != nil {
+		return nil, err
+	}
+	defer w.releaseVM(vcpus, memoryMB)
+
+	vmID := uuid.New().String()
+	vmConfig := &types.VMConfig{
+		ID:         vmID,
+		KernelPath: "/var/firecracker/vmlinux",
+		SocketPath: fmt.Sprintf("/tmp/aetherium-vm-%s.sock", vmID),
+		VCPUCount:  vcpus,
+		MemoryMB:   memoryMB,
+		Metadata:   map[string]string{},
+	}
+	if svc.RootFSImage != "" {
+		vmConfig.Metadata["rootfs_template"] = svc.RootFSImage
+	}
+
+	vm, err := w.createVM(ctx, vmConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VM: %w", err)
+	}
+	if err := w.orchestrator.StartVM(ctx, vm.ID); err != nil {
+		w.orchestrator.DeleteVM(ctx, vm.ID)
+		return nil, fmt.Errorf("failed to start VM: %w", err)
+	}
+
+	// Recorded under the workspace so destroyWorkspaceServices finds it, and
+	// so VM GC leaves it alone
+	vmUUID, _ := uuid.Parse(vm.ID)
+	kernelPath := vmConfig.KernelPath
+	socketPath := vmConfig.SocketPath
+	var workerID *string
+	if w.workerInfo != nil {
+		workerID = &w.workerInfo.ID
+	}
+	dbVM := &storage.VM{
+		ID:           vmUUID,
+		Name:         fmt.Sprintf("env-%s-ws-%s-%s", env.Name, workspace.Name, svc.Name),
+		Orchestrator: "firecracker",
+		Status:       string(vm.Status),
+		KernelPath:   &kernelPath,
+		SocketPath:   &socketPath,
+		VCPUCount:    &vcpus,
+		MemoryMB:     &memoryMB,
+		WorkerID:     workerID,
+		CreatedAt:    time.Now(),
+		Metadata: map[string]interface{}{
+			"workspace_id":   workspace.ID.String(),
+			"environment_id": env.ID.String(),
+			"service":        svc.Name,
+		},
+	}
+	if err := w.store.VMs().Create(ctx, dbVM); err != nil {
+		w.orchestrator.DeleteVM(ctx, vm.ID)
+		return nil, fmt.Errorf("failed to record VM: %w", err)
+	}
+
+	w.mu.Lock()
+	w.runningVMs[vm.ID] = &vmResourceUsage{
+		VCPUs:    vcpus,
+		MemoryMB: int64(memoryMB),
+	}
+	w.mu.Unlock()
+
+	// Wait for agent to be ready
+	time.Sleep(5 * time.Second)
+
+	// The command runs detached from the agent's exec session, which would
+	// otherwise wait for it to exit
+	cmdEnv := map[string]string{"AETHERIUM_SERVICE_CMD": svc.Command}
+	for key, value := range svc.Env {
+		cmdEnv[key] = value
+	}
+	start := &vmm.Command{
+		Cmd:  "sh",
+		Args: []string{"-c", fmt.Sprintf(`setsid sh -c "$AETHERIUM_SERVICE_CMD" > %s 2>&1 < /dev/null &`, serviceLogPath)},
+		Env:  cmdEnv,
+	}
+	if err := w.execInVM(ctx, vm.ID, start); err != nil {
+		return nil, fmt.Errorf("failed to start command: %w", err)
+	}
+
+	if len(svc.Ports) > 0 {
+		if err := w.waitForServicePorts(ctx, vm.ID, svc.Ports); err != nil {
+			return nil, err
+		}
+	}
+
+	address, err := w.vmAddress(ctx, vm.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sidecar{name: svc.Name, vmID: vm.ID, address: address}, nil
+}
+
+// waitForServicePorts waits, inside the sidecar, until every port accepts
+// connections
+func (w *Worker) waitForServicePorts(ctx context.Context, vmID string, ports []int) error {
+	portList := make([]string, len(ports))
+	for i, port := range ports {
+		portList[i] = strconv.Itoa(port)
+	}
+	script := fmt.Sprintf(`for port in %s; do
+	i=0
+	until (echo > /dev/tcp/127.0.0.1/$port) 2>/dev/null; do
+		i=$((i+1))
+		if [ $i -ge %d ]; then echo "port $port did not open" >&2; tail -n 20 %s >&2; exit 1; fi
+		sleep 1
+	done
+done`, strings.Join(portList, " "), int(serviceReadyTimeout/time.Second), serviceLogPath)
+
+	return w.execInVM(ctx, vmID, &vmm.Command{Cmd: "bash", Args: []string{"-c", script}})
+}
+
+// vmAddress returns the VM's primary IP address as seen from inside it
+func (w *Worker) vmAddress(ctx context.Context, vmID string) (string, error) {
+	result, err := w.orchestrator.ExecuteCommand(ctx, vmID, &vmm.Command{Cmd: "hostname", Args: []string{"-I"}})
+	if err != nil {
+		return "", fmt.Errorf("failed to get address: %w", err)
+	}
+	fields := strings.Fields(result.Stdout)
+	if result.ExitCode != 0 || len(fields) == 0 {
+		return "", fmt.Errorf("VM %s has no IP address", vmID)
+	}
+	return fields[0], nil
+}
+
+// linkWorkspaceServices adds each sidecar to the workspace VM's /etc/hosts
+// under its service name
+func (w *Worker) linkWorkspaceServices(ctx context.Context, vmID string, sidecars []sidecar) error {
+	var hosts strings.Builder
+	for _, sc := range sidecars {
+		fmt.Fprintf(&hosts, "%s %s\n", sc.address, sc.name)
+	}
+	cmd := &vmm.Command{
+		Cmd:  "sh",
+		Args: []string{"-c", `printf '%s' "$AETHERIUM_HOSTS" >> /etc/hosts`},
+		Env:  map[string]string{"AETHERIUM_HOSTS": hosts.String()},
+	}
+	return w.execInVM(ctx, vmID, cmd)
+}
+
+// destroyWorkspaceServices deletes a workspace's sidecar VMs and their
+// records. VMs on other workers (after a failover) can't be reached and only
+// lose their records.
+func (w *Worker) destroyWorkspaceServices(ctx context.Context, workspaceID uuid.UUID) {
+	vms, err := w.store.VMs().List(ctx, map[string]interface{}{"workspace_id": workspaceID.String()})
+	if err != nil {
+		log.Printf("Warning: Failed to list services of workspace %s: %v", workspaceID, err)
+		return
+	}
+
+	for _, vm := range vms {
+		if _, ok := vm.Metadata["service"]; !ok {
+			continue // The workspace VM
+		}
+
+		vmID := vm.ID.String()
+		if vm.WorkerID == nil || (w.workerInfo != nil && *vm.WorkerID == w.workerInfo.ID) {
+			if err := w.orchestrator.DeleteVM(ctx, vmID); err != nil {
+				log.Printf("Warning: Failed to delete service VM %s: %v", vmID, err)
+			}
+			w.mu.Lock()
+			delete(w.runningVMs, vmID)
+			w.mu.Unlock()
+		}
+		if err := w.store.VMs().Delete(ctx, vm.ID); err != nil {
+			log.Printf("Warning: Failed to delete service VM %s from database: %v", vmID, err)
+		}
+	}
+}
+
+// execInVM runs cmd and fails on a non-zero exit code
+func (w *Worker) execInVM(ctx context.Context, vmID string, cmd *vmm.Command) error {
+	result, err := w.orchestrator.ExecuteCommand(ctx, vmID, cmd)
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("exit code %d: %s", result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+	return nil
+}
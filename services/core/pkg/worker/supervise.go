@@ -0,0 +1,137 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/google/uuid"
+)
+
+// Restart policies for VMs whose process exits unexpectedly
+const (
+	RestartPolicyNever   = "never"    // Mark crashed VMs failed
+	RestartPolicyOnCrash = "on-crash" // Boot crashed VMs again, up to the restart limit
+)
+
+// DefaultMaxVMRestarts is how many times a crashed VM is restarted before it's marked failed
+const DefaultMaxVMRestarts = 3
+
+// SetVMRestartPolicy sets what happens to VMs that crash on this worker.
+// maxRestarts limits restarts per VM; 0 uses DefaultMaxVMRestarts.
+func (w *Worker) SetVMRestartPolicy(policy string, maxRestarts int) error {
+	if policy != RestartPolicyNever && policy != RestartPolicyOnCrash {
+		return fmt.Errorf("unknown VM restart policy: %q", policy)
+	}
+	if maxRestarts <= 0 {
+		maxRestarts = DefaultMaxVMRestarts
+	}
+
+	w.mu.Lock()
+	w.restartPolicy = policy
+	w.maxVMRestarts = maxRestarts
+	w.mu.Unlock()
+	return nil
+}
+
+// superviseVMs registers the worker for VM exit notifications when the
+// orchestrator watches its VM processes
+func (w *Worker) superviseVMs() {
+	if supervisor, ok := w.orchestrator.(vmm.Supervisor); ok {
+		supervisor.SetExitHandler(w.handleVMExit)
+	}
+}
+
+// handleVMExit records a crashed VM and, if the restart policy allows it,
+// boots it again. VMs that aren't restarted are marked failed and stop
+// counting against the worker's capacity.
+func (w *Worker) handleVMExit(exit vmm.VMExit) {
+	ctx := context.Background()
+	vmUUID, _ := uuid.Parse(exit.VMID)
+
+	log.Printf("VM %s crashed: %s", exit.VMID, exit.Reason)
+
+	w.setVMStatus(ctx, vmUUID, types.VMStatusCrashed, map[string]interface{}{
+		"exit_reason": exit.Reason,
+		"crashed_at":  exit.ExitedAt.Format(time.RFC3339),
+	})
+	w.recordEvent(ctx, events.TopicVMCrashed, SeverityError, "vm", exit.VMID,
+		fmt.Sprintf("VM %s crashed: %s", exit.VMID, exit.Reason), map[string]interface{}{
+			"reason": exit.Reason,
+		})
+
+	w.mu.Lock()
+	attempt := w.vmRestarts[exit.VMID] + 1
+	restart := w.restartPolicy == RestartPolicyOnCrash && exit.Restartable && attempt <= w.maxVMRestarts
+	if restart {
+		w.vmRestarts[exit.VMID] = attempt
+	}
+	maxRestarts := w.maxVMRestarts
+	w.mu.Unlock()
+
+	if restart {
+		log.Printf("Restarting crashed VM %s (attempt %d/%d)", exit.VMID, attempt, maxRestarts)
+
+		err := w.orchestrator.(vmm.Supervisor).RestartVM(ctx, exit.VMID)
+		if err == nil {
+			w.setVMStatus(ctx, vmUUID, types.VMStatusStarting, nil)
+			w.setVMStatus(ctx, vmUUID, types.VMStatusRunning, map[string]interface{}{
+				"restart_count": attempt,
+			})
+			w.recordEvent(ctx, events.TopicVMRestarted, SeverityWarning, "vm", exit.VMID,
+				fmt.Sprintf("VM %s restarted after a crash (attempt %d/%d)", exit.VMID, attempt, maxRestarts),
+				map[string]interface{}{
+					"attempt":      attempt,
+					"max_restarts": maxRestarts,
+				})
+			log.Printf("✓ VM %s restarted", exit.VMID)
+			return
+		}
+		if errors.Is(err, vmm.ErrVMStopped) {
+			// Whoever stopped or deleted it records the VM's status
+			log.Printf("Not restarting VM %s: %v", exit.VMID, err)
+			w.mu.Lock()
+			delete(w.vmRestarts, exit.VMID)
+			w.mu.Unlock()
+			return
+		}
+		log.Printf("Warning: Failed to restart VM %s: %v", exit.VMID, err)
+	}
+
+	w.setVMStatus(ctx, vmUUID, types.VMStatusFailed, nil)
+
+	w.mu.Lock()
+	delete(w.runningVMs, exit.VMID)
+	delete(w.vmRestarts, exit.VMID)
+	w.mu.Unlock()
+
+	if w.workerInfo != nil {
+		w.updateWorkerResources(ctx)
+	}
+}
+
+// setVMStatus moves a stored VM to status and merges metadata into its record
+func (w *Worker) setVMStatus(ctx context.Context, vmID uuid.UUID, status types.VMStatus, metadata map[string]interface{}) {
+	vm, err := w.store.VMs().Get(ctx, vmID)
+	if err != nil {
+		log.Printf("Warning: Failed to load VM %s: %v", vmID, err)
+		return
+	}
+
+	vm.Status = string(status)
+	if vm.Metadata == nil {
+		vm.Metadata = make(map[string]interface{})
+	}
+	for k, v := range metadata {
+		vm.Metadata[k] = v
+	}
+
+	if err := w.store.VMs().Update(ctx, vm); err != nil {
+		log.Printf("Warning: Failed to mark VM %s as %s: %v", vmID, status, err)
+	}
+}
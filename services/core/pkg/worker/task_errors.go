@@ -0,0 +1,35 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+)
+
+// runHandler runs a task handler, turning a panic into a failed result so
+// one bad task can't take the worker and every task it's running down. A
+// panic is a bug that will recur on every attempt, so the task isn't retried.
+func runHandler(ctx context.Context, handler queue.TaskHandler, task *queue.Task) (result *queue.TaskResult, err error) {
+	startTime := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			stack := string(debug.Stack())
+			log.Printf("Task %s (%s) panicked: %v\n%s", task.ID, task.Type, r, stack)
+			result = &queue.TaskResult{
+				TaskID:    task.ID,
+				Success:   false,
+				Error:     fmt.Sprintf("panic: %v", r),
+				Result:    map[string]interface{}{"panic": fmt.Sprint(r), "stack": stack},
+				Duration:  time.Since(startTime),
+				StartedAt: startTime,
+				Terminal:  true,
+			}
+			err = nil
+		}
+	}()
+	return handler(ctx, task)
+}
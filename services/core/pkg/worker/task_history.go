@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"context"
+	"log"
+
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// recordTaskStart marks a task as processing by this worker in the task
+// history and publishes the transition
+func (w *Worker) recordTaskStart(ctx context.Context, task *queue.Task) {
+	workerID := ""
+	if w.workerInfo != nil {
+		workerID = w.workerInfo.ID
+	}
+	if err := w.store.Tasks().MarkProcessing(ctx, task.ID, workerID); err != nil {
+		log.Printf("Warning: Failed to record start of task %s: %v", task.ID, err)
+	}
+	w.publishTaskState(ctx, task.ID, storage.TaskStatusProcessing, task.Retried, nil)
+}
+
+// recordTaskOutcome records how an attempt at a task ended in the task
+// history and publishes it. A failure the queue will retry leaves the task
+// retrying.
+func (w *Worker) recordTaskOutcome(ctx context.Context, task *queue.Task, result *queue.TaskResult, err error) {
+	outcome := &storage.TaskOutcome{
+		Status:     storage.TaskStatusCompleted,
+		RetryCount: task.Retried,
+	}
+	if result != nil {
+		outcome.Result = storage.JSONB(result.Result)
+		// vm:create tasks only learn their VM when it's created
+		if vmID, ok := result.Result["vm_id"].(string); ok {
+			if id, parseErr := uuid.Parse(vmID); parseErr == nil {
+				outcome.VMID = &id
+			}
+		}
+	}
+
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	} else if result != nil && !result.Success {
+		msg = result.Error
+	}
+	if msg != "" {
+		outcome.Error = &msg
+		outcome.Status = storage.TaskStatusFailed
+		retryable := err == nil || queue.IsRetryable(err)
+		if retryable && (result == nil || !result.Terminal) && task.Retried < task.MaxRetry {
+			outcome.Status = storage.TaskStatusRetrying
+			outcome.RetryCount = task.Retried + 1
+		}
+	}
+
+	// The handler's context may have timed out; the outcome is still recorded
+	if err := w.store.Tasks().Finish(context.WithoutCancel(ctx), task.ID, outcome); err != nil {
+		log.Printf("Warning: Failed to record outcome of task %s: %v", task.ID, err)
+	}
+	w.publishTaskState(ctx, task.ID, outcome.Status, outcome.RetryCount, outcome.Error)
+}
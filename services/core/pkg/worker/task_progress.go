@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
+	"github.com/aetherium/aetherium/libs/common/pkg/logging"
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/google/uuid"
+)
+
+// publishTaskState publishes a task's new status on its progress topic, for
+// gateways streaming the task to clients
+func (w *Worker) publishTaskState(ctx context.Context, taskID uuid.UUID, status string, retryCount int, errMsg *string) {
+	data := map[string]interface{}{
+		"kind":        events.TaskProgressState,
+		"status":      status,
+		"retry_count": retryCount,
+	}
+	if w.workerInfo != nil {
+		data["worker_id"] = w.workerInfo.ID
+	}
+	if errMsg != nil {
+		data["error"] = *errMsg
+	}
+	w.publishTaskProgress(ctx, taskID.String(), data)
+}
+
+// publishTaskLog publishes a log line on the progress topic of the task ctx
+// belongs to, if any (see taskLogContext)
+func (w *Worker) publishTaskLog(ctx context.Context, level types.LogLevel, message string, fields map[string]interface{}) {
+	taskID, _ := logging.ContextFields(ctx)["task_id"].(string)
+	if taskID == "" {
+		return
+	}
+
+	data := map[string]interface{}{
+		"kind":    events.TaskProgressLog,
+		"level":   string(level),
+		"message": message,
+	}
+	if len(fields) > 0 {
+		data["fields"] = fields
+	}
+	w.publishTaskProgress(ctx, taskID, data)
+}
+
+func (w *Worker) publishTaskProgress(ctx context.Context, taskID string, data map[string]interface{}) {
+	if w.eventBus == nil {
+		return
+	}
+
+	topic := events.TaskProgressTopic(taskID)
+	event := &types.Event{
+		ID:        uuid.New().String(),
+		Type:      events.TopicTaskProgress,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+	// The handler's context may have timed out; the progress is still sent
+	if err := w.eventBus.Publish(context.WithoutCancel(ctx), topic, event); err != nil {
+		log.Printf("Warning: Failed to publish progress of task %s: %v", taskID, err)
+	}
+}
@@ -0,0 +1,165 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+)
+
+// taskStats tracks task throughput between heartbeats
+type taskStats struct {
+	mu          sync.Mutex
+	inProgress  int
+	completed   int
+	errors      int
+	latencySum  time.Duration
+	latencyN    int
+	windowStart time.Time
+}
+
+// taskStatsSnapshot is the throughput for one heartbeat window
+type taskStatsSnapshot struct {
+	InProgress     int
+	TasksPerMinute float64
+	QueueLatencyMs float64
+	Errors         int
+}
+
+func newTaskStats() *taskStats {
+	return &taskStats{windowStart: time.Now()}
+}
+
+// snapshot returns the stats for the current window and starts a new one
+func (s *taskStats) snapshot() taskStatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := taskStatsSnapshot{
+		InProgress: s.inProgress,
+		Errors:     s.errors,
+	}
+	if elapsed := time.Since(s.windowStart); elapsed > 0 {
+		snap.TasksPerMinute = float64(s.completed) / elapsed.Minutes()
+	}
+	if s.latencyN > 0 {
+		snap.QueueLatencyMs = float64(s.latencySum.Milliseconds()) / float64(s.latencyN)
+	}
+
+	s.completed = 0
+	s.errors = 0
+	s.latencySum = 0
+	s.latencyN = 0
+	s.windowStart = time.Now()
+
+	return snap
+}
+
+// trackTask wraps a handler to record in-progress tasks, completions, failures
+// and how long the task waited in the queue. The handler's context carries the
+// task's log correlation fields, and reads from the primary database since
+// tasks are enqueued right after the rows they act on are written. Panics
+// are recovered into failed results (see runHandler). Each attempt is
+// recorded in the task history.
+func (w *Worker) trackTask(handler queue.TaskHandler) queue.TaskHandler {
+	return func(ctx context.Context, task *queue.Task) (*queue.TaskResult, error) {
+		s := w.taskStats
+		ctx = storage.WithPrimaryReads(w.taskLogContext(ctx, task))
+		startTime := time.Now()
+
+		s.mu.Lock()
+		s.inProgress++
+		if !task.EnqueuedAt.IsZero() {
+			s.latencySum += time.Since(task.EnqueuedAt)
+			s.latencyN++
+		}
+		s.mu.Unlock()
+
+		w.shipLog(ctx, types.LogLevelInfo, fmt.Sprintf("Task %s started", task.Type), nil)
+		w.recordTaskStart(ctx, task)
+
+		result, err := runHandler(ctx, handler, task)
+
+		s.mu.Lock()
+		s.inProgress--
+		s.completed++
+		if err != nil || (result != nil && !result.Success) {
+			s.errors++
+		}
+		s.mu.Unlock()
+
+		w.logTaskResult(ctx, task, result, err, time.Since(startTime))
+		w.recordTaskOutcome(ctx, task, result, err)
+
+		return result, err
+	}
+}
+
+// logTaskResult ships a task's outcome to the logger
+func (w *Worker) logTaskResult(ctx context.Context, task *queue.Task, result *queue.TaskResult, err error, duration time.Duration) {
+	fields := map[string]interface{}{
+		"duration_ms": duration.Milliseconds(),
+	}
+	if err == nil && result != nil && !result.Success {
+		err = errors.New(result.Error)
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		fields["retryable"] = queue.IsRetryable(err) && (result == nil || !result.Terminal)
+		if result != nil && result.Result["stack"] != nil {
+			fields["stack"] = result.Result["stack"]
+		}
+		w.shipLog(ctx, types.LogLevelError, fmt.Sprintf("Task %s failed", task.Type), fields)
+		return
+	}
+	w.shipLog(ctx, types.LogLevelInfo, fmt.Sprintf("Task %s completed", task.Type), fields)
+}
+
+// recordMetrics persists the current resource usage, task throughput and
+// host health to worker_metrics
+func (w *Worker) recordMetrics(ctx context.Context, health *HostHealth) {
+	snap := w.taskStats.snapshot()
+
+	w.mu.RLock()
+	res := w.workerInfo.Resources
+	tasksProcessed := w.tasksProcessed
+	w.mu.RUnlock()
+
+	metric := &storage.WorkerMetric{
+		WorkerID:        w.workerInfo.ID,
+		Timestamp:       time.Now(),
+		VMCount:         res.VMCount,
+		TasksProcessed:  tasksProcessed,
+		TasksInProgress: snap.InProgress,
+		TasksPerMinute:  snap.TasksPerMinute,
+		QueueLatencyMs:  snap.QueueLatencyMs,
+		ErrorCount:      snap.Errors,
+		Metadata:        make(storage.JSONB),
+	}
+	if health != nil {
+		metric.LoadAvg1m = health.LoadAvg1m
+		metric.LoadAvg5m = health.LoadAvg5m
+		metric.LoadAvg15m = health.LoadAvg15m
+		metric.CPUStealPercent = health.CPUStealPercent
+		metric.DiskIOPercent = health.DiskIOPercent
+		metric.TemperatureC = health.TemperatureC
+		metric.GPUTemperatureC = health.GPUTemperatureC
+		metric.GPUUtilizationPercent = health.GPUUtilizationPercent
+	}
+	if res.CPUCores > 0 {
+		metric.CPUUsage = float64(res.UsedCPUCores) / float64(res.CPUCores) * 100
+	}
+	if res.MemoryMB > 0 {
+		metric.MemoryUsage = float64(res.UsedMemoryMB) / float64(res.MemoryMB) * 100
+	}
+
+	if err := w.store.WorkerMetrics().Create(ctx, metric); err != nil {
+		log.Printf("Warning: Failed to record worker metrics: %v", err)
+	}
+}
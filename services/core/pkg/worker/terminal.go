@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+)
+
+// serveVMTerminal opens a terminal in a VM, switches the connection to the
+// vmm.TerminalUpgrade protocol and relays terminal frames over it until
+// either side closes. The dir, cols and rows parameters set the terminal's
+// directory and size.
+func (w *Worker) serveVMTerminal(rw http.ResponseWriter, r *http.Request) {
+	terminals, ok := w.orchestrator.(vmm.Terminals)
+	if !ok {
+		http.Error(rw, "orchestrator does not support terminals", http.StatusNotImplemented)
+		return
+	}
+	if !strings.EqualFold(r.Header.Get("Upgrade"), vmm.TerminalUpgrade) {
+		http.Error(rw, "Expected Upgrade: "+vmm.TerminalUpgrade, http.StatusUpgradeRequired)
+		return
+	}
+
+	query := r.URL.Query()
+	req := &vmm.TerminalRequest{Dir: query.Get("dir")}
+	for name, size := range map[string]*uint16{"cols": &req.Cols, "rows": &req.Rows} {
+		if value := query.Get(name); value != "" {
+			n, err := strconv.ParseUint(value, 10, 16)
+			if err != nil {
+				http.Error(rw, "Invalid "+name, http.StatusBadRequest)
+				return
+			}
+			*size = uint16(n)
+		}
+	}
+
+	hijacker, ok := rw.(http.Hijacker)
+	if !ok {
+		http.Error(rw, "Connection does not support upgrades", http.StatusInternalServerError)
+		return
+	}
+
+	vmID := r.PathValue("id")
+	stream, err := terminals.OpenTerminal(r.Context(), vmID, req)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer stream.Close()
+
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		log.Printf("Failed to take over terminal connection for VM %s: %v", vmID, err)
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Time{})
+
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: " + vmm.TerminalUpgrade + "\r\n\r\n")
+	if err := buf.Flush(); err != nil {
+		return
+	}
+	log.Printf("Opened terminal in VM %s", vmID)
+
+	// Whichever side closes first ends both copies
+	go func() {
+		io.Copy(stream, buf)
+		stream.Close()
+	}()
+	io.Copy(conn, stream)
+	log.Printf("Closed terminal in VM %s", vmID)
+}
@@ -0,0 +1,221 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// defaultGCProject is the policy applied to VMs without a project
+const defaultGCProject = "default"
+
+// SetEventBus sets the event bus used to publish worker events (optional)
+func (w *Worker) SetEventBus(bus events.EventBus) {
+	w.eventBus = bus
+}
+
+// StartVMGarbageCollection periodically deletes non-workspace VMs that exceed their
+// project's GC policy (max age / max idle). A warning event is published
+// policy.WarningSeconds before deletion, then a vm:delete task is enqueued.
+func (w *Worker) StartVMGarbageCollection(ctx context.Context, q queue.Queue, checkInterval time.Duration) {
+	log.Printf("Starting VM garbage collection (check interval: %v)", checkInterval)
+
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Printf("VM garbage collection stopped")
+				return
+			case <-ticker.C:
+				w.collectVMs(ctx, q)
+			}
+		}
+	}()
+}
+
+// collectVMs applies GC policies to this worker's VMs
+func (w *Worker) collectVMs(ctx context.Context, q queue.Queue) {
+	policies, err := w.store.VMGCPolicies().List(ctx)
+	if err != nil {
+		log.Printf("Error listing VM GC policies: %v", err)
+		return
+	}
+
+	policyByProject := make(map[string]*storage.VMGCPolicy, len(policies))
+	for _, p := range policies {
+		policyByProject[p.Project] = p
+	}
+
+	// Only collect VMs owned by this worker (the orchestrator can only delete its own)
+	filters := map[string]interface{}{}
+	if w.workerInfo != nil {
+		filters["worker_id"] = w.workerInfo.ID
+	}
+
+	vms, err := w.store.VMs().List(ctx, filters)
+	if err != nil {
+		log.Printf("Error listing VMs for garbage collection: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, vm := range vms {
+		// Workspace VMs are handled by idle workspace cleanup
+		if _, ok := vm.Metadata["workspace_id"]; ok {
+			continue
+		}
+		// Warm pool VMs are replaced by the warm pool
+		if _, ok := vm.Metadata["warm_pool"]; ok {
+			continue
+		}
+		if _, ok := vm.Metadata["gc_scheduled_at"]; ok {
+			continue
+		}
+
+		project := defaultGCProject
+		if p, ok := vm.Metadata["project"].(string); ok && p != "" {
+			project = p
+		}
+
+		policy, ok := policyByProject[project]
+		if !ok {
+			policy, ok = policyByProject[defaultGCProject]
+		}
+		if !ok || !policy.Enabled {
+			continue
+		}
+
+		deadline, reason := gcDeadline(vm, policy)
+		if deadline.IsZero() {
+			continue
+		}
+
+		if now.Before(deadline) {
+			warnAt := deadline.Add(-time.Duration(policy.WarningSeconds) * time.Second)
+			_, warned := vm.Metadata["gc_warned_at"]
+			switch {
+			case !warned && !now.Before(warnAt):
+				w.warnVMCollection(ctx, vm, project, reason, deadline)
+			case warned && now.Before(warnAt):
+				// VM was used after the warning; re-arm it for the new deadline
+				delete(vm.Metadata, "gc_warned_at")
+				if err := w.store.VMs().Update(ctx, vm); err != nil {
+					log.Printf("Warning: Failed to clear GC warning for VM %s: %v", vm.ID, err)
+				}
+			}
+			continue
+		}
+
+		w.scheduleVMCollection(ctx, q, vm, project, reason)
+	}
+}
+
+// gcDeadline returns when a VM becomes eligible for collection and why
+func gcDeadline(vm *storage.VM, policy *storage.VMGCPolicy) (time.Time, string) {
+	var deadline time.Time
+	var reason string
+
+	if policy.MaxAgeSeconds > 0 {
+		deadline = vm.CreatedAt.Add(time.Duration(policy.MaxAgeSeconds) * time.Second)
+		reason = "max_age"
+	}
+
+	if policy.MaxIdleSeconds > 0 {
+		lastUsed := vm.CreatedAt
+		if vm.StartedAt != nil {
+			lastUsed = *vm.StartedAt
+		}
+		if vm.LastUsedAt != nil {
+			lastUsed = *vm.LastUsedAt
+		}
+		idleDeadline := lastUsed.Add(time.Duration(policy.MaxIdleSeconds) * time.Second)
+		if deadline.IsZero() || idleDeadline.Before(deadline) {
+			deadline = idleDeadline
+			reason = "max_idle"
+		}
+	}
+
+	return deadline, reason
+}
+
+// warnVMCollection records an advance warning and records it on the VM
+func (w *Worker) warnVMCollection(ctx context.Context, vm *storage.VM, project, reason string, deadline time.Time) {
+	log.Printf("VM %s (%s) will be garbage collected at %s (%s)", vm.Name, vm.ID, deadline.Format(time.RFC3339), reason)
+
+	message := fmt.Sprintf("VM %s will be garbage collected at %s (%s)", vm.Name, deadline.Format(time.RFC3339), reason)
+	w.recordVMEvent(ctx, events.TopicVMGCWarning, vm, message, map[string]interface{}{
+		"project":   project,
+		"reason":    reason,
+		"delete_at": deadline,
+	})
+
+	vm.Metadata["gc_warned_at"] = time.Now().Format(time.RFC3339)
+	if err := w.store.VMs().Update(ctx, vm); err != nil {
+		log.Printf("Warning: Failed to record GC warning for VM %s: %v", vm.ID, err)
+	}
+}
+
+// scheduleVMCollection enqueues a deletion task for a VM
+func (w *Worker) scheduleVMCollection(ctx context.Context, q queue.Queue, vm *storage.VM, project, reason string) {
+	task, err := queue.NewTask(queue.TaskTypeVMDelete, &queue.VMDeletePayload{VMID: vm.ID.String()})
+	if err != nil {
+		log.Printf("Error building GC deletion task for VM %s: %v", vm.ID, err)
+		return
+	}
+
+	if err := q.Enqueue(ctx, task, &queue.TaskOptions{
+		Queue:     "low",
+		Priority:  1,
+		UniqueKey: vm.ID.String(),
+	}); err != nil {
+		if errors.Is(err, queue.ErrDuplicateTask) {
+			log.Printf("VM %s already has a deletion task queued", vm.ID)
+			return
+		}
+		log.Printf("Error enqueueing GC deletion for VM %s: %v", vm.ID, err)
+		return
+	}
+
+	log.Printf("✓ Scheduled garbage collection of VM %s (%s): %s", vm.Name, vm.ID, reason)
+
+	message := fmt.Sprintf("VM %s scheduled for garbage collection (%s)", vm.Name, reason)
+	w.recordVMEvent(ctx, events.TopicVMGCScheduled, vm, message, map[string]interface{}{
+		"project": project,
+		"reason":  reason,
+		"task_id": task.ID.String(),
+	})
+
+	vm.Metadata["gc_scheduled_at"] = time.Now().Format(time.RFC3339)
+	if err := w.store.VMs().Update(ctx, vm); err != nil {
+		log.Printf("Warning: Failed to record GC schedule for VM %s: %v", vm.ID, err)
+	}
+}
+
+// recordVMEvent records a GC event for a VM in the cluster timeline
+func (w *Worker) recordVMEvent(ctx context.Context, topic string, vm *storage.VM, message string, data map[string]interface{}) {
+	data["vm_id"] = vm.ID.String()
+	data["vm_name"] = vm.Name
+
+	w.recordEvent(ctx, topic, SeverityWarning, "vm", vm.ID.String(), message, data)
+}
+
+// markVMUsed records that a VM was just used, resetting its idle clock
+func (w *Worker) markVMUsed(ctx context.Context, vmID string) {
+	id, err := uuid.Parse(vmID)
+	if err != nil {
+		return
+	}
+	if err := w.store.VMs().UpdateLastUsed(ctx, id); err != nil {
+		log.Printf("Warning: Failed to update last used time for VM %s: %v", vmID, err)
+	}
+}
@@ -0,0 +1,138 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/google/uuid"
+)
+
+// VMSnapshotPayload is the payload of vm:snapshot and vm:restore tasks
+type VMSnapshotPayload = queue.VMSnapshotPayload
+
+// registerSnapshotHandlers handles vm:snapshot and vm:restore tasks when
+// the orchestrator can snapshot VMs
+func (w *Worker) registerSnapshotHandlers(q queue.Queue) error {
+	if _, ok := w.orchestrator.(vmm.Snapshotter); !ok {
+		return nil
+	}
+	if err := q.RegisterHandler(queue.TaskTypeVMSnapshot, w.trackTask(w.HandleVMSnapshot)); err != nil {
+		return fmt.Errorf("failed to register VM snapshot handler: %w", err)
+	}
+	if err := q.RegisterHandler(queue.TaskTypeVMRestore, w.trackTask(w.HandleVMRestore)); err != nil {
+		return fmt.Errorf("failed to register VM restore handler: %w", err)
+	}
+	return nil
+}
+
+// HandleVMSnapshot snapshots a VM and marks its snapshot record ready, or
+// failed with the reason
+func (w *Worker) HandleVMSnapshot(ctx context.Context, task *queue.Task) (*queue.TaskResult, error) {
+	startTime := time.Now()
+
+	var payload VMSnapshotPayload
+	if err := queue.DecodePayload(task, &payload); err != nil {
+		return nil, err
+	}
+	snapshotID, _ := uuid.Parse(payload.SnapshotID) // Validated with the payload
+
+	snapshotter, ok := w.orchestrator.(vmm.Snapshotter)
+	if !ok {
+		return nil, fmt.Errorf("orchestrator does not support VM snapshots")
+	}
+
+	log.Printf("Snapshotting VM %s as %s", payload.VMID, payload.SnapshotID)
+
+	size, err := snapshotter.SnapshotVM(ctx, payload.VMID, payload.SnapshotID)
+	if err != nil {
+		if failErr := w.store.VMSnapshots().Fail(ctx, snapshotID, err.Error()); failErr != nil {
+			log.Printf("Warning: Failed to mark snapshot %s failed: %v", payload.SnapshotID, failErr)
+		}
+		return &queue.TaskResult{
+			TaskID:    task.ID,
+			Success:   false,
+			Error:     fmt.Sprintf("failed to snapshot VM: %v", err),
+			Result:    vmmErrorResult(err),
+			Duration:  time.Since(startTime),
+			StartedAt: startTime,
+		}, nil
+	}
+
+	if err := w.store.VMSnapshots().Complete(ctx, snapshotID, size); err != nil {
+		log.Printf("Warning: Failed to mark snapshot %s ready: %v", payload.SnapshotID, err)
+	}
+
+	log.Printf("✓ VM %s snapshotted as %s", payload.VMID, payload.SnapshotID)
+
+	return &queue.TaskResult{
+		TaskID:  task.ID,
+		Success: true,
+		Result: map[string]interface{}{
+			"vm_id":       payload.VMID,
+			"snapshot_id": payload.SnapshotID,
+			"size_bytes":  size,
+		},
+		Duration:  time.Since(startTime),
+		StartedAt: startTime,
+	}, nil
+}
+
+// HandleVMRestore returns a VM to one of its snapshots
+func (w *Worker) HandleVMRestore(ctx context.Context, task *queue.Task) (*queue.TaskResult, error) {
+	startTime := time.Now()
+
+	var payload VMSnapshotPayload
+	if err := queue.DecodePayload(task, &payload); err != nil {
+		return nil, err
+	}
+	// Both IDs were validated with the payload
+	vmID, _ := uuid.Parse(payload.VMID)
+	snapshotID, _ := uuid.Parse(payload.SnapshotID)
+
+	snapshotter, ok := w.orchestrator.(vmm.Snapshotter)
+	if !ok {
+		return nil, fmt.Errorf("orchestrator does not support VM snapshots")
+	}
+
+	log.Printf("Restoring VM %s to snapshot %s", payload.VMID, payload.SnapshotID)
+
+	if err := snapshotter.RestoreVM(ctx, payload.VMID, payload.SnapshotID); err != nil {
+		// A VM whose process was already stopped can't be recovered
+		if vm, statusErr := w.orchestrator.GetVMStatus(ctx, payload.VMID); statusErr == nil && vm.Status == types.VMStatusFailed {
+			w.setVMStatus(ctx, vmID, types.VMStatusFailed, nil)
+		}
+		return &queue.TaskResult{
+			TaskID:    task.ID,
+			Success:   false,
+			Error:     fmt.Sprintf("failed to restore VM: %v", err),
+			Result:    vmmErrorResult(err),
+			Duration:  time.Since(startTime),
+			StartedAt: startTime,
+		}, nil
+	}
+
+	w.setVMStatus(ctx, vmID, types.VMStatusRunning, map[string]interface{}{
+		"restored_snapshot_id": payload.SnapshotID,
+	})
+	if err := w.store.VMSnapshots().MarkRestored(ctx, snapshotID); err != nil {
+		log.Printf("Warning: Failed to record restore of snapshot %s: %v", payload.SnapshotID, err)
+	}
+
+	log.Printf("✓ VM %s restored to snapshot %s", payload.VMID, payload.SnapshotID)
+
+	return &queue.TaskResult{
+		TaskID:  task.ID,
+		Success: true,
+		Result: map[string]interface{}{
+			"vm_id":       payload.VMID,
+			"snapshot_id": payload.SnapshotID,
+		},
+		Duration:  time.Since(startTime),
+		StartedAt: startTime,
+	}, nil
+}
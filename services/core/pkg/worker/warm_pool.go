@@ -0,0 +1,421 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// DefaultWarmPoolMaxAge is how long a warm VM waits for a workspace before
+// it's replaced, so it doesn't miss tool releases for too long
+const DefaultWarmPoolMaxAge = 6 * time.Hour
+
+// warmPoolUsageWindow is how far back workspace creations count towards an
+// environment's popularity
+const warmPoolUsageWindow = 7 * 24 * time.Hour
+
+// warmVM is a booted VM with an environment's tools installed, waiting to
+// be claimed by a workspace of that environment
+type warmVM struct {
+	vmID          string
+	environmentID uuid.UUID
+	fingerprint   string
+	createdAt     time.Time
+}
+
+// SetWarmPool keeps up to size VMs pre-warmed for the most used
+// environments, one per environment. maxAge limits how long a warm VM waits
+// for a workspace; 0 uses DefaultWarmPoolMaxAge. A size of 0 disables the pool.
+func (w *Worker) SetWarmPool(size int, maxAge time.Duration) {
+	if maxAge <= 0 {
+		maxAge = DefaultWarmPoolMaxAge
+	}
+
+	w.mu.Lock()
+	w.warmPoolSize = size
+	w.warmPoolMaxAge = maxAge
+	w.mu.Unlock()
+}
+
+// StartWarmPool periodically replaces stale warm VMs and, while the worker
+// is idle, warms a VM for the most used environment that has none. Warm VMs
+// left over from a previous run are deleted first, as they aren't tracked.
+func (w *Worker) StartWarmPool(ctx context.Context, checkInterval time.Duration) {
+	w.mu.RLock()
+	size := w.warmPoolSize
+	w.mu.RUnlock()
+	if size <= 0 {
+		return
+	}
+
+	log.Printf("Starting warm pool (size: %d, check interval: %v)", size, checkInterval)
+
+	go func() {
+		w.discardLeftoverWarmVMs(ctx)
+
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Printf("Warm pool stopped")
+				return
+			case <-ticker.C:
+				w.refreshWarmPool(ctx)
+			}
+		}
+	}()
+}
+
+// refreshWarmPool drops stale warm VMs and warms at most one new one
+func (w *Worker) refreshWarmPool(ctx context.Context) {
+	w.pruneWarmPool(ctx)
+
+	if !w.idle() {
+		return
+	}
+
+	env := w.nextWarmEnvironment(ctx)
+	if env == nil {
+		return
+	}
+
+	if err := w.warmEnvironment(ctx, env); err != nil {
+		log.Printf("Warning: Failed to warm a VM for environment %s: %v", env.Name, err)
+	}
+}
+
+// idle reports whether the worker has no tasks running and no VMs booting
+func (w *Worker) idle() bool {
+	w.taskStats.mu.Lock()
+	inProgress := w.taskStats.inProgress
+	w.taskStats.mu.Unlock()
+
+	w.mu.RLock()
+	pending := w.pendingVMs
+	w.mu.RUnlock()
+
+	return inProgress == 0 && pending == 0
+}
+
+// pruneWarmPool discards warm VMs that are too old, crashed, or no longer
+// match their environment
+func (w *Worker) pruneWarmPool(ctx context.Context) {
+	w.mu.RLock()
+	maxAge := w.warmPoolMaxAge
+	warm := make([]*warmVM, 0, len(w.warmVMs))
+	running := make(map[string]bool, len(w.warmVMs))
+	for _, vm := range w.warmVMs {
+		warm = append(warm, vm)
+		_, running[vm.vmID] = w.runningVMs[vm.vmID]
+	}
+	w.mu.RUnlock()
+
+	for _, vm := range warm {
+		var reason string
+		if env, err := w.store.Environments().Get(ctx, vm.environmentID); err != nil {
+			reason = fmt.Sprintf("environment unavailable: %v", err)
+		} else if environmentFingerprint(env) != vm.fingerprint {
+			reason = "environment changed"
+		} else if time.Since(vm.createdAt) > maxAge {
+			reason = fmt.Sprintf("unclaimed for %v", maxAge)
+		} else if !running[vm.vmID] {
+			reason = "VM is no longer running"
+		}
+
+		if reason != "" {
+			w.discardWarmVM(ctx, vm.vmID, reason)
+		}
+	}
+}
+
+// nextWarmEnvironment returns the most used environment without a warm VM,
+// or nil when the pool is full or every popular environment has one
+func (w *Worker) nextWarmEnvironment(ctx context.Context) *storage.Environment {
+	w.mu.RLock()
+	full := len(w.warmVMs) >= w.warmPoolSize
+	warmed := make(map[uuid.UUID]bool, len(w.warmVMs))
+	for _, vm := range w.warmVMs {
+		warmed[vm.environmentID] = true
+	}
+	w.mu.RUnlock()
+
+	if full {
+		return nil
+	}
+
+	usage, err := w.store.Environments().ListUsage(ctx, time.Now().Add(-warmPoolUsageWindow), 0)
+	if err != nil {
+		log.Printf("Error listing environment usage for the warm pool: %v", err)
+		return nil
+	}
+
+	for _, u := range usage {
+		if warmed[u.EnvironmentID] {
+			continue
+		}
+		env, err := w.store.Environments().Get(ctx, u.EnvironmentID)
+		if err != nil {
+			continue
+		}
+		if canWarm(env) && w.canBootEnvironment(env) == nil {
+			return env
+		}
+	}
+	return nil
+}
+
+// canWarm reports whether a VM can be prepared for an environment ahead of
+// its workspaces. Services are started per workspace, and saved rootfs
+// images only exist on the worker that saved them.
+func canWarm(env *storage.Environment) bool {
+	if len(env.Services) > 0 {
+		return false
+	}
+	if env.RootFSImage != nil {
+		if _, err := os.Stat(*env.RootFSImage); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// warmEnvironment boots a VM for an environment and installs its tools. It
+// doesn't delete other warm VMs to make room.
+func (w *Worker) warmEnvironment(ctx context.Context, env *storage.Environment) error {
+	vcpus, memoryMB := environmentVMSize(env)
+	if err := w.reserveVMCapacity(vcpus, memoryMB); err != nil {
+		return err
+	}
+	defer w.releaseVM(vcpus, memoryMB)
+
+	vmConfig := environmentVMConfig(env, vcpus, memoryMB)
+	log.Printf("Warming VM %s for environment %s", vmConfig.ID, env.Name)
+
+	vm, err := w.createVM(ctx, vmConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create VM: %w", err)
+	}
+
+	if err := w.orchestrator.StartVM(ctx, vm.ID); err != nil {
+		w.orchestrator.DeleteVM(ctx, vm.ID)
+		return fmt.Errorf("failed to start VM: %w", err)
+	}
+
+	vmUUID, _ := uuid.Parse(vm.ID)
+	kernelPath := vmConfig.KernelPath
+	rootfsPath := vmConfig.RootFSPath
+	socketPath := vmConfig.SocketPath
+
+	var workerID *string
+	if w.workerInfo != nil {
+		workerID = &w.workerInfo.ID
+	}
+
+	dbVM := &storage.VM{
+		ID:           vmUUID,
+		Name:         fmt.Sprintf("warm-%s-%s", env.Name, vm.ID[:8]),
+		Orchestrator: "firecracker",
+		Status:       string(vm.Status),
+		KernelPath:   &kernelPath,
+		RootFSPath:   &rootfsPath,
+		SocketPath:   &socketPath,
+		VCPUCount:    &vcpus,
+		MemoryMB:     &memoryMB,
+		WorkerID:     workerID,
+		CreatedAt:    time.Now(),
+		Metadata: map[string]interface{}{
+			"warm_pool":      true,
+			"environment_id": env.ID.String(),
+		},
+	}
+
+	if err := w.store.VMs().Create(ctx, dbVM); err != nil {
+		w.orchestrator.DeleteVM(ctx, vm.ID)
+		return fmt.Errorf("failed to store VM: %w", err)
+	}
+
+	// Wait for agent to be ready
+	time.Sleep(5 * time.Second)
+
+	w.prepareEnvironmentVM(ctx, vm.ID, env)
+
+	w.mu.Lock()
+	w.runningVMs[vm.ID] = &vmResourceUsage{
+		VCPUs:    vcpus,
+		MemoryMB: int64(memoryMB),
+	}
+	w.warmVMs[vm.ID] = &warmVM{
+		vmID:          vm.ID,
+		environmentID: env.ID,
+		fingerprint:   environmentFingerprint(env),
+		createdAt:     time.Now(),
+	}
+	w.mu.Unlock()
+
+	if w.workerInfo != nil {
+		w.updateWorkerResources(ctx)
+	}
+
+	log.Printf("✓ VM %s warmed for environment %s", vm.ID, env.Name)
+	return nil
+}
+
+// claimWarmVM hands a warm VM of the environment to a workspace. It returns
+// nil when there's none, and the workspace's VM is then created as usual.
+func (w *Worker) claimWarmVM(ctx context.Context, workspace *storage.Workspace, env *storage.Environment) *types.VM {
+	fingerprint := environmentFingerprint(env)
+
+	w.mu.Lock()
+	var claimed *warmVM
+	for _, vm := range w.warmVMs {
+		if _, running := w.runningVMs[vm.vmID]; running && vm.environmentID == env.ID && vm.fingerprint == fingerprint {
+			claimed = vm
+			break
+		}
+	}
+	if claimed != nil {
+		delete(w.warmVMs, claimed.vmID)
+	}
+	w.mu.Unlock()
+
+	if claimed == nil {
+		return nil
+	}
+
+	vm, err := w.orchestrator.GetVMStatus(ctx, claimed.vmID)
+	if err != nil || vm.Status != types.VMStatusRunning {
+		w.discardWarmVM(ctx, claimed.vmID, "VM is no longer running")
+		return nil
+	}
+
+	vmUUID, _ := uuid.Parse(claimed.vmID)
+	dbVM, err := w.store.VMs().Get(ctx, vmUUID)
+	if err != nil {
+		w.discardWarmVM(ctx, claimed.vmID, fmt.Sprintf("VM record unavailable: %v", err))
+		return nil
+	}
+
+	dbVM.Name = fmt.Sprintf("env-%s-ws-%s", env.Name, workspace.Name)
+	dbVM.Metadata = map[string]interface{}{
+		"workspace_id":   workspace.ID.String(),
+		"environment_id": env.ID.String(),
+		"on_demand":      true,
+		"prewarmed":      true,
+	}
+
+	err = w.store.WithTx(ctx, func(tx storage.Store) error {
+		if err := tx.VMs().Update(ctx, dbVM); err != nil {
+			return err
+		}
+		return tx.Workspaces().SetVMID(ctx, workspace.ID, dbVM.ID)
+	})
+	if err != nil {
+		w.discardWarmVM(ctx, claimed.vmID, fmt.Sprintf("failed to link to workspace: %v", err))
+		return nil
+	}
+
+	w.recordZonePlacement(ctx, workspace.ID, claimed.vmID)
+
+	w.mu.Lock()
+	w.tasksProcessed++
+	w.mu.Unlock()
+
+	log.Printf("✓ Workspace %s claimed warm VM %s (warmed %v ago)",
+		workspace.ID, claimed.vmID, time.Since(claimed.createdAt).Round(time.Second))
+	return vm
+}
+
+// evictWarmVM deletes the oldest warm VM to free its capacity, reporting
+// whether there was one
+func (w *Worker) evictWarmVM() bool {
+	w.mu.RLock()
+	var oldest *warmVM
+	for _, vm := range w.warmVMs {
+		if oldest == nil || vm.createdAt.Before(oldest.createdAt) {
+			oldest = vm
+		}
+	}
+	w.mu.RUnlock()
+
+	if oldest == nil {
+		return false
+	}
+
+	w.discardWarmVM(context.Background(), oldest.vmID, "capacity needed")
+	return true
+}
+
+// discardWarmVM deletes a warm VM and its record
+func (w *Worker) discardWarmVM(ctx context.Context, vmID, reason string) {
+	w.mu.Lock()
+	delete(w.warmVMs, vmID)
+	delete(w.runningVMs, vmID)
+	delete(w.vmRestarts, vmID)
+	w.mu.Unlock()
+
+	if err := w.orchestrator.DeleteVM(ctx, vmID); err != nil {
+		log.Printf("Warning: Failed to delete warm VM %s: %v", vmID, err)
+	}
+
+	vmUUID, _ := uuid.Parse(vmID)
+	if err := w.store.VMs().Delete(ctx, vmUUID); err != nil {
+		log.Printf("Warning: Failed to delete warm VM %s from database: %v", vmID, err)
+	}
+
+	if w.workerInfo != nil {
+		w.updateWorkerResources(ctx)
+	}
+
+	log.Printf("Discarded warm VM %s: %s", vmID, reason)
+}
+
+// discardLeftoverWarmVMs deletes this worker's warm VMs from before a restart
+func (w *Worker) discardLeftoverWarmVMs(ctx context.Context) {
+	if w.workerInfo == nil {
+		return
+	}
+
+	vms, err := w.store.VMs().List(ctx, map[string]interface{}{"worker_id": w.workerInfo.ID})
+	if err != nil {
+		log.Printf("Error listing VMs for the warm pool: %v", err)
+		return
+	}
+
+	for _, vm := range vms {
+		if warm, _ := vm.Metadata["warm_pool"].(bool); warm {
+			w.discardWarmVM(ctx, vm.ID.String(), "left over from a previous run")
+		}
+	}
+}
+
+// environmentFingerprint identifies what a warm VM was prepared with, so
+// VMs warmed before the environment changed aren't handed out
+func environmentFingerprint(env *storage.Environment) string {
+	vcpus, memoryMB := environmentVMSize(env)
+	data, _ := json.Marshal(struct {
+		VCPUs       int                          `json:"vcpus"`
+		MemoryMB    int                          `json:"memory_mb"`
+		Tools       []string                     `json:"tools"`
+		ToolLock    *storage.EnvironmentLockfile `json:"tool_lock"`
+		Sandbox     *storage.SandboxProfile      `json:"sandbox"`
+		Docker      *storage.DockerProfile       `json:"docker"`
+		KernelArgs  []string                     `json:"kernel_args"`
+		Firewall    *types.FirewallPolicy        `json:"firewall"`
+		RootFSImage *string                      `json:"rootfs_image"`
+		Platform    string                       `json:"platform"`
+	}{vcpus, memoryMB, env.RequestedTools(), env.ToolLock, env.Sandbox, env.Docker, env.KernelArgs, env.Firewall, env.RootFSImage, env.Platform})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -6,9 +6,12 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
+	"github.com/aetherium/aetherium/libs/common/pkg/logging"
 	"github.com/aetherium/aetherium/services/gateway/pkg/discovery"
 	"github.com/aetherium/aetherium/services/core/pkg/queue"
 	"github.com/aetherium/aetherium/services/core/pkg/service"
@@ -35,10 +38,60 @@ type Worker struct {
 	mu             sync.RWMutex
 	runningVMs     map[string]*vmResourceUsage
 	tasksProcessed int
+	taskStats      *taskStats
+
+	// Admission control (capacity reserved for VMs still booting, and for the host)
+	reservedMemoryMB   int64
+	reservedVCPUs      int
+	pendingVMs         int
+	memoryReserveMB    int64
+	cpuReserveCores    int
+	capacityRejections int64
+
+	// Execution result cache (used when a task asks for it)
+	resultCache *ResultCache
+
+	// Image VMs boot from by default (see execution_env.go)
+	baseImage string
+
+	// Time limit for prompts whose environment sets none (see prompt_timeout.go)
+	promptTimeout time.Duration
+
+	// How often running prompts are checkpointed (see prompt_checkpoint.go)
+	promptCheckpointInterval time.Duration
+
+	// Event publishing (optional)
+	eventBus events.EventBus
+
+	// Log shipping (optional, see log_shipping.go)
+	logger logging.Logger
 
 	// Heartbeat control
 	heartbeatCancel context.CancelFunc
 	heartbeatDone   chan struct{}
+
+	// Restart requests from the gateway (see restart.go)
+	restartHandler func()
+	restarting     bool
+
+	// Crashed VM handling (see supervise.go)
+	restartPolicy string
+	maxVMRestarts int
+	vmRestarts    map[string]int
+
+	// VMs pre-warmed for popular environments (see warm_pool.go)
+	warmPoolSize   int
+	warmPoolMaxAge time.Duration
+	warmVMs        map[string]*warmVM
+
+	// Authenticates to other workers when cloning workspaces (see clone.go)
+	peerSecret string
+
+	// Names of the host checks that failed last (see host_checks.go)
+	failedHostChecks string
+
+	// Host health signals, sampled every heartbeat (see host_health.go)
+	hostHealth *hostHealthSampler
 }
 
 // vmResourceUsage tracks resource usage for a VM
@@ -62,18 +115,47 @@ type Config struct {
 	DiskGB   int64
 	MaxVMs   int
 
+	// Build information reported on registration and heartbeat
+	Version string
+	Commit  string
+
+	// Host resources held back for the OS, the worker and the proxy. They are
+	// subtracted from the advertised capacity and kept free when admitting
+	// new VMs.
+	MemoryReserveMB int64
+	CPUReserveCores int
+
+	// Execution result cache
+	ResultCacheTTL        time.Duration
+	ResultCacheMaxEntries int
+
 	// Service discovery (optional)
 	Registry discovery.ServiceRegistry
 }
 
 // New creates a new worker
 func New(store storage.Store, orchestrator vmm.VMOrchestrator) *Worker {
-	return &Worker{
+	w := &Worker{
 		store:         store,
 		orchestrator:  orchestrator,
 		toolInstaller: tools.NewInstaller(orchestrator),
 		runningVMs:    make(map[string]*vmResourceUsage),
+		taskStats:     newTaskStats(),
+		resultCache:   NewResultCache(DefaultResultCacheTTL, DefaultResultCacheMaxEntries),
+
+		memoryReserveMB: DefaultMemoryReserveMB,
+
+		restartPolicy: RestartPolicyNever,
+		maxVMRestarts: DefaultMaxVMRestarts,
+		vmRestarts:    make(map[string]int),
+
+		warmPoolMaxAge: DefaultWarmPoolMaxAge,
+		warmVMs:        make(map[string]*warmVM),
+
+		hostHealth: newHostHealthSampler(),
 	}
+	w.superviseVMs()
+	return w
 }
 
 // NewWithConfig creates a new worker with configuration and service discovery
@@ -92,6 +174,14 @@ func NewWithConfig(store storage.Store, orchestrator vmm.VMOrchestrator, config
 	if config.MaxVMs == 0 {
 		config.MaxVMs = 100
 	}
+	if config.MemoryReserveMB == 0 {
+		config.MemoryReserveMB = DefaultMemoryReserveMB
+	}
+
+	cpuCores, memoryMB, err := reserveCapacity(config)
+	if err != nil {
+		return nil, err
+	}
 
 	worker := &Worker{
 		store:         store,
@@ -99,6 +189,21 @@ func NewWithConfig(store storage.Store, orchestrator vmm.VMOrchestrator, config
 		toolInstaller: tools.NewInstaller(orchestrator),
 		registry:      config.Registry,
 		runningVMs:    make(map[string]*vmResourceUsage),
+		taskStats:     newTaskStats(),
+		resultCache:   NewResultCache(config.ResultCacheTTL, config.ResultCacheMaxEntries),
+
+		memoryReserveMB: config.MemoryReserveMB,
+		cpuReserveCores: config.CPUReserveCores,
+
+		restartPolicy: RestartPolicyNever,
+		maxVMRestarts: DefaultMaxVMRestarts,
+		vmRestarts:    make(map[string]int),
+
+		warmPoolMaxAge: DefaultWarmPoolMaxAge,
+		warmVMs:        make(map[string]*warmVM),
+
+		hostHealth: newHostHealthSampler(),
+
 		workerInfo: &discovery.WorkerInfo{
 			ID:           config.ID,
 			Hostname:     config.Hostname,
@@ -110,17 +215,34 @@ func NewWithConfig(store storage.Store, orchestrator vmm.VMOrchestrator, config
 			StartedAt:    time.Now(),
 			LastSeen:     time.Now(),
 			Resources: discovery.WorkerResources{
-				CPUCores: config.CPUCores,
-				MemoryMB: config.MemoryMB,
+				CPUCores: cpuCores,
+				MemoryMB: memoryMB,
 				DiskGB:   config.DiskGB,
 				MaxVMs:   config.MaxVMs,
 			},
+			Metadata: map[string]string{
+				MetadataVersion:          config.Version,
+				MetadataCommit:           config.Commit,
+				MetadataReservedMemoryMB: strconv.FormatInt(config.MemoryReserveMB, 10),
+				MetadataReservedCPUCores: strconv.Itoa(config.CPUReserveCores),
+			},
 		},
 	}
+	// Gateways write tasks at a payload version this worker reads
+	for key, value := range queue.LocalPayloadVersions().Metadata() {
+		worker.workerInfo.Metadata[key] = value
+	}
+	worker.superviseVMs()
 
 	return worker, nil
 }
 
+// SetPackageMirrors makes tool installs in VMs go through host-level caches
+// (DNS, apt, npm, pip and Go module mirrors)
+func (w *Worker) SetPackageMirrors(mirrors tools.Mirrors) {
+	w.toolInstaller.SetMirrors(mirrors)
+}
+
 // Register registers the worker with service discovery and database
 func (w *Worker) Register(ctx context.Context) error {
 	// Register with service discovery if configured
@@ -142,6 +264,10 @@ func (w *Worker) Register(ctx context.Context) error {
 			}
 		}
 		log.Printf("Worker registered in database: %s", w.workerInfo.ID)
+		w.reportHostChecks(ctx)
+
+		w.recordEvent(ctx, events.TopicWorkerJoined, SeverityInfo, "worker", w.workerInfo.ID,
+			fmt.Sprintf("Worker %s joined (zone=%s, version=%s)", w.workerInfo.ID, w.workerInfo.Zone, w.workerInfo.Metadata[MetadataVersion]), nil)
 	}
 
 	return nil
@@ -195,6 +321,11 @@ func (w *Worker) sendHeartbeat(ctx context.Context) error {
 		w.workerInfo.Resources.UsedCPUCores += vm.VCPUs
 		w.workerInfo.Resources.UsedMemoryMB += vm.MemoryMB
 	}
+
+	if w.workerInfo.Metadata == nil {
+		w.workerInfo.Metadata = make(map[string]string)
+	}
+	w.workerInfo.Metadata["capacity_rejections"] = strconv.FormatInt(w.CapacityRejections(), 10)
 	w.mu.Unlock()
 
 	// Send heartbeat to service discovery
@@ -207,6 +338,45 @@ func (w *Worker) sendHeartbeat(ctx context.Context) error {
 		log.Printf("Warning: Failed to update last_seen in database: %v", err)
 	}
 
+	versionInfo := map[string]interface{}{
+		MetadataVersion:                 w.workerInfo.Metadata[MetadataVersion],
+		MetadataCommit:                  w.workerInfo.Metadata[MetadataCommit],
+		queue.MetadataPayloadVersionMin: w.workerInfo.Metadata[queue.MetadataPayloadVersionMin],
+		queue.MetadataPayloadVersionMax: w.workerInfo.Metadata[queue.MetadataPayloadVersionMax],
+	}
+	if err := w.store.Workers().UpdateMetadata(ctx, w.workerInfo.ID, versionInfo); err != nil {
+		log.Printf("Warning: Failed to report version in database: %v", err)
+	}
+
+	// Keep the host check report current for the gateway
+	w.reportHostChecks(ctx)
+
+	// Persist resource usage, task throughput and host health for
+	// scheduling decisions
+	health := w.reportHostHealth(ctx)
+	w.recordMetrics(ctx, health)
+
+	// Restart once drained if the gateway asked for it
+	w.checkRestartRequest(ctx)
+
+	return nil
+}
+
+// CheckRegistration reports whether this worker's database record exists and
+// isn't offline. Workers without a registry config always pass.
+func (w *Worker) CheckRegistration(ctx context.Context) error {
+	if w.workerInfo == nil {
+		return nil
+	}
+
+	dbWorker, err := w.store.Workers().Get(ctx, w.workerInfo.ID)
+	if err != nil {
+		return err
+	}
+	if dbWorker.Status == string(discovery.WorkerStatusOffline) {
+		return fmt.Errorf("worker %s is marked offline", w.workerInfo.ID)
+	}
+
 	return nil
 }
 
@@ -232,6 +402,9 @@ func (w *Worker) Deregister(ctx context.Context) error {
 		if err := w.store.Workers().UpdateStatus(ctx, w.workerInfo.ID, string(discovery.WorkerStatusOffline)); err != nil {
 			log.Printf("Warning: Failed to update worker status in database: %v", err)
 		}
+
+		w.recordEvent(ctx, events.TopicWorkerLeft, SeverityInfo, "worker", w.workerInfo.ID,
+			fmt.Sprintf("Worker %s left", w.workerInfo.ID), nil)
 	}
 
 	return nil
@@ -261,6 +434,11 @@ func (w *Worker) workerInfoToStorage(info *discovery.WorkerInfo) *storage.Worker
 		labels[k] = v
 	}
 
+	metadata := make(map[string]interface{})
+	for k, v := range info.Metadata {
+		metadata[k] = v
+	}
+
 	return &storage.Worker{
 		ID:           info.ID,
 		Hostname:     info.Hostname,
@@ -279,54 +457,64 @@ func (w *Worker) workerInfoToStorage(info *discovery.WorkerInfo) *storage.Worker
 		UsedDiskGB:   info.Resources.UsedDiskGB,
 		VMCount:      info.Resources.VMCount,
 		MaxVMs:       info.Resources.MaxVMs,
-		Metadata:     make(map[string]interface{}),
+		Metadata:     metadata,
 	}
 }
 
 // RegisterHandlers registers task handlers with the queue
 func (w *Worker) RegisterHandlers(q queue.Queue) error {
-	if err := q.RegisterHandler(queue.TaskTypeVMCreate, w.HandleVMCreate); err != nil {
+	if err := q.RegisterHandler(queue.TaskTypeVMCreate, w.trackTask(w.HandleVMCreate)); err != nil {
 		return fmt.Errorf("failed to register VM create handler: %w", err)
 	}
 
-	if err := q.RegisterHandler(queue.TaskTypeVMExecute, w.HandleVMExecute); err != nil {
+	if err := q.RegisterHandler(queue.TaskTypeVMExecute, w.trackTask(w.HandleVMExecute)); err != nil {
 		return fmt.Errorf("failed to register VM execute handler: %w", err)
 	}
 
-	if err := q.RegisterHandler(queue.TaskTypeVMDelete, w.HandleVMDelete); err != nil {
+	if err := q.RegisterHandler(queue.TaskTypeVMDelete, w.trackTask(w.HandleVMDelete)); err != nil {
 		return fmt.Errorf("failed to register VM delete handler: %w", err)
 	}
 
-	return nil
-}
+	if err := w.registerSnapshotHandlers(q); err != nil {
+		return err
+	}
 
-// VMCreatePayload represents VM creation task payload
-type VMCreatePayload struct {
-	Name            string            `json:"name"`
-	VCPUs           int               `json:"vcpus"`
-	MemoryMB        int               `json:"memory_mb"`
-	AdditionalTools []string          `json:"additional_tools,omitempty"`
-	ToolVersions    map[string]string `json:"tool_versions,omitempty"`
+	return w.registerContainerHandler(q)
 }
 
-// VMExecutePayload represents command execution task payload
-type VMExecutePayload struct {
-	VMID    string   `json:"vm_id"`
-	Command string   `json:"command"`
-	Args    []string `json:"args"`
-}
+// Task payloads handled by the worker
+type (
+	VMCreatePayload  = queue.VMCreatePayload
+	VMExecutePayload = queue.VMExecutePayload
+	VMDeletePayload  = queue.VMDeletePayload
+)
 
 // HandleVMCreate handles VM creation tasks
 func (w *Worker) HandleVMCreate(ctx context.Context, task *queue.Task) (*queue.TaskResult, error) {
 	startTime := time.Now()
 
 	var payload VMCreatePayload
-	if err := queue.UnmarshalPayload(task.Payload, &payload); err != nil {
-		return nil, fmt.Errorf("invalid payload: %w", err)
+	if err := queue.DecodePayload(task, &payload); err != nil {
+		return nil, err
 	}
 
 	log.Printf("Creating VM: %s (vcpu=%d, mem=%dMB)", payload.Name, payload.VCPUs, payload.MemoryMB)
 
+	// Admission control: a failed result makes the queue retry the task later
+	if err := w.admitVM(payload.VCPUs, payload.MemoryMB); err != nil {
+		log.Printf("Rejecting VM %s: %v", payload.Name, err)
+		w.recordEvent(ctx, events.TopicVMCapacityRejected, SeverityWarning, "vm", payload.Name,
+			fmt.Sprintf("VM %s rejected: %v", payload.Name, err), nil)
+		return &queue.TaskResult{
+			TaskID:    task.ID,
+			Success:   false,
+			Error:     err.Error(),
+			Duration:  time.Since(startTime),
+			StartedAt: startTime,
+		}, nil
+	}
+	defer w.releaseVM(payload.VCPUs, payload.MemoryMB)
+
 	// Create VM config
 	vmID := uuid.New().String()
 	vmConfig := &types.VMConfig{
@@ -336,26 +524,33 @@ func (w *Worker) HandleVMCreate(ctx context.Context, task *queue.Task) (*queue.T
 		SocketPath: fmt.Sprintf("/tmp/aetherium-vm-%s.sock", vmID),
 		VCPUCount:  payload.VCPUs,
 		MemoryMB:   payload.MemoryMB,
+		Metadata:   sandboxMetadata(payload.Sandbox),
 	}
 
 	// Create VM using orchestrator
-	vm, err := w.orchestrator.CreateVM(ctx, vmConfig)
+	vm, err := w.createVM(ctx, vmConfig)
 	if err != nil {
+		w.recordEvent(ctx, events.TopicVMFailed, SeverityError, "vm", vmID,
+			fmt.Sprintf("VM %s failed to create: %v", payload.Name, err), nil)
 		return &queue.TaskResult{
 			TaskID:    task.ID,
 			Success:   false,
 			Error:     err.Error(),
 			Duration:  time.Since(startTime),
 			StartedAt: startTime,
+			Terminal:  !queue.IsRetryable(err),
 		}, nil
 	}
 
 	// Start VM
 	if err := w.orchestrator.StartVM(ctx, vm.ID); err != nil {
+		w.recordEvent(ctx, events.TopicVMFailed, SeverityError, "vm", vm.ID,
+			fmt.Sprintf("VM %s failed to start: %v", payload.Name, err), nil)
 		return &queue.TaskResult{
 			TaskID:    task.ID,
 			Success:   false,
 			Error:     fmt.Sprintf("failed to start VM: %v", err),
+			Result:    vmmErrorResult(err),
 			Duration:  time.Since(startTime),
 			StartedAt: startTime,
 		}, nil
@@ -381,6 +576,12 @@ func (w *Worker) HandleVMCreate(ctx context.Context, task *queue.Task) (*queue.T
 		}
 	}
 
+	// Read-only sandboxes can't install anything; tools must be baked into the image
+	if payload.Sandbox != nil && payload.Sandbox.ReadOnlyRootFS {
+		log.Printf("Skipping tool installation in VM %s (read-only sandbox)", vm.ID)
+		uniqueTools = nil
+	}
+
 	// Install tools with timeout (20 minutes)
 	if len(uniqueTools) > 0 {
 		toolVersions := payload.ToolVersions
@@ -432,6 +633,10 @@ func (w *Worker) HandleVMCreate(ctx context.Context, task *queue.Task) (*queue.T
 		Metadata:     make(map[string]interface{}),
 	}
 
+	if payload.Project != "" {
+		dbVM.Metadata["project"] = payload.Project
+	}
+
 	if err := w.store.VMs().Create(ctx, dbVM); err != nil {
 		log.Printf("Warning: Failed to store VM in database: %v", err)
 	}
@@ -443,10 +648,17 @@ func (w *Worker) HandleVMCreate(ctx context.Context, task *queue.Task) (*queue.T
 
 	log.Printf("✓ VM created successfully: %s (id=%s)", payload.Name, vm.ID)
 
+	w.recordEvent(ctx, events.TopicVMCreated, SeverityInfo, "vm", vm.ID,
+		fmt.Sprintf("VM %s created", payload.Name), map[string]interface{}{
+			"name":      payload.Name,
+			"vcpus":     payload.VCPUs,
+			"memory_mb": payload.MemoryMB,
+		})
+
 	result := map[string]interface{}{
 		"vm_id":  vm.ID,
 		"name":   payload.Name,
-		"status": "running",
+		"status": string(vm.Status),
 	}
 
 	return &queue.TaskResult{
@@ -463,27 +675,66 @@ func (w *Worker) HandleVMExecute(ctx context.Context, task *queue.Task) (*queue.
 	startTime := time.Now()
 
 	var payload VMExecutePayload
-	if err := queue.UnmarshalPayload(task.Payload, &payload); err != nil {
-		return nil, fmt.Errorf("invalid payload: %w", err)
+	if err := queue.DecodePayload(task, &payload); err != nil {
+		return nil, err
 	}
 
 	log.Printf("Executing command on VM %s: %s %v", payload.VMID, payload.Command, payload.Args)
 
-	// Execute command
-	cmd := &vmm.Command{
-		Cmd:  payload.Command,
-		Args: payload.Args,
+	// Serve from the result cache when requested
+	var cacheKey string
+	var execResult *vmm.ExecResult
+	cached := false
+	if payload.Cache && w.resultCache != nil {
+		image := payload.CacheImage
+		if image == "" {
+			image = payload.VMID
+		}
+		cacheKey = ResultCacheKey(image, payload.Command, payload.Args, payload.InputsHash)
+		if entry, ok := w.resultCache.Get(cacheKey); ok {
+			log.Printf("✓ Result cache hit for command on VM %s", payload.VMID)
+			execResult = &vmm.ExecResult{
+				ExitCode: entry.ExitCode,
+				Stdout:   entry.Stdout,
+				Stderr:   entry.Stderr,
+			}
+			cached = true
+		}
 	}
 
-	execResult, err := w.orchestrator.ExecuteCommand(ctx, payload.VMID, cmd)
-	if err != nil {
-		return &queue.TaskResult{
-			TaskID:    task.ID,
-			Success:   false,
-			Error:     err.Error(),
-			Duration:  time.Since(startTime),
-			StartedAt: startTime,
-		}, nil
+	if execResult == nil {
+		// Execute command
+		cmd := &vmm.Command{
+			Cmd:  payload.Command,
+			Args: payload.Args,
+		}
+
+		var err error
+		execResult, err = w.orchestrator.ExecuteCommand(ctx, payload.VMID, cmd)
+		if err != nil {
+			// Record the failure so clients following this task see why it ended
+			w.recordFailedExecution(ctx, task.ID, &payload, startTime, err)
+			return &queue.TaskResult{
+				TaskID:    task.ID,
+				Success:   false,
+				Error:     err.Error(),
+				Duration:  time.Since(startTime),
+				StartedAt: startTime,
+			}, nil
+		}
+
+		w.markVMUsed(ctx, payload.VMID)
+		redactExecResult(w.vmRedactor(ctx, payload.VMID), execResult)
+
+		// Only successful results are worth reusing
+		if cacheKey != "" && execResult.ExitCode == 0 {
+			w.resultCache.Put(cacheKey, &cachedResult{
+				ExitCode:  execResult.ExitCode,
+				Stdout:    execResult.Stdout,
+				Stderr:    execResult.Stderr,
+				CreatedAt: time.Now(),
+			})
+		}
 	}
 
 	// Store execution in database
@@ -500,6 +751,7 @@ func (w *Worker) HandleVMExecute(ctx context.Context, task *queue.Task) (*queue.
 
 	execution := &storage.Execution{
 		ID:          uuid.New(),
+		TaskID:      &task.ID,
 		VMID:        &vmUUID,
 		Command:     payload.Command,
 		Args:        args,
@@ -509,12 +761,19 @@ func (w *Worker) HandleVMExecute(ctx context.Context, task *queue.Task) (*queue.
 		StartedAt:   startTime,
 		CompletedAt: timePtr(time.Now()),
 		DurationMS:  intPtr(int(time.Since(startTime).Milliseconds())),
-		Metadata:    make(map[string]interface{}),
+		Metadata: map[string]interface{}{
+			"cached":  cached,
+			"task_id": task.ID.String(),
+		},
+	}
+	if execResult.Resources.Exhausted() {
+		execution.Metadata["resources"] = execResult.Resources
 	}
 
 	if err := w.store.Executions().Create(ctx, execution); err != nil {
 		log.Printf("Warning: Failed to store execution: %v", err)
 	}
+	w.recordResourceExhaustion(ctx, payload.VMID, execResult.Resources)
 
 	success := execResult.ExitCode == 0
 	if success {
@@ -528,16 +787,24 @@ func (w *Worker) HandleVMExecute(ctx context.Context, task *queue.Task) (*queue.
 		"exit_code": execResult.ExitCode,
 		"stdout":    execResult.Stdout,
 		"stderr":    execResult.Stderr,
+		"cached":    cached,
 	}
 
+	// The command ran; running it again would repeat its side effects
 	if !success {
+		errMsg := fmt.Sprintf("command failed with exit code %d", execResult.ExitCode)
+		if exhaustion := describeResourceExhaustion(execResult.Resources); exhaustion != "" {
+			result["resources"] = execResult.Resources
+			errMsg += " (" + exhaustion + ")"
+		}
 		return &queue.TaskResult{
 			TaskID:    task.ID,
 			Success:   false,
-			Error:     fmt.Sprintf("command failed with exit code %d", execResult.ExitCode),
+			Error:     errMsg,
 			Result:    result,
 			Duration:  time.Since(startTime),
 			StartedAt: startTime,
+			Terminal:  true,
 		}, nil
 	}
 
@@ -550,14 +817,43 @@ func (w *Worker) HandleVMExecute(ctx context.Context, task *queue.Task) (*queue.
 	}, nil
 }
 
+// recordFailedExecution stores an execution that never produced a result
+func (w *Worker) recordFailedExecution(ctx context.Context, taskID uuid.UUID, payload *VMExecutePayload, startTime time.Time, execErr error) {
+	vmUUID, _ := uuid.Parse(payload.VMID)
+
+	args := make(storage.JSONBArray, len(payload.Args))
+	for i, arg := range payload.Args {
+		args[i] = arg
+	}
+
+	errMsg := execErr.Error()
+	execution := &storage.Execution{
+		ID:          uuid.New(),
+		TaskID:      &taskID,
+		VMID:        &vmUUID,
+		Command:     payload.Command,
+		Args:        args,
+		Error:       &errMsg,
+		StartedAt:   startTime,
+		CompletedAt: timePtr(time.Now()),
+		DurationMS:  intPtr(int(time.Since(startTime).Milliseconds())),
+		Metadata:    map[string]interface{}{"task_id": taskID.String()},
+	}
+
+	if err := w.store.Executions().Create(ctx, execution); err != nil {
+		log.Printf("Warning: Failed to store execution: %v", err)
+	}
+}
+
 // HandleVMDelete handles VM deletion tasks
 func (w *Worker) HandleVMDelete(ctx context.Context, task *queue.Task) (*queue.TaskResult, error) {
 	startTime := time.Now()
 
-	vmID, ok := task.Payload["vm_id"].(string)
-	if !ok {
-		return nil, fmt.Errorf("invalid payload: missing vm_id")
+	var payload VMDeletePayload
+	if err := queue.DecodePayload(task, &payload); err != nil {
+		return nil, err
 	}
+	vmID := payload.VMID
 
 	log.Printf("Deleting VM: %s", vmID)
 
@@ -575,6 +871,7 @@ func (w *Worker) HandleVMDelete(ctx context.Context, task *queue.Task) (*queue.T
 	// Untrack VM resources
 	w.mu.Lock()
 	delete(w.runningVMs, vmID)
+	delete(w.vmRestarts, vmID)
 	w.mu.Unlock()
 
 	// Delete from database
@@ -623,6 +920,34 @@ func (w *Worker) updateWorkerResources(ctx context.Context) {
 	}
 }
 
+// sandboxMetadata converts a stored sandbox profile into VMConfig metadata for the orchestrator
+func sandboxMetadata(sandbox *storage.SandboxProfile) map[string]string {
+	metadata := make(map[string]string)
+	if sandbox == nil {
+		return metadata
+	}
+
+	profile := &vmm.SandboxProfile{
+		ReadOnlyRootFS: sandbox.ReadOnlyRootFS,
+		TmpfsWorkdir:   sandbox.TmpfsWorkdir,
+		TmpfsSizeMB:    sandbox.TmpfsSizeMB,
+		NoNetwork:      sandbox.NoNetwork,
+		RestrictProc:   sandbox.RestrictProc,
+	}
+	profile.ApplyToMetadata(metadata)
+	return metadata
+}
+
+// vmmErrorResult reports the kind of VMM API error in a failed task's result,
+// so callers can tell a slow host from a broken VM config
+func vmmErrorResult(err error) map[string]interface{} {
+	kind := vmm.APIErrorKind(err)
+	if kind == "" {
+		return nil
+	}
+	return map[string]interface{}{"error_type": kind}
+}
+
 func timePtr(t time.Time) *time.Time {
 	return &t
 }
@@ -2,10 +2,13 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"path/filepath"
 	"time"
 
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
 	"github.com/aetherium/aetherium/services/core/pkg/mcp"
 	"github.com/aetherium/aetherium/services/core/pkg/queue"
 	"github.com/aetherium/aetherium/services/core/pkg/service"
@@ -16,30 +19,14 @@ import (
 	"github.com/google/uuid"
 )
 
-// WorkspaceCreatePayload represents workspace creation task payload
-type WorkspaceCreatePayload struct {
-	WorkspaceID       string                 `json:"workspace_id"`
-	Name              string                 `json:"name"`
-	VCPUs             int                    `json:"vcpus"`
-	MemoryMB          int                    `json:"memory_mb"`
-	AIAssistant       string                 `json:"ai_assistant"`
-	AIAssistantConfig map[string]interface{} `json:"ai_assistant_config,omitempty"`
-	WorkingDir        string                 `json:"working_dir"`
-	AdditionalTools   []string               `json:"additional_tools,omitempty"`
-	ToolVersions      map[string]string      `json:"tool_versions,omitempty"`
-}
-
-// WorkspaceDeletePayload represents workspace deletion task payload
-type WorkspaceDeletePayload struct {
-	WorkspaceID string     `json:"workspace_id"`
-	VMID        *uuid.UUID `json:"vm_id,omitempty"`
-}
-
-// PromptExecutePayload represents prompt execution task payload
-type PromptExecutePayload struct {
-	PromptID    string `json:"prompt_id"`
-	WorkspaceID string `json:"workspace_id"`
-}
+// Task payloads handled by the workspace handlers
+type (
+	WorkspaceCreatePayload   = queue.WorkspaceCreatePayload
+	WorkspaceDeletePayload   = queue.WorkspaceDeletePayload
+	WorkspaceSnapshotPayload = queue.WorkspaceSnapshotPayload
+	WorkspaceRelocatePayload = queue.WorkspaceRelocatePayload
+	PromptExecutePayload     = queue.PromptExecutePayload
+)
 
 // SetWorkspaceService sets the workspace service for workspace handlers
 func (w *Worker) SetWorkspaceService(ws *service.WorkspaceService) {
@@ -48,42 +35,233 @@ func (w *Worker) SetWorkspaceService(ws *service.WorkspaceService) {
 
 // RegisterWorkspaceHandlers registers workspace-related task handlers
 func (w *Worker) RegisterWorkspaceHandlers(q queue.Queue) error {
-	if err := q.RegisterHandler(queue.TaskTypeWorkspaceCreate, w.HandleWorkspaceCreate); err != nil {
+	if err := q.RegisterHandler(queue.TaskTypeWorkspaceCreate, w.trackTask(w.HandleWorkspaceCreate)); err != nil {
 		return fmt.Errorf("failed to register workspace create handler: %w", err)
 	}
 
-	if err := q.RegisterHandler(queue.TaskTypeWorkspaceDelete, w.HandleWorkspaceDelete); err != nil {
+	if err := q.RegisterHandler(queue.TaskTypeWorkspaceDelete, w.trackTask(w.HandleWorkspaceDelete)); err != nil {
 		return fmt.Errorf("failed to register workspace delete handler: %w", err)
 	}
 
-	if err := q.RegisterHandler(queue.TaskTypePromptExecute, w.HandlePromptExecute); err != nil {
+	if err := q.RegisterHandler(queue.TaskTypePromptExecute, w.trackTask(w.HandlePromptExecute)); err != nil {
 		return fmt.Errorf("failed to register prompt execute handler: %w", err)
 	}
 
+	if err := q.RegisterHandler(queue.TaskTypeWorkspaceSnapshot, w.trackTask(w.HandleWorkspaceSnapshot)); err != nil {
+		return fmt.Errorf("failed to register workspace snapshot handler: %w", err)
+	}
+
+	if err := q.RegisterHandler(queue.TaskTypeWorkspaceRelocate, w.trackTask(w.HandleWorkspaceRelocate)); err != nil {
+		return fmt.Errorf("failed to register workspace relocate handler: %w", err)
+	}
+
 	return nil
 }
 
-// HandleWorkspaceCreate handles workspace creation tasks
+// HandleWorkspaceCreate handles workspace creation tasks. Creation runs in
+// phases (VM created, tools installed, prepared) that are checkpointed on the
+// workspace, so a redelivered or retried task resumes after the last phase
+// that completed instead of starting over.
 func (w *Worker) HandleWorkspaceCreate(ctx context.Context, task *queue.Task) (*queue.TaskResult, error) {
 	startTime := time.Now()
 
 	var payload WorkspaceCreatePayload
-	if err := queue.UnmarshalPayload(task.Payload, &payload); err != nil {
-		return nil, fmt.Errorf("invalid payload: %w", err)
+	if err := queue.DecodePayload(task, &payload); err != nil {
+		return nil, err
 	}
 
 	workspaceID, err := uuid.Parse(payload.WorkspaceID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid workspace_id: %w", err)
+		return nil, queue.Terminal(fmt.Errorf("invalid workspace_id: %w", err))
+	}
+
+	workspace, err := w.store.Workspaces().Get(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("workspace not found: %w", err)
+	}
+
+	// A redelivered task for a workspace that already finished has nothing to do
+	if workspace.Status == storage.WorkspaceStatusReady && workspace.VMID != nil {
+		log.Printf("Workspace %s is already ready, skipping create task %s", payload.Name, task.ID)
+		return w.workspaceCreateResult(task, startTime, workspaceID, workspace.VMID.String(), payload.Name), nil
 	}
 
-	log.Printf("Creating workspace: %s (ai=%s, vcpu=%d, mem=%dMB)", payload.Name, payload.AIAssistant, payload.VCPUs, payload.MemoryMB)
+	log.Printf("Creating workspace: %s (ai=%s, vcpu=%d, mem=%dMB, phase=%q)",
+		payload.Name, payload.AIAssistant, payload.VCPUs, payload.MemoryMB, workspace.CreatePhase)
 
-	// Update workspace status to preparing
-	if err := w.store.Workspaces().UpdateStatus(ctx, workspaceID, "preparing"); err != nil {
-		log.Printf("Warning: Failed to update workspace status: %v", err)
+	reason := fmt.Sprintf("create task %s picked up by a worker", task.ID)
+	if workspace.CreatePhase != "" {
+		reason = fmt.Sprintf("create task %s resuming after phase %s", task.ID, workspace.CreatePhase)
+	}
+	if err := w.store.Workspaces().UpdateStatus(ctx, workspaceID, storage.WorkspaceStatusPreparing, reason); err != nil {
+		return &queue.TaskResult{
+			TaskID:    task.ID,
+			Success:   false,
+			Error:     fmt.Sprintf("failed to start workspace creation: %v", err),
+			Duration:  time.Since(startTime),
+			StartedAt: startTime,
+		}, nil
 	}
 
+	phase := workspace.CreatePhase
+	var vmID string
+
+	// Reuse the VM from an earlier attempt if it is still running on this worker.
+	// Otherwise everything installed in it is gone, so start over.
+	if phase != "" {
+		if vmID = w.runningWorkspaceVM(ctx, workspace); vmID == "" {
+			log.Printf("VM from earlier attempt is gone, recreating workspace %s from scratch", payload.Name)
+			if err := w.discardWorkspaceVM(ctx, workspace); err != nil {
+				return w.failWorkspaceCreate(ctx, task, startTime, workspaceID, payload.Name,
+					fmt.Sprintf("could not discard VM from earlier attempt: %v", err)), nil
+			}
+			phase = ""
+		}
+	}
+
+	if phase == "" {
+		vmID, err = w.createWorkspaceVM(ctx, workspaceID, &payload)
+		if err != nil {
+			return w.failWorkspaceCreate(ctx, task, startTime, workspaceID, payload.Name, err.Error()), nil
+		}
+		phase = w.checkpointWorkspace(ctx, workspaceID, storage.WorkspacePhaseVMCreated)
+	}
+
+	if phase == storage.WorkspacePhaseVMCreated {
+		log.Printf("Installing tools in workspace VM %s...", vmID)
+		if err := w.installWorkspaceTools(ctx, vmID, &payload); err != nil {
+			return w.failWorkspaceCreate(ctx, task, startTime, workspaceID, payload.Name,
+				fmt.Sprintf("tool installation failed: %v", err)), nil
+		}
+		log.Printf("✓ All tools installed successfully in workspace VM %s", vmID)
+		phase = w.checkpointWorkspace(ctx, workspaceID, storage.WorkspacePhaseToolsInstalled)
+	}
+
+	if phase == storage.WorkspacePhaseToolsInstalled {
+		log.Printf("Executing preparation steps for workspace %s...", workspaceID)
+		if err := w.executePrepSteps(ctx, workspaceID, vmID); err != nil {
+			return w.failWorkspaceCreate(ctx, task, startTime, workspaceID, payload.Name, err.Error()), nil
+		}
+		if payload.CloneFrom != "" {
+			log.Printf("Copying working tree of workspace %s into workspace %s...", payload.CloneFrom, workspaceID)
+			if err := w.copyWorkingTree(ctx, vmID, &payload); err != nil {
+				return w.failWorkspaceCreate(ctx, task, startTime, workspaceID, payload.Name, err.Error()), nil
+			}
+		}
+		w.checkpointWorkspace(ctx, workspaceID, storage.WorkspacePhasePrepared)
+	}
+
+	// Track VM resources
+	w.mu.Lock()
+	w.runningVMs[vmID] = &vmResourceUsage{
+		VCPUs:    payload.VCPUs,
+		MemoryMB: int64(payload.MemoryMB),
+	}
+	w.tasksProcessed++
+	w.mu.Unlock()
+
+	// Mark workspace as ready
+	if err := w.store.Workspaces().SetReady(ctx, workspaceID, fmt.Sprintf("VM %s is running", vmID)); err != nil {
+		log.Printf("Warning: Failed to mark workspace as ready: %v", err)
+	}
+	w.recordEvent(ctx, events.TopicWorkspaceReady, SeverityInfo, "workspace", workspaceID.String(),
+		fmt.Sprintf("Workspace %s is ready", payload.Name), map[string]interface{}{"vm_id": vmID})
+
+	// Update worker resources in database
+	if w.workerInfo != nil {
+		w.updateWorkerResources(ctx)
+	}
+
+	log.Printf("✓ Workspace created successfully: %s (vm=%s)", payload.Name, vmID)
+
+	return w.workspaceCreateResult(task, startTime, workspaceID, vmID, payload.Name), nil
+}
+
+func (w *Worker) workspaceCreateResult(task *queue.Task, startTime time.Time, workspaceID uuid.UUID, vmID, name string) *queue.TaskResult {
+	return &queue.TaskResult{
+		TaskID:  task.ID,
+		Success: true,
+		Result: map[string]interface{}{
+			"workspace_id": workspaceID.String(),
+			"vm_id":        vmID,
+			"name":         name,
+			"status":       storage.WorkspaceStatusReady,
+		},
+		Duration:  time.Since(startTime),
+		StartedAt: startTime,
+	}
+}
+
+// failWorkspaceCreate marks the workspace failed, keeping its checkpoint so
+// POST /workspaces/{id}/retry can resume it
+func (w *Worker) failWorkspaceCreate(ctx context.Context, task *queue.Task, startTime time.Time, workspaceID uuid.UUID, name, reason string) *queue.TaskResult {
+	w.store.Workspaces().UpdateStatus(ctx, workspaceID, storage.WorkspaceStatusFailed, reason)
+	w.recordEvent(ctx, events.TopicWorkspaceFailed, SeverityError, "workspace", workspaceID.String(),
+		fmt.Sprintf("Workspace %s failed: %s", name, reason), nil)
+	return &queue.TaskResult{
+		TaskID:    task.ID,
+		Success:   false,
+		Error:     reason,
+		Duration:  time.Since(startTime),
+		StartedAt: startTime,
+	}
+}
+
+// checkpointWorkspace records that a creation phase completed and returns it
+func (w *Worker) checkpointWorkspace(ctx context.Context, workspaceID uuid.UUID, phase string) string {
+	if err := w.store.Workspaces().SetCreatePhase(ctx, workspaceID, phase); err != nil {
+		log.Printf("Warning: Failed to checkpoint workspace %s at %s: %v", workspaceID, phase, err)
+	}
+	return phase
+}
+
+// runningWorkspaceVM returns the workspace's VM ID if the VM is running on
+// this worker, or "" if it is missing or stopped
+func (w *Worker) runningWorkspaceVM(ctx context.Context, workspace *storage.Workspace) string {
+	if workspace.VMID == nil {
+		return ""
+	}
+	vm, err := w.orchestrator.GetVMStatus(ctx, workspace.VMID.String())
+	if err != nil || vm.Status != types.VMStatusRunning {
+		return ""
+	}
+	return vm.ID
+}
+
+// discardWorkspaceVM removes what is left of an earlier creation attempt so
+// the workspace can be created from scratch
+func (w *Worker) discardWorkspaceVM(ctx context.Context, workspace *storage.Workspace) error {
+	if workspace.VMID != nil {
+		vmID := workspace.VMID.String()
+		if err := w.orchestrator.DeleteVM(ctx, vmID); err != nil {
+			log.Printf("Warning: Failed to delete VM %s from earlier attempt: %v", vmID, err)
+		}
+		w.mu.Lock()
+		delete(w.runningVMs, vmID)
+		w.mu.Unlock()
+	}
+	w.destroyWorkspaceServices(ctx, workspace.ID)
+
+	return w.store.WithTx(ctx, func(tx storage.Store) error {
+		// Unlink before deleting the VM row; deleting it cascades to the workspace
+		if workspace.VMID != nil {
+			if err := tx.Workspaces().ClearVMID(ctx, workspace.ID); err != nil {
+				return err
+			}
+			if err := tx.VMs().Delete(ctx, *workspace.VMID); err != nil {
+				log.Printf("Warning: Failed to delete VM from database: %v", err)
+			}
+		}
+		if err := tx.PrepSteps().ResetByWorkspace(ctx, workspace.ID); err != nil {
+			return err
+		}
+		return tx.Workspaces().SetCreatePhase(ctx, workspace.ID, "")
+	})
+}
+
+// createWorkspaceVM creates and boots the workspace VM, links it to the
+// workspace and provides secrets to it
+func (w *Worker) createWorkspaceVM(ctx context.Context, workspaceID uuid.UUID, payload *WorkspaceCreatePayload) (string, error) {
 	// Create VM config
 	vmID := uuid.New().String()
 	vmConfig := &types.VMConfig{
@@ -96,28 +274,15 @@ func (w *Worker) HandleWorkspaceCreate(ctx context.Context, task *queue.Task) (*
 	}
 
 	// Create VM using orchestrator
-	vm, err := w.orchestrator.CreateVM(ctx, vmConfig)
+	vm, err := w.createVM(ctx, vmConfig)
 	if err != nil {
-		w.store.Workspaces().UpdateStatus(ctx, workspaceID, "failed")
-		return &queue.TaskResult{
-			TaskID:    task.ID,
-			Success:   false,
-			Error:     fmt.Sprintf("failed to create VM: %v", err),
-			Duration:  time.Since(startTime),
-			StartedAt: startTime,
-		}, nil
+		return "", fmt.Errorf("could not create VM: %w", err)
 	}
 
 	// Start VM
 	if err := w.orchestrator.StartVM(ctx, vm.ID); err != nil {
-		w.store.Workspaces().UpdateStatus(ctx, workspaceID, "failed")
-		return &queue.TaskResult{
-			TaskID:    task.ID,
-			Success:   false,
-			Error:     fmt.Sprintf("failed to start VM: %v", err),
-			Duration:  time.Since(startTime),
-			StartedAt: startTime,
-		}, nil
+		w.orchestrator.DeleteVM(ctx, vm.ID)
+		return "", fmt.Errorf("could not start VM %s: %w", vm.ID, err)
 	}
 
 	// ✅ IMPORTANT: Store VM in database FIRST (before SetVMID) to satisfy foreign key constraint
@@ -149,19 +314,15 @@ func (w *Worker) HandleWorkspaceCreate(ctx context.Context, task *queue.Task) (*
 		},
 	}
 
-	if err := w.store.VMs().Create(ctx, dbVM); err != nil {
-		log.Printf("Warning: Failed to store VM in database: %v", err)
-		// Don't fail here - VM is running, we should continue
-	}
-
-	// Now we can safely link the VM to the workspace (foreign key constraint satisfied)
-	if err := w.store.Workspaces().SetVMID(ctx, workspaceID, vmUUID); err != nil {
-		log.Printf("Warning: Failed to link VM to workspace: %v", err)
+	// Resuming relies on the link to the workspace, so it is required
+	if err := w.linkWorkspaceVM(ctx, workspaceID, dbVM); err != nil {
+		w.orchestrator.DeleteVM(ctx, vm.ID)
+		return "", fmt.Errorf("could not link VM %s to workspace: %w", vm.ID, err)
 	}
 
 	// ✅ SECURITY: Inject secrets at boot time via vsock (in-memory only, never filesystem)
 	if w.workspaceService != nil {
-		secrets, err := w.getWorkspaceSecrets(ctx, workspaceID)
+		secrets, provided, err := w.getWorkspaceSecrets(ctx, workspaceID)
 		if err != nil {
 			log.Printf("Warning: Failed to get workspace secrets: %v", err)
 		} else if len(secrets) > 0 {
@@ -175,6 +336,8 @@ func (w *Worker) HandleWorkspaceCreate(ctx context.Context, task *queue.Task) (*
 					log.Printf("Warning: Failed to provide secrets to VM: %v", err)
 					// Don't fail workspace creation if secret injection fails
 					// The workspace will still be usable, just without secrets
+				} else if err := w.workspaceService.RecordSecretUsage(ctx, provided, workspaceID, &vmUUID, storage.SecretUsageVMBoot); err != nil {
+					log.Printf("Warning: %v", err)
 				}
 			} else {
 				log.Printf("Warning: Orchestrator does not support secure secret injection")
@@ -185,9 +348,120 @@ func (w *Worker) HandleWorkspaceCreate(ctx context.Context, task *queue.Task) (*
 	// Wait for agent to be ready (including time for secret fetching)
 	time.Sleep(8 * time.Second)
 
-	// Install tools (default + AI assistant + additional)
-	log.Printf("Installing tools in workspace VM %s...", vm.ID)
+	return vm.ID, nil
+}
+
+// linkWorkspaceVM stores the VM and points the workspace at it in one
+// transaction. The VM row must exist first to satisfy the workspaces.vm_id
+// foreign key.
+func (w *Worker) linkWorkspaceVM(ctx context.Context, workspaceID uuid.UUID, vm *storage.VM) error {
+	err := w.store.WithTx(ctx, func(tx storage.Store) error {
+		if err := tx.VMs().Create(ctx, vm); err != nil {
+			return err
+		}
+		return tx.Workspaces().SetVMID(ctx, workspaceID, vm.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	w.recordZonePlacement(ctx, workspaceID, vm.ID.String())
+	return nil
+}
+
+// recordZonePlacement records in the workspace's metadata that its new VM
+// runs in this worker's zone. Workspaces with an environment only change
+// zones by failing over; others only when rebalancing moves them.
+func (w *Worker) recordZonePlacement(ctx context.Context, workspaceID uuid.UUID, vmID string) {
+	zone := w.zone()
+	if zone == "" {
+		return
+	}
+	workspace, err := w.store.Workspaces().Get(ctx, workspaceID)
+	if err != nil {
+		log.Printf("Warning: Failed to record zone placement of workspace %s: %v", workspaceID, err)
+		return
+	}
+
+	reason := storage.PlacementRespawn
+	switch previous := workspace.Zone(); {
+	case previous == "":
+		reason = storage.PlacementInitial
+	case previous != zone && workspace.EnvironmentID != nil:
+		reason = storage.PlacementFailover
+	case previous != zone:
+		reason = storage.PlacementMoved
+	}
+
+	metadata := workspace.PlacementMetadata(storage.ZonePlacement{
+		Zone:     zone,
+		WorkerID: w.workerInfo.ID,
+		VMID:     vmID,
+		Reason:   reason,
+		PlacedAt: time.Now(),
+	})
+	if err := w.store.Workspaces().UpdateMetadata(ctx, workspaceID, metadata); err != nil {
+		log.Printf("Warning: Failed to record zone placement of workspace %s: %v", workspaceID, err)
+	}
+}
+
+// checkWorkspaceZone decides whether this worker may run a workspace placed
+// in another zone. It may when the workspace's environment permits failover,
+// in which case failover is true and the workspace's VM, if any, is
+// unreachable and must be respawned here.
+func (w *Worker) checkWorkspaceZone(ctx context.Context, workspace *storage.Workspace) (failover bool, err error) {
+	placed, zone := workspace.Zone(), w.zone()
+	if placed == "" || zone == "" || placed == zone {
+		return false, nil
+	}
+	if workspace.EnvironmentID == nil {
+		return false, fmt.Errorf("workspace is placed in zone %s, not %s", placed, zone)
+	}
+	env, err := w.store.Environments().Get(ctx, *workspace.EnvironmentID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get environment: %w", err)
+	}
+	if !env.CanFailOver() {
+		return false, fmt.Errorf("workspace is placed in zone %s and environment %s does not permit failover to %s", placed, env.Name, zone)
+	}
+	return true, nil
+}
+
+// forgetWorkspaceVM unlinks a VM that is stranded on a worker in another
+// zone and deletes its record, so the workspace can respawn one here
+func (w *Worker) forgetWorkspaceVM(ctx context.Context, workspace *storage.Workspace) error {
+	if workspace.VMID == nil {
+		return nil
+	}
+	vmID := *workspace.VMID
+	w.destroyWorkspaceServices(ctx, workspace.ID)
+	err := w.store.WithTx(ctx, func(tx storage.Store) error {
+		if err := tx.Workspaces().ClearVMID(ctx, workspace.ID); err != nil {
+			return err
+		}
+		if err := tx.VMs().Delete(ctx, vmID); err != nil {
+			log.Printf("Warning: Failed to delete VM from database: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to unlink VM %s: %w", vmID, err)
+	}
+	workspace.VMID = nil
+	return nil
+}
 
+// zone returns the worker's zone, or "" when it isn't registered
+func (w *Worker) zone() string {
+	if w.workerInfo == nil {
+		return ""
+	}
+	return w.workerInfo.Zone
+}
+
+// installWorkspaceTools installs the default tools, the AI assistant and any
+// additional tools requested for the workspace
+func (w *Worker) installWorkspaceTools(ctx context.Context, vmID string, payload *WorkspaceCreatePayload) error {
 	defaultTools := tools.GetDefaultTools()
 	allTools := append(defaultTools, payload.AdditionalTools...)
 
@@ -222,64 +496,24 @@ func (w *Worker) HandleWorkspaceCreate(ctx context.Context, task *queue.Task) (*
 		toolVersions = make(map[string]string)
 	}
 
-	if err := w.toolInstaller.InstallToolsWithTimeout(ctx, vm.ID, uniqueTools, toolVersions, 20*time.Minute); err != nil {
-		log.Printf("Warning: Tool installation failed (workspace may be partially usable): %v", err)
-	} else {
-		log.Printf("✓ All tools installed successfully in workspace VM %s", vm.ID)
-	}
-
-	// Execute prep steps
-	log.Printf("Executing preparation steps for workspace %s...", workspaceID)
-	if err := w.executePrepSteps(ctx, workspaceID, vm.ID); err != nil {
-		log.Printf("Warning: Prep steps failed: %v", err)
-		// Don't fail the entire workspace creation, just log it
-	}
-
-	// Track VM resources
-	w.mu.Lock()
-	w.runningVMs[vm.ID] = &vmResourceUsage{
-		VCPUs:    payload.VCPUs,
-		MemoryMB: int64(payload.MemoryMB),
-	}
-	w.tasksProcessed++
-	w.mu.Unlock()
-
-	// Mark workspace as ready
-	if err := w.store.Workspaces().SetReady(ctx, workspaceID); err != nil {
-		log.Printf("Warning: Failed to mark workspace as ready: %v", err)
-	}
-
-	// Update worker resources in database
-	if w.workerInfo != nil {
-		w.updateWorkerResources(ctx)
-	}
-
-	log.Printf("✓ Workspace created successfully: %s (vm=%s)", payload.Name, vm.ID)
-
-	result := map[string]interface{}{
-		"workspace_id": workspaceID.String(),
-		"vm_id":        vm.ID,
-		"name":         payload.Name,
-		"status":       "ready",
-	}
-
-	return &queue.TaskResult{
-		TaskID:    task.ID,
-		Success:   true,
-		Result:    result,
-		Duration:  time.Since(startTime),
-		StartedAt: startTime,
-	}, nil
+	return w.toolInstaller.InstallToolsWithTimeout(ctx, vmID, uniqueTools, toolVersions, 20*time.Minute)
 }
 
-// executePrepSteps executes preparation steps for a workspace
+// executePrepSteps executes the workspace's pending preparation steps in order,
+// stopping at the first one that fails
 func (w *Worker) executePrepSteps(ctx context.Context, workspaceID uuid.UUID, vmID string) error {
 	prepSteps, err := w.store.PrepSteps().ListByWorkspace(ctx, workspaceID)
 	if err != nil {
 		return fmt.Errorf("failed to get prep steps: %w", err)
 	}
+	redactor := w.workspaceRedactor(ctx, workspaceID)
 
 	for _, step := range prepSteps {
+		// Steps completed by an earlier attempt already ran in this VM
+		if step.Status == "completed" {
+			continue
+		}
+
 		log.Printf("Executing prep step %d (%s) for workspace %s", step.StepOrder, step.StepType, workspaceID)
 
 		// Update step status to running
@@ -303,16 +537,18 @@ func (w *Worker) executePrepSteps(ctx context.Context, workspaceID uuid.UUID, vm
 		if result == nil {
 			result = &storage.PrepStepResult{}
 		}
+		result.Stdout = redactor.String(result.Stdout)
+		result.Stderr = redactor.String(result.Stderr)
 
 		durationMS := int(time.Since(stepStartTime).Milliseconds())
 		result.DurationMS = durationMS
 
 		if execErr != nil {
-			result.Error = execErr.Error()
+			result.Error = redactor.String(execErr.Error())
 			w.store.PrepSteps().UpdateStatus(ctx, step.ID, "failed", result)
 			log.Printf("✗ Prep step %d failed: %v", step.StepOrder, execErr)
-			// Continue to next step instead of failing entirely
-			continue
+			// Later steps may depend on this one, so stop here. A retry resumes from this step.
+			return fmt.Errorf("prep step %d (%s) failed: %w", step.StepOrder, step.StepType, execErr)
 		}
 
 		w.store.PrepSteps().UpdateStatus(ctx, step.ID, "completed", result)
@@ -402,18 +638,21 @@ func (w *Worker) executeScript(ctx context.Context, vmID string, config map[stri
 	return result, nil
 }
 
-// getWorkspaceSecrets retrieves and decrypts all secrets for a workspace
-func (w *Worker) getWorkspaceSecrets(ctx context.Context, workspaceID uuid.UUID) (map[string]string, error) {
-	secrets, err := w.store.Secrets().ListByWorkspace(ctx, workspaceID)
+// getWorkspaceSecrets retrieves and decrypts all secrets for a workspace,
+// including those inherited from its environment. It also returns the
+// records of the secrets it could decrypt.
+func (w *Worker) getWorkspaceSecrets(ctx context.Context, workspaceID uuid.UUID) (map[string]string, []*storage.WorkspaceSecret, error) {
+	secrets, err := w.workspaceService.EffectiveSecrets(ctx, workspaceID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list secrets: %w", err)
+		return nil, nil, fmt.Errorf("failed to list secrets: %w", err)
 	}
 
 	if len(secrets) == 0 {
-		return make(map[string]string), nil
+		return make(map[string]string), nil, nil
 	}
 
 	decryptedSecrets := make(map[string]string)
+	var decrypted []*storage.WorkspaceSecret
 	for _, secret := range secrets {
 		decryptedValue, err := w.workspaceService.GetDecryptedSecret(ctx, secret.ID)
 		if err != nil {
@@ -421,9 +660,30 @@ func (w *Worker) getWorkspaceSecrets(ctx context.Context, workspaceID uuid.UUID)
 			continue
 		}
 		decryptedSecrets[secret.Name] = decryptedValue
+		decrypted = append(decrypted, secret)
+	}
+
+	return decryptedSecrets, decrypted, nil
+}
+
+// recordPromptSecretUsage records a prompt running with the workspace's
+// secrets, which the VM's agent puts in the environment of every command
+func (w *Worker) recordPromptSecretUsage(ctx context.Context, workspaceID uuid.UUID, vmID string) {
+	if w.workspaceService == nil {
+		return
+	}
+	secrets, err := w.workspaceService.EffectiveSecrets(ctx, workspaceID)
+	if err != nil || len(secrets) == 0 {
+		return
 	}
 
-	return decryptedSecrets, nil
+	var vmUUID *uuid.UUID
+	if id, err := uuid.Parse(vmID); err == nil {
+		vmUUID = &id
+	}
+	if err := w.workspaceService.RecordSecretUsage(ctx, secrets, workspaceID, vmUUID, storage.SecretUsagePrompt); err != nil {
+		log.Printf("Warning: %v", err)
+	}
 }
 
 // executeEnvVar sets an environment variable
@@ -488,13 +748,13 @@ func (w *Worker) HandleWorkspaceDelete(ctx context.Context, task *queue.Task) (*
 	startTime := time.Now()
 
 	var payload WorkspaceDeletePayload
-	if err := queue.UnmarshalPayload(task.Payload, &payload); err != nil {
-		return nil, fmt.Errorf("invalid payload: %w", err)
+	if err := queue.DecodePayload(task, &payload); err != nil {
+		return nil, err
 	}
 
 	workspaceID, err := uuid.Parse(payload.WorkspaceID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid workspace_id: %w", err)
+		return nil, queue.Terminal(fmt.Errorf("invalid workspace_id: %w", err))
 	}
 
 	log.Printf("Deleting workspace: %s", workspaceID)
@@ -515,15 +775,22 @@ func (w *Worker) HandleWorkspaceDelete(ctx context.Context, task *queue.Task) (*
 		w.mu.Lock()
 		delete(w.runningVMs, vmID)
 		w.mu.Unlock()
-
-		// Delete VM from database
-		if err := w.store.VMs().Delete(ctx, *workspace.VMID); err != nil {
-			log.Printf("Warning: Failed to delete VM from database: %v", err)
-		}
 	}
+	w.destroyWorkspaceServices(ctx, workspaceID)
 
-	// Delete workspace (cascade will delete prep steps, secrets, etc.)
-	if err := w.store.Workspaces().Delete(ctx, workspaceID); err != nil {
+	// Delete workspace (cascade will delete prep steps, secrets, etc.) and its VM record together
+	err = w.store.WithTx(ctx, func(tx storage.Store) error {
+		if err := tx.Workspaces().Delete(ctx, workspaceID); err != nil {
+			return err
+		}
+		if workspace != nil && workspace.VMID != nil {
+			if err := tx.VMs().Delete(ctx, *workspace.VMID); err != nil {
+				log.Printf("Warning: Failed to delete VM from database: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
 		return &queue.TaskResult{
 			TaskID:    task.ID,
 			Success:   false,
@@ -549,23 +816,204 @@ func (w *Worker) HandleWorkspaceDelete(ctx context.Context, task *queue.Task) (*
 	}, nil
 }
 
+// HandleWorkspaceRelocate moves an idle workspace to another worker. It runs
+// on the worker hosting the workspace VM: the VM is discarded and a creation
+// task is queued for the target worker, which rebuilds the workspace from
+// its record. Workspaces that became busy or changed VMs since the move was
+// planned are left alone.
+func (w *Worker) HandleWorkspaceRelocate(ctx context.Context, task *queue.Task) (*queue.TaskResult, error) {
+	startTime := time.Now()
+
+	var payload WorkspaceRelocatePayload
+	if err := queue.DecodePayload(task, &payload); err != nil {
+		return nil, err
+	}
+
+	workspaceID, err := uuid.Parse(payload.WorkspaceID)
+	if err != nil {
+		return nil, queue.Terminal(fmt.Errorf("invalid workspace_id: %w", err))
+	}
+
+	if w.workspaceService == nil {
+		return nil, fmt.Errorf("workspace service not configured")
+	}
+
+	workspace, err := w.store.Workspaces().Get(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("workspace not found: %w", err)
+	}
+
+	skip := ""
+	switch {
+	case workspace.VMID == nil || workspace.VMID.String() != payload.VMID:
+		skip = "its VM changed"
+	case workspace.Status != storage.WorkspaceStatusReady:
+		skip = fmt.Sprintf("it is %s", workspace.Status)
+	case workspace.IdleSince == nil:
+		skip = "it is running a prompt"
+	case workspace.EnvironmentID != nil:
+		skip = "its VMs are spawned from an environment"
+	}
+	if skip != "" {
+		log.Printf("Not relocating workspace %s: %s", workspace.Name, skip)
+		return &queue.TaskResult{
+			TaskID:    task.ID,
+			Success:   true,
+			Result:    map[string]interface{}{"workspace_id": workspaceID.String(), "skipped": skip},
+			Duration:  time.Since(startTime),
+			StartedAt: startTime,
+		}, nil
+	}
+
+	log.Printf("Relocating workspace %s (vm=%s) to worker %s", workspace.Name, payload.VMID, payload.TargetWorkerID)
+
+	if err := w.discardWorkspaceVM(ctx, workspace); err != nil {
+		return &queue.TaskResult{
+			TaskID:    task.ID,
+			Success:   false,
+			Error:     fmt.Sprintf("failed to discard workspace VM: %v", err),
+			Duration:  time.Since(startTime),
+			StartedAt: startTime,
+		}, nil
+	}
+	w.store.Workspaces().UpdateIdleSince(ctx, workspaceID, nil)
+	if w.workerInfo != nil {
+		w.updateWorkerResources(ctx)
+	}
+
+	reason := fmt.Sprintf("moving to worker %s", payload.TargetWorkerID)
+	if err := w.store.Workspaces().UpdateStatus(ctx, workspaceID, storage.WorkspaceStatusCreating, reason); err != nil {
+		log.Printf("Warning: Failed to mark workspace %s as creating: %v", workspaceID, err)
+	}
+
+	createTaskID, err := w.workspaceService.RecreateWorkspace(ctx, workspaceID, payload.TargetWorkerID)
+	if err != nil {
+		// The VM is already gone; fail the workspace so it can be retried anywhere
+		return w.failWorkspaceCreate(ctx, task, startTime, workspaceID, workspace.Name,
+			fmt.Sprintf("could not queue creation on worker %s: %v", payload.TargetWorkerID, err)), nil
+	}
+
+	log.Printf("✓ Workspace %s handed off to worker %s (task %s)", workspace.Name, payload.TargetWorkerID, createTaskID)
+
+	return &queue.TaskResult{
+		TaskID:  task.ID,
+		Success: true,
+		Result: map[string]interface{}{
+			"workspace_id":     workspaceID.String(),
+			"target_worker_id": payload.TargetWorkerID,
+			"create_task_id":   createTaskID.String(),
+		},
+		Duration:  time.Since(startTime),
+		StartedAt: startTime,
+	}, nil
+}
+
+// HandleWorkspaceSnapshot copies a workspace VM's rootfs into an environment image
+func (w *Worker) HandleWorkspaceSnapshot(ctx context.Context, task *queue.Task) (*queue.TaskResult, error) {
+	startTime := time.Now()
+
+	var payload WorkspaceSnapshotPayload
+	if err := queue.DecodePayload(task, &payload); err != nil {
+		return nil, err
+	}
+
+	envID, err := uuid.Parse(payload.EnvironmentID)
+	if err != nil {
+		return nil, queue.Terminal(fmt.Errorf("invalid environment_id: %w", err))
+	}
+
+	snapshotter, ok := w.orchestrator.(interface {
+		SnapshotRootFS(context.Context, string, string) error
+	})
+	if !ok {
+		return &queue.TaskResult{
+			TaskID:    task.ID,
+			Success:   false,
+			Error:     "orchestrator does not support rootfs snapshots",
+			Duration:  time.Since(startTime),
+			StartedAt: startTime,
+		}, nil
+	}
+
+	env, err := w.store.Environments().Get(ctx, envID)
+	if err != nil {
+		return &queue.TaskResult{
+			TaskID:    task.ID,
+			Success:   false,
+			Error:     fmt.Sprintf("failed to get environment: %v", err),
+			Duration:  time.Since(startTime),
+			StartedAt: startTime,
+		}, nil
+	}
+
+	log.Printf("Snapshotting rootfs of VM %s (workspace %s) into environment %s", payload.VMID, payload.WorkspaceID, env.Name)
+
+	// Flush guest page cache so the copied image is consistent
+	if _, err := w.orchestrator.ExecuteCommand(ctx, payload.VMID, &vmm.Command{Cmd: "sync"}); err != nil {
+		log.Printf("Warning: Failed to sync guest filesystem before snapshot: %v", err)
+	}
+
+	// Next to the worker's default template, so it is on the same volume
+	w.mu.RLock()
+	imageDir := filepath.Dir(w.baseImage)
+	w.mu.RUnlock()
+	imagePath := filepath.Join(imageDir, fmt.Sprintf("rootfs-env-%s.ext4", envID))
+	if err := snapshotter.SnapshotRootFS(ctx, payload.VMID, imagePath); err != nil {
+		return &queue.TaskResult{
+			TaskID:    task.ID,
+			Success:   false,
+			Error:     fmt.Sprintf("failed to snapshot rootfs: %v", err),
+			Duration:  time.Since(startTime),
+			StartedAt: startTime,
+		}, nil
+	}
+
+	env.RootFSImage = &imagePath
+	env.RootFSImageWorkerID = nil
+	if w.workerInfo != nil {
+		env.RootFSImageWorkerID = &w.workerInfo.ID
+	}
+	if err := w.store.Environments().Update(ctx, env); err != nil {
+		return &queue.TaskResult{
+			TaskID:    task.ID,
+			Success:   false,
+			Error:     fmt.Sprintf("failed to update environment: %v", err),
+			Duration:  time.Since(startTime),
+			StartedAt: startTime,
+		}, nil
+	}
+
+	log.Printf("✓ Saved rootfs image %s for environment %s", imagePath, env.Name)
+
+	return &queue.TaskResult{
+		TaskID:  task.ID,
+		Success: true,
+		Result: map[string]interface{}{
+			"environment_id": envID.String(),
+			"rootfs_image":   imagePath,
+		},
+		Duration:  time.Since(startTime),
+		StartedAt: startTime,
+	}, nil
+}
+
 // HandlePromptExecute handles prompt execution tasks with on-demand VM spawning
 func (w *Worker) HandlePromptExecute(ctx context.Context, task *queue.Task) (*queue.TaskResult, error) {
 	startTime := time.Now()
 
 	var payload PromptExecutePayload
-	if err := queue.UnmarshalPayload(task.Payload, &payload); err != nil {
-		return nil, fmt.Errorf("invalid payload: %w", err)
+	if err := queue.DecodePayload(task, &payload); err != nil {
+		return nil, err
 	}
 
 	promptID, err := uuid.Parse(payload.PromptID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid prompt_id: %w", err)
+		return nil, queue.Terminal(fmt.Errorf("invalid prompt_id: %w", err))
 	}
 
 	workspaceID, err := uuid.Parse(payload.WorkspaceID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid workspace_id: %w", err)
+		return nil, queue.Terminal(fmt.Errorf("invalid workspace_id: %w", err))
 	}
 
 	// Get prompt task
@@ -573,6 +1021,10 @@ func (w *Worker) HandlePromptExecute(ctx context.Context, task *queue.Task) (*qu
 	if err != nil {
 		return nil, fmt.Errorf("prompt not found: %w", err)
 	}
+	// Tasks of a retried prompt's earlier attempts are dropped
+	if attempt := max(payload.Attempt, 1); promptTask.Attempt != attempt {
+		return nil, queue.Terminal(fmt.Errorf("prompt %s is on attempt %d, not %d", promptID, promptTask.Attempt, attempt))
+	}
 
 	// Get workspace
 	workspace, err := w.store.Workspaces().Get(ctx, workspaceID)
@@ -580,7 +1032,29 @@ func (w *Worker) HandlePromptExecute(ctx context.Context, task *queue.Task) (*qu
 		return nil, fmt.Errorf("workspace not found: %w", err)
 	}
 
+	// A workspace in another zone only runs here when it is failing over
+	failover, err := w.checkWorkspaceZone(ctx, workspace)
+	if err != nil {
+		errResult := &storage.PromptResult{Error: err.Error()}
+		w.store.PromptTasks().UpdateStatus(ctx, promptID, "failed", errResult)
+		w.recordPromptFailure(ctx, promptID, workspaceID, errResult.Error)
+		return &queue.TaskResult{
+			TaskID:    task.ID,
+			Success:   false,
+			Error:     err.Error(),
+			Duration:  time.Since(startTime),
+			StartedAt: startTime,
+		}, nil
+	}
+	if failover {
+		log.Printf("Workspace %s is failing over from zone %s to %s", workspaceID, workspace.Zone(), w.zone())
+		if err := w.forgetWorkspaceVM(ctx, workspace); err != nil {
+			return nil, err
+		}
+	}
+
 	var vmID string
+	var env *storage.Environment
 
 	// On-demand VM spawning: If workspace has no VM, spawn one from environment template
 	if workspace.VMID == nil {
@@ -590,6 +1064,7 @@ func (w *Worker) HandlePromptExecute(ctx context.Context, task *queue.Task) (*qu
 		if workspace.EnvironmentID == nil {
 			errResult := &storage.PromptResult{Error: "workspace has no VM and no environment template configured"}
 			w.store.PromptTasks().UpdateStatus(ctx, promptID, "failed", errResult)
+			w.recordPromptFailure(ctx, promptID, workspaceID, errResult.Error)
 			return &queue.TaskResult{
 				TaskID:    task.ID,
 				Success:   false,
@@ -600,10 +1075,11 @@ func (w *Worker) HandlePromptExecute(ctx context.Context, task *queue.Task) (*qu
 		}
 
 		// Get environment template
-		env, err := w.store.Environments().Get(ctx, *workspace.EnvironmentID)
+		env, err = w.store.Environments().Get(ctx, *workspace.EnvironmentID)
 		if err != nil {
 			errResult := &storage.PromptResult{Error: fmt.Sprintf("failed to get environment: %v", err)}
 			w.store.PromptTasks().UpdateStatus(ctx, promptID, "failed", errResult)
+			w.recordPromptFailure(ctx, promptID, workspaceID, errResult.Error)
 			return &queue.TaskResult{
 				TaskID:    task.ID,
 				Success:   false,
@@ -616,14 +1092,35 @@ func (w *Worker) HandlePromptExecute(ctx context.Context, task *queue.Task) (*qu
 		log.Printf("Spawning on-demand VM for workspace %s using environment %s", workspaceID, env.Name)
 
 		// Update workspace status to indicate VM is being created
-		w.store.Workspaces().UpdateStatus(ctx, workspaceID, "spawning")
+		w.store.Workspaces().UpdateStatus(ctx, workspaceID, storage.WorkspaceStatusSpawning,
+			fmt.Sprintf("prompt %s needs a VM, spawning from environment %s", promptID, env.Name))
 
 		// Spawn VM using environment template
 		vm, err := w.spawnVMFromEnvironment(ctx, workspace, env)
 		if err != nil {
-			w.store.Workspaces().UpdateStatus(ctx, workspaceID, "failed")
-			errResult := &storage.PromptResult{Error: fmt.Sprintf("failed to spawn VM: %v", err)}
+			errResult := &storage.PromptResult{
+				Error:         fmt.Sprintf("failed to spawn VM: %v", err),
+				FailureReason: storage.PromptFailureSpawnFailed,
+				FailureDetail: err.Error(),
+			}
+			// Another worker may have room for the VM, or a working image
+			if w.canRetryPrompt(promptTask, workspace, errResult.FailureReason) {
+				w.store.Workspaces().UpdateStatus(ctx, workspaceID, storage.WorkspaceStatusIdle,
+					fmt.Sprintf("could not spawn VM, retrying prompt %s on another worker: %v", promptID, err))
+				if w.retryPrompt(ctx, promptTask, "", errResult) {
+					return &queue.TaskResult{
+						TaskID:    task.ID,
+						Success:   false,
+						Error:     errResult.Error + " (retrying on another worker)",
+						Duration:  time.Since(startTime),
+						StartedAt: startTime,
+					}, nil
+				}
+			}
+			w.store.Workspaces().UpdateStatus(ctx, workspaceID, storage.WorkspaceStatusFailed,
+				fmt.Sprintf("could not spawn VM: %v", err))
 			w.store.PromptTasks().UpdateStatus(ctx, promptID, "failed", errResult)
+			w.recordPromptFailure(ctx, promptID, workspaceID, errResult.Error)
 			return &queue.TaskResult{
 				TaskID:    task.ID,
 				Success:   false,
@@ -662,10 +1159,16 @@ func (w *Worker) HandlePromptExecute(ctx context.Context, task *queue.Task) (*qu
 		}
 
 		// Mark workspace as ready
-		w.store.Workspaces().SetReady(ctx, workspaceID)
+		w.store.Workspaces().SetReady(ctx, workspaceID, fmt.Sprintf("on-demand VM %s is running", vm.ID))
 		log.Printf("✓ On-demand VM %s spawned successfully for workspace %s", vmID, workspaceID)
 	} else {
 		vmID = workspace.VMID.String()
+		if workspace.EnvironmentID != nil {
+			if env, err = w.store.Environments().Get(ctx, *workspace.EnvironmentID); err != nil {
+				log.Printf("Warning: Failed to get environment for workspace %s: %v", workspaceID, err)
+				env = nil
+			}
+		}
 	}
 
 	// Reset idle timer since workspace is now active
@@ -683,6 +1186,35 @@ func (w *Worker) HandlePromptExecute(ctx context.Context, task *queue.Task) (*qu
 		workingDir = *promptTask.WorkingDirectory
 	}
 
+	// Copy attached files into the working directory, removing them again
+	// once the prompt is done
+	prompt := promptTask.Prompt
+	attachments, err := w.store.PromptAttachments().ListByPrompt(ctx, promptID)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) > 0 {
+		defer w.cleanupPromptAttachments(ctx, vmID, workingDir, promptID)
+		if err := w.copyPromptAttachments(ctx, vmID, workingDir, promptID, attachments); err != nil {
+			errResult := &storage.PromptResult{Error: fmt.Sprintf("failed to copy attachments: %v", err)}
+			w.store.PromptTasks().UpdateStatus(ctx, promptID, "failed", errResult)
+			w.recordPromptFailure(ctx, promptID, workspaceID, errResult.Error)
+			return &queue.TaskResult{
+				TaskID:    task.ID,
+				Success:   false,
+				Error:     errResult.Error,
+				Duration:  time.Since(startTime),
+				StartedAt: startTime,
+			}, nil
+		}
+		prompt = promptWithAttachments(prompt, promptID, attachments)
+	}
+
+	// A retried prompt picks up where its interrupted attempt left off
+	if promptTask.Attempt > 1 {
+		prompt = w.resumeFromCheckpoint(ctx, vmID, workingDir, promptTask, prompt)
+	}
+
 	// ⚠️ SECURITY: Claude Code cannot run with --dangerously-skip-permissions as root
 	// We need to create a non-root user 'aether' and run Claude as that user
 	// This script:
@@ -696,13 +1228,13 @@ func (w *Worker) HandlePromptExecute(ctx context.Context, task *queue.Task) (*qu
 	switch workspace.AIAssistant {
 	case "claude-code":
 		// Claude Code CLI - binary is named 'claude' (from @anthropic-ai/claude-code package)
-		innerCmd = fmt.Sprintf("cd %s && claude --dangerously-skip-permissions -p '%s'", workingDir, escapeShellArg(promptTask.Prompt))
+		innerCmd = fmt.Sprintf("cd %s && claude --dangerously-skip-permissions -p '%s'", workingDir, escapeShellArg(prompt))
 	case "ampcode", "amp":
 		// Ampcode CLI
-		innerCmd = fmt.Sprintf("cd %s && amp '%s'", workingDir, escapeShellArg(promptTask.Prompt))
+		innerCmd = fmt.Sprintf("cd %s && amp '%s'", workingDir, escapeShellArg(prompt))
 	default:
 		// Default to claude-code (binary named 'claude')
-		innerCmd = fmt.Sprintf("cd %s && claude --dangerously-skip-permissions -p '%s'", workingDir, escapeShellArg(promptTask.Prompt))
+		innerCmd = fmt.Sprintf("cd %s && claude --dangerously-skip-permissions -p '%s'", workingDir, escapeShellArg(prompt))
 	}
 
 	// Wrap in non-root user execution
@@ -740,13 +1272,46 @@ su - aether -c '
 
 	cmd = &vmm.Command{
 		Cmd:  "bash",
-		Args: []string{"-c", aiCmd},
+		Args: []string{"-c", wrapPromptCommand(promptID, aiCmd)},
 	}
 
-	execResult, err := w.orchestrator.ExecuteCommand(ctx, vmID, cmd)
+	// Record what the prompt runs against so its result can be reproduced
+	w.captureExecutionEnv(ctx, promptID, workspace, env, vmID, workingDir)
+	w.recordPromptSecretUsage(ctx, workspaceID, vmID)
+
+	// Tools often echo the secrets they were given
+	redactor := w.outputRedactor(ctx, workspaceID, env)
+
+	timeout := w.promptTimeoutFor(promptTask, env)
+	execCtx, cancel := context.WithTimeout(ctx, timeout)
+	stopCheckpoints := w.startPromptCheckpoints(execCtx, vmID, workingDir, promptTask, redactor)
+	execResult, err := w.orchestrator.ExecuteCommand(execCtx, vmID, cmd)
+	timedOut := err != nil && errors.Is(execCtx.Err(), context.DeadlineExceeded)
+	cancel()
+	stopCheckpoints()
+	if timedOut {
+		return w.finishTimedOutPrompt(ctx, task, promptID, workspaceID, vmID, timeout, startTime, redactor), nil
+	}
 	if err != nil {
 		errResult := &storage.PromptResult{Error: err.Error()}
-		w.store.PromptTasks().UpdateStatus(ctx, promptID, "failed", errResult)
+		w.diagnoseAgentFailure(ctx, vmID, err, errResult)
+		// The prompt didn't get to run, or its VM broke under it
+		if w.canRetryPrompt(promptTask, workspace, errResult.FailureReason) {
+			reason := fmt.Sprintf("VM %s unreachable, retrying prompt %s on another worker", vmID, promptID)
+			if abandonErr := w.abandonWorkspaceVM(ctx, workspace, vmID, reason); abandonErr != nil {
+				log.Printf("Warning: Not retrying prompt %s: %v", promptID, abandonErr)
+			} else if w.retryPrompt(ctx, promptTask, vmID, errResult) {
+				return &queue.TaskResult{
+					TaskID:    task.ID,
+					Success:   false,
+					Error:     err.Error() + " (retrying on another worker)",
+					Duration:  time.Since(startTime),
+					StartedAt: startTime,
+				}, nil
+			}
+		}
+		w.store.PromptTasks().UpdateStatus(ctx, promptID, "failed", w.withPromptCheckpoint(ctx, promptID, errResult))
+		w.recordPromptFailure(ctx, promptID, workspaceID, errResult.Error)
 		return &queue.TaskResult{
 			TaskID:    task.ID,
 			Success:   false,
@@ -756,6 +1321,8 @@ su - aether -c '
 		}, nil
 	}
 
+	redactExecResult(redactor, execResult)
+
 	durationMS := int(time.Since(startTime).Milliseconds())
 	result := &storage.PromptResult{
 		ExitCode:   execResult.ExitCode,
@@ -777,11 +1344,18 @@ su - aether -c '
 		}
 		result.Error = errMsg
 		log.Printf("✗ Prompt execution failed: %s", errMsg)
+		w.diagnosePromptFailure(ctx, vmID, result, execResult.Resources)
 	} else {
 		log.Printf("✓ Prompt executed successfully on workspace %s", workspaceID)
 	}
 
 	w.store.PromptTasks().UpdateStatus(ctx, promptID, status, result)
+	if status == "failed" {
+		w.recordPromptFailure(ctx, promptID, workspaceID, fmt.Sprintf("exit code %d (%s)", execResult.ExitCode, result.FailureReason))
+	} else if err := w.store.PromptCheckpoints().Delete(ctx, promptID); err != nil {
+		// Completed prompts have their full output
+		log.Printf("Warning: Failed to delete checkpoint of prompt %s: %v", promptID, err)
+	}
 
 	// Set idle timer since workspace is now idle again
 	idleNow := time.Now()
@@ -804,27 +1378,49 @@ su - aether -c '
 	}, nil
 }
 
+// recordPromptFailure adds a failed prompt to the cluster events timeline
+func (w *Worker) recordPromptFailure(ctx context.Context, promptID, workspaceID uuid.UUID, reason string) {
+	w.recordEvent(ctx, events.TopicPromptFailed, SeverityError, "prompt", promptID.String(),
+		fmt.Sprintf("Prompt failed on workspace %s: %s", workspaceID, reason),
+		map[string]interface{}{"workspace_id": workspaceID.String()})
+}
+
 // spawnVMFromEnvironment creates and starts a VM using environment template configuration
 func (w *Worker) spawnVMFromEnvironment(ctx context.Context, workspace *storage.Workspace, env *storage.Environment) (*types.VM, error) {
-	// Create VM config from environment template
-	vmID := uuid.New().String()
-	vmConfig := &types.VMConfig{
-		ID:         vmID,
-		KernelPath: "/var/firecracker/vmlinux",
-		RootFSPath: "", // Will be set by orchestrator.CreateVM() from template
-		SocketPath: fmt.Sprintf("/tmp/aetherium-vm-%s.sock", vmID),
-		VCPUCount:  env.VCPUs,
-		MemoryMB:   env.MemoryMB,
+	// A pre-warmed VM already has the environment's tools installed
+	if vm := w.claimWarmVM(ctx, workspace, env); vm != nil {
+		return vm, nil
+	}
+
+	if err := w.canBootEnvironment(env); err != nil {
+		return nil, err
 	}
 
+	vcpus, memoryMB := environmentVMSize(env)
+	if err := w.admitVM(vcpus, memoryMB); err != nil {
+		return nil, err
+	}
+	defer w.releaseVM(vcpus, memoryMB)
+
+	// Sidecars boot first so the workspace VM can reach them once it is up
+	sidecars, err := w.startWorkspaceServices(ctx, workspace, env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start services: %w", err)
+	}
+
+	// Create VM config from environment template
+	vmConfig := environmentVMConfig(env, vcpus, memoryMB)
+
 	// Create VM
-	vm, err := w.orchestrator.CreateVM(ctx, vmConfig)
+	vm, err := w.createVM(ctx, vmConfig)
 	if err != nil {
+		w.destroyWorkspaceServices(ctx, workspace.ID)
 		return nil, fmt.Errorf("failed to create VM: %w", err)
 	}
 
 	// Start VM
 	if err := w.orchestrator.StartVM(ctx, vm.ID); err != nil {
+		w.destroyWorkspaceServices(ctx, workspace.ID)
 		return nil, fmt.Errorf("failed to start VM: %w", err)
 	}
 
@@ -848,8 +1444,8 @@ func (w *Worker) spawnVMFromEnvironment(ctx context.Context, workspace *storage.
 		KernelPath:   &kernelPath,
 		RootFSPath:   &rootfsPath,
 		SocketPath:   &socketPath,
-		VCPUCount:    &env.VCPUs,
-		MemoryMB:     &env.MemoryMB,
+		VCPUCount:    &vcpus,
+		MemoryMB:     &memoryMB,
 		WorkerID:     workerID,
 		CreatedAt:    time.Now(),
 		Metadata: map[string]interface{}{
@@ -859,60 +1455,28 @@ func (w *Worker) spawnVMFromEnvironment(ctx context.Context, workspace *storage.
 		},
 	}
 
-	if err := w.store.VMs().Create(ctx, dbVM); err != nil {
-		log.Printf("Warning: Failed to store VM in database: %v", err)
-		// Don't fail here - VM is running, we should continue
-	}
-
-	// Now we can safely link the VM to the workspace (foreign key constraint satisfied)
-	if err := w.store.Workspaces().SetVMID(ctx, workspace.ID, vmUUID); err != nil {
-		log.Printf("Warning: Failed to link VM to workspace: %v", err)
+	if err := w.linkWorkspaceVM(ctx, workspace.ID, dbVM); err != nil {
+		w.orchestrator.DeleteVM(ctx, vm.ID)
+		w.destroyWorkspaceServices(ctx, workspace.ID)
+		return nil, fmt.Errorf("failed to link VM %s to workspace: %w", vm.ID, err)
 	}
 
 	// Wait for agent to be ready
 	time.Sleep(5 * time.Second)
 
-	// Install tools from environment template
-	log.Printf("Installing tools from environment template for VM %s...", vm.ID)
-
-	// Start with default tools
-	defaultTools := tools.GetDefaultTools()
-	allTools := append(defaultTools, env.Tools...)
-
-	// Always include claude-code for AI assistant
-	hasClaudeCode := false
-	for _, t := range allTools {
-		if t == "claude-code" {
-			hasClaudeCode = true
-			break
-		}
-	}
-	if !hasClaudeCode {
-		allTools = append(allTools, "claude-code")
-	}
-
-	// Remove duplicates
-	toolSet := make(map[string]bool)
-	uniqueTools := []string{}
-	for _, tool := range allTools {
-		if !toolSet[tool] {
-			toolSet[tool] = true
-			uniqueTools = append(uniqueTools, tool)
+	if len(sidecars) > 0 {
+		if err := w.linkWorkspaceServices(ctx, vm.ID, sidecars); err != nil {
+			log.Printf("Warning: Failed to add services to /etc/hosts of VM %s: %v", vm.ID, err)
 		}
 	}
 
-	// Install tools with timeout
-	if err := w.toolInstaller.InstallToolsWithTimeout(ctx, vm.ID, uniqueTools, nil, 20*time.Minute); err != nil {
-		log.Printf("Warning: Tool installation failed (workspace may be partially usable): %v", err)
-	} else {
-		log.Printf("✓ All tools installed successfully in VM %s", vm.ID)
-	}
+	w.prepareEnvironmentVM(ctx, vm.ID, env)
 
 	// Track VM resources
 	w.mu.Lock()
 	w.runningVMs[vm.ID] = &vmResourceUsage{
-		VCPUs:    env.VCPUs,
-		MemoryMB: int64(env.MemoryMB),
+		VCPUs:    vcpus,
+		MemoryMB: int64(memoryMB),
 	}
 	w.tasksProcessed++
 	w.mu.Unlock()
@@ -925,6 +1489,62 @@ func (w *Worker) spawnVMFromEnvironment(ctx context.Context, workspace *storage.
 	return vm, nil
 }
 
+// environmentVMConfig builds the configuration of a VM for an environment
+func environmentVMConfig(env *storage.Environment, vcpus, memoryMB int) *types.VMConfig {
+	vmID := uuid.New().String()
+	vmConfig := &types.VMConfig{
+		ID:         vmID,
+		KernelPath: "/var/firecracker/vmlinux",
+		RootFSPath: "", // Will be set by orchestrator.CreateVM() from template
+		SocketPath: fmt.Sprintf("/tmp/aetherium-vm-%s.sock", vmID),
+		VCPUCount:  vcpus,
+		MemoryMB:   memoryMB,
+		Metadata:   sandboxMetadata(env.Sandbox),
+		KernelArgs: env.KernelArgs,
+		Firewall:   env.Firewall,
+	}
+
+	applyDockerMetadata(env.Docker, vmConfig.Metadata)
+	applyPlatformMetadata(env, vmConfig.Metadata)
+
+	// Boot from the environment's saved rootfs image when it has one
+	if env.RootFSImage != nil {
+		vmConfig.Metadata["rootfs_template"] = *env.RootFSImage
+	}
+	return vmConfig
+}
+
+// prepareEnvironmentVM installs an environment's tools in a started VM and
+// starts Docker when the environment runs it. Failures leave the VM
+// partially usable, so they are only logged.
+func (w *Worker) prepareEnvironmentVM(ctx context.Context, vmID string, env *storage.Environment) {
+	// Install tools from environment template
+	log.Printf("Installing tools from environment template for VM %s...", vmID)
+
+	// Default tools, the environment's tools and claude-code for the AI assistant
+	uniqueTools := tools.EnvironmentTools(env.RequestedTools())
+
+	// Install tools with timeout (read-only sandboxes and Windows guests must
+	// have tools baked into the image)
+	if env.Sandbox != nil && env.Sandbox.ReadOnlyRootFS {
+		log.Printf("Skipping tool installation in VM %s (read-only sandbox)", vmID)
+	} else if env.IsWindows() {
+		log.Printf("Skipping tool installation in VM %s (Windows guest)", vmID)
+	} else if err := w.toolInstaller.InstallReleasesWithTimeout(ctx, vmID, uniqueTools, lockedReleases(env), 20*time.Minute); err != nil {
+		log.Printf("Warning: Tool installation failed (workspace may be partially usable): %v", err)
+	} else {
+		log.Printf("✓ All tools installed successfully in VM %s", vmID)
+	}
+
+	if env.Docker != nil {
+		if err := w.startDocker(ctx, vmID); err != nil {
+			log.Printf("Warning: Docker is not available in VM %s: %v", vmID, err)
+		} else {
+			log.Printf("✓ Docker daemon running in VM %s", vmID)
+		}
+	}
+}
+
 // setupClaudeCodeMCP configures MCP servers in the VM by writing to ~/.claude/settings.json
 func (w *Worker) setupClaudeCodeMCP(ctx context.Context, vmID string, env *storage.Environment) error {
 	// Generate Claude Code settings from environment MCP config
@@ -1117,24 +1737,28 @@ func (w *Worker) destroyWorkspaceVM(ctx context.Context, workspace *storage.Work
 	delete(w.runningVMs, vmID)
 	w.mu.Unlock()
 
-	// Delete VM from database
-	if err := w.store.VMs().Delete(ctx, *workspace.VMID); err != nil {
-		log.Printf("Warning: Failed to delete VM from database: %v", err)
-	}
-
-	// Clear VM ID from workspace and update status to idle
-	if err := w.store.Workspaces().ClearVMID(ctx, workspace.ID); err != nil {
-		return fmt.Errorf("failed to clear workspace VM ID: %w", err)
-	}
-
-	// Update workspace status to indicate it's idle (no VM)
-	if err := w.store.Workspaces().UpdateStatus(ctx, workspace.ID, "idle"); err != nil {
-		log.Printf("Warning: Failed to update workspace status: %v", err)
-	}
+	w.destroyWorkspaceServices(ctx, workspace.ID)
 
-	// Clear idle timestamp
-	if err := w.store.Workspaces().UpdateIdleSince(ctx, workspace.ID, nil); err != nil {
-		log.Printf("Warning: Failed to clear idle timestamp: %v", err)
+	// Mark the workspace idle without a VM, then delete the VM record. The
+	// workspace must be unlinked first since deleting the VM cascades to it.
+	err := w.store.WithTx(ctx, func(tx storage.Store) error {
+		if err := tx.Workspaces().ClearVMID(ctx, workspace.ID); err != nil {
+			return fmt.Errorf("failed to clear workspace VM ID: %w", err)
+		}
+		if err := tx.Workspaces().UpdateStatus(ctx, workspace.ID, storage.WorkspaceStatusIdle,
+			fmt.Sprintf("idle VM %s reclaimed", vmID)); err != nil {
+			return err
+		}
+		if err := tx.Workspaces().UpdateIdleSince(ctx, workspace.ID, nil); err != nil {
+			return err
+		}
+		if err := tx.VMs().Delete(ctx, *workspace.VMID); err != nil {
+			log.Printf("Warning: Failed to delete VM from database: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update workspace after deleting VM: %w", err)
 	}
 
 	// Update worker resources
@@ -1144,3 +1768,20 @@ func (w *Worker) destroyWorkspaceVM(ctx context.Context, workspace *storage.Work
 
 	return nil
 }
+
+// lockedReleases returns the tool releases pinned by an environment's tool
+// lock, or nil when it isn't locked
+func lockedReleases(env *storage.Environment) map[string]tools.Release {
+	if env.ToolLock == nil {
+		return nil
+	}
+	releases := make(map[string]tools.Release, len(env.ToolLock.Tools))
+	for _, locked := range env.ToolLock.Tools {
+		releases[locked.Name] = tools.Release{
+			Version:  locked.Version,
+			Artifact: locked.Artifact,
+			Checksum: locked.Checksum,
+		}
+	}
+	return releases
+}
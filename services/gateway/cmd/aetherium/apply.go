@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+)
+
+// Actions reported for each object
+const (
+	actionCreated   = "created"
+	actionUpdated   = "updated"
+	actionUnchanged = "unchanged"
+	actionDeleted   = "deleted"
+)
+
+// Defaults the gateway fills in, so unset manifest fields compare equal
+const (
+	defaultCapacityRetryAfter = 30
+	defaultGCWarningSeconds   = 300
+)
+
+func runApply(client *apiClient, args []string) int {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	path := fs.String("f", "", "Manifest file or directory (required)")
+	prune := fs.Bool("prune", false, "Delete objects of the managed kinds that no manifest declares")
+	dryRun := fs.Bool("dry-run", false, "Print the changes without making them")
+	fs.Parse(args)
+
+	if *path == "" {
+		printError("-f is required")
+		return 2
+	}
+
+	manifests, err := loadManifests(*path)
+	if err != nil {
+		printError("%v", err)
+		return 1
+	}
+
+	a := &applier{client: client, prune: *prune, dryRun: *dryRun}
+	if !a.apply(manifests) {
+		return 1
+	}
+	return 0
+}
+
+// applier reconciles API objects to match a set of manifests. Objects are
+// matched by name; ones that already match are left alone, so applying the
+// same manifests again changes nothing. Fields a manifest leaves out keep
+// their current values.
+type applier struct {
+	client *apiClient
+	prune  bool
+	dryRun bool
+	failed bool
+}
+
+// policyList is the body of GET /capacity-policies and /gc-policies
+type policyList[T any] struct {
+	Policies []T `json:"policies"`
+}
+
+// apply reconciles every kind, carrying on past failed objects, and reports
+// whether all of them succeeded
+func (a *applier) apply(manifests []*manifest) bool {
+	byKind := make(map[string][]*manifest)
+	for _, m := range manifests {
+		byKind[m.Kind] = append(byKind[m.Kind], m)
+	}
+
+	var environments api.ListEnvironmentsResponse
+	if err := a.client.request(http.MethodGet, "/environments", nil, &environments); err != nil {
+		printError("failed to list environments: %v", err)
+		return false
+	}
+	var capacityPolicies policyList[*api.CapacityPolicyResponse]
+	if err := a.client.request(http.MethodGet, "/capacity-policies", nil, &capacityPolicies); err != nil {
+		printError("failed to list capacity policies: %v", err)
+		return false
+	}
+	var gcPolicies policyList[*api.VMGCPolicyResponse]
+	if err := a.client.request(http.MethodGet, "/gc-policies", nil, &gcPolicies); err != nil {
+		printError("failed to list GC policies: %v", err)
+		return false
+	}
+
+	envs := a.applyEnvironments(byKind[kindEnvironment], environments.Environments)
+	a.applyFirewalls(byKind[kindFirewall], envs)
+	a.applyCapacityPolicies(byKind[kindCapacityPolicy], capacityPolicies.Policies)
+	a.applyGCPolicies(byKind[kindGCPolicy], gcPolicies.Policies)
+
+	return !a.failed
+}
+
+// applyEnvironments creates or updates declared environments, then prunes
+// undeclared ones. It returns the environments left, by name; ones only
+// created in a dry run have no ID.
+func (a *applier) applyEnvironments(manifests []*manifest, current []*api.EnvironmentResponse) map[string]*api.EnvironmentResponse {
+	existing := make(map[string]*api.EnvironmentResponse)
+	duplicates := make(map[string]bool)
+	for _, env := range current {
+		if _, ok := existing[env.Name]; ok {
+			duplicates[env.Name] = true
+		}
+		existing[env.Name] = env
+	}
+
+	declared := make(map[string]bool)
+	for _, m := range manifests {
+		name := m.Metadata.Name
+		declared[name] = true
+		if duplicates[name] {
+			a.report(m.Kind, name, "", fmt.Errorf("several environments are named %q; rename all but one", name))
+			delete(existing, name)
+			continue
+		}
+
+		var create api.CreateEnvironmentRequest
+		if err := m.decodeSpec(&create); err != nil {
+			a.report(m.Kind, name, "", err)
+			continue
+		}
+		create.Name = name
+
+		env, ok := existing[name]
+		if !ok {
+			created := &api.EnvironmentResponse{Name: name}
+			err := a.change(http.MethodPost, "/environments", create, created)
+			if err == nil {
+				existing[name] = created
+			}
+			a.report(m.Kind, name, actionCreated, err)
+			continue
+		}
+
+		if !specMatches(create, env) {
+			var update api.UpdateEnvironmentRequest
+			if err := m.decodeSpec(&update); err != nil {
+				a.report(m.Kind, name, "", err)
+				continue
+			}
+			update.Name = name
+			err := a.change(http.MethodPut, "/environments/"+env.ID.String(), update, env)
+			a.report(m.Kind, name, actionUpdated, err)
+			continue
+		}
+		a.report(m.Kind, name, actionUnchanged, nil)
+	}
+
+	if a.prune {
+		for name, env := range existing {
+			if declared[name] || duplicates[name] {
+				continue
+			}
+			err := a.change(http.MethodDelete, "/environments/"+env.ID.String(), nil, nil)
+			if err == nil {
+				delete(existing, name)
+			}
+			a.report(kindEnvironment, name, actionDeleted, err)
+		}
+	}
+
+	return existing
+}
+
+// applyFirewalls sets declared firewalls and prunes the rest
+func (a *applier) applyFirewalls(manifests []*manifest, envs map[string]*api.EnvironmentResponse) {
+	declared := make(map[string]bool)
+	for _, m := range manifests {
+		name := m.Metadata.Name
+		declared[name] = true
+
+		env, ok := envs[name]
+		if !ok {
+			a.report(m.Kind, name, "", fmt.Errorf("environment %q not found", name))
+			continue
+		}
+
+		var policy types.FirewallPolicy
+		if err := m.decodeSpec(&policy); err != nil {
+			a.report(m.Kind, name, "", err)
+			continue
+		}
+		if policy.DefaultEgress == "" {
+			policy.DefaultEgress = types.FirewallAllow
+		}
+		if policy.DefaultIngress == "" {
+			policy.DefaultIngress = types.FirewallAllow
+		}
+		if policy.Rules == nil {
+			policy.Rules = []types.FirewallRule{}
+		}
+
+		if env.Firewall != nil && reflect.DeepEqual(*env.Firewall, policy) {
+			a.report(m.Kind, name, actionUnchanged, nil)
+			continue
+		}
+		action := actionUpdated
+		if env.Firewall == nil {
+			action = actionCreated
+		}
+		a.report(m.Kind, name, action, a.change(http.MethodPut, "/environments/"+env.ID.String()+"/firewall", policy, nil))
+	}
+
+	if a.prune {
+		for name, env := range envs {
+			if declared[name] || env.Firewall == nil {
+				continue
+			}
+			a.report(kindFirewall, name, actionDeleted, a.change(http.MethodDelete, "/environments/"+env.ID.String()+"/firewall", nil, nil))
+		}
+	}
+}
+
+func (a *applier) applyCapacityPolicies(manifests []*manifest, current []*api.CapacityPolicyResponse) {
+	existing := make(map[string]*api.CapacityPolicyResponse)
+	for _, p := range current {
+		existing[p.Project] = p
+	}
+
+	for _, m := range manifests {
+		project := m.Metadata.Name
+		var req api.CapacityPolicyRequest
+		if err := m.decodeSpec(&req); err != nil {
+			a.report(m.Kind, project, "", err)
+			continue
+		}
+		if req.RetryAfterSeconds == 0 {
+			req.RetryAfterSeconds = defaultCapacityRetryAfter
+		}
+
+		policy, ok := existing[project]
+		delete(existing, project)
+		switch {
+		case !ok:
+			a.report(m.Kind, project, actionCreated, a.change(http.MethodPut, "/capacity-policies/"+url.PathEscape(project), req, nil))
+		case policy.Policy != req.Policy || policy.RetryAfterSeconds != req.RetryAfterSeconds:
+			a.report(m.Kind, project, actionUpdated, a.change(http.MethodPut, "/capacity-policies/"+url.PathEscape(project), req, nil))
+		default:
+			a.report(m.Kind, project, actionUnchanged, nil)
+		}
+	}
+
+	if a.prune {
+		for project := range existing {
+			a.report(kindCapacityPolicy, project, actionDeleted, a.change(http.MethodDelete, "/capacity-policies/"+url.PathEscape(project), nil, nil))
+		}
+	}
+}
+
+func (a *applier) applyGCPolicies(manifests []*manifest, current []*api.VMGCPolicyResponse) {
+	existing := make(map[string]*api.VMGCPolicyResponse)
+	for _, p := range current {
+		existing[p.Project] = p
+	}
+
+	for _, m := range manifests {
+		project := m.Metadata.Name
+		var req api.VMGCPolicyRequest
+		if err := m.decodeSpec(&req); err != nil {
+			a.report(m.Kind, project, "", err)
+			continue
+		}
+		if req.WarningSeconds == 0 {
+			req.WarningSeconds = defaultGCWarningSeconds
+		}
+		enabled := req.Enabled == nil || *req.Enabled
+
+		policy, ok := existing[project]
+		delete(existing, project)
+		switch {
+		case !ok:
+			a.report(m.Kind, project, actionCreated, a.change(http.MethodPut, "/gc-policies/"+url.PathEscape(project), req, nil))
+		case policy.MaxAgeSeconds != req.MaxAgeSeconds || policy.MaxIdleSeconds != req.MaxIdleSeconds ||
+			policy.WarningSeconds != req.WarningSeconds || policy.Enabled != enabled:
+			a.report(m.Kind, project, actionUpdated, a.change(http.MethodPut, "/gc-policies/"+url.PathEscape(project), req, nil))
+		default:
+			a.report(m.Kind, project, actionUnchanged, nil)
+		}
+	}
+
+	if a.prune {
+		for project := range existing {
+			a.report(kindGCPolicy, project, actionDeleted, a.change(http.MethodDelete, "/gc-policies/"+url.PathEscape(project), nil, nil))
+		}
+	}
+}
+
+// change sends a request that modifies an object, unless this is a dry run
+func (a *applier) change(method, path string, body, out interface{}) error {
+	if a.dryRun {
+		return nil
+	}
+	return a.client.request(method, path, body, out)
+}
+
+// report prints the outcome for one object, recording failures
+func (a *applier) report(kind, name, action string, err error) {
+	if err != nil {
+		a.failed = true
+		printError("%s/%s: %v", kind, name, err)
+		return
+	}
+	if jsonOutput {
+		emit(record{Type: recordApplied, Kind: kind, Name: name, Action: action, DryRun: a.dryRun})
+		return
+	}
+	if a.dryRun && action != actionUnchanged {
+		fmt.Printf("%s/%s %s (dry run)\n", kind, name, action)
+		return
+	}
+	fmt.Printf("%s/%s %s\n", kind, name, action)
+}
+
+// specMatches reports whether every field set in a manifest's spec already
+// has that value on the environment
+func specMatches(spec api.CreateEnvironmentRequest, env *api.EnvironmentResponse) bool {
+	var desired, current map[string]interface{}
+	if !roundTrip(spec, &desired) || !roundTrip(env, &current) {
+		return false
+	}
+	for field, value := range desired {
+		if !reflect.DeepEqual(value, current[field]) {
+			return false
+		}
+	}
+	return true
+}
+
+// roundTrip converts v to its generic JSON form
+func roundTrip(v interface{}, out *map[string]interface{}) bool {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, out) == nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+// defaultAPIURL is used when no flag, environment variable or context sets one
+const defaultAPIURL = "http://localhost:8080"
+
+// Context is a named cluster profile
+type Context struct {
+	API     string `json:"api"`
+	Token   string `json:"token,omitempty"`
+	Project string `json:"project,omitempty"`
+}
+
+// Config is the CLI configuration file
+type Config struct {
+	CurrentContext string              `json:"current_context,omitempty"`
+	Contexts       map[string]*Context `json:"contexts"`
+}
+
+// configPath returns $AETHERIUM_CONFIG or ~/.aetherium/config.json
+func configPath() (string, error) {
+	if path := os.Getenv("AETHERIUM_CONFIG"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+	return filepath.Join(home, ".aetherium", "config.json"), nil
+}
+
+// loadConfig reads the config file, returning an empty config if it doesn't exist
+func loadConfig() (*Config, error) {
+	cfg := &Config{Contexts: make(map[string]*Context)}
+
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if cfg.Contexts == nil {
+		cfg.Contexts = make(map[string]*Context)
+	}
+
+	return cfg, nil
+}
+
+// save writes the config file. It may hold tokens, so it is only readable by the owner.
+func (c *Config) save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	return nil
+}
+
+// resolveContext picks the context to use: --context, then $AETHERIUM_CONTEXT,
+// then the current context. An empty result means no context is configured.
+func (c *Config) resolveContext(name string) (*Context, error) {
+	if name == "" {
+		name = os.Getenv("AETHERIUM_CONTEXT")
+	}
+	if name == "" {
+		name = c.CurrentContext
+	}
+	if name == "" {
+		return &Context{}, nil
+	}
+
+	ctx, ok := c.Contexts[name]
+	if !ok {
+		return nil, fmt.Errorf("context %q not found", name)
+	}
+	return ctx, nil
+}
+
+func configUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: aetherium config <command>
+
+Commands:
+  get-contexts                     List contexts (* marks the current one)
+  current-context                  Print the current context
+  use-context NAME                 Switch the current context
+  set-context NAME [--api URL] [--token TOKEN] [--project PROJECT]
+                                   Create or update a context
+  delete-context NAME              Remove a context
+`)
+}
+
+func runConfig(args []string) int {
+	if len(args) == 0 {
+		configUsage()
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		printError("%v", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "get-contexts":
+		names := make([]string, 0, len(cfg.Contexts))
+		for name := range cfg.Contexts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		if jsonOutput {
+			for _, name := range names {
+				ctx := cfg.Contexts[name]
+				emit(record{
+					Type:    recordContext,
+					Name:    name,
+					API:     ctx.API,
+					Project: ctx.Project,
+					Current: name == cfg.CurrentContext,
+				})
+			}
+			return 0
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "CURRENT\tNAME\tAPI\tPROJECT")
+		for _, name := range names {
+			current := ""
+			if name == cfg.CurrentContext {
+				current = "*"
+			}
+			ctx := cfg.Contexts[name]
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", current, name, ctx.API, ctx.Project)
+		}
+		tw.Flush()
+		return 0
+
+	case "current-context":
+		if cfg.CurrentContext == "" {
+			printError("current context is not set")
+			return 1
+		}
+		if jsonOutput {
+			ctx := cfg.Contexts[cfg.CurrentContext]
+			rec := record{Type: recordContext, Name: cfg.CurrentContext, Current: true}
+			if ctx != nil {
+				rec.API = ctx.API
+				rec.Project = ctx.Project
+			}
+			emit(rec)
+			return 0
+		}
+		fmt.Println(cfg.CurrentContext)
+		return 0
+
+	case "use-context":
+		if len(args) != 2 {
+			printError("use-context takes a context name")
+			return 2
+		}
+		if _, ok := cfg.Contexts[args[1]]; !ok {
+			printError("context %q not found", args[1])
+			return 1
+		}
+		cfg.CurrentContext = args[1]
+		if err := cfg.save(); err != nil {
+			printError("%v", err)
+			return 1
+		}
+		fmt.Printf("Switched to context %q\n", args[1])
+		return 0
+
+	case "set-context":
+		if len(args) < 2 {
+			printError("set-context takes a context name")
+			return 2
+		}
+		name := args[1]
+
+		fs := flag.NewFlagSet("config set-context", flag.ExitOnError)
+		api := fs.String("api", "", "API gateway address")
+		token := fs.String("token", "", "API token")
+		project := fs.String("project", "", "Default project")
+		fs.Parse(args[2:])
+
+		ctx, exists := cfg.Contexts[name]
+		if !exists {
+			ctx = &Context{API: defaultAPIURL}
+			cfg.Contexts[name] = ctx
+		}
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "api":
+				ctx.API = *api
+			case "token":
+				ctx.Token = *token
+			case "project":
+				ctx.Project = *project
+			}
+		})
+		if cfg.CurrentContext == "" {
+			cfg.CurrentContext = name
+		}
+
+		if err := cfg.save(); err != nil {
+			printError("%v", err)
+			return 1
+		}
+		if exists {
+			fmt.Printf("Context %q updated\n", name)
+		} else {
+			fmt.Printf("Context %q created\n", name)
+		}
+		return 0
+
+	case "delete-context":
+		if len(args) != 2 {
+			printError("delete-context takes a context name")
+			return 2
+		}
+		if _, ok := cfg.Contexts[args[1]]; !ok {
+			printError("context %q not found", args[1])
+			return 1
+		}
+		delete(cfg.Contexts, args[1])
+		if cfg.CurrentContext == args[1] {
+			cfg.CurrentContext = ""
+		}
+		if err := cfg.save(); err != nil {
+			printError("%v", err)
+			return 1
+		}
+		fmt.Printf("Context %q deleted\n", args[1])
+		return 0
+
+	default:
+		printError("unknown config command %q", args[0])
+		configUsage()
+		return 2
+	}
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+)
+
+// exitCodeUnknown is returned when a followed command ended without an exit code
+const exitCodeUnknown = 1
+
+// Reconnect handling for streams ended by a draining gateway
+const (
+	reconnectRequested = -1
+	maxReconnects      = 5
+	reconnectDelay     = 2 * time.Second
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: aetherium [--context NAME] [--api URL] [--json] <command> [options]
+
+Commands:
+  exec [--vm ID | --image IMAGE] [--project P] [--follow] -- <command> [args...]
+        Run a command on a VM (or any suitable VM via smart-execute), or in a
+        throwaway container of the given image
+  prompt submit --workspace ID [--attach FILE]... [--follow] <prompt>
+        Submit a prompt to a workspace, uploading files for it to read
+  apply -f PATH [--prune] [--dry-run]
+        Create or update environments, firewalls, capacity and GC policies to
+        match the YAML manifests in a file or directory
+  sync --repo URL [--branch B] [--path DIR] [--interval D] [--prune] [--once]
+        Keep applying the manifests in a git repository as it changes
+  worker bootstrap [--registry URL] [--set KEY=VALUE]... [--check] [--wait D]
+        Check and fix a host's Firecracker worker prerequisites, download
+        missing artifacts, write the worker's config and check it registered
+  config <command>
+        Manage cluster contexts (see 'aetherium config')
+
+With --follow, output is streamed to the terminal and aetherium exits with the
+command's exit code.
+
+With --json (or --jsonl), stdout is JSON Lines: one object per line with a
+"type" of submitted, status, output, exit, error, context, applied, synced
+or check.
+
+The API address comes from --api, $AETHERIUM_API, the selected context
+(--context, $AETHERIUM_CONTEXT or the current context), or defaults to
+http://localhost:8080. $AETHERIUM_TOKEN overrides the context's token.
+`)
+}
+
+func main() {
+	global := flag.NewFlagSet("aetherium", flag.ExitOnError)
+	global.Usage = usage
+	apiURL := global.String("api", "", "API gateway address (overrides the context)")
+	contextName := global.String("context", "", "Context to use instead of the current one")
+	global.BoolVar(&jsonOutput, "json", false, "Print JSON Lines instead of text")
+	global.BoolVar(&jsonOutput, "jsonl", false, "Alias for --json")
+	global.Parse(os.Args[1:])
+
+	args := global.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	if args[0] == "config" {
+		os.Exit(runConfig(args[1:]))
+	}
+
+	client, err := newAPIClient(*contextName, *apiURL)
+	if err != nil {
+		printError("%v", err)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "exec":
+		os.Exit(runExec(client, args[1:]))
+	case "prompt":
+		if len(args) < 2 || args[1] != "submit" {
+			printError("expected 'prompt submit'")
+			usage()
+			os.Exit(2)
+		}
+		os.Exit(runPromptSubmit(client, args[2:]))
+	case "apply":
+		os.Exit(runApply(client, args[1:]))
+	case "sync":
+		os.Exit(runSync(client, args[1:]))
+	case "worker":
+		os.Exit(runWorker(client, args[1:]))
+	default:
+		printError("unknown command %q", args[0])
+		usage()
+		os.Exit(2)
+	}
+}
+
+func runExec(client *apiClient, args []string) int {
+	fs := flag.NewFlagSet("exec", flag.ExitOnError)
+	vmID := fs.String("vm", "", "VM ID to run on (default: pick a VM via smart-execute)")
+	image := fs.String("image", "", "Run in a throwaway container of this image instead of a VM")
+	project := fs.String("project", client.project, "Project for a newly created VM (default from context)")
+	follow := fs.Bool("follow", false, "Stream output and exit with the command's exit code")
+	fs.Parse(args)
+
+	cmdArgs := fs.Args()
+	if len(cmdArgs) == 0 {
+		printError("command is required")
+		return 2
+	}
+
+	if *vmID != "" && *image != "" {
+		printError("--vm and --image cannot be used together")
+		return 2
+	}
+
+	submitted := record{Type: recordSubmitted}
+	if *vmID != "" {
+		var resp api.ExecuteCommandResponse
+		req := api.ExecuteCommandRequest{Command: cmdArgs[0], Args: cmdArgs[1:]}
+		if err := client.post("/vms/"+*vmID+"/execute", req, &resp); err != nil {
+			printError("%v", err)
+			return 1
+		}
+		submitted.TaskID = resp.TaskID.String()
+		submitted.VMID = resp.VMID
+	} else {
+		var resp api.SmartExecuteResponse
+		req := api.SmartExecuteRequest{Command: cmdArgs[0], Args: cmdArgs[1:], PreferExisting: true, Project: *project, Image: *image}
+		if err := client.post("/smart-execute", req, &resp); err != nil {
+			printError("%v", err)
+			return 1
+		}
+		submitted.TaskID = resp.ExecutionID.String()
+		if resp.VMID != nil {
+			submitted.VMID = resp.VMID.String()
+		}
+		submitted.VMName = resp.VMName
+		submitted.VMCreated = resp.VMCreated
+		if resp.VMCreated && !jsonOutput {
+			fmt.Fprintf(os.Stderr, "Created VM %s (%s)\n", resp.VMName, submitted.VMID)
+		}
+	}
+
+	if jsonOutput {
+		emit(submitted)
+	} else if !*follow {
+		fmt.Println(submitted.TaskID)
+	}
+	if !*follow {
+		return 0
+	}
+
+	if !jsonOutput {
+		fmt.Fprintf(os.Stderr, "Task %s submitted, waiting for output...\n", submitted.TaskID)
+	}
+	return client.follow("/tasks/" + submitted.TaskID + "/stream")
+}
+
+func runPromptSubmit(client *apiClient, args []string) int {
+	fs := flag.NewFlagSet("prompt submit", flag.ExitOnError)
+	workspaceID := fs.String("workspace", "", "Workspace ID (required)")
+	follow := fs.Bool("follow", false, "Stream progress and exit with the prompt's exit code")
+	class := fs.String("class", "", "Workload class: interactive or batch (default batch)")
+	var attach fileList
+	fs.Var(&attach, "attach", "File to attach to the prompt (repeatable)")
+	fs.Parse(args)
+
+	if *workspaceID == "" {
+		printError("--workspace is required")
+		return 2
+	}
+	prompt := strings.Join(fs.Args(), " ")
+	if prompt == "" {
+		printError("prompt is required")
+		return 2
+	}
+
+	req := api.SubmitPromptRequest{Prompt: prompt, WorkloadClass: *class}
+	for _, file := range attach {
+		attachment, err := client.uploadAttachment(*workspaceID, file)
+		if err != nil {
+			printError("failed to attach %s: %v", file, err)
+			return 1
+		}
+		req.Attachments = append(req.Attachments, attachment.ID)
+	}
+
+	var resp api.SubmitPromptResponse
+	if err := client.post("/workspaces/"+*workspaceID+"/prompts", req, &resp); err != nil {
+		printError("%v", err)
+		return 1
+	}
+
+	if jsonOutput {
+		emit(record{
+			Type:        recordSubmitted,
+			PromptID:    resp.PromptID.String(),
+			WorkspaceID: resp.WorkspaceID.String(),
+			Status:      resp.Status,
+		})
+	} else if !*follow {
+		fmt.Println(resp.PromptID)
+	}
+	if !*follow {
+		return 0
+	}
+
+	if !jsonOutput {
+		fmt.Fprintf(os.Stderr, "Prompt %s submitted\n", resp.PromptID)
+	}
+	return client.follow(fmt.Sprintf("/workspaces/%s/prompts/%s/stream", *workspaceID, resp.PromptID))
+}
+
+// fileList collects a repeatable file flag
+type fileList []string
+
+func (f *fileList) String() string { return strings.Join(*f, ",") }
+
+func (f *fileList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// apiClient is a minimal client for the gateway REST API
+type apiClient struct {
+	baseURL string
+	token   string
+	project string
+}
+
+// newAPIClient builds a client from the selected context, with --api and
+// environment variables taking precedence
+func newAPIClient(contextName, apiURL string) (*apiClient, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	ctx, err := cfg.resolveContext(contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	if apiURL == "" {
+		apiURL = os.Getenv("AETHERIUM_API")
+	}
+	if apiURL == "" {
+		apiURL = ctx.API
+	}
+	if apiURL == "" {
+		apiURL = defaultAPIURL
+	}
+
+	return &apiClient{
+		baseURL: strings.TrimRight(apiURL, "/") + "/api/v1",
+		token:   getEnv("AETHERIUM_TOKEN", ctx.Token),
+		project: ctx.Project,
+	}, nil
+}
+
+// do sends a request with the context's token, if any
+func (c *apiClient) do(method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func (c *apiClient) post(path string, body, out interface{}) error {
+	return c.request(http.MethodPost, path, body, out)
+}
+
+// request sends body (if not nil) as JSON and decodes the response into out
+// (if not nil)
+func (c *apiClient) request(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	resp, err := c.do(method, path, reader)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// uploadAttachment uploads a file to attach to a prompt of the workspace,
+// named after its base name
+func (c *apiClient) uploadAttachment(workspaceID, file string) (*api.PromptAttachmentResponse, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	path := fmt.Sprintf("/workspaces/%s/attachments?name=%s", workspaceID, url.QueryEscape(filepath.Base(file)))
+	resp, err := c.do(http.MethodPost, path, f)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, responseError(resp)
+	}
+
+	var attachment api.PromptAttachmentResponse
+	if err := json.NewDecoder(resp.Body).Decode(&attachment); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &attachment, nil
+}
+
+// follow reads a server-sent event stream, printing output as it arrives, and
+// returns the exit code from the final "exit" event. Streams closed by a
+// draining gateway are reopened, which lands on another replica.
+func (c *apiClient) follow(path string) int {
+	for attempt := 0; ; attempt++ {
+		code := c.followOnce(path)
+		if code != reconnectRequested {
+			return code
+		}
+		if attempt == maxReconnects {
+			printError("gateway asked to reconnect %d times, giving up", maxReconnects)
+			return exitCodeUnknown
+		}
+		if !jsonOutput {
+			fmt.Fprintln(os.Stderr, "Gateway restarting, reconnecting...")
+		}
+		time.Sleep(reconnectDelay)
+	}
+}
+
+func (c *apiClient) followOnce(path string) int {
+	resp, err := c.do(http.MethodGet, path, nil)
+	if err != nil {
+		printError("stream request failed: %v", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		printError("%v", responseError(resp))
+		return 1
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var event string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data := []byte(strings.TrimPrefix(line, "data: "))
+			if code, done := handleStreamEvent(event, data); done {
+				return code
+			}
+		case line == "":
+			event = ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		printError("stream interrupted: %v", err)
+	} else {
+		printError("stream closed before completion")
+	}
+	return exitCodeUnknown
+}
+
+// handleStreamEvent prints one event and reports whether the stream is finished
+func handleStreamEvent(event string, data []byte) (int, bool) {
+	switch event {
+	case "status":
+		var status api.StreamStatusEvent
+		if err := json.Unmarshal(data, &status); err != nil {
+			return 0, false
+		}
+		if jsonOutput {
+			emit(record{Type: recordStatus, Status: status.Status})
+		} else {
+			fmt.Fprintf(os.Stderr, "Status: %s\n", status.Status)
+		}
+	case "output":
+		var output api.StreamOutputEvent
+		if err := json.Unmarshal(data, &output); err != nil {
+			return 0, false
+		}
+		if jsonOutput {
+			emit(record{Type: recordOutput, Stream: output.Stream, Data: output.Data})
+		} else if output.Stream == "stderr" {
+			io.WriteString(os.Stderr, output.Data)
+		} else {
+			io.WriteString(os.Stdout, output.Data)
+		}
+	case "exit":
+		var exit api.StreamExitEvent
+		if err := json.Unmarshal(data, &exit); err != nil {
+			printError("invalid exit event: %v", err)
+			return exitCodeUnknown, true
+		}
+		code := exit.ExitCode
+		if code < 0 {
+			code = exitCodeUnknown
+		}
+		if jsonOutput {
+			rec := record{Type: recordExit, Status: exit.Status, ExitCode: &code, DurationMS: exit.DurationMS}
+			if exit.Error != nil {
+				rec.Message = *exit.Error
+			}
+			emit(rec)
+		} else if exit.Error != nil && *exit.Error != "" {
+			printError("%s", *exit.Error)
+		}
+		return code, true
+	case "reconnect":
+		return reconnectRequested, true
+	case "error":
+		var msg map[string]string
+		json.Unmarshal(data, &msg)
+		printError("%s", msg["message"])
+		return exitCodeUnknown, true
+	}
+	return 0, false
+}
+
+func responseError(resp *http.Response) error {
+	var apiErr api.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiErr); err == nil && apiErr.Message != "" {
+		return fmt.Errorf("%s (HTTP %d)", apiErr.Message, resp.StatusCode)
+	}
+	return fmt.Errorf("unexpected response: HTTP %d", resp.StatusCode)
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// manifestAPIVersion is the apiVersion manifests must declare
+const manifestAPIVersion = "aetherium/v1"
+
+// Manifest kinds, in the order they are applied
+const (
+	kindEnvironment    = "Environment"    // An environment (VM template), by name
+	kindFirewall       = "Firewall"       // An environment's network whitelist, named after the environment
+	kindCapacityPolicy = "CapacityPolicy" // A project's capacity quota policy, named after the project
+	kindGCPolicy       = "GCPolicy"       // A project's VM garbage collection policy, named after the project
+)
+
+var manifestKinds = []string{kindEnvironment, kindFirewall, kindCapacityPolicy, kindGCPolicy}
+
+// manifest is one declared API object:
+//
+//	apiVersion: aetherium/v1
+//	kind: Environment
+//	metadata:
+//	  name: go-dev
+//	spec:
+//	  vcpus: 2
+//
+// The spec has the fields of the object's API request.
+type manifest struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec map[string]interface{} `yaml:"spec"`
+
+	source string // File the manifest was read from, for errors
+}
+
+func (m *manifest) String() string {
+	return m.Kind + "/" + m.Metadata.Name
+}
+
+// decodeSpec decodes the spec into an API request, rejecting unknown fields
+// so typos don't silently drop settings
+func (m *manifest) decodeSpec(out interface{}) error {
+	data, err := json.Marshal(m.Spec)
+	if err != nil {
+		return fmt.Errorf("%s (%s): invalid spec: %w", m, m.source, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(out); err != nil {
+		return fmt.Errorf("%s (%s): invalid spec: %w", m, m.source, err)
+	}
+	return nil
+}
+
+// loadManifests reads the manifests in a YAML file, or in every .yaml and
+// .yml file under a directory. Files may hold several documents separated
+// by ---. Hidden directories such as .git are skipped.
+func loadManifests(path string) ([]*manifest, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	if info.IsDir() {
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if p != path && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if ext := filepath.Ext(p); ext == ".yaml" || ext == ".yml" {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	} else {
+		files = []string{path}
+	}
+
+	var manifests []*manifest
+	seen := make(map[string]string)
+	for _, file := range files {
+		fileManifests, err := readManifestFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range fileManifests {
+			if previous, ok := seen[m.String()]; ok {
+				return nil, fmt.Errorf("%s is declared in both %s and %s", m, previous, m.source)
+			}
+			seen[m.String()] = m.source
+			manifests = append(manifests, m)
+		}
+	}
+
+	return manifests, nil
+}
+
+func readManifestFile(file string) ([]*manifest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var manifests []*manifest
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		m := &manifest{source: file}
+		err := dec.Decode(m)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		// Empty documents, e.g. after a trailing ---
+		if m.APIVersion == "" && m.Kind == "" && m.Metadata.Name == "" && m.Spec == nil {
+			continue
+		}
+		if err := m.validate(); err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, m)
+	}
+
+	return manifests, nil
+}
+
+func (m *manifest) validate() error {
+	if m.APIVersion != manifestAPIVersion {
+		return fmt.Errorf("%s: apiVersion must be %q", m.source, manifestAPIVersion)
+	}
+	known := false
+	for _, kind := range manifestKinds {
+		if m.Kind == kind {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("%s: unknown kind %q (expected one of %s)", m.source, m.Kind, strings.Join(manifestKinds, ", "))
+	}
+	if m.Metadata.Name == "" {
+		return fmt.Errorf("%s: %s is missing metadata.name", m.source, m.Kind)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// jsonOutput switches stdout to JSON Lines (--json / --jsonl)
+var jsonOutput bool
+
+// Record types emitted in JSON Lines mode
+const (
+	recordSubmitted = "submitted" // A task or prompt was accepted
+	recordStatus    = "status"    // Status change while following
+	recordOutput    = "output"    // Command output while following
+	recordExit      = "exit"      // Final record when following
+	recordError     = "error"     // The command or stream failed
+	recordContext   = "context"   // One per context from config get-contexts
+	recordApplied   = "applied"   // One per object from apply and sync
+	recordSynced    = "synced"    // A sync of a manifest repository finished
+	recordCheck     = "check"     // One per check from worker bootstrap
+)
+
+// record is one JSON Lines output line. Fields are stable; new fields may be
+// added but existing ones won't be renamed or removed.
+type record struct {
+	Type        string `json:"type"`
+	TaskID      string `json:"task_id,omitempty"`
+	PromptID    string `json:"prompt_id,omitempty"`
+	WorkspaceID string `json:"workspace_id,omitempty"`
+	VMID        string `json:"vm_id,omitempty"`
+	VMName      string `json:"vm_name,omitempty"`
+	VMCreated   bool   `json:"vm_created,omitempty"`
+	Status      string `json:"status,omitempty"`
+	Stream      string `json:"stream,omitempty"`
+	Data        string `json:"data,omitempty"`
+	ExitCode    *int   `json:"exit_code,omitempty"`
+	DurationMS  *int   `json:"duration_ms,omitempty"`
+	Message     string `json:"message,omitempty"`
+
+	// Context records
+	Name    string `json:"name,omitempty"`
+	API     string `json:"api,omitempty"`
+	Project string `json:"project,omitempty"`
+	Current bool   `json:"current,omitempty"`
+
+	// Apply and sync records
+	Kind     string `json:"kind,omitempty"`
+	Action   string `json:"action,omitempty"` // created, updated, unchanged or deleted
+	DryRun   bool   `json:"dry_run,omitempty"`
+	Revision string `json:"revision,omitempty"`
+}
+
+// emit writes a record as one line on stdout
+func emit(r record) {
+	data, _ := json.Marshal(r)
+	os.Stdout.Write(append(data, '\n'))
+}
+
+// printError reports a failure on stderr, or as an error record in JSON mode
+func printError(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if jsonOutput {
+		emit(record{Type: recordError, Message: msg})
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Error: %s\n", msg)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// runSync is a sync controller: it pulls a git repository of manifests and
+// applies them every interval, so the API objects follow the repository and
+// changes made by hand are reverted. Run it with --prune for the repository
+// to be the only source of the managed kinds.
+func runSync(client *apiClient, args []string) int {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	repo := fs.String("repo", "", "Git repository holding the manifests (required)")
+	branch := fs.String("branch", "main", "Branch to follow")
+	path := fs.String("path", ".", "Manifest directory within the repository")
+	interval := fs.Duration("interval", time.Minute, "How often to pull and apply")
+	checkout := fs.String("checkout", "", "Directory to keep the clone in (default: a temporary directory)")
+	prune := fs.Bool("prune", false, "Delete objects of the managed kinds that no manifest declares")
+	once := fs.Bool("once", false, "Sync once and exit")
+	fs.Parse(args)
+
+	if *repo == "" {
+		printError("--repo is required")
+		return 2
+	}
+	if *interval <= 0 {
+		printError("--interval must be positive")
+		return 2
+	}
+
+	dir := *checkout
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "aetherium-sync-")
+		if err != nil {
+			printError("failed to create checkout directory: %v", err)
+			return 1
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	for {
+		ok := syncOnce(ctx, client, *repo, *branch, dir, *path, *prune)
+		if *once {
+			if !ok {
+				return 1
+			}
+			return 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncOnce pulls the branch and applies its manifests, reporting whether
+// everything succeeded
+func syncOnce(ctx context.Context, client *apiClient, repo, branch, dir, path string, prune bool) bool {
+	revision, err := pullRepository(ctx, repo, branch, dir)
+	if err != nil {
+		printError("failed to pull %s: %v", repo, err)
+		return false
+	}
+
+	manifests, err := loadManifests(filepath.Join(dir, path))
+	if err != nil {
+		printError("revision %s: %v", revision, err)
+		return false
+	}
+
+	a := &applier{client: client, prune: prune}
+	ok := a.apply(manifests)
+
+	if jsonOutput {
+		emit(record{Type: recordSynced, Revision: revision, Status: syncStatus(ok)})
+	} else {
+		fmt.Fprintf(os.Stderr, "Synced revision %s: %d manifests, %s\n", revision, len(manifests), syncStatus(ok))
+	}
+	return ok
+}
+
+func syncStatus(ok bool) string {
+	if ok {
+		return "succeeded"
+	}
+	return "failed"
+}
+
+// pullRepository brings dir to the tip of the branch, cloning it the first
+// time, and returns the commit checked out. Only the latest commit is
+// fetched.
+func pullRepository(ctx context.Context, repo, branch, dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		if _, err := runGit(ctx, "", "clone", "--quiet", "--depth", "1", "--branch", branch, repo, dir); err != nil {
+			return "", err
+		}
+	} else {
+		if _, err := runGit(ctx, dir, "fetch", "--quiet", "--depth", "1", repo, branch); err != nil {
+			return "", err
+		}
+		if _, err := runGit(ctx, dir, "reset", "--quiet", "--hard", "FETCH_HEAD"); err != nil {
+			return "", err
+		}
+	}
+
+	return runGit(ctx, dir, "rev-parse", "--short", "HEAD")
+}
+
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
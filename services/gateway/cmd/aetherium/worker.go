@@ -0,0 +1,475 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Defaults matching scripts/setup-network.sh and the worker's config
+const (
+	defaultFirecrackerVersion = "v1.7.0"
+	defaultKernelURL          = "https://s3.amazonaws.com/spec.ccfc.min/img/quickstart_guide/x86_64/kernels/vmlinux.bin"
+	defaultBridge             = "aetherium0"
+	defaultBridgeIP           = "172.16.0.1/24"
+	defaultProxyAddr          = "127.0.0.1:3128"
+	registryKernel            = "vmlinux"
+	registryRootFS            = "aetherium-rootfs-latest.ext4" // As uploaded by scripts/build-and-upload-rootfs.sh
+)
+
+// Bootstrap check results
+const (
+	checkOK     = "ok"
+	checkFixed  = "fixed"
+	checkFailed = "failed"
+)
+
+// bootstrapCheck is a host prerequisite of a worker. fix is nil when the
+// check can only be fixed by hand, as described by hint.
+type bootstrapCheck struct {
+	name  string
+	check func() error
+	fix   func() error
+	hint  string
+}
+
+func runWorker(client *apiClient, args []string) int {
+	if len(args) == 0 || args[0] != "bootstrap" {
+		printError("expected 'worker bootstrap'")
+		usage()
+		return 2
+	}
+	return runWorkerBootstrap(client, args[1:])
+}
+
+// runWorkerBootstrap prepares a host to run a Firecracker worker: it checks
+// the prerequisites, fixes those it can, writes the worker's environment
+// file and checks that the worker registered with the cluster
+func runWorkerBootstrap(client *apiClient, args []string) int {
+	fs := flag.NewFlagSet("worker bootstrap", flag.ExitOnError)
+	registry := fs.String("registry", os.Getenv("AETHERIUM_IMAGE_REGISTRY"), "Base URL to download the kernel ("+registryKernel+") and rootfs ("+registryRootFS+") from")
+	kernel := fs.String("kernel", "/var/firecracker/vmlinux", "Kernel image path")
+	rootfs := fs.String("rootfs", "/var/firecracker/rootfs.ext4", "Rootfs template path")
+	fcVersion := fs.String("firecracker-version", defaultFirecrackerVersion, "Firecracker release to install when missing")
+	bridge := fs.String("bridge", defaultBridge, "Bridge VMs are attached to")
+	bridgeIP := fs.String("bridge-ip", defaultBridgeIP, "Address of the bridge, with the VM subnet's prefix length")
+	proxy := fs.String("proxy", defaultProxyAddr, "Address Squid listens on")
+	configPath := fs.String("config", "/etc/aetherium/worker.env", "Worker environment file to write")
+	workerID := fs.String("worker-id", "", "Worker ID (default: worker-<hostname>)")
+	zone := fs.String("zone", "default", "Worker zone")
+	labels := fs.String("labels", "", "Worker labels, as key=value,...")
+	var settings fileList
+	fs.Var(&settings, "set", "Extra worker setting KEY=VALUE, e.g. POSTGRES_HOST=db (repeatable)")
+	checkOnly := fs.Bool("check", false, "Only check the host, without fixing anything or writing the config")
+	wait := fs.Duration("wait", 0, "How long to wait for the worker to register with the cluster")
+	fs.Parse(args)
+
+	if *workerID == "" {
+		hostname, _ := os.Hostname()
+		*workerID = "worker-" + hostname
+	}
+	env := map[string]string{
+		"WORKER_ID":         *workerID,
+		"WORKER_ZONE":       *zone,
+		"WORKER_CAPABILITY": "firecracker",
+		"VMM_BACKEND":       "firecracker",
+		"KERNEL_PATH":       *kernel,
+		"ROOTFS_TEMPLATE":   *rootfs,
+	}
+	if *labels != "" {
+		env["WORKER_LABELS"] = *labels
+	}
+	for _, s := range settings {
+		key, value, ok := strings.Cut(s, "=")
+		if !ok || key == "" {
+			printError("invalid --set %q, expected KEY=VALUE", s)
+			return 2
+		}
+		env[key] = value
+	}
+
+	checks := []bootstrapCheck{
+		{
+			name:  "kvm",
+			check: func() error { return checkDevice("/dev/kvm") },
+			hint:  "enable virtualization and load kvm_intel or kvm_amd",
+		},
+		{
+			name:  "vhost-vsock",
+			check: func() error { return checkDevice("/dev/vhost-vsock") },
+			fix:   func() error { return run("modprobe", "vhost_vsock") },
+			hint:  "modprobe vhost_vsock",
+		},
+		{
+			name:  "firecracker",
+			check: func() error { _, err := exec.LookPath("firecracker"); return err },
+			fix:   func() error { return installFirecracker(*fcVersion) },
+			hint:  "sudo ./scripts/install-firecracker.sh",
+		},
+		{
+			name:  "kernel",
+			check: func() error { return checkFile(*kernel) },
+			fix: func() error {
+				url := defaultKernelURL
+				if *registry != "" {
+					url = strings.TrimRight(*registry, "/") + "/" + registryKernel
+				}
+				return download(url, *kernel)
+			},
+			hint: "sudo ./scripts/download-vsock-kernel.sh",
+		},
+		{
+			name:  "rootfs",
+			check: func() error { return checkFile(*rootfs) },
+			fix: func() error {
+				if *registry == "" {
+					return fmt.Errorf("no --registry to download it from")
+				}
+				return download(strings.TrimRight(*registry, "/")+"/"+registryRootFS, *rootfs)
+			},
+			hint: "pass --registry, or build one with sudo ./scripts/prepare-rootfs-with-tools.sh",
+		},
+		{
+			name:  "bridge",
+			check: func() error { return checkBridge(*bridge, *bridgeIP) },
+			fix:   func() error { return setupBridge(*bridge, *bridgeIP) },
+			hint:  "sudo ./scripts/setup-network.sh",
+		},
+		{
+			name:  "squid",
+			check: func() error { return checkListening(*proxy) },
+			hint:  "sudo ./scripts/setup-squid.sh",
+		},
+	}
+
+	failed := 0
+	for _, c := range checks {
+		status, err := runCheck(c, *checkOnly)
+		reportCheck(c, status, err)
+		if status == checkFailed {
+			failed++
+		}
+	}
+
+	if !*checkOnly {
+		status, err := checkOK, writeWorkerEnv(*configPath, env)
+		if err != nil {
+			status = checkFailed
+			failed++
+		}
+		reportCheck(bootstrapCheck{name: "config"}, status, err)
+	}
+
+	// Workers register when they start, which bootstrap leaves to the
+	// operator; the registration only fails bootstrap when waited for
+	status, err := checkRegistered(client, *workerID, *wait)
+	reportCheck(bootstrapCheck{name: "registration", hint: "start the worker with the settings in " + *configPath}, status, err)
+	if status == checkFailed && *wait > 0 {
+		failed++
+	}
+
+	if failed > 0 {
+		if !jsonOutput {
+			fmt.Fprintf(os.Stderr, "%d check(s) failed\n", failed)
+		}
+		return 1
+	}
+	return 0
+}
+
+// runCheck runs a check and, unless checkOnly, fixes it when it fails
+func runCheck(c bootstrapCheck, checkOnly bool) (string, error) {
+	err := c.check()
+	if err == nil {
+		return checkOK, nil
+	}
+	if checkOnly || c.fix == nil {
+		return checkFailed, err
+	}
+	if fixErr := c.fix(); fixErr != nil {
+		return checkFailed, fmt.Errorf("%v; fixing it failed: %w", err, fixErr)
+	}
+	if err := c.check(); err != nil {
+		return checkFailed, fmt.Errorf("still failing after the fix: %w", err)
+	}
+	return checkFixed, nil
+}
+
+func reportCheck(c bootstrapCheck, status string, err error) {
+	message := ""
+	if err != nil {
+		message = err.Error()
+		if c.hint != "" {
+			message += " (" + c.hint + ")"
+		}
+	}
+	if jsonOutput {
+		emit(record{Type: recordCheck, Name: c.name, Status: status, Message: message})
+		return
+	}
+
+	mark := "✓"
+	if status == checkFailed {
+		mark = "✗"
+	}
+	line := fmt.Sprintf("%s %-13s %s", mark, c.name, status)
+	if message != "" {
+		line += ": " + message
+	}
+	fmt.Println(line)
+}
+
+// checkDevice checks that a device can be opened for reading and writing
+func checkDevice(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func checkFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("%s is empty", path)
+	}
+	return nil
+}
+
+// checkBridge checks that the bridge is up with its address, and that the
+// host forwards the VMs' traffic
+func checkBridge(bridge, bridgeIP string) error {
+	iface, err := net.InterfaceByName(bridge)
+	if err != nil {
+		return fmt.Errorf("bridge %s: %w", bridge, err)
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return fmt.Errorf("bridge %s is down", bridge)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return err
+	}
+	hasIP := false
+	for _, addr := range addrs {
+		if addr.String() == bridgeIP {
+			hasIP = true
+		}
+	}
+	if !hasIP {
+		return fmt.Errorf("bridge %s doesn't have address %s", bridge, bridgeIP)
+	}
+
+	forward, err := os.ReadFile("/proc/sys/net/ipv4/ip_forward")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(forward)) != "1" {
+		return fmt.Errorf("IP forwarding is disabled")
+	}
+	return nil
+}
+
+// setupBridge creates the bridge and NAT for the VM subnet, as
+// scripts/setup-network.sh does
+func setupBridge(bridge, bridgeIP string) error {
+	_, subnet, err := net.ParseCIDR(bridgeIP)
+	if err != nil {
+		return fmt.Errorf("invalid --bridge-ip: %w", err)
+	}
+
+	if _, err := net.InterfaceByName(bridge); err != nil {
+		if err := run("ip", "link", "add", bridge, "type", "bridge"); err != nil {
+			return err
+		}
+	}
+	if err := checkBridge(bridge, bridgeIP); err != nil && strings.Contains(err.Error(), "address") {
+		if err := run("ip", "addr", "add", bridgeIP, "dev", bridge); err != nil {
+			return err
+		}
+	}
+	if err := run("ip", "link", "set", bridge, "up"); err != nil {
+		return err
+	}
+	if err := os.WriteFile("/proc/sys/net/ipv4/ip_forward", []byte("1"), 0644); err != nil {
+		return fmt.Errorf("failed to enable IP forwarding: %w", err)
+	}
+
+	rules := [][]string{
+		{"-t", "nat", "POSTROUTING", "-s", subnet.String(), "!", "-o", bridge, "-j", "MASQUERADE"},
+		{"FORWARD", "-i", bridge, "-j", "ACCEPT"},
+		{"FORWARD", "-o", bridge, "-j", "ACCEPT"},
+	}
+	for _, rule := range rules {
+		if err := ensureIPTablesRule(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureIPTablesRule appends a rule unless it exists. The rule is given as
+// [-t TABLE] CHAIN SPEC...
+func ensureIPTablesRule(rule []string) error {
+	var table []string
+	if rule[0] == "-t" {
+		table, rule = rule[:2], rule[2:]
+	}
+	chain, spec := rule[0], rule[1:]
+
+	check := append(append(append([]string{}, table...), "-C", chain), spec...)
+	if exec.Command("iptables", check...).Run() == nil {
+		return nil
+	}
+	return run("iptables", append(append(append([]string{}, table...), "-A", chain), spec...)...)
+}
+
+func checkListening(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		return fmt.Errorf("nothing listening on %s", addr)
+	}
+	return conn.Close()
+}
+
+// installFirecracker installs a Firecracker release from GitHub into
+// /usr/local/bin
+func installFirecracker(version string) error {
+	arch := "x86_64"
+	if runtime.GOARCH == "arm64" {
+		arch = "aarch64"
+	}
+	url := fmt.Sprintf("https://github.com/firecracker-microvm/firecracker/releases/download/%s/firecracker-%s-%s.tgz", version, version, arch)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	binary := fmt.Sprintf("firecracker-%s-%s", version, arch)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("%s not found in %s", binary, url)
+		}
+		if err != nil {
+			return err
+		}
+		if filepath.Base(hdr.Name) == binary {
+			return writeFile("/usr/local/bin/firecracker", tr, 0755)
+		}
+	}
+}
+
+// download fetches url into path
+func download(url, path string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return writeFile(path, resp.Body, 0644)
+}
+
+// writeFile writes r to path through a temporary file, so an interrupted
+// download doesn't leave a partial artifact behind
+func writeFile(path string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeWorkerEnv writes the worker's settings as an environment file, for
+// systemd's EnvironmentFile or to be sourced before starting the worker
+func writeWorkerEnv(path string, env map[string]string) error {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("# Written by aetherium worker bootstrap\n")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", key, env[key])
+	}
+	return writeFile(path, strings.NewReader(b.String()), 0600)
+}
+
+// checkRegistered checks that the worker is known to the cluster, waiting up
+// to wait for it to register
+func checkRegistered(client *apiClient, workerID string, wait time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+
+	for {
+		var worker struct {
+			Status string `json:"status"`
+		}
+		err := client.request(http.MethodGet, "/workers/"+workerID, nil, &worker)
+		if err == nil {
+			if worker.Status != "active" {
+				return checkFailed, fmt.Errorf("worker %s is registered but %s", workerID, worker.Status)
+			}
+			return checkOK, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return checkFailed, fmt.Errorf("worker %s is not registered with %s: %v", workerID, client.baseURL, err)
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func run(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+	"github.com/google/uuid"
+)
+
+// maxAnalyticsDays bounds the window of the workspace analytics
+const maxAnalyticsDays = 365
+
+// getWorkspaceAnalytics serves GET /analytics/workspaces: per-workspace
+// prompts, failures and VM time over the last ?days (default 30), with a
+// daily prompt count for heatmaps and a rollup per environment. Filter with
+// ?environment_id.
+func (s *Server) getWorkspaceAnalytics(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		var err error
+		if days, err = strconv.Atoi(daysStr); err != nil || days < 1 || days > maxAnalyticsDays {
+			respondError(w, http.StatusBadRequest, "Invalid days", fmt.Errorf("days must be between 1 and %d", maxAnalyticsDays))
+			return
+		}
+	}
+
+	filters := map[string]interface{}{}
+	if envStr := r.URL.Query().Get("environment_id"); envStr != "" {
+		environmentID, err := uuid.Parse(envStr)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
+			return
+		}
+		filters["environment_id"] = environmentID
+	}
+
+	// The window covers whole UTC days, today included
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, 1-days)
+
+	usage, err := s.store.Workspaces().ListUsage(r.Context(), filters, since)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get workspace usage", err)
+		return
+	}
+
+	environments, err := s.store.Environments().List(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list environments", err)
+		return
+	}
+	envNames := make(map[uuid.UUID]string, len(environments))
+	for _, env := range environments {
+		envNames[env.ID] = env.Name
+	}
+
+	resp := api.WorkspaceAnalyticsResponse{
+		Since:        since,
+		Days:         days,
+		Workspaces:   make([]api.WorkspaceUsageResponse, 0, len(usage)),
+		Environments: []api.EnvironmentUsageResponse{},
+		Total:        len(usage),
+	}
+
+	rollups := make(map[uuid.UUID]*environmentRollup)
+	var rollupOrder []uuid.UUID
+	for _, u := range usage {
+		resp.Workspaces = append(resp.Workspaces, api.WorkspaceUsageResponse{
+			WorkspaceID:   u.WorkspaceID,
+			Name:          u.Name,
+			EnvironmentID: u.EnvironmentID,
+			Status:        u.Status,
+			Prompts:       u.Prompts,
+			PromptsPerDay: float64(u.Prompts) / float64(days),
+			AvgDurationMs: u.AvgDurationMs,
+			FailureRate:   u.FailureRate(),
+			IdleRatio:     u.IdleRatio(),
+			VMHours:       u.VMHours(),
+			Daily:         dailyPrompts(u.Daily, since, days),
+		})
+
+		// Workspaces without an environment share the zero key
+		var key uuid.UUID
+		if u.EnvironmentID != nil {
+			key = *u.EnvironmentID
+		}
+		rollup, ok := rollups[key]
+		if !ok {
+			rollup = &environmentRollup{}
+			rollups[key] = rollup
+			rollupOrder = append(rollupOrder, key)
+		}
+		rollup.add(u)
+	}
+
+	for _, key := range rollupOrder {
+		rollup := rollups[key]
+		env := api.EnvironmentUsageResponse{
+			Workspaces: rollup.workspaces,
+			Prompts:    rollup.usage.Prompts,
+			VMHours:    rollup.usage.VMHours(),
+			IdleRatio:  rollup.usage.IdleRatio(),
+		}
+		if key != uuid.Nil {
+			id := key
+			env.EnvironmentID = &id
+			env.Name = envNames[key]
+		}
+		resp.Environments = append(resp.Environments, env)
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// environmentRollup sums the usage of an environment's workspaces
+type environmentRollup struct {
+	workspaces int
+	usage      storage.WorkspaceUsage
+}
+
+func (e *environmentRollup) add(u *storage.WorkspaceUsage) {
+	e.workspaces++
+	e.usage.Prompts += u.Prompts
+	e.usage.BusySeconds += u.BusySeconds
+	e.usage.VMSeconds += u.VMSeconds
+}
+
+// dailyPrompts expands the days with prompts into one entry per day of the
+// window, so that quiet days show up in heatmaps
+func dailyPrompts(daily []storage.DailyPrompts, since time.Time, days int) []api.DailyPromptsResponse {
+	counts := make(map[string]int, len(daily))
+	for _, d := range daily {
+		counts[d.Day.Format(time.DateOnly)] = d.Prompts
+	}
+
+	resp := make([]api.DailyPromptsResponse, days)
+	for i := range resp {
+		date := since.AddDate(0, 0, i).Format(time.DateOnly)
+		resp[i] = api.DailyPromptsResponse{Date: date, Prompts: counts[date]}
+	}
+	return resp
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aetherium/aetherium/services/core/pkg/markdown"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// patchWorkspace edits a workspace's annotations
+func (s *Server) patchWorkspace(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		return
+	}
+
+	patch, ok := decodeAnnotationsPatch(w, r)
+	if !ok {
+		return
+	}
+
+	workspace, err := s.store.Workspaces().Get(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", err)
+		return
+	}
+
+	annotations, ok := patchAnnotations(w, workspace.Annotations, patch)
+	if !ok {
+		return
+	}
+	if err := s.store.Workspaces().SetAnnotations(r.Context(), id, annotations); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update annotations", err)
+		return
+	}
+	workspace.Annotations = annotations
+
+	respondJSON(w, http.StatusOK, storageWorkspaceToResponse(workspace))
+}
+
+// patchEnvironment edits an environment's annotations. Its other settings
+// are replaced with PUT.
+func (s *Server) patchEnvironment(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
+		return
+	}
+
+	patch, ok := decodeAnnotationsPatch(w, r)
+	if !ok {
+		return
+	}
+
+	env, err := s.store.Environments().Get(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Environment not found", err)
+		return
+	}
+
+	annotations, ok := patchAnnotations(w, env.Annotations, patch)
+	if !ok {
+		return
+	}
+	if err := s.store.Environments().SetAnnotations(r.Context(), id, annotations); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update annotations", err)
+		return
+	}
+	env.Annotations = annotations
+
+	respondJSON(w, http.StatusOK, storageEnvironmentToResponse(env))
+}
+
+func decodeAnnotationsPatch(w http.ResponseWriter, r *http.Request) (*api.AnnotationsPatch, bool) {
+	var req api.PatchAnnotationsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return nil, false
+	}
+	if req.Annotations == nil {
+		respondError(w, http.StatusBadRequest, "Annotations are required", nil)
+		return nil, false
+	}
+	return req.Annotations, true
+}
+
+// patchAnnotations applies a patch to a copy of the current annotations
+// and validates the result, which is nil once none are left
+func patchAnnotations(w http.ResponseWriter, current *storage.Annotations, patch *api.AnnotationsPatch) (*storage.Annotations, bool) {
+	annotations := &storage.Annotations{}
+	if current != nil {
+		*annotations = *current
+	}
+	if patch.Owner != nil {
+		annotations.Owner = *patch.Owner
+	}
+	if patch.Purpose != nil {
+		annotations.Purpose = *patch.Purpose
+	}
+	if patch.Notes != nil {
+		annotations.Notes = *patch.Notes
+	}
+	if patch.Links != nil {
+		annotations.Links = make([]storage.AnnotationLink, len(*patch.Links))
+		for i, link := range *patch.Links {
+			annotations.Links[i] = storage.AnnotationLink{Title: link.Title, URL: link.URL}
+		}
+	}
+
+	if err := storage.ValidateAnnotations(annotations); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid annotations", err)
+		return nil, false
+	}
+	if annotations.IsEmpty() {
+		return nil, true
+	}
+	return annotations, true
+}
+
+// storageAnnotationsToResponse converts annotations, rendering the notes
+func storageAnnotationsToResponse(a *storage.Annotations) *api.Annotations {
+	if a.IsEmpty() {
+		return nil
+	}
+	resp := &api.Annotations{
+		Owner:   a.Owner,
+		Purpose: a.Purpose,
+		Notes:   a.Notes,
+	}
+	if a.Notes != "" {
+		resp.NotesHTML = markdown.Render(a.Notes)
+	}
+	for _, link := range a.Links {
+		resp.Links = append(resp.Links, api.AnnotationLink{Title: link.Title, URL: link.URL})
+	}
+	return resp
+}
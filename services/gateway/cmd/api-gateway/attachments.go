@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/service"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// uploadAttachment stores the request body as a file to attach to a prompt
+// of the workspace, named by the name parameter
+func (s *Server) uploadAttachment(w http.ResponseWriter, r *http.Request) {
+	workspaceID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		return
+	}
+	if _, err := s.store.Workspaces().Get(r.Context(), workspaceID); err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", err)
+		return
+	}
+
+	attachment, err := s.workspaceService.UploadAttachment(r.Context(), workspaceID, r.URL.Query().Get("name"), r.Body)
+	switch {
+	case errors.Is(err, service.ErrInvalidAttachment):
+		respondError(w, http.StatusBadRequest, "Invalid attachment", err)
+		return
+	case errors.Is(err, service.ErrAttachmentTooLarge):
+		respondError(w, http.StatusRequestEntityTooLarge, "Attachment too large", err)
+		return
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "Failed to upload attachment", err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, storageAttachmentToResponse(attachment))
+}
+
+// respondPromptError responds to a prompt submission that failed
+func respondPromptError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidAttachment):
+		respondError(w, http.StatusBadRequest, "Invalid attachments", err)
+	case errors.Is(err, service.ErrAttachmentTooLarge):
+		respondError(w, http.StatusRequestEntityTooLarge, "Attachments too large", err)
+	case errors.Is(err, queue.ErrInvalidWorkloadClass):
+		respondError(w, http.StatusBadRequest, "Invalid workload class", err)
+	default:
+		respondError(w, http.StatusInternalServerError, "Failed to submit prompt", err)
+	}
+}
+
+// pruneAttachments deletes uploads that were never submitted with a prompt
+func pruneAttachments(ctx context.Context, workspaceService *service.WorkspaceService) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		deleted, err := workspaceService.PruneAttachments(ctx)
+		if err != nil {
+			log.Printf("Warning: Failed to prune unattached uploads: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Pruned %d unattached uploads", deleted)
+		}
+	}
+}
+
+func storageAttachmentToResponse(a *storage.PromptAttachment) *api.PromptAttachmentResponse {
+	return &api.PromptAttachmentResponse{
+		ID:          a.ID,
+		WorkspaceID: a.WorkspaceID,
+		PromptID:    a.PromptID,
+		Name:        a.Name,
+		SizeBytes:   a.SizeBytes,
+		SHA256:      a.SHA256,
+		CreatedAt:   a.CreatedAt,
+		CleanedAt:   a.CleanedAt,
+	}
+}
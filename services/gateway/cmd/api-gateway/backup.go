@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aetherium/aetherium/services/core/pkg/service"
+)
+
+// requireAdminToken guards the admin routes with the bearer token in
+// ADMIN_TOKEN. Without one they are disabled: backups hold every secret's
+// ciphertext, and restores write environments, workers and clusters.
+func requireAdminToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				respondError(w, http.StatusServiceUnavailable, "Admin API is disabled",
+					errors.New("set ADMIN_TOKEN to enable it"))
+				return
+			}
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				respondError(w, http.StatusUnauthorized, "Invalid admin token", nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// exportBackup serves GET /admin/backup: a tar.gz archive of the control
+// plane's state (see service.BackupService)
+func (s *Server) exportBackup(w http.ResponseWriter, r *http.Request) {
+	// Built in memory so a failed export is reported as an error rather
+	// than a truncated download
+	var buf bytes.Buffer
+	manifest, err := s.backupService.Export(r.Context(), &buf)
+	if errors.Is(err, service.ErrBackupUnsupported) {
+		respondError(w, http.StatusNotImplemented, "Backups are not supported by this storage provider", nil)
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to export backup", err)
+		return
+	}
+
+	filename := fmt.Sprintf("aetherium-backup-%s.tar.gz", manifest.CreatedAt.Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("X-Aetherium-Schema-Version", fmt.Sprint(manifest.SchemaVersion))
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
+
+// importBackup serves POST /admin/restore with a backup archive as the body,
+// capped by the upload body limit
+func (s *Server) importBackup(w http.ResponseWriter, r *http.Request) {
+	result, err := s.backupService.Import(r.Context(), r.Body)
+	if errors.Is(err, service.ErrBackupUnsupported) {
+		respondError(w, http.StatusNotImplemented, "Backups are not supported by this storage provider", nil)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidBackup) {
+		respondError(w, http.StatusBadRequest, "Invalid backup archive", err)
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to restore backup", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
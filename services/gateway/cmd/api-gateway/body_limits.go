@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/config"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+)
+
+// limitBodies caps request bodies at the limit of their route group.
+// Requests declaring a larger Content-Length are rejected before their body
+// is read. Chunked bodies are streamed and cut off at the limit, failing the
+// handler's read with *http.MaxBytesError, which respondError turns into a
+// 413.
+func limitBodies(limits config.BodyLimitsConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := bodyLimit(limits, r.URL.Path)
+			if limit < 0 || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.ContentLength > limit {
+				respondBodyTooLarge(w, limit)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bodyLimit returns the body size limit of a route group
+func bodyLimit(limits config.BodyLimitsConfig, path string) int64 {
+	switch {
+	case path == "/api/v1/admin/restore",
+		strings.HasPrefix(path, "/api/v1/files"),
+		strings.HasSuffix(path, "/attachments"),
+		strings.HasPrefix(path, "/preview/"):
+		return limits.UploadBytes
+	case strings.HasPrefix(path, "/api/v1/webhooks/"):
+		return limits.WebhookBytes
+	case strings.HasSuffix(path, "/prompts"), path == "/api/v1/smart-execute":
+		return limits.PromptBytes
+	}
+	return limits.DefaultBytes
+}
+
+// respondBodyTooLarge rejects a request whose body is over limit bytes
+func respondBodyTooLarge(w http.ResponseWriter, limit int64) {
+	// The rest of the body isn't read, so don't reuse the connection
+	w.Header().Set("Connection", "close")
+	respondJSON(w, http.StatusRequestEntityTooLarge, api.ErrorResponse{
+		Error:      http.StatusText(http.StatusRequestEntityTooLarge),
+		Message:    fmt.Sprintf("Request body exceeds the %d byte limit", limit),
+		Code:       http.StatusRequestEntityTooLarge,
+		LimitBytes: limit,
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/config"
+	"github.com/aetherium/aetherium/libs/common/pkg/container"
+)
+
+// loadConfig builds the gateway configuration. AETHERIUM_CONFIG may point at
+// a YAML config file; the gateway's environment variables override it.
+func loadConfig() (*config.Config, error) {
+	var cfg *config.Config
+	if path := os.Getenv("AETHERIUM_CONFIG"); path != "" {
+		loaded, err := config.Load(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", path, err)
+		}
+		cfg = loaded
+	} else {
+		cfg = config.New()
+
+		// Without a config file, Loki and the event bus are only used when
+		// their addresses are set
+		cfg.Logging.Provider = container.ProviderNone
+		if os.Getenv("LOKI_URL") != "" {
+			cfg.Logging.Provider = "loki"
+		}
+		if os.Getenv("REDIS_ADDR") == "" && os.Getenv("EVENT_BUS_PROVIDER") == "" {
+			cfg.EventBus.Provider = container.ProviderNone
+		}
+		if provider := os.Getenv("LOG_PROVIDER"); provider != "" {
+			cfg.Logging.Provider = provider
+		}
+	}
+
+	cfg.Database.Host = getEnv("POSTGRES_HOST", cfg.Database.Host)
+	cfg.Database.Port = getEnvInt("POSTGRES_PORT", cfg.Database.Port)
+	cfg.Database.User = getEnv("POSTGRES_USER", cfg.Database.User)
+	cfg.Database.Password = getEnv("POSTGRES_PASSWORD", cfg.Database.Password)
+	cfg.Database.Database = getEnv("POSTGRES_DB", cfg.Database.Database)
+	cfg.Database.CacheTTLSeconds = getEnvInt("DB_CACHE_TTL_SECONDS", cfg.Database.CacheTTLSeconds)
+	if replicas := os.Getenv("POSTGRES_READ_REPLICAS"); replicas != "" {
+		cfg.Database.ReadReplicas = strings.Split(replicas, ",")
+	}
+	cfg.Database.MaxReplicaLagSeconds = getEnvInt("POSTGRES_MAX_REPLICA_LAG_SECONDS", cfg.Database.MaxReplicaLagSeconds)
+	if chain := os.Getenv("TRANSCRIPT_CHAIN"); chain != "" {
+		cfg.Database.TranscriptChain = chain == "true"
+	}
+
+	if origins, ok := os.LookupEnv("CORS_ALLOWED_ORIGINS"); ok {
+		cfg.Server.CORS.AllowedOrigins = splitList(origins)
+	}
+	if credentials := os.Getenv("CORS_ALLOW_CREDENTIALS"); credentials != "" {
+		cfg.Server.CORS.AllowCredentials = credentials == "true"
+	}
+	cfg.Server.BodyLimits.DefaultBytes = getEnvInt64("MAX_BODY_BYTES", cfg.Server.BodyLimits.DefaultBytes)
+	cfg.Server.BodyLimits.PromptBytes = getEnvInt64("MAX_PROMPT_BODY_BYTES", cfg.Server.BodyLimits.PromptBytes)
+	cfg.Server.BodyLimits.WebhookBytes = getEnvInt64("MAX_WEBHOOK_BODY_BYTES", cfg.Server.BodyLimits.WebhookBytes)
+	cfg.Server.BodyLimits.UploadBytes = getEnvInt64("MAX_UPLOAD_BODY_BYTES", cfg.Server.BodyLimits.UploadBytes)
+	cfg.Server.SecurityHeaders.HSTSMaxAgeSeconds = getEnvInt("HSTS_MAX_AGE_SECONDS", cfg.Server.SecurityHeaders.HSTSMaxAgeSeconds)
+	cfg.Server.SecurityHeaders.FrameOptions = getEnv("FRAME_OPTIONS", cfg.Server.SecurityHeaders.FrameOptions)
+	cfg.Server.SecurityHeaders.UIContentSecurityPolicy = getEnv("UI_CONTENT_SECURITY_POLICY", cfg.Server.SecurityHeaders.UIContentSecurityPolicy)
+
+	cfg.Logging.Loki.URL = getEnv("LOKI_URL", cfg.Logging.Loki.URL)
+	if cfg.Logging.Loki.Labels == nil {
+		cfg.Logging.Loki.Labels = map[string]string{
+			"service":   "aetherium-api",
+			"component": "api-gateway",
+		}
+	}
+
+	return cfg, nil
+}
+
+// splitList splits a comma-separated list, dropping blanks
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// syncExecDefaultTimeout and syncExecMaxTimeout bound how long a
+	// synchronous execute waits for its command
+	syncExecDefaultTimeout = 10 * time.Second
+	syncExecMaxTimeout     = 30 * time.Second
+	// syncExecGrace is how long past the command's timeout the gateway
+	// waits for the worker to respond
+	syncExecGrace = 5 * time.Second
+	// syncExecMaxBody bounds the request body of a synchronous execute
+	syncExecMaxBody = 64 << 10
+)
+
+// errWorkerUnreachable is returned when a synchronous execute never reached
+// the worker, so the command didn't run and may be queued instead
+var errWorkerUnreachable = errors.New("worker unreachable")
+
+// executeCommandSync serves POST /vms/{id}/execute-sync: runs a short
+// command on the worker running the VM and responds with its result,
+// skipping the task queue. If the worker can't be reached, the command is
+// queued as by POST /vms/{id}/execute and 202 is returned.
+func (s *Server) executeCommandSync(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid VM ID", err)
+		return
+	}
+
+	var req api.ExecuteSyncRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, syncExecMaxBody)).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if req.Command == "" {
+		respondError(w, http.StatusBadRequest, "command is required", nil)
+		return
+	}
+	timeout := syncExecDefaultTimeout
+	if req.TimeoutMS < 0 || time.Duration(req.TimeoutMS)*time.Millisecond > syncExecMaxTimeout {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("timeout_ms must be between 1 and %d", syncExecMaxTimeout.Milliseconds()), nil)
+		return
+	}
+	if req.TimeoutMS > 0 {
+		timeout = time.Duration(req.TimeoutMS) * time.Millisecond
+	}
+
+	worker, status, err := s.runningVMWorker(r.Context(), id)
+	if err == nil {
+		var resp api.ExecuteSyncResponse
+		status, err = s.workerExec(r.Context(), worker, id, &req, timeout, &resp)
+		if err == nil {
+			resp.VMID = idStr
+			respondJSON(w, http.StatusOK, resp)
+			return
+		}
+	}
+
+	// Only a command that can't have run is queued, so it never runs twice
+	if status != http.StatusServiceUnavailable && !errors.Is(err, errWorkerUnreachable) {
+		respondError(w, status, "Failed to execute command", err)
+		return
+	}
+	log.Printf("Queueing synchronous execute on VM %s: %v", idStr, err)
+
+	taskID, qerr := s.taskService.ExecuteCommandTask(r.Context(), idStr, req.Command, req.Args)
+	if qerr != nil {
+		respondError(w, taskErrorStatus(qerr), "Failed to execute command", qerr)
+		return
+	}
+	respondJSON(w, http.StatusAccepted, api.ExecuteCommandResponse{
+		TaskID:   taskID,
+		VMID:     idStr,
+		Status:   "pending",
+		Fallback: err.Error(),
+	})
+}
+
+// workerExec runs a command through the worker's POST /vms/{id}/exec. On
+// failure it also returns the status to respond with; the error wraps
+// errWorkerUnreachable if the request never reached the worker or the
+// worker doesn't serve it.
+func (s *Server) workerExec(ctx context.Context, worker *storage.Worker, id uuid.UUID, req *api.ExecuteSyncRequest, timeout time.Duration, out *api.ExecuteSyncResponse) (int, error) {
+	data, err := json.Marshal(map[string]interface{}{
+		"command":    req.Command,
+		"args":       req.Args,
+		"timeout_ms": timeout.Milliseconds(),
+	})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout+syncExecGrace)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/vms/%s/exec", worker.Address, id), bytes.NewReader(data))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+string(s.peerSecret))
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		// Only a failed dial means the command wasn't sent; after that it
+		// may be running, so it isn't queued
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return http.StatusBadGateway, fmt.Errorf("%w: %s: %v", errWorkerUnreachable, worker.ID, err)
+		}
+		if ctx.Err() != nil {
+			return http.StatusGatewayTimeout, fmt.Errorf("worker %s did not respond within %s", worker.ID, timeout+syncExecGrace)
+		}
+		return http.StatusBadGateway, fmt.Errorf("worker %s: %w", worker.ID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("worker %s returned %s: %s", worker.ID, resp.Status, strings.TrimSpace(string(msg)))
+		switch resp.StatusCode {
+		case http.StatusNotFound, http.StatusMethodNotAllowed:
+			// A worker that predates synchronous execute
+			return http.StatusBadGateway, fmt.Errorf("%w: %v", errWorkerUnreachable, err)
+		case http.StatusGatewayTimeout:
+			return http.StatusGatewayTimeout, fmt.Errorf("command did not finish within %s", timeout)
+		case http.StatusBadRequest:
+			return http.StatusBadRequest, err
+		}
+		return http.StatusBadGateway, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return http.StatusBadGateway, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/service"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// federatedHeader marks requests sent by another gateway. They are served
+// locally only, so federated clusters never forward or fan out in loops.
+const federatedHeader = "X-Aetherium-Federated"
+
+// IDs no cluster has are remembered for federationMissTTL, so repeated
+// lookups of unknown IDs don't each probe every cluster. At most
+// federationMaxMisses are kept.
+const (
+	federationMissTTL   = 30 * time.Second
+	federationMaxMisses = 10000
+)
+
+// federation routes requests to remote clusters registered in the clusters
+// table. Workspaces whose environment has a region served by a remote
+// cluster are created there; federated list requests fan out to every
+// enabled cluster; reads of workspaces and VMs unknown here are proxied to
+// the cluster that has them.
+type federation struct {
+	store    storage.Store
+	clusters *service.ClusterService // Seals and opens cluster tokens
+	region   string                  // This gateway's own region (GATEWAY_REGION)
+	client   *http.Client
+
+	mu        sync.Mutex
+	locations map[uuid.UUID]string    // Remote workspace/VM ID -> cluster name
+	misses    map[uuid.UUID]time.Time // IDs no cluster had -> when to probe again
+}
+
+func newFederation(store storage.Store, clusters *service.ClusterService, region string) *federation {
+	return &federation{
+		store:     store,
+		clusters:  clusters,
+		region:    region,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		locations: make(map[uuid.UUID]string),
+		misses:    make(map[uuid.UUID]time.Time),
+	}
+}
+
+// isLocalRegion reports whether region is served by this gateway's cluster
+func (f *federation) isLocalRegion(region string) bool {
+	return region == "" || region == f.region
+}
+
+// enabledClusters returns the enabled remote clusters
+func (f *federation) enabledClusters(ctx context.Context) ([]*storage.Cluster, error) {
+	clusters, err := f.store.Clusters().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := make([]*storage.Cluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		if cluster.Enabled {
+			enabled = append(enabled, cluster)
+		}
+	}
+	return enabled, nil
+}
+
+// clusterForRegion returns the enabled cluster serving region
+func (f *federation) clusterForRegion(ctx context.Context, region string) (*storage.Cluster, error) {
+	clusters, err := f.enabledClusters(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clusters: %w", err)
+	}
+	for _, cluster := range clusters {
+		if cluster.Region == region {
+			return cluster, nil
+		}
+	}
+	return nil, fmt.Errorf("no enabled cluster is registered for region %q", region)
+}
+
+// do sends a request to a remote cluster's gateway. path includes the
+// /api/v1 prefix and any query string.
+func (f *federation) do(ctx context.Context, cluster *storage.Cluster, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(cluster.URL, "/")+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	token, err := f.clusters.Token(cluster)
+	if err != nil {
+		return nil, fmt.Errorf("cluster %s: %w", cluster.Name, err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	origin := f.region
+	if origin == "" {
+		origin = "default"
+	}
+	req.Header.Set(federatedHeader, origin)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cluster %s: %w", cluster.Name, err)
+	}
+	return resp, nil
+}
+
+// getJSON fetches path from a remote cluster and decodes the response into v
+func (f *federation) getJSON(ctx context.Context, cluster *storage.Cluster, path string, v interface{}) error {
+	resp, err := f.do(ctx, cluster, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cluster %s: %s returned %s", cluster.Name, path, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("cluster %s: failed to decode response: %w", cluster.Name, err)
+	}
+	return nil
+}
+
+// proxy forwards r to a remote cluster and copies its response back,
+// flushing as it goes so event streams pass through
+func (f *federation) proxy(w http.ResponseWriter, r *http.Request, cluster *storage.Cluster, body io.Reader) {
+	resp, err := f.do(r.Context(), cluster, r.Method, r.URL.RequestURI(), body)
+	if err != nil {
+		respondError(w, http.StatusBadGateway, "Federated cluster unreachable", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, header := range []string{"Content-Type", "Cache-Control", "Content-Disposition", "Retry-After"} {
+		if value := resp.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+	w.Header().Set("X-Aetherium-Cluster", cluster.Name)
+	w.WriteHeader(resp.StatusCode)
+
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// fanOut fetches path from every enabled remote cluster concurrently and
+// passes each decoded body to collect, one call at a time. Clusters that
+// fail are returned as errors rather than failing the whole list.
+func (f *federation) fanOut(ctx context.Context, path string, collect func(cluster string, body json.RawMessage) error) []api.ClusterError {
+	clusters, err := f.enabledClusters(ctx)
+	if err != nil {
+		return []api.ClusterError{{Cluster: "*", Error: err.Error()}}
+	}
+
+	type result struct {
+		cluster string
+		body    json.RawMessage
+		err     error
+	}
+	results := make([]result, len(clusters))
+
+	var wg sync.WaitGroup
+	for i, cluster := range clusters {
+		wg.Add(1)
+		go func(i int, cluster *storage.Cluster) {
+			defer wg.Done()
+			results[i].cluster = cluster.Name
+			results[i].err = f.getJSON(ctx, cluster, path, &results[i].body)
+		}(i, cluster)
+	}
+	wg.Wait()
+
+	var errs []api.ClusterError
+	for _, res := range results {
+		if res.err == nil {
+			res.err = collect(res.cluster, res.body)
+		}
+		if res.err != nil {
+			errs = append(errs, api.ClusterError{Cluster: res.cluster, Error: res.err.Error()})
+		}
+	}
+	return errs
+}
+
+// locate finds the remote cluster holding a workspace or VM that is not in
+// the local store, probing each enabled cluster with GET base/{id}
+func (f *federation) locate(ctx context.Context, base string, id uuid.UUID) *storage.Cluster {
+	f.mu.Lock()
+	name, cached := f.locations[id]
+	retryAt, missed := f.misses[id]
+	f.mu.Unlock()
+
+	if missed && time.Now().Before(retryAt) {
+		return nil
+	}
+
+	if cached {
+		cluster, err := f.store.Clusters().Get(ctx, name)
+		if err == nil && cluster.Enabled {
+			return cluster
+		}
+		f.forget(id)
+	}
+
+	clusters, err := f.enabledClusters(ctx)
+	if err != nil {
+		return nil
+	}
+	answered := true
+	for _, cluster := range clusters {
+		resp, err := f.do(ctx, cluster, http.MethodGet, base+"/"+id.String(), nil)
+		if err != nil {
+			answered = false
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			f.remember(id, cluster.Name)
+			return cluster
+		}
+		if resp.StatusCode != http.StatusNotFound {
+			answered = false
+		}
+	}
+	// Only a miss every cluster confirmed is cached; one that couldn't
+	// answer may have the ID
+	if answered {
+		f.rememberMiss(id)
+	}
+	return nil
+}
+
+func (f *federation) remember(id uuid.UUID, cluster string) {
+	f.mu.Lock()
+	f.locations[id] = cluster
+	delete(f.misses, id)
+	f.mu.Unlock()
+}
+
+func (f *federation) forget(id uuid.UUID) {
+	f.mu.Lock()
+	delete(f.locations, id)
+	f.mu.Unlock()
+}
+
+// rememberMiss caches that no cluster has id, dropping expired misses when
+// the cache is full
+func (f *federation) rememberMiss(id uuid.UUID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if len(f.misses) >= federationMaxMisses {
+		for missed, retryAt := range f.misses {
+			if !now.Before(retryAt) {
+				delete(f.misses, missed)
+			}
+		}
+		if len(f.misses) >= federationMaxMisses {
+			return
+		}
+	}
+	f.misses[id] = now.Add(federationMissTTL)
+}
+
+// isFederatedRequest reports whether r came from another gateway
+func isFederatedRequest(r *http.Request) bool {
+	return r.Header.Get(federatedHeader) != ""
+}
+
+// wantsFederatedList reports whether a list request should fan out to the
+// remote clusters (?federated=true, and not itself sent by a gateway)
+func wantsFederatedList(r *http.Request) bool {
+	return r.URL.Query().Get("federated") == "true" && !isFederatedRequest(r)
+}
+
+// localListPath is the path sent to remote clusters for a federated list:
+// the request's own path and query without the federated flag
+func localListPath(r *http.Request) string {
+	query := r.URL.Query()
+	query.Del("federated")
+	if encoded := query.Encode(); encoded != "" {
+		return r.URL.Path + "?" + encoded
+	}
+	return r.URL.Path
+}
+
+// remoteResource proxies requests for a workspace or VM ({id}) that is not
+// in the local store to the federated cluster that has it. base is the
+// resource's collection path on the remote gateway, e.g. /api/v1/workspaces.
+func (s *Server) remoteResource(base string, exists func(ctx context.Context, id uuid.UUID) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, err := uuid.Parse(chi.URLParam(r, "id"))
+			if err != nil || isFederatedRequest(r) || exists(r.Context(), id) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cluster := s.federation.locate(r.Context(), base, id)
+			if cluster == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.Method == http.MethodDelete && r.URL.Path == base+"/"+id.String() {
+				s.federation.forget(id)
+			}
+			s.federation.proxy(w, r, cluster, r.Body)
+		})
+	}
+}
+
+func (s *Server) localWorkspaceExists(ctx context.Context, id uuid.UUID) bool {
+	_, err := s.store.Workspaces().Get(ctx, id)
+	return err == nil
+}
+
+func (s *Server) localVMExists(ctx context.Context, id uuid.UUID) bool {
+	_, err := s.store.VMs().Get(ctx, id)
+	return err == nil
+}
+
+// createRemoteWorkspace creates a workspace in the federated cluster serving
+// the environment's region. The remote cluster resolves the environment by
+// name, so it must have an environment of the same name.
+func (s *Server) createRemoteWorkspace(w http.ResponseWriter, r *http.Request, req *api.CreateWorkspaceRequest, env *storage.Environment) {
+	cluster, err := s.federation.clusterForRegion(r.Context(), env.Region)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Environment region is not served by any cluster", err)
+		return
+	}
+
+	var remoteEnvs api.ListEnvironmentsResponse
+	if err := s.federation.getJSON(r.Context(), cluster, "/api/v1/environments", &remoteEnvs); err != nil {
+		respondError(w, http.StatusBadGateway, "Federated cluster unreachable", err)
+		return
+	}
+	var remoteEnv *api.EnvironmentResponse
+	for _, candidate := range remoteEnvs.Environments {
+		if candidate.Name == env.Name {
+			remoteEnv = candidate
+			break
+		}
+	}
+	if remoteEnv == nil {
+		respondError(w, http.StatusBadRequest, "Environment not found in federated cluster",
+			fmt.Errorf("cluster %s has no environment named %q", cluster.Name, env.Name))
+		return
+	}
+
+	forwarded := *req
+	forwarded.EnvironmentID = remoteEnv.ID.String()
+	body, err := json.Marshal(&forwarded)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to encode request", err)
+		return
+	}
+
+	s.federation.proxy(w, r, cluster, bytes.NewReader(body))
+}
+
+// Cluster management handlers
+
+func (s *Server) listClusters(w http.ResponseWriter, r *http.Request) {
+	clusters, err := s.store.Clusters().List(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list clusters", err)
+		return
+	}
+
+	responses := make([]*api.ClusterResponse, len(clusters))
+	for i, cluster := range clusters {
+		responses[i] = storageClusterToResponse(cluster)
+	}
+
+	respondJSON(w, http.StatusOK, api.ListClustersResponse{
+		LocalRegion: s.federation.region,
+		Clusters:    responses,
+		Total:       len(responses),
+	})
+}
+
+func (s *Server) getCluster(w http.ResponseWriter, r *http.Request) {
+	cluster, err := s.store.Clusters().Get(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Cluster not found", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, storageClusterToResponse(cluster))
+}
+
+func (s *Server) putCluster(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	var req api.ClusterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	if req.Region == "" {
+		respondError(w, http.StatusBadRequest, "Region is required", nil)
+		return
+	}
+	if s.federation.isLocalRegion(req.Region) {
+		respondError(w, http.StatusBadRequest, "Invalid region",
+			fmt.Errorf("region %q is this gateway's own region", req.Region))
+		return
+	}
+	parsed, err := url.Parse(req.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		respondError(w, http.StatusBadRequest, "Invalid URL", fmt.Errorf("url must be an http(s) URL, got %q", req.URL))
+		return
+	}
+
+	cluster := &storage.Cluster{
+		Name:    name,
+		Region:  req.Region,
+		URL:     req.URL,
+		Enabled: true,
+	}
+	if req.Enabled != nil {
+		cluster.Enabled = *req.Enabled
+	}
+	if req.Token == "" {
+		// Keep the existing token when updating without one
+		if existing, err := s.store.Clusters().Get(r.Context(), name); err == nil {
+			cluster.EncryptedToken = existing.EncryptedToken
+			cluster.TokenNonce = existing.TokenNonce
+		}
+	}
+
+	err = s.federation.clusters.Save(r.Context(), cluster, req.Token)
+	if errors.Is(err, service.ErrNoClusterKey) {
+		respondError(w, http.StatusServiceUnavailable, "Cluster tokens are disabled", err)
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save cluster", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, storageClusterToResponse(cluster))
+}
+
+func (s *Server) deleteCluster(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.Clusters().Delete(r.Context(), chi.URLParam(r, "name")); err != nil {
+		respondError(w, http.StatusNotFound, "Cluster not found", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func storageClusterToResponse(cluster *storage.Cluster) *api.ClusterResponse {
+	return &api.ClusterResponse{
+		Name:      cluster.Name,
+		Region:    cluster.Region,
+		URL:       cluster.URL,
+		HasToken:  len(cluster.EncryptedToken) > 0,
+		Enabled:   cluster.Enabled,
+		CreatedAt: cluster.CreatedAt,
+		UpdatedAt: cluster.UpdatedAt,
+	}
+}
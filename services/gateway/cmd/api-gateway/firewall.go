@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/network"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// getEnvironmentFirewall serves GET /environments/{id}/firewall
+func (s *Server) getEnvironmentFirewall(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
+		return
+	}
+
+	env, err := s.store.Environments().Get(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Environment not found", err)
+		return
+	}
+	if env.Firewall == nil {
+		respondError(w, http.StatusNotFound, "Environment has no firewall", nil)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, env.Firewall)
+}
+
+// putEnvironmentFirewall replaces an environment's firewall policy. It is
+// programmed on the TAP devices of VMs spawned from the environment
+// afterwards; running VMs keep their rules.
+func (s *Server) putEnvironmentFirewall(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
+		return
+	}
+
+	var policy types.FirewallPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if policy.DefaultEgress == "" {
+		policy.DefaultEgress = types.FirewallAllow
+	}
+	if policy.DefaultIngress == "" {
+		policy.DefaultIngress = types.FirewallAllow
+	}
+	if policy.Rules == nil {
+		policy.Rules = []types.FirewallRule{}
+	}
+	if err := network.ValidateFirewall(&policy); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid firewall policy", err)
+		return
+	}
+
+	if err := s.store.Environments().SetFirewall(r.Context(), id, &policy); err != nil {
+		respondError(w, http.StatusNotFound, "Environment not found", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, policy)
+}
+
+// deleteEnvironmentFirewall removes an environment's firewall policy
+func (s *Server) deleteEnvironmentFirewall(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
+		return
+	}
+
+	if err := s.store.Environments().SetFirewall(r.Context(), id, nil); err != nil {
+		respondError(w, http.StatusNotFound, "Environment not found", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/service"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+	"github.com/aetherium/aetherium/services/gateway/pkg/integrations"
+	githubIntegration "github.com/aetherium/aetherium/services/gateway/pkg/integrations/github"
+	"github.com/aetherium/aetherium/services/gateway/pkg/integrations/slack"
+	"github.com/go-chi/chi/v5"
+)
+
+// integrationTypes build the integrations that can be configured at runtime
+var integrationTypes = map[string]func() integrations.Integration{
+	"github": func() integrations.Integration { return githubIntegration.NewGitHubIntegration() },
+	"slack":  func() integrations.Integration { return slack.NewSlackIntegration() },
+}
+
+var integrationNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// runtimeIntegrations runs the integrations configured through the API. A
+// config named like an integration set by the environment replaces it.
+// Configs are synced at startup, on every change through this gateway and
+// periodically, to pick up changes made through other replicas.
+type runtimeIntegrations struct {
+	registry *integrations.Registry
+	service  *service.IntegrationService
+
+	mu      sync.Mutex
+	applied map[string]time.Time // Config name -> UpdatedAt of the config applied
+	errors  map[string]string    // Config name -> why its integration isn't running
+}
+
+func newRuntimeIntegrations(registry *integrations.Registry, svc *service.IntegrationService) *runtimeIntegrations {
+	return &runtimeIntegrations{
+		registry: registry,
+		service:  svc,
+		applied:  make(map[string]time.Time),
+		errors:   make(map[string]string),
+	}
+}
+
+// sync applies configs changed since the last sync and stops the
+// integrations of deleted ones
+func (ri *runtimeIntegrations) sync(ctx context.Context) error {
+	configs, err := ri.service.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+
+	current := make(map[string]bool, len(configs))
+	for _, config := range configs {
+		current[config.Name] = true
+		if applied, ok := ri.applied[config.Name]; ok && applied.Equal(config.UpdatedAt) {
+			continue
+		}
+		ri.apply(ctx, config)
+	}
+	for name := range ri.applied {
+		if !current[name] {
+			ri.remove(name)
+		}
+	}
+	return nil
+}
+
+// watch syncs configs every interval until ctx is cancelled
+func (ri *runtimeIntegrations) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ri.sync(ctx); err != nil {
+				log.Printf("Warning: Failed to sync integration configs: %v", err)
+			}
+		}
+	}
+}
+
+// apply starts or restarts the integration of a config, or stops it when
+// disabled. A config that fails to start leaves the running integration in
+// place. Callers hold ri.mu.
+func (ri *runtimeIntegrations) apply(ctx context.Context, config *storage.IntegrationConfig) {
+	ri.applied[config.Name] = config.UpdatedAt
+	delete(ri.errors, config.Name)
+
+	if !config.Enabled {
+		ri.stop(config.Name)
+		return
+	}
+	integration, err := ri.build(ctx, config)
+	if err != nil {
+		ri.errors[config.Name] = err.Error()
+		log.Printf("Warning: Failed to start integration %s: %v", config.Name, err)
+		return
+	}
+	ri.start(config.Name, integration)
+}
+
+// build initializes a config's integration
+func (ri *runtimeIntegrations) build(ctx context.Context, config *storage.IntegrationConfig) (integrations.Integration, error) {
+	newIntegration, ok := integrationTypes[config.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown integration type %q", config.Type)
+	}
+	options, err := ri.service.Options(config)
+	if err != nil {
+		return nil, err
+	}
+	integration := newIntegration()
+	if err := integration.Initialize(ctx, integrations.Config{Options: options}); err != nil {
+		integration.Close()
+		return nil, err
+	}
+	return integration, nil
+}
+
+// start registers an integration, closing the one it replaces
+func (ri *runtimeIntegrations) start(name string, integration integrations.Integration) {
+	if previous := ri.registry.Replace(name, integration); previous != nil {
+		previous.Close()
+		log.Printf("Integration %s reconfigured", name)
+		return
+	}
+	log.Printf("Integration %s started", name)
+}
+
+// stop unregisters and closes an integration, if running
+func (ri *runtimeIntegrations) stop(name string) {
+	integration, err := ri.registry.Get(name)
+	if err != nil {
+		return
+	}
+	ri.registry.Unregister(name)
+	integration.Close()
+	log.Printf("Integration %s stopped", name)
+}
+
+// remove stops the integration of a deleted config and forgets it
+func (ri *runtimeIntegrations) remove(name string) {
+	ri.stop(name)
+	delete(ri.applied, name)
+	delete(ri.errors, name)
+}
+
+// saved applies a config saved through this gateway, with its integration
+// already initialized when enabled
+func (ri *runtimeIntegrations) saved(config *storage.IntegrationConfig, integration integrations.Integration) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+
+	ri.applied[config.Name] = config.UpdatedAt
+	delete(ri.errors, config.Name)
+	if integration == nil {
+		ri.stop(config.Name)
+		return
+	}
+	ri.start(config.Name, integration)
+}
+
+// deleted stops the integration of a config deleted through this gateway
+func (ri *runtimeIntegrations) deleted(name string) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+
+	ri.remove(name)
+}
+
+// status returns why a config's integration isn't running, if it failed to start
+func (ri *runtimeIntegrations) status(name string) string {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+
+	return ri.errors[name]
+}
+
+func (s *Server) listIntegrations(w http.ResponseWriter, r *http.Request) {
+	configs, err := s.integrationSync.service.List(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list integrations", err)
+		return
+	}
+
+	responses := make([]*api.IntegrationResponse, 0, len(configs))
+	configured := make(map[string]bool, len(configs))
+	for _, config := range configs {
+		configured[config.Name] = true
+		responses = append(responses, s.integrationConfigToResponse(config))
+	}
+	// Integrations set by the environment and not replaced by a config
+	for _, name := range s.integrations.List() {
+		if configured[name] {
+			continue
+		}
+		integration, err := s.integrations.Get(name)
+		if err != nil {
+			continue
+		}
+		responses = append(responses, &api.IntegrationResponse{
+			Name:    name,
+			Type:    integration.Name(),
+			Source:  "env",
+			Enabled: true,
+			Running: true,
+		})
+	}
+	sort.Slice(responses, func(i, j int) bool { return responses[i].Name < responses[j].Name })
+
+	respondJSON(w, http.StatusOK, api.ListIntegrationsResponse{
+		Integrations: responses,
+		Total:        len(responses),
+	})
+}
+
+func (s *Server) getIntegration(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	config, err := s.integrationSync.service.Get(r.Context(), name)
+	if err == nil {
+		respondJSON(w, http.StatusOK, s.integrationConfigToResponse(config))
+		return
+	}
+	if integration, err := s.integrations.Get(name); err == nil {
+		respondJSON(w, http.StatusOK, &api.IntegrationResponse{
+			Name:    name,
+			Type:    integration.Name(),
+			Source:  "env",
+			Enabled: true,
+			Running: true,
+		})
+		return
+	}
+	respondError(w, http.StatusNotFound, "Integration not found", err)
+}
+
+// putIntegration creates or reconfigures an integration. The integration is
+// initialized before the config is saved, so invalid options are rejected
+// and leave the running integration untouched.
+func (s *Server) putIntegration(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if !integrationNamePattern.MatchString(name) {
+		respondError(w, http.StatusBadRequest, "Invalid integration name",
+			fmt.Errorf("name must be 1-63 lowercase letters, digits, '-' or '_'"))
+		return
+	}
+
+	var req api.IntegrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	svc := s.integrationSync.service
+	integrationType := req.Type
+	enabled := true
+	options := make(map[string]interface{})
+	if existing, err := svc.Get(r.Context(), name); err == nil {
+		if integrationType == "" {
+			integrationType = existing.Type
+		}
+		enabled = existing.Enabled
+		// Options of another type don't carry over
+		if integrationType == existing.Type {
+			options, err = svc.Options(existing)
+			if err != nil {
+				respondError(w, http.StatusInternalServerError, "Failed to read integration options", err)
+				return
+			}
+		}
+	}
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	for key, value := range req.Options {
+		if value == nil || value == "" {
+			delete(options, key)
+			continue
+		}
+		options[key] = value
+	}
+
+	newIntegration, ok := integrationTypes[integrationType]
+	if !ok {
+		respondError(w, http.StatusBadRequest, "Invalid integration type",
+			fmt.Errorf("type must be github or slack, got %q", integrationType))
+		return
+	}
+	var integration integrations.Integration
+	if enabled {
+		integration = newIntegration()
+		if err := integration.Initialize(r.Context(), integrations.Config{Options: options}); err != nil {
+			integration.Close()
+			respondError(w, http.StatusBadRequest, "Invalid integration options", err)
+			return
+		}
+	}
+
+	config, err := svc.Save(r.Context(), name, integrationType, enabled, options)
+	if err != nil && integration != nil {
+		// Never registered, so nothing else stops it
+		integration.Close()
+	}
+	if errors.Is(err, service.ErrNoEncryptionKey) {
+		respondError(w, http.StatusServiceUnavailable, "Integration configs are disabled", err)
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save integration", err)
+		return
+	}
+	s.integrationSync.saved(config, integration)
+
+	respondJSON(w, http.StatusOK, s.integrationConfigToResponse(config))
+}
+
+// deleteIntegration removes an integration config and stops its integration.
+// An integration it replaced from the environment returns on restart.
+func (s *Server) deleteIntegration(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := s.integrationSync.service.Delete(r.Context(), name); err != nil {
+		respondError(w, http.StatusNotFound, "Integration not found", err)
+		return
+	}
+	s.integrationSync.deleted(name)
+
+	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func (s *Server) integrationConfigToResponse(config *storage.IntegrationConfig) *api.IntegrationResponse {
+	response := &api.IntegrationResponse{
+		Name:      config.Name,
+		Type:      config.Type,
+		Source:    "api",
+		Enabled:   config.Enabled,
+		Error:     s.integrationSync.status(config.Name),
+		CreatedAt: &config.CreatedAt,
+		UpdatedAt: &config.UpdatedAt,
+	}
+	if _, err := s.integrations.Get(config.Name); err == nil {
+		response.Running = true
+	}
+	if options, err := s.integrationSync.service.Options(config); err == nil {
+		for key := range options {
+			response.Options = append(response.Options, key)
+		}
+		sort.Strings(response.Options)
+	} else if response.Error == "" {
+		response.Error = err.Error()
+	}
+	return response
+}
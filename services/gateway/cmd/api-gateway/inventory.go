@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aetherium/aetherium/services/core/pkg/service"
+)
+
+// defaultVMExporterPort is where VM exporters listen unless the scrape
+// asks for another port (node_exporter's)
+const defaultVMExporterPort = 9100
+
+// getInventory serves GET /inventory: the cluster's workers and VMs
+func (s *Server) getInventory(w http.ResponseWriter, r *http.Request) {
+	inv, err := s.inventoryService.Snapshot(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get inventory", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, inv)
+}
+
+// getPrometheusTargets serves GET /inventory/prometheus in the Prometheus
+// http_sd format: running VMs (kind=vms, the default) scraped on port
+// through their worker, or the workers themselves (kind=workers)
+func (s *Server) getPrometheusTargets(w http.ResponseWriter, r *http.Request) {
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && kind != "vms" && kind != "workers" {
+		respondError(w, http.StatusBadRequest, "Invalid kind", fmt.Errorf("kind must be vms or workers"))
+		return
+	}
+	port := defaultVMExporterPort
+	if value := r.URL.Query().Get("port"); value != "" {
+		p, err := strconv.Atoi(value)
+		if err != nil || p < 1 || p > 65535 {
+			respondError(w, http.StatusBadRequest, "Invalid port", err)
+			return
+		}
+		port = p
+	}
+
+	inv, err := s.inventoryService.Snapshot(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get inventory", err)
+		return
+	}
+
+	if kind == "workers" {
+		respondJSON(w, http.StatusOK, service.PrometheusWorkerTargets(inv))
+		return
+	}
+	respondJSON(w, http.StatusOK, service.PrometheusVMTargets(inv, port))
+}
+
+// inventoryWebhook pushes the inventory to an external CMDB
+type inventoryWebhook struct {
+	url    string
+	secret []byte // Signs each push when set
+	client *http.Client
+}
+
+// pushInventory posts the inventory to the webhook every interval until ctx
+// is done. Failed pushes are logged and retried at the next interval.
+func pushInventory(ctx context.Context, inventory *service.InventoryService, hook *inventoryWebhook, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := hook.push(ctx, inventory); err != nil {
+			log.Printf("Warning: Failed to push inventory to %s: %v", hook.url, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// push posts one inventory snapshot. With a secret, the body's HMAC-SHA256
+// is sent as "sha256=<hex>" in X-Aetherium-Signature, like GitHub webhooks.
+func (h *inventoryWebhook) push(ctx context.Context, inventory *service.InventoryService) error {
+	inv, err := inventory.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(inv)
+	if err != nil {
+		return fmt.Errorf("failed to encode inventory: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Aetherium-Event", "inventory")
+	if len(h.secret) > 0 {
+		mac := hmac.New(sha256.New, h.secret)
+		mac.Write(body)
+		req.Header.Set("X-Aetherium-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
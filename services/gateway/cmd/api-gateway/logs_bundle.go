@@ -0,0 +1,361 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/logging"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Logs bundle settings
+const (
+	bundleVMLogsTimeout  = 30 * time.Second
+	bundleWorkerLogLimit = 5000
+	bundleEventLimit     = 1000
+)
+
+// bundleVMLogs are collected by running a command in the workspace's VM.
+// The agent runs as a systemd unit in the Firecracker rootfs; other
+// backends fall back to the plain log files.
+var bundleVMLogs = []struct {
+	file   string
+	script string
+}{
+	{"vm/console.log", "dmesg 2>/dev/null || journalctl -k -b --no-pager"},
+	{"vm/agent.log", "journalctl -u fc-agent -b --no-pager 2>/dev/null || cat /var/log/fc-agent.log"},
+}
+
+// logsBundle is the content of a logs bundle, gathered before anything is
+// written so that failures can still be reported as JSON errors
+type logsBundle struct {
+	workspace *storage.Workspace
+	since     time.Time
+	until     time.Time
+	promptID  *uuid.UUID
+	files     []bundleFile
+}
+
+type bundleFile struct {
+	name string
+	data []byte
+}
+
+func (b *logsBundle) add(name string, data []byte) {
+	b.files = append(b.files, bundleFile{name: name, data: data})
+}
+
+func (b *logsBundle) addJSON(name string, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		data = []byte(fmt.Sprintf("failed to encode %s: %v\n", name, err))
+	}
+	b.add(name, data)
+}
+
+// getWorkspaceLogsBundle serves a zip of a workspace's logs for a time range:
+// prompt outputs, prep step logs, the VM's console and agent logs, cluster
+// events and worker logs from Loki. With prompt_id it is limited to that
+// prompt and, unless since/until are given, to the time it ran.
+func (s *Server) getWorkspaceLogsBundle(w http.ResponseWriter, r *http.Request) {
+	workspaceID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		return
+	}
+
+	workspace, err := s.workspaceService.GetWorkspace(r.Context(), workspaceID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", err)
+		return
+	}
+
+	bundle := &logsBundle{
+		workspace: workspace,
+		since:     workspace.CreatedAt,
+		until:     time.Now(),
+	}
+
+	var prompts []*storage.PromptTask
+	if value := r.URL.Query().Get("prompt_id"); value != "" {
+		promptID, err := uuid.Parse(value)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid prompt ID", err)
+			return
+		}
+		prompt, err := s.workspaceService.GetPrompt(r.Context(), promptID)
+		if err != nil || prompt.WorkspaceID != workspaceID {
+			respondError(w, http.StatusNotFound, "Prompt not found", err)
+			return
+		}
+
+		bundle.promptID = &promptID
+		bundle.since = prompt.CreatedAt
+		if prompt.CompletedAt != nil {
+			bundle.until = *prompt.CompletedAt
+		}
+		prompts = []*storage.PromptTask{prompt}
+	}
+
+	for key, bound := range map[string]*time.Time{"since": &bundle.since, "until": &bundle.until} {
+		if value := r.URL.Query().Get(key); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s (expected RFC3339)", key), err)
+				return
+			}
+			*bound = t
+		}
+	}
+	if bundle.until.Before(bundle.since) {
+		respondError(w, http.StatusBadRequest, "until must not be before since", nil)
+		return
+	}
+
+	if bundle.promptID == nil {
+		prompts, err = s.workspaceService.ListPrompts(r.Context(), workspaceID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to list prompts", err)
+			return
+		}
+	}
+
+	steps, err := s.workspaceService.GetPrepSteps(r.Context(), workspaceID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get prep steps", err)
+		return
+	}
+
+	bundle.addJSON("workspace.json", storageWorkspaceToResponse(workspace))
+	bundle.addPrompts(prompts)
+	bundle.addPrepSteps(steps)
+	s.addBundleEvents(r.Context(), bundle)
+	s.addBundleWorkerLogs(r.Context(), bundle)
+	s.addBundleVMLogs(r.Context(), bundle)
+
+	filename := fmt.Sprintf("workspace-%s-logs.zip", workspace.Name)
+	if bundle.promptID != nil {
+		filename = fmt.Sprintf("workspace-%s-prompt-%s-logs.zip", workspace.Name, bundle.promptID)
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+	for _, file := range bundle.files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: bundle.until,
+		})
+		if err != nil {
+			log.Printf("Warning: Failed to write %s to logs bundle: %v", file.name, err)
+			return
+		}
+		if _, err := fw.Write(file.data); err != nil {
+			log.Printf("Warning: Failed to write %s to logs bundle: %v", file.name, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("Warning: Failed to finish logs bundle for workspace %s: %v", workspaceID, err)
+	}
+}
+
+// addPrompts adds the prompts created in the bundle's time range, each as its
+// details and its stdout and stderr
+func (b *logsBundle) addPrompts(prompts []*storage.PromptTask) {
+	for _, prompt := range prompts {
+		if b.promptID == nil && (prompt.CreatedAt.Before(b.since) || prompt.CreatedAt.After(b.until)) {
+			continue
+		}
+
+		dir := fmt.Sprintf("prompts/%s-%s", prompt.CreatedAt.UTC().Format("20060102T150405Z"), prompt.ID)
+		resp := storagePromptToResponse(prompt)
+		resp.Stdout, resp.Stderr = nil, nil
+		b.addJSON(dir+"/prompt.json", resp)
+		if prompt.Stdout != nil {
+			b.add(dir+"/stdout.log", []byte(*prompt.Stdout))
+		}
+		if prompt.Stderr != nil {
+			b.add(dir+"/stderr.log", []byte(*prompt.Stderr))
+		}
+	}
+}
+
+// addPrepSteps adds a log per preparation step with its status and output
+func (b *logsBundle) addPrepSteps(steps []*storage.PrepStep) {
+	for _, step := range steps {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "step:    %s (#%d)\n", step.StepType, step.StepOrder)
+		fmt.Fprintf(&sb, "status:  %s\n", step.Status)
+		if step.ExitCode != nil {
+			fmt.Fprintf(&sb, "exit:    %d\n", *step.ExitCode)
+		}
+		if step.DurationMS != nil {
+			fmt.Fprintf(&sb, "took:    %dms\n", *step.DurationMS)
+		}
+		if step.Error != nil {
+			fmt.Fprintf(&sb, "error:   %s\n", *step.Error)
+		}
+		if step.Stdout != nil {
+			fmt.Fprintf(&sb, "\n--- stdout ---\n%s\n", *step.Stdout)
+		}
+		if step.Stderr != nil {
+			fmt.Fprintf(&sb, "\n--- stderr ---\n%s\n", *step.Stderr)
+		}
+		b.add(fmt.Sprintf("prep_steps/%02d-%s.log", step.StepOrder, step.StepType), []byte(sb.String()))
+	}
+}
+
+// addBundleEvents adds the cluster events of the workspace and its VM
+func (s *Server) addBundleEvents(ctx context.Context, b *logsBundle) {
+	resources := map[string]string{"workspace": b.workspace.ID.String()}
+	if b.workspace.VMID != nil {
+		resources["vm"] = b.workspace.VMID.String()
+	}
+
+	var clusterEvents []*storage.ClusterEvent
+	for resourceType, resourceID := range resources {
+		list, err := s.store.ClusterEvents().List(ctx, map[string]interface{}{
+			"resource_type": resourceType,
+			"resource_id":   resourceID,
+			"since":         b.since,
+			"until":         b.until,
+			"limit":         bundleEventLimit,
+		})
+		if err != nil {
+			b.add("events.error.txt", []byte(fmt.Sprintf("failed to list %s events: %v\n", resourceType, err)))
+			return
+		}
+		clusterEvents = append(clusterEvents, list...)
+	}
+
+	sort.Slice(clusterEvents, func(i, j int) bool {
+		return clusterEvents[i].CreatedAt.Before(clusterEvents[j].CreatedAt)
+	})
+	b.addJSON("events.json", clusterEvents)
+}
+
+// addBundleWorkerLogs adds the worker logs shipped to Loki for the workspace
+func (s *Server) addBundleWorkerLogs(ctx context.Context, b *logsBundle) {
+	if s.logger == nil {
+		b.add("worker.log", []byte("worker logs unavailable: logging is not configured\n"))
+		return
+	}
+
+	start, end := b.since.UnixNano(), b.until.UnixNano()
+	entries, err := s.logger.Query(ctx, &logging.Query{
+		Labels:    map[string]string{"workspace_id": b.workspace.ID.String()},
+		StartTime: &start,
+		EndTime:   &end,
+		Limit:     bundleWorkerLogLimit,
+	})
+	if err != nil {
+		b.add("worker.log", []byte(fmt.Sprintf("worker logs unavailable: %v\n", err)))
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	var sb strings.Builder
+	for _, entry := range entries {
+		if b.promptID != nil {
+			if promptID, ok := entry.Fields["prompt_id"].(string); ok && promptID != b.promptID.String() {
+				continue
+			}
+		}
+		fmt.Fprintf(&sb, "%s %-5s %s", entry.Timestamp.UTC().Format(time.RFC3339Nano), entry.Level, entry.Message)
+		if len(entry.Fields) > 0 {
+			if fields, err := json.Marshal(entry.Fields); err == nil {
+				fmt.Fprintf(&sb, " %s", fields)
+			}
+		}
+		sb.WriteString("\n")
+	}
+	b.add("worker.log", []byte(sb.String()))
+}
+
+// addBundleVMLogs runs commands in the workspace's VM to collect its console
+// and agent logs, waiting up to bundleVMLogsTimeout for them
+func (s *Server) addBundleVMLogs(ctx context.Context, b *logsBundle) {
+	if b.workspace.VMID == nil {
+		for _, vmLog := range bundleVMLogs {
+			b.add(vmLog.file, []byte("unavailable: the workspace has no VM\n"))
+		}
+		return
+	}
+	vmID := b.workspace.VMID.String()
+
+	taskIDs := make([]uuid.UUID, len(bundleVMLogs))
+	for i, vmLog := range bundleVMLogs {
+		taskID, err := s.taskService.ExecuteCommandTask(ctx, vmID, "bash", []string{"-c", vmLog.script})
+		if err != nil {
+			log.Printf("Warning: Failed to collect %s from VM %s: %v", vmLog.file, vmID, err)
+		}
+		taskIDs[i] = taskID
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, bundleVMLogsTimeout)
+	defer cancel()
+
+	executions := make([]*storage.Execution, len(bundleVMLogs))
+	collect := func() bool {
+		done := true
+		for i, taskID := range taskIDs {
+			if taskID == uuid.Nil || executions[i] != nil {
+				continue
+			}
+			if execution, err := s.taskService.GetExecutionByTask(ctx, taskID); err == nil {
+				executions[i] = execution
+			} else {
+				done = false
+			}
+		}
+		return done
+	}
+
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+wait:
+	for !collect() {
+		select {
+		case <-ctx.Done():
+			break wait
+		case <-ticker.C:
+		}
+	}
+
+	for i, vmLog := range bundleVMLogs {
+		execution := executions[i]
+		switch {
+		case taskIDs[i] == uuid.Nil:
+			b.add(vmLog.file, []byte("unavailable: failed to run the collection command\n"))
+		case execution == nil:
+			b.add(vmLog.file, []byte(fmt.Sprintf("unavailable: the VM did not respond within %v\n", bundleVMLogsTimeout)))
+		default:
+			var sb strings.Builder
+			if execution.Stdout != nil {
+				sb.WriteString(*execution.Stdout)
+			}
+			if execution.Stderr != nil && *execution.Stderr != "" {
+				fmt.Fprintf(&sb, "\n--- stderr ---\n%s", *execution.Stderr)
+			}
+			if execution.Error != nil {
+				fmt.Fprintf(&sb, "\n--- error ---\n%s\n", *execution.Error)
+			}
+			b.add(vmLog.file, []byte(sb.String()))
+		}
+	}
+}
@@ -3,27 +3,39 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/aetherium/aetherium/libs/common/pkg/container"
+	"github.com/aetherium/aetherium/libs/common/pkg/container/factories"
+	"github.com/aetherium/aetherium/libs/common/pkg/diagnostics"
 	"github.com/aetherium/aetherium/services/gateway/pkg/api"
 	"github.com/aetherium/aetherium/services/gateway/pkg/discovery"
 	"github.com/aetherium/aetherium/services/gateway/pkg/discovery/consul"
-	"github.com/aetherium/aetherium/libs/common/pkg/events/redis"
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
+	"github.com/aetherium/aetherium/libs/common/pkg/health"
 	"github.com/aetherium/aetherium/services/gateway/pkg/integrations"
 	githubIntegration "github.com/aetherium/aetherium/services/gateway/pkg/integrations/github"
 	"github.com/aetherium/aetherium/services/gateway/pkg/integrations/slack"
-	"github.com/aetherium/aetherium/libs/common/pkg/logging/loki"
-	"github.com/aetherium/aetherium/services/core/pkg/queue/asynq"
+	"github.com/aetherium/aetherium/services/gateway/pkg/websocket"
+	"github.com/aetherium/aetherium/libs/common/pkg/logging"
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/queue"
+	"github.com/aetherium/aetherium/services/core/pkg/redact"
+	"github.com/aetherium/aetherium/services/core/pkg/scheduler"
 	"github.com/aetherium/aetherium/services/core/pkg/service"
 	"github.com/aetherium/aetherium/services/core/pkg/storage"
-	"github.com/aetherium/aetherium/services/core/pkg/storage/postgres"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
@@ -31,73 +43,70 @@ import (
 )
 
 type Server struct {
-	store            *postgres.Store
+	store            storage.Store
 	taskService      *service.TaskService
 	workerService    *service.WorkerService
 	workspaceService *service.WorkspaceService
+	capacityService  *service.CapacityService
+	envService       *service.EnvironmentService
+	backupService    *service.BackupService
+	inventoryService *service.InventoryService
+	sloService       *service.SLOService
+	transcripts      *service.TranscriptService
+	sessionManager   *websocket.SessionManager
+	taskStreamer     *websocket.TaskStreamer
 	integrations     *integrations.Registry
-	logger           *loki.LokiLogger
-	eventBus         *redis.RedisEventBus
+	integrationSync  *runtimeIntegrations // Integrations configured through the API
+	federation       *federation
+	previewSecret    []byte // PREVIEW_SECRET: signs preview URLs
+	peerSecret       []byte // WORKER_PEER_SECRET: authenticates the gateway to workers
+	adminToken       string // ADMIN_TOKEN: bearer token for the admin routes; unset disables them
+	uiCSP            string // Content-Security-Policy of the web UI
+	logger           logging.Logger
+	eventBus         events.EventBus
+
+	// How long smart execute waits for the VMs it creates
+	vmWaitTimeout time.Duration
+
+	// Closed on SIGTERM: readiness fails and streams tell clients to reconnect
+	drainCh   chan struct{}
+	drainOnce sync.Once
 }
 
+// Build information, set via -ldflags "-X main.version=... -X main.commit=..."
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
 func main() {
-	log.Println("Aetherium API Gateway starting...")
-
-	// Initialize PostgreSQL store
-	store, err := postgres.NewStore(postgres.Config{
-		Host:         getEnv("POSTGRES_HOST", "localhost"),
-		Port:         getEnvInt("POSTGRES_PORT", 5432),
-		User:         getEnv("POSTGRES_USER", "aetherium"),
-		Password:     getEnv("POSTGRES_PASSWORD", "aetherium"),
-		Database:     getEnv("POSTGRES_DB", "aetherium"),
-		SSLMode:      "disable",
-		MaxOpenConns: 25,
-		MaxIdleConns: 5,
-	})
-	if err != nil {
-		log.Fatalf("Failed to initialize store: %v", err)
-	}
-	defer store.Close()
+	log.Printf("Aetherium API Gateway starting (version=%s, commit=%s, task payload versions %d-%d)...",
+		version, commit, queue.MinPayloadVersion, queue.PayloadVersion)
 
-	// Initialize Redis queue
-	queue, err := asynq.NewQueue(asynq.Config{
-		RedisAddr: getEnv("REDIS_ADDR", "localhost:6379"),
-	})
+	cfg, err := loadConfig()
 	if err != nil {
-		log.Fatalf("Failed to initialize queue: %v", err)
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Initialize Loki logger (optional)
-	var logger *loki.LokiLogger
-	if lokiURL := getEnv("LOKI_URL", ""); lokiURL != "" {
-		logger, err = loki.NewLokiLogger(&loki.Config{
-			URL:           lokiURL,
-			BatchSize:     100,
-			BatchInterval: 5 * time.Second,
-			Labels: map[string]string{
-				"service":   "aetherium-api",
-				"component": "api-gateway",
-			},
-		})
-		if err != nil {
-			log.Printf("Warning: Failed to initialize Loki logger: %v", err)
-		} else {
-			defer logger.Close()
-		}
+	// Providers are chosen by the configuration. Loki and the event bus are
+	// optional and left nil when disabled or unreachable.
+	deps := container.New(cfg)
+	deps.RegisterStoreFactory(factories.NewStorageFactory())
+	deps.RegisterQueueFactory(factories.NewQueueFactory())
+	deps.RegisterLoggerFactory(factories.NewLoggerFactory())
+	deps.RegisterEventBusFactory(factories.NewEventBusFactory())
+	if err := deps.Initialize(context.Background()); err != nil {
+		log.Fatalf("Failed to initialize gateway: %v", err)
 	}
+	defer deps.Shutdown(context.Background())
 
-	// Initialize Redis event bus (optional)
-	var eventBus *redis.RedisEventBus
-	if redisAddr := getEnv("REDIS_ADDR", ""); redisAddr != "" {
-		eventBus, err = redis.NewRedisEventBus(&redis.Config{
-			Addr: redisAddr,
-		})
-		if err != nil {
-			log.Printf("Warning: Failed to initialize event bus: %v", err)
-		} else {
-			defer eventBus.Close()
-		}
-	}
+	store := deps.GetStore()
+	// Tasks are written at a payload version the workers read, so the
+	// gateway and the workers can be upgraded separately
+	queue := service.NewVersionedQueue(deps.GetQueue(), store)
+	logger := deps.GetLogger()
+	eventBus := deps.GetEventBus()
+	log.Printf("✓ Initialized (storage: %s, queue: %s)", cfg.Storage.Provider, cfg.TaskQueue.Provider)
 
 	// Initialize integration registry
 	registry := integrations.NewRegistry()
@@ -134,8 +143,48 @@ func main() {
 		}
 	}
 
+	registry.SetHealthCheckOptions(
+		time.Duration(getEnvInt("INTEGRATION_HEALTH_TTL_SECONDS", int(integrations.DefaultHealthTTL.Seconds())))*time.Second,
+		time.Duration(max(getEnvInt("INTEGRATION_HEALTH_TIMEOUT_SECONDS", int(integrations.DefaultHealthTimeout.Seconds())), 1))*time.Second,
+	)
+
+	// Integrations configured through the API, replacing those of the same
+	// name set above
+	integrationService, err := service.NewIntegrationService(store, getEnv("WORKSPACE_ENCRYPTION_KEY", ""))
+	if err != nil {
+		log.Fatalf("Failed to initialize integration service: %v", err)
+	}
+	runtimeIntegrations := newRuntimeIntegrations(registry, integrationService)
+	if err := runtimeIntegrations.sync(context.Background()); err != nil {
+		log.Printf("Warning: Failed to load integration configs: %v", err)
+	}
+
 	// Create task service
 	taskService := service.NewTaskService(queue, store)
+	if eventBus != nil {
+		taskService.SetEventBus(eventBus)
+	}
+
+	// Create capacity service (checks cluster saturation before VM requests are enqueued)
+	capacityService := service.NewCapacityService(queue, store)
+	if eventBus != nil {
+		capacityService.SetEventBus(eventBus)
+	}
+
+	// Create SLO service (tracks API requests and tasks against the SLO targets)
+	sloService, err := service.NewSLOService(store, sloSettings(cfg.Server.SLO))
+	if err != nil {
+		log.Fatalf("Invalid SLO configuration: %v", err)
+	}
+	if eventBus != nil {
+		sloService.SetEventBus(eventBus)
+	}
+
+	// Create transcript service (verifies and anchors the transcript chain)
+	transcriptService := service.NewTranscriptService(store)
+	if eventBus != nil {
+		transcriptService.SetEventBus(eventBus)
+	}
 
 	// Create workspace service
 	encryptionKey := getEnv("WORKSPACE_ENCRYPTION_KEY", "")
@@ -145,6 +194,44 @@ func main() {
 	}
 	log.Println("✓ Workspace service initialized")
 
+	// Backups; restored archives are capped once decompressed too
+	backupService := service.NewBackupService(store)
+	backupService.SetMaxBytes(getEnvInt64("MAX_BACKUP_BYTES", service.DefaultBackupMaxBytes))
+
+	// Federated clusters, whose tokens are sealed with the same key
+	clusterService, err := service.NewClusterService(store, encryptionKey)
+	if err != nil {
+		log.Fatalf("Failed to initialize cluster service: %v", err)
+	}
+
+	// Place VMs on workers with a scheduling strategy instead of leaving
+	// them to whichever worker polls first; environments may pick their own
+	if strategy := getEnv("SCHEDULER_STRATEGY", ""); strategy != "" {
+		if err := taskService.SetSchedulingStrategy(strategy); err != nil {
+			log.Fatalf("Invalid SCHEDULER_STRATEGY: %v", err)
+		}
+		workspaceService.SetSchedulingStrategy(strategy)
+		log.Printf("✓ VMs scheduled with the %s strategy", strategy)
+	}
+	workspaceService.SetPromptRetries(getEnvInt("PROMPT_INFRA_RETRIES", service.DefaultPromptRetries))
+
+	// Create WebSocket session manager. Prompts run on workers through the queue;
+	// with an event bus, sessions fan out across gateway replicas.
+	gatewayID := getEnv("GATEWAY_ID", "")
+	if gatewayID == "" {
+		gatewayID, _ = os.Hostname()
+	}
+	sessionManager := websocket.NewSessionManager(store, nil)
+	sessionManager.SetGatewayID(gatewayID)
+	sessionManager.SetPromptSubmitter(workspaceService)
+	if eventBus != nil {
+		sessionManager.SetEventBus(eventBus)
+	} else {
+		log.Println("Warning: No event bus, workspace sessions are only shared within this gateway")
+	}
+	sessionManager.ReleaseOwnedSessions(context.Background())
+	log.Printf("✓ Session manager initialized (gateway: %s)", gatewayID)
+
 	// Initialize service discovery (optional)
 	var workerService *service.WorkerService
 	var consulRegistry discovery.ServiceRegistry
@@ -166,15 +253,15 @@ func main() {
 		if err != nil {
 			log.Printf("Warning: Failed to initialize Consul registry: %v", err)
 			log.Println("Worker service will run without service discovery")
-			workerService = service.NewWorkerService(store, nil)
+			workerService = service.NewWorkerService(store, nil, queue)
 		} else {
 			consulRegistry = reg
-			workerService = service.NewWorkerService(store, consulRegistry)
+			workerService = service.NewWorkerService(store, consulRegistry, queue)
 			log.Printf("✓ Consul registry initialized (address: %s, datacenter: %s)",
 				consulAddr, consulConfig.Datacenter)
 		}
 	} else {
-		workerService = service.NewWorkerService(store, nil)
+		workerService = service.NewWorkerService(store, nil, queue)
 		log.Println("Worker service initialized (no Consul configured)")
 		log.Println("  Set CONSUL_ADDR environment variable to enable service discovery")
 	}
@@ -185,9 +272,29 @@ func main() {
 		taskService:      taskService,
 		workerService:    workerService,
 		workspaceService: workspaceService,
+		capacityService:  capacityService,
+		envService:       service.NewEnvironmentService(store),
+		backupService:    backupService,
+		inventoryService: service.NewInventoryService(store),
+		sloService:       sloService,
+		transcripts:      transcriptService,
+		sessionManager:   sessionManager,
 		integrations:     registry,
+		integrationSync:  runtimeIntegrations,
+		federation:       newFederation(store, clusterService, getEnv("GATEWAY_REGION", "")),
+		previewSecret:    []byte(os.Getenv("PREVIEW_SECRET")),
+		peerSecret:       []byte(os.Getenv("WORKER_PEER_SECRET")),
+		adminToken:       os.Getenv("ADMIN_TOKEN"),
+		uiCSP:            cfg.Server.SecurityHeaders.UIContentSecurityPolicy,
+		vmWaitTimeout:    time.Duration(max(getEnvInt("SMART_EXECUTE_VM_TIMEOUT_SECONDS", 30), 1)) * time.Second,
 		logger:           logger,
 		eventBus:         eventBus,
+		drainCh:          make(chan struct{}),
+	}
+	sessionManager.SetTerminalDialer(srv)
+	srv.taskStreamer = websocket.NewTaskStreamer(store, srv.drainCh)
+	if eventBus != nil {
+		srv.taskStreamer.SetEventBus(eventBus)
 	}
 
 	// Setup router
@@ -198,48 +305,144 @@ func main() {
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(requestTimeout(60 * time.Second))
+	r.Use(readConsistency)
+	r.Use(securityHeaders(cfg.Server.SecurityHeaders))
+	r.Use(limitBodies(cfg.Server.BodyLimits))
 
 	// CORS
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	}))
+	r.Use(cors.Handler(corsOptions(cfg.Server.CORS)))
 
 	// Static UI
 	r.Get("/ui", srv.serveUI)
 	r.Get("/", srv.serveUI) // Redirect root to UI
 
+	// Kubernetes probes
+	checker := health.NewChecker()
+	checker.Add("database", store.Ping)
+	checker.Add("redis", func(ctx context.Context) error {
+		_, err := queue.Stats(ctx)
+		return err
+	})
+	if eventBus != nil {
+		checker.Add("event_bus", eventBus.Health)
+	}
+	checker.Add("draining", func(ctx context.Context) error {
+		if srv.draining() {
+			return fmt.Errorf("gateway is shutting down")
+		}
+		return nil
+	})
+	r.Get("/livez", health.LivezHandler)
+	r.Get("/readyz", checker.ReadyzHandler)
+
+	// Workspace previews: browser traffic to ports of workspace VMs
+	r.HandleFunc("/preview/{id}/{port}/*", srv.previewWorkspace)
+
 	// Routes
 	r.Route("/api/v1", func(r chi.Router) {
+		r.Use(srv.recordSLO)
+
 		// Smart Execute - Intelligent VM selection
 		r.Post("/smart-execute", srv.smartExecute)
+		r.Get("/smart-executions", srv.listSmartExecutions)
+		r.Get("/smart-executions/{id}", srv.getSmartExecution)
 
 		// VMs
 		r.Post("/vms", srv.createVM)
 		r.Get("/vms", srv.listVMs)
-		r.Get("/vms/{id}", srv.getVM)
-		r.Delete("/vms/{id}", srv.deleteVM)
-		r.Post("/vms/{id}/execute", srv.executeCommand)
-		r.Get("/vms/{id}/executions", srv.listExecutions)
+		r.Group(func(r chi.Router) {
+			r.Use(srv.remoteResource("/api/v1/vms", srv.localVMExists))
+			r.Get("/vms/{id}", srv.getVM)
+			r.Delete("/vms/{id}", srv.deleteVM)
+			r.Post("/vms/{id}/execute", srv.executeCommand)
+			r.Post("/vms/{id}/execute-sync", srv.executeCommandSync)
+			r.Get("/vms/{id}/executions", srv.listExecutions)
+			r.Get("/vms/{id}/tasks", srv.listVMTasks)
+			r.Get("/vms/{id}/processes", srv.getVMProcesses)
+			r.Post("/vms/{id}/processes/{pid}/signal", srv.signalVMProcess)
+			r.Post("/vms/{id}/snapshot", srv.snapshotVM)
+			r.Get("/vms/{id}/snapshots", srv.listVMSnapshots)
+			r.Post("/vms/{id}/restore", srv.restoreVM)
+		})
 
 		// Workers
 		r.Get("/workers", srv.listWorkers)
 		r.Get("/workers/{id}", srv.getWorker)
 		r.Get("/workers/{id}/vms", srv.getWorkerVMs)
+		r.Get("/workers/{id}/diagnostics", srv.getWorkerDiagnostics)
 		r.Post("/workers/{id}/drain", srv.drainWorker)
 		r.Post("/workers/{id}/activate", srv.activateWorker)
+		r.Post("/workers/{id}/restart", srv.restartWorker)
+		r.Post("/workers/{id}/reconcile", srv.reconcileWorker)
 
 		// Cluster
 		r.Get("/cluster/stats", srv.getClusterStats)
 		r.Get("/cluster/distribution", srv.getVMDistribution)
 
+		// Inventory for external monitoring (Prometheus http_sd) and CMDBs
+		r.Get("/inventory", srv.getInventory)
+		r.Get("/inventory/prometheus", srv.getPrometheusTargets)
+		r.Post("/cluster/rebalance", srv.rebalanceCluster)
+		r.Post("/scheduler/simulate", srv.simulateScheduler)
+		r.Get("/cluster/events", srv.listClusterEvents)
+		r.Get("/cluster/storage-cache", srv.getStorageCacheStats)
+		r.Get("/cluster/storage-replicas", srv.getStorageReplicas)
+
+		// Task queues
+		r.Get("/queues", srv.getQueues)
+
+		// Usage analytics
+		r.Get("/analytics/workspaces", srv.getWorkspaceAnalytics)
+
+		// Full-text search over prompts and workspace names
+		r.Get("/search", srv.search)
+
+		// VM garbage collection policies
+		r.Get("/gc-policies", srv.listGCPolicies)
+		r.Get("/gc-policies/{project}", srv.getGCPolicy)
+		r.Put("/gc-policies/{project}", srv.putGCPolicy)
+		r.Delete("/gc-policies/{project}", srv.deleteGCPolicy)
+
+		// Stale workspace policies
+		r.Get("/reap-policies", srv.listReapPolicies)
+		r.Get("/reap-policies/{project}", srv.getReapPolicy)
+		r.Put("/reap-policies/{project}", srv.putReapPolicy)
+		r.Delete("/reap-policies/{project}", srv.deleteReapPolicy)
+
+		// Capacity policies (what happens to VM requests when the cluster is saturated)
+		r.Get("/capacity-policies", srv.listCapacityPolicies)
+		r.Put("/capacity-policies/{project}", srv.putCapacityPolicy)
+		r.Delete("/capacity-policies/{project}", srv.deleteCapacityPolicy)
+
+		// Alert rules (threshold and absence rules over metrics and events)
+		r.Get("/alert-rules", srv.listAlertRules)
+		r.Post("/alert-rules", srv.createAlertRule)
+		r.Get("/alert-rules/{id}", srv.getAlertRule)
+		r.Put("/alert-rules/{id}", srv.updateAlertRule)
+		r.Delete("/alert-rules/{id}", srv.deleteAlertRule)
+
+		// Federated clusters
+		r.Get("/clusters", srv.listClusters)
+		r.Get("/clusters/{name}", srv.getCluster)
+		r.Put("/clusters/{name}", srv.putCluster)
+		r.Delete("/clusters/{name}", srv.deleteCluster)
+
+		// Integrations configured at runtime
+		r.Get("/integrations", srv.listIntegrations)
+		r.Get("/integrations/{name}", srv.getIntegration)
+		r.Put("/integrations/{name}", srv.putIntegration)
+		r.Delete("/integrations/{name}", srv.deleteIntegration)
+
+		// Control-plane backup and restore, with ADMIN_TOKEN
+		r.With(requireAdminToken(srv.adminToken)).Get("/admin/backup", srv.exportBackup)
+		r.With(requireAdminToken(srv.adminToken)).Post("/admin/restore", srv.importBackup)
+
 		// Tasks
+		r.Get("/tasks", srv.listTasks)
 		r.Get("/tasks/{id}", srv.getTask)
+		r.Get("/tasks/{id}/result", srv.getTaskResult)
+		r.Get("/tasks/{id}/stream", srv.streamTask) // SSE or WebSocket
 
 		// Logs
 		r.Post("/logs/query", srv.queryLogs)
@@ -253,30 +456,145 @@ func main() {
 		r.Get("/environments", srv.listEnvironments)
 		r.Get("/environments/{id}", srv.getEnvironment)
 		r.Put("/environments/{id}", srv.updateEnvironment)
+		r.Patch("/environments/{id}", srv.patchEnvironment)
 		r.Delete("/environments/{id}", srv.deleteEnvironment)
+		r.Get("/environments/{id}/workspaces", srv.listEnvironmentWorkspaces)
+		r.Get("/environments/{id}/lock", srv.getEnvironmentLock)
+		r.Post("/environments/{id}/lock", srv.lockEnvironmentTools)
+		r.Delete("/environments/{id}/lock", srv.unlockEnvironmentTools)
+		r.Get("/environments/{id}/firewall", srv.getEnvironmentFirewall)
+		r.Put("/environments/{id}/firewall", srv.putEnvironmentFirewall)
+		r.Delete("/environments/{id}/firewall", srv.deleteEnvironmentFirewall)
+		r.Post("/environments/{id}/secrets", srv.addEnvironmentSecret)
+		r.Get("/environments/{id}/secrets", srv.listEnvironmentSecrets)
+		r.Delete("/environments/{id}/secrets/{secretId}", srv.deleteEnvironmentSecret)
+
+		// Secret audit
+		r.Get("/secrets/unused", srv.listUnusedSecrets)
+		r.Get("/secrets/{id}/usage", srv.listSecretUsage)
 
 		// Workspaces
 		r.Post("/workspaces", srv.createWorkspace)
 		r.Get("/workspaces", srv.listWorkspaces)
-		r.Get("/workspaces/{id}", srv.getWorkspace)
-		r.Delete("/workspaces/{id}", srv.deleteWorkspace)
-		r.Post("/workspaces/{id}/prompts", srv.submitPrompt)
-		r.Get("/workspaces/{id}/prompts", srv.listPrompts)
-		r.Get("/workspaces/{id}/prompts/{promptId}", srv.getPrompt)
-		r.Post("/workspaces/{id}/secrets", srv.addSecret)
-		r.Get("/workspaces/{id}/secrets", srv.listSecrets)
-		r.Delete("/workspaces/{id}/secrets/{secretId}", srv.deleteSecret)
+		r.Group(func(r chi.Router) {
+			// Workspaces held by a federated cluster are proxied there
+			r.Use(srv.remoteResource("/api/v1/workspaces", srv.localWorkspaceExists))
+			r.Get("/workspaces/{id}", srv.getWorkspace)
+			r.Patch("/workspaces/{id}", srv.patchWorkspace)
+			r.Get("/workspaces/{id}/history", srv.getWorkspaceHistory)
+			r.Get("/workspaces/{id}/tasks", srv.listWorkspaceTasks)
+			r.Get("/workspaces/{id}/logs/bundle", srv.getWorkspaceLogsBundle)
+			r.Post("/workspaces/{id}/retry", srv.retryWorkspace)
+			r.Post("/workspaces/{id}/clone", srv.cloneWorkspace)
+			r.Delete("/workspaces/{id}", srv.deleteWorkspace)
+			r.Post("/workspaces/{id}/attachments", srv.uploadAttachment)
+			r.Post("/workspaces/{id}/prompts", srv.submitPrompt)
+			r.Get("/workspaces/{id}/prompts", srv.listPrompts)
+			r.Get("/workspaces/{id}/prompts/{promptId}", srv.getPrompt)
+			r.Get("/workspaces/{id}/prompts/{promptId}/stream", srv.streamPrompt) // SSE
+			r.Get("/workspaces/{id}/prompts/{promptId}/checkpoint", srv.getPromptCheckpoint)
+			r.Post("/workspaces/{id}/secrets", srv.addSecret)
+			r.Get("/workspaces/{id}/secrets", srv.listSecrets)
+			r.Delete("/workspaces/{id}/secrets/{secretId}", srv.deleteSecret)
+			r.Post("/workspaces/{id}/save-as-environment", srv.saveWorkspaceAsEnvironment)
+			r.Get("/workspaces/{id}/ports", srv.listWorkspacePorts)
+		})
 		r.Get("/workspaces/{id}/session", srv.workspaceSession) // WebSocket
 
+		// Service level objectives
+		r.Get("/slo", srv.getSLOReport)
+
+		// Hash-chained execution and prompt transcripts
+		r.Get("/transcripts", srv.listTranscriptEntries)
+		r.Get("/transcripts/verify", srv.verifyTranscripts)
+
 		// Health
 		r.Get("/health", srv.health)
 	})
 
+	// Prune cluster timeline events past their retention, expired
+	// key-value state and uploads never attached to a prompt
+	pruneCtx, pruneCancel := context.WithCancel(context.Background())
+	defer pruneCancel()
+	eventRetention := time.Duration(getEnvInt("CLUSTER_EVENTS_RETENTION_HOURS", 72)) * time.Hour
+	go pruneClusterEvents(pruneCtx, store, eventRetention)
+	go pruneExpiredKV(pruneCtx, store)
+	go pruneAttachments(pruneCtx, workspaceService)
+
+	// Retry prompts lost with a worker that stopped sending heartbeats
+	go recoverLostPrompts(pruneCtx, workspaceService)
+
+	// Push the inventory to an external CMDB
+	if webhookURL := os.Getenv("INVENTORY_WEBHOOK_URL"); webhookURL != "" {
+		hook := &inventoryWebhook{
+			url:    webhookURL,
+			secret: []byte(os.Getenv("INVENTORY_WEBHOOK_SECRET")),
+			client: &http.Client{Timeout: 30 * time.Second},
+		}
+		interval := time.Duration(max(getEnvInt("INVENTORY_WEBHOOK_INTERVAL_SECONDS", 300), 10)) * time.Second
+		go pushInventory(pruneCtx, srv.inventoryService, hook, interval)
+		log.Printf("Pushing inventory to %s every %v", webhookURL, interval)
+	}
+
+	// Pick up integration changes made through other gateway replicas
+	syncInterval := time.Duration(max(getEnvInt("INTEGRATION_SYNC_INTERVAL_SECONDS", 30), 5)) * time.Second
+	go runtimeIntegrations.watch(pruneCtx, syncInterval)
+
+	// Evaluate alert rules, delivering alerts through the notification integrations
+	notify := func(ctx context.Context, target storage.AlertTarget, notification *types.Notification) error {
+		integration, err := registry.Get(target.Integration)
+		if err != nil {
+			return err
+		}
+		return integration.SendNotification(ctx, notification)
+	}
+	alertService := service.NewAlertService(store)
+	alertService.SetNotifier(notify)
+	if eventBus != nil {
+		alertService.SetEventBus(eventBus)
+	}
+	if alertInterval := time.Duration(getEnvInt("ALERT_EVAL_INTERVAL_SECONDS", 30)) * time.Second; alertInterval > 0 {
+		go alertService.Run(pruneCtx, alertInterval)
+	}
+
+	// Write API request counts and emit events when SLO error budgets are at risk
+	sloInterval := time.Duration(max(getEnvInt("SLO_EVAL_INTERVAL_SECONDS", 60), 10)) * time.Second
+	go sloService.Run(pruneCtx, sloInterval)
+
+	// Publish the transcript chain's head, so rewriting the chain is caught
+	if cfg.Database.TranscriptChain {
+		if anchorInterval := time.Duration(getEnvInt("TRANSCRIPT_ANCHOR_INTERVAL_SECONDS", 3600)) * time.Second; anchorInterval > 0 {
+			go transcriptService.Run(pruneCtx, anchorInterval)
+		}
+	}
+
+	// Flag unused workspaces, notify their owners and archive them after
+	// the grace period, per the reap policies
+	reaper := service.NewWorkspaceReaper(store, workspaceService, os.Getenv("WORKSPACE_ARCHIVE_DIR"))
+	reaper.SetNotifier(notify)
+	if eventBus != nil {
+		reaper.SetEventBus(eventBus)
+	}
+	if reapInterval := time.Duration(getEnvInt("WORKSPACE_REAP_INTERVAL_SECONDS", 3600)) * time.Second; reapInterval > 0 {
+		go reaper.Run(pruneCtx, reapInterval)
+	}
+
+	// Runtime diagnostics are served outside the router, whose RealIP
+	// middleware would let a remote client pass as a loopback one
+	handler := http.Handler(r)
+	if cfg.Server.Debug.Enabled {
+		root := http.NewServeMux()
+		root.Handle("/debug/", diagnostics.Handler(cfg.Server.Debug))
+		root.Handle("/", r)
+		handler = root
+		log.Println("Runtime diagnostics enabled on /debug/")
+	}
+
 	// Start server
 	port := getEnv("PORT", "8080")
 	httpServer := &http.Server{
 		Addr:    fmt.Sprintf(":%s", port),
-		Handler: r,
+		Handler: handler,
 	}
 
 	// Graceful shutdown
@@ -292,20 +610,37 @@ func main() {
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	<-sigChan
 
+	// Drain: fail readiness so load balancers stop routing here, then move
+	// clients off before shutting the server down
+	drainDelay := time.Duration(getEnvInt("GATEWAY_DRAIN_DELAY_SECONDS", 5)) * time.Second
+	drainTimeout := time.Duration(getEnvInt("GATEWAY_DRAIN_TIMEOUT_SECONDS", 30)) * time.Second
+
+	log.Printf("Draining API Gateway (readiness delay %s, timeout %s)...", drainDelay, drainTimeout)
+	srv.startDraining()
+	time.Sleep(drainDelay)
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), drainTimeout)
+	sessionManager.Drain(drainCtx)
+	drainCancel()
+
 	log.Println("Shutting down API Gateway...")
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := httpServer.Shutdown(ctx); err != nil {
 		log.Printf("Server shutdown error: %v", err)
 	}
 
+	// Hijacked WebSocket connections aren't closed by Shutdown
+	sessionManager.Shutdown(ctx)
+
 	log.Println("API Gateway stopped")
 }
 
 // Handler functions
 
 func (s *Server) serveUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", s.uiCSP)
 	http.ServeFile(w, r, "web/index.html")
 }
 
@@ -316,23 +651,56 @@ func (s *Server) createVM(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	taskID, err := s.taskService.CreateVMTaskWithTools(
+	decision := s.admitVMRequest(w, r, req.Project, req.MemoryMB)
+	if decision == nil {
+		return
+	}
+
+	taskID, err := s.taskService.CreateVMTaskWithOptions(
 		r.Context(),
 		req.Name,
 		req.VCPUs,
 		req.MemoryMB,
-		req.AdditionalTools,
-		req.ToolVersions,
+		&service.VMCreateOptions{
+			AdditionalTools: req.AdditionalTools,
+			ToolVersions:    req.ToolVersions,
+			Project:         req.Project,
+		},
 	)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to create VM task", err)
+		respondError(w, taskErrorStatus(err), "Failed to create VM task", err)
 		return
 	}
 
-	respondJSON(w, http.StatusAccepted, api.CreateVMResponse{
+	resp := api.CreateVMResponse{
 		TaskID: taskID,
 		Status: "pending",
-	})
+	}
+	if decision.Saturated {
+		resp.Status = "queued"
+		resp.QueuePosition = decision.QueuePosition
+		resp.Message = fmt.Sprintf("Cluster is at capacity; request accepted with policy %s", decision.Policy)
+	}
+
+	respondJSON(w, http.StatusAccepted, resp)
+}
+
+// admitVMRequest applies the project's capacity policy before a VM request is enqueued.
+// It writes a 503 with Retry-After and returns nil when the request is rejected.
+func (s *Server) admitVMRequest(w http.ResponseWriter, r *http.Request, project string, memoryMB int) *service.AdmissionDecision {
+	decision, err := s.capacityService.Admit(r.Context(), project, memoryMB)
+	if err != nil {
+		log.Printf("Warning: Capacity check failed, admitting request: %v", err)
+		return &service.AdmissionDecision{Admitted: true}
+	}
+
+	if !decision.Admitted {
+		w.Header().Set("Retry-After", strconv.Itoa(int(decision.RetryAfter.Seconds())))
+		respondError(w, http.StatusServiceUnavailable, "Cluster is at capacity, retry later", nil)
+		return nil
+	}
+
+	return decision
 }
 
 func (s *Server) listVMs(w http.ResponseWriter, r *http.Request) {
@@ -356,14 +724,28 @@ func (s *Server) listVMs(w http.ResponseWriter, r *http.Request) {
 			CreatedAt:  vm.CreatedAt,
 			StartedAt:  vm.StartedAt,
 			StoppedAt:  vm.StoppedAt,
+			LastUsedAt: vm.LastUsedAt,
 			Metadata:   vm.Metadata,
 		}
 	}
 
-	respondJSON(w, http.StatusOK, api.ListVMsResponse{
-		VMs:   vmResponses,
-		Total: len(vmResponses),
-	})
+	resp := api.ListVMsResponse{VMs: vmResponses}
+	if wantsFederatedList(r) {
+		resp.ClusterErrors = s.federation.fanOut(r.Context(), localListPath(r), func(cluster string, body json.RawMessage) error {
+			var remote api.ListVMsResponse
+			if err := json.Unmarshal(body, &remote); err != nil {
+				return err
+			}
+			for _, vm := range remote.VMs {
+				vm.Cluster = cluster
+				resp.VMs = append(resp.VMs, vm)
+			}
+			return nil
+		})
+	}
+	resp.Total = len(resp.VMs)
+
+	respondJSON(w, http.StatusOK, resp)
 }
 
 func (s *Server) getVM(w http.ResponseWriter, r *http.Request) {
@@ -392,6 +774,7 @@ func (s *Server) getVM(w http.ResponseWriter, r *http.Request) {
 		CreatedAt:  vm.CreatedAt,
 		StartedAt:  vm.StartedAt,
 		StoppedAt:  vm.StoppedAt,
+		LastUsedAt: vm.LastUsedAt,
 		Metadata:   vm.Metadata,
 	})
 }
@@ -401,7 +784,7 @@ func (s *Server) deleteVM(w http.ResponseWriter, r *http.Request) {
 
 	taskID, err := s.taskService.DeleteVMTask(r.Context(), idStr)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to delete VM", err)
+		respondError(w, taskErrorStatus(err), "Failed to delete VM", err)
 		return
 	}
 
@@ -421,9 +804,12 @@ func (s *Server) executeCommand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	taskID, err := s.taskService.ExecuteCommandTask(r.Context(), idStr, req.Command, req.Args)
+	taskID, err := s.taskService.ExecuteCommandTaskWithOptions(r.Context(), idStr, req.Command, req.Args, &service.ExecuteOptions{
+		Cache:      req.Cache,
+		InputsHash: req.InputsHash,
+	})
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to execute command", err)
+		respondError(w, taskErrorStatus(err), "Failed to execute command", err)
 		return
 	}
 
@@ -450,20 +836,7 @@ func (s *Server) listExecutions(w http.ResponseWriter, r *http.Request) {
 
 	execResponses := make([]*api.ExecutionResponse, len(executions))
 	for i, exec := range executions {
-		execResponses[i] = &api.ExecutionResponse{
-			ID:          exec.ID,
-			VMID:        exec.VMID,
-			Command:     exec.Command,
-			Args:        exec.Args,
-			ExitCode:    exec.ExitCode,
-			Stdout:      exec.Stdout,
-			Stderr:      exec.Stderr,
-			Error:       exec.Error,
-			StartedAt:   exec.StartedAt,
-			CompletedAt: exec.CompletedAt,
-			DurationMS:  exec.DurationMS,
-			Metadata:    exec.Metadata,
-		}
+		execResponses[i] = executionResponse(exec)
 	}
 
 	respondJSON(w, http.StatusOK, api.ListExecutionsResponse{
@@ -472,6 +845,24 @@ func (s *Server) listExecutions(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func executionResponse(exec *storage.Execution) *api.ExecutionResponse {
+	return &api.ExecutionResponse{
+		ID:          exec.ID,
+		TaskID:      exec.TaskID,
+		VMID:        exec.VMID,
+		Command:     exec.Command,
+		Args:        exec.Args,
+		ExitCode:    exec.ExitCode,
+		Stdout:      exec.Stdout,
+		Stderr:      exec.Stderr,
+		Error:       exec.Error,
+		StartedAt:   exec.StartedAt,
+		CompletedAt: exec.CompletedAt,
+		DurationMS:  exec.DurationMS,
+		Metadata:    exec.Metadata,
+	}
+}
+
 func (s *Server) smartExecute(w http.ResponseWriter, r *http.Request) {
 	var req api.SmartExecuteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -487,15 +878,42 @@ func (s *Server) smartExecute(w http.ResponseWriter, r *http.Request) {
 		req.MemoryMB = 512
 	}
 
+	// Commands with an image skip VMs entirely
+	if req.Image != "" {
+		s.smartExecuteContainer(w, r, &req)
+		return
+	}
+
 	var selectedVM *uuid.UUID
 	var vmName string
 	var vmCreated bool
 	var vmReused bool
 
+	// Resolve sandbox profile from the requested environment
+	var sandbox *storage.SandboxProfile
+	if req.Environment != "" {
+		env, err := s.lookupEnvironment(r.Context(), req.Environment)
+		if err != nil {
+			respondError(w, http.StatusNotFound, "Environment not found", err)
+			return
+		}
+		sandbox = env.Sandbox
+		req.RequiredTools = append(req.RequiredTools, env.Tools...)
+	}
+
+	// Sandboxed executions always get a fresh VM so untrusted code never shares one
+	if sandbox != nil {
+		req.PreferExisting = false
+		if req.VMName != "" {
+			respondError(w, http.StatusBadRequest, "vm_name cannot be used with a sandboxed environment", nil)
+			return
+		}
+	}
+
 	// Strategy 1: If specific VM name provided, try to find it
 	if req.VMName != "" {
 		vm, err := s.taskService.GetVMByName(r.Context(), req.VMName)
-		if err == nil && vm != nil && vm.Status == "RUNNING" {
+		if err == nil && vm != nil && vm.Status == string(types.VMStatusRunning) {
 			selectedVM = &vm.ID
 			vmName = vm.Name
 			vmReused = true
@@ -509,7 +927,7 @@ func (s *Server) smartExecute(w http.ResponseWriter, r *http.Request) {
 		if err == nil && len(vms) > 0 {
 			// Find first running VM
 			for _, vm := range vms {
-				if vm.Status == "RUNNING" {
+				if vm.Status == string(types.VMStatusRunning) {
 					selectedVM = &vm.ID
 					vmName = vm.Name
 					vmReused = true
@@ -531,66 +949,89 @@ func (s *Server) smartExecute(w http.ResponseWriter, r *http.Request) {
 			vmName = req.VMName
 		}
 
+		if s.admitVMRequest(w, r, req.Project, req.MemoryMB) == nil {
+			return
+		}
+
 		// Create VM task
-		taskID, err := s.taskService.CreateVMTaskWithTools(
+		taskID, err := s.taskService.CreateVMTaskWithOptions(
 			r.Context(),
 			vmName,
 			req.VCPUs,
 			req.MemoryMB,
-			req.RequiredTools,
-			nil, // tool versions
+			&service.VMCreateOptions{
+				AdditionalTools: req.RequiredTools,
+				Sandbox:         sandbox,
+				Project:         req.Project,
+			},
 		)
 		if err != nil {
-			respondError(w, http.StatusInternalServerError, "Failed to create VM", err)
+			respondError(w, taskErrorStatus(err), "Failed to create VM", err)
 			return
 		}
 
 		log.Printf("Smart Execute: VM creation task submitted (ID: %s), waiting for VM...", taskID)
 
-		// Wait for VM to be created (poll for up to 30 seconds)
-		var newVM *uuid.UUID
-		for i := 0; i < 30; i++ {
-			time.Sleep(1 * time.Second)
-
-			vm, err := s.taskService.GetVMByName(r.Context(), vmName)
-			if err == nil && vm != nil && vm.Status == "RUNNING" {
-				newVM = &vm.ID
-				break
-			}
-		}
-
-		if newVM == nil {
+		// Wait for the worker to finish creating the VM; it's running by then
+		task, err := s.taskService.WaitForTask(r.Context(), taskID, s.vmWaitTimeout)
+		if errors.Is(err, service.ErrTaskWaitTimeout) {
 			respondError(w, http.StatusInternalServerError, "VM creation timed out", nil)
 			return
 		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to wait for VM creation", err)
+			return
+		}
+		if task.Status != storage.TaskStatusCompleted {
+			var taskErr error
+			if task.Error != nil {
+				taskErr = errors.New(*task.Error)
+			}
+			respondError(w, http.StatusInternalServerError, "VM creation failed", taskErr)
+			return
+		}
 
-		selectedVM = newVM
+		selectedVM = task.VMID
+		if selectedVM == nil {
+			vm, err := s.taskService.GetVMByName(r.Context(), vmName)
+			if err != nil {
+				respondError(w, http.StatusInternalServerError, "Created VM not found", err)
+				return
+			}
+			selectedVM = &vm.ID
+		}
 		vmCreated = true
 		log.Printf("Smart Execute: New VM created successfully: %s (%s)", vmName, *selectedVM)
 	}
 
 	// Execute command on selected VM
-	// If args are provided, use them directly. Otherwise, wrap the full command in bash -c
-	var taskID uuid.UUID
-	var execErr error
-	if len(req.Args) > 0 {
-		// Command and args provided separately
-		taskID, execErr = s.taskService.ExecuteCommandTask(r.Context(), selectedVM.String(), req.Command, req.Args)
-	} else {
-		// Full command string provided - execute via bash -c
-		taskID, execErr = s.taskService.ExecuteCommandTask(r.Context(), selectedVM.String(), "bash", []string{"-c", req.Command})
+	// Cached results are shared between VMs built with the same tool set
+	execOpts := &service.ExecuteOptions{
+		Cache:      req.Cache,
+		CacheImage: smartExecuteCacheImage(req.RequiredTools),
+		InputsHash: req.InputsHash,
 	}
 
+	command, args := smartExecuteCommand(&req)
+	taskID, execErr := s.taskService.ExecuteCommandTaskWithOptions(r.Context(), selectedVM.String(), command, args, execOpts)
 	if execErr != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to execute command", execErr)
+		respondError(w, taskErrorStatus(execErr), "Failed to execute command", execErr)
 		return
 	}
 
 	log.Printf("Smart Execute: Command execution task submitted (ID: %s) on VM %s", taskID, *selectedVM)
 
+	record := newSmartExecution(&req, taskID, command, args)
+	record.VMID = selectedVM
+	record.VMName = vmName
+	record.VMCreated = vmCreated
+	record.VMReused = vmReused
+	s.recordSmartExecution(r.Context(), record)
+
 	respondJSON(w, http.StatusAccepted, api.SmartExecuteResponse{
+		ID:          record.ID,
 		ExecutionID: taskID,
-		VMID:        *selectedVM,
+		VMID:        selectedVM,
 		VMName:      vmName,
 		VMCreated:   vmCreated,
 		VMReused:    vmReused,
@@ -599,660 +1040,2561 @@ func (s *Server) smartExecute(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (s *Server) getTask(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement task status endpoint
-	respondJSON(w, http.StatusOK, map[string]string{"status": "not_implemented"})
-}
+// smartExecuteContainer runs a smart-execute command in a throwaway
+// container of the requested image on a worker with the Docker backend.
+// Containers are stateless, so VM selection, tool installs and result
+// caching don't apply.
+func (s *Server) smartExecuteContainer(w http.ResponseWriter, r *http.Request, req *api.SmartExecuteRequest) {
+	switch {
+	case req.VMName != "":
+		respondError(w, http.StatusBadRequest, "vm_name cannot be used with image", nil)
+		return
+	case len(req.RequiredTools) > 0:
+		respondError(w, http.StatusBadRequest, "required_tools cannot be used with image", nil)
+		return
+	case req.Cache:
+		respondError(w, http.StatusBadRequest, "cache cannot be used with image", nil)
+		return
+	}
+	if err := vmm.ValidateImage(req.Image); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid image", err)
+		return
+	}
 
-func (s *Server) queryLogs(w http.ResponseWriter, r *http.Request) {
-	if s.logger == nil {
-		respondError(w, http.StatusServiceUnavailable, "Logging not configured", nil)
+	// Only the environment's sandbox applies; its tools come from the image
+	var sandbox *storage.SandboxProfile
+	if req.Environment != "" {
+		env, err := s.lookupEnvironment(r.Context(), req.Environment)
+		if err != nil {
+			respondError(w, http.StatusNotFound, "Environment not found", err)
+			return
+		}
+		if env.IsWindows() {
+			respondError(w, http.StatusBadRequest, "image cannot be used with a Windows environment", nil)
+			return
+		}
+		sandbox = env.Sandbox
+	}
+
+	if !s.anyActiveWorkerHasCapability(r, "docker") {
+		respondError(w, http.StatusServiceUnavailable, "No active worker can run containers", nil)
 		return
 	}
 
-	var req api.LogQueryRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+	command, args := smartExecuteCommand(req)
+	taskID, err := s.taskService.RunContainerTask(r.Context(), req.Image, command, args, sandbox)
+	if err != nil {
+		respondError(w, taskErrorStatus(err), "Failed to execute command", err)
 		return
 	}
 
-	// TODO: Query logs from Loki
-	respondJSON(w, http.StatusOK, api.LogQueryResponse{
-		Logs:  []*api.LogEntry{},
-		Total: 0,
+	log.Printf("Smart Execute: Container task submitted (ID: %s) with image %s", taskID, req.Image)
+
+	record := newSmartExecution(req, taskID, command, args)
+	record.Image = &req.Image
+	s.recordSmartExecution(r.Context(), record)
+
+	respondJSON(w, http.StatusAccepted, api.SmartExecuteResponse{
+		ID:          record.ID,
+		ExecutionID: taskID,
+		Image:       req.Image,
+		Status:      "pending",
+		Message:     fmt.Sprintf("Command queued for execution in a %s container", req.Image),
 	})
 }
 
-func (s *Server) streamLogs(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement WebSocket log streaming
-	respondError(w, http.StatusNotImplemented, "Log streaming not yet implemented", nil)
+// smartExecuteCommand returns the command to run. Without args the command
+// is a full command line, run with bash -c.
+func smartExecuteCommand(req *api.SmartExecuteRequest) (string, []string) {
+	if len(req.Args) == 0 {
+		return "bash", []string{"-c", req.Command}
+	}
+	return req.Command, req.Args
 }
 
-func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
-	integrationName := chi.URLParam(r, "integration")
-
-	_, err := s.integrations.Get(integrationName)
-	if err != nil {
-		respondError(w, http.StatusNotFound, "Integration not found", err)
-		return
+func newSmartExecution(req *api.SmartExecuteRequest, taskID uuid.UUID, command string, args []string) *storage.SmartExecution {
+	record := &storage.SmartExecution{
+		TaskID:  taskID,
+		Command: command,
+		Args:    make(storage.JSONBArray, len(args)),
 	}
+	for i, arg := range args {
+		record.Args[i] = arg
+	}
+	if req.Environment != "" {
+		record.Environment = &req.Environment
+	}
+	if req.Project != "" {
+		record.Project = &req.Project
+	}
+	return record
+}
 
-	// TODO: Verify webhook signature
-	// TODO: Parse webhook payload and publish event
-
-	respondJSON(w, http.StatusOK, map[string]string{"status": "received"})
+// recordSmartExecution stores a smart-execute request. The command is
+// already queued, so a failure to record it is only logged.
+func (s *Server) recordSmartExecution(ctx context.Context, record *storage.SmartExecution) {
+	if err := s.store.SmartExecutions().Create(ctx, record); err != nil {
+		log.Printf("Warning: Failed to record smart execution for task %s: %v", record.TaskID, err)
+	}
 }
 
-func (s *Server) health(w http.ResponseWriter, r *http.Request) {
-	components := make(map[string]string)
+// anyActiveWorkerHasCapability reports whether an active worker has the
+// capability. Without registered workers (legacy mode) there's nothing to
+// check, so it reports true.
+func (s *Server) anyActiveWorkerHasCapability(r *http.Request, capability string) bool {
+	workers, err := s.store.Workers().ListActive(r.Context())
+	return err != nil || len(workers) == 0 || anyWorkerHasCapability(workers, capability)
+}
 
-	// Check integrations
-	if s.integrations != nil {
-		healthResults := s.integrations.HealthCheck(r.Context())
-		for name, err := range healthResults {
-			if err != nil {
-				components[name] = "unhealthy"
-			} else {
-				components[name] = "healthy"
+// anyWorkerHasCapability reports whether one of the workers has the capability
+func anyWorkerHasCapability(workers []*storage.Worker, capability string) bool {
+	for _, worker := range workers {
+		for _, c := range worker.Capabilities {
+			if c == capability {
+				return true
 			}
 		}
 	}
+	return false
+}
 
-	// Check logger
-	if s.logger != nil {
-		if err := s.logger.Health(r.Context()); err != nil {
-			components["loki"] = "unhealthy"
-		} else {
-			components["loki"] = "healthy"
+// listSmartExecutions lists recorded smart-execute requests, newest first
+func (s *Server) listSmartExecutions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filters := map[string]interface{}{}
+
+	if value := query.Get("vm_id"); value != "" {
+		vmID, err := uuid.Parse(value)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid vm_id", err)
+			return
 		}
+		filters["vm_id"] = vmID
 	}
 
-	// Check event bus
-	if s.eventBus != nil {
-		if err := s.eventBus.Health(r.Context()); err != nil {
-			components["event_bus"] = "unhealthy"
-		} else {
-			components["event_bus"] = "healthy"
+	if value := query.Get("vm_created"); value != "" {
+		created, err := strconv.ParseBool(value)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid vm_created", err)
+			return
 		}
+		filters["vm_created"] = created
 	}
 
-	respondJSON(w, http.StatusOK, api.HealthResponse{
-		Status:     "ok",
-		Components: components,
-		Timestamp:  time.Now(),
-	})
-}
-
-// Worker management handlers
+	if value := query.Get("status"); value != "" {
+		switch value {
+		case storage.SmartExecutionPending, storage.SmartExecutionCompleted, storage.SmartExecutionFailed:
+			filters["status"] = value
+		default:
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Unknown status: %s", value), nil)
+			return
+		}
+	}
 
-func (s *Server) listWorkers(w http.ResponseWriter, r *http.Request) {
-	// Check for zone filter
-	zone := r.URL.Query().Get("zone")
+	for _, key := range []string{"environment", "project"} {
+		if value := query.Get(key); value != "" {
+			filters[key] = value
+		}
+	}
 
-	var workers []*service.WorkerStats
-	var err error
+	for _, key := range []string{"since", "until"} {
+		if value := query.Get(key); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s (expected RFC3339)", key), err)
+				return
+			}
+			filters[key] = t
+		}
+	}
 
-	if zone != "" {
-		workers, err = s.workerService.ListWorkersByZone(r.Context(), zone)
-	} else {
-		workers, err = s.workerService.ListWorkers(r.Context())
+	limit := 100
+	if value := query.Get("limit"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l <= 0 {
+			respondError(w, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+		limit = l
+	}
+	if limit > 1000 {
+		limit = 1000
 	}
+	filters["limit"] = limit
 
+	executions, err := s.store.SmartExecutions().List(r.Context(), filters)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to list workers", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list smart executions", err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"workers": workers,
-		"total":   len(workers),
+	responses := make([]*api.SmartExecutionResponse, len(executions))
+	for i, execution := range executions {
+		responses[i] = smartExecutionResponse(execution)
+	}
+
+	respondJSON(w, http.StatusOK, api.ListSmartExecutionsResponse{
+		SmartExecutions: responses,
+		Total:           len(responses),
 	})
 }
 
-func (s *Server) getWorker(w http.ResponseWriter, r *http.Request) {
-	workerID := chi.URLParam(r, "id")
-
-	worker, err := s.workerService.GetWorker(r.Context(), workerID)
+// getSmartExecution returns a smart-execute request with its command's output
+func (s *Server) getSmartExecution(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
-		respondError(w, http.StatusNotFound, "Worker not found", err)
+		respondError(w, http.StatusBadRequest, "Invalid smart execution ID", err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, worker)
-}
-
-func (s *Server) getWorkerVMs(w http.ResponseWriter, r *http.Request) {
-	workerID := chi.URLParam(r, "id")
-
-	vms, err := s.workerService.GetWorkerVMs(r.Context(), workerID)
+	execution, err := s.store.SmartExecutions().Get(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusNotFound, "Failed to get worker VMs", err)
+		respondError(w, http.StatusNotFound, "Smart execution not found", err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"worker_id": workerID,
-		"vms":       vms,
-		"total":     len(vms),
-	})
-}
-
-func (s *Server) drainWorker(w http.ResponseWriter, r *http.Request) {
-	workerID := chi.URLParam(r, "id")
+	resp := smartExecutionResponse(execution)
+	if execution.ExecutionID != nil {
+		exec, err := s.store.Executions().Get(r.Context(), *execution.ExecutionID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to get execution", err)
+			return
+		}
+		resp.Execution = executionResponse(exec)
+	}
 
-	if err := s.workerService.DrainWorker(r.Context(), workerID); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to drain worker", err)
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func smartExecutionResponse(e *storage.SmartExecution) *api.SmartExecutionResponse {
+	return &api.SmartExecutionResponse{
+		ID:          e.ID,
+		TaskID:      e.TaskID,
+		VMID:        e.VMID,
+		VMName:      e.VMName,
+		Image:       e.Image,
+		VMCreated:   e.VMCreated,
+		VMReused:    e.VMReused,
+		Command:     e.Command,
+		Args:        e.Args,
+		Environment: e.Environment,
+		Project:     e.Project,
+		Status:      e.Status(),
+		ExitCode:    e.ExitCode,
+		Error:       e.Error,
+		CreatedAt:   e.CreatedAt,
+		CompletedAt: e.CompletedAt,
+		DurationMS:  e.DurationMS,
+	}
+}
+
+// lookupEnvironment finds an environment by ID or name
+func (s *Server) lookupEnvironment(ctx context.Context, ref string) (*storage.Environment, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		return s.store.Environments().Get(ctx, id)
+	}
+	return s.store.Environments().GetByName(ctx, ref)
+}
+
+// smartExecuteCacheImage derives a result cache image key from the tools a VM was built with
+func smartExecuteCacheImage(tools []string) string {
+	sorted := append([]string(nil), tools...)
+	sort.Strings(sorted)
+	return "smart:" + strings.Join(sorted, ",")
+}
+
+// getTaskResult returns the result of a command task, or of a prompt when
+// given a prompt ID. Tasks that haven't finished have no result yet.
+func (s *Server) getTaskResult(w http.ResponseWriter, r *http.Request) {
+	taskID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid task ID", err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"worker_id": workerID,
-		"status":    "draining",
-		"message":   "Worker marked as draining. It will stop accepting new tasks.",
+	if execution, err := s.taskService.GetExecutionByTask(r.Context(), taskID); err == nil {
+		resp := api.TaskResultResponse{
+			TaskID:    taskID,
+			Type:      "command",
+			Status:    "completed",
+			ExitCode:  execution.ExitCode,
+			Execution: executionResponse(execution),
+		}
+		if execution.Error != nil {
+			resp.Status = "failed"
+		}
+		respondJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	prompt, err := s.workspaceService.GetPrompt(r.Context(), taskID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "No result for task (unknown, or not finished yet)", nil)
+		return
+	}
+	if !storage.IsTerminalPromptStatus(prompt.Status) {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Prompt has no result yet (status: %s)", prompt.Status), nil)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, api.TaskResultResponse{
+		TaskID:   taskID,
+		Type:     "prompt",
+		Status:   prompt.Status,
+		ExitCode: prompt.ExitCode,
+		Prompt:   storagePromptToResponse(prompt),
 	})
 }
 
-func (s *Server) activateWorker(w http.ResponseWriter, r *http.Request) {
-	workerID := chi.URLParam(r, "id")
+// Server-sent event stream settings for following tasks and prompts
+const (
+	streamPollInterval      = 500 * time.Millisecond
+	streamKeepAliveInterval = 15 * time.Second
+	streamDefaultTimeout    = 30 * time.Minute
+)
 
-	if err := s.workerService.ActivateWorker(r.Context(), workerID); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to activate worker", err)
+// streamTask follows a command execution task over server-sent events.
+// It emits "status" while the task is pending, then "output" for stdout and
+// stderr and a final "exit" event carrying the exit code. WebSocket clients
+// get any task's state transitions and worker log lines as they happen
+// instead (see websocket.TaskStreamer).
+func (s *Server) streamTask(w http.ResponseWriter, r *http.Request) {
+	taskID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid task ID", err)
+		return
+	}
+
+	if websocket.IsUpgrade(r) {
+		s.taskStreamer.HandleTaskStream(w, r, taskID, streamTimeout(r))
+		return
+	}
+
+	sse, ok := newSSEWriter(w)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Streaming not supported", nil)
+		return
+	}
+
+	sse.send("status", api.StreamStatusEvent{ID: taskID, Status: "pending"})
+
+	s.pollStream(r, sse, func(ctx context.Context) bool {
+		execution, err := s.taskService.GetExecutionByTask(ctx, taskID)
+		if err != nil {
+			return false
+		}
+
+		sse.sendOutput(execution.Stdout, execution.Stderr)
+		exit := api.StreamExitEvent{
+			ID:         taskID,
+			Status:     "completed",
+			Error:      execution.Error,
+			DurationMS: execution.DurationMS,
+		}
+		if execution.ExitCode != nil {
+			exit.ExitCode = *execution.ExitCode
+		} else {
+			exit.ExitCode = -1
+		}
+		if execution.Error != nil {
+			exit.Status = "failed"
+		}
+		sse.send("exit", exit)
+		return true
+	})
+}
+
+// streamPrompt follows a workspace prompt over server-sent events, emitting
+// "status" on every status change and "output"/"exit" once it finishes
+func (s *Server) streamPrompt(w http.ResponseWriter, r *http.Request) {
+	promptID, err := uuid.Parse(chi.URLParam(r, "promptId"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid prompt ID", err)
+		return
+	}
+
+	if _, err := s.workspaceService.GetPrompt(r.Context(), promptID); err != nil {
+		respondError(w, http.StatusNotFound, "Prompt not found", err)
+		return
+	}
+
+	sse, ok := newSSEWriter(w)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Streaming not supported", nil)
+		return
+	}
+
+	lastStatus := ""
+	var output promptOutputStream
+	s.pollStream(r, sse, func(ctx context.Context) bool {
+		prompt, err := s.workspaceService.GetPrompt(ctx, promptID)
+		if err != nil {
+			return false
+		}
+
+		if prompt.Status != lastStatus {
+			lastStatus = prompt.Status
+			sse.send("status", api.StreamStatusEvent{ID: promptID, Status: prompt.Status})
+		}
+
+		switch {
+		case storage.IsTerminalPromptStatus(prompt.Status):
+		case prompt.Status == storage.PromptStatusRunning:
+			// Output arrives with the prompt's checkpoints until it finishes
+			if checkpoint, err := s.workspaceService.GetPromptCheckpoint(ctx, promptID); err == nil && checkpoint != nil {
+				output.sendCheckpoint(sse, checkpoint)
+			}
+			return false
+		default:
+			return false
+		}
+
+		output.sendFinal(sse, prompt.Stdout, prompt.Stderr)
+		exit := api.StreamExitEvent{
+			ID:         promptID,
+			Status:     prompt.Status,
+			ExitCode:   -1,
+			Error:      prompt.Error,
+			DurationMS: prompt.DurationMS,
+		}
+		if prompt.ExitCode != nil {
+			exit.ExitCode = *prompt.ExitCode
+		}
+		sse.send("exit", exit)
+		return true
+	})
+}
+
+// streamTimeout returns how long a stream may wait for completion
+// (?timeout_seconds=, default 30m)
+func streamTimeout(r *http.Request) time.Duration {
+	if v := r.URL.Query().Get("timeout_seconds"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	return streamDefaultTimeout
+}
+
+// pollStream calls check until it reports completion, the client disconnects
+// or the stream's timeout expires
+func (s *Server) pollStream(r *http.Request, sse *sseWriter, check func(ctx context.Context) bool) {
+	ctx := r.Context()
+	deadline := time.After(streamTimeout(r))
+	poll := time.NewTicker(streamPollInterval)
+	defer poll.Stop()
+	keepAlive := time.NewTicker(streamKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	if check(ctx) {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.drainCh:
+			sse.send("reconnect", map[string]string{"message": "gateway is restarting, reconnect to resume"})
+			return
+		case <-deadline:
+			sse.send("error", map[string]string{"message": "timed out waiting for completion"})
+			return
+		case <-keepAlive.C:
+			sse.comment("keep-alive")
+		case <-poll.C:
+			if check(ctx) {
+				return
+			}
+		}
+	}
+}
+
+// sseWriter writes server-sent events to a flushing response
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &sseWriter{w: w, flusher: flusher}, true
+}
+
+func (s *sseWriter) send(event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Warning: Failed to encode %s stream event: %v", event, err)
+		return
+	}
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload)
+	s.flusher.Flush()
+}
+
+func (s *sseWriter) sendOutput(stdout, stderr *string) {
+	if stdout != nil && *stdout != "" {
+		s.send("output", api.StreamOutputEvent{Stream: "stdout", Data: *stdout})
+	}
+	if stderr != nil && *stderr != "" {
+		s.send("output", api.StreamOutputEvent{Stream: "stderr", Data: *stderr})
+	}
+}
+
+func (s *sseWriter) comment(text string) {
+	fmt.Fprintf(s.w, ": %s\n\n", text)
+	s.flusher.Flush()
+}
+
+// defaultLogQueryLimit is how many log entries a query returns by default
+const defaultLogQueryLimit = 100
+
+// queryLogs searches the logs shipped by the gateway and workers, filtered by
+// the VM, task and workspace they belong to
+func (s *Server) queryLogs(w http.ResponseWriter, r *http.Request) {
+	if s.logger == nil {
+		respondError(w, http.StatusServiceUnavailable, "Logging not configured", nil)
+		return
+	}
+
+	var req api.LogQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	query := &logging.Query{
+		Labels: make(map[string]string),
+		Limit:  req.Limit,
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultLogQueryLimit
+	}
+	for label, value := range map[string]string{
+		"vm_id":        req.VMID,
+		"task_id":      req.TaskID,
+		"workspace_id": req.WorkspaceID,
+	} {
+		if value != "" {
+			query.Labels[label] = value
+		}
+	}
+	if req.Level != "" {
+		level := types.LogLevel(strings.ToUpper(req.Level))
+		query.Level = &level
+	}
+	if req.SearchText != "" {
+		query.SearchText = &req.SearchText
+	}
+	if req.StartTime != nil {
+		start := time.UnixMilli(*req.StartTime).UnixNano()
+		query.StartTime = &start
+	}
+	if req.EndTime != nil {
+		end := time.UnixMilli(*req.EndTime).UnixNano()
+		query.EndTime = &end
+	}
+
+	entries, err := s.logger.Query(r.Context(), query)
+	if err != nil {
+		respondError(w, http.StatusBadGateway, "Failed to query logs", err)
+		return
+	}
+
+	logs := make([]*api.LogEntry, 0, len(entries))
+	for _, entry := range entries {
+		logs = append(logs, &api.LogEntry{
+			Timestamp: entry.Timestamp,
+			Level:     string(entry.Level),
+			Message:   entry.Message,
+			TaskID:    entry.TaskID,
+			VMID:      entry.VMID,
+			Fields:    entry.Fields,
+		})
+	}
+
+	respondJSON(w, http.StatusOK, api.LogQueryResponse{
+		Logs:  logs,
+		Total: len(logs),
+	})
+}
+
+func (s *Server) streamLogs(w http.ResponseWriter, r *http.Request) {
+	// TODO: Implement WebSocket log streaming
+	respondError(w, http.StatusNotImplemented, "Log streaming not yet implemented", nil)
+}
+
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	integrationName := chi.URLParam(r, "integration")
+
+	_, err := s.integrations.Get(integrationName)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Integration not found", err)
+		return
+	}
+
+	// TODO: Verify webhook signature
+	// TODO: Parse webhook payload and publish event
+
+	respondJSON(w, http.StatusOK, map[string]string{"status": "received"})
+}
+
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	components := make(map[string]string)
+	checks := make(map[string]api.ComponentCheck)
+
+	// Check integrations, concurrently and cached (see Registry.HealthStatuses)
+	if s.integrations != nil {
+		for name, status := range s.integrations.HealthStatuses(r.Context()) {
+			check := api.ComponentCheck{Status: "healthy", DurationMS: status.Duration.Milliseconds()}
+			if status.Err != nil {
+				check.Status = "unhealthy"
+				check.Error = status.Err.Error()
+			}
+			if !status.CheckedAt.IsZero() {
+				checkedAt := status.CheckedAt
+				check.CheckedAt = &checkedAt
+			}
+			components[name] = check.Status
+			checks[name] = check
+		}
+	}
+
+	// Check logger
+	if s.logger != nil {
+		if err := s.logger.Health(r.Context()); err != nil {
+			components["loki"] = "unhealthy"
+		} else {
+			components["loki"] = "healthy"
+		}
+	}
+
+	// Check event bus
+	if s.eventBus != nil {
+		if err := s.eventBus.Health(r.Context()); err != nil {
+			components["event_bus"] = "unhealthy"
+		} else {
+			components["event_bus"] = "healthy"
+		}
+	}
+
+	respondJSON(w, http.StatusOK, api.HealthResponse{
+		Status:            "ok",
+		Components:        components,
+		Checks:            checks,
+		Version:           version,
+		Commit:            commit,
+		MinPayloadVersion: queue.MinPayloadVersion,
+		PayloadVersion:    queue.PayloadVersion,
+		Timestamp:         time.Now(),
+	})
+}
+
+// requestTimeout applies middleware.Timeout to every request except event
+// streams, which stay open until the followed task finishes, and workspace
+// previews, whose WebSockets stay open as long as the browser tab
+func requestTimeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		timed := middleware.Timeout(timeout)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/stream") || strings.HasPrefix(r.URL.Path, "/preview/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			timed.ServeHTTP(w, r)
+		})
+	}
+}
+
+// consistencyHeader set to "strong" makes a GET read from the primary
+// database instead of a read replica
+const consistencyHeader = "X-Aetherium-Consistency"
+
+// readConsistency sends the reads of requests that write, and of GETs that
+// ask for strong consistency, to the primary database. Other GETs may be
+// served from a read replica within the store's lag limit.
+func readConsistency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) ||
+			strings.EqualFold(r.Header.Get(consistencyHeader), "strong") {
+			r = r.WithContext(storage.WithPrimaryReads(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startDraining marks the gateway as draining. New WebSocket sessions are
+// refused and open event streams end with a reconnect event.
+func (s *Server) startDraining() {
+	s.drainOnce.Do(func() {
+		close(s.drainCh)
+	})
+}
+
+func (s *Server) draining() bool {
+	select {
+	case <-s.drainCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// Worker management handlers
+
+func (s *Server) listWorkers(w http.ResponseWriter, r *http.Request) {
+	// Check for zone filter
+	zone := r.URL.Query().Get("zone")
+
+	var workers []*service.WorkerStats
+	var err error
+
+	if zone != "" {
+		workers, err = s.workerService.ListWorkersByZone(r.Context(), zone)
+	} else {
+		workers, err = s.workerService.ListWorkers(r.Context())
+	}
+
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list workers", err)
 		return
 	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"worker_id": workerID,
-		"status":    "active",
-		"message":   "Worker activated. It will resume accepting tasks.",
+		"workers": workers,
+		"total":   len(workers),
 	})
 }
 
-func (s *Server) getClusterStats(w http.ResponseWriter, r *http.Request) {
-	stats, err := s.workerService.GetClusterStats(r.Context())
+func (s *Server) getWorker(w http.ResponseWriter, r *http.Request) {
+	workerID := chi.URLParam(r, "id")
+
+	worker, err := s.workerService.GetWorker(r.Context(), workerID)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to get cluster stats", err)
+		respondError(w, http.StatusNotFound, "Worker not found", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, worker)
+}
+
+func (s *Server) getWorkerVMs(w http.ResponseWriter, r *http.Request) {
+	workerID := chi.URLParam(r, "id")
+
+	vms, err := s.workerService.GetWorkerVMs(r.Context(), workerID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Failed to get worker VMs", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"worker_id": workerID,
+		"vms":       vms,
+		"total":     len(vms),
+	})
+}
+
+func (s *Server) drainWorker(w http.ResponseWriter, r *http.Request) {
+	workerID := chi.URLParam(r, "id")
+
+	if err := s.workerService.DrainWorker(r.Context(), workerID); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to drain worker", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"worker_id": workerID,
+		"status":    "draining",
+		"message":   "Worker marked as draining. It will stop accepting new tasks.",
+	})
+}
+
+func (s *Server) activateWorker(w http.ResponseWriter, r *http.Request) {
+	workerID := chi.URLParam(r, "id")
+
+	if err := s.workerService.ActivateWorker(r.Context(), workerID); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to activate worker", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"worker_id": workerID,
+		"status":    "active",
+		"message":   "Worker activated. It will resume accepting tasks.",
+	})
+}
+
+func (s *Server) restartWorker(w http.ResponseWriter, r *http.Request) {
+	workerID := chi.URLParam(r, "id")
+
+	var req api.RestartWorkerRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body", err)
+			return
+		}
+	}
+
+	if req.DrainTimeoutSeconds <= 0 {
+		req.DrainTimeoutSeconds = 600
+	}
+	drainTimeout := time.Duration(req.DrainTimeoutSeconds) * time.Second
+
+	if err := s.workerService.RestartWorker(r.Context(), workerID, drainTimeout); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to restart worker", err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"worker_id":     workerID,
+		"status":        "draining",
+		"drain_timeout": drainTimeout.String(),
+		"message":       "Worker is draining and will restart once its tasks finish or the timeout expires.",
+	})
+}
+
+func (s *Server) getClusterStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.workerService.GetClusterStats(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get cluster stats", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, stats)
+}
+
+// getStorageCacheStats reports the store's read cache hit rate. Stores
+// without a cache report it as disabled.
+func (s *Server) getStorageCacheStats(w http.ResponseWriter, r *http.Request) {
+	reporter, ok := s.store.(storage.CacheReporter)
+	if !ok {
+		respondJSON(w, http.StatusOK, storage.CacheStats{})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, reporter.CacheStats())
+}
+
+// getStorageReplicas reports the health and lag of the store's read
+// replicas; the list is empty without replicas
+func (s *Server) getStorageReplicas(w http.ResponseWriter, r *http.Request) {
+	replicas := []storage.ReplicaStatus{}
+	if reporter, ok := s.store.(storage.ReplicaReporter); ok {
+		replicas = reporter.ReplicaStatus()
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"replicas": replicas,
+	})
+}
+
+func (s *Server) getQueues(w http.ResponseWriter, r *http.Request) {
+	overview, err := s.taskService.GetQueueOverview(r.Context())
+	if errors.Is(err, service.ErrQueueInspectionUnsupported) {
+		respondError(w, http.StatusNotImplemented, "Queue inspection is not supported by this task queue", nil)
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to inspect queues", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, overview)
+}
+
+func (s *Server) listClusterEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filters := map[string]interface{}{}
+
+	if typeParam := query.Get("type"); typeParam != "" {
+		types := strings.Split(typeParam, ",")
+		for _, t := range types {
+			if !events.IsTimelineTopic(t) {
+				respondError(w, http.StatusBadRequest, fmt.Sprintf("Unknown event type: %s", t), nil)
+				return
+			}
+		}
+		filters["types"] = types
+	}
+
+	for _, key := range []string{"severity", "resource_type", "resource_id", "worker_id"} {
+		if value := query.Get(key); value != "" {
+			filters[key] = value
+		}
+	}
+
+	for _, key := range []string{"since", "until"} {
+		if value := query.Get(key); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s (expected RFC3339)", key), err)
+				return
+			}
+			filters[key] = t
+		}
+	}
+
+	limit := 100
+	if value := query.Get("limit"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l <= 0 {
+			respondError(w, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+		limit = l
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+	filters["limit"] = limit
+
+	clusterEvents, err := s.store.ClusterEvents().List(r.Context(), filters)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list cluster events", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"events": clusterEvents,
+		"total":  len(clusterEvents),
+	})
+}
+
+func (s *Server) getVMDistribution(w http.ResponseWriter, r *http.Request) {
+	distribution, err := s.workerService.GetVMDistribution(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get VM distribution", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"distribution":  distribution,
+		"total_workers": len(distribution),
+	})
+}
+
+func (s *Server) rebalanceCluster(w http.ResponseWriter, r *http.Request) {
+	var req api.RebalanceClusterRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body", err)
+			return
+		}
+	}
+	if dryRun := r.URL.Query().Get("dry_run"); dryRun != "" {
+		req.DryRun = dryRun == "true" || dryRun == "1"
+	}
+
+	plan, err := s.workerService.Rebalance(r.Context(), service.RebalanceOptions{
+		DryRun:    req.DryRun,
+		MaxMoves:  req.MaxMoves,
+		Threshold: req.Threshold,
+	})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to rebalance cluster", err)
+		return
+	}
+
+	status := http.StatusAccepted
+	if plan.DryRun || len(plan.Moves) == 0 {
+		status = http.StatusOK
+	}
+	respondJSON(w, status, plan)
+}
+
+// simulateScheduler works out where hypothetical VMs would be placed on the
+// current workers, for capacity planning. Nothing is created.
+func (s *Server) simulateScheduler(w http.ResponseWriter, r *http.Request) {
+	var req api.SimulateSchedulerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	opts := service.SimulationOptions{Strategy: req.Strategy}
+	for _, vm := range req.VMs {
+		simulated := service.SimulatedVM{
+			Name:         vm.Name,
+			Count:        vm.Count,
+			VCPUs:        vm.VCPUs,
+			MemoryMB:     vm.MemoryMB,
+			Zone:         vm.Zone,
+			ZoneRequired: vm.ZoneRequired,
+			Capabilities: vm.Capabilities,
+		}
+		if vm.EnvironmentID != "" {
+			envID, err := uuid.Parse(vm.EnvironmentID)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
+				return
+			}
+			simulated.EnvironmentID = &envID
+		}
+		opts.VMs = append(opts.VMs, simulated)
+	}
+	for _, worker := range req.AddWorkers {
+		opts.AddWorkers = append(opts.AddWorkers, service.SimulatedWorker{
+			ID:           worker.ID,
+			Count:        worker.Count,
+			Zone:         worker.Zone,
+			MemoryMB:     worker.MemoryMB,
+			MaxVMs:       worker.MaxVMs,
+			Capabilities: worker.Capabilities,
+		})
+	}
+
+	result, err := s.workspaceService.SimulatePlacement(r.Context(), opts)
+	if errors.Is(err, service.ErrInvalidSimulation) {
+		respondError(w, http.StatusBadRequest, "Invalid simulation", err)
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to simulate placement", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// Workspace handlers
+
+func (s *Server) createWorkspace(w http.ResponseWriter, r *http.Request) {
+	var req api.CreateWorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	// Validate required fields
+	if req.Name == "" {
+		respondError(w, http.StatusBadRequest, "Name is required", nil)
+		return
+	}
+	if req.VCPUs < 1 {
+		req.VCPUs = 1
+	}
+	if req.MemoryMB < 128 {
+		req.MemoryMB = 512
+	}
+	if req.AIAssistant == "" {
+		req.AIAssistant = "claude-code"
+	}
+
+	// Environments in another region are created by that region's cluster
+	if req.EnvironmentID != "" {
+		if envID, err := uuid.Parse(req.EnvironmentID); err == nil {
+			if env, err := s.store.Environments().Get(r.Context(), envID); err == nil {
+				if !isFederatedRequest(r) && !s.federation.isLocalRegion(env.Region) {
+					s.createRemoteWorkspace(w, r, &req, env)
+					return
+				}
+				if env.IsWindows() && !s.anyActiveWorkerHasCapability(r, vmm.CapabilityDockerWindows) {
+					respondError(w, http.StatusServiceUnavailable, "No active worker can run Windows VMs", nil)
+					return
+				}
+			}
+		}
+	}
+
+	decision := s.admitVMRequest(w, r, "", req.MemoryMB)
+	if decision == nil {
+		return
+	}
+
+	taskID, workspaceID, err := s.workspaceService.CreateWorkspace(r.Context(), &req)
+	if err != nil {
+		respondError(w, taskErrorStatus(err), "Failed to create workspace", err)
+		return
+	}
+
+	resp := api.CreateWorkspaceResponse{
+		TaskID:      taskID,
+		WorkspaceID: workspaceID,
+		Status:      storage.WorkspaceStatusCreating,
+	}
+	if decision.Saturated {
+		resp.Status = "queued"
+		resp.QueuePosition = decision.QueuePosition
+	}
+
+	respondJSON(w, http.StatusAccepted, resp)
+}
+
+func (s *Server) listWorkspaces(w http.ResponseWriter, r *http.Request) {
+	filters := map[string]interface{}{}
+	if owner := r.URL.Query().Get("owner"); owner != "" {
+		filters["owner"] = owner
+	}
+
+	workspaces, err := s.workspaceService.ListWorkspaces(r.Context(), filters)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list workspaces", err)
+		return
+	}
+
+	responses := make([]*api.WorkspaceResponse, len(workspaces))
+	for i, ws := range workspaces {
+		responses[i] = storageWorkspaceToResponse(ws)
+	}
+
+	resp := api.ListWorkspacesResponse{Workspaces: responses}
+	if wantsFederatedList(r) {
+		resp.ClusterErrors = s.federation.fanOut(r.Context(), localListPath(r), func(cluster string, body json.RawMessage) error {
+			var remote api.ListWorkspacesResponse
+			if err := json.Unmarshal(body, &remote); err != nil {
+				return err
+			}
+			for _, ws := range remote.Workspaces {
+				ws.Cluster = cluster
+				resp.Workspaces = append(resp.Workspaces, ws)
+			}
+			return nil
+		})
+	}
+	resp.Total = len(resp.Workspaces)
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) getWorkspace(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		return
+	}
+
+	workspace, err := s.workspaceService.GetWorkspace(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, storageWorkspaceToResponse(workspace))
+}
+
+func (s *Server) getWorkspaceHistory(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		return
+	}
+
+	workspace, err := s.workspaceService.GetWorkspace(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", err)
+		return
+	}
+
+	history, err := s.workspaceService.GetStatusHistory(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get workspace history", err)
+		return
+	}
+
+	resp := api.WorkspaceHistoryResponse{
+		WorkspaceID: workspace.ID,
+		Status:      workspace.Status,
+		History:     make([]api.WorkspaceStatusChangeResponse, len(history)),
+	}
+	for i, change := range history {
+		resp.History[i] = api.WorkspaceStatusChangeResponse{
+			ToStatus:  change.ToStatus,
+			Reason:    change.Reason,
+			CreatedAt: change.CreatedAt,
+		}
+		if change.FromStatus != nil {
+			resp.History[i].FromStatus = *change.FromStatus
+		}
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) retryWorkspace(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		return
+	}
+
+	workspace, err := s.workspaceService.GetWorkspace(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", err)
+		return
+	}
+	if workspace.Status != storage.WorkspaceStatusFailed {
+		respondError(w, http.StatusConflict, fmt.Sprintf("Only failed workspaces can be retried (status: %s)", workspace.Status), nil)
+		return
+	}
+
+	taskID, err := s.workspaceService.RetryWorkspace(r.Context(), id)
+	if err != nil {
+		respondError(w, taskErrorStatus(err), "Failed to retry workspace", err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, api.RetryWorkspaceResponse{
+		TaskID:      taskID,
+		WorkspaceID: id,
+		ResumeFrom:  workspace.CreatePhase,
+	})
+}
+
+// cloneWorkspace creates a workspace from a ready one, copying its working
+// directory, so an AI session can branch off without losing the original
+func (s *Server) cloneWorkspace(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		return
+	}
+
+	var req api.CloneWorkspaceRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body", err)
+			return
+		}
+	}
+
+	workspace, err := s.workspaceService.GetWorkspace(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", err)
+		return
+	}
+	if workspace.Status != storage.WorkspaceStatusReady || workspace.VMID == nil {
+		respondError(w, http.StatusConflict, fmt.Sprintf("Only ready workspaces can be cloned (status: %s)", workspace.Status), nil)
+		return
+	}
+
+	memoryMB := 512
+	if v, ok := workspace.Metadata["memory_mb"].(float64); ok && v > 0 {
+		memoryMB = int(v)
+	}
+	decision := s.admitVMRequest(w, r, "", memoryMB)
+	if decision == nil {
+		return
+	}
+
+	taskID, cloneID, err := s.workspaceService.CloneWorkspace(r.Context(), id, &req)
+	if err != nil {
+		respondError(w, taskErrorStatus(err), "Failed to clone workspace", err)
+		return
+	}
+
+	resp := api.CreateWorkspaceResponse{
+		TaskID:      taskID,
+		WorkspaceID: cloneID,
+		Status:      storage.WorkspaceStatusCreating,
+	}
+	if decision.Saturated {
+		resp.Status = "queued"
+		resp.QueuePosition = decision.QueuePosition
+	}
+
+	respondJSON(w, http.StatusAccepted, resp)
+}
+
+func (s *Server) deleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		return
+	}
+
+	taskID, err := s.workspaceService.DeleteWorkspace(r.Context(), id)
+	if err != nil {
+		respondError(w, taskErrorStatus(err), "Failed to delete workspace", err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, api.TaskResponse{
+		ID:     taskID,
+		Type:   "workspace:delete",
+		Status: "pending",
+	})
+}
+
+func (s *Server) saveWorkspaceAsEnvironment(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		return
+	}
+
+	var req api.SaveAsEnvironmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	if req.Name == "" {
+		respondError(w, http.StatusBadRequest, "Name is required", nil)
+		return
+	}
+
+	if _, err := s.workspaceService.GetWorkspace(r.Context(), id); err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", err)
+		return
+	}
+
+	env, snapshotTaskID, err := s.workspaceService.SaveAsEnvironment(r.Context(), id, &req)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save workspace as environment", err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, api.SaveAsEnvironmentResponse{
+		Environment:    storageEnvironmentToResponse(env),
+		SnapshotTaskID: snapshotTaskID,
+	})
+}
+
+func (s *Server) submitPrompt(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	workspaceID, err := uuid.Parse(idStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		return
+	}
+
+	var req api.SubmitPromptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	if req.Prompt == "" {
+		respondError(w, http.StatusBadRequest, "Prompt is required", nil)
+		return
+	}
+
+	promptID, err := s.workspaceService.SubmitPrompt(r.Context(), workspaceID, &req)
+	if err != nil {
+		respondPromptError(w, err)
+		return
+	}
+
+	resp := api.SubmitPromptResponse{
+		PromptID:    promptID,
+		WorkspaceID: workspaceID,
+		Status:      "pending",
+	}
+	if prompt, err := s.workspaceService.GetPrompt(r.Context(), promptID); err == nil {
+		resp.Position, resp.ETASeconds = s.estimatePrompt(r.Context(), prompt)
+	}
+
+	respondJSON(w, http.StatusAccepted, resp)
+}
+
+func (s *Server) listPrompts(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	workspaceID, err := uuid.Parse(idStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		return
+	}
+
+	prompts, err := s.workspaceService.ListPrompts(r.Context(), workspaceID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list prompts", err)
+		return
+	}
+
+	responses := make([]*api.PromptResponse, len(prompts))
+	for i, p := range prompts {
+		responses[i] = storagePromptToResponse(p)
+	}
+
+	respondJSON(w, http.StatusOK, api.ListPromptsResponse{
+		Prompts: responses,
+		Total:   len(responses),
+	})
+}
+
+func (s *Server) getPrompt(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "promptId")
+	promptID, err := uuid.Parse(idStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid prompt ID", err)
+		return
+	}
+
+	prompt, err := s.workspaceService.GetPrompt(r.Context(), promptID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Prompt not found", err)
+		return
+	}
+
+	resp := storagePromptToResponse(prompt)
+	resp.Position, resp.ETASeconds = s.estimatePrompt(r.Context(), prompt)
+	if prompt.Attempt > 1 {
+		attempts, err := s.workspaceService.ListPromptAttempts(r.Context(), promptID)
+		if err != nil {
+			log.Printf("Warning: Failed to list attempts of prompt %s: %v", promptID, err)
+		}
+		for _, a := range attempts {
+			resp.Attempts = append(resp.Attempts, storagePromptAttemptToResponse(a))
+		}
+	}
+	attachments, err := s.workspaceService.ListPromptAttachments(r.Context(), promptID)
+	if err != nil {
+		log.Printf("Warning: Failed to list attachments of prompt %s: %v", promptID, err)
+	}
+	for _, a := range attachments {
+		resp.Attachments = append(resp.Attachments, storageAttachmentToResponse(a))
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// estimatePrompt returns a prompt's queue position and ETA in seconds. The
+// estimate is best effort: zeros are returned when it can't be made.
+func (s *Server) estimatePrompt(ctx context.Context, prompt *storage.PromptTask) (int, int) {
+	estimate, err := s.workspaceService.EstimatePrompt(ctx, prompt)
+	if err != nil {
+		log.Printf("Warning: Failed to estimate prompt %s: %v", prompt.ID, err)
+		return 0, 0
+	}
+	if estimate == nil {
+		return 0, 0
+	}
+	return estimate.Position, int(estimate.ETA.Seconds())
+}
+
+func (s *Server) addSecret(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	workspaceID, err := uuid.Parse(idStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		return
+	}
+
+	var req api.AddSecretRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	if req.Name == "" || req.Value == "" {
+		respondError(w, http.StatusBadRequest, "Name and value are required", nil)
+		return
+	}
+
+	secretID, err := s.workspaceService.AddSecret(r.Context(), workspaceID, &req)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to add secret", err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, api.AddSecretResponse{
+		SecretID: secretID,
+		Name:     req.Name,
+		Status:   "created",
+	})
+}
+
+func (s *Server) listSecrets(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	workspaceID, err := uuid.Parse(idStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		return
+	}
+
+	// Include secrets inherited from the workspace's environment
+	secrets, err := s.workspaceService.EffectiveSecrets(r.Context(), workspaceID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list secrets", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, secretsResponse(secrets))
+}
+
+// secretsResponse converts secrets to their API form. Only metadata is
+// returned, never the actual values.
+func secretsResponse(secrets []*storage.WorkspaceSecret) api.ListSecretsResponse {
+	responses := make([]*api.SecretResponse, len(secrets))
+	for i, secret := range secrets {
+		description := ""
+		if secret.Description != nil {
+			description = *secret.Description
+		}
+		responses[i] = &api.SecretResponse{
+			ID:            secret.ID,
+			Name:          secret.Name,
+			Type:          secret.SecretType,
+			Description:   description,
+			Scope:         secret.Scope,
+			WorkspaceID:   secret.WorkspaceID,
+			EnvironmentID: secret.EnvironmentID,
+			CreatedAt:     secret.CreatedAt,
+			UpdatedAt:     secret.UpdatedAt,
+			LastUsedAt:    secret.LastUsedAt,
+		}
+	}
+
+	return api.ListSecretsResponse{
+		Secrets: responses,
+		Total:   len(responses),
+	}
+}
+
+func (s *Server) deleteSecret(w http.ResponseWriter, r *http.Request) {
+	secretIDStr := chi.URLParam(r, "secretId")
+	secretID, err := uuid.Parse(secretIDStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid secret ID", err)
+		return
+	}
+
+	if err := s.workspaceService.DeleteSecret(r.Context(), secretID); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete secret", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// addEnvironmentSecret adds a secret inherited by every workspace created
+// from the environment
+func (s *Server) addEnvironmentSecret(w http.ResponseWriter, r *http.Request) {
+	environmentID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
+		return
+	}
+
+	var req api.AddSecretRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	if req.Name == "" || req.Value == "" {
+		respondError(w, http.StatusBadRequest, "Name and value are required", nil)
+		return
+	}
+
+	if _, err := s.store.Environments().Get(r.Context(), environmentID); err != nil {
+		respondError(w, http.StatusNotFound, "Environment not found", err)
+		return
+	}
+
+	secretID, err := s.workspaceService.AddEnvironmentSecret(r.Context(), environmentID, &req)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to add secret", err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, api.AddSecretResponse{
+		SecretID: secretID,
+		Name:     req.Name,
+		Status:   "created",
+	})
+}
+
+func (s *Server) listEnvironmentSecrets(w http.ResponseWriter, r *http.Request) {
+	environmentID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
+		return
+	}
+
+	secrets, err := s.workspaceService.ListEnvironmentSecrets(r.Context(), environmentID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list secrets", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, secretsResponse(secrets))
+}
+
+func (s *Server) deleteEnvironmentSecret(w http.ResponseWriter, r *http.Request) {
+	environmentID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
+		return
+	}
+	secretID, err := uuid.Parse(chi.URLParam(r, "secretId"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid secret ID", err)
+		return
+	}
+
+	secret, err := s.store.Secrets().Get(r.Context(), secretID)
+	if err != nil || secret.EnvironmentID == nil || *secret.EnvironmentID != environmentID {
+		respondError(w, http.StatusNotFound, "Secret not found", err)
+		return
+	}
+
+	if err := s.workspaceService.DeleteSecret(r.Context(), secretID); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete secret", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// listSecretUsage returns the latest times a secret reached a VM
+func (s *Server) listSecretUsage(w http.ResponseWriter, r *http.Request) {
+	secretID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid secret ID", err)
+		return
+	}
+
+	secret, err := s.store.Secrets().Get(r.Context(), secretID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Secret not found", err)
+		return
+	}
+
+	limit := 100
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit < 1 || limit > 1000 {
+			respondError(w, http.StatusBadRequest, "Invalid limit", fmt.Errorf("limit must be between 1 and 1000"))
+			return
+		}
+	}
+
+	usages, err := s.workspaceService.ListSecretUsage(r.Context(), secretID, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list secret usage", err)
+		return
+	}
+
+	responses := make([]*api.SecretUsageResponse, len(usages))
+	for i, usage := range usages {
+		responses[i] = &api.SecretUsageResponse{
+			RequestType: usage.RequestType,
+			WorkspaceID: usage.WorkspaceID,
+			VMID:        usage.VMID,
+			UsedAt:      usage.UsedAt,
+		}
+	}
+
+	respondJSON(w, http.StatusOK, api.ListSecretUsageResponse{
+		SecretID:   secretID,
+		LastUsedAt: secret.LastUsedAt,
+		Usages:     responses,
+		Total:      len(responses),
+	})
+}
+
+// listUnusedSecrets reports secrets that haven't reached a VM in the last
+// ?days (default 30), to help clean up stale credentials
+func (s *Server) listUnusedSecrets(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		var err error
+		if days, err = strconv.Atoi(daysStr); err != nil || days < 1 {
+			respondError(w, http.StatusBadRequest, "Invalid days", fmt.Errorf("days must be a positive integer"))
+			return
+		}
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	secrets, err := s.workspaceService.UnusedSecrets(r.Context(), since)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list unused secrets", err)
+		return
+	}
+
+	list := secretsResponse(secrets)
+	respondJSON(w, http.StatusOK, api.UnusedSecretsResponse{
+		Since:   since,
+		Secrets: list.Secrets,
+		Total:   list.Total,
+	})
+}
+
+func (s *Server) workspaceSession(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	workspaceID, err := uuid.Parse(idStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		return
+	}
+
+	s.sessionManager.HandleSession(w, r, workspaceID)
+}
+
+// Environment handlers
+
+func (s *Server) createEnvironment(w http.ResponseWriter, r *http.Request) {
+	var req api.CreateEnvironmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	// Validate required fields
+	if req.Name == "" {
+		respondError(w, http.StatusBadRequest, "Name is required", nil)
+		return
+	}
+	if req.FailoverPolicy != "" && !storage.ValidFailoverPolicy(req.FailoverPolicy) {
+		respondError(w, http.StatusBadRequest, "Invalid failover policy",
+			fmt.Errorf("failover_policy must be %q or %q", storage.EnvironmentFailoverNone, storage.EnvironmentFailoverAnyZone))
+		return
+	}
+	if err := vmm.ValidateKernelArgs(req.KernelArgs); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid kernel args", err)
+		return
+	}
+	if err := validateSandbox(req.Sandbox); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid sandbox profile", err)
+		return
+	}
+	services := apiServicesToStorage(req.Services)
+	if err := storage.ValidateServices(services); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid services", err)
+		return
+	}
+	docker := apiDockerToStorage(req.Docker)
+	if err := storage.ValidateDocker(docker); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid docker profile", err)
+		return
+	}
+	if req.PromptTimeoutSeconds < 0 {
+		respondError(w, http.StatusBadRequest, "Invalid prompt timeout", fmt.Errorf("prompt_timeout_seconds must not be negative"))
+		return
+	}
+	if req.SchedulingStrategy != "" {
+		if _, err := scheduler.Lookup(req.SchedulingStrategy); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid scheduling strategy", err)
+			return
+		}
+	}
+	redaction := apiRedactionToStorage(req.Redaction)
+	if redaction != nil {
+		if err := redact.ValidatePatterns(redaction.Patterns); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid redaction policy", err)
+			return
+		}
+	}
+
+	// Convert request to storage type
+	env := &storage.Environment{
+		Name:                 req.Name,
+		GitRepoURL:           req.GitRepoURL,
+		GitBranch:            req.GitBranch,
+		WorkingDirectory:     req.WorkingDirectory,
+		VCPUs:                req.VCPUs,
+		MemoryMB:             req.MemoryMB,
+		Tools:                req.Tools,
+		EnvVars:              req.EnvVars,
+		IdleTimeoutSeconds:   req.IdleTimeoutSeconds,
+		PromptTimeoutSeconds: req.PromptTimeoutSeconds,
+		Sandbox:              apiSandboxToStorage(req.Sandbox),
+		KernelArgs:           req.KernelArgs,
+		Services:             services,
+		Docker:               docker,
+		FailoverPolicy:       req.FailoverPolicy,
+		Region:               req.Region,
+		SchedulingStrategy:   req.SchedulingStrategy,
+		Redaction:            redaction,
+		Platform:             req.Platform,
+	}
+	if err := storage.ValidatePlatform(env); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid platform", err)
+		return
+	}
+
+	if req.Description != "" {
+		env.Description = &req.Description
+	}
+
+	// Convert MCP servers
+	if len(req.MCPServers) > 0 {
+		env.MCPServers = make([]storage.MCPServerConfig, len(req.MCPServers))
+		for i, mcp := range req.MCPServers {
+			env.MCPServers[i] = storage.MCPServerConfig{
+				Name:    mcp.Name,
+				Type:    storage.MCPServerType(mcp.Type),
+				Command: mcp.Command,
+				Args:    mcp.Args,
+				URL:     mcp.URL,
+				Headers: mcp.Headers,
+				Env:     mcp.Env,
+			}
+		}
+	}
+
+	if err := s.store.Environments().Create(r.Context(), env); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create environment", err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, storageEnvironmentToResponse(env))
+}
+
+func (s *Server) listEnvironments(w http.ResponseWriter, r *http.Request) {
+	environments, err := s.store.Environments().List(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list environments", err)
+		return
+	}
+
+	responses := make([]*api.EnvironmentResponse, len(environments))
+	for i, env := range environments {
+		responses[i] = storageEnvironmentToResponse(env)
+	}
+
+	resp := api.ListEnvironmentsResponse{Environments: responses}
+	if wantsFederatedList(r) {
+		resp.ClusterErrors = s.federation.fanOut(r.Context(), localListPath(r), func(cluster string, body json.RawMessage) error {
+			var remote api.ListEnvironmentsResponse
+			if err := json.Unmarshal(body, &remote); err != nil {
+				return err
+			}
+			for _, env := range remote.Environments {
+				env.Cluster = cluster
+				resp.Environments = append(resp.Environments, env)
+			}
+			return nil
+		})
+	}
+	resp.Total = len(resp.Environments)
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) getEnvironment(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
+		return
+	}
+
+	env, err := s.store.Environments().Get(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Environment not found", err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, stats)
+	respondJSON(w, http.StatusOK, storageEnvironmentToResponse(env))
 }
 
-func (s *Server) getVMDistribution(w http.ResponseWriter, r *http.Request) {
-	distribution, err := s.workerService.GetVMDistribution(r.Context())
+func (s *Server) updateEnvironment(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to get VM distribution", err)
+		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"distribution":  distribution,
-		"total_workers": len(distribution),
-	})
-}
-
-// Workspace handlers
+	// Get existing environment
+	env, err := s.store.Environments().Get(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Environment not found", err)
+		return
+	}
 
-func (s *Server) createWorkspace(w http.ResponseWriter, r *http.Request) {
-	var req api.CreateWorkspaceRequest
+	var req api.UpdateEnvironmentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
-	// Validate required fields
-	if req.Name == "" {
-		respondError(w, http.StatusBadRequest, "Name is required", nil)
-		return
+	// Update fields if provided
+	if req.Name != "" {
+		env.Name = req.Name
 	}
-	if req.VCPUs < 1 {
-		req.VCPUs = 1
+	if req.Description != "" {
+		env.Description = &req.Description
 	}
-	if req.MemoryMB < 128 {
-		req.MemoryMB = 512
+	if req.VCPUs > 0 {
+		env.VCPUs = req.VCPUs
 	}
-	if req.AIAssistant == "" {
-		req.AIAssistant = "claude-code"
+	if req.MemoryMB > 0 {
+		env.MemoryMB = req.MemoryMB
+	}
+	if req.GitRepoURL != "" {
+		env.GitRepoURL = req.GitRepoURL
+	}
+	if req.GitBranch != "" {
+		env.GitBranch = req.GitBranch
+	}
+	if req.WorkingDirectory != "" {
+		env.WorkingDirectory = req.WorkingDirectory
+	}
+	if req.Tools != nil {
+		env.Tools = req.Tools
+	}
+	if req.EnvVars != nil {
+		env.EnvVars = req.EnvVars
+	}
+	if req.IdleTimeoutSeconds > 0 {
+		env.IdleTimeoutSeconds = req.IdleTimeoutSeconds
+	}
+	if req.PromptTimeoutSeconds > 0 {
+		env.PromptTimeoutSeconds = req.PromptTimeoutSeconds
+	}
+	if req.Sandbox != nil {
+		if err := validateSandbox(req.Sandbox); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid sandbox profile", err)
+			return
+		}
+		env.Sandbox = apiSandboxToStorage(req.Sandbox)
+	}
+	if req.KernelArgs != nil {
+		if err := vmm.ValidateKernelArgs(req.KernelArgs); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid kernel args", err)
+			return
+		}
+		env.KernelArgs = req.KernelArgs
+	}
+	if req.Services != nil {
+		services := apiServicesToStorage(req.Services)
+		if err := storage.ValidateServices(services); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid services", err)
+			return
+		}
+		env.Services = services
+	}
+	if req.Docker != nil {
+		docker := apiDockerToStorage(req.Docker)
+		if err := storage.ValidateDocker(docker); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid docker profile", err)
+			return
+		}
+		env.Docker = docker
+	}
+	if req.FailoverPolicy != "" {
+		if !storage.ValidFailoverPolicy(req.FailoverPolicy) {
+			respondError(w, http.StatusBadRequest, "Invalid failover policy",
+				fmt.Errorf("failover_policy must be %q or %q", storage.EnvironmentFailoverNone, storage.EnvironmentFailoverAnyZone))
+			return
+		}
+		env.FailoverPolicy = req.FailoverPolicy
+	}
+	if req.Region != nil {
+		env.Region = *req.Region
+	}
+	if req.SchedulingStrategy != nil {
+		if *req.SchedulingStrategy != "" {
+			if _, err := scheduler.Lookup(*req.SchedulingStrategy); err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid scheduling strategy", err)
+				return
+			}
+		}
+		env.SchedulingStrategy = *req.SchedulingStrategy
+	}
+	if req.Redaction != nil {
+		redaction := apiRedactionToStorage(req.Redaction)
+		if err := redact.ValidatePatterns(redaction.Patterns); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid redaction policy", err)
+			return
+		}
+		env.Redaction = redaction
+	}
+	if req.Platform != nil {
+		env.Platform = *req.Platform
+		if env.Platform == "" {
+			env.Platform = storage.EnvironmentPlatformLinux
+		}
+	}
+	// Checked after all changes apply, as a Windows environment rules out
+	// tools, docker and other Linux features
+	if err := storage.ValidatePlatform(env); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid platform", err)
+		return
 	}
 
-	taskID, workspaceID, err := s.workspaceService.CreateWorkspace(r.Context(), &req)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to create workspace", err)
+	// Update MCP servers if provided
+	if req.MCPServers != nil {
+		env.MCPServers = make([]storage.MCPServerConfig, len(req.MCPServers))
+		for i, mcp := range req.MCPServers {
+			env.MCPServers[i] = storage.MCPServerConfig{
+				Name:    mcp.Name,
+				Type:    storage.MCPServerType(mcp.Type),
+				Command: mcp.Command,
+				Args:    mcp.Args,
+				URL:     mcp.URL,
+				Headers: mcp.Headers,
+				Env:     mcp.Env,
+			}
+		}
+	}
+
+	if err := s.store.Environments().Update(r.Context(), env); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update environment", err)
 		return
 	}
 
-	respondJSON(w, http.StatusAccepted, api.CreateWorkspaceResponse{
-		TaskID:      taskID,
-		WorkspaceID: workspaceID,
-		Status:      "creating",
-	})
+	respondJSON(w, http.StatusOK, storageEnvironmentToResponse(env))
 }
 
-func (s *Server) listWorkspaces(w http.ResponseWriter, r *http.Request) {
-	workspaces, err := s.workspaceService.ListWorkspaces(r.Context())
+func (s *Server) deleteEnvironment(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to list workspaces", err)
+		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
 		return
 	}
 
-	responses := make([]*api.WorkspaceResponse, len(workspaces))
-	for i, ws := range workspaces {
-		responses[i] = storageWorkspaceToResponse(ws)
+	if _, err := s.store.Environments().Get(r.Context(), id); err != nil {
+		respondError(w, http.StatusNotFound, "Environment not found", err)
+		return
 	}
 
-	respondJSON(w, http.StatusOK, api.ListWorkspacesResponse{
-		Workspaces: responses,
-		Total:      len(responses),
+	// With force, workspaces using the environment are detached (environment_id
+	// is set to NULL) and can no longer spawn on-demand VMs from it
+	force := r.URL.Query().Get("force") == "true"
+
+	var inUse []*storage.Workspace
+	err = s.store.WithTx(r.Context(), func(tx storage.Store) error {
+		workspaces, err := tx.Workspaces().ListByEnvironment(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		if len(workspaces) > 0 && !force {
+			inUse = workspaces
+			return nil
+		}
+		if len(workspaces) > 0 {
+			log.Printf("Force-deleting environment %s, detaching %d workspace(s)", id, len(workspaces))
+		}
+		return tx.Environments().Delete(r.Context(), id)
 	})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete environment", err)
+		return
+	}
+
+	if inUse != nil {
+		resp := api.EnvironmentInUseResponse{
+			ErrorResponse: api.ErrorResponse{
+				Error:   http.StatusText(http.StatusConflict),
+				Message: fmt.Sprintf("Environment is used by %d workspace(s); delete them first or retry with ?force=true to detach them", len(inUse)),
+				Code:    http.StatusConflict,
+			},
+			Workspaces: make([]*api.WorkspaceResponse, len(inUse)),
+		}
+		for i, ws := range inUse {
+			resp.Workspaces[i] = storageWorkspaceToResponse(ws)
+		}
+		respondJSON(w, http.StatusConflict, resp)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
-func (s *Server) getWorkspace(w http.ResponseWriter, r *http.Request) {
+func (s *Server) listEnvironmentWorkspaces(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
 		return
 	}
 
-	workspace, err := s.workspaceService.GetWorkspace(r.Context(), id)
+	if _, err := s.store.Environments().Get(r.Context(), id); err != nil {
+		respondError(w, http.StatusNotFound, "Environment not found", err)
+		return
+	}
+
+	workspaces, err := s.store.Workspaces().ListByEnvironment(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusNotFound, "Workspace not found", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list environment workspaces", err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, storageWorkspaceToResponse(workspace))
+	responses := make([]*api.WorkspaceResponse, len(workspaces))
+	for i, ws := range workspaces {
+		responses[i] = storageWorkspaceToResponse(ws)
+	}
+
+	respondJSON(w, http.StatusOK, api.ListWorkspacesResponse{
+		Workspaces: responses,
+		Total:      len(responses),
+	})
 }
 
-func (s *Server) deleteWorkspace(w http.ResponseWriter, r *http.Request) {
+// getEnvironmentLock returns an environment's tool lock
+func (s *Server) getEnvironmentLock(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
 		return
 	}
 
-	taskID, err := s.workspaceService.DeleteWorkspace(r.Context(), id)
+	env, err := s.store.Environments().Get(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to delete workspace", err)
+		respondError(w, http.StatusNotFound, "Environment not found", err)
+		return
+	}
+	if env.ToolLock == nil {
+		respondError(w, http.StatusNotFound, "Environment tools are not locked", nil)
 		return
 	}
 
-	respondJSON(w, http.StatusAccepted, api.TaskResponse{
-		ID:     taskID,
-		Type:   "workspace:delete",
-		Status: "pending",
-	})
+	respondJSON(w, http.StatusOK, storageLockfileToResponse(env.ToolLock))
 }
 
-func (s *Server) submitPrompt(w http.ResponseWriter, r *http.Request) {
+// lockEnvironmentTools resolves the exact release of each of an environment's
+// tools and pins them for every VM spawned from it afterwards
+func (s *Server) lockEnvironmentTools(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
-	workspaceID, err := uuid.Parse(idStr)
+	id, err := uuid.Parse(idStr)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
 		return
 	}
 
-	var req api.SubmitPromptRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body", err)
-		return
+	var req api.LockEnvironmentToolsRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body", err)
+			return
+		}
 	}
 
-	if req.Prompt == "" {
-		respondError(w, http.StatusBadRequest, "Prompt is required", nil)
+	if _, err := s.store.Environments().Get(r.Context(), id); err != nil {
+		respondError(w, http.StatusNotFound, "Environment not found", err)
 		return
 	}
 
-	promptID, err := s.workspaceService.SubmitPrompt(r.Context(), workspaceID, &req)
+	lock, err := s.envService.LockTools(r.Context(), id, req.Versions)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to submit prompt", err)
+		respondError(w, http.StatusBadRequest, "Failed to lock environment tools", err)
 		return
 	}
 
-	respondJSON(w, http.StatusAccepted, api.SubmitPromptResponse{
-		PromptID:    promptID,
-		WorkspaceID: workspaceID,
-		Status:      "pending",
-	})
+	respondJSON(w, http.StatusOK, storageLockfileToResponse(lock))
 }
 
-func (s *Server) listPrompts(w http.ResponseWriter, r *http.Request) {
+// unlockEnvironmentTools removes an environment's tool lock
+func (s *Server) unlockEnvironmentTools(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
-	workspaceID, err := uuid.Parse(idStr)
+	id, err := uuid.Parse(idStr)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
 		return
 	}
 
-	prompts, err := s.workspaceService.ListPrompts(r.Context(), workspaceID)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to list prompts", err)
+	if err := s.envService.UnlockTools(r.Context(), id); err != nil {
+		respondError(w, http.StatusNotFound, "Environment not found", err)
 		return
 	}
 
-	responses := make([]*api.PromptResponse, len(prompts))
-	for i, p := range prompts {
-		responses[i] = storagePromptToResponse(p)
-	}
-
-	respondJSON(w, http.StatusOK, api.ListPromptsResponse{
-		Prompts: responses,
-		Total:   len(responses),
-	})
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (s *Server) getPrompt(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "promptId")
-	promptID, err := uuid.Parse(idStr)
+// VM GC policy handlers
+
+func (s *Server) listGCPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := s.store.VMGCPolicies().List(r.Context())
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid prompt ID", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list GC policies", err)
 		return
 	}
 
-	prompt, err := s.workspaceService.GetPrompt(r.Context(), promptID)
-	if err != nil {
-		respondError(w, http.StatusNotFound, "Prompt not found", err)
-		return
+	responses := make([]*api.VMGCPolicyResponse, len(policies))
+	for i, p := range policies {
+		responses[i] = storageGCPolicyToResponse(p)
 	}
 
-	respondJSON(w, http.StatusOK, storagePromptToResponse(prompt))
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"policies": responses,
+		"total":    len(responses),
+	})
 }
 
-func (s *Server) addSecret(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	workspaceID, err := uuid.Parse(idStr)
+func (s *Server) getGCPolicy(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+
+	policy, err := s.store.VMGCPolicies().Get(r.Context(), project)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		respondError(w, http.StatusNotFound, "GC policy not found", err)
 		return
 	}
 
-	var req api.AddSecretRequest
+	respondJSON(w, http.StatusOK, storageGCPolicyToResponse(policy))
+}
+
+func (s *Server) putGCPolicy(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+
+	var req api.VMGCPolicyRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
-	if req.Name == "" || req.Value == "" {
-		respondError(w, http.StatusBadRequest, "Name and value are required", nil)
+	if req.MaxAgeSeconds < 0 || req.MaxIdleSeconds < 0 || req.WarningSeconds < 0 {
+		respondError(w, http.StatusBadRequest, "Durations must not be negative", nil)
 		return
 	}
 
-	secretID, err := s.workspaceService.AddSecret(r.Context(), workspaceID, &req)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to add secret", err)
-		return
+	policy := &storage.VMGCPolicy{
+		Project:        project,
+		MaxAgeSeconds:  req.MaxAgeSeconds,
+		MaxIdleSeconds: req.MaxIdleSeconds,
+		WarningSeconds: req.WarningSeconds,
+		Enabled:        req.Enabled == nil || *req.Enabled,
 	}
-
-	respondJSON(w, http.StatusCreated, api.AddSecretResponse{
-		SecretID: secretID,
-		Name:     req.Name,
-		Status:   "created",
-	})
-}
-
-func (s *Server) listSecrets(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	workspaceID, err := uuid.Parse(idStr)
-	if err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
-		return
+	if policy.WarningSeconds == 0 {
+		policy.WarningSeconds = 300
 	}
 
-	secrets, err := s.workspaceService.ListSecrets(r.Context(), workspaceID)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to list secrets", err)
+	if err := s.store.VMGCPolicies().Upsert(r.Context(), policy); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save GC policy", err)
 		return
 	}
 
-	// Only return metadata, never the actual values
-	responses := make([]*api.SecretResponse, len(secrets))
-	for i, secret := range secrets {
-		description := ""
-		if secret.Description != nil {
-			description = *secret.Description
-		}
-		responses[i] = &api.SecretResponse{
-			ID:          secret.ID,
-			Name:        secret.Name,
-			Type:        secret.SecretType,
-			Description: description,
-			Scope:       secret.Scope,
-			CreatedAt:   secret.CreatedAt,
-			UpdatedAt:   secret.UpdatedAt,
-		}
+	respondJSON(w, http.StatusOK, storageGCPolicyToResponse(policy))
+}
+
+func (s *Server) deleteGCPolicy(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+
+	if err := s.store.VMGCPolicies().Delete(r.Context(), project); err != nil {
+		respondError(w, http.StatusNotFound, "GC policy not found", err)
+		return
 	}
 
-	respondJSON(w, http.StatusOK, api.ListSecretsResponse{
-		Secrets: responses,
-		Total:   len(responses),
-	})
+	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
-func (s *Server) deleteSecret(w http.ResponseWriter, r *http.Request) {
-	secretIDStr := chi.URLParam(r, "secretId")
-	secretID, err := uuid.Parse(secretIDStr)
+// Capacity policy handlers
+
+func (s *Server) listCapacityPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := s.store.CapacityPolicies().List(r.Context())
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid secret ID", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list capacity policies", err)
 		return
 	}
 
-	if err := s.workspaceService.DeleteSecret(r.Context(), secretID); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to delete secret", err)
-		return
+	responses := make([]*api.CapacityPolicyResponse, len(policies))
+	for i, p := range policies {
+		responses[i] = storageCapacityPolicyToResponse(p)
 	}
 
-	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
-}
-
-func (s *Server) workspaceSession(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement WebSocket session handler
-	// This will be implemented in pkg/websocket/session.go
-	respondError(w, http.StatusNotImplemented, "WebSocket sessions not yet implemented", nil)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"policies": responses,
+		"total":    len(responses),
+	})
 }
 
-// Environment handlers
+func (s *Server) putCapacityPolicy(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
 
-func (s *Server) createEnvironment(w http.ResponseWriter, r *http.Request) {
-	var req api.CreateEnvironmentRequest
+	var req api.CapacityPolicyRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
-	// Validate required fields
-	if req.Name == "" {
-		respondError(w, http.StatusBadRequest, "Name is required", nil)
+	if !service.IsValidCapacityPolicy(req.Policy) {
+		respondError(w, http.StatusBadRequest, "Policy must be one of: reject, queue, burst", nil)
 		return
 	}
-
-	// Convert request to storage type
-	env := &storage.Environment{
-		Name:               req.Name,
-		GitRepoURL:         req.GitRepoURL,
-		GitBranch:          req.GitBranch,
-		WorkingDirectory:   req.WorkingDirectory,
-		VCPUs:              req.VCPUs,
-		MemoryMB:           req.MemoryMB,
-		Tools:              req.Tools,
-		EnvVars:            req.EnvVars,
-		IdleTimeoutSeconds: req.IdleTimeoutSeconds,
+	if req.RetryAfterSeconds < 0 {
+		respondError(w, http.StatusBadRequest, "retry_after_seconds must not be negative", nil)
+		return
+	}
+	if req.RetryAfterSeconds == 0 {
+		req.RetryAfterSeconds = 30
 	}
 
-	if req.Description != "" {
-		env.Description = &req.Description
+	policy := &storage.CapacityPolicy{
+		Project:           project,
+		Policy:            req.Policy,
+		RetryAfterSeconds: req.RetryAfterSeconds,
 	}
 
-	// Convert MCP servers
-	if len(req.MCPServers) > 0 {
-		env.MCPServers = make([]storage.MCPServerConfig, len(req.MCPServers))
-		for i, mcp := range req.MCPServers {
-			env.MCPServers[i] = storage.MCPServerConfig{
-				Name:    mcp.Name,
-				Type:    storage.MCPServerType(mcp.Type),
-				Command: mcp.Command,
-				Args:    mcp.Args,
-				URL:     mcp.URL,
-				Headers: mcp.Headers,
-				Env:     mcp.Env,
-			}
-		}
+	if err := s.store.CapacityPolicies().Upsert(r.Context(), policy); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save capacity policy", err)
+		return
 	}
 
-	if err := s.store.Environments().Create(r.Context(), env); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to create environment", err)
+	respondJSON(w, http.StatusOK, storageCapacityPolicyToResponse(policy))
+}
+
+func (s *Server) deleteCapacityPolicy(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+
+	if err := s.store.CapacityPolicies().Delete(r.Context(), project); err != nil {
+		respondError(w, http.StatusNotFound, "Capacity policy not found", err)
 		return
 	}
 
-	respondJSON(w, http.StatusCreated, storageEnvironmentToResponse(env))
+	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
-func (s *Server) listEnvironments(w http.ResponseWriter, r *http.Request) {
-	environments, err := s.store.Environments().List(r.Context())
+// Alert rule handlers
+
+func (s *Server) listAlertRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.store.AlertRules().List(r.Context())
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to list environments", err)
+		respondError(w, http.StatusInternalServerError, "Failed to list alert rules", err)
 		return
 	}
 
-	responses := make([]*api.EnvironmentResponse, len(environments))
-	for i, env := range environments {
-		responses[i] = storageEnvironmentToResponse(env)
+	responses := make([]*api.AlertRuleResponse, len(rules))
+	for i, rule := range rules {
+		responses[i] = storageAlertRuleToResponse(rule)
 	}
 
-	respondJSON(w, http.StatusOK, api.ListEnvironmentsResponse{
-		Environments: responses,
-		Total:        len(responses),
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"rules": responses,
+		"total": len(responses),
 	})
 }
 
-func (s *Server) getEnvironment(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	id, err := uuid.Parse(idStr)
-	if err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
+func (s *Server) createAlertRule(w http.ResponseWriter, r *http.Request) {
+	var req api.AlertRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
-	env, err := s.store.Environments().Get(r.Context(), id)
-	if err != nil {
-		respondError(w, http.StatusNotFound, "Environment not found", err)
+	rule := &storage.AlertRule{ID: uuid.New()}
+	applyAlertRuleRequest(rule, &req)
+	if err := service.ValidateAlertRule(rule); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid alert rule", err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, storageEnvironmentToResponse(env))
+	if err := s.store.AlertRules().Create(r.Context(), rule); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create alert rule", err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, storageAlertRuleToResponse(rule))
 }
 
-func (s *Server) updateEnvironment(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	id, err := uuid.Parse(idStr)
+func (s *Server) getAlertRule(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
+		respondError(w, http.StatusBadRequest, "Invalid alert rule ID", err)
 		return
 	}
 
-	// Get existing environment
-	env, err := s.store.Environments().Get(r.Context(), id)
+	rule, err := s.store.AlertRules().Get(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusNotFound, "Environment not found", err)
+		respondError(w, http.StatusNotFound, "Alert rule not found", err)
 		return
 	}
 
-	var req api.UpdateEnvironmentRequest
+	respondJSON(w, http.StatusOK, storageAlertRuleToResponse(rule))
+}
+
+func (s *Server) updateAlertRule(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid alert rule ID", err)
+		return
+	}
+
+	var req api.AlertRuleRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
-	// Update fields if provided
-	if req.Name != "" {
-		env.Name = req.Name
-	}
-	if req.Description != "" {
-		env.Description = &req.Description
-	}
-	if req.VCPUs > 0 {
-		env.VCPUs = req.VCPUs
-	}
-	if req.MemoryMB > 0 {
-		env.MemoryMB = req.MemoryMB
-	}
-	if req.GitRepoURL != "" {
-		env.GitRepoURL = req.GitRepoURL
-	}
-	if req.GitBranch != "" {
-		env.GitBranch = req.GitBranch
-	}
-	if req.WorkingDirectory != "" {
-		env.WorkingDirectory = req.WorkingDirectory
-	}
-	if req.Tools != nil {
-		env.Tools = req.Tools
-	}
-	if req.EnvVars != nil {
-		env.EnvVars = req.EnvVars
-	}
-	if req.IdleTimeoutSeconds > 0 {
-		env.IdleTimeoutSeconds = req.IdleTimeoutSeconds
+	rule, err := s.store.AlertRules().Get(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Alert rule not found", err)
+		return
 	}
 
-	// Update MCP servers if provided
-	if req.MCPServers != nil {
-		env.MCPServers = make([]storage.MCPServerConfig, len(req.MCPServers))
-		for i, mcp := range req.MCPServers {
-			env.MCPServers[i] = storage.MCPServerConfig{
-				Name:    mcp.Name,
-				Type:    storage.MCPServerType(mcp.Type),
-				Command: mcp.Command,
-				Args:    mcp.Args,
-				URL:     mcp.URL,
-				Headers: mcp.Headers,
-				Env:     mcp.Env,
-			}
-		}
+	applyAlertRuleRequest(rule, &req)
+	if err := service.ValidateAlertRule(rule); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid alert rule", err)
+		return
 	}
 
-	if err := s.store.Environments().Update(r.Context(), env); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to update environment", err)
+	if err := s.store.AlertRules().Update(r.Context(), rule); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update alert rule", err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, storageEnvironmentToResponse(env))
+	respondJSON(w, http.StatusOK, storageAlertRuleToResponse(rule))
 }
 
-func (s *Server) deleteEnvironment(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	id, err := uuid.Parse(idStr)
+func (s *Server) deleteAlertRule(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid environment ID", err)
+		respondError(w, http.StatusBadRequest, "Invalid alert rule ID", err)
 		return
 	}
 
-	if err := s.store.Environments().Delete(r.Context(), id); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to delete environment", err)
+	if err := s.store.AlertRules().Delete(r.Context(), id); err != nil {
+		respondError(w, http.StatusNotFound, "Alert rule not found", err)
 		return
 	}
 
 	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
+// applyAlertRuleRequest sets a rule's definition from a request, replacing it
+// entirely; rules are enabled unless the request says otherwise
+func applyAlertRuleRequest(rule *storage.AlertRule, req *api.AlertRuleRequest) {
+	rule.Name = req.Name
+	rule.Kind = req.Kind
+	rule.Metric = req.Metric
+	rule.Operator = req.Operator
+	rule.Threshold = req.Threshold
+	rule.WindowSeconds = req.WindowSeconds
+	rule.Severity = req.Severity
+	rule.Enabled = req.Enabled == nil || *req.Enabled
+	rule.Notify = make([]storage.AlertTarget, len(req.Notify))
+	for i, target := range req.Notify {
+		rule.Notify[i] = storage.AlertTarget{Integration: target.Integration, Target: target.Target}
+	}
+}
+
+func storageAlertRuleToResponse(rule *storage.AlertRule) *api.AlertRuleResponse {
+	resp := &api.AlertRuleResponse{
+		ID:            rule.ID,
+		Name:          rule.Name,
+		Kind:          rule.Kind,
+		Metric:        rule.Metric,
+		Operator:      rule.Operator,
+		Threshold:     rule.Threshold,
+		WindowSeconds: rule.WindowSeconds,
+		Severity:      rule.Severity,
+		Notify:        make([]api.AlertTarget, len(rule.Notify)),
+		Enabled:       rule.Enabled,
+		Firing:        rule.Firing,
+		LastValue:     rule.LastValue,
+		LastFiredAt:   rule.LastFiredAt,
+		CreatedAt:     rule.CreatedAt,
+		UpdatedAt:     rule.UpdatedAt,
+	}
+	for i, target := range rule.Notify {
+		resp.Notify[i] = api.AlertTarget{Integration: target.Integration, Target: target.Target}
+	}
+	return resp
+}
+
+func storageCapacityPolicyToResponse(p *storage.CapacityPolicy) *api.CapacityPolicyResponse {
+	return &api.CapacityPolicyResponse{
+		Project:           p.Project,
+		Policy:            p.Policy,
+		RetryAfterSeconds: p.RetryAfterSeconds,
+		CreatedAt:         p.CreatedAt,
+		UpdatedAt:         p.UpdatedAt,
+	}
+}
+
+func storageGCPolicyToResponse(p *storage.VMGCPolicy) *api.VMGCPolicyResponse {
+	return &api.VMGCPolicyResponse{
+		Project:        p.Project,
+		MaxAgeSeconds:  p.MaxAgeSeconds,
+		MaxIdleSeconds: p.MaxIdleSeconds,
+		WarningSeconds: p.WarningSeconds,
+		Enabled:        p.Enabled,
+		CreatedAt:      p.CreatedAt,
+		UpdatedAt:      p.UpdatedAt,
+	}
+}
+
 // Environment response helper
+func storageLockfileToResponse(lock *storage.EnvironmentLockfile) *api.EnvironmentLockfile {
+	resp := &api.EnvironmentLockfile{
+		Tools:                make([]api.LockedTool, len(lock.Tools)),
+		EnvironmentUpdatedAt: lock.EnvironmentUpdatedAt,
+		ResolvedAt:           lock.ResolvedAt,
+	}
+	for i, tool := range lock.Tools {
+		resp.Tools[i] = api.LockedTool{
+			Name:       tool.Name,
+			Constraint: tool.Constraint,
+			Version:    tool.Version,
+			Artifact:   tool.Artifact,
+			Checksum:   tool.Checksum,
+		}
+	}
+	return resp
+}
+
 func storageEnvironmentToResponse(env *storage.Environment) *api.EnvironmentResponse {
 	resp := &api.EnvironmentResponse{
-		ID:                 env.ID,
-		Name:               env.Name,
-		VCPUs:              env.VCPUs,
-		MemoryMB:           env.MemoryMB,
-		GitRepoURL:         env.GitRepoURL,
-		GitBranch:          env.GitBranch,
-		WorkingDirectory:   env.WorkingDirectory,
-		Tools:              env.Tools,
-		EnvVars:            env.EnvVars,
-		IdleTimeoutSeconds: env.IdleTimeoutSeconds,
-		CreatedAt:          env.CreatedAt,
-		UpdatedAt:          env.UpdatedAt,
+		ID:                   env.ID,
+		Name:                 env.Name,
+		VCPUs:                env.VCPUs,
+		MemoryMB:             env.MemoryMB,
+		GitRepoURL:           env.GitRepoURL,
+		GitBranch:            env.GitBranch,
+		WorkingDirectory:     env.WorkingDirectory,
+		Tools:                env.Tools,
+		EnvVars:              env.EnvVars,
+		IdleTimeoutSeconds:   env.IdleTimeoutSeconds,
+		PromptTimeoutSeconds: env.PromptTimeoutSeconds,
+		KernelArgs:           env.KernelArgs,
+		Services:             storageServicesToResponse(env.Services),
+		FailoverPolicy:       env.FailoverPolicy,
+		Region:               env.Region,
+		SchedulingStrategy:   env.SchedulingStrategy,
+		Platform:             env.Platform,
+		SourceWorkspaceID:    env.SourceWorkspaceID,
+		Firewall:             env.Firewall,
+		Annotations:          storageAnnotationsToResponse(env.Annotations),
+		CreatedAt:            env.CreatedAt,
+		UpdatedAt:            env.UpdatedAt,
 	}
 
 	if env.Description != nil {
 		resp.Description = *env.Description
 	}
+	if env.RootFSImage != nil {
+		resp.RootFSImage = *env.RootFSImage
+	}
+	if env.RootFSImageWorkerID != nil {
+		resp.RootFSImageWorkerID = *env.RootFSImageWorkerID
+	}
+	if env.Redaction != nil {
+		resp.Redaction = &api.RedactionPolicy{
+			Disabled:     env.Redaction.Disabled,
+			SkipPatterns: env.Redaction.SkipPatterns,
+			Patterns:     env.Redaction.Patterns,
+		}
+	}
+	if env.Sandbox != nil {
+		resp.Sandbox = &api.SandboxProfile{
+			ReadOnlyRootFS: env.Sandbox.ReadOnlyRootFS,
+			TmpfsWorkdir:   env.Sandbox.TmpfsWorkdir,
+			TmpfsSizeMB:    env.Sandbox.TmpfsSizeMB,
+			NoNetwork:      env.Sandbox.NoNetwork,
+			RestrictProc:   env.Sandbox.RestrictProc,
+		}
+	}
+
+	if env.Docker != nil {
+		resp.Docker = &api.DockerProfile{
+			Enabled:    true,
+			DiskSizeMB: env.Docker.DiskSizeMB,
+			Registries: env.Docker.Registries,
+		}
+	}
+
+	if env.ToolLock != nil {
+		resp.ToolLock = storageLockfileToResponse(env.ToolLock)
+	}
 
 	// Convert MCP servers
 	if len(env.MCPServers) > 0 {
@@ -1273,6 +3615,94 @@ func storageEnvironmentToResponse(env *storage.Environment) *api.EnvironmentResp
 	return resp
 }
 
+// validateSandbox checks a sandbox profile from the API. Its tmpfs workdir
+// ends up in guest kernel arguments and docker flags.
+func validateSandbox(sandbox *api.SandboxProfile) error {
+	if sandbox == nil {
+		return nil
+	}
+	profile := &vmm.SandboxProfile{TmpfsWorkdir: sandbox.TmpfsWorkdir, TmpfsSizeMB: sandbox.TmpfsSizeMB}
+	return profile.Validate()
+}
+
+// apiSandboxToStorage converts a sandbox profile from the API to storage form
+func apiSandboxToStorage(sandbox *api.SandboxProfile) *storage.SandboxProfile {
+	if sandbox == nil {
+		return nil
+	}
+	return &storage.SandboxProfile{
+		ReadOnlyRootFS: sandbox.ReadOnlyRootFS,
+		TmpfsWorkdir:   sandbox.TmpfsWorkdir,
+		TmpfsSizeMB:    sandbox.TmpfsSizeMB,
+		NoNetwork:      sandbox.NoNetwork,
+		RestrictProc:   sandbox.RestrictProc,
+	}
+}
+
+// apiRedactionToStorage converts a redaction policy from the API to storage
+// form (nil = the default)
+func apiRedactionToStorage(policy *api.RedactionPolicy) *redact.Policy {
+	if policy == nil {
+		return nil
+	}
+	return &redact.Policy{
+		Disabled:     policy.Disabled,
+		SkipPatterns: policy.SkipPatterns,
+		Patterns:     policy.Patterns,
+	}
+}
+
+// apiDockerToStorage converts a Docker profile from the API to storage form
+func apiDockerToStorage(docker *api.DockerProfile) *storage.DockerProfile {
+	if docker == nil || !docker.Enabled {
+		return nil
+	}
+	return &storage.DockerProfile{
+		DiskSizeMB: docker.DiskSizeMB,
+		Registries: docker.Registries,
+	}
+}
+
+// apiServicesToStorage converts sidecar specs from the API to storage form
+func apiServicesToStorage(services []api.ServiceSpec) []storage.ServiceSpec {
+	if services == nil {
+		return nil
+	}
+	result := make([]storage.ServiceSpec, len(services))
+	for i, svc := range services {
+		result[i] = storage.ServiceSpec{
+			Name:        svc.Name,
+			Command:     svc.Command,
+			Ports:       svc.Ports,
+			Env:         svc.Env,
+			RootFSImage: svc.RootFSImage,
+			VCPUs:       svc.VCPUs,
+			MemoryMB:    svc.MemoryMB,
+		}
+	}
+	return result
+}
+
+// storageServicesToResponse converts sidecar specs to their API form
+func storageServicesToResponse(services []storage.ServiceSpec) []api.ServiceSpec {
+	if len(services) == 0 {
+		return nil
+	}
+	result := make([]api.ServiceSpec, len(services))
+	for i, svc := range services {
+		result[i] = api.ServiceSpec{
+			Name:        svc.Name,
+			Command:     svc.Command,
+			Ports:       svc.Ports,
+			Env:         svc.Env,
+			RootFSImage: svc.RootFSImage,
+			VCPUs:       svc.VCPUs,
+			MemoryMB:    svc.MemoryMB,
+		}
+	}
+	return result
+}
+
 // Workspace response helpers
 
 func storageWorkspaceToResponse(ws *storage.Workspace) *api.WorkspaceResponse {
@@ -1287,7 +3717,9 @@ func storageWorkspaceToResponse(ws *storage.Workspace) *api.WorkspaceResponse {
 		ReadyAt:           ws.ReadyAt,
 		StoppedAt:         ws.StoppedAt,
 		IdleSince:         ws.IdleSince,
+		CreatePhase:       ws.CreatePhase,
 		Metadata:          ws.Metadata,
+		Annotations:       storageAnnotationsToResponse(ws.Annotations),
 	}
 	if ws.Description != nil {
 		resp.Description = *ws.Description
@@ -1303,17 +3735,19 @@ func storageWorkspaceToResponse(ws *storage.Workspace) *api.WorkspaceResponse {
 
 func storagePromptToResponse(p *storage.PromptTask) *api.PromptResponse {
 	resp := &api.PromptResponse{
-		ID:          p.ID,
-		WorkspaceID: p.WorkspaceID,
-		Prompt:      p.Prompt,
-		Priority:    p.Priority,
-		Status:      p.Status,
-		CreatedAt:   p.CreatedAt,
-		ScheduledAt: p.ScheduledAt,
-		StartedAt:   p.StartedAt,
-		CompletedAt: p.CompletedAt,
-		DurationMS:  p.DurationMS,
-		Metadata:    p.Metadata,
+		ID:             p.ID,
+		WorkspaceID:    p.WorkspaceID,
+		Prompt:         p.Prompt,
+		Priority:       p.Priority,
+		Status:         p.Status,
+		CreatedAt:      p.CreatedAt,
+		ScheduledAt:    p.ScheduledAt,
+		StartedAt:      p.StartedAt,
+		CompletedAt:    p.CompletedAt,
+		DurationMS:     p.DurationMS,
+		Metadata:       p.Metadata,
+		TimeoutSeconds: p.TimeoutSeconds,
+		Attempt:        p.Attempt,
 	}
 	if p.SystemPrompt != nil {
 		resp.SystemPrompt = *p.SystemPrompt
@@ -1336,6 +3770,50 @@ func storagePromptToResponse(p *storage.PromptTask) *api.PromptResponse {
 	if p.Error != nil {
 		resp.Error = p.Error
 	}
+	if p.FailureReason != nil {
+		resp.FailureReason = *p.FailureReason
+		resp.Remediation = storage.PromptFailureRemediation(*p.FailureReason)
+	}
+	if p.FailureDetail != nil {
+		resp.FailureDetail = *p.FailureDetail
+	}
+	if e := p.ExecutionEnv; e != nil {
+		resp.ExecutionEnv = &api.ExecutionEnvironment{
+			WorkerID:             e.WorkerID,
+			VMID:                 e.VMID,
+			EnvironmentID:        e.EnvironmentID,
+			EnvironmentName:      e.EnvironmentName,
+			EnvironmentUpdatedAt: e.EnvironmentUpdatedAt,
+			GitRepoURL:           e.GitRepoURL,
+			GitBranch:            e.GitBranch,
+			RootFSImage:          e.RootFSImage,
+			RootFSImageSHA256:    e.RootFSImageSHA256,
+			ToolVersions:         e.ToolVersions,
+			AIAssistant:          e.AIAssistant,
+			AgentVersion:         e.AgentVersion,
+			GitCommit:            e.GitCommit,
+			EnvVarNames:          e.EnvVarNames,
+			WorkingDir:           e.WorkingDir,
+			CapturedAt:           e.CapturedAt,
+		}
+	}
+	return resp
+}
+
+func storagePromptAttemptToResponse(a *storage.PromptAttempt) *api.PromptAttempt {
+	resp := &api.PromptAttempt{
+		Attempt:       a.Attempt,
+		VMID:          a.VMID,
+		FailureReason: a.FailureReason,
+		StartedAt:     a.StartedAt,
+		FinishedAt:    a.FinishedAt,
+	}
+	if a.WorkerID != nil {
+		resp.WorkerID = *a.WorkerID
+	}
+	if a.Error != nil {
+		resp.Error = *a.Error
+	}
 	return resp
 }
 
@@ -1347,7 +3825,29 @@ func respondJSON(w http.ResponseWriter, code int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
+// taskErrorStatus maps an error from submitting a task to an HTTP status.
+// Task payloads are validated before they're enqueued, so an invalid payload
+// means a bad request; a task for the same work that is still queued or
+// running is a conflict.
+func taskErrorStatus(err error) int {
+	switch {
+	case queue.IsPayloadError(err):
+		return http.StatusBadRequest
+	case errors.Is(err, queue.ErrDuplicateTask):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func respondError(w http.ResponseWriter, code int, message string, err error) {
+	// Whatever the handler made of it, a body over the limit is a 413
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondBodyTooLarge(w, tooLarge.Limit)
+		return
+	}
+
 	errMsg := message
 	if err != nil {
 		errMsg = fmt.Sprintf("%s: %v", message, err)
@@ -1360,6 +3860,69 @@ func respondError(w http.ResponseWriter, code int, message string, err error) {
 	})
 }
 
+// pruneClusterEvents deletes timeline events older than the retention period every hour
+func pruneClusterEvents(ctx context.Context, store storage.Store, retention time.Duration) {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := store.ClusterEvents().DeleteOlderThan(ctx, time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Warning: Failed to prune cluster events: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Pruned %d cluster events older than %v", deleted, retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pruneExpiredKV deletes expired key-value entries, which reads already
+// treat as missing
+func pruneExpiredKV(ctx context.Context, store storage.Store) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		deleted, err := store.KV().DeleteExpired(ctx)
+		if err != nil {
+			log.Printf("Warning: Failed to prune expired kv entries: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Pruned %d expired kv entries", deleted)
+		}
+	}
+}
+
+func recoverLostPrompts(ctx context.Context, workspaceService *service.WorkspaceService) {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		recovered, err := workspaceService.RecoverLostPrompts(ctx)
+		if err != nil {
+			log.Printf("Warning: Failed to check for lost prompts: %v", err)
+		} else if recovered > 0 {
+			log.Printf("Recovered %d prompts lost with their worker", recovered)
+		}
+	}
+}
+
 func getEnv(key, fallback string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -1375,3 +3938,12 @@ func getEnvInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+func getEnvInt64(key string, fallback int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		if intVal, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return intVal
+		}
+	}
+	return fallback
+}
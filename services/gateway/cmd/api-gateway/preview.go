@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// previewTokenTTL is how long a preview URL keeps working
+const previewTokenTTL = 12 * time.Hour
+
+// previewCookie holds a workspace's preview token after the first visit, so
+// the app's own requests don't need it in their URL
+const previewCookie = "aetherium_preview"
+
+// previewToken signs access to a workspace's previews until expires
+func previewToken(secret []byte, workspaceID uuid.UUID, expires time.Time) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s:%d", workspaceID, expires.Unix())
+	return fmt.Sprintf("%d.%s", expires.Unix(), hex.EncodeToString(mac.Sum(nil)))
+}
+
+// checkPreviewToken reports whether token grants access to the workspace's
+// previews and hasn't expired
+func checkPreviewToken(secret []byte, workspaceID uuid.UUID, token string) bool {
+	expiresStr, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expiresUnix, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil {
+		return false
+	}
+	expires := time.Unix(expiresUnix, 0)
+	if time.Now().After(expires) {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(previewToken(secret, workspaceID, expires)))
+}
+
+// previewTarget finds the VM of a ready workspace and the worker running it
+func (s *Server) previewTarget(ctx context.Context, workspaceID uuid.UUID) (*storage.VM, *storage.Worker, int, error) {
+	workspace, err := s.store.Workspaces().Get(ctx, workspaceID)
+	if err != nil {
+		return nil, nil, http.StatusNotFound, fmt.Errorf("workspace not found")
+	}
+	if workspace.Status != storage.WorkspaceStatusReady || workspace.VMID == nil {
+		return nil, nil, http.StatusConflict, fmt.Errorf("workspace has no running VM (status: %s)", workspace.Status)
+	}
+
+	vm, err := s.store.VMs().Get(ctx, *workspace.VMID)
+	if err != nil {
+		return nil, nil, http.StatusConflict, fmt.Errorf("workspace VM not found")
+	}
+	if vm.WorkerID == nil {
+		return nil, nil, http.StatusConflict, fmt.Errorf("workspace VM is not assigned to a worker")
+	}
+	worker, err := s.store.Workers().Get(ctx, *vm.WorkerID)
+	if err != nil {
+		return nil, nil, http.StatusBadGateway, fmt.Errorf("worker %s not found", *vm.WorkerID)
+	}
+	return vm, worker, 0, nil
+}
+
+// listWorkspacePorts serves GET /workspaces/{id}/ports: the ports the
+// workspace VM listens on, reported by its agent, with preview URLs
+func (s *Server) listWorkspacePorts(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		return
+	}
+	if len(s.previewSecret) == 0 || len(s.peerSecret) == 0 {
+		respondError(w, http.StatusServiceUnavailable, "Previews are not configured", fmt.Errorf("PREVIEW_SECRET and WORKER_PEER_SECRET must be set"))
+		return
+	}
+
+	vm, worker, status, err := s.previewTarget(r.Context(), id)
+	if err != nil {
+		respondError(w, status, "Workspace preview unavailable", err)
+		return
+	}
+
+	var listed struct {
+		Ports []int `json:"ports"`
+	}
+	if status, err := s.workerRequest(r.Context(), worker, http.MethodGet, fmt.Sprintf("/vms/%s/ports", vm.ID), nil, &listed); err != nil {
+		respondError(w, status, "Failed to list ports", err)
+		return
+	}
+
+	expires := time.Now().Add(previewTokenTTL).Truncate(time.Second)
+	token := url.QueryEscape(previewToken(s.previewSecret, id, expires))
+	base := previewBaseURL(r)
+	ports := make([]api.PreviewPort, len(listed.Ports))
+	for i, port := range listed.Ports {
+		ports[i] = api.PreviewPort{
+			Port: port,
+			URL:  fmt.Sprintf("%s/preview/%s/%d/?token=%s", base, id, port, token),
+		}
+	}
+
+	respondJSON(w, http.StatusOK, api.WorkspacePortsResponse{
+		WorkspaceID: id,
+		Ports:       ports,
+		ExpiresAt:   expires,
+	})
+}
+
+// workerRequest calls a worker's VM or admin endpoints, sending body and
+// decoding the response into out when given. On failure it also returns the
+// status to respond with.
+func (s *Server) workerRequest(ctx context.Context, worker *storage.Worker, method, path string, body, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://"+worker.Address+path, reader)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	req.Header.Set("Authorization", "Bearer "+string(s.peerSecret))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return http.StatusBadGateway, fmt.Errorf("worker %s unreachable: %w", worker.ID, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return http.StatusNotFound, fmt.Errorf("%s", strings.TrimSpace(string(msg)))
+	case resp.StatusCode >= 300:
+		return http.StatusBadGateway, fmt.Errorf("worker %s returned %s", worker.ID, resp.Status)
+	}
+	if out == nil {
+		return 0, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return http.StatusBadGateway, err
+	}
+	return 0, nil
+}
+
+// runningVMWorker finds the worker running a VM. On failure it also returns
+// the status to respond with.
+func (s *Server) runningVMWorker(ctx context.Context, id uuid.UUID) (*storage.Worker, int, error) {
+	if len(s.peerSecret) == 0 {
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("WORKER_PEER_SECRET is not set")
+	}
+	vm, err := s.store.VMs().Get(ctx, id)
+	if err != nil {
+		return nil, http.StatusNotFound, fmt.Errorf("VM not found")
+	}
+	if vm.Status != string(types.VMStatusRunning) || vm.WorkerID == nil {
+		return nil, http.StatusConflict, fmt.Errorf("VM is not running (status: %s)", vm.Status)
+	}
+	worker, err := s.store.Workers().Get(ctx, *vm.WorkerID)
+	if err != nil {
+		return nil, http.StatusBadGateway, fmt.Errorf("worker %s not found", *vm.WorkerID)
+	}
+	return worker, 0, nil
+}
+
+// getVMProcesses serves GET /vms/{id}/processes: the processes and
+// listening sockets in a running VM, reported by its agent
+func (s *Server) getVMProcesses(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid VM ID", err)
+		return
+	}
+
+	worker, status, err := s.runningVMWorker(r.Context(), id)
+	if err != nil {
+		respondError(w, status, "VM processes unavailable", err)
+		return
+	}
+
+	resp := api.VMProcessesResponse{VMID: id}
+	if status, err := s.workerRequest(r.Context(), worker, http.MethodGet, fmt.Sprintf("/vms/%s/processes", id), nil, &resp); err != nil {
+		respondError(w, status, "Failed to list processes", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// signalVMProcess serves POST /vms/{id}/processes/{pid}/signal: stops a
+// runaway process in a VM without deleting the VM
+func (s *Server) signalVMProcess(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid VM ID", err)
+		return
+	}
+	pid, err := strconv.Atoi(chi.URLParam(r, "pid"))
+	if err != nil || pid <= 1 {
+		respondError(w, http.StatusBadRequest, "Invalid PID", fmt.Errorf("pid must be greater than 1"))
+		return
+	}
+
+	var req api.SignalProcessRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body", err)
+			return
+		}
+	}
+	signal := strings.TrimPrefix(strings.ToUpper(req.Signal), "SIG")
+	if signal == "" {
+		signal = "TERM"
+	}
+	if !slices.Contains(vmm.ProcessSignals, signal) {
+		respondError(w, http.StatusBadRequest, "Invalid signal",
+			fmt.Errorf("signal must be one of %s", strings.Join(vmm.ProcessSignals, ", ")))
+		return
+	}
+
+	worker, status, err := s.runningVMWorker(r.Context(), id)
+	if err != nil {
+		respondError(w, status, "Cannot signal VM processes", err)
+		return
+	}
+	path := fmt.Sprintf("/vms/%s/processes/%d/signal", id, pid)
+	if status, err := s.workerRequest(r.Context(), worker, http.MethodPost, path, map[string]string{"signal": signal}, nil); err != nil {
+		respondError(w, status, "Failed to signal process", err)
+		return
+	}
+
+	log.Printf("Sent SIG%s to process %d in VM %s", signal, pid, id)
+	respondJSON(w, http.StatusOK, api.SignalProcessResponse{VMID: id, PID: pid, Signal: signal})
+}
+
+// previewBaseURL is the gateway's external URL: PREVIEW_BASE_URL, or the
+// scheme and host the request came in on
+func previewBaseURL(r *http.Request) string {
+	if base := getEnv("PREVIEW_BASE_URL", ""); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// previewWorkspace proxies /preview/{id}/{port}/... to the port of the
+// workspace VM, through the worker running it. WebSocket upgrades pass
+// through. The token from the preview URL is traded for a cookie scoped to
+// the workspace's previews and kept from the app.
+func (s *Server) previewWorkspace(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid workspace ID", http.StatusBadRequest)
+		return
+	}
+	port, err := strconv.Atoi(chi.URLParam(r, "port"))
+	if err != nil || port < 1 || port > 65535 {
+		http.Error(w, "Invalid port", http.StatusBadRequest)
+		return
+	}
+	if len(s.previewSecret) == 0 || len(s.peerSecret) == 0 {
+		http.Error(w, "Previews are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	cookiePath := fmt.Sprintf("/preview/%s/", id)
+	query := r.URL.Query()
+	if token := query.Get("token"); token != "" {
+		if !checkPreviewToken(s.previewSecret, id, token) {
+			http.Error(w, "Invalid or expired preview token", http.StatusUnauthorized)
+			return
+		}
+		expiresUnix, _ := strconv.ParseInt(strings.SplitN(token, ".", 2)[0], 10, 64)
+		http.SetCookie(w, &http.Cookie{
+			Name:     previewCookie,
+			Value:    token,
+			Path:     cookiePath,
+			Expires:  time.Unix(expiresUnix, 0),
+			HttpOnly: true,
+			Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+			SameSite: http.SameSiteLaxMode,
+		})
+		query.Del("token")
+		r.URL.RawQuery = query.Encode()
+	} else if cookie, err := r.Cookie(previewCookie); err != nil || !checkPreviewToken(s.previewSecret, id, cookie.Value) {
+		http.Error(w, "Preview token required", http.StatusUnauthorized)
+		return
+	}
+
+	vm, worker, status, err := s.previewTarget(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	rest := chi.URLParam(r, "*")
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetXForwarded()
+			pr.Out.URL.Scheme = "http"
+			pr.Out.URL.Host = worker.Address
+			pr.Out.URL.Path = fmt.Sprintf("/preview/%s/%d/%s", vm.ID, port, rest)
+			pr.Out.URL.RawPath = ""
+			pr.Out.Host = worker.Address
+			pr.Out.Header.Set("Authorization", "Bearer "+string(s.peerSecret))
+			removeCookie(pr.Out, previewCookie)
+		},
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Preview of workspace %s port %d failed: %v", id, port, err)
+			http.Error(w, "Worker unreachable", http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// removeCookie drops one cookie from a request's Cookie headers
+func removeCookie(r *http.Request, name string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != name {
+			r.AddCookie(cookie)
+		}
+	}
+}
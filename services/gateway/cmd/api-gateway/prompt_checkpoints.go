@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// getPromptCheckpoint returns the latest checkpoint of a prompt
+func (s *Server) getPromptCheckpoint(w http.ResponseWriter, r *http.Request) {
+	promptID, err := uuid.Parse(chi.URLParam(r, "promptId"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid prompt ID", err)
+		return
+	}
+
+	checkpoint, err := s.workspaceService.GetPromptCheckpoint(r.Context(), promptID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get checkpoint", err)
+		return
+	}
+	if checkpoint == nil {
+		respondError(w, http.StatusNotFound, "Prompt has no checkpoint", nil)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, &api.PromptCheckpointResponse{
+		PromptID:      checkpoint.PromptID,
+		Attempt:       checkpoint.Attempt,
+		Sequence:      checkpoint.Sequence,
+		Stdout:        checkpoint.Stdout,
+		Stderr:        checkpoint.Stderr,
+		Diff:          checkpoint.Diff,
+		DiffTruncated: checkpoint.DiffTruncated,
+		CreatedAt:     checkpoint.CreatedAt,
+	})
+}
+
+// promptOutputStream tracks the output of a prompt sent on its stream, so
+// each checkpoint and the final result only send what is new
+type promptOutputStream struct {
+	attempt int
+	stdout  string
+	stderr  string
+}
+
+// sendCheckpoint sends the output a checkpoint adds. A retried attempt's
+// output starts over.
+func (o *promptOutputStream) sendCheckpoint(sse *sseWriter, checkpoint *storage.PromptCheckpoint) {
+	if checkpoint.Attempt != o.attempt {
+		o.attempt = checkpoint.Attempt
+		o.stdout, o.stderr = "", ""
+	}
+	o.send(sse, "stdout", &o.stdout, checkpoint.Stdout)
+	o.send(sse, "stderr", &o.stderr, checkpoint.Stderr)
+}
+
+// sendFinal sends the rest of a finished prompt's output
+func (o *promptOutputStream) sendFinal(sse *sseWriter, stdout, stderr *string) {
+	if stdout != nil {
+		o.send(sse, "stdout", &o.stdout, *stdout)
+	}
+	if stderr != nil {
+		o.send(sse, "stderr", &o.stderr, *stderr)
+	}
+}
+
+// send sends output past what was sent already, or all of it if it doesn't
+// continue what was sent
+func (o *promptOutputStream) send(sse *sseWriter, stream string, sent *string, output string) {
+	data := output
+	if strings.HasPrefix(output, *sent) {
+		data = output[len(*sent):]
+	}
+	if data != "" {
+		sse.send("output", api.StreamOutputEvent{Stream: stream, Data: data})
+	}
+	*sent = output
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aetherium/aetherium/services/core/pkg/service"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+	"github.com/go-chi/chi/v5"
+)
+
+// Stale workspace policy handlers
+
+func (s *Server) listReapPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := s.store.WorkspaceReapPolicies().List(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list reap policies", err)
+		return
+	}
+
+	responses := make([]*api.WorkspaceReapPolicyResponse, len(policies))
+	for i, p := range policies {
+		responses[i] = storageReapPolicyToResponse(p)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"policies": responses,
+		"total":    len(responses),
+	})
+}
+
+func (s *Server) getReapPolicy(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+
+	policy, err := s.store.WorkspaceReapPolicies().Get(r.Context(), project)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Reap policy not found", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, storageReapPolicyToResponse(policy))
+}
+
+func (s *Server) putReapPolicy(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+
+	var req api.WorkspaceReapPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	policy := &storage.WorkspaceReapPolicy{
+		Project:           project,
+		StaleAfterSeconds: req.StaleAfterSeconds,
+		GraceSeconds:      req.GraceSeconds,
+		Notify:            make(storage.AlertTargets, len(req.Notify)),
+		Enabled:           req.Enabled == nil || *req.Enabled,
+	}
+	for i, target := range req.Notify {
+		policy.Notify[i] = storage.AlertTarget{Integration: target.Integration, Target: target.Target}
+	}
+	if err := service.ValidateReapPolicy(policy); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid reap policy", err)
+		return
+	}
+
+	if err := s.store.WorkspaceReapPolicies().Upsert(r.Context(), policy); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save reap policy", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, storageReapPolicyToResponse(policy))
+}
+
+func (s *Server) deleteReapPolicy(w http.ResponseWriter, r *http.Request) {
+	project := chi.URLParam(r, "project")
+
+	if err := s.store.WorkspaceReapPolicies().Delete(r.Context(), project); err != nil {
+		respondError(w, http.StatusNotFound, "Reap policy not found", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func storageReapPolicyToResponse(p *storage.WorkspaceReapPolicy) *api.WorkspaceReapPolicyResponse {
+	resp := &api.WorkspaceReapPolicyResponse{
+		Project:           p.Project,
+		StaleAfterSeconds: p.StaleAfterSeconds,
+		GraceSeconds:      p.GraceSeconds,
+		Notify:            make([]api.AlertTarget, len(p.Notify)),
+		Enabled:           p.Enabled,
+		CreatedAt:         p.CreatedAt,
+		UpdatedAt:         p.UpdatedAt,
+	}
+	for i, target := range p.Notify {
+		resp.Notify[i] = api.AlertTarget{Integration: target.Integration, Target: target.Target}
+	}
+	return resp
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+	"github.com/google/uuid"
+)
+
+// maxSearchLimit bounds the hits of each kind a search returns
+const maxSearchLimit = 100
+
+// highlightReplacer turns the storage match markers into HTML
+var highlightReplacer = strings.NewReplacer(
+	storage.HighlightStart, "<mark>",
+	storage.HighlightStop, "</mark>",
+)
+
+// search serves GET /search?q=: prompts whose text or output matches q and
+// workspaces whose name does, with the matches highlighted. Scope it with
+// ?project and ?workspace_id (prompts only); ?limit caps the hits of each
+// kind (default 20).
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		respondError(w, http.StatusBadRequest, "Missing search query", fmt.Errorf("q is required"))
+		return
+	}
+
+	filters := &storage.SearchFilters{Project: query.Get("project")}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxSearchLimit {
+			respondError(w, http.StatusBadRequest, "Invalid limit", fmt.Errorf("limit must be between 1 and %d", maxSearchLimit))
+			return
+		}
+		filters.Limit = limit
+	}
+	if idStr := query.Get("workspace_id"); idStr != "" {
+		workspaceID, err := uuid.Parse(idStr)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+			return
+		}
+		filters.WorkspaceID = &workspaceID
+	}
+
+	prompts, err := s.store.Search().Prompts(r.Context(), q, filters)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to search prompts", err)
+		return
+	}
+	resp := api.SearchResponse{
+		Query:      q,
+		Prompts:    make([]*api.PromptSearchHit, 0, len(prompts)),
+		Workspaces: []*api.WorkspaceSearchHit{},
+	}
+	for _, hit := range prompts {
+		resp.Prompts = append(resp.Prompts, &api.PromptSearchHit{
+			PromptID:        hit.PromptID,
+			WorkspaceID:     hit.WorkspaceID,
+			WorkspaceName:   hit.WorkspaceName,
+			Status:          hit.Status,
+			CreatedAt:       hit.CreatedAt,
+			Score:           hit.Rank,
+			PromptHighlight: highlightHTML(hit.PromptHighlight),
+			StdoutHighlight: highlightHTML(hit.StdoutHighlight),
+		})
+	}
+
+	// Workspace hits don't narrow to a workspace
+	if filters.WorkspaceID == nil {
+		workspaces, err := s.store.Search().Workspaces(r.Context(), q, filters)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to search workspaces", err)
+			return
+		}
+		for _, hit := range workspaces {
+			resp.Workspaces = append(resp.Workspaces, &api.WorkspaceSearchHit{
+				ID:            hit.ID,
+				Name:          hit.Name,
+				Status:        hit.Status,
+				Score:         hit.Rank,
+				NameHighlight: highlightHTML(hit.NameHighlight),
+			})
+		}
+	}
+	resp.Total = len(resp.Prompts) + len(resp.Workspaces)
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// highlightHTML escapes a highlighted excerpt for display, then marks its
+// matches. Prompts and output are user content and must not be rendered
+// as HTML.
+func highlightHTML(excerpt string) string {
+	return highlightReplacer.Replace(html.EscapeString(excerpt))
+}
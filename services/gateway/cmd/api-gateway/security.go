@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/config"
+	"github.com/go-chi/cors"
+)
+
+// corsOptions builds the CORS policy from the server config. Browsers
+// reject credentials for a wildcard origin, so "*" turns them off.
+func corsOptions(c config.CORSConfig) cors.Options {
+	credentials := c.AllowCredentials
+	if credentials && slices.Contains(c.AllowedOrigins, "*") {
+		log.Println("Warning: CORS allows any origin, so credentials are not allowed")
+		credentials = false
+	}
+
+	headers := c.AllowedHeaders
+	if !slices.Contains(headers, consistencyHeader) {
+		headers = append(slices.Clone(headers), consistencyHeader)
+	}
+
+	return cors.Options{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   c.AllowedMethods,
+		AllowedHeaders:   headers,
+		ExposedHeaders:   c.ExposedHeaders,
+		AllowCredentials: credentials,
+		MaxAge:           c.MaxAgeSeconds,
+	}
+}
+
+// securityHeaders sets hardening headers on every response. Workspace
+// previews are left alone: the proxied app decides how it may be framed.
+func securityHeaders(c config.SecurityHeadersConfig) func(http.Handler) http.Handler {
+	hsts := ""
+	if c.HSTSMaxAgeSeconds > 0 {
+		hsts = fmt.Sprintf("max-age=%d", c.HSTSMaxAgeSeconds)
+		if c.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			if hsts != "" && (r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https") {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			if !strings.HasPrefix(r.URL.Path, "/preview/") {
+				h.Set("X-Content-Type-Options", "nosniff")
+				if c.FrameOptions != "off" {
+					h.Set("X-Frame-Options", c.FrameOptions)
+				}
+				if c.ReferrerPolicy != "off" {
+					h.Set("Referrer-Policy", c.ReferrerPolicy)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/config"
+	"github.com/aetherium/aetherium/services/core/pkg/service"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// sloSettings converts the SLO configuration for the SLO service
+func sloSettings(cfg config.SLOConfig) service.SLOSettings {
+	settings := service.SLOSettings{
+		Window:       time.Duration(cfg.WindowDays) * 24 * time.Hour,
+		FastBurnRate: cfg.FastBurnRate,
+		SlowBurnRate: cfg.SlowBurnRate,
+	}
+	for _, target := range cfg.Targets {
+		settings.Targets = append(settings.Targets, service.SLOTarget{
+			Name:          target.Name,
+			Endpoint:      target.Endpoint,
+			TaskType:      target.TaskType,
+			Availability:  target.Availability,
+			Latency:       time.Duration(target.LatencyMS) * time.Millisecond,
+			LatencyTarget: target.LatencyTarget,
+		})
+	}
+	return settings
+}
+
+// recordSLO counts API requests against the SLO targets by route pattern.
+// Streams and WebSockets stay open for as long as the client wants, so they
+// are left out.
+func (s *Server) recordSLO(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" || strings.HasSuffix(r.URL.Path, "/stream") ||
+			strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			return // No route matched
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		s.sloService.RecordRequest(r.Method, route, status, time.Since(start))
+	})
+}
+
+// getSLOReport serves GET /slo: the error budget and burn rates of every
+// SLO objective
+func (s *Server) getSLOReport(w http.ResponseWriter, r *http.Request) {
+	report, err := s.sloService.Report(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to compute SLO report", err)
+		return
+	}
+
+	resp := api.SLOReportResponse{
+		WindowSeconds: int(report.Window.Seconds()),
+		Objectives:    make([]*api.SLOObjectiveResponse, 0, len(report.Objectives)),
+		GeneratedAt:   report.GeneratedAt,
+	}
+	for _, objective := range report.Objectives {
+		resp.Objectives = append(resp.Objectives, &api.SLOObjectiveResponse{
+			Target:          objective.Target,
+			Endpoint:        objective.Endpoint,
+			TaskType:        objective.TaskType,
+			Objective:       objective.Objective,
+			Goal:            objective.Goal,
+			LatencyMS:       objective.Latency.Milliseconds(),
+			Total:           objective.Total,
+			Bad:             objective.Bad,
+			SLI:             objective.SLI,
+			BudgetRemaining: objective.BudgetRemaining,
+			BurnRate1h:      objective.BurnRate1h,
+			BurnRate6h:      objective.BurnRate6h,
+			BurnRateWindow:  objective.BurnRateWindow,
+			Status:          objective.Status,
+		})
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func (s *Server) getTask(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid task ID", err)
+		return
+	}
+
+	task, err := s.taskService.GetTask(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Task not found", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, taskResponse(task))
+}
+
+// listTasks serves GET /tasks: recent tasks, optionally of one type and
+// status, newest first
+func (s *Server) listTasks(w http.ResponseWriter, r *http.Request) {
+	limit, ok := taskHistoryLimit(w, r)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", storage.TaskStatusPending, storage.TaskStatusProcessing, storage.TaskStatusCompleted,
+		storage.TaskStatusRetrying, storage.TaskStatusFailed:
+	default:
+		respondError(w, http.StatusBadRequest, "Invalid status", nil)
+		return
+	}
+
+	tasks, err := s.taskService.ListTasks(r.Context(), r.URL.Query().Get("type"), status, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list tasks", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, listTasksResponse(tasks))
+}
+
+// listVMTasks serves GET /vms/{id}/tasks: every task that acted on the VM,
+// including after it was deleted
+func (s *Server) listVMTasks(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid VM ID", err)
+		return
+	}
+	limit, ok := taskHistoryLimit(w, r)
+	if !ok {
+		return
+	}
+
+	tasks, err := s.taskService.ListVMTasks(r.Context(), id, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list tasks", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, listTasksResponse(tasks))
+}
+
+// listWorkspaceTasks serves GET /workspaces/{id}/tasks: every task that
+// acted on the workspace, including after it was deleted
+func (s *Server) listWorkspaceTasks(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID", err)
+		return
+	}
+	limit, ok := taskHistoryLimit(w, r)
+	if !ok {
+		return
+	}
+
+	tasks, err := s.taskService.ListWorkspaceTasks(r.Context(), id, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list tasks", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, listTasksResponse(tasks))
+}
+
+// taskHistoryLimit parses the limit query parameter, responding with 400
+// if it's invalid
+func taskHistoryLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l <= 0 {
+			respondError(w, http.StatusBadRequest, "Invalid limit", err)
+			return 0, false
+		}
+		limit = l
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+	return limit, true
+}
+
+func listTasksResponse(tasks []*storage.Task) api.ListTasksResponse {
+	resp := api.ListTasksResponse{
+		Tasks: make([]*api.TaskResponse, len(tasks)),
+		Total: len(tasks),
+	}
+	for i, task := range tasks {
+		resp.Tasks[i] = taskResponse(task)
+	}
+	return resp
+}
+
+func taskResponse(task *storage.Task) *api.TaskResponse {
+	resp := &api.TaskResponse{
+		ID:          task.ID,
+		Type:        task.Type,
+		Status:      task.Status,
+		Result:      task.Result,
+		CreatedAt:   task.CreatedAt,
+		VMID:        task.VMID,
+		WorkspaceID: task.WorkspaceID,
+		PromptID:    task.PromptID,
+		WorkerID:    task.WorkerID,
+		RetryCount:  task.RetryCount,
+		MaxRetries:  task.MaxRetries,
+		StartedAt:   task.StartedAt,
+		CompletedAt: task.CompletedAt,
+	}
+	if task.Error != nil {
+		resp.Error = *task.Error
+	}
+	return resp
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/google/uuid"
+)
+
+// DialTerminal opens a terminal in a VM through the worker running it, for
+// workspace sessions (see websocket.TerminalDialer)
+func (s *Server) DialTerminal(ctx context.Context, vmID uuid.UUID, req *vmm.TerminalRequest) (io.ReadWriteCloser, error) {
+	worker, _, err := s.runningVMWorker(ctx, vmID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	if req.Dir != "" {
+		query.Set("dir", req.Dir)
+	}
+	if req.Cols > 0 && req.Rows > 0 {
+		query.Set("cols", strconv.Itoa(int(req.Cols)))
+		query.Set("rows", strconv.Itoa(int(req.Rows)))
+	}
+	target := fmt.Sprintf("http://%s/vms/%s/terminal?%s", worker.Address, vmID, query.Encode())
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+string(s.peerSecret))
+	httpReq.Header.Set("Connection", "Upgrade")
+	httpReq.Header.Set("Upgrade", vmm.TerminalUpgrade)
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("worker %s unreachable: %w", worker.ID, err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("worker %s returned %s: %s", worker.ID, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	// The body of a protocol switch is the connection itself
+	stream, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, fmt.Errorf("worker %s returned a read-only terminal stream", worker.ID)
+	}
+	return stream, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+	"github.com/google/uuid"
+)
+
+// listTranscriptEntries serves GET /transcripts: the transcript chain in
+// order, from after_seq, or a record's entries with record_id
+func (s *Server) listTranscriptEntries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var recordID *uuid.UUID
+	if value := query.Get("record_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid record_id", err)
+			return
+		}
+		recordID = &id
+	}
+
+	var afterSeq int64
+	if value := query.Get("after_seq"); value != "" {
+		seq, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seq < 0 {
+			respondError(w, http.StatusBadRequest, "Invalid after_seq", err)
+			return
+		}
+		afterSeq = seq
+	}
+
+	limit, ok := taskHistoryLimit(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := s.transcripts.ListEntries(r.Context(), recordID, afterSeq, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list transcript entries", err)
+		return
+	}
+
+	resp := api.ListTranscriptEntriesResponse{
+		Entries: make([]*api.TranscriptEntryResponse, len(entries)),
+		Total:   len(entries),
+	}
+	for i, entry := range entries {
+		resp.Entries[i] = transcriptEntryResponse(entry)
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// verifyTranscripts serves GET /transcripts/verify: it checks the whole
+// chain, its anchors and the chained records
+func (s *Server) verifyTranscripts(w http.ResponseWriter, r *http.Request) {
+	result, err := s.transcripts.Verify(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to verify transcripts", err)
+		return
+	}
+
+	resp := api.TranscriptVerificationResponse{
+		Valid:             result.Valid,
+		Entries:           result.Entries,
+		HeadSeq:           result.HeadSeq,
+		HeadHash:          result.HeadHash,
+		Anchors:           result.Anchors,
+		AnchorMismatch:    result.AnchorMismatch,
+		MissingRecords:    result.MissingRecords,
+		InProgressRecords: result.InProgressRecords,
+		VerifiedAt:        result.VerifiedAt,
+	}
+	if result.Break != nil {
+		resp.BrokenAt = &result.Break.Seq
+		resp.BreakReason = result.Break.Reason
+	}
+	for _, issue := range result.ModifiedRecords {
+		resp.ModifiedRecords = append(resp.ModifiedRecords, api.TranscriptRecordIssue{
+			Kind:     issue.Kind,
+			RecordID: issue.RecordID,
+			Seq:      issue.Seq,
+			Reason:   issue.Reason,
+		})
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func transcriptEntryResponse(entry *storage.TranscriptEntry) *api.TranscriptEntryResponse {
+	return &api.TranscriptEntryResponse{
+		Seq:         entry.Seq,
+		Kind:        entry.Kind,
+		RecordID:    entry.RecordID,
+		ContentHash: entry.ContentHash,
+		PrevHash:    entry.PrevHash,
+		Hash:        entry.Hash,
+		CreatedAt:   entry.CreatedAt,
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/aetherium/aetherium/services/core/pkg/service"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// snapshotVM serves POST /vms/{id}/snapshot: it records a pending snapshot
+// and enqueues the task taking it on the VM's worker
+func (s *Server) snapshotVM(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid VM ID", err)
+		return
+	}
+
+	// The body is optional
+	var req api.SnapshotVMRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	snapshot, taskID, err := s.taskService.SnapshotVM(r.Context(), id, req.Name)
+	if err != nil {
+		respondSnapshotError(w, "Failed to snapshot VM", err)
+		return
+	}
+
+	resp := storageVMSnapshotToResponse(snapshot)
+	resp.TaskID = &taskID
+	respondJSON(w, http.StatusAccepted, resp)
+}
+
+// restoreVM serves POST /vms/{id}/restore: it enqueues a task returning the
+// VM to one of its snapshots
+func (s *Server) restoreVM(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid VM ID", err)
+		return
+	}
+
+	var req api.RestoreVMRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if req.SnapshotID == uuid.Nil {
+		respondError(w, http.StatusBadRequest, "snapshot_id is required", nil)
+		return
+	}
+
+	taskID, err := s.taskService.RestoreVM(r.Context(), id, req.SnapshotID)
+	if err != nil {
+		respondSnapshotError(w, "Failed to restore VM", err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, api.TaskResponse{
+		ID:     taskID,
+		Type:   "vm:restore",
+		Status: "pending",
+		VMID:   &id,
+	})
+}
+
+// listVMSnapshots serves GET /vms/{id}/snapshots
+func (s *Server) listVMSnapshots(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid VM ID", err)
+		return
+	}
+
+	snapshots, err := s.taskService.ListVMSnapshots(r.Context(), id)
+	if err != nil {
+		respondSnapshotError(w, "Failed to list VM snapshots", err)
+		return
+	}
+
+	resp := api.ListVMSnapshotsResponse{
+		Snapshots: make([]*api.VMSnapshotResponse, 0, len(snapshots)),
+		Total:     len(snapshots),
+	}
+	for _, snapshot := range snapshots {
+		resp.Snapshots = append(resp.Snapshots, storageVMSnapshotToResponse(snapshot))
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// respondSnapshotError maps errors from snapshotting or restoring a VM to
+// their HTTP status
+func respondSnapshotError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, service.ErrVMSnapshotNotFound):
+		respondError(w, http.StatusNotFound, message, err)
+	case errors.Is(err, service.ErrVMSnapshotConflict):
+		respondError(w, http.StatusConflict, message, err)
+	default:
+		respondError(w, taskErrorStatus(err), message, err)
+	}
+}
+
+func storageVMSnapshotToResponse(snapshot *storage.VMSnapshot) *api.VMSnapshotResponse {
+	resp := &api.VMSnapshotResponse{
+		ID:          snapshot.ID,
+		VMID:        snapshot.VMID,
+		WorkerID:    snapshot.WorkerID,
+		Name:        snapshot.Name,
+		Status:      snapshot.Status,
+		SizeBytes:   snapshot.SizeBytes,
+		CreatedAt:   snapshot.CreatedAt,
+		CompletedAt: snapshot.CompletedAt,
+		RestoredAt:  snapshot.RestoredAt,
+	}
+	if snapshot.Error != nil {
+		resp.Error = *snapshot.Error
+	}
+	return resp
+}
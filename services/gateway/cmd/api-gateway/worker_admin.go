@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
+	"github.com/aetherium/aetherium/services/gateway/pkg/discovery"
+	"github.com/go-chi/chi/v5"
+)
+
+// reconcileWorker serves POST /workers/{id}/reconcile: asks a worker to
+// adopt VMs it lost track of and mark VMs that are gone as failed, through
+// its admin API, without restarting it
+func (s *Server) reconcileWorker(w http.ResponseWriter, r *http.Request) {
+	workerID := chi.URLParam(r, "id")
+	if len(s.peerSecret) == 0 {
+		respondError(w, http.StatusServiceUnavailable, "Worker admin API unavailable", fmt.Errorf("WORKER_PEER_SECRET is not set"))
+		return
+	}
+	worker, err := s.store.Workers().Get(r.Context(), workerID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Worker not found", err)
+		return
+	}
+
+	resp := api.ReconcileWorkerResponse{WorkerID: workerID}
+	if status, err := s.workerRequest(r.Context(), worker, http.MethodPost, "/admin/reconcile", nil, &resp); err != nil {
+		respondError(w, status, "Failed to reconcile worker", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// getWorkerDiagnostics serves GET /workers/{id}/diagnostics: whether a
+// worker's host can run VMs (KVM, vsock, kernel, rootfs, bridge, disk
+// space). The worker checks its host now through its admin API; if it
+// can't be reached, the report from its last heartbeat is returned.
+func (s *Server) getWorkerDiagnostics(w http.ResponseWriter, r *http.Request) {
+	workerID := chi.URLParam(r, "id")
+	worker, err := s.store.Workers().Get(r.Context(), workerID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Worker not found", err)
+		return
+	}
+
+	resp := api.WorkerDiagnosticsResponse{WorkerID: workerID}
+	switch {
+	case len(s.peerSecret) == 0:
+		resp.Error = "WORKER_PEER_SECRET is not set"
+	case worker.Status == string(discovery.WorkerStatusOffline):
+		resp.Error = "worker is offline"
+	default:
+		if _, err := s.workerRequest(r.Context(), worker, http.MethodGet, "/admin/host-checks", nil, &resp); err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Live = true
+		}
+	}
+
+	if !resp.Live {
+		// Reported by the worker on registration and every heartbeat
+		stored, ok := worker.Metadata["host_checks"]
+		if !ok {
+			respondError(w, http.StatusNotFound, "Worker has not reported host checks", fmt.Errorf("%s", resp.Error))
+			return
+		}
+		data, err := json.Marshal(stored)
+		if err == nil {
+			err = json.Unmarshal(data, &resp)
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to read host checks", err)
+			return
+		}
+	}
+
+	resp.Failed = []string{}
+	for _, check := range resp.Checks {
+		if !check.OK {
+			resp.Failed = append(resp.Failed, check.Name)
+		}
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
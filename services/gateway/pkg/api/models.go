@@ -3,6 +3,7 @@ package api
 import (
 	"time"
 
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
 	"github.com/google/uuid"
 )
 
@@ -13,13 +14,16 @@ type CreateVMRequest struct {
 	MemoryMB        int               `json:"memory_mb" binding:"required,min=128"`
 	AdditionalTools []string          `json:"additional_tools,omitempty"`
 	ToolVersions    map[string]string `json:"tool_versions,omitempty"`
+	Project         string            `json:"project,omitempty"` // Selects the VM garbage collection policy
 }
 
 // CreateVMResponse represents a VM creation response
 type CreateVMResponse struct {
-	TaskID uuid.UUID `json:"task_id"`
-	VMID   string    `json:"vm_id,omitempty"`
-	Status string    `json:"status"`
+	TaskID        uuid.UUID `json:"task_id"`
+	VMID          string    `json:"vm_id,omitempty"`
+	Status        string    `json:"status"`
+	QueuePosition int       `json:"queue_position,omitempty"` // Set when queued behind a saturated cluster
+	Message       string    `json:"message,omitempty"`
 }
 
 // VMResponse represents a VM information response
@@ -35,31 +39,281 @@ type VMResponse struct {
 	CreatedAt    time.Time         `json:"created_at"`
 	StartedAt    *time.Time        `json:"started_at,omitempty"`
 	StoppedAt    *time.Time        `json:"stopped_at,omitempty"`
+	LastUsedAt   *time.Time        `json:"last_used_at,omitempty"`
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	Cluster      string            `json:"cluster,omitempty"` // Federated cluster the VM lives in (federated lists)
+}
+
+// VMProcess is a process running in a VM, as reported by its agent
+type VMProcess struct {
+	PID       int       `json:"pid"`
+	PPID      int       `json:"ppid"`
+	User      string    `json:"user"`
+	Name      string    `json:"name"`
+	Command   string    `json:"command"`
+	State     string    `json:"state"`
+	RSSKB     int64     `json:"rss_kb"`
+	StartedAt time.Time `json:"started_at"`
+	Ports     []int     `json:"ports,omitempty"` // TCP ports it listens on
+}
+
+// VMSocket is a listening TCP socket in a VM
+type VMSocket struct {
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	Loopback bool   `json:"loopback,omitempty"` // Not reachable through previews
+	PID      int    `json:"pid,omitempty"`
+	Process  string `json:"process,omitempty"`
+}
+
+// VMProcessesResponse lists what runs inside a VM
+type VMProcessesResponse struct {
+	VMID      uuid.UUID   `json:"vm_id"`
+	Processes []VMProcess `json:"processes"`
+	Sockets   []VMSocket  `json:"sockets"`
+}
+
+// SignalProcessRequest represents a request to signal a process in a VM
+type SignalProcessRequest struct {
+	Signal string `json:"signal"` // TERM (default), KILL or INT
+}
+
+// SignalProcessResponse confirms a signal was delivered
+type SignalProcessResponse struct {
+	VMID   uuid.UUID `json:"vm_id"`
+	PID    int       `json:"pid"`
+	Signal string    `json:"signal"`
+}
+
+// SnapshotVMRequest represents a request to snapshot a VM
+type SnapshotVMRequest struct {
+	Name string `json:"name,omitempty"` // Default snapshot-<UTC time>
+}
+
+// RestoreVMRequest represents a request to restore a VM to a snapshot
+type RestoreVMRequest struct {
+	SnapshotID uuid.UUID `json:"snapshot_id"`
+}
+
+// VMSnapshotResponse represents a snapshot of a VM's memory, devices and disk
+type VMSnapshotResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	VMID        uuid.UUID  `json:"vm_id"`
+	WorkerID    *string    `json:"worker_id,omitempty"` // Worker keeping the snapshot's files
+	Name        string     `json:"name"`
+	Status      string     `json:"status"` // pending, ready or failed
+	SizeBytes   *int64     `json:"size_bytes,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	RestoredAt  *time.Time `json:"restored_at,omitempty"`
+	TaskID      *uuid.UUID `json:"task_id,omitempty"` // vm:snapshot task, when the snapshot was just requested
+}
+
+// ListVMSnapshotsResponse lists a VM's snapshots, newest first
+type ListVMSnapshotsResponse struct {
+	Snapshots []*VMSnapshotResponse `json:"snapshots"`
+	Total     int                   `json:"total"`
+}
+
+// VMGCPolicyRequest represents a VM garbage collection policy update
+type VMGCPolicyRequest struct {
+	MaxAgeSeconds  int   `json:"max_age_seconds"`  // 0 = no age limit
+	MaxIdleSeconds int   `json:"max_idle_seconds"` // 0 = no idle limit
+	WarningSeconds int   `json:"warning_seconds,omitempty"`
+	Enabled        *bool `json:"enabled,omitempty"` // Default true
+}
+
+// VMGCPolicyResponse represents a VM garbage collection policy
+type VMGCPolicyResponse struct {
+	Project        string    `json:"project"`
+	MaxAgeSeconds  int       `json:"max_age_seconds"`
+	MaxIdleSeconds int       `json:"max_idle_seconds"`
+	WarningSeconds int       `json:"warning_seconds"`
+	Enabled        bool      `json:"enabled"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// WorkspaceReapPolicyRequest represents a stale workspace policy update
+type WorkspaceReapPolicyRequest struct {
+	StaleAfterSeconds int           `json:"stale_after_seconds"`
+	GraceSeconds      int           `json:"grace_seconds,omitempty"` // Default 604800 (7 days)
+	Notify            []AlertTarget `json:"notify,omitempty"`        // Targets without a target go to the workspace owner
+	Enabled           *bool         `json:"enabled,omitempty"`       // Default true; false opts the project out
+}
+
+// WorkspaceReapPolicyResponse represents a stale workspace policy
+type WorkspaceReapPolicyResponse struct {
+	Project           string        `json:"project"`
+	StaleAfterSeconds int           `json:"stale_after_seconds"`
+	GraceSeconds      int           `json:"grace_seconds"`
+	Notify            []AlertTarget `json:"notify"`
+	Enabled           bool          `json:"enabled"`
+	CreatedAt         time.Time     `json:"created_at"`
+	UpdatedAt         time.Time     `json:"updated_at"`
+}
+
+// CapacityPolicyRequest represents a capacity policy update
+type CapacityPolicyRequest struct {
+	Policy            string `json:"policy"`                        // reject, queue or burst
+	RetryAfterSeconds int    `json:"retry_after_seconds,omitempty"` // Retry-After hint for rejections (default 30)
+}
+
+// CapacityPolicyResponse represents a capacity policy
+type CapacityPolicyResponse struct {
+	Project           string    `json:"project"`
+	Policy            string    `json:"policy"`
+	RetryAfterSeconds int       `json:"retry_after_seconds"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// AlertTarget is a notification integration and its target (e.g. a Slack channel)
+type AlertTarget struct {
+	Integration string `json:"integration"`
+	Target      string `json:"target"`
+}
+
+// AlertRuleRequest represents an alert rule create or update
+type AlertRuleRequest struct {
+	Name          string        `json:"name"`
+	Kind          string        `json:"kind"`               // threshold or absence
+	Metric        string        `json:"metric"`             // e.g. disk_usage, worker_heartbeat, event:vm.crashed
+	Operator      string        `json:"operator,omitempty"` // >, >=, <, <= (threshold rules)
+	Threshold     float64       `json:"threshold"`          // Absence rules: seconds without data
+	WindowSeconds int           `json:"window_seconds,omitempty"`
+	Severity      string        `json:"severity,omitempty"` // info, warning (default) or error
+	Notify        []AlertTarget `json:"notify,omitempty"`
+	Enabled       *bool         `json:"enabled,omitempty"` // Default true
+}
+
+// AlertRuleResponse represents an alert rule and its last evaluation
+type AlertRuleResponse struct {
+	ID            uuid.UUID     `json:"id"`
+	Name          string        `json:"name"`
+	Kind          string        `json:"kind"`
+	Metric        string        `json:"metric"`
+	Operator      string        `json:"operator,omitempty"`
+	Threshold     float64       `json:"threshold"`
+	WindowSeconds int           `json:"window_seconds"`
+	Severity      string        `json:"severity"`
+	Notify        []AlertTarget `json:"notify"`
+	Enabled       bool          `json:"enabled"`
+	Firing        bool          `json:"firing"`
+	LastValue     *float64      `json:"last_value,omitempty"`
+	LastFiredAt   *time.Time    `json:"last_fired_at,omitempty"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+// ClusterRequest registers or updates a federated cluster
+type ClusterRequest struct {
+	Region  string `json:"region"`
+	URL     string `json:"url"`               // Base URL of the cluster's gateway, e.g. https://eu.example.com
+	Token   string `json:"token,omitempty"`   // Bearer token sent to the cluster; omitted on update keeps the old one
+	Enabled *bool  `json:"enabled,omitempty"` // Default true
+}
+
+// ClusterResponse represents a federated cluster. The token is never returned.
+type ClusterResponse struct {
+	Name      string    `json:"name"`
+	Region    string    `json:"region"`
+	URL       string    `json:"url"`
+	HasToken  bool      `json:"has_token"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ListClustersResponse represents the federated clusters and the gateway's own region
+type ListClustersResponse struct {
+	LocalRegion string             `json:"local_region,omitempty"`
+	Clusters    []*ClusterResponse `json:"clusters"`
+	Total       int                `json:"total"`
+}
+
+// IntegrationRequest creates or reconfigures an integration at runtime
+type IntegrationRequest struct {
+	Type    string                 `json:"type,omitempty"`    // github or slack; required when creating
+	Enabled *bool                  `json:"enabled,omitempty"` // Default true, or unchanged on update
+	Options map[string]interface{} `json:"options,omitempty"` // Merged into the stored options; null or "" removes one
+}
+
+// IntegrationResponse represents an integration. Option values are never
+// returned, only their names.
+type IntegrationResponse struct {
+	Name      string     `json:"name"`
+	Type      string     `json:"type"`
+	Source    string     `json:"source"` // api, or env when set by the gateway's environment
+	Enabled   bool       `json:"enabled"`
+	Running   bool       `json:"running"`
+	Options   []string   `json:"options,omitempty"`
+	Error     string     `json:"error,omitempty"` // Why a configured integration isn't running
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// ListIntegrationsResponse represents a list of integrations
+type ListIntegrationsResponse struct {
+	Integrations []*IntegrationResponse `json:"integrations"`
+	Total        int                    `json:"total"`
+}
+
+// ClusterError reports a federated cluster that could not be reached
+type ClusterError struct {
+	Cluster string `json:"cluster"`
+	Error   string `json:"error"`
 }
 
 // ListVMsResponse represents a list of VMs
 type ListVMsResponse struct {
-	VMs   []*VMResponse `json:"vms"`
-	Total int           `json:"total"`
+	VMs           []*VMResponse  `json:"vms"`
+	Total         int            `json:"total"`
+	ClusterErrors []ClusterError `json:"cluster_errors,omitempty"` // Unreachable clusters (federated lists)
 }
 
 // ExecuteCommandRequest represents a command execution request
 type ExecuteCommandRequest struct {
-	Command string   `json:"command" binding:"required"`
-	Args    []string `json:"args,omitempty"`
+	Command    string   `json:"command" binding:"required"`
+	Args       []string `json:"args,omitempty"`
+	Cache      bool     `json:"cache,omitempty"`       // Reuse a cached result for identical executions
+	InputsHash string   `json:"inputs_hash,omitempty"` // Hash of inputs the command depends on (part of cache key)
 }
 
 // ExecuteCommandResponse represents a command execution response
 type ExecuteCommandResponse struct {
-	TaskID uuid.UUID `json:"task_id"`
-	VMID   string    `json:"vm_id"`
-	Status string    `json:"status"`
+	TaskID   uuid.UUID `json:"task_id"`
+	VMID     string    `json:"vm_id"`
+	Status   string    `json:"status"`
+	Fallback string    `json:"fallback,omitempty"` // Why a synchronous execute was queued instead
+}
+
+// ExecuteSyncRequest represents a request to run a short command and wait
+// for its result
+type ExecuteSyncRequest struct {
+	Command   string   `json:"command" binding:"required"`
+	Args      []string `json:"args,omitempty"`
+	TimeoutMS int      `json:"timeout_ms,omitempty"` // Default 10000, at most 30000
+}
+
+// ExecuteSyncResponse represents the result of a synchronous command
+type ExecuteSyncResponse struct {
+	ExecutionID uuid.UUID              `json:"execution_id"`
+	VMID        string                 `json:"vm_id"`
+	ExitCode    int                    `json:"exit_code"`
+	Stdout      string                 `json:"stdout"`
+	Stderr      string                 `json:"stderr"`
+	DurationMS  int64                  `json:"duration_ms"`
+	Truncated   bool                   `json:"truncated,omitempty"` // Output was cut to 1 MiB per stream
+	Resources   map[string]interface{} `json:"resources,omitempty"` // What the command ran out of, if anything
 }
 
 // ExecutionResponse represents a command execution result
 type ExecutionResponse struct {
 	ID          uuid.UUID              `json:"id"`
+	TaskID      *uuid.UUID             `json:"task_id,omitempty"`
 	VMID        *uuid.UUID             `json:"vm_id,omitempty"`
 	Command     string                 `json:"command"`
 	Args        []interface{}          `json:"args,omitempty"`
@@ -81,12 +335,37 @@ type ListExecutionsResponse struct {
 
 // TaskResponse represents a task status response
 type TaskResponse struct {
-	ID        uuid.UUID              `json:"id"`
-	Type      string                 `json:"type"`
-	Status    string                 `json:"status"`
-	Result    map[string]interface{} `json:"result,omitempty"`
-	Error     string                 `json:"error,omitempty"`
-	CreatedAt time.Time              `json:"created_at"`
+	ID          uuid.UUID              `json:"id"`
+	Type        string                 `json:"type"`
+	Status      string                 `json:"status"`
+	Result      map[string]interface{} `json:"result,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+	CreatedAt   time.Time              `json:"created_at"`
+	VMID        *uuid.UUID             `json:"vm_id,omitempty"`
+	WorkspaceID *uuid.UUID             `json:"workspace_id,omitempty"`
+	PromptID    *uuid.UUID             `json:"prompt_id,omitempty"`
+	WorkerID    *string                `json:"worker_id,omitempty"`
+	RetryCount  int                    `json:"retry_count,omitempty"`
+	MaxRetries  int                    `json:"max_retries,omitempty"`
+	StartedAt   *time.Time             `json:"started_at,omitempty"`
+	CompletedAt *time.Time             `json:"completed_at,omitempty"`
+}
+
+// ListTasksResponse is a task history, newest first
+type ListTasksResponse struct {
+	Tasks []*TaskResponse `json:"tasks"`
+	Total int             `json:"total"`
+}
+
+// TaskResultResponse is the result of a finished command task or prompt.
+// Exactly one of Execution and Prompt is set, according to Type.
+type TaskResultResponse struct {
+	TaskID    uuid.UUID          `json:"task_id"`
+	Type      string             `json:"type"`   // command, prompt
+	Status    string             `json:"status"` // completed, failed; prompts also cancelled, timed_out
+	ExitCode  *int               `json:"exit_code,omitempty"`
+	Execution *ExecutionResponse `json:"execution,omitempty"`
+	Prompt    *PromptResponse    `json:"prompt,omitempty"`
 }
 
 // SmartExecuteRequest represents a smart command execution request
@@ -98,28 +377,86 @@ type SmartExecuteRequest struct {
 	PreferExisting  bool              `json:"prefer_existing"`            // Default true: reuse existing VMs
 	VCPUs           int               `json:"vcpus,omitempty"`            // For new VM if needed
 	MemoryMB        int               `json:"memory_mb,omitempty"`        // For new VM if needed
+	Cache           bool              `json:"cache,omitempty"`            // Reuse a cached result for identical executions
+	InputsHash      string            `json:"inputs_hash,omitempty"`      // Hash of inputs the command depends on (part of cache key)
+	Environment     string            `json:"environment,omitempty"`      // Optional: environment name/ID whose sandbox profile applies
+	Project         string            `json:"project,omitempty"`          // Selects the GC policy for a newly created VM
+	Image           string            `json:"image,omitempty"`            // Optional: run in a throwaway container of this image instead of a VM
 }
 
 // SmartExecuteResponse represents a smart command execution response
 type SmartExecuteResponse struct {
-	ExecutionID uuid.UUID `json:"execution_id"`
-	VMID        uuid.UUID `json:"vm_id"`
-	VMName      string    `json:"vm_name"`
-	VMCreated   bool      `json:"vm_created"`    // true if new VM was created
-	VMReused    bool      `json:"vm_reused"`     // true if existing VM was reused
-	Status      string    `json:"status"`
-	Message     string    `json:"message,omitempty"`
+	ID          uuid.UUID  `json:"id"` // Smart execution record, see GET /smart-executions/{id}
+	ExecutionID uuid.UUID  `json:"execution_id"`
+	VMID        *uuid.UUID `json:"vm_id,omitempty"` // Unset for container executions
+	VMName      string     `json:"vm_name,omitempty"`
+	Image       string     `json:"image,omitempty"` // Container image the command runs in
+	VMCreated   bool       `json:"vm_created"`      // true if new VM was created
+	VMReused    bool       `json:"vm_reused"`       // true if existing VM was reused
+	Status      string     `json:"status"`
+	Message     string     `json:"message,omitempty"`
+}
+
+// SmartExecutionResponse is a recorded smart-execute request with the result
+// of its command once it has run
+type SmartExecutionResponse struct {
+	ID          uuid.UUID          `json:"id"`
+	TaskID      uuid.UUID          `json:"task_id"` // execution_id in the smart-execute response
+	VMID        *uuid.UUID         `json:"vm_id,omitempty"`
+	VMName      string             `json:"vm_name,omitempty"`
+	Image       *string            `json:"image,omitempty"` // Set for container executions
+	VMCreated   bool               `json:"vm_created"`
+	VMReused    bool               `json:"vm_reused"`
+	Command     string             `json:"command"`
+	Args        []interface{}      `json:"args,omitempty"`
+	Environment *string            `json:"environment,omitempty"`
+	Project     *string            `json:"project,omitempty"`
+	Status      string             `json:"status"` // pending, completed, failed
+	ExitCode    *int               `json:"exit_code,omitempty"`
+	Error       *string            `json:"error,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+	CompletedAt *time.Time         `json:"completed_at,omitempty"`
+	DurationMS  *int               `json:"duration_ms,omitempty"`
+	Execution   *ExecutionResponse `json:"execution,omitempty"` // Full output; only on GET /smart-executions/{id}
+}
+
+// ListSmartExecutionsResponse represents a list of smart executions
+type ListSmartExecutionsResponse struct {
+	SmartExecutions []*SmartExecutionResponse `json:"smart_executions"`
+	Total           int                       `json:"total"`
+}
+
+// StreamStatusEvent is sent on task and prompt streams when the status changes
+type StreamStatusEvent struct {
+	ID     uuid.UUID `json:"id"`
+	Status string    `json:"status"`
+}
+
+// StreamOutputEvent carries command output on task and prompt streams
+type StreamOutputEvent struct {
+	Stream string `json:"stream"` // stdout or stderr
+	Data   string `json:"data"`
+}
+
+// StreamExitEvent is the final event on task and prompt streams
+type StreamExitEvent struct {
+	ID         uuid.UUID `json:"id"`
+	Status     string    `json:"status"`
+	ExitCode   int       `json:"exit_code"` // -1 when the command never ran
+	Error      *string   `json:"error,omitempty"`
+	DurationMS *int      `json:"duration_ms,omitempty"`
 }
 
 // LogQueryRequest represents a log query request
 type LogQueryRequest struct {
-	VMID       string `json:"vm_id,omitempty"`
-	TaskID     string `json:"task_id,omitempty"`
-	Level      string `json:"level,omitempty"`
-	SearchText string `json:"search_text,omitempty"`
-	StartTime  *int64 `json:"start_time,omitempty"`
-	EndTime    *int64 `json:"end_time,omitempty"`
-	Limit      int    `json:"limit,omitempty"`
+	VMID        string `json:"vm_id,omitempty"`
+	TaskID      string `json:"task_id,omitempty"`
+	WorkspaceID string `json:"workspace_id,omitempty"`
+	Level       string `json:"level,omitempty"`
+	SearchText  string `json:"search_text,omitempty"`
+	StartTime   *int64 `json:"start_time,omitempty"` // Unix milliseconds
+	EndTime     *int64 `json:"end_time,omitempty"`   // Unix milliseconds
+	Limit       int    `json:"limit,omitempty"`
 }
 
 // LogEntry represents a log entry
@@ -148,16 +485,112 @@ type WebhookRequest struct {
 
 // HealthResponse represents a health check response
 type HealthResponse struct {
-	Status     string            `json:"status"`
-	Components map[string]string `json:"components"`
-	Timestamp  time.Time         `json:"timestamp"`
+	Status     string                    `json:"status"`
+	Components map[string]string         `json:"components"`
+	Checks     map[string]ComponentCheck `json:"checks,omitempty"` // Cached checks, by component
+	Version    string                    `json:"version,omitempty"`
+	Commit     string                    `json:"commit,omitempty"`
+
+	// Task payload versions this release reads and writes
+	MinPayloadVersion int `json:"min_payload_version"`
+	PayloadVersion    int `json:"payload_version"`
+
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ComponentCheck is the last health check of a component whose results are
+// cached, such as integrations
+type ComponentCheck struct {
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	CheckedAt  *time.Time `json:"checked_at,omitempty"` // Unset until the first check finishes
+	DurationMS int64      `json:"duration_ms"`
+}
+
+// RestartWorkerRequest represents a request to drain and restart a worker
+type RestartWorkerRequest struct {
+	DrainTimeoutSeconds int `json:"drain_timeout_seconds,omitempty"` // Default 600; restart even if VMs remain after this
+}
+
+// ReconcileWorkerResponse lists what reconciling a worker's VMs changed
+type ReconcileWorkerResponse struct {
+	WorkerID string   `json:"worker_id"`
+	Adopted  []string `json:"adopted"` // VMs found running that the worker didn't track
+	Failed   []string `json:"failed"`  // VMs recorded as running that the worker no longer has
+}
+
+// HostCheck is the result of checking one prerequisite on a worker's host
+type HostCheck struct {
+	Name   string `json:"name"` // kvm, vhost-vsock, firecracker, kernel, rootfs, bridge or disk
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"` // What was found, or why the check failed
+}
+
+// WorkerDiagnosticsResponse reports whether a worker's host can run VMs
+type WorkerDiagnosticsResponse struct {
+	WorkerID  string      `json:"worker_id"`
+	Ready     bool        `json:"ready"`  // Every check passed
+	Failed    []string    `json:"failed"` // Names of the failed checks
+	Checks    []HostCheck `json:"checks"`
+	CheckedAt time.Time   `json:"checked_at"`
+	// Live is false when the worker couldn't be asked, and the report is
+	// the one from its last heartbeat; Error says why
+	Live  bool   `json:"live"`
+	Error string `json:"error,omitempty"`
+}
+
+// RebalanceClusterRequest represents a request to move idle workspace VMs
+// from busy workers to less loaded ones
+type RebalanceClusterRequest struct {
+	DryRun    bool    `json:"dry_run,omitempty"`   // Only return the plan
+	MaxMoves  int     `json:"max_moves,omitempty"` // Default 10
+	Threshold float64 `json:"threshold,omitempty"` // Minimum load difference in percentage points; default 20
+}
+
+// SimulateSchedulerRequest represents hypothetical VMs to place on the
+// cluster, in order, without creating them
+type SimulateSchedulerRequest struct {
+	Strategy   string                `json:"strategy,omitempty"` // Default: the gateway's strategy, else spread
+	VMs        []SimulatedVMRequest  `json:"vms"`
+	AddWorkers []SimulatedWorkerSpec `json:"add_workers,omitempty"` // Hypothetical workers to add to the cluster
+}
+
+// SimulatedVMRequest is a group of identical hypothetical VMs. With an
+// environment, its resources and placement settings apply.
+type SimulatedVMRequest struct {
+	Name          string   `json:"name,omitempty"`
+	Count         int      `json:"count,omitempty"` // Default 1
+	VCPUs         int      `json:"vcpus,omitempty"`
+	MemoryMB      int      `json:"memory_mb,omitempty"`
+	EnvironmentID string   `json:"environment_id,omitempty"`
+	Zone          string   `json:"zone,omitempty"`
+	ZoneRequired  bool     `json:"zone_required,omitempty"`
+	Capabilities  []string `json:"capabilities,omitempty"`
+}
+
+// SimulatedWorkerSpec is a hypothetical worker for a scheduler simulation
+type SimulatedWorkerSpec struct {
+	ID           string   `json:"id,omitempty"`
+	Count        int      `json:"count,omitempty"` // Default 1
+	Zone         string   `json:"zone,omitempty"`
+	MemoryMB     int64    `json:"memory_mb"`
+	MaxVMs       int      `json:"max_vms"`
+	Capabilities []string `json:"capabilities,omitempty"`
 }
 
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
-	Code    int    `json:"code"`
+	Error      string `json:"error"`
+	Message    string `json:"message"`
+	Code       int    `json:"code"`
+	LimitBytes int64  `json:"limit_bytes,omitempty"` // Set with 413: the route's maximum body size
+}
+
+// EnvironmentInUseResponse is returned with 409 when deleting an environment
+// that workspaces still reference
+type EnvironmentInUseResponse struct {
+	ErrorResponse
+	Workspaces []*WorkspaceResponse `json:"workspaces"`
 }
 
 // Proxy-related models
@@ -233,13 +666,59 @@ type CreateWorkspaceRequest struct {
 	PrepSteps         []PrepStepRequest      `json:"prep_steps,omitempty"`
 	AdditionalTools   []string               `json:"additional_tools,omitempty"`
 	ToolVersions      map[string]string      `json:"tool_versions,omitempty"`
+	Project           string                 `json:"project,omitempty"` // Scopes searches; kept in the workspace's metadata
 }
 
 // CreateWorkspaceResponse represents a workspace creation response
 type CreateWorkspaceResponse struct {
+	TaskID        uuid.UUID `json:"task_id"`
+	WorkspaceID   uuid.UUID `json:"workspace_id"`
+	Status        string    `json:"status"`
+	QueuePosition int       `json:"queue_position,omitempty"` // Set when queued behind a saturated cluster
+}
+
+// SearchResponse lists the prompts and workspaces matching a search, most
+// relevant first. Highlights are HTML with matches wrapped in <mark>.
+type SearchResponse struct {
+	Query      string                `json:"query"`
+	Prompts    []*PromptSearchHit    `json:"prompts"`
+	Workspaces []*WorkspaceSearchHit `json:"workspaces"`
+	Total      int                   `json:"total"`
+}
+
+// PromptSearchHit is a prompt whose text or output matches a search
+type PromptSearchHit struct {
+	PromptID        uuid.UUID `json:"prompt_id"`
+	WorkspaceID     uuid.UUID `json:"workspace_id"`
+	WorkspaceName   string    `json:"workspace_name"`
+	Status          string    `json:"status"`
+	CreatedAt       time.Time `json:"created_at"`
+	Score           float64   `json:"score"`
+	PromptHighlight string    `json:"prompt_highlight"`
+	StdoutHighlight string    `json:"stdout_highlight,omitempty"` // Set when the output matches
+}
+
+// WorkspaceSearchHit is a workspace whose name matches a search
+type WorkspaceSearchHit struct {
+	ID            uuid.UUID `json:"id"`
+	Name          string    `json:"name"`
+	Status        string    `json:"status"`
+	Score         float64   `json:"score"`
+	NameHighlight string    `json:"name_highlight"`
+}
+
+// CloneWorkspaceRequest creates a workspace from another one, with a copy of
+// its working directory
+type CloneWorkspaceRequest struct {
+	Name        string `json:"name,omitempty"` // Default: the source's name with a -clone suffix
+	Description string `json:"description,omitempty"`
+}
+
+// RetryWorkspaceResponse is returned when a failed workspace is resubmitted
+type RetryWorkspaceResponse struct {
 	TaskID      uuid.UUID `json:"task_id"`
 	WorkspaceID uuid.UUID `json:"workspace_id"`
-	Status      string    `json:"status"`
+	ResumeFrom  string    `json:"resume_from,omitempty"` // Last completed phase; empty if starting over
 }
 
 // PrepStepResponse represents a preparation step response
@@ -260,13 +739,39 @@ type PrepStepResponse struct {
 
 // SecretResponse represents a secret response (value is never returned)
 type SecretResponse struct {
-	ID          uuid.UUID `json:"id"`
-	Name        string    `json:"name"`
-	Type        string    `json:"type"`
-	Description string    `json:"description,omitempty"`
-	Scope       string    `json:"scope"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID            uuid.UUID  `json:"id"`
+	Name          string     `json:"name"`
+	Type          string     `json:"type"`
+	Description   string     `json:"description,omitempty"`
+	Scope         string     `json:"scope"`                    // workspace, global or environment
+	WorkspaceID   *uuid.UUID `json:"workspace_id,omitempty"`
+	EnvironmentID *uuid.UUID `json:"environment_id,omitempty"` // Set for secrets inherited from an environment
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	LastUsedAt    *time.Time `json:"last_used_at,omitempty"` // When it last reached a VM; unset if never
+}
+
+// SecretUsageResponse is one time a secret reached a VM
+type SecretUsageResponse struct {
+	RequestType string     `json:"request_type"` // vm_boot or prompt
+	WorkspaceID *uuid.UUID `json:"workspace_id,omitempty"`
+	VMID        *uuid.UUID `json:"vm_id,omitempty"`
+	UsedAt      time.Time  `json:"used_at"`
+}
+
+// ListSecretUsageResponse lists a secret's latest usages, newest first
+type ListSecretUsageResponse struct {
+	SecretID   uuid.UUID              `json:"secret_id"`
+	LastUsedAt *time.Time             `json:"last_used_at,omitempty"`
+	Usages     []*SecretUsageResponse `json:"usages"`
+	Total      int                    `json:"total"`
+}
+
+// UnusedSecretsResponse lists secrets that haven't reached a VM since Since
+type UnusedSecretsResponse struct {
+	Since   time.Time         `json:"since"`
+	Secrets []*SecretResponse `json:"secrets"`
+	Total   int               `json:"total"`
 }
 
 // WorkspaceResponse represents workspace information
@@ -285,16 +790,120 @@ type WorkspaceResponse struct {
 	ReadyAt           *time.Time             `json:"ready_at,omitempty"`
 	StoppedAt         *time.Time             `json:"stopped_at,omitempty"`
 	IdleSince         *time.Time             `json:"idle_since,omitempty"`
+	CreatePhase       string                 `json:"create_phase,omitempty"` // Last completed creation phase
 	Metadata          map[string]interface{} `json:"metadata,omitempty"`
+	Cluster           string                 `json:"cluster,omitempty"` // Federated cluster the workspace lives in (federated lists)
+	Annotations       *Annotations           `json:"annotations,omitempty"`
 	// Nested data (included on detail view)
 	PrepSteps []PrepStepResponse `json:"prep_steps,omitempty"`
 	Secrets   []SecretResponse   `json:"secrets,omitempty"`
 }
 
+// Annotations describe a workspace or environment to people: who owns it,
+// what it is for and where to read more
+type Annotations struct {
+	Owner     string           `json:"owner,omitempty"`
+	Purpose   string           `json:"purpose,omitempty"`
+	Links     []AnnotationLink `json:"links,omitempty"`
+	Notes     string           `json:"notes,omitempty"`      // Markdown
+	NotesHTML string           `json:"notes_html,omitempty"` // Notes rendered to HTML, safe to embed
+}
+
+// AnnotationLink points to a related page, e.g. a runbook or a ticket
+type AnnotationLink struct {
+	Title string `json:"title,omitempty"`
+	URL   string `json:"url"` // http or https
+}
+
+// PatchAnnotationsRequest edits the annotations of a workspace or an
+// environment
+type PatchAnnotationsRequest struct {
+	Annotations *AnnotationsPatch `json:"annotations"`
+}
+
+// AnnotationsPatch sets the annotations given. Ones left out keep their
+// value; an empty value removes one.
+type AnnotationsPatch struct {
+	Owner   *string           `json:"owner,omitempty"`
+	Purpose *string           `json:"purpose,omitempty"`
+	Links   *[]AnnotationLink `json:"links,omitempty"`
+	Notes   *string           `json:"notes,omitempty"`
+}
+
 // ListWorkspacesResponse represents a list of workspaces
 type ListWorkspacesResponse struct {
-	Workspaces []*WorkspaceResponse `json:"workspaces"`
-	Total      int                  `json:"total"`
+	Workspaces    []*WorkspaceResponse `json:"workspaces"`
+	Total         int                  `json:"total"`
+	ClusterErrors []ClusterError       `json:"cluster_errors,omitempty"` // Unreachable clusters (federated lists)
+}
+
+// WorkspaceStatusChangeResponse is one entry in a workspace's status history
+type WorkspaceStatusChangeResponse struct {
+	FromStatus string    `json:"from_status,omitempty"` // Empty for the initial status
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WorkspaceHistoryResponse lists a workspace's status changes, oldest first
+type WorkspaceHistoryResponse struct {
+	WorkspaceID uuid.UUID                       `json:"workspace_id"`
+	Status      string                          `json:"status"`
+	History     []WorkspaceStatusChangeResponse `json:"history"`
+}
+
+// WorkspaceUsageResponse is a workspace's activity over the analytics window
+type WorkspaceUsageResponse struct {
+	WorkspaceID   uuid.UUID              `json:"workspace_id"`
+	Name          string                 `json:"name"`
+	EnvironmentID *uuid.UUID             `json:"environment_id,omitempty"`
+	Status        string                 `json:"status"`
+	Prompts       int                    `json:"prompts"`
+	PromptsPerDay float64                `json:"prompts_per_day"`
+	AvgDurationMs float64                `json:"avg_duration_ms"`
+	FailureRate   float64                `json:"failure_rate"` // Of finished prompts
+	IdleRatio     float64                `json:"idle_ratio"`   // Of VM time, with no prompt running
+	VMHours       float64                `json:"vm_hours"`
+	Daily         []DailyPromptsResponse `json:"daily"` // One entry per day of the window, oldest first
+}
+
+// DailyPromptsResponse counts the prompts submitted on a (UTC) day
+type DailyPromptsResponse struct {
+	Date    string `json:"date"` // YYYY-MM-DD
+	Prompts int    `json:"prompts"`
+}
+
+// EnvironmentUsageResponse rolls up the usage of an environment's workspaces
+type EnvironmentUsageResponse struct {
+	EnvironmentID *uuid.UUID `json:"environment_id,omitempty"` // Unset for workspaces without an environment
+	Name          string     `json:"name,omitempty"`
+	Workspaces    int        `json:"workspaces"`
+	Prompts       int        `json:"prompts"`
+	VMHours       float64    `json:"vm_hours"`
+	IdleRatio     float64    `json:"idle_ratio"`
+}
+
+// WorkspaceAnalyticsResponse reports workspace usage since Since, most
+// prompted workspaces first
+type WorkspaceAnalyticsResponse struct {
+	Since        time.Time                  `json:"since"`
+	Days         int                        `json:"days"`
+	Workspaces   []WorkspaceUsageResponse   `json:"workspaces"`
+	Environments []EnvironmentUsageResponse `json:"environments"`
+	Total        int                        `json:"total"`
+}
+
+// PreviewPort is a port the workspace VM listens on, with its preview URL
+type PreviewPort struct {
+	Port int    `json:"port"`
+	URL  string `json:"url"` // Carries an access token; opening it sets a cookie for the rest of the app
+}
+
+// WorkspacePortsResponse lists a workspace's previewable ports
+type WorkspacePortsResponse struct {
+	WorkspaceID uuid.UUID     `json:"workspace_id"`
+	Ports       []PreviewPort `json:"ports"`
+	ExpiresAt   time.Time     `json:"expires_at"` // When the URLs' tokens stop working
 }
 
 // SubmitPromptRequest represents a prompt submission request
@@ -303,7 +912,35 @@ type SubmitPromptRequest struct {
 	SystemPrompt     string                 `json:"system_prompt,omitempty"`
 	WorkingDirectory string                 `json:"working_directory,omitempty"`
 	Environment      map[string]interface{} `json:"environment,omitempty"`
-	Priority         int                    `json:"priority,omitempty"` // 0-10, default 5
+	Priority         int                    `json:"priority,omitempty"`        // 0-10, default 5
+	TimeoutSeconds   int                    `json:"timeout_seconds,omitempty"` // Overrides the environment's prompt timeout
+	Attachments      []uuid.UUID            `json:"attachments,omitempty"`     // IDs of files uploaded to the workspace's attachments
+	WorkloadClass    string                 `json:"workload_class,omitempty"`  // "interactive" or "batch" (default)
+}
+
+// PromptAttachmentResponse represents a file uploaded for a prompt
+type PromptAttachmentResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	WorkspaceID uuid.UUID  `json:"workspace_id"`
+	PromptID    *uuid.UUID `json:"prompt_id,omitempty"`
+	Name        string     `json:"name"`
+	SizeBytes   int64      `json:"size_bytes"`
+	SHA256      string     `json:"sha256"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CleanedAt   *time.Time `json:"cleaned_at,omitempty"`
+}
+
+// PromptCheckpointResponse is the latest checkpoint of a running prompt:
+// its output so far and the uncommitted changes it made
+type PromptCheckpointResponse struct {
+	PromptID      uuid.UUID `json:"prompt_id"`
+	Attempt       int       `json:"attempt"`
+	Sequence      int       `json:"sequence"`
+	Stdout        string    `json:"stdout"`
+	Stderr        string    `json:"stderr"`
+	Diff          string    `json:"diff"`
+	DiffTruncated bool      `json:"diff_truncated"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
 // SubmitPromptResponse represents a prompt submission response
@@ -311,7 +948,8 @@ type SubmitPromptResponse struct {
 	PromptID    uuid.UUID `json:"prompt_id"`
 	WorkspaceID uuid.UUID `json:"workspace_id"`
 	Status      string    `json:"status"`
-	Position    int       `json:"position,omitempty"` // Position in queue
+	Position    int       `json:"position,omitempty"`    // Position in queue
+	ETASeconds  int       `json:"eta_seconds,omitempty"` // Rough time until the prompt finishes
 }
 
 // PromptResponse represents a prompt task response
@@ -334,6 +972,62 @@ type PromptResponse struct {
 	CompletedAt      *time.Time             `json:"completed_at,omitempty"`
 	DurationMS       *int                   `json:"duration_ms,omitempty"`
 	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+	ExecutionEnv     *ExecutionEnvironment  `json:"execution_env,omitempty"`
+	TimeoutSeconds   *int                   `json:"timeout_seconds,omitempty"`
+
+	// Why a failed prompt failed (tool_missing, auth_error, out_of_memory,
+	// network_blocked, assistant_crash, agent_error, spawn_failed,
+	// worker_lost, timeout or unknown),
+	// the output or event showing it, and a suggested fix
+	FailureReason string `json:"failure_reason,omitempty"`
+	FailureDetail string `json:"failure_detail,omitempty"`
+	Remediation   string `json:"remediation,omitempty"`
+
+	// Queue position (pending prompts) and rough time until the prompt
+	// finishes (pending and running prompts)
+	Position   int `json:"position,omitempty"`
+	ETASeconds int `json:"eta_seconds,omitempty"`
+
+	// Attempt the prompt is on, and the earlier attempts that failed for
+	// an infrastructure reason (spawn_failed, agent_error, worker_lost)
+	// and were retried on another worker
+	Attempt  int              `json:"attempt"`
+	Attempts []*PromptAttempt `json:"attempts,omitempty"`
+
+	// Files attached to the prompt (only when getting one prompt)
+	Attachments []*PromptAttachmentResponse `json:"attachments,omitempty"`
+}
+
+// PromptAttempt is an earlier, retried attempt of a prompt
+type PromptAttempt struct {
+	Attempt       int        `json:"attempt"`
+	WorkerID      string     `json:"worker_id,omitempty"`
+	VMID          *uuid.UUID `json:"vm_id,omitempty"`
+	FailureReason string     `json:"failure_reason"`
+	Error         string     `json:"error,omitempty"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	FinishedAt    time.Time  `json:"finished_at"`
+}
+
+// ExecutionEnvironment is what a prompt ran against, captured by the worker
+// just before running it
+type ExecutionEnvironment struct {
+	WorkerID             string            `json:"worker_id,omitempty"`
+	VMID                 string            `json:"vm_id"`
+	EnvironmentID        *uuid.UUID        `json:"environment_id,omitempty"`
+	EnvironmentName      string            `json:"environment_name,omitempty"`
+	EnvironmentUpdatedAt *time.Time        `json:"environment_updated_at,omitempty"`
+	GitRepoURL           string            `json:"git_repo_url,omitempty"`
+	GitBranch            string            `json:"git_branch,omitempty"`
+	RootFSImage          string            `json:"rootfs_image,omitempty"`
+	RootFSImageSHA256    string            `json:"rootfs_image_sha256,omitempty"`
+	ToolVersions         map[string]string `json:"tool_versions"`
+	AIAssistant          string            `json:"ai_assistant"`
+	AgentVersion         string            `json:"agent_version,omitempty"`
+	GitCommit            string            `json:"git_commit,omitempty"`
+	EnvVarNames          []string          `json:"env_var_names"`
+	WorkingDir           string            `json:"working_directory,omitempty"`
+	CapturedAt           time.Time         `json:"captured_at"`
 }
 
 // ListPromptsResponse represents a list of prompts
@@ -409,34 +1103,90 @@ type MCPServerRequest struct {
 	Env     map[string]string `json:"env,omitempty"`
 }
 
+// SandboxProfile represents VM sandbox settings for running untrusted code
+type SandboxProfile struct {
+	ReadOnlyRootFS bool   `json:"read_only_rootfs,omitempty"`
+	TmpfsWorkdir   string `json:"tmpfs_workdir,omitempty"` // Writable tmpfs mounted over this path
+	TmpfsSizeMB    int    `json:"tmpfs_size_mb,omitempty"`
+	NoNetwork      bool   `json:"no_network,omitempty"`
+	RestrictProc   bool   `json:"restrict_proc,omitempty"` // Hide other users' processes in /proc
+}
+
+// DockerProfile represents the Docker daemon run in an environment's VMs
+type DockerProfile struct {
+	Enabled    bool     `json:"enabled"`                // false on update removes Docker
+	DiskSizeMB int      `json:"disk_size_mb,omitempty"` // Rootfs size for images and volumes (0 = image size)
+	Registries []string `json:"registries,omitempty"`   // Whitelisted next to Docker Hub, e.g. ["ghcr.io"]
+}
+
+// RedactionPolicy represents how secrets are masked in output from an
+// environment's VMs. The zero policy masks the workspace's secrets and
+// common token formats.
+type RedactionPolicy struct {
+	Disabled     bool     `json:"disabled,omitempty"`      // Store output as is
+	SkipPatterns bool     `json:"skip_patterns,omitempty"` // Mask only secret values, not token formats
+	Patterns     []string `json:"patterns,omitempty"`      // Extra regular expressions to mask
+}
+
+// ServiceSpec represents a sidecar service VM started with each workspace VM
+type ServiceSpec struct {
+	Name        string            `json:"name"`            // Hostname the workspace VM reaches it by
+	Command     string            `json:"command"`         // Started in the background of the service VM
+	Ports       []int             `json:"ports,omitempty"` // Waited for before the workspace is ready
+	Env         map[string]string `json:"env,omitempty"`
+	RootFSImage string            `json:"rootfs_image,omitempty"` // Image with the service installed
+	VCPUs       int               `json:"vcpus,omitempty"`
+	MemoryMB    int               `json:"memory_mb,omitempty"`
+}
+
 // CreateEnvironmentRequest represents an environment creation request
 type CreateEnvironmentRequest struct {
-	Name               string             `json:"name" binding:"required"`
-	Description        string             `json:"description,omitempty"`
-	VCPUs              int                `json:"vcpus,omitempty"`
-	MemoryMB           int                `json:"memory_mb,omitempty"`
-	GitRepoURL         string             `json:"git_repo_url,omitempty"`
-	GitBranch          string             `json:"git_branch,omitempty"`
-	WorkingDirectory   string             `json:"working_directory,omitempty"`
-	Tools              []string           `json:"tools,omitempty"`
-	EnvVars            map[string]string  `json:"env_vars,omitempty"`
-	MCPServers         []MCPServerRequest `json:"mcp_servers,omitempty"`
-	IdleTimeoutSeconds int                `json:"idle_timeout_seconds,omitempty"`
+	Name                 string             `json:"name" binding:"required"`
+	Description          string             `json:"description,omitempty"`
+	VCPUs                int                `json:"vcpus,omitempty"`
+	MemoryMB             int                `json:"memory_mb,omitempty"`
+	GitRepoURL           string             `json:"git_repo_url,omitempty"`
+	GitBranch            string             `json:"git_branch,omitempty"`
+	WorkingDirectory     string             `json:"working_directory,omitempty"`
+	Tools                []string           `json:"tools,omitempty"`
+	EnvVars              map[string]string  `json:"env_vars,omitempty"`
+	MCPServers           []MCPServerRequest `json:"mcp_servers,omitempty"`
+	IdleTimeoutSeconds   int                `json:"idle_timeout_seconds,omitempty"`
+	PromptTimeoutSeconds int                `json:"prompt_timeout_seconds,omitempty"` // Default prompt time limit (0 = worker default)
+	Sandbox              *SandboxProfile    `json:"sandbox,omitempty"`
+	KernelArgs           []string           `json:"kernel_args,omitempty"`         // Extra kernel boot args, e.g. ["quiet"]
+	Services             []ServiceSpec      `json:"services,omitempty"`            // Sidecar service VMs
+	Docker               *DockerProfile     `json:"docker,omitempty"`              // Docker daemon in the VMs
+	FailoverPolicy       string             `json:"failover_policy,omitempty"`     // "none" (default) or "any_zone"
+	Region               string             `json:"region,omitempty"`              // Federated cluster region (empty = this cluster)
+	SchedulingStrategy   string             `json:"scheduling_strategy,omitempty"` // e.g. "binpack" (empty = the gateway's)
+	Redaction            *RedactionPolicy   `json:"redaction,omitempty"`           // Secret masking in output (nil = default)
+	Platform             string             `json:"platform,omitempty"`            // "linux" (default) or "windows"
 }
 
 // UpdateEnvironmentRequest represents an environment update request
 type UpdateEnvironmentRequest struct {
-	Name               string             `json:"name,omitempty"`
-	Description        string             `json:"description,omitempty"`
-	VCPUs              int                `json:"vcpus,omitempty"`
-	MemoryMB           int                `json:"memory_mb,omitempty"`
-	GitRepoURL         string             `json:"git_repo_url,omitempty"`
-	GitBranch          string             `json:"git_branch,omitempty"`
-	WorkingDirectory   string             `json:"working_directory,omitempty"`
-	Tools              []string           `json:"tools,omitempty"`
-	EnvVars            map[string]string  `json:"env_vars,omitempty"`
-	MCPServers         []MCPServerRequest `json:"mcp_servers,omitempty"`
-	IdleTimeoutSeconds int                `json:"idle_timeout_seconds,omitempty"`
+	Name                 string             `json:"name,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	VCPUs                int                `json:"vcpus,omitempty"`
+	MemoryMB             int                `json:"memory_mb,omitempty"`
+	GitRepoURL           string             `json:"git_repo_url,omitempty"`
+	GitBranch            string             `json:"git_branch,omitempty"`
+	WorkingDirectory     string             `json:"working_directory,omitempty"`
+	Tools                []string           `json:"tools,omitempty"`
+	EnvVars              map[string]string  `json:"env_vars,omitempty"`
+	MCPServers           []MCPServerRequest `json:"mcp_servers,omitempty"`
+	IdleTimeoutSeconds   int                `json:"idle_timeout_seconds,omitempty"`
+	PromptTimeoutSeconds int                `json:"prompt_timeout_seconds,omitempty"` // Default prompt time limit (0 = worker default)
+	Sandbox              *SandboxProfile    `json:"sandbox,omitempty"`
+	KernelArgs           []string           `json:"kernel_args,omitempty"`         // Extra kernel boot args, e.g. ["quiet"]
+	Services             []ServiceSpec      `json:"services,omitempty"`            // Sidecar service VMs; [] removes them
+	Docker               *DockerProfile     `json:"docker,omitempty"`              // Docker daemon in the VMs
+	FailoverPolicy       string             `json:"failover_policy,omitempty"`     // "none" (default) or "any_zone"
+	Region               *string            `json:"region,omitempty"`              // Federated cluster region ("" = this cluster)
+	SchedulingStrategy   *string            `json:"scheduling_strategy,omitempty"` // e.g. "binpack" ("" = the gateway's)
+	Redaction            *RedactionPolicy   `json:"redaction,omitempty"`           // Secret masking in output ({} = default)
+	Platform             *string            `json:"platform,omitempty"`            // "linux" or "windows"
 }
 
 // MCPServerResponse represents an MCP server configuration in responses
@@ -452,24 +1202,144 @@ type MCPServerResponse struct {
 
 // EnvironmentResponse represents environment information
 type EnvironmentResponse struct {
-	ID                 uuid.UUID           `json:"id"`
-	Name               string              `json:"name"`
-	Description        string              `json:"description,omitempty"`
-	VCPUs              int                 `json:"vcpus"`
-	MemoryMB           int                 `json:"memory_mb"`
-	GitRepoURL         string              `json:"git_repo_url,omitempty"`
-	GitBranch          string              `json:"git_branch"`
-	WorkingDirectory   string              `json:"working_directory"`
-	Tools              []string            `json:"tools"`
-	EnvVars            map[string]string   `json:"env_vars,omitempty"`
-	MCPServers         []MCPServerResponse `json:"mcp_servers,omitempty"`
-	IdleTimeoutSeconds int                 `json:"idle_timeout_seconds"`
-	CreatedAt          time.Time           `json:"created_at"`
-	UpdatedAt          time.Time           `json:"updated_at"`
+	ID                   uuid.UUID             `json:"id"`
+	Name                 string                `json:"name"`
+	Description          string                `json:"description,omitempty"`
+	VCPUs                int                   `json:"vcpus"`
+	MemoryMB             int                   `json:"memory_mb"`
+	GitRepoURL           string                `json:"git_repo_url,omitempty"`
+	GitBranch            string                `json:"git_branch"`
+	WorkingDirectory     string                `json:"working_directory"`
+	Tools                []string              `json:"tools"`
+	EnvVars              map[string]string     `json:"env_vars,omitempty"`
+	MCPServers           []MCPServerResponse   `json:"mcp_servers,omitempty"`
+	IdleTimeoutSeconds   int                   `json:"idle_timeout_seconds"`
+	PromptTimeoutSeconds int                   `json:"prompt_timeout_seconds,omitempty"`
+	Sandbox              *SandboxProfile       `json:"sandbox,omitempty"`
+	KernelArgs           []string              `json:"kernel_args,omitempty"`
+	Services             []ServiceSpec         `json:"services,omitempty"`
+	Docker               *DockerProfile        `json:"docker,omitempty"`
+	FailoverPolicy       string                `json:"failover_policy"`
+	Region               string                `json:"region,omitempty"`
+	SchedulingStrategy   string                `json:"scheduling_strategy,omitempty"`
+	Redaction            *RedactionPolicy      `json:"redaction,omitempty"`
+	Platform             string                `json:"platform"`
+	Cluster              string                `json:"cluster,omitempty"` // Federated cluster the environment lives in (federated lists)
+	RootFSImage          string                `json:"rootfs_image,omitempty"`
+	RootFSImageWorkerID  string                `json:"rootfs_image_worker_id,omitempty"` // Worker holding the saved image; workspaces are created there
+	SourceWorkspaceID    *uuid.UUID            `json:"source_workspace_id,omitempty"`
+	ToolLock             *EnvironmentLockfile  `json:"tool_lock,omitempty"`
+	Firewall             *types.FirewallPolicy `json:"firewall,omitempty"`
+	Annotations          *Annotations          `json:"annotations,omitempty"`
+	CreatedAt            time.Time             `json:"created_at"`
+	UpdatedAt            time.Time             `json:"updated_at"`
+}
+
+// LockEnvironmentToolsRequest sets version constraints ("20", "1.23.0",
+// "latest") for individual tools when locking an environment's tools
+type LockEnvironmentToolsRequest struct {
+	Versions map[string]string `json:"versions,omitempty"`
+}
+
+// EnvironmentLockfile represents the pinned tool releases of an environment
+type EnvironmentLockfile struct {
+	Tools                []LockedTool `json:"tools"`
+	EnvironmentUpdatedAt time.Time    `json:"environment_updated_at"`
+	ResolvedAt           time.Time    `json:"resolved_at"`
+}
+
+// LockedTool represents one pinned tool release
+type LockedTool struct {
+	Name       string `json:"name"`
+	Constraint string `json:"constraint"`
+	Version    string `json:"version"`
+	Artifact   string `json:"artifact,omitempty"`
+	Checksum   string `json:"checksum,omitempty"`
 }
 
 // ListEnvironmentsResponse represents a list of environments
 type ListEnvironmentsResponse struct {
-	Environments []*EnvironmentResponse `json:"environments"`
-	Total        int                    `json:"total"`
+	Environments  []*EnvironmentResponse `json:"environments"`
+	Total         int                    `json:"total"`
+	ClusterErrors []ClusterError         `json:"cluster_errors,omitempty"` // Unreachable clusters (federated lists)
+}
+
+// SaveAsEnvironmentRequest represents a request to save a workspace as an environment
+type SaveAsEnvironmentRequest struct {
+	Name           string `json:"name" binding:"required"`
+	Description    string `json:"description,omitempty"`
+	SnapshotRootFS bool   `json:"snapshot_rootfs,omitempty"` // Also capture the VM's rootfs as the environment image
+}
+
+// SaveAsEnvironmentResponse represents the result of saving a workspace as an environment
+type SaveAsEnvironmentResponse struct {
+	Environment    *EnvironmentResponse `json:"environment"`
+	SnapshotTaskID *uuid.UUID           `json:"snapshot_task_id,omitempty"`
+}
+
+// SLOObjectiveResponse represents the error budget of one objective of a
+// service level objective
+type SLOObjectiveResponse struct {
+	Target          string  `json:"target"`
+	Endpoint        string  `json:"endpoint,omitempty"`
+	TaskType        string  `json:"task_type,omitempty"`
+	Objective       string  `json:"objective"` // availability or latency
+	Goal            float64 `json:"goal"`      // % that must be good
+	LatencyMS       int64   `json:"latency_ms,omitempty"`
+	Total           int64   `json:"total"`
+	Bad             int64   `json:"bad"`
+	SLI             float64 `json:"sli"`
+	BudgetRemaining float64 `json:"budget_remaining"` // % of the window's budget left
+	BurnRate1h      float64 `json:"burn_rate_1h"`
+	BurnRate6h      float64 `json:"burn_rate_6h"`
+	BurnRateWindow  float64 `json:"burn_rate_window"`
+	Status          string  `json:"status"` // ok, at_risk or exhausted
+}
+
+// SLOReportResponse represents the error budgets of all service level objectives
+type SLOReportResponse struct {
+	WindowSeconds int                     `json:"window_seconds"`
+	Objectives    []*SLOObjectiveResponse `json:"objectives"`
+	GeneratedAt   time.Time               `json:"generated_at"`
+}
+
+// TranscriptEntryResponse represents a link of the transcript chain
+type TranscriptEntryResponse struct {
+	Seq         int64     `json:"seq"`
+	Kind        string    `json:"kind"` // execution or prompt
+	RecordID    uuid.UUID `json:"record_id"`
+	ContentHash string    `json:"content_hash"`
+	PrevHash    string    `json:"prev_hash"`
+	Hash        string    `json:"hash"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ListTranscriptEntriesResponse represents transcript chain entries in chain order
+type ListTranscriptEntriesResponse struct {
+	Entries []*TranscriptEntryResponse `json:"entries"`
+	Total   int                        `json:"total"`
+}
+
+// TranscriptRecordIssue represents a chained record that no longer matches its entry
+type TranscriptRecordIssue struct {
+	Kind     string    `json:"kind"`
+	RecordID uuid.UUID `json:"record_id"`
+	Seq      int64     `json:"seq"`
+	Reason   string    `json:"reason"`
+}
+
+// TranscriptVerificationResponse represents the outcome of verifying the transcript chain
+type TranscriptVerificationResponse struct {
+	Valid             bool                    `json:"valid"`
+	Entries           int64                   `json:"entries"`
+	HeadSeq           int64                   `json:"head_seq"`
+	HeadHash          string                  `json:"head_hash,omitempty"`
+	BrokenAt          *int64                  `json:"broken_at,omitempty"`
+	BreakReason       string                  `json:"break_reason,omitempty"`
+	Anchors           int                     `json:"anchors"`
+	AnchorMismatch    []int64                 `json:"anchor_mismatch,omitempty"`
+	ModifiedRecords   []TranscriptRecordIssue `json:"modified_records,omitempty"`
+	MissingRecords    int                     `json:"missing_records"`
+	InProgressRecords int                     `json:"in_progress_records"`
+	VerifiedAt        time.Time               `json:"verified_at"`
 }
@@ -1,3 +1,5 @@
+//go:build !noconsul
+
 package consul
 
 import (
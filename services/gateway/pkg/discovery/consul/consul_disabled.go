@@ -0,0 +1,23 @@
+//go:build noconsul
+
+package consul
+
+import (
+	"errors"
+
+	"github.com/aetherium/aetherium/services/gateway/pkg/discovery"
+)
+
+// ErrDisabled is returned by NewConsulRegistry in binaries built with the
+// noconsul tag
+var ErrDisabled = errors.New("consul support not compiled in (built with -tags noconsul)")
+
+// ConsulRegistry is a placeholder so callers build without the Consul client
+type ConsulRegistry struct {
+	discovery.ServiceRegistry
+}
+
+// NewConsulRegistry always fails; rebuild without the noconsul tag to use Consul
+func NewConsulRegistry(config *discovery.ConsulConfig, healthCheck discovery.HealthCheckConfig) (*ConsulRegistry, error) {
+	return nil, ErrDisabled
+}
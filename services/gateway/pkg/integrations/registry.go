@@ -4,21 +4,58 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
+)
+
+// Defaults for integration health checks
+const (
+	DefaultHealthTTL     = 30 * time.Second
+	DefaultHealthTimeout = 5 * time.Second
 )
 
 // Registry manages registered integrations
 type Registry struct {
 	mu           sync.RWMutex
 	integrations map[string]Integration
+
+	healthMu      sync.Mutex
+	health        map[string]*healthEntry
+	healthTTL     time.Duration
+	healthTimeout time.Duration
+}
+
+// HealthStatus is the result of an integration's last health check
+type HealthStatus struct {
+	Err       error
+	CheckedAt time.Time // Zero until the first check finishes
+	Duration  time.Duration
+}
+
+// healthEntry is an integration's cached health and its running check
+type healthEntry struct {
+	status HealthStatus
+	done   chan struct{} // Closed when the running check finishes; nil when none runs
 }
 
 // NewRegistry creates a new integration registry
 func NewRegistry() *Registry {
 	return &Registry{
-		integrations: make(map[string]Integration),
+		integrations:  make(map[string]Integration),
+		health:        make(map[string]*healthEntry),
+		healthTTL:     DefaultHealthTTL,
+		healthTimeout: DefaultHealthTimeout,
 	}
 }
 
+// SetHealthCheckOptions sets how long health results are cached and how
+// long a single check may take
+func (r *Registry) SetHealthCheckOptions(ttl, timeout time.Duration) {
+	r.healthMu.Lock()
+	defer r.healthMu.Unlock()
+	r.healthTTL = ttl
+	r.healthTimeout = timeout
+}
+
 // Register adds an integration to the registry
 func (r *Registry) Register(integration Integration) error {
 	r.mu.Lock()
@@ -68,9 +105,29 @@ func (r *Registry) Unregister(name string) error {
 	}
 
 	delete(r.integrations, name)
+
+	r.healthMu.Lock()
+	delete(r.health, name)
+	r.healthMu.Unlock()
 	return nil
 }
 
+// Replace registers an integration under name, whatever its Name(), and
+// returns the one it replaces, if any, for the caller to close. Integrations
+// configured at runtime are registered under their config's name.
+func (r *Registry) Replace(name string, integration Integration) Integration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.integrations[name]
+	r.integrations[name] = integration
+
+	r.healthMu.Lock()
+	delete(r.health, name)
+	r.healthMu.Unlock()
+	return previous
+}
+
 // Close closes all integrations
 func (r *Registry) Close() error {
 	r.mu.Lock()
@@ -90,15 +147,95 @@ func (r *Registry) Close() error {
 	return nil
 }
 
-// HealthCheck checks the health of all integrations
+// HealthCheck checks the health of all integrations (see HealthStatuses)
 func (r *Registry) HealthCheck(ctx context.Context) map[string]error {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	statuses := r.HealthStatuses(ctx)
+	results := make(map[string]error, len(statuses))
+	for name, status := range statuses {
+		results[name] = status.Err
+	}
+	return results
+}
 
-	results := make(map[string]error)
+// HealthStatuses returns the health of all integrations. Results younger
+// than the TTL are served from cache; stale ones are checked again, all
+// integrations at once and each within the check timeout, so a slow
+// integration neither delays the others nor holds up the caller for longer
+// than the timeout. Concurrent callers share running checks.
+func (r *Registry) HealthStatuses(ctx context.Context) map[string]HealthStatus {
+	r.mu.RLock()
+	integrations := make(map[string]Integration, len(r.integrations))
 	for name, integration := range r.integrations {
-		results[name] = integration.Health(ctx)
+		integrations[name] = integration
+	}
+	r.mu.RUnlock()
+
+	var running []chan struct{}
+	r.healthMu.Lock()
+	for name, integration := range integrations {
+		entry, ok := r.health[name]
+		if !ok {
+			entry = &healthEntry{}
+			r.health[name] = entry
+		}
+		if entry.done == nil && time.Since(entry.status.CheckedAt) >= r.healthTTL {
+			entry.done = make(chan struct{})
+			go r.checkHealth(integration, entry, r.healthTimeout)
+		}
+		if entry.done != nil {
+			running = append(running, entry.done)
+		}
 	}
+	r.healthMu.Unlock()
 
+	for _, done := range running {
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+
+	r.healthMu.Lock()
+	defer r.healthMu.Unlock()
+
+	results := make(map[string]HealthStatus, len(integrations))
+	for name := range integrations {
+		entry, ok := r.health[name]
+		if !ok {
+			continue // Unregistered meanwhile
+		}
+		status := entry.status
+		if status.CheckedAt.IsZero() {
+			status.Err = fmt.Errorf("health check pending")
+		}
+		results[name] = status
+	}
 	return results
 }
+
+// checkHealth runs an integration's health check and records the result.
+// Checks that outlive the timeout without returning, e.g. stuck resolving a
+// host name, are recorded as failed and left to finish on their own.
+func (r *Registry) checkHealth(integration Integration, entry *healthEntry, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	startedAt := time.Now()
+	result := make(chan error, 1)
+	go func() {
+		result <- integration.Health(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = fmt.Errorf("health check timed out after %s", timeout)
+	}
+
+	r.healthMu.Lock()
+	defer r.healthMu.Unlock()
+	entry.status = HealthStatus{Err: err, CheckedAt: time.Now(), Duration: time.Since(startedAt)}
+	close(entry.done)
+	entry.done = nil
+}
@@ -0,0 +1,80 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// drainRetryAfter is the Retry-After hint given to clients while draining
+const drainRetryAfter = 5 * time.Second
+
+// Draining reports whether the manager has stopped accepting sessions
+func (m *SessionManager) Draining() bool {
+	return m.draining.Load()
+}
+
+// Drain stops accepting new sessions, tells connected clients to reconnect
+// (to another replica) and closes each session once its queued messages are
+// written. Sessions running a prompt are closed when the prompt finishes.
+// Drain returns when every session is closed or ctx expires; call Shutdown
+// afterwards to close any that remain.
+func (m *SessionManager) Drain(ctx context.Context) {
+	m.draining.Store(true)
+
+	m.mu.RLock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, session)
+	}
+	m.mu.RUnlock()
+
+	log.Printf("Draining %d WebSocket sessions", len(sessions))
+
+	for _, session := range sessions {
+		session.sendMessage(&OutgoingMessage{
+			Type:         MessageTypeReconnect,
+			SessionID:    session.ID,
+			Content:      "Gateway is restarting, reconnect to continue",
+			RetryAfterMS: drainRetryAfter.Milliseconds(),
+			Timestamp:    time.Now(),
+		})
+		if !session.busy.Load() {
+			session.requestClose()
+		}
+	}
+
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		m.mu.RLock()
+		remaining := len(m.sessions)
+		m.mu.RUnlock()
+
+		if remaining == 0 {
+			log.Println("All WebSocket sessions drained")
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Drain deadline reached with %d sessions still open", remaining)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// requestClose asks the write pump to send a close frame after the messages
+// already queued, so nothing sent before draining is lost
+func (s *Session) requestClose() {
+	s.closeRequest.Do(func() {
+		select {
+		case s.send <- nil:
+		default:
+			// Buffer full, the client isn't keeping up
+			s.cleanup()
+		}
+	})
+}
@@ -6,12 +6,17 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
 	"github.com/aetherium/aetherium/services/core/pkg/queue"
 	"github.com/aetherium/aetherium/services/core/pkg/storage"
 	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/aetherium/aetherium/services/gateway/pkg/api"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
@@ -24,68 +29,137 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-// SessionManager handles WebSocket sessions for AI workspaces
+// sessionTopicPrefix is the event bus topic prefix for workspace session fan-out
+const sessionTopicPrefix = "workspace.session."
+
+// promptPollInterval is how often queued prompts are checked for completion
+const promptPollInterval = 1 * time.Second
+
+// PromptSubmitter queues prompts for a worker to execute
+type PromptSubmitter interface {
+	SubmitPrompt(ctx context.Context, workspaceID uuid.UUID, req *api.SubmitPromptRequest) (uuid.UUID, error)
+}
+
+// SessionManager handles WebSocket sessions for AI workspaces.
+//
+// With an event bus set, conversation messages are published per workspace
+// and every replica delivers them to its own connections, so clients of the
+// same workspace can be spread across gateway replicas.
 type SessionManager struct {
-	store        storage.Store
-	orchestrator vmm.VMOrchestrator
-	sessions     map[uuid.UUID]*Session
-	mu           sync.RWMutex
+	store         storage.Store
+	orchestrator  vmm.VMOrchestrator
+	prompts       PromptSubmitter
+	terminals     TerminalDialer
+	eventBus      events.EventBus
+	gatewayID     string
+	sessions      map[uuid.UUID]*Session
+	subscriptions map[uuid.UUID]string // Workspace ID -> event bus subscription ID
+	draining      atomic.Bool
+	mu            sync.RWMutex
 }
 
-// NewSessionManager creates a new session manager
+// NewSessionManager creates a new session manager. The orchestrator may be nil
+// when prompts are executed by workers (see SetPromptSubmitter).
 func NewSessionManager(store storage.Store, orchestrator vmm.VMOrchestrator) *SessionManager {
 	return &SessionManager{
-		store:        store,
-		orchestrator: orchestrator,
-		sessions:     make(map[uuid.UUID]*Session),
+		store:         store,
+		orchestrator:  orchestrator,
+		sessions:      make(map[uuid.UUID]*Session),
+		subscriptions: make(map[uuid.UUID]string),
 	}
 }
 
+// SetGatewayID sets the replica ID recorded as the owner of new sessions
+func (m *SessionManager) SetGatewayID(id string) {
+	m.gatewayID = id
+}
+
+// SetEventBus enables fan-out of session messages across gateway replicas
+func (m *SessionManager) SetEventBus(bus events.EventBus) {
+	m.eventBus = bus
+}
+
+// SetPromptSubmitter routes prompts through the task queue instead of the
+// local orchestrator
+func (m *SessionManager) SetPromptSubmitter(p PromptSubmitter) {
+	m.prompts = p
+}
+
 // Session represents an active WebSocket session
 type Session struct {
-	ID          uuid.UUID
-	WorkspaceID uuid.UUID
-	Conn        *websocket.Conn
-	Manager     *SessionManager
-	send        chan []byte
-	done        chan struct{}
-	mu          sync.Mutex
+	ID           uuid.UUID
+	WorkspaceID  uuid.UUID
+	Conn         *websocket.Conn
+	Manager      *SessionManager
+	send         chan []byte
+	done         chan struct{}
+	closeOnce    sync.Once
+	closeRequest sync.Once
+	busy         atomic.Bool      // A prompt is being processed
+	terminal     *sessionTerminal // Open terminal, see terminal.go
+	mu           sync.Mutex
 }
 
 // Message types for WebSocket communication
 type MessageType string
 
 const (
-	MessageTypePrompt   MessageType = "prompt"
-	MessageTypeResponse MessageType = "response"
-	MessageTypeError    MessageType = "error"
-	MessageTypeStatus   MessageType = "status"
-	MessageTypePing     MessageType = "ping"
-	MessageTypePong     MessageType = "pong"
+	MessageTypePrompt    MessageType = "prompt"
+	MessageTypeResponse  MessageType = "response"
+	MessageTypeError     MessageType = "error"
+	MessageTypeStatus    MessageType = "status"
+	MessageTypePing      MessageType = "ping"
+	MessageTypePong      MessageType = "pong"
+	MessageTypeReconnect MessageType = "reconnect" // Gateway is draining, reconnect elsewhere
 )
 
 // IncomingMessage represents a message from the client
 type IncomingMessage struct {
+	Version          int                    `json:"v,omitempty"` // See ProtocolVersion
 	Type             MessageType            `json:"type"`
 	Prompt           string                 `json:"prompt,omitempty"`
 	SystemPrompt     string                 `json:"system_prompt,omitempty"`
 	WorkingDirectory string                 `json:"working_directory,omitempty"`
 	Environment      map[string]interface{} `json:"environment,omitempty"`
+
+	// Terminal messages
+	Data   string `json:"data,omitempty"` // Input or pasted text
+	Cols   uint16 `json:"cols,omitempty"`
+	Rows   uint16 `json:"rows,omitempty"`
+	Signal string `json:"signal,omitempty"`
+
+	// File drops
+	Name   string `json:"name,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	Path   string `json:"path,omitempty"` // Directory to drop into
+	DropID string `json:"drop_id,omitempty"`
+	Chunk  []byte `json:"chunk,omitempty"` // Base64 in JSON
 }
 
 // OutgoingMessage represents a message to the client
 type OutgoingMessage struct {
-	Type      MessageType `json:"type"`
-	SessionID uuid.UUID   `json:"session_id,omitempty"`
-	MessageID uuid.UUID   `json:"message_id,omitempty"`
-	Content   string      `json:"content,omitempty"`
-	ExitCode  *int        `json:"exit_code,omitempty"`
-	Error     string      `json:"error,omitempty"`
-	Timestamp time.Time   `json:"timestamp"`
+	Version      int         `json:"v,omitempty"` // Set on the welcome message
+	Type         MessageType `json:"type"`
+	SessionID    uuid.UUID   `json:"session_id,omitempty"`
+	MessageID    uuid.UUID   `json:"message_id,omitempty"`
+	Content      string      `json:"content,omitempty"`
+	ExitCode     *int        `json:"exit_code,omitempty"`
+	Error        string      `json:"error,omitempty"`
+	RetryAfterMS int64       `json:"retry_after_ms,omitempty"` // Set on reconnect messages
+	DropID       string      `json:"drop_id,omitempty"`        // Set on file drop messages
+	Path         string      `json:"path,omitempty"`
+	ChunkSize    int         `json:"chunk_size,omitempty"`
+	Timestamp    time.Time   `json:"timestamp"`
 }
 
 // HandleSession handles a WebSocket connection for a workspace session
 func (m *SessionManager) HandleSession(w http.ResponseWriter, r *http.Request, workspaceID uuid.UUID) {
+	if m.Draining() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(drainRetryAfter.Seconds())))
+		http.Error(w, "Gateway is draining, reconnect to another replica", http.StatusServiceUnavailable)
+		return
+	}
+
 	// Verify workspace exists and is ready
 	workspace, err := m.store.Workspaces().Get(r.Context(), workspaceID)
 	if err != nil {
@@ -93,7 +167,7 @@ func (m *SessionManager) HandleSession(w http.ResponseWriter, r *http.Request, w
 		return
 	}
 
-	if workspace.Status != "ready" {
+	if workspace.Status != storage.WorkspaceStatusReady {
 		http.Error(w, fmt.Sprintf("Workspace is not ready (status: %s)", workspace.Status), http.StatusBadRequest)
 		return
 	}
@@ -113,11 +187,14 @@ func (m *SessionManager) HandleSession(w http.ResponseWriter, r *http.Request, w
 	dbSession := &storage.WorkspaceSession{
 		ID:           sessionID,
 		WorkspaceID:  workspaceID,
-		Status:       "connected",
+		Status:       "active",
 		ClientIP:     &clientIP,
 		ConnectedAt:  now,
 		LastActivity: now,
 	}
+	if m.gatewayID != "" {
+		dbSession.GatewayID = &m.gatewayID
+	}
 
 	if err := m.store.Sessions().Create(r.Context(), dbSession); err != nil {
 		log.Printf("Failed to create session record: %v", err)
@@ -136,12 +213,11 @@ func (m *SessionManager) HandleSession(w http.ResponseWriter, r *http.Request, w
 	}
 
 	// Register session
-	m.mu.Lock()
-	m.sessions[sessionID] = session
-	m.mu.Unlock()
+	m.register(session)
 
 	// Send welcome message
 	session.sendMessage(&OutgoingMessage{
+		Version:   ProtocolVersion,
 		Type:      MessageTypeStatus,
 		SessionID: sessionID,
 		Content:   fmt.Sprintf("Connected to workspace: %s", workspace.Name),
@@ -181,6 +257,10 @@ func (s *Session) readPump(workspace *storage.Workspace) {
 			s.sendError("Invalid message format")
 			continue
 		}
+		if incoming.Version > ProtocolVersion {
+			s.sendError(fmt.Sprintf("Unsupported protocol version %d, this gateway speaks %d", incoming.Version, ProtocolVersion))
+			continue
+		}
 
 		// Handle message based on type
 		switch incoming.Type {
@@ -190,7 +270,20 @@ func (s *Session) readPump(workspace *storage.Workspace) {
 				Timestamp: time.Now(),
 			})
 		case MessageTypePrompt:
+			if s.Manager.Draining() {
+				s.sendError("Gateway is draining, reconnect to submit prompts")
+				continue
+			}
+			s.busy.Store(true)
 			s.handlePrompt(workspace, &incoming)
+			s.busy.Store(false)
+			if s.Manager.Draining() {
+				s.requestClose()
+			}
+		case MessageTypeTerminalOpen, MessageTypeTerminalInput, MessageTypeTerminalPaste,
+			MessageTypeTerminalResize, MessageTypeTerminalSignal, MessageTypeTerminalClose,
+			MessageTypeFileDrop, MessageTypeFileChunk:
+			s.handleTerminalMessage(workspace, &incoming)
 		default:
 			s.sendError(fmt.Sprintf("Unknown message type: %s", incoming.Type))
 		}
@@ -216,6 +309,12 @@ func (s *Session) writePump() {
 				s.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
+			if message == nil {
+				// Close requested after flushing queued messages (see requestClose)
+				s.Conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseServiceRestart, "gateway restarting"))
+				return
+			}
 
 			w, err := s.Conn.NextWriter(websocket.TextMessage)
 			if err != nil {
@@ -237,7 +336,8 @@ func (s *Session) writePump() {
 	}
 }
 
-// handlePrompt processes a prompt from the client
+// handlePrompt processes a prompt from the client. The prompt and its
+// response are broadcast to every session on the workspace.
 func (s *Session) handlePrompt(workspace *storage.Workspace, incoming *IncomingMessage) {
 	ctx := context.Background()
 	messageID := uuid.New()
@@ -254,72 +354,49 @@ func (s *Session) handlePrompt(workspace *storage.Workspace, incoming *IncomingM
 		log.Printf("Failed to store prompt message: %v", err)
 	}
 
+	s.Manager.broadcast(ctx, s.WorkspaceID, &OutgoingMessage{
+		Type:      MessageTypePrompt,
+		SessionID: s.ID,
+		MessageID: messageID,
+		Content:   incoming.Prompt,
+		Timestamp: time.Now(),
+	})
+
 	// Send acknowledgment
-	s.sendMessage(&OutgoingMessage{
+	s.Manager.broadcast(ctx, s.WorkspaceID, &OutgoingMessage{
 		Type:      MessageTypeStatus,
 		MessageID: messageID,
 		Content:   "Processing prompt...",
 		Timestamp: time.Now(),
 	})
 
-	// Determine working directory
-	workingDir := workspace.WorkingDirectory
-	if incoming.WorkingDirectory != "" {
-		workingDir = incoming.WorkingDirectory
-	}
-
-	// Build AI command based on workspace configuration
-	var aiCmd string
-	escapedPrompt := escapeShellArg(incoming.Prompt)
-
-	switch workspace.AIAssistant {
-	case "claude-code":
-		aiCmd = fmt.Sprintf("cd %s && claude-code --dangerously-skip-permissions '%s'", workingDir, escapedPrompt)
-	case "ampcode", "amp":
-		aiCmd = fmt.Sprintf("cd %s && amp '%s'", workingDir, escapedPrompt)
-	default:
-		s.sendError(fmt.Sprintf("Unknown AI assistant: %s", workspace.AIAssistant))
-		return
-	}
+	var exitCode *int
+	var stdout, stderr string
+	var err error
 
-	// Execute command in VM
-	vmID := ""
-	if workspace.VMID != nil {
-		vmID = workspace.VMID.String()
+	if s.Manager.orchestrator != nil {
+		exitCode, stdout, stderr, err = s.executeDirect(ctx, workspace, incoming)
+	} else if s.Manager.prompts != nil {
+		exitCode, stdout, stderr, err = s.executeQueued(ctx, workspace, incoming)
 	} else {
-		s.sendError("Workspace has no VM assigned")
-		return
-	}
-
-	cmd := &vmm.Command{
-		Cmd:  "bash",
-		Args: []string{"-c", aiCmd},
+		err = fmt.Errorf("no prompt executor configured")
 	}
 
-	result, err := s.Manager.orchestrator.ExecuteCommand(ctx, vmID, cmd)
-
-	var exitCode *int
-	var stdout, stderr string
-
 	if err != nil {
-		s.sendMessage(&OutgoingMessage{
+		s.Manager.broadcast(ctx, s.WorkspaceID, &OutgoingMessage{
 			Type:      MessageTypeError,
 			MessageID: messageID,
 			Error:     fmt.Sprintf("Failed to execute command: %v", err),
 			Timestamp: time.Now(),
 		})
 	} else {
-		exitCode = &result.ExitCode
-		stdout = result.Stdout
-		stderr = result.Stderr
-
 		// Send response
 		content := stdout
-		if stderr != "" && result.ExitCode != 0 {
+		if stderr != "" && exitCode != nil && *exitCode != 0 {
 			content += "\n\nStderr:\n" + stderr
 		}
 
-		s.sendMessage(&OutgoingMessage{
+		s.Manager.broadcast(ctx, s.WorkspaceID, &OutgoingMessage{
 			Type:      MessageTypeResponse,
 			MessageID: messageID,
 			Content:   content,
@@ -350,6 +427,90 @@ func (s *Session) handlePrompt(workspace *storage.Workspace, incoming *IncomingM
 	}
 }
 
+// executeDirect runs the prompt in the workspace VM through the local orchestrator
+func (s *Session) executeDirect(ctx context.Context, workspace *storage.Workspace, incoming *IncomingMessage) (*int, string, string, error) {
+	// Determine working directory
+	workingDir := workspace.WorkingDirectory
+	if incoming.WorkingDirectory != "" {
+		workingDir = incoming.WorkingDirectory
+	}
+
+	// Build AI command based on workspace configuration
+	var aiCmd string
+	escapedPrompt := escapeShellArg(incoming.Prompt)
+
+	switch workspace.AIAssistant {
+	case "claude-code":
+		aiCmd = fmt.Sprintf("cd %s && claude-code --dangerously-skip-permissions '%s'", workingDir, escapedPrompt)
+	case "ampcode", "amp":
+		aiCmd = fmt.Sprintf("cd %s && amp '%s'", workingDir, escapedPrompt)
+	default:
+		return nil, "", "", fmt.Errorf("unknown AI assistant: %s", workspace.AIAssistant)
+	}
+
+	if workspace.VMID == nil {
+		return nil, "", "", fmt.Errorf("workspace has no VM assigned")
+	}
+
+	cmd := &vmm.Command{
+		Cmd:  "bash",
+		Args: []string{"-c", aiCmd},
+	}
+
+	result, err := s.Manager.orchestrator.ExecuteCommand(ctx, workspace.VMID.String(), cmd)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	return &result.ExitCode, result.Stdout, result.Stderr, nil
+}
+
+// executeQueued submits the prompt to the task queue and waits for a worker to finish it
+func (s *Session) executeQueued(ctx context.Context, workspace *storage.Workspace, incoming *IncomingMessage) (*int, string, string, error) {
+	promptID, err := s.Manager.prompts.SubmitPrompt(ctx, workspace.ID, &api.SubmitPromptRequest{
+		Prompt:           incoming.Prompt,
+		SystemPrompt:     incoming.SystemPrompt,
+		WorkingDirectory: incoming.WorkingDirectory,
+		Environment:      incoming.Environment,
+		WorkloadClass:    string(queue.WorkloadInteractive), // Someone is waiting in the session
+	})
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	ticker := time.NewTicker(promptPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return nil, "", "", fmt.Errorf("session closed before prompt %s finished", promptID)
+		case <-ticker.C:
+		}
+
+		prompt, err := s.Manager.store.PromptTasks().Get(ctx, promptID)
+		if err != nil {
+			return nil, "", "", err
+		}
+
+		if !storage.IsTerminalPromptStatus(prompt.Status) {
+			continue
+		}
+
+		var stdout, stderr string
+		if prompt.Stdout != nil {
+			stdout = *prompt.Stdout
+		}
+		if prompt.Stderr != nil {
+			stderr = *prompt.Stderr
+		}
+		if prompt.ExitCode == nil && prompt.Error != nil {
+			return nil, stdout, stderr, fmt.Errorf("%s", *prompt.Error)
+		}
+		return prompt.ExitCode, stdout, stderr, nil
+	}
+}
+
 // sendMessage sends a message to the client
 func (s *Session) sendMessage(msg *OutgoingMessage) {
 	data, err := json.Marshal(msg)
@@ -382,19 +543,156 @@ func (s *Session) updateActivity() {
 
 // cleanup cleans up the session
 func (s *Session) cleanup() {
-	close(s.done)
-	s.Conn.Close()
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.Conn.Close()
+		s.closeTerminal(s.currentTerminal())
 
-	// Update session status in database
-	ctx := context.Background()
-	s.Manager.store.Sessions().UpdateStatus(ctx, s.ID, "disconnected")
+		// Update session status in database
+		ctx := context.Background()
+		s.Manager.store.Sessions().UpdateStatus(ctx, s.ID, "disconnected")
+
+		// Remove from active sessions
+		s.Manager.unregister(s)
+
+		log.Printf("Session %s disconnected", s.ID)
+	})
+}
+
+// register adds a local session, subscribing to its workspace's fan-out topic
+// when it is the first local session on that workspace
+func (m *SessionManager) register(session *Session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[session.ID] = session
+
+	if m.eventBus == nil {
+		return
+	}
+	if _, ok := m.subscriptions[session.WorkspaceID]; ok {
+		return
+	}
+
+	workspaceID := session.WorkspaceID
+	subID, err := m.eventBus.Subscribe(context.Background(), sessionTopicPrefix+workspaceID.String(),
+		func(ctx context.Context, event *types.Event) error {
+			message, ok := event.Data["message"].(string)
+			if !ok {
+				return fmt.Errorf("session event without message")
+			}
+			m.deliverLocal(workspaceID, []byte(message))
+			return nil
+		})
+	if err != nil {
+		log.Printf("Failed to subscribe to workspace %s sessions: %v", workspaceID, err)
+		return
+	}
+	m.subscriptions[workspaceID] = subID
+}
+
+// unregister removes a local session and drops the workspace subscription
+// once no local sessions remain on it
+func (m *SessionManager) unregister(session *Session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, session.ID)
+
+	subID, ok := m.subscriptions[session.WorkspaceID]
+	if !ok {
+		return
+	}
+	for _, other := range m.sessions {
+		if other.WorkspaceID == session.WorkspaceID {
+			return
+		}
+	}
+
+	delete(m.subscriptions, session.WorkspaceID)
+	if err := m.eventBus.Unsubscribe(context.Background(), sessionTopicPrefix+session.WorkspaceID.String(), subID); err != nil {
+		log.Printf("Failed to unsubscribe from workspace %s sessions: %v", session.WorkspaceID, err)
+	}
+}
+
+// broadcast sends a message to every session on a workspace, on all replicas
+// when an event bus is set
+func (m *SessionManager) broadcast(ctx context.Context, workspaceID uuid.UUID, msg *OutgoingMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to marshal message: %v", err)
+		return
+	}
+
+	if m.eventBus == nil {
+		m.deliverLocal(workspaceID, data)
+		return
+	}
+
+	topic := sessionTopicPrefix + workspaceID.String()
+	event := &types.Event{
+		ID:        uuid.New().String(),
+		Type:      topic,
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"message":    string(data),
+			"gateway_id": m.gatewayID,
+		},
+	}
+	if err := m.eventBus.Publish(ctx, topic, event); err != nil {
+		log.Printf("Failed to publish session message, delivering locally: %v", err)
+		m.deliverLocal(workspaceID, data)
+	}
+}
+
+// deliverLocal queues a message on this replica's sessions for a workspace
+func (m *SessionManager) deliverLocal(workspaceID uuid.UUID, data []byte) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, session := range m.sessions {
+		if session.WorkspaceID != workspaceID {
+			continue
+		}
+		select {
+		case session.send <- data:
+		default:
+			log.Printf("Session %s send buffer full", session.ID)
+		}
+	}
+}
 
-	// Remove from active sessions
-	s.Manager.mu.Lock()
-	delete(s.Manager.sessions, s.ID)
-	s.Manager.mu.Unlock()
+// Shutdown closes this replica's sessions and marks any it still owns in the
+// database as disconnected, including ones left behind by a crash
+func (m *SessionManager) Shutdown(ctx context.Context) {
+	m.mu.RLock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, session)
+	}
+	m.mu.RUnlock()
 
-	log.Printf("Session %s disconnected", s.ID)
+	for _, session := range sessions {
+		session.cleanup()
+	}
+
+	m.ReleaseOwnedSessions(ctx)
+}
+
+// ReleaseOwnedSessions marks sessions recorded for this replica as
+// disconnected. Call it on startup to clear sessions from a previous run.
+func (m *SessionManager) ReleaseOwnedSessions(ctx context.Context) {
+	if m.gatewayID == "" {
+		return
+	}
+	n, err := m.store.Sessions().DisconnectByGateway(ctx, m.gatewayID)
+	if err != nil {
+		log.Printf("Failed to release sessions for gateway %s: %v", m.gatewayID, err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Released %d stale sessions for gateway %s", n, m.gatewayID)
+	}
 }
 
 // GetSession returns a session by ID
@@ -0,0 +1,298 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aetherium/aetherium/libs/common/pkg/events"
+	"github.com/aetherium/aetherium/libs/types/pkg/domain"
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Task stream settings
+const (
+	taskStreamPollInterval  = 1 * time.Second  // Without an event bus
+	taskStreamCheckInterval = 5 * time.Second  // With one, in case progress events were missed
+	taskStreamPingInterval  = 30 * time.Second // Clients must answer within two
+	taskStreamWriteTimeout  = 10 * time.Second
+	taskStreamBuffer        = 256 // Progress events waiting to be written
+)
+
+// Task stream message types, besides MessageTypeError and MessageTypeReconnect
+const (
+	MessageTypeState  MessageType = "state"  // The task's status changed
+	MessageTypeLog    MessageType = "log"    // A worker log line for the task
+	MessageTypeOutput MessageType = "output" // Command output, once the task finished
+	MessageTypeExit   MessageType = "exit"   // The task finished, the last message
+)
+
+// TaskStreamMessage is a message sent to task stream clients
+type TaskStreamMessage struct {
+	Type       MessageType            `json:"type"`
+	TaskID     uuid.UUID              `json:"task_id"`
+	Status     string                 `json:"status,omitempty"`
+	WorkerID   string                 `json:"worker_id,omitempty"`
+	RetryCount int                    `json:"retry_count,omitempty"`
+	Level      string                 `json:"level,omitempty"`
+	Message    string                 `json:"message,omitempty"`
+	Fields     map[string]interface{} `json:"fields,omitempty"`
+	Stream     string                 `json:"stream,omitempty"` // stdout or stderr
+	Data       string                 `json:"data,omitempty"`
+	ExitCode   *int                   `json:"exit_code,omitempty"`
+	DurationMS *int                   `json:"duration_ms,omitempty"`
+	Result     map[string]interface{} `json:"result,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Timestamp  time.Time              `json:"timestamp"`
+}
+
+// IsUpgrade reports whether a request asks for a WebSocket connection
+func IsUpgrade(r *http.Request) bool {
+	return websocket.IsWebSocketUpgrade(r)
+}
+
+// TaskStreamer streams tasks' state transitions and worker log lines to
+// WebSocket clients.
+//
+// Workers publish both on the task's progress topic (see
+// events.TaskProgressTopic). Every state event re-reads the task history,
+// which stays the source of truth: events may arrive out of order or not at
+// all, so the task is also re-read periodically. Without an event bus the
+// task history is polled and no log lines are sent.
+type TaskStreamer struct {
+	store    storage.Store
+	eventBus events.EventBus
+	drain    <-chan struct{}
+}
+
+// NewTaskStreamer creates a task streamer. Streams end with a reconnect
+// message once drain is closed.
+func NewTaskStreamer(store storage.Store, drain <-chan struct{}) *TaskStreamer {
+	return &TaskStreamer{store: store, drain: drain}
+}
+
+// SetEventBus streams task progress as workers publish it
+func (t *TaskStreamer) SetEventBus(bus events.EventBus) {
+	t.eventBus = bus
+}
+
+// taskStream is one client following a task
+type taskStream struct {
+	conn   *websocket.Conn
+	taskID uuid.UUID
+	status string // Last status sent
+}
+
+func (s *taskStream) send(msg *TaskStreamMessage) error {
+	msg.TaskID = s.taskID
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(taskStreamWriteTimeout))
+	return s.conn.WriteJSON(msg)
+}
+
+// close sends a close frame with code and reason
+func (s *taskStream) close(code int, reason string) {
+	s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(taskStreamWriteTimeout))
+}
+
+// HandleTaskStream upgrades to a WebSocket and streams a task until it
+// completes or fails, the client disconnects, the gateway drains or timeout
+// expires. The client gets the task's current state first, then a "state"
+// message on every transition and a "log" message per worker log line. A
+// finished task ends with its command output, if it ran one, and an "exit"
+// message.
+func (t *TaskStreamer) HandleTaskStream(w http.ResponseWriter, r *http.Request, taskID uuid.UUID, timeout time.Duration) {
+	select {
+	case <-t.drain:
+		w.Header().Set("Retry-After", strconv.Itoa(int(drainRetryAfter.Seconds())))
+		http.Error(w, "Gateway is draining, reconnect to another replica", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	// The task's rows may have just been written
+	ctx := storage.WithPrimaryReads(r.Context())
+	if _, err := t.store.Tasks().Get(ctx, taskID); err != nil {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade WebSocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go readTaskStream(conn, cancel)
+
+	// Subscribe before reading the task, so no transition falls in between
+	progress := make(chan *types.Event, taskStreamBuffer)
+	check := time.NewTicker(taskStreamPollInterval)
+	defer check.Stop()
+	if t.eventBus != nil {
+		topic := events.TaskProgressTopic(taskID.String())
+		subID, err := t.eventBus.Subscribe(ctx, topic, func(_ context.Context, event *types.Event) error {
+			select {
+			case progress <- event:
+			default:
+				// The client isn't keeping up; states are still re-read
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Warning: Failed to subscribe to progress of task %s, polling: %v", taskID, err)
+		} else {
+			defer t.eventBus.Unsubscribe(context.Background(), topic, subID)
+			check.Reset(taskStreamCheckInterval)
+		}
+	}
+
+	stream := &taskStream{conn: conn, taskID: taskID}
+	done, err := t.check(ctx, stream)
+	if err != nil {
+		return
+	}
+	if done {
+		stream.close(websocket.CloseNormalClosure, "task finished")
+		return
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ping := time.NewTicker(taskStreamPingInterval)
+	defer ping.Stop()
+
+	for {
+		done, err = false, nil
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.drain:
+			stream.send(&TaskStreamMessage{
+				Type:    MessageTypeReconnect,
+				Message: "Gateway is restarting, reconnect to resume",
+			})
+			stream.close(websocket.CloseServiceRestart, "gateway restarting")
+			return
+		case <-deadline.C:
+			stream.send(&TaskStreamMessage{Type: MessageTypeError, Error: "timed out waiting for completion"})
+			stream.close(websocket.CloseNormalClosure, "timed out")
+			return
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(taskStreamWriteTimeout))
+		case <-check.C:
+			done, err = t.check(ctx, stream)
+		case event := <-progress:
+			switch event.Data["kind"] {
+			case events.TaskProgressState:
+				done, err = t.check(ctx, stream)
+			case events.TaskProgressLog:
+				err = stream.send(taskLogMessage(event))
+			}
+		}
+
+		if err != nil {
+			return
+		}
+		if done {
+			stream.close(websocket.CloseNormalClosure, "task finished")
+			return
+		}
+	}
+}
+
+// readTaskStream reads (and drops) client messages, answering pings, until
+// the connection fails or closes, then cancels the stream
+func readTaskStream(conn *websocket.Conn, cancel context.CancelFunc) {
+	defer cancel()
+
+	conn.SetReadLimit(4 * 1024)
+	conn.SetReadDeadline(time.Now().Add(2 * taskStreamPingInterval))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(2 * taskStreamPingInterval))
+		return nil
+	})
+
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// check re-reads the task, sending its state if it changed and, once it has
+// finished, its result. It reports whether the task has finished.
+func (t *TaskStreamer) check(ctx context.Context, s *taskStream) (bool, error) {
+	task, err := t.store.Tasks().Get(ctx, s.taskID)
+	if err != nil {
+		// Try again on the next event or check
+		log.Printf("Warning: Failed to read task %s for its stream: %v", s.taskID, err)
+		return false, nil
+	}
+
+	if task.Status != s.status {
+		s.status = task.Status
+		msg := &TaskStreamMessage{Type: MessageTypeState, Status: task.Status, RetryCount: task.RetryCount}
+		if task.WorkerID != nil {
+			msg.WorkerID = *task.WorkerID
+		}
+		if task.Status == storage.TaskStatusRetrying && task.Error != nil {
+			msg.Error = *task.Error
+		}
+		if err := s.send(msg); err != nil {
+			return false, err
+		}
+	}
+
+	switch task.Status {
+	case storage.TaskStatusCompleted, storage.TaskStatusFailed:
+		return true, t.finish(ctx, s, task)
+	}
+	return false, nil
+}
+
+// finish sends a finished task's command output, if it ran a command, and
+// its exit message
+func (t *TaskStreamer) finish(ctx context.Context, s *taskStream, task *storage.Task) error {
+	exit := &TaskStreamMessage{Type: MessageTypeExit, Status: task.Status, Result: task.Result}
+	if task.Error != nil {
+		exit.Error = *task.Error
+	}
+
+	if execution, err := t.store.Executions().GetByTaskID(ctx, task.ID); err == nil {
+		for _, output := range []struct {
+			stream string
+			data   *string
+		}{{"stdout", execution.Stdout}, {"stderr", execution.Stderr}} {
+			if output.data == nil || *output.data == "" {
+				continue
+			}
+			if err := s.send(&TaskStreamMessage{Type: MessageTypeOutput, Stream: output.stream, Data: *output.data}); err != nil {
+				return err
+			}
+		}
+		exit.ExitCode = execution.ExitCode
+		exit.DurationMS = execution.DurationMS
+	}
+
+	return s.send(exit)
+}
+
+// taskLogMessage converts a log line published by a worker
+func taskLogMessage(event *types.Event) *TaskStreamMessage {
+	msg := &TaskStreamMessage{Type: MessageTypeLog, Timestamp: event.Timestamp}
+	msg.Level, _ = event.Data["level"].(string)
+	msg.Message, _ = event.Data["message"].(string)
+	msg.Fields, _ = event.Data["fields"].(map[string]interface{})
+	return msg
+}
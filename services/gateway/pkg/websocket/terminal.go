@@ -0,0 +1,432 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aetherium/aetherium/services/core/pkg/storage"
+	"github.com/aetherium/aetherium/services/core/pkg/vmm"
+	"github.com/google/uuid"
+)
+
+// ProtocolVersion is the version of the session message schema. Clients
+// may send it as "v" on every message; messages from newer protocol
+// versions are rejected rather than misread. Messages without it are
+// version 1.
+const ProtocolVersion = 1
+
+// Terminal message types. A session can run one shell in the workspace VM;
+// its output goes only to the session that opened it.
+const (
+	MessageTypeTerminalOpen   MessageType = "terminal_open"   // Client: start a shell of cols x rows
+	MessageTypeTerminalInput  MessageType = "terminal_input"  // Client: keystrokes in data
+	MessageTypeTerminalPaste  MessageType = "terminal_paste"  // Client: pasted text in data
+	MessageTypeTerminalResize MessageType = "terminal_resize" // Client: the window is now cols x rows
+	MessageTypeTerminalSignal MessageType = "terminal_signal" // Client: signal the foreground job, e.g. INT for Ctrl-C
+	MessageTypeTerminalClose  MessageType = "terminal_close"  // Client: hang up the shell
+	MessageTypeTerminalOutput MessageType = "terminal_output" // Server: output in content
+	MessageTypeTerminalExit   MessageType = "terminal_exit"   // Server: the shell exited with exit_code
+	MessageTypeFileDrop       MessageType = "file_drop"       // Client: upload name, size bytes, into path
+	MessageTypeFileChunk      MessageType = "file_chunk"      // Client: next chunk of drop_id, base64
+	MessageTypeFileDropReady  MessageType = "file_drop_ready" // Server: send chunks of up to chunk_size bytes
+	MessageTypeFileDropDone   MessageType = "file_drop_done"  // Server: the file is written to path
+)
+
+// File drops are sent in chunks small enough to stay under the session's
+// 64KB message limit once base64 encoded
+const (
+	fileDropChunkSize = 32 * 1024
+	maxFileDropBytes  = 100 * 1024 * 1024
+)
+
+// Bracketed paste: shells that support it turn the mode on and off at each
+// prompt, and expect pasted text between the paste markers
+var (
+	bracketedPasteOn  = []byte("\x1b[?2004h")
+	bracketedPasteOff = []byte("\x1b[?2004l")
+)
+
+const (
+	pasteStart = "\x1b[200~"
+	pasteEnd   = "\x1b[201~"
+)
+
+// TerminalDialer opens terminals in VMs run by workers
+type TerminalDialer interface {
+	DialTerminal(ctx context.Context, vmID uuid.UUID, req *vmm.TerminalRequest) (io.ReadWriteCloser, error)
+}
+
+// SetTerminalDialer opens session terminals through workers when the
+// session manager has no orchestrator of its own
+func (m *SessionManager) SetTerminalDialer(d TerminalDialer) {
+	m.terminals = d
+}
+
+// openTerminal opens a terminal in a VM, through the local orchestrator or
+// the terminal dialer
+func (m *SessionManager) openTerminal(ctx context.Context, vmID uuid.UUID, req *vmm.TerminalRequest) (io.ReadWriteCloser, error) {
+	if terminals, ok := m.orchestrator.(vmm.Terminals); ok {
+		return terminals.OpenTerminal(ctx, vmID.String(), req)
+	}
+	if m.terminals != nil {
+		return m.terminals.DialTerminal(ctx, vmID, req)
+	}
+	return nil, fmt.Errorf("terminals are not available")
+}
+
+// sessionTerminal is a session's shell in the workspace VM
+type sessionTerminal struct {
+	stream    io.ReadWriteCloser
+	writeMu   sync.Mutex  // Serializes frames written to stream
+	bracketed atomic.Bool // The shell has bracketed paste on
+	mu        sync.Mutex
+	drops     map[string]*fileDrop // By drop ID
+}
+
+// fileDrop is a file being uploaded into the VM through the terminal
+type fileDrop struct {
+	id       string
+	path     string
+	size     int64
+	received int64
+}
+
+// send writes a frame to the terminal
+func (t *sessionTerminal) send(frame *vmm.TerminalFrame) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.stream.Write(append(data, '\n'))
+	return err
+}
+
+// paste returns pasted text as terminal input. Line breaks become carriage
+// returns, as typed. When the shell has bracketed paste on, the text is
+// wrapped in paste markers so it isn't run line by line; end markers inside
+// it, which would run the rest, are removed.
+func (t *sessionTerminal) paste(text string) []byte {
+	text = strings.ReplaceAll(text, "\r\n", "\r")
+	text = strings.ReplaceAll(text, "\n", "\r")
+	if !t.bracketed.Load() {
+		return []byte(text)
+	}
+	return []byte(pasteStart + strings.ReplaceAll(text, pasteEnd, "") + pasteEnd)
+}
+
+// trackBracketedPaste follows the shell turning bracketed paste on and off
+// in its output
+func (t *sessionTerminal) trackBracketedPaste(output []byte) {
+	on := bytes.LastIndex(output, bracketedPasteOn)
+	off := bytes.LastIndex(output, bracketedPasteOff)
+	switch {
+	case on > off:
+		t.bracketed.Store(true)
+	case off > on:
+		t.bracketed.Store(false)
+	}
+}
+
+// takeDrops removes and returns the file drops writing to path
+func (t *sessionTerminal) takeDrops(path string) []*fileDrop {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var drops []*fileDrop
+	for id, drop := range t.drops {
+		if drop.path == path {
+			drops = append(drops, drop)
+			delete(t.drops, id)
+		}
+	}
+	return drops
+}
+
+// handleTerminalMessage handles the terminal and file drop messages of a
+// session
+func (s *Session) handleTerminalMessage(workspace *storage.Workspace, incoming *IncomingMessage) {
+	if incoming.Type == MessageTypeTerminalOpen {
+		s.openTerminal(workspace, incoming)
+		return
+	}
+
+	term := s.currentTerminal()
+	if term == nil {
+		s.sendError("No terminal is open")
+		return
+	}
+
+	var err error
+	switch incoming.Type {
+	case MessageTypeTerminalInput:
+		err = term.send(&vmm.TerminalFrame{Type: vmm.TerminalFrameInput, Data: []byte(incoming.Data)})
+	case MessageTypeTerminalPaste:
+		err = term.send(&vmm.TerminalFrame{Type: vmm.TerminalFrameInput, Data: term.paste(incoming.Data)})
+	case MessageTypeTerminalResize:
+		if incoming.Cols == 0 || incoming.Rows == 0 {
+			s.sendError("Terminal size needs cols and rows")
+			return
+		}
+		err = term.send(&vmm.TerminalFrame{Type: vmm.TerminalFrameResize, Cols: incoming.Cols, Rows: incoming.Rows})
+	case MessageTypeTerminalSignal:
+		signal := strings.TrimPrefix(strings.ToUpper(incoming.Signal), "SIG")
+		if !slices.Contains(vmm.ProcessSignals, signal) {
+			s.sendError(fmt.Sprintf("Signal must be one of %s", strings.Join(vmm.ProcessSignals, ", ")))
+			return
+		}
+		err = term.send(&vmm.TerminalFrame{Type: vmm.TerminalFrameSignal, Signal: signal})
+	case MessageTypeTerminalClose:
+		s.closeTerminal(term)
+	case MessageTypeFileDrop:
+		s.startFileDrop(term, workspace, incoming)
+	case MessageTypeFileChunk:
+		s.writeFileChunk(term, incoming)
+	}
+	if err != nil {
+		s.sendError(fmt.Sprintf("Failed to write to terminal: %v", err))
+	}
+}
+
+// openTerminal starts a shell in the workspace VM, in the workspace's
+// working directory
+func (s *Session) openTerminal(workspace *storage.Workspace, incoming *IncomingMessage) {
+	if s.Manager.Draining() {
+		s.sendError("Gateway is draining, reconnect to open a terminal")
+		return
+	}
+	if s.currentTerminal() != nil {
+		s.sendError("A terminal is already open")
+		return
+	}
+	if workspace.VMID == nil {
+		s.sendError("Workspace has no VM assigned")
+		return
+	}
+
+	req := &vmm.TerminalRequest{
+		Dir:  workspace.WorkingDirectory,
+		Cols: incoming.Cols,
+		Rows: incoming.Rows,
+	}
+	// The stream outlives this message, so it isn't tied to a request context
+	stream, err := s.Manager.openTerminal(context.Background(), *workspace.VMID, req)
+	if err != nil {
+		s.sendError(fmt.Sprintf("Failed to open terminal: %v", err))
+		return
+	}
+
+	term := &sessionTerminal{stream: stream, drops: make(map[string]*fileDrop)}
+	s.mu.Lock()
+	s.terminal = term
+	s.mu.Unlock()
+
+	s.sendMessage(&OutgoingMessage{
+		Type:      MessageTypeStatus,
+		Content:   "Terminal opened",
+		Timestamp: time.Now(),
+	})
+	go s.pumpTerminal(term)
+}
+
+// pumpTerminal relays a terminal's frames to the client until the terminal
+// closes
+func (s *Session) pumpTerminal(term *sessionTerminal) {
+	defer s.closeTerminal(term)
+
+	reader := bufio.NewReader(term.stream)
+	var pending []byte // Incomplete UTF-8 sequence at the end of the last output
+	exited := false
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break
+		}
+		var frame vmm.TerminalFrame
+		if err := json.Unmarshal(line, &frame); err != nil {
+			continue
+		}
+
+		switch frame.Type {
+		case vmm.TerminalFrameOutput:
+			term.trackBracketedPaste(frame.Data)
+			data := append(pending, frame.Data...)
+			n := completeUTF8(data)
+			pending = append([]byte(nil), data[n:]...)
+			if n > 0 {
+				s.sendOrWait(&OutgoingMessage{
+					Type:      MessageTypeTerminalOutput,
+					Content:   string(data[:n]),
+					Timestamp: time.Now(),
+				})
+			}
+		case vmm.TerminalFrameExit:
+			exited = true
+			s.sendOrWait(&OutgoingMessage{
+				Type:      MessageTypeTerminalExit,
+				ExitCode:  frame.ExitCode,
+				Timestamp: time.Now(),
+			})
+		case vmm.TerminalFrameFile:
+			for _, drop := range term.takeDrops(frame.Path) {
+				s.sendOrWait(&OutgoingMessage{
+					Type:      MessageTypeFileDropDone,
+					DropID:    drop.id,
+					Path:      drop.path,
+					Timestamp: time.Now(),
+				})
+			}
+		case vmm.TerminalFrameError:
+			msg := &OutgoingMessage{Type: MessageTypeError, Error: frame.Error, Timestamp: time.Now()}
+			if frame.Path != "" {
+				msg.Error = fmt.Sprintf("Failed to write %s: %s", frame.Path, frame.Error)
+				for _, drop := range term.takeDrops(frame.Path) {
+					msg.DropID = drop.id
+				}
+			}
+			s.sendOrWait(msg)
+		}
+	}
+
+	if !exited && s.currentTerminal() == term {
+		s.sendOrWait(&OutgoingMessage{
+			Type:      MessageTypeTerminalExit,
+			Error:     "terminal connection lost",
+			Timestamp: time.Now(),
+		})
+	}
+}
+
+// startFileDrop starts uploading a file into the VM. It lands in path,
+// default the workspace's working directory, under its own name.
+func (s *Session) startFileDrop(term *sessionTerminal, workspace *storage.Workspace, incoming *IncomingMessage) {
+	name := incoming.Name
+	if name == "" || name == "." || name == ".." || name != path.Base(name) || strings.Contains(name, "\\") {
+		s.sendError("Invalid file name")
+		return
+	}
+	if incoming.Size < 0 || incoming.Size > maxFileDropBytes {
+		s.sendError(fmt.Sprintf("Dropped files are limited to %d bytes", maxFileDropBytes))
+		return
+	}
+	dir := incoming.Path
+	if dir == "" {
+		dir = workspace.WorkingDirectory
+	}
+
+	drop := &fileDrop{id: uuid.New().String(), path: path.Join(dir, name), size: incoming.Size}
+	term.mu.Lock()
+	term.drops[drop.id] = drop
+	term.mu.Unlock()
+
+	s.sendMessage(&OutgoingMessage{
+		Type:      MessageTypeFileDropReady,
+		DropID:    drop.id,
+		Path:      drop.path,
+		ChunkSize: fileDropChunkSize,
+		Timestamp: time.Now(),
+	})
+
+	if drop.size == 0 {
+		if err := term.send(&vmm.TerminalFrame{Type: vmm.TerminalFrameFile, Path: drop.path, EOF: true}); err != nil {
+			s.sendError(fmt.Sprintf("Failed to write to terminal: %v", err))
+		}
+	}
+}
+
+// writeFileChunk sends the next chunk of a file drop to the VM. The agent
+// confirms the last one, completing the drop.
+func (s *Session) writeFileChunk(term *sessionTerminal, incoming *IncomingMessage) {
+	term.mu.Lock()
+	drop, ok := term.drops[incoming.DropID]
+	if !ok {
+		term.mu.Unlock()
+		s.sendError(fmt.Sprintf("Unknown file drop: %s", incoming.DropID))
+		return
+	}
+	n := int64(len(incoming.Chunk))
+	if n == 0 || n > fileDropChunkSize || drop.received+n > drop.size {
+		delete(term.drops, drop.id)
+		term.mu.Unlock()
+		s.sendMessage(&OutgoingMessage{
+			Type:      MessageTypeError,
+			DropID:    drop.id,
+			Error:     fmt.Sprintf("Invalid chunk for %s, the drop is cancelled", drop.path),
+			Timestamp: time.Now(),
+		})
+		return
+	}
+	frame := &vmm.TerminalFrame{
+		Type:   vmm.TerminalFrameFile,
+		Path:   drop.path,
+		Data:   incoming.Chunk,
+		Append: drop.received > 0,
+	}
+	drop.received += n
+	frame.EOF = drop.received == drop.size
+	term.mu.Unlock()
+
+	if err := term.send(frame); err != nil {
+		s.sendError(fmt.Sprintf("Failed to write to terminal: %v", err))
+	}
+}
+
+// currentTerminal returns the session's open terminal, if any
+func (s *Session) currentTerminal() *sessionTerminal {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.terminal
+}
+
+// closeTerminal hangs up a terminal and detaches it from the session
+func (s *Session) closeTerminal(term *sessionTerminal) {
+	if term == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.terminal == term {
+		s.terminal = nil
+	}
+	s.mu.Unlock()
+	term.stream.Close()
+}
+
+// sendOrWait queues a message for the client, waiting for room instead of
+// dropping it like sendMessage: terminal output can't lose pieces
+func (s *Session) sendOrWait(msg *OutgoingMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	select {
+	case s.send <- data:
+	case <-s.done:
+	}
+}
+
+// completeUTF8 returns the length of data without a trailing incomplete
+// UTF-8 sequence, which is completed by the next output
+func completeUTF8(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(data[i]) {
+			continue
+		}
+		if !utf8.FullRune(data[i:]) {
+			return i
+		}
+		break
+	}
+	return len(data)
+}
@@ -291,7 +291,7 @@ func TestWorkerService(t *testing.T) {
 	ctx := context.Background()
 
 	// Create worker service
-	workerService := service.NewWorkerService(store, nil)
+	workerService := service.NewWorkerService(store, nil, nil)
 
 	// Create test workers
 	workers := []storage.Worker{
@@ -490,7 +490,7 @@ func TestVMWorkerAssignment(t *testing.T) {
 	})
 
 	t.Run("GetWorkerVMs", func(t *testing.T) {
-		workerService := service.NewWorkerService(store, nil)
+		workerService := service.NewWorkerService(store, nil, nil)
 
 		vms, err := workerService.GetWorkerVMs(ctx, "vm-worker-01")
 		require.NoError(t, err, "Failed to get worker VMs")
@@ -503,7 +503,7 @@ func TestVMWorkerAssignment(t *testing.T) {
 	})
 
 	t.Run("GetVMDistribution", func(t *testing.T) {
-		workerService := service.NewWorkerService(store, nil)
+		workerService := service.NewWorkerService(store, nil, nil)
 
 		distribution, err := workerService.GetVMDistribution(ctx)
 		require.NoError(t, err, "Failed to get VM distribution")
@@ -531,7 +531,7 @@ func TestMultiWorkerScenario(t *testing.T) {
 	defer cleanupTestDB(t, store)
 
 	ctx := context.Background()
-	workerService := service.NewWorkerService(store, nil)
+	workerService := service.NewWorkerService(store, nil, nil)
 
 	t.Run("SetupThreeWorkerCluster", func(t *testing.T) {
 		// Create 3 workers in different zones